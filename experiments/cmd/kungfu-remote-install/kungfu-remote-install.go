@@ -16,6 +16,7 @@ import (
 	"github.com/lsds/KungFu/srcs/go/utils"
 	"github.com/lsds/KungFu/srcs/go/utils/assert"
 	"github.com/lsds/KungFu/srcs/go/utils/runner/remote"
+	"github.com/lsds/KungFu/srcs/go/utils/ssh"
 )
 
 var flg = struct {
@@ -133,7 +134,7 @@ func (ss shellCmds) RunOn(hostname string) error {
 			Dir:      c.chdir,
 		}
 		log.Infof("running on %s $ %s %q", p.Hostname, p.Prog, p.Args)
-		if err := remote.RemoteRunAll(context.TODO(), *flg.usr, []proc.Proc{p}, true, *flg.logDir); err != nil {
+		if err := remote.RemoteRunAll(context.TODO(), ssh.Options{User: *flg.usr}, []proc.Proc{p}, true, *flg.logDir); err != nil {
 			log.Errorf("failed to run %s $ %s %q: %v", p.Hostname, p.Prog, p.Args, err)
 			return err
 		}
@@ -148,7 +149,7 @@ func waitSSH(hostname string) {
 		Hostname: hostname,
 	}
 	trial := func() bool {
-		err := remote.RemoteRunAll(context.TODO(), *flg.usr, []proc.Proc{p}, true, *flg.logDir)
+		err := remote.RemoteRunAll(context.TODO(), ssh.Options{User: *flg.usr}, []proc.Proc{p}, true, *flg.logDir)
 		if err != nil {
 			log.Warnf("still waiting %s", hostname)
 		}
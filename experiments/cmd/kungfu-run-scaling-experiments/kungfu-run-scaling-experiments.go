@@ -20,6 +20,7 @@ import (
 	"github.com/lsds/KungFu/srcs/go/proc"
 	"github.com/lsds/KungFu/srcs/go/utils"
 	"github.com/lsds/KungFu/srcs/go/utils/runner/remote"
+	"github.com/lsds/KungFu/srcs/go/utils/ssh"
 	"github.com/lsds/KungFu/tests/go/configserver"
 )
 
@@ -102,7 +103,7 @@ func main() {
 
 	pr := plan.DefaultPortRange
 	sp := runtime.SystemParameters{
-		User:            *flg.usr,
+		SSH:             ssh.Options{User: *flg.usr},
 		WorkerPortRange: pr,
 		RunnerPort:      plan.DefaultRunnerPort,
 		HostList:        c.Hostlist,
@@ -167,7 +168,7 @@ func runConfigServer(hostname string, port int) (context.CancelFunc, *sync.WaitG
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
-		if err := remote.RemoteRunAll(ctx, *flg.usr, []proc.Proc{p}, true, *flg.logDir); err != nil {
+		if err := remote.RemoteRunAll(ctx, ssh.Options{User: *flg.usr}, []proc.Proc{p}, true, *flg.logDir); err != nil {
 			log.Errorf("%s failed: %v", p.Name, err)
 		}
 		wg.Done()
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/lsds/KungFu/experiments/sweep"
+)
+
+// comparison compares the work durations of a configuration in the baseline and the current results
+type comparison struct {
+	desc       string
+	base, curr []float64 // seconds of successful runs
+	speedup    float64   // mean of base / mean of curr, > 1 means faster
+	p          float64   // of Welch's t-test, NaN if not enough runs
+}
+
+func (c comparison) verdict(alpha float64) string {
+	switch {
+	case len(c.base) == 0:
+		return "new"
+	case len(c.curr) == 0:
+		return "missing"
+	case math.IsNaN(c.p):
+		return "n/a"
+	case c.p >= alpha:
+		return "~"
+	case c.speedup > 1:
+		return "faster"
+	default:
+		return "REGRESSION"
+	}
+}
+
+// recordKey identifies the configuration of a record
+type recordKey struct {
+	size int
+	e    string
+}
+
+// samples groups the work durations of successful records by configuration, except the ones stopped early
+func samples(rs []sweep.Record) (map[recordKey][]float64, map[recordKey]string) {
+	xs := make(map[recordKey][]float64)
+	descs := make(map[recordKey]string)
+	for _, r := range rs {
+		if !r.OK() || r.EarlyStopped {
+			continue
+		}
+		k := recordKey{r.ClusterSize, r.Experiment.Key()}
+		d := r.WorkDuration
+		if d == 0 {
+			d = r.Duration
+		}
+		xs[k] = append(xs[k], d.Seconds())
+		descs[k] = point(sweep.Config{Cluster: sweep.Cluster{Size: r.ClusterSize}, Experiment: r.Experiment}).String()
+	}
+	return xs, descs
+}
+
+// compare compares the configurations of curr to those of base, in the order of their descriptions
+func compare(base, curr []sweep.Record) []comparison {
+	bs, bDescs := samples(base)
+	cs, cDescs := samples(curr)
+	for k, d := range bDescs {
+		cDescs[k] = d
+	}
+	var cmps []comparison
+	for k, desc := range cDescs {
+		c := comparison{desc: desc, base: bs[k], curr: cs[k], speedup: math.NaN(), p: math.NaN()}
+		if len(c.base) > 0 && len(c.curr) > 0 {
+			c.speedup = mean(c.base) / mean(c.curr)
+			c.p = welch(c.base, c.curr)
+		}
+		cmps = append(cmps, c)
+	}
+	sort.Slice(cmps, func(i, j int) bool { return cmps[i].desc < cmps[j].desc })
+	return cmps
+}
+
+// report writes the comparisons as a table, and returns the number of significant regressions
+func report(w io.Writer, cmps []comparison, alpha float64) int {
+	var regressions int
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "configuration\tbaseline\tcurrent\tspeedup\tp\tverdict\n")
+	for _, c := range cmps {
+		v := c.verdict(alpha)
+		if v == "REGRESSION" {
+			regressions++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%.3f\t%.3g\t%s\n", c.desc, meanDesc(c.base), meanDesc(c.curr), c.speedup, c.p, v)
+	}
+	tw.Flush()
+	return regressions
+}
+
+func meanDesc(xs []float64) string {
+	if len(xs) == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2fs (n=%d)", mean(xs), len(xs))
+}
+
+func mean(xs []float64) float64 {
+	var s float64
+	for _, x := range xs {
+		s += x
+	}
+	return s / float64(len(xs))
+}
+
+func variance(xs []float64) float64 {
+	m := mean(xs)
+	var s float64
+	for _, x := range xs {
+		s += (x - m) * (x - m)
+	}
+	return s / float64(len(xs)-1)
+}
+
+// welch returns the two-sided p-value of Welch's t-test that xs and ys have the same mean,
+// NaN if either has less than 2 samples.
+func welch(xs, ys []float64) float64 {
+	n, m := float64(len(xs)), float64(len(ys))
+	if n < 2 || m < 2 {
+		return math.NaN()
+	}
+	a, b := variance(xs)/n, variance(ys)/m
+	if a+b == 0 {
+		if mean(xs) == mean(ys) {
+			return 1
+		}
+		return 0
+	}
+	t := (mean(xs) - mean(ys)) / math.Sqrt(a+b)
+	df := (a + b) * (a + b) / (a*a/(n-1) + b*b/(m-1))
+	return incompleteBeta(df/2, 0.5, df/(df+t*t))
+}
+
+// incompleteBeta returns the regularized incomplete beta function I_x(a, b), by its continued fraction
+func incompleteBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	if x > (a+1)/(a+b+2) {
+		return 1 - front*betaFraction(b, a, 1-x)/b
+	}
+	return front * betaFraction(a, b, x) / a
+}
+
+// betaFraction evaluates the continued fraction of the incomplete beta function by Lentz's method
+func betaFraction(a, b, x float64) float64 {
+	const (
+		eps  = 1e-12
+		tiny = 1e-300
+	)
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	f := d
+	for i := 1; i <= 200; i++ {
+		m := float64(i)
+		for _, num := range []float64{
+			m * (b - m) * x / ((a + 2*m - 1) * (a + 2*m)),
+			-(a + m) * (a + b + m) * x / ((a + 2*m) * (a + 2*m + 1)),
+		} {
+			d = 1 + num*d
+			if math.Abs(d) < tiny {
+				d = tiny
+			}
+			c = 1 + num/c
+			if math.Abs(c) < tiny {
+				c = tiny
+			}
+			d = 1 / d
+			f *= c * d
+		}
+		if math.Abs(c*d-1) < eps {
+			break
+		}
+	}
+	return f
+}
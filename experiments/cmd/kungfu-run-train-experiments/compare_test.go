@@ -0,0 +1,50 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/lsds/KungFu/experiments/sweep"
+	"github.com/lsds/KungFu/experiments/tfkeras"
+)
+
+func Test_welch(t *testing.T) {
+	tests := []struct {
+		xs, ys []float64
+		p      float64
+	}{
+		{[]float64{1, 2, 3, 4, 5}, []float64{2, 3, 4, 5, 6}, 0.3466},
+		{[]float64{10, 11, 12, 10, 11}, []float64{20, 21, 19, 20, 22}, 0.0000},
+		{[]float64{1, 2, 3}, []float64{1, 2, 3}, 1},
+	}
+	for _, tt := range tests {
+		if p := welch(tt.xs, tt.ys); math.Abs(p-tt.p) > 1e-4 {
+			t.Errorf("welch(%v, %v) = %f, want %f", tt.xs, tt.ys, p, tt.p)
+		}
+	}
+	if p := welch([]float64{1}, []float64{1, 2}); !math.IsNaN(p) {
+		t.Errorf("welch of a single sample = %f, want NaN", p)
+	}
+}
+
+func Test_compare(t *testing.T) {
+	e := tfkeras.New(tfkeras.ResNet50, tfkeras.SyncSgd, 32)
+	records := func(ds ...int) []sweep.Record {
+		var rs []sweep.Record
+		for _, d := range ds {
+			rs = append(rs, sweep.Record{ClusterSize: 4, Experiment: e, WorkDuration: time.Duration(d) * time.Second})
+		}
+		return rs
+	}
+	cmps := compare(records(10, 11, 10, 11), records(20, 21, 20, 21))
+	if len(cmps) != 1 {
+		t.Fatalf("got %d comparisons, want 1", len(cmps))
+	}
+	if v := cmps[0].verdict(0.05); v != "REGRESSION" {
+		t.Errorf("verdict = %s, want REGRESSION", v)
+	}
+	if v := compare(records(10, 11), records(10, 11))[0].verdict(0.05); v != "~" {
+		t.Errorf("verdict = %s, want ~", v)
+	}
+}
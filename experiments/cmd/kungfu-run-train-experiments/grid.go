@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lsds/KungFu/experiments/grid"
+	"github.com/lsds/KungFu/experiments/sweep"
+	"github.com/lsds/KungFu/experiments/tfkeras"
+	"github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/proc"
+)
+
+// parameters of -grid, UPPER_CASE parameters are environment variables of the experiment
+const (
+	paramNP        = `np`
+	paramStrategy  = `strategy`
+	paramModel     = `model`
+	paramOptimizer = `kf-opt`
+	paramBatchSize = `batch-size`
+)
+
+// constraintList is the value of repeated -where flags
+type constraintList []grid.Constraint
+
+func (l *constraintList) String() string {
+	var ds []string
+	for _, c := range *l {
+		ds = append(ds, c.Desc)
+	}
+	return strings.Join(ds, ", ")
+}
+
+func (l *constraintList) Set(val string) error {
+	c, err := grid.ParseConstraint(val)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, c)
+	return nil
+}
+
+// point describes c by the parameters of -grid, so that -where applies to experiments of -experiments as well
+func point(c sweep.Config) grid.Point {
+	strategy := c.Experiment.Strategy
+	if len(strategy) == 0 {
+		strategy = flg.strategy.String()
+	}
+	p := grid.Point{
+		paramNP:        strconv.Itoa(c.Cluster.Size),
+		paramStrategy:  strategy,
+		paramModel:     string(c.Experiment.Model),
+		paramOptimizer: string(c.Experiment.KFOptimizer),
+		paramBatchSize: strconv.Itoa(c.Experiment.BatchSize),
+	}
+	for k, v := range c.Experiment.Envs {
+		p[k] = v
+	}
+	return p
+}
+
+func isEnvName(name string) bool {
+	return name == strings.ToUpper(name)
+}
+
+// fromPoint creates the config of a point of -grid, parameters not in the grid are defaults
+func fromPoint(hl plan.HostList, p grid.Point) (*sweep.Config, error) {
+	e := tfkeras.New(tfkeras.ResNet50, tfkeras.SyncSgd, 32)
+	np := 1
+	for name, val := range p {
+		switch {
+		case name == paramNP:
+			n, err := strconv.Atoi(val)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid %s: %q", name, val)
+			}
+			np = n
+		case name == paramStrategy:
+			s, o, err := base.ParseStrategySpec(val)
+			if err != nil {
+				return nil, err
+			}
+			e.Strategy = base.FormatStrategySpec(*s, *o)
+		case name == paramModel:
+			e.Model = tfkeras.Model(val)
+		case name == paramOptimizer:
+			e.KFOptimizer = tfkeras.KFOptimizer(val)
+		case name == paramBatchSize:
+			n, err := strconv.Atoi(val)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid %s: %q", name, val)
+			}
+			e.BatchSize = n
+		case isEnvName(name):
+			if e.Envs == nil {
+				e.Envs = make(proc.Envs)
+			}
+			e.Envs[name] = val
+		default:
+			return nil, fmt.Errorf("unknown grid parameter %q", name)
+		}
+	}
+	return &sweep.Config{Cluster: sweep.Cluster{Hostlist: hl.ShrinkToFit(np), Size: np}, Experiment: e}, nil
+}
+
+// generateConfigs returns the configs of -grid, or of -cluster-sizes and -experiments, which satisfy all constraints
+func generateConfigs(hl plan.HostList, pool plan.HostList, cs []grid.Constraint) ([]sweep.Config, error) {
+	capacity := grid.Where(fmt.Sprintf("np<=%d, the capacity of a host group", pool.Cap()), func(p grid.Point) bool {
+		return p.Int(paramNP) <= pool.Cap()
+	})
+	cs = append(cs, capacity)
+	var configs []sweep.Config
+	if len(*flg.grid) > 0 {
+		g, err := grid.Parse(*flg.grid)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range g.Product() {
+			c, err := fromPoint(hl, p)
+			if err != nil {
+				return nil, err
+			}
+			configs = append(configs, *c)
+		}
+	} else {
+		sizes, err := parseIntList(*flg.clusterSizes)
+		if err != nil {
+			return nil, err
+		}
+		es := tfkeras.Default()
+		if len(*flg.experiments) > 0 {
+			if es, err = tfkeras.Load(*flg.experiments); err != nil {
+				return nil, err
+			}
+		}
+		configs = sweep.CrossProduct(sweep.GenerateClusters(hl, sizes), es)
+	}
+	var ok []sweep.Config
+	for _, c := range configs {
+		ps, skipped, err := grid.Filter([]grid.Point{point(c)}, cs...)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range skipped {
+			log.Infof("skipping %s: %s", s.Point, s.Reason)
+		}
+		if len(ps) > 0 {
+			ok = append(ok, c)
+		}
+	}
+	log.Infof("%d of %d configurations satisfy all constraints", len(ok), len(configs))
+	return ok, nil
+}
@@ -4,23 +4,24 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/lsds/KungFu/experiments/tfkeras"
+	"github.com/lsds/KungFu/experiments/sweep"
 	"github.com/lsds/KungFu/srcs/go/kungfu/base"
-	"github.com/lsds/KungFu/srcs/go/kungfu/runtime"
 	"github.com/lsds/KungFu/srcs/go/log"
-	"github.com/lsds/KungFu/srcs/go/plan"
 	"github.com/lsds/KungFu/srcs/go/plan/hostfile"
 	"github.com/lsds/KungFu/srcs/go/utils"
-	"github.com/lsds/KungFu/srcs/go/utils/runner/remote"
 )
 
 var flg = struct {
 	hostfile     *string
 	clusterSizes *string
+	experiments  *string
+	grid         *string
+	where        constraintList
 
 	quiet      *bool
 	logDir     *string
@@ -30,9 +31,28 @@ var flg = struct {
 	kfRoot     *string
 
 	strategy base.Strategy
+
+	results  *string
+	resume   *string
+	repeats  *int
+	baseline *string
+	alpha    *float64
+
+	parallel          *int
+	rebalanceInterval *time.Duration
+
+	earlyStop *bool
+	patience  *int
+	minDelta  *float64
+
+	configPort *int
+
+	tags tagMap
 }{
 	hostfile:     flag.String("hostfile", "hosts.txt", ""),
 	clusterSizes: flag.String("cluster-sizes", "", ""),
+	experiments:  flag.String("experiments", "", "JSON file of experiments, each can override environment variables with Envs, set Priority and Deadline, list ResultFiles to collect, and schedule Resizes to run in elastic mode"),
+	grid:         flag.String("grid", "", "run the cross product of parameters instead of -cluster-sizes and -experiments, e.g. \"np=1,2,4,8 strategy=RING,CLIQUE model=ResNet50 kf-opt=sync-sgd batch-size=32,64\", UPPER_CASE parameters are environment variables"),
 
 	quiet:      flag.Bool("q", false, ""),
 	logDir:     flag.String("logdir", ".", ""),
@@ -42,20 +62,35 @@ var flg = struct {
 	kfRoot:     flag.String("kf-root", "./.kungfu/KungFu", ""),
 
 	strategy: base.DefaultStrategy,
+
+	results:  flag.String("results", "results.json", "file to save experiment records to as they finish"),
+	resume:   flag.String("resume", "", "skip experiments already succeeded in the given results file"),
+	repeats:  flag.Int("repeats", 1, "run each configuration this many times, so that -baseline can test the significance of differences"),
+	baseline: flag.String("baseline", "", "results file of a previous sweep to compare the results to, exits with 1 if any configuration is significantly slower"),
+	alpha:    flag.Float64("alpha", 0.05, "significance level of the comparison to -baseline"),
+
+	parallel:          flag.Int("parallel", 1, "split hosts into this many groups, each runs one experiment at a time, idle groups steal experiments from busy ones"),
+	rebalanceInterval: flag.Duration("rebalance-interval", 0, "move queued experiments from groups of long backlog to groups of short backlog at this interval, 0 to only steal when idle"),
+
+	earlyStop: flag.Bool("early-stop", false, "stop an experiment once the metric it reports has plateaued, requires the outputs of peers, so not with -q"),
+	patience:  flag.Int("patience", 3, "number of metric values without change of more than -min-delta before an experiment is stopped early"),
+	minDelta:  flag.Float64("min-delta", 0.01, "relative change of the metric that is not considered a plateau"),
+
+	configPort: flag.Int("config-port", 9100, "port of the config server run on the first host of experiments with Resizes"),
+
+	tags: tagMap{},
 }
 
 func init() {
 	flag.Var(&flg.strategy, "strategy", fmt.Sprintf("all reduce strategy, options are: %s", strings.Join(base.StrategyNames(), " | ")))
+	flag.Var(flg.tags, "tag", "tag stored with the metadata of each record, e.g. lr=0.1, can be repeated")
+	flag.Var(&flg.where, "where", "skip configurations violating the constraint, e.g. \"strategy=CLIQUE => np<=16\", can be repeated")
 }
 
 func main() {
 	flag.Parse()
 	t0 := time.Now()
 	defer func(prog string) { log.Infof("%s finished, took %s", prog, time.Since(t0)) }(utils.ProgName())
-	sizes, err := parseIntList(*flg.clusterSizes)
-	if err != nil {
-		utils.ExitErr(err)
-	}
 	hl, err := hostfile.ParseFile(*flg.hostfile)
 	if err != nil {
 		utils.ExitErr(err)
@@ -65,48 +100,65 @@ func main() {
 		fmt.Printf("host[%d]=%s\n", i, h.DebugString())
 	}
 
-	cs := generateClusters(hl, sizes)
-	es := tfkeras.Default()
-	succ, failed := combine(cs, es, run)
-	fmt.Printf("run %d experiments, succ: %d, failed: %d\n", succ+failed, succ, failed)
-}
-
-func combine(cs []Cluster, es []tfkeras.Experiment, f func(Cluster, tfkeras.Experiment) error) (int, int) {
-	var idx int
-	var succ, failed int
-	for _, c := range cs {
-		log.Infof("will runn %d experiments with %d peers", len(es), c.Size)
-		for _, e := range es {
-			idx++
-			if err := f(c, e); err != nil {
-				log.Errorf("experiment #%d failed: %v", idx, err)
-				failed++
-			} else {
-				succ++
-			}
+	results := sweep.NewResults(*flg.results)
+	if len(*flg.resume) > 0 {
+		if results, err = sweep.LoadResults(*flg.resume); err != nil {
+			utils.ExitErr(err)
 		}
+		results.SaveAs(*flg.results)
+		log.Infof("resuming from %s with %d records", *flg.resume, len(results.Records))
 	}
-	return succ, failed
-}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	utils.Trap(func(sig os.Signal) {
+		log.Warnf("%s trapped, stopping after current experiment", sig)
+		cancel()
+	})
+	var baseline *sweep.Results
+	if len(*flg.baseline) > 0 {
+		if baseline, err = sweep.LoadResults(*flg.baseline); err != nil {
+			utils.ExitErr(err)
+		}
+	}
+	if *flg.earlyStop && *flg.quiet {
+		log.Warnf("-early-stop has no effect with -q, metrics are not streamed from quiet peers")
+	}
+	opts := sweep.Options{
+		KFRoot:     *flg.kfRoot,
+		LogDir:     *flg.logDir,
+		User:       *flg.usr,
+		Nic:        *flg.nic,
+		Quiet:      *flg.quiet,
+		VerboseLog: *flg.verboseLog,
+		Strategy:   flg.strategy,
 
-func run(c Cluster, e tfkeras.Experiment) error {
-	pr := plan.DefaultPortRange
-	ctx := context.TODO()
-	j := e.Job(*flg.kfRoot, flg.strategy, c.Hostlist, pr, *flg.logDir)
-	fmt.Printf("%s\n", j.DebugString())
-	sp := runtime.SystemParameters{
-		User:            *flg.usr,
-		WorkerPortRange: pr,
-		RunnerPort:      plan.DefaultRunnerPort,
-		HostList:        c.Hostlist,
-		ClusterSize:     c.Size,
-		Nic:             *flg.nic,
+		Repeats:           *flg.repeats,
+		RebalanceInterval: *flg.rebalanceInterval,
+
+		EarlyStop: *flg.earlyStop,
+		Plateau:   sweep.Plateau{Patience: *flg.patience, MinDelta: *flg.minDelta},
+
+		ConfigPort: *flg.configPort,
+
+		Tags: flg.tags,
+	}
+	r := sweep.NewRunner(ctx, hl, opts)
+	pool := sweep.NewPool(hl, *flg.parallel)
+	configs, err := generateConfigs(hl, pool.Largest(), flg.where)
+	if err != nil {
+		utils.ExitErr(err)
+	}
+	total, err := r.Sweep(ctx, pool, configs, results)
+	if err != nil {
+		utils.ExitErr(err)
+	}
+	fmt.Printf("run %d experiments, succ: %d, failed: %d, skipped: %d, expired: %d, unsatisfiable: %d\n", total.Succ+total.Failed, total.Succ, total.Failed, total.Skipped, total.Expired, total.Unsatisfiable)
+	if baseline != nil && ctx.Err() == nil {
+		if n := report(os.Stdout, compare(baseline.Records, results.Records), *flg.alpha); n > 0 {
+			log.Errorf("%d configurations are significantly slower than %s", n, *flg.baseline)
+			os.Exit(1)
+		}
 	}
-	d, err := utils.Measure(func() error {
-		return remote.RunStaticKungFuJob(ctx, j, sp, *flg.quiet)
-	})
-	log.Infof("run tfkeras.Experiment took %s", d)
-	return err
 }
 
 func parseIntList(line string) ([]int, error) {
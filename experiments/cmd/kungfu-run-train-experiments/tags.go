@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// tagMap is the value of repeated -tag flags
+type tagMap map[string]string
+
+func (m tagMap) String() string {
+	var kvs []string
+	for k, v := range m {
+		kvs = append(kvs, k+"="+v)
+	}
+	sort.Strings(kvs)
+	return strings.Join(kvs, ",")
+}
+
+func (m tagMap) Set(val string) error {
+	kv := strings.SplitN(val, "=", 2)
+	if len(kv) != 2 || len(kv[0]) == 0 {
+		return fmt.Errorf("invalid tag %q, expect <key>=<value>", val)
+	}
+	m[kv[0]] = kv[1]
+	return nil
+}
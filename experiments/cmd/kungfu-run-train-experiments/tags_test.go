@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func Test_tagMap(t *testing.T) {
+	m := tagMap{}
+	for _, v := range []string{`lr=0.1`, `note=a=b`} {
+		if err := m.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := m.String(); s != `lr=0.1,note=a=b` {
+		t.Errorf("unexpected tags: %s", s)
+	}
+	for _, v := range []string{`lr`, `=0.1`} {
+		if err := m.Set(v); err == nil {
+			t.Errorf("%q should be invalid", v)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// Package grid generates the cross product of experiment parameters,
+// without the configurations violating constraints, e.g.
+//
+//	g := grid.New().AddInts("np", 1, 2, 4, 8, 16, 32).Add("strategy", "RING", "CLIQUE")
+//	g.Where(grid.MustParseConstraint("strategy=CLIQUE => np<=16"))
+//	ps, skipped, err := g.Points()
+package grid
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Point is a configuration of the grid, from parameter names to values
+type Point map[string]string
+
+// Int returns the value of name as an int, 0 if it is not an int
+func (p Point) Int(name string) int {
+	n, _ := strconv.Atoi(p[name])
+	return n
+}
+
+func (p Point) String() string {
+	var names []string
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		parts = append(parts, name+"="+p[name])
+	}
+	return strings.Join(parts, " ")
+}
+
+// Grid is a list of parameters and their values, and the constraints of their combinations
+type Grid struct {
+	names       []string
+	values      [][]string
+	constraints []Constraint
+}
+
+func New() *Grid {
+	return &Grid{}
+}
+
+var (
+	errInvalidAxis       = errors.New("invalid grid parameter, expect name=value,value,...")
+	errInvalidConstraint = errors.New("invalid constraint, expect [name op value =>] name op value")
+)
+
+// Parse parses a grid of space separated parameters, e.g. "np=1,2,4 strategy=RING,CLIQUE"
+func Parse(spec string) (*Grid, error) {
+	g := New()
+	for _, f := range strings.Fields(spec) {
+		parts := strings.SplitN(f, "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			return nil, fmt.Errorf("%v: %q", errInvalidAxis, f)
+		}
+		g.Add(parts[0], strings.Split(parts[1], ",")...)
+	}
+	return g, nil
+}
+
+// Add adds a parameter, parameters added earlier change slower in Points
+func (g *Grid) Add(name string, values ...string) *Grid {
+	g.names = append(g.names, name)
+	g.values = append(g.values, values)
+	return g
+}
+
+func (g *Grid) AddInts(name string, values ...int) *Grid {
+	var vs []string
+	for _, v := range values {
+		vs = append(vs, strconv.Itoa(v))
+	}
+	return g.Add(name, vs...)
+}
+
+// Where adds constraints that all points must satisfy
+func (g *Grid) Where(cs ...Constraint) *Grid {
+	g.constraints = append(g.constraints, cs...)
+	return g
+}
+
+// Size returns the number of points before constraints are applied
+func (g *Grid) Size() int {
+	if len(g.names) == 0 {
+		return 0
+	}
+	n := 1
+	for _, vs := range g.values {
+		n *= len(vs)
+	}
+	return n
+}
+
+// Points returns the points satisfying all constraints, and the points skipped with the reasons
+func (g *Grid) Points() ([]Point, []Skipped, error) {
+	return Filter(g.Product(), g.constraints...)
+}
+
+// Product returns all points regardless of constraints
+func (g *Grid) Product() []Point {
+	var ps []Point
+	if len(g.names) > 0 {
+		g.product(0, Point{}, &ps)
+	}
+	return ps
+}
+
+func (g *Grid) product(i int, p Point, ps *[]Point) {
+	if i == len(g.names) {
+		q := make(Point, len(p))
+		for k, v := range p {
+			q[k] = v
+		}
+		*ps = append(*ps, q)
+		return
+	}
+	for _, v := range g.values[i] {
+		p[g.names[i]] = v
+		g.product(i+1, p, ps)
+	}
+}
+
+// Skipped is a point violating a constraint
+type Skipped struct {
+	Point  Point
+	Reason string
+}
+
+// Filter returns the points satisfying all constraints, and the points skipped with the reasons.
+// It fails if a parsed constraint refers to a parameter not in a point.
+func Filter(ps []Point, cs ...Constraint) ([]Point, []Skipped, error) {
+	var ok []Point
+	var skipped []Skipped
+	for _, p := range ps {
+		if reason, err := check(p, cs); err != nil {
+			return nil, nil, err
+		} else if len(reason) > 0 {
+			skipped = append(skipped, Skipped{Point: p, Reason: reason})
+		} else {
+			ok = append(ok, p)
+		}
+	}
+	return ok, skipped, nil
+}
+
+func check(p Point, cs []Constraint) (string, error) {
+	for _, c := range cs {
+		for _, name := range c.names {
+			if _, ok := p[name]; !ok {
+				return "", fmt.Errorf("unknown parameter %q in constraint %q", name, c.Desc)
+			}
+		}
+		if !c.Allow(p) {
+			return "violates " + c.Desc, nil
+		}
+	}
+	return "", nil
+}
+
+// Constraint tells if a point is allowed
+type Constraint struct {
+	Desc  string
+	Allow func(Point) bool
+
+	names []string // parameters used by a parsed constraint
+}
+
+// Where creates a constraint of a Go function
+func Where(desc string, allow func(Point) bool) Constraint {
+	return Constraint{Desc: desc, Allow: allow}
+}
+
+// ParseConstraint parses a comparison, or an implication of two comparisons, e.g. "np<=64", "strategy=CLIQUE => np<=16".
+// Operators are = != < <= > >=, values are compared as ints if both are ints.
+func ParseConstraint(s string) (Constraint, error) {
+	parts := strings.Split(s, "=>")
+	if len(parts) > 2 {
+		return Constraint{}, fmt.Errorf("%v: %q", errInvalidConstraint, s)
+	}
+	var cmps []comparison
+	for _, part := range parts {
+		c, err := parseComparison(strings.TrimSpace(part))
+		if err != nil {
+			return Constraint{}, fmt.Errorf("%v: %q", errInvalidConstraint, s)
+		}
+		cmps = append(cmps, c)
+	}
+	c := Constraint{Desc: strings.TrimSpace(s)}
+	for _, cmp := range cmps {
+		c.names = append(c.names, cmp.name)
+	}
+	if len(cmps) == 1 {
+		c.Allow = cmps[0].eval
+	} else {
+		c.Allow = func(p Point) bool { return !cmps[0].eval(p) || cmps[1].eval(p) }
+	}
+	return c, nil
+}
+
+func MustParseConstraint(s string) Constraint {
+	c, err := ParseConstraint(s)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+type comparison struct {
+	name  string
+	op    string
+	value string
+}
+
+var ops = []string{"!=", "<=", ">=", "=", "<", ">"} // longer operators are matched first
+
+func parseComparison(s string) (comparison, error) {
+	for _, op := range ops {
+		if i := strings.Index(s, op); i > 0 {
+			c := comparison{
+				name:  strings.TrimSpace(s[:i]),
+				op:    op,
+				value: strings.TrimSpace(s[i+len(op):]),
+			}
+			if len(c.name) == 0 || len(c.value) == 0 || strings.ContainsAny(c.value, "=<>!") {
+				break
+			}
+			return c, nil
+		}
+	}
+	return comparison{}, errInvalidConstraint
+}
+
+func (c comparison) eval(p Point) bool {
+	x, y := p[c.name], c.value
+	d := strings.Compare(x, y)
+	if a, err := strconv.Atoi(x); err == nil {
+		if b, err := strconv.Atoi(y); err == nil {
+			d = a - b
+		}
+	}
+	switch c.op {
+	case "=":
+		return d == 0
+	case "!=":
+		return d != 0
+	case "<":
+		return d < 0
+	case "<=":
+		return d <= 0
+	case ">":
+		return d > 0
+	case ">=":
+		return d >= 0
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package grid
+
+import "testing"
+
+func Test_Points(t *testing.T) {
+	g, err := Parse("np=4,8,16,32 strategy=RING,CLIQUE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Where(MustParseConstraint("strategy=CLIQUE => np<=16"))
+	g.Where(Where("np <= 24 slots", func(p Point) bool { return p.Int("np") <= 24 }))
+	ps, skipped, err := g.Points()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Size() != 8 || len(ps) != 6 || len(skipped) != 2 {
+		t.Fatalf("unexpected points: %v, skipped: %v", ps, skipped)
+	}
+	if ps[0].String() != "np=4 strategy=RING" || ps[1].String() != "np=4 strategy=CLIQUE" {
+		t.Errorf("unexpected order: %v", ps)
+	}
+	if skipped[0].Point.String() != "np=32 strategy=RING" || skipped[0].Reason != "violates np <= 24 slots" {
+		t.Errorf("unexpected skipped: %v", skipped[0])
+	}
+}
+
+func Test_ParseConstraint(t *testing.T) {
+	p := Point{"np": "8", "model": "ResNet50"}
+	tests := []struct {
+		s  string
+		ok bool
+	}{
+		{"np<=16", true},
+		{"np>16", false},
+		{"np != 8", false},
+		{"np=8 => model=ResNet50", true},
+		{"np>8 => model=MobileNetV2", true},
+		{"model=ResNet50 => np>=10", false},
+	}
+	for _, tt := range tests {
+		c, err := ParseConstraint(tt.s)
+		if err != nil {
+			t.Errorf("failed to parse %q: %v", tt.s, err)
+			continue
+		}
+		if got := c.Allow(p); got != tt.ok {
+			t.Errorf("%q on %s: got %v, want %v", tt.s, p, got, tt.ok)
+		}
+	}
+	for _, s := range []string{"np", "=8", "np<=", "a=1 => b=2 => c=3", "np=<8"} {
+		if _, err := ParseConstraint(s); err == nil {
+			t.Errorf("%q should be invalid", s)
+		}
+	}
+	if _, _, err := Filter([]Point{p}, MustParseConstraint("bs=32")); err == nil {
+		t.Errorf("constraint of unknown parameter should fail")
+	}
+}
@@ -0,0 +1,55 @@
+package sweep
+
+import (
+	"sort"
+
+	"github.com/lsds/KungFu/experiments/tfkeras"
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+type Cluster struct {
+	Hostlist plan.HostList
+	Size     int
+}
+
+// GenerateClusters returns a cluster of each size, from the largest to the smallest
+func GenerateClusters(hl plan.HostList, sizes []int) []Cluster {
+	sort.Sort(sort.Reverse(sort.IntSlice(sizes)))
+	var cs []Cluster
+	for _, s := range sizes {
+		c := Cluster{
+			Hostlist: hl.ShrinkToFit(s),
+			Size:     s,
+		}
+		cs = append(cs, c)
+	}
+	return cs
+}
+
+// Config is an experiment to run on a cluster of a size
+type Config struct {
+	Cluster    Cluster
+	Experiment tfkeras.Experiment
+}
+
+// CrossProduct returns the config of each experiment on each cluster
+func CrossProduct(cs []Cluster, es []tfkeras.Experiment) []Config {
+	var configs []Config
+	for _, c := range cs {
+		for _, e := range es {
+			configs = append(configs, Config{Cluster: c, Experiment: e})
+		}
+	}
+	return configs
+}
+
+// repeat returns each config n times in a row
+func repeat(configs []Config, n int) []Config {
+	var cs []Config
+	for _, c := range configs {
+		for i := 0; i < n; i++ {
+			cs = append(cs, c)
+		}
+	}
+	return cs
+}
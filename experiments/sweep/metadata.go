@@ -0,0 +1,83 @@
+package sweep
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/envsnap"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/utils/runner/remote"
+	"github.com/lsds/KungFu/srcs/go/utils/ssh"
+)
+
+// Metadata is stored with each record, so that sweeps remain interpretable long after they were run
+type Metadata struct {
+	Tags  map[string]string `json:",omitempty"` // Options.Tags of the sweep
+	Hosts []HostMetadata    `json:",omitempty"` // hosts of the cluster of the experiment
+}
+
+// HostMetadata is what a host ran an experiment with, values are - if not found
+type HostMetadata struct {
+	Host         string
+	Commit       string            `json:",omitempty"` // git commit of the workload in Options.KFRoot
+	KungFu       string            `json:",omitempty"` // version of the installed KungFu package
+	InstanceType string            `json:",omitempty"` // of the cloud instance, from the metadata service of AWS, GCP or Azure
+	Versions     map[string]string `json:",omitempty"` // GPU models, driver, CUDA, NCCL, Python and TensorFlow, see envsnap.VersionScript
+}
+
+// metadataScript prints <key>=<value> of the workload and the instance of a host, followed by the versions of envsnap.VersionScript
+func metadataScript(kfRoot string) string {
+	return fmt.Sprintf(`PATH=$HOME/local/python/bin:$PATH
+v() { [ -n "$1" ] && echo "$1" || echo -; }
+echo commit=$(v "$(git -C %q rev-parse HEAD 2>/dev/null)")
+echo kungfu=$(v "$(python3 -c 'import pkg_resources; print(pkg_resources.get_distribution("kungfu").version)' 2>/dev/null)")
+instance_type() {
+	t=$(curl -sf -m 1 -X PUT -H 'X-aws-ec2-metadata-token-ttl-seconds: 60' http://169.254.169.254/latest/api/token 2>/dev/null)
+	curl -sf -m 1 -H "X-aws-ec2-metadata-token: $t" http://169.254.169.254/latest/meta-data/instance-type 2>/dev/null && return
+	curl -sf -m 1 -H 'Metadata-Flavor: Google' http://metadata.google.internal/computeMetadata/v1/instance/machine-type 2>/dev/null | awk -F/ '{print $NF}' && return
+	curl -sf -m 1 -H 'Metadata: true' 'http://169.254.169.254/metadata/instance/compute/vmSize?api-version=2021-02-01&format=text' 2>/dev/null
+}
+echo instance-type=$(v "$(instance_type)")
+`, kfRoot) + envsnap.VersionScript
+}
+
+// probeMetadata returns the metadata of all hosts by their names, hosts failed to probe are left out with a warning
+func probeMetadata(ctx context.Context, opts ssh.Options, hl plan.HostList, kfRoot string) map[string]HostMetadata {
+	hvs, err := remote.ProbeHosts(ctx, opts, hl, metadataScript(kfRoot))
+	if err != nil {
+		log.Warnf("metadata of some hosts are missing: %v", err)
+	}
+	ms := make(map[string]HostMetadata)
+	for _, hv := range hvs {
+		if hv.Versions == nil {
+			continue
+		}
+		m := HostMetadata{Host: hv.Host, Versions: make(map[string]string)}
+		for k, v := range hv.Versions {
+			switch k {
+			case `commit`:
+				m.Commit = v
+			case `kungfu`:
+				m.KungFu = v
+			case `instance-type`:
+				m.InstanceType = v
+			default:
+				m.Versions[k] = v
+			}
+		}
+		ms[hv.Host] = m
+	}
+	return ms
+}
+
+// metadataOf returns the metadata of an experiment run on the hosts of hl
+func metadataOf(hl plan.HostList, hosts map[string]HostMetadata, tags map[string]string) Metadata {
+	md := Metadata{Tags: tags}
+	for _, h := range hl {
+		if m, ok := hosts[hl.LookupHost(h.IPv4)]; ok {
+			md.Hosts = append(md.Hosts, m)
+		}
+	}
+	return md
+}
@@ -0,0 +1,22 @@
+package sweep
+
+import (
+	"testing"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+func Test_metadataOf(t *testing.T) {
+	hl, err := plan.ParseHostList(`192.168.1.11:4,192.168.1.12:4`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := map[string]HostMetadata{
+		`192.168.1.12`: {Host: `192.168.1.12`, Commit: `abc`},
+		`192.168.1.13`: {Host: `192.168.1.13`, Commit: `abc`},
+	}
+	md := metadataOf(hl, hosts, map[string]string{`lr`: `0.1`})
+	if len(md.Hosts) != 1 || md.Hosts[0].Host != `192.168.1.12` || md.Tags[`lr`] != `0.1` {
+		t.Errorf("unexpected metadata: %+v", md)
+	}
+}
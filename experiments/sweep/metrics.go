@@ -0,0 +1,153 @@
+package sweep
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/experiments/tfkeras"
+	"github.com/lsds/KungFu/srcs/go/log"
+)
+
+var xtermColor = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// metricStream parses the metric values reported in the output lines of an experiment as it runs,
+// grouped by the host and the peer that wrote them.
+type metricStream struct {
+	sync.Mutex
+	re      *regexp.Regexp
+	idx     int
+	series  map[string][]float64
+	samples []sample      // all values in the order of arrival
+	first   chan struct{} // closed once the first value arrives
+	plateau Plateau
+	stop    func() // called once all series have plateaued, nil to only collect
+	stopped bool
+}
+
+func newMetricStream(idx int, e tfkeras.Experiment, p Plateau, stop func()) (*metricStream, error) {
+	expr := e.Metric
+	if len(expr) == 0 {
+		expr = tfkeras.DefaultMetric
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &metricStream{
+		re:      re,
+		idx:     idx,
+		series:  make(map[string][]float64),
+		first:   make(chan struct{}),
+		plateau: p,
+		stop:    stop,
+	}, nil
+}
+
+// source returns the host, and the peer if the line is prefixed by the peer name as kungfu-run does
+func source(host, line string) string {
+	line = xtermColor.ReplaceAllString(line, "")
+	if strings.HasPrefix(line, "[") {
+		if i := strings.Index(line, "::"); i > 0 {
+			return host + "/" + line[1:i]
+		}
+	}
+	return host
+}
+
+func (s *metricStream) onLine(host, line string) {
+	m := s.re.FindStringSubmatch(line)
+	if len(m) < 2 {
+		return
+	}
+	v, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return
+	}
+	src := source(host, line)
+	s.Lock()
+	defer s.Unlock()
+	s.series[src] = append(s.series[src], v)
+	if len(s.samples) == 0 {
+		close(s.first)
+	}
+	s.samples = append(s.samples, sample{src: src, t: time.Now(), v: v})
+	log.Infof("experiment #%d %s: %g", s.idx, src, v)
+	if s.stop == nil || s.stopped {
+		return
+	}
+	for _, xs := range s.series {
+		if !s.plateau.reached(xs) {
+			return
+		}
+	}
+	log.Infof("experiment #%d plateaued after %d values, stopping early", s.idx, len(s.series[src]))
+	s.stopped = true
+	s.stop()
+}
+
+// started is closed once the first value is reported
+func (s *metricStream) started() <-chan struct{} {
+	return s.first
+}
+
+func (s *metricStream) timeline() []sample {
+	s.Lock()
+	defer s.Unlock()
+	return append([]sample(nil), s.samples...)
+}
+
+func (s *metricStream) result() (map[string][]float64, bool) {
+	s.Lock()
+	defer s.Unlock()
+	if len(s.series) == 0 {
+		return nil, s.stopped
+	}
+	return s.series, s.stopped
+}
+
+// sample is a metric value reported by a source at a time
+type sample struct {
+	src string
+	t   time.Time
+	v   float64
+}
+
+// globalRate sums the mean value of each source in [from, to), which is the global throughput if the metric is the throughput of each peer
+func globalRate(samples []sample, from, to time.Time) float64 {
+	sums := make(map[string]float64)
+	counts := make(map[string]int)
+	for _, x := range samples {
+		if !x.t.Before(from) && x.t.Before(to) {
+			sums[x.src] += x.v
+			counts[x.src]++
+		}
+	}
+	var r float64
+	for src, sum := range sums {
+		r += sum / float64(counts[src])
+	}
+	return r
+}
+
+// Plateau is reached when each of the last Patience values is within MinDelta, relative, of the value before them
+type Plateau struct {
+	Patience int
+	MinDelta float64
+}
+
+func (p Plateau) reached(xs []float64) bool {
+	if p.Patience <= 0 || len(xs) <= p.Patience {
+		return false
+	}
+	ref := xs[len(xs)-p.Patience-1]
+	for _, x := range xs[len(xs)-p.Patience:] {
+		if math.Abs(x-ref) > p.MinDelta*math.Abs(ref) {
+			return false
+		}
+	}
+	return true
+}
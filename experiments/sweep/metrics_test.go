@@ -0,0 +1,32 @@
+package sweep
+
+import "testing"
+
+func Test_plateau(t *testing.T) {
+	p := Plateau{Patience: 2, MinDelta: 0.01}
+	tests := []struct {
+		xs   []float64
+		want bool
+	}{
+		{[]float64{100, 100.5}, false},
+		{[]float64{100, 100.5, 99.8}, true},
+		{[]float64{50, 80, 100, 100.5}, false},
+		{[]float64{50, 80, 100, 100.5, 100.2}, true},
+		{[]float64{100, 100.5, 120}, false},
+	}
+	for _, tt := range tests {
+		if got := p.reached(tt.xs); got != tt.want {
+			t.Errorf("reached(%v) = %v, want %v", tt.xs, got, tt.want)
+		}
+	}
+}
+
+func Test_source(t *testing.T) {
+	line := "[\x1b[1;32m127.0.0.1.10000\x1b[m::stdout] Iter #1: 42.0 img/sec per CPU"
+	if s := source("10.0.0.1", line); s != "10.0.0.1/127.0.0.1.10000" {
+		t.Errorf("source(%q) = %q", line, s)
+	}
+	if s := source("10.0.0.1", "Iter #1: 42.0 img/sec per CPU"); s != "10.0.0.1" {
+		t.Errorf("source of unprefixed line = %q", s)
+	}
+}
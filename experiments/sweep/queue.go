@@ -0,0 +1,89 @@
+package sweep
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lsds/KungFu/experiments/tfkeras"
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+type task struct {
+	idx      int
+	cluster  Cluster
+	e        tfkeras.Experiment
+	deadline time.Time // zero for no deadline
+	resizes  []resize  // the experiment is run in elastic mode if not empty
+}
+
+// peak returns the largest cluster size of the task
+func (t task) peak() int {
+	return peakSize(t.cluster.Size, t.resizes)
+}
+
+// queue orders tasks by priority, tasks of the same priority are run in FIFO order
+type queue struct {
+	tasks []task
+}
+
+func newQueue(t0 time.Time, configs []Config) (*queue, error) {
+	q := &queue{}
+	for _, c := range configs {
+		t := task{idx: len(q.tasks) + 1, cluster: c.Cluster, e: c.Experiment}
+		if len(c.Experiment.Deadline) > 0 {
+			d, err := time.ParseDuration(c.Experiment.Deadline)
+			if err != nil {
+				return nil, fmt.Errorf("invalid deadline of experiment #%d: %v", t.idx, err)
+			}
+			t.deadline = t0.Add(d)
+		}
+		rs, err := parseResizes(c.Experiment.Resizes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid resizes of experiment #%d: %v", t.idx, err)
+		}
+		t.resizes = rs
+		q.tasks = append(q.tasks, t)
+	}
+	sort.SliceStable(q.tasks, func(i, j int) bool {
+		return q.tasks[i].e.Priority > q.tasks[j].e.Priority
+	})
+	return q, nil
+}
+
+func (q *queue) Len() int {
+	return len(q.tasks)
+}
+
+func (q *queue) Pop() task {
+	t := q.tasks[0]
+	q.tasks = q.tasks[1:]
+	return t
+}
+
+// Unsatisfiable removes the tasks that can never be run in the pool, and returns them with the reasons
+func (q *queue) Unsatisfiable(pool plan.HostList) ([]task, []string) {
+	var bad []task
+	var reasons []string
+	var ok []task
+	for _, t := range q.tasks {
+		if reason := checkCluster(pool, Cluster{Size: t.peak()}); len(reason) > 0 {
+			bad = append(bad, t)
+			reasons = append(reasons, reason)
+			continue
+		}
+		ok = append(ok, t)
+	}
+	q.tasks = ok
+	return bad, reasons
+}
+
+func checkCluster(pool plan.HostList, c Cluster) string {
+	if c.Size <= 0 {
+		return fmt.Sprintf("invalid cluster size %d", c.Size)
+	}
+	if cap := pool.Cap(); c.Size > cap {
+		return fmt.Sprintf("%d peers exceed the capacity %d of all hosts", c.Size, cap)
+	}
+	return ""
+}
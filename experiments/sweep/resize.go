@@ -0,0 +1,224 @@
+package sweep
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/experiments/tfkeras"
+	"github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/kungfu/runtime"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/proc"
+	"github.com/lsds/KungFu/srcs/go/utils/runner/remote"
+	"github.com/lsds/KungFu/tests/go/configserver"
+)
+
+// resize is a scripted resize of the cluster of an elastic experiment
+type resize struct {
+	At   time.Duration // after the first metric value of the experiment
+	Size int
+}
+
+var errUnorderedResizes = errors.New("resizes must be in the order of time")
+
+// parseResizes parses the Resizes of an experiment, e.g. 60s:4,120s:8
+func parseResizes(s string) ([]resize, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+	var rs []resize
+	for _, part := range strings.Split(s, ",") {
+		kv := strings.SplitN(part, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid resize %q, must be <time>:<size>", part)
+		}
+		at, err := time.ParseDuration(kv[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid resize %q: %v", part, err)
+		}
+		n, err := strconv.Atoi(kv[1])
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid size of resize %q", part)
+		}
+		if len(rs) > 0 && at <= rs[len(rs)-1].At {
+			return nil, fmt.Errorf("%v: %s", errUnorderedResizes, s)
+		}
+		rs = append(rs, resize{At: at, Size: n})
+	}
+	return rs, nil
+}
+
+// peakSize returns the largest size of a cluster starting with size peers and resized by rs
+func peakSize(size int, rs []resize) int {
+	for _, r := range rs {
+		if r.Size > size {
+			size = r.Size
+		}
+	}
+	return size
+}
+
+// ResizeRecord is the global throughput around a scripted resize of an elastic experiment
+type ResizeRecord struct {
+	At       time.Duration // after the first metric value
+	From     int
+	To       int
+	Before   float64       // sum of the mean metric of each peer, from the previous resize to this one
+	After    float64       // sum of the mean metric of each peer, from the first value after this resize to the next resize
+	Recovery time.Duration // from this resize to the first metric value after it, 0 if there is none
+	Error    string        `json:",omitempty"` // the config server refused the resize
+}
+
+// applied is a resize sent to the config server
+type applied struct {
+	resize
+	from int
+	t    time.Time
+	err  error
+}
+
+// driveResizes updates the cluster through cc at the times of rs after the first metric value of ms, until ctx is done
+func driveResizes(ctx context.Context, cc *configserver.Client, sp runtime.SystemParameters, rs []resize, ms *metricStream) []applied {
+	select {
+	case <-ms.started():
+	case <-ctx.Done():
+		return nil
+	}
+	t0 := time.Now()
+	size := sp.ClusterSize
+	var as []applied
+	for _, r := range rs {
+		select {
+		case <-time.After(time.Until(t0.Add(r.At))):
+		case <-ctx.Done():
+			return as
+		}
+		cluster := plan.Cluster{
+			Runners: sp.HostList.GenRunnerList(sp.RunnerPort),
+			Workers: sp.HostList.MustGenPeerList(r.Size, sp.WorkerPortRange),
+		}
+		a := applied{resize: r, from: size, t: time.Now(), err: cc.Update(cluster)}
+		if a.err != nil {
+			log.Errorf("failed to resize from %d to %d peers: %v", size, r.Size, a.err)
+		} else {
+			log.Infof("resized from %d to %d peers after %s", size, r.Size, r.At)
+			size = r.Size
+		}
+		as = append(as, a)
+	}
+	return as
+}
+
+// resizeRecords measures the global throughput before and after each resize in as, the last phase lasts until end
+func resizeRecords(as []applied, samples []sample, end time.Time) []ResizeRecord {
+	var records []ResizeRecord
+	var from time.Time
+	for i, a := range as {
+		next := end
+		if i+1 < len(as) {
+			next = as[i+1].t
+		}
+		rec := ResizeRecord{At: a.At, From: a.from, To: a.Size, Before: globalRate(samples, from, a.t)}
+		if a.err != nil {
+			rec.To = a.from
+			rec.Error = a.err.Error()
+		}
+		after := a.t
+		for _, x := range samples {
+			if x.t.After(a.t) && x.t.Before(next) {
+				after = x.t
+				rec.Recovery = x.t.Sub(a.t)
+				break
+			}
+		}
+		rec.After = globalRate(samples, after, next)
+		records = append(records, rec)
+		from = a.t
+	}
+	return records
+}
+
+// runElastic runs an experiment in elastic mode with a config server on the first host, which is resized as scheduled
+func (r *Runner) runElastic(ctx context.Context, idx int, c Cluster, e tfkeras.Experiment, strategy base.Strategy, strategyOptions base.StrategyOptions, rs []resize, sp runtime.SystemParameters, ms *metricStream) ([]ResizeRecord, error) {
+	host := c.Hostlist[0]
+	endpoint := url.URL{
+		Scheme: `http`,
+		Host:   net.JoinHostPort(plan.FormatIPv4(host.IPv4), strconv.Itoa(r.opts.ConfigPort)),
+		Path:   `/config`,
+	}
+	stopServer, err := r.startConfigServer(ctx, sp.HostList.LookupHost(host.IPv4), endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer stopServer()
+	cc := configserver.NewClient(endpoint.String())
+	initCluster := plan.Cluster{
+		Runners: sp.HostList.GenRunnerList(sp.RunnerPort),
+		Workers: sp.HostList.MustGenPeerList(sp.ClusterSize, sp.WorkerPortRange),
+	}
+	if err := cc.Update(initCluster); err != nil {
+		return nil, err
+	}
+	j := e.Job(r.opts.KFRoot, strategy, sp.HostList, sp.WorkerPortRange, r.opts.LogDir)
+	j.StrategyOptions = strategyOptions
+	j.ConfigServer = endpoint.String()
+	fmt.Printf("%s\n", j.DebugString())
+	driveCtx, stopDriving := context.WithCancel(ctx)
+	var as []applied
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		as = driveResizes(driveCtx, cc, sp, rs, ms)
+	}()
+	err = remote.StreamElasticKungFuJob(ctx, j, sp, r.opts.Quiet, ms.onLine)
+	end := time.Now()
+	stopDriving()
+	wg.Wait()
+	if len(as) < len(rs) && err == nil {
+		log.Warnf("experiment #%d finished before %d of its %d resizes", idx, len(rs)-len(as), len(rs))
+	}
+	return resizeRecords(as, ms.timeline(), end), err
+}
+
+// startConfigServer runs kungfu-config-server on host until the returned function is called
+func (r *Runner) startConfigServer(ctx context.Context, host string, endpoint url.URL) (func(), error) {
+	_, port, _ := net.SplitHostPort(endpoint.Host)
+	p := proc.Proc{
+		Name:     `config-server`,
+		Prog:     `kungfu-config-server`,
+		Args:     []string{`-port`, port, `-endpoint`, endpoint.Path},
+		Hostname: host,
+		Envs:     proc.Envs{`PATH`: `$HOME/go/bin:$PATH`},
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := remote.RemoteRunAll(ctx, r.opts.sshOptions(), []proc.Proc{p}, r.opts.VerboseLog, r.opts.LogDir); err != nil && ctx.Err() == nil {
+			log.Errorf("%s failed: %v", p.Name, err)
+			cancel()
+		}
+	}()
+	cc := configserver.NewClient(endpoint.String())
+	if err := cc.WaitServerContext(ctx); err != nil {
+		cancel()
+		<-done
+		return nil, fmt.Errorf("config server on %s is not ready: %v", host, err)
+	}
+	return func() {
+		if err := cc.StopServer(); err != nil {
+			log.Warnf("failed to stop config server on %s: %v", host, err)
+		}
+		cancel()
+		<-done
+	}, nil
+}
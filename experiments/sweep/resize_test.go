@@ -0,0 +1,53 @@
+package sweep
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_parseResizes(t *testing.T) {
+	rs, err := parseResizes("60s:4,2m:8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 2 || rs[0] != (resize{At: time.Minute, Size: 4}) || rs[1] != (resize{At: 2 * time.Minute, Size: 8}) {
+		t.Errorf("parseResizes = %v", rs)
+	}
+	if n := peakSize(6, rs); n != 8 {
+		t.Errorf("peakSize = %d, want 8", n)
+	}
+	for _, s := range []string{"60s", "60s:0", "x:4", "2m:8,60s:4"} {
+		if _, err := parseResizes(s); err == nil {
+			t.Errorf("parseResizes(%q) should fail", s)
+		}
+	}
+}
+
+func Test_resizeRecords(t *testing.T) {
+	t0 := time.Now()
+	at := func(s int) time.Time { return t0.Add(time.Duration(s) * time.Second) }
+	samples := []sample{
+		{src: "a", t: at(1), v: 10},
+		{src: "b", t: at(1), v: 10},
+		{src: "a", t: at(2), v: 12},
+		{src: "b", t: at(2), v: 12},
+		{src: "a", t: at(7), v: 15},
+		{src: "a", t: at(8), v: 17},
+		{src: "a", t: at(12), v: 1},
+	}
+	as := []applied{
+		{resize: resize{At: 5 * time.Second, Size: 1}, from: 2, t: at(5)},
+		{resize: resize{At: 10 * time.Second, Size: 2}, from: 1, t: at(10), err: errors.New("rejected")},
+	}
+	rs := resizeRecords(as, samples, at(13))
+	if len(rs) != 2 {
+		t.Fatalf("got %d records", len(rs))
+	}
+	if r := rs[0]; r.Before != 22 || r.After != 16 || r.Recovery != 2*time.Second || r.From != 2 || r.To != 1 {
+		t.Errorf("first record: %+v", r)
+	}
+	if r := rs[1]; r.Before != 16 || r.After != 1 || r.To != 1 || len(r.Error) == 0 {
+		t.Errorf("second record: %+v", r)
+	}
+}
@@ -0,0 +1,137 @@
+package sweep
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/experiments/tfkeras"
+	"github.com/lsds/KungFu/srcs/go/utils/runner/remote"
+)
+
+// Record is the result of one finished experiment
+type Record struct {
+	ClusterSize int
+	Experiment  tfkeras.Experiment
+	Duration    time.Duration
+	Error       string
+
+	WorkDuration time.Duration // reported by the peers, excluding the launch overhead
+
+	Results []ResultFile `json:",omitempty"` // collected from the ResultFiles of the experiment
+
+	Metrics      map[string][]float64 `json:",omitempty"` // values of the Metric of the experiment, by the host and peer reporting them
+	EarlyStopped bool                 `json:",omitempty"` // stopped by Options.EarlyStop once Metrics plateaued
+
+	Resizes []ResizeRecord `json:",omitempty"` // throughput around the scripted resizes of an elastic experiment
+
+	Metadata Metadata // of the workload, the hosts and the sweep
+}
+
+// ResultFile is a result file collected from a host, Data is kept as is if it is JSON, otherwise as a JSON string
+type ResultFile struct {
+	Host string
+	File string
+	Data json.RawMessage
+}
+
+func newResultFile(f remote.CollectedFile) ResultFile {
+	data := json.RawMessage(f.Data)
+	if !json.Valid(f.Data) {
+		data, _ = json.Marshal(string(f.Data))
+	}
+	return ResultFile{Host: f.Host, File: f.File, Data: data}
+}
+
+func (r Record) OK() bool {
+	return len(r.Error) == 0
+}
+
+type recordKey struct {
+	size int
+	e    string
+}
+
+// Results persists records to a JSON file as they are added
+type Results struct {
+	sync.Mutex
+	filename string
+	Records  []Record
+	done     map[recordKey]int // number of succeeded records
+}
+
+func NewResults(filename string) *Results {
+	return &Results{
+		filename: filename,
+		done:     make(map[recordKey]int),
+	}
+}
+
+// SaveAs changes the file that records are saved to as they are added, e.g. to resume from loaded results without overwriting them
+func (r *Results) SaveAs(filename string) {
+	r.Lock()
+	defer r.Unlock()
+	r.filename = filename
+}
+
+// LoadResults loads records saved by a previous run
+func LoadResults(filename string) (*Results, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []Record
+	if err := json.NewDecoder(f).Decode(&records); err != nil {
+		return nil, err
+	}
+	r := NewResults(filename)
+	for _, rec := range records {
+		r.add(rec)
+	}
+	return r, nil
+}
+
+func (r *Results) add(rec Record) {
+	r.Records = append(r.Records, rec)
+	if rec.OK() {
+		r.done[recordKey{rec.ClusterSize, rec.Experiment.Key()}]++
+	}
+}
+
+// Done returns true if the experiment has already succeeded n times with the given cluster size
+func (r *Results) Done(size int, e tfkeras.Experiment, n int) bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.done[recordKey{size, e.Key()}] >= n
+}
+
+// Add appends a record and saves all records to file
+func (r *Results) Add(rec Record) error {
+	r.Lock()
+	defer r.Unlock()
+	r.add(rec)
+	return r.save()
+}
+
+func (r *Results) save() error {
+	if len(r.filename) == 0 {
+		return nil
+	}
+	tmp := r.filename + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	e := json.NewEncoder(f)
+	e.SetIndent("", "    ")
+	if err := e.Encode(r.Records); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.filename)
+}
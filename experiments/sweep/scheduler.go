@@ -0,0 +1,170 @@
+package sweep
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+// group is a partition of the hosts, which runs one experiment at a time
+type group struct {
+	id    int
+	hl    plan.HostList
+	tasks []task // the implicit queue of the group, run from the head and stolen from the tail
+	done  int
+	spent time.Duration // total duration of the finished experiments
+}
+
+func (g *group) fits(t task) bool {
+	return t.peak() <= g.hl.Cap()
+}
+
+// scheduler assigns tasks to groups in acquisition order,
+// a group running out of tasks steals from the group of the longest estimated backlog.
+type scheduler struct {
+	sync.Mutex
+	groups []*group
+}
+
+// Pool is the hosts of a sweep split into groups, each of them runs one experiment at a time
+type Pool []plan.HostList
+
+// NewPool splits hosts into n groups of consecutive hosts
+func NewPool(hl plan.HostList, n int) Pool {
+	if n > len(hl) {
+		n = len(hl)
+	}
+	var p Pool
+	for i := 0; i < n; i++ {
+		p = append(p, hl[i*len(hl)/n:(i+1)*len(hl)/n])
+	}
+	return p
+}
+
+// Largest returns the group of the largest capacity, which bounds the size of the experiments of the pool
+func (p Pool) Largest() plan.HostList {
+	var l plan.HostList
+	for _, hl := range p {
+		if hl.Cap() > l.Cap() {
+			l = hl
+		}
+	}
+	return l
+}
+
+func newScheduler(q *queue, p Pool) *scheduler {
+	s := &scheduler{}
+	for i, hl := range p {
+		s.groups = append(s.groups, &group{id: i, hl: hl})
+	}
+	for q.Len() > 0 {
+		t := q.Pop()
+		var best *group
+		for _, g := range s.groups {
+			if g.fits(t) && (best == nil || len(g.tasks) < len(best.tasks)) {
+				best = g
+			}
+		}
+		if best == nil {
+			log.Errorf("experiment #%d of %d peers fits in no group", t.idx, t.peak())
+			continue
+		}
+		best.tasks = append(best.tasks, t)
+	}
+	return s
+}
+
+// meanDuration estimates the duration of an experiment in g, from the finished experiments of g or all groups
+func (s *scheduler) meanDuration(g *group) time.Duration {
+	if g.done > 0 {
+		return g.spent / time.Duration(g.done)
+	}
+	var done int
+	var spent time.Duration
+	for _, g := range s.groups {
+		done += g.done
+		spent += g.spent
+	}
+	if done > 0 {
+		return spent / time.Duration(done)
+	}
+	return time.Second
+}
+
+func (s *scheduler) backlog(g *group) time.Duration {
+	return time.Duration(len(g.tasks)) * s.meanDuration(g)
+}
+
+// next returns the next task for g, stealing one if g has no task left
+func (s *scheduler) next(g *group) (task, bool) {
+	s.Lock()
+	defer s.Unlock()
+	if len(g.tasks) > 0 {
+		t := g.tasks[0]
+		g.tasks = g.tasks[1:]
+		return t, true
+	}
+	if v := s.victim(g); v != nil {
+		t := s.steal(v)
+		log.Infof("group #%d stole experiment #%d from group #%d", g.id, t.idx, v.id)
+		return t, true
+	}
+	return task{}, false
+}
+
+// victim returns the group of the longest backlog which has a task fitting in g
+func (s *scheduler) victim(g *group) *group {
+	var victim *group
+	var longest time.Duration
+	for _, v := range s.groups {
+		if v == g || len(v.tasks) == 0 || !g.fits(v.tasks[len(v.tasks)-1]) {
+			continue
+		}
+		if b := s.backlog(v); victim == nil || b > longest {
+			victim, longest = v, b
+		}
+	}
+	return victim
+}
+
+func (s *scheduler) steal(from *group) task {
+	t := from.tasks[len(from.tasks)-1]
+	from.tasks = from.tasks[:len(from.tasks)-1]
+	return t
+}
+
+func (s *scheduler) finished(g *group, d time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	g.done++
+	g.spent += d
+}
+
+// rebalance moves tasks from the group of the longest backlog to the group of the shortest one,
+// while it shortens the longest backlog.
+func (s *scheduler) rebalance() {
+	s.Lock()
+	defer s.Unlock()
+	for {
+		var long, short *group
+		for _, g := range s.groups {
+			if long == nil || s.backlog(g) > s.backlog(long) {
+				long = g
+			}
+			if short == nil || s.backlog(g) < s.backlog(short) {
+				short = g
+			}
+		}
+		if long == short || len(long.tasks) == 0 || !short.fits(long.tasks[len(long.tasks)-1]) {
+			return
+		}
+		if s.backlog(short)+s.meanDuration(short) >= s.backlog(long) {
+			return
+		}
+		t := s.steal(long)
+		short.tasks = append(short.tasks, t)
+		log.Infof("moved experiment #%d from group #%d (backlog %s) to group #%d (backlog %s)", t.idx, long.id, s.backlog(long), short.id, s.backlog(short))
+	}
+}
@@ -0,0 +1,256 @@
+// Package sweep runs experiments on a pool of hosts and records their results,
+// so that sweep drivers other than kungfu-run-train-experiments can choose the configurations to run, e.g.
+//
+//	r := sweep.NewRunner(ctx, hl, sweep.Options{KFRoot: kfRoot, Strategy: base.DefaultStrategy})
+//	results := sweep.NewResults("results.json")
+//	for !converged {
+//		c := sweep.Config{Cluster: sweep.Cluster{Hostlist: hl.ShrinkToFit(np), Size: np}, Experiment: next(results.Records)}
+//		results.Add(r.Run(ctx, len(results.Records)+1, c.Cluster, c.Experiment))
+//	}
+package sweep
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/experiments/tfkeras"
+	"github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/kungfu/runtime"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/utils"
+	"github.com/lsds/KungFu/srcs/go/utils/runner/remote"
+	"github.com/lsds/KungFu/srcs/go/utils/ssh"
+)
+
+// Options are how experiments are run, they are the flags of kungfu-run-train-experiments of the same names
+type Options struct {
+	KFRoot     string // the workload is in tests/python of it
+	LogDir     string
+	User       string // user name for ssh
+	Nic        string
+	Quiet      bool // peers don't stream their outputs, so metrics are not collected
+	VerboseLog bool
+	Strategy   base.Strategy // of experiments without a Strategy
+
+	Repeats           int           // Sweep runs each configuration this many times, 1 if 0
+	RebalanceInterval time.Duration // Sweep moves queued experiments between groups at this interval, 0 to only steal when idle
+
+	EarlyStop bool // stop an experiment once the metric it reports has plateaued
+	Plateau   Plateau
+
+	ConfigPort int // of the config server run on the first host of experiments with Resizes
+
+	Tags map[string]string // stored with the metadata of each record
+}
+
+func (o Options) sshOptions() ssh.Options {
+	return ssh.Options{User: o.User}
+}
+
+func (o Options) repeats() int {
+	if o.Repeats <= 0 {
+		return 1
+	}
+	return o.Repeats
+}
+
+// Runner runs experiments on the hosts it was created for
+type Runner struct {
+	opts  Options
+	hosts map[string]HostMetadata
+}
+
+// NewRunner probes the metadata of the hosts of hl, which is stored with the record of each experiment run on them
+func NewRunner(ctx context.Context, hl plan.HostList, opts Options) *Runner {
+	return &Runner{
+		opts:  opts,
+		hosts: probeMetadata(ctx, opts.sshOptions(), hl, opts.KFRoot),
+	}
+}
+
+// Counts are the numbers of experiments of a sweep by what happened to them
+type Counts struct {
+	Succ, Failed, Skipped, Expired, Unsatisfiable int
+}
+
+func (c *Counts) add(d Counts) {
+	c.Succ += d.Succ
+	c.Failed += d.Failed
+	c.Skipped += d.Skipped
+	c.Expired += d.Expired
+	c.Unsatisfiable += d.Unsatisfiable
+}
+
+// Sweep runs each config Options.Repeats times on the groups of p in parallel, in the order of their priorities,
+// configs already done in results are skipped, and the records of the others are added to results as they finish.
+// It returns early once ctx is done.
+func (r *Runner) Sweep(ctx context.Context, p Pool, configs []Config, results *Results) (Counts, error) {
+	var total Counts
+	q, err := newQueue(time.Now(), repeat(configs, r.opts.repeats()))
+	if err != nil {
+		return total, err
+	}
+	bad, reasons := q.Unsatisfiable(p.Largest())
+	for i, t := range bad {
+		log.Errorf("experiment #%d can never run: %s", t.idx, reasons[i])
+	}
+	total.Unsatisfiable = len(bad)
+	sched := newScheduler(q, p)
+	if r.opts.RebalanceInterval > 0 {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			tk := time.NewTicker(r.opts.RebalanceInterval)
+			defer tk.Stop()
+			for {
+				select {
+				case <-tk.C:
+					sched.rebalance()
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, g := range sched.groups {
+		wg.Add(1)
+		go func(g *group) {
+			defer wg.Done()
+			c := r.combine(ctx, sched, g, results)
+			mu.Lock()
+			total.add(c)
+			mu.Unlock()
+		}(g)
+	}
+	wg.Wait()
+	return total, nil
+}
+
+// combine runs the tasks of g until there is none left in the scheduler
+func (r *Runner) combine(ctx context.Context, s *scheduler, g *group, results *Results) Counts {
+	var n Counts
+	repeats := r.opts.repeats()
+	for {
+		t, ok := s.next(g)
+		if !ok {
+			return n
+		}
+		c, e := Cluster{Hostlist: g.hl.ShrinkToFit(t.peak()), Size: t.cluster.Size}, t.e
+		if results.Done(c.Size, e, repeats) {
+			log.Infof("experiment #%d already done %s, skipped", t.idx, utils.Pluralize(repeats, "time", "times"))
+			n.Skipped++
+			continue
+		}
+		if !t.deadline.IsZero() && time.Now().After(t.deadline) {
+			log.Warnf("experiment #%d missed its deadline %s, dropped", t.idx, e.Deadline)
+			n.Expired++
+			continue
+		}
+		log.Infof("running experiment #%d with %d peers on group #%d, priority: %d", t.idx, c.Size, g.id, e.Priority)
+		rec := r.Run(ctx, t.idx, c, e)
+		if ctx.Err() != nil {
+			log.Warnf("experiment #%d interrupted: %v", t.idx, ctx.Err())
+			return n
+		}
+		s.finished(g, rec.Duration)
+		if rec.OK() {
+			n.Succ++
+		} else {
+			n.Failed++
+		}
+		if err := results.Add(rec); err != nil {
+			log.Errorf("failed to save results: %v", err)
+		}
+	}
+}
+
+// Run runs e on c, which must have hosts for the largest size of the Resizes of e, and returns its record.
+// The record is incomplete if ctx is done before e finishes.
+func (r *Runner) Run(ctx context.Context, idx int, c Cluster, e tfkeras.Experiment) Record {
+	rec := Record{ClusterSize: c.Size, Experiment: e, Metadata: metadataOf(c.Hostlist, r.hosts, r.opts.Tags)}
+	var o outcome
+	d, work, err := utils.MeasureWork(func() (time.Duration, error) {
+		var err error
+		o, err = r.run(ctx, idx, c, e)
+		return o.work, err
+	})
+	rec.Duration, rec.WorkDuration = d, work
+	rec.Results, rec.Metrics, rec.EarlyStopped, rec.Resizes = o.files, o.metrics, o.earlyStopped, o.resizes
+	if err != nil && ctx.Err() == nil {
+		log.Errorf("experiment #%d failed: %v", idx, err)
+		rec.Error = err.Error()
+	}
+	return rec
+}
+
+// outcome is what a run of an experiment reports besides its duration
+type outcome struct {
+	work         time.Duration
+	files        []ResultFile
+	metrics      map[string][]float64
+	earlyStopped bool
+	resizes      []ResizeRecord
+}
+
+func (r *Runner) run(ctx context.Context, idx int, c Cluster, e tfkeras.Experiment) (outcome, error) {
+	pr := plan.DefaultPortRange
+	strategy, strategyOptions := r.opts.Strategy, base.StrategyOptions{}
+	if len(e.Strategy) > 0 {
+		s, so, err := base.ParseStrategySpec(e.Strategy)
+		if err != nil {
+			return outcome{}, err
+		}
+		strategy, strategyOptions = *s, *so
+	}
+	rs, err := parseResizes(e.Resizes)
+	if err != nil {
+		return outcome{}, err
+	}
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	var stopEarly func()
+	if r.opts.EarlyStop {
+		stopEarly = stop
+	}
+	ms, err := newMetricStream(idx, e, r.opts.Plateau, stopEarly)
+	if err != nil {
+		return outcome{}, err
+	}
+	sp := runtime.SystemParameters{
+		SSH:             r.opts.sshOptions(),
+		WorkerPortRange: pr,
+		RunnerPort:      plan.DefaultRunnerPort,
+		HostList:        c.Hostlist,
+		ClusterSize:     c.Size,
+		Nic:             r.opts.Nic,
+	}
+	var o outcome
+	d, work, err := utils.MeasureWork(func() (time.Duration, error) {
+		if len(rs) > 0 {
+			var err error
+			o.resizes, err = r.runElastic(runCtx, idx, c, e, strategy, strategyOptions, rs, sp, ms)
+			return 0, err
+		}
+		j := e.Job(r.opts.KFRoot, strategy, c.Hostlist, pr, r.opts.LogDir)
+		j.StrategyOptions = strategyOptions
+		fmt.Printf("%s\n", j.DebugString())
+		return remote.StreamStaticKungFuJob(runCtx, j, sp, r.opts.Quiet, ms.onLine)
+	})
+	log.Infof("run tfkeras.Experiment took %s, excluding launch overhead: %s", d, work)
+	o.work = work
+	if o.metrics, o.earlyStopped = ms.result(); o.earlyStopped && ctx.Err() == nil {
+		err = nil // the job failed because it was stopped
+	}
+	if len(e.ResultFiles) > 0 && ctx.Err() == nil {
+		for _, f := range remote.CollectFiles(ctx, r.opts.sshOptions(), c.Hostlist, e.ResultFiles) {
+			o.files = append(o.files, newResultFile(f))
+		}
+		log.Infof("collected %d result files", len(o.files))
+	}
+	return o, err
+}
@@ -1,12 +1,15 @@
 package tfkeras
 
 import (
+	"encoding/json"
 	"path"
 	"strconv"
 
 	"github.com/lsds/KungFu/srcs/go/kungfu/base"
 	"github.com/lsds/KungFu/srcs/go/kungfu/job"
 	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/proc"
+	"github.com/lsds/KungFu/srcs/go/utils/strictjson"
 )
 
 type Model string
@@ -42,6 +45,32 @@ type Experiment struct {
 	NumBatchPerIter int
 
 	KFOptimizer KFOptimizer
+
+	Strategy string `json:",omitempty"` // overrides -strategy, e.g. RING or RING?chunk=4MB
+
+	Envs proc.Envs `json:",omitempty"` // environment overrides, e.g. KUNGFU_CONFIG_LOG_LEVEL
+
+	Priority int    `json:",omitempty"` // experiments of higher priority are run first
+	Deadline string `json:",omitempty"` // e.g. 2h, the experiment is dropped if not started in time
+
+	ResultFiles []string `json:",omitempty"` // files written by the script on each host, collected into the record after the experiment
+
+	Metric string `json:",omitempty"` // regexp of output lines reporting a metric as its first group, DefaultMetric if empty
+
+	Resizes string `json:",omitempty"` // e.g. 60s:4,120s:8, runs the experiment in elastic mode and resizes the cluster at the times after the first metric value
+}
+
+// DefaultMetric matches the per iteration throughput reported by the benchmark script
+const DefaultMetric = `Iter #\d+: ([0-9.]+) img/sec`
+
+// Key identifies the experiment with all its settings, except how it is scheduled and collected
+func (e Experiment) Key() string {
+	e.Priority = 0
+	e.Deadline = ""
+	e.ResultFiles = nil
+	e.Metric = ""
+	bs, _ := json.Marshal(e) // keys of Envs are sorted
+	return string(bs)
 }
 
 const script = `benchmarks/system/benchmark_kungfu.py`
@@ -64,6 +93,7 @@ func (e Experiment) Job(kfRoot string, strategy base.Strategy, hl plan.HostList,
 		PortRange: pr,
 		Prog:      prog,
 		Args:      args,
+		Envs:      e.Envs,
 		LogDir:    logDir,
 	}
 }
@@ -82,22 +112,35 @@ func Default() []Experiment {
 	)
 }
 
+// New creates an experiment with the default number of iterations
+func New(m Model, opt KFOptimizer, batchSize int) Experiment {
+	return Experiment{
+		Model:           m,
+		BatchSize:       batchSize,
+		WarmupBatches:   4,
+		NumIters:        4,
+		NumBatchPerIter: 4,
+		KFOptimizer:     opt,
+	}
+}
+
 func Combination(models []Model, optimizers []KFOptimizer, batchSizes []int) []Experiment {
 	var es []Experiment
 	for _, m := range models {
 		for _, opt := range optimizers {
 			for _, bs := range batchSizes {
-				e := Experiment{
-					Model:           m,
-					BatchSize:       bs,
-					WarmupBatches:   4,
-					NumIters:        4,
-					NumBatchPerIter: 4,
-					KFOptimizer:     opt,
-				}
-				es = append(es, e)
+				es = append(es, New(m, opt, bs))
 			}
 		}
 	}
 	return es
 }
+
+// Load reads a list of experiments from a JSON file
+func Load(filename string) ([]Experiment, error) {
+	var es []Experiment
+	if err := strictjson.ReadFile(filename, &es); err != nil {
+		return nil, err
+	}
+	return es, nil
+}
@@ -28,7 +28,12 @@ go_install_old() {
         GO_X_CRYPTO_GIT_URL=https://github.com/golang/crypto.git
     fi
 
+    if [ -z "${GO_X_SYS_GIT_URL}" ]; then
+        GO_X_SYS_GIT_URL=https://github.com/golang/sys.git
+    fi
+
     get_go_source $GO_X_CRYPTO_GIT_URL $GOPATH/src/golang.org/x/crypto
+    get_go_source $GO_X_SYS_GIT_URL $GOPATH/src/golang.org/x/sys
 
     gomod=$(head -n 1 ${ROOT}/go.mod | awk '{print $2}')
     src_loc=$GOPATH/src/$gomod
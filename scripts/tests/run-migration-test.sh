@@ -0,0 +1,105 @@
+#!/bin/bash
+# Migrates a rank between two hosts in the middle of a run, and checks that the new peer resumes from its step.
+# The hosts are network namespaces of this machine, with their own /tmp for the unix sockets of runners, which requires root.
+set -e
+
+cd $(dirname $0)/../..
+. ./scripts/utils/measure.sh
+
+HOST_A=10.99.0.1
+HOST_B=10.99.0.2
+CONFIG_SERVER=http://$HOST_A:9100/config
+
+reinstall() {
+    env \
+        GOBIN=$(pwd)/bin \
+        go install -v ./srcs/go/cmd/kungfu-run ./srcs/go/cmd/kungfu-ctl ./tests/go/cmd/kungfu-test-migrate
+}
+
+setup() {
+    ip netns add kf-a
+    ip netns add kf-b
+    ip link add kf-a0 type veth peer name kf-b0
+    ip link set kf-a0 netns kf-a
+    ip link set kf-b0 netns kf-b
+    ip -n kf-a addr add $HOST_A/24 dev kf-a0
+    ip -n kf-b addr add $HOST_B/24 dev kf-b0
+    for ns in kf-a kf-b; do
+        ip -n $ns link set lo up
+    done
+    ip -n kf-a link set kf-a0 up
+    ip -n kf-b link set kf-b0 up
+}
+
+teardown() {
+    ip netns del kf-a 2>/dev/null || true
+    ip netns del kf-b 2>/dev/null || true
+}
+
+# on <namespace> <command> runs the command on the host of the namespace
+on() {
+    local ns=$1
+    shift
+    ip netns exec $ns unshare -m sh -c 'mount -t tmpfs tmpfs /tmp && exec "$@"' sh "$@"
+}
+
+kungfu_run() {
+    local self=$1
+    shift
+    ./bin/kungfu-run \
+        -q \
+        -w \
+        -H $HOST_A:2,$HOST_B:2 \
+        -np 2 \
+        -self $self \
+        -config-server $CONFIG_SERVER \
+        -timeout 60s \
+        $@
+}
+
+# on_host <namespace> <flags of kungfu-run> runs kungfu-test-migrate by the runner of the host
+on_host() {
+    local ns=$1
+    shift
+    on $ns bash -c "$(declare -f kungfu_run); $(declare -p HOST_A HOST_B CONFIG_SERVER); kungfu_run $*"
+}
+
+# wait_for <pattern> <file> waits up to 30s until a line of the file matches the pattern
+wait_for() {
+    for i in $(seq 300); do
+        if grep -q "$1" $2; then
+            return
+        fi
+        sleep 0.1
+    done
+    cat $2
+    echo "timeout waiting for: $1"
+    return 1
+}
+
+# Rank 1 is migrated from host A to host B after step 10 by kungfu.MigrateRank, and back to host A by kungfu-ctl migrate-rank.
+test_migration() {
+    local flags="./bin/kungfu-test-migrate -steps 60 -step-time 100ms -migrate-at 10 -host $HOST_B"
+    mkdir -p logs
+    rm -f logs/migration-a.log logs/migration-b.log
+    on_host kf-b $HOST_B $flags >logs/migration-b.log 2>&1 &
+    local b=$!
+    on_host kf-a $HOST_A -builtin-config-port 9100 $flags >logs/migration-a.log 2>&1 &
+    local a=$!
+    wait_for "rank 1 resumed after step 10" logs/migration-b.log
+    on kf-a ./bin/kungfu-ctl -config-server $CONFIG_SERVER migrate-rank 1 $HOST_A
+    wait $a
+    wait $b
+    cat logs/migration-a.log logs/migration-b.log
+    grep -q "rank 1/2 finished" logs/migration-a.log
+}
+
+main() {
+    measure reinstall
+    trap teardown EXIT
+    teardown
+    setup
+    measure test_migration
+}
+
+main
@@ -11,6 +11,10 @@ struct float16 {
     uint16_t value;
 };
 
+struct bfloat16 {
+    uint16_t value;
+};
+
 namespace internal
 {
 namespace types
@@ -43,6 +47,14 @@ template <> struct data_type_t<double> {
     static constexpr V value = KungFu_DOUBLE;
 };
 
+template <> struct data_type_t<bfloat16> {
+    static constexpr V value = KungFu_BFLOAT16;
+};
+
+template <> struct data_type_t<bool> {
+    static constexpr V value = KungFu_BOOL;
+};
+
 struct encoding {
     using value_type = V;
     template <typename R> static constexpr value_type value()
@@ -57,6 +69,8 @@ struct op_max;
 struct op_min;
 struct op_sum;
 struct op_prod;
+struct op_land;
+struct op_lor;
 
 namespace internal
 {
@@ -82,6 +96,14 @@ template <> struct op_type_t<op_prod> {
     static constexpr V value = KungFu_PROD;
 };
 
+template <> struct op_type_t<op_land> {
+    static constexpr V value = KungFu_LAND;
+};
+
+template <> struct op_type_t<op_lor> {
+    static constexpr V value = KungFu_LOR;
+};
+
 struct encoding {
     using value_type = V;
     template <typename R> static constexpr value_type value()
@@ -10,6 +10,8 @@ enum KungFu_Op {
     KungFu_MIN,
     KungFu_MAX,
     KungFu_PROD,
+    KungFu_LAND,  // logical AND
+    KungFu_LOR,   // logical OR
 };
 
 typedef enum KungFu_Op KungFu_Op;
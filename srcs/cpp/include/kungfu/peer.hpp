@@ -22,6 +22,25 @@ class Peer
     // metadata APIs
     uint64_t Uid() const;
 
+    // random seed of the current rank, derived from the job seed
+    uint64_t Seed() const;
+
+    // blocks while the job is paused by kungfu-ctl, must be called by all
+    // peers once per step
+    int StepFence();
+
+    // a step is between BeginStep and EndStep, the cluster only changes at
+    // EndStep, which runs StepFence and applies the changes of the config
+    // server
+    int BeginStep();
+    int EndStep(bool *changed, bool *detached);
+
+    // declares a tensor to be reduced under name, CheckTensorSchema fails if
+    // peers declared different tensors, which is also checked after resize
+    int DeclareTensor(const char *name, KungFu_Datatype dtype, const int *shape,
+                      int ndim);
+    int CheckTensorSchema();
+
     // https://www.open-mpi.org/doc/v4.0/man3/MPI_Comm_rank.3.php
     int Rank() const;
 
@@ -32,6 +51,19 @@ class Peer
     int LocalSize() const;
     int HostCount() const;
 
+    // rank and size among peers of the same role, see -role of kungfu-run
+    int RoleRank() const;
+    int RoleSize() const;
+
+    // cluster metadata store, KVGet returns the size of the value, or -1 if
+    // the key doesn't exist, the value is copied only if it fits in buf
+    int KVPut(const char *key, const void *buf, int size);
+    int KVGet(const char *key, void *buf, int capacity) const;
+
+    // runtime knob changed by kungfu-ctl tune at StepFence, e.g.
+    // fusion-buffer-size, returns -1 if the name is unknown
+    int64_t GetTunable(const char *name) const;
+
     // call Done asynchronously
     int Noop(const DoneCallback &done);
 
@@ -63,6 +95,9 @@ class Peer
     int Barrier();
     int Barrier(const DoneCallback &done);
 
+    // fails if some peers don't arrive in time, the missing ranks are logged
+    int NamedBarrier(const char *name, int timeout_ms);
+
     int Consensus(const void *buf, int count, KungFu_Datatype dtype, bool *ok,
                   const char *name);
     int Consensus(const void *buf, int count, KungFu_Datatype dtype, bool *ok,
@@ -86,6 +121,13 @@ class Peer
                        KungFu_Datatype dtype, KungFu_Op op, const char *name,
                        const DoneCallback &done);
 
+    // AllReduce among peers of the same role
+    int RoleAllReduce(const void *sendbuf, void *recvbuf, int count,
+                      KungFu_Datatype dtype, KungFu_Op op, const char *name);
+    int RoleAllReduce(const void *sendbuf, void *recvbuf, int count,
+                      KungFu_Datatype dtype, KungFu_Op op, const char *name,
+                      const DoneCallback &done);
+
     int MonitoredAllReduce(const void *sendbuf, void *recvbuf, int count,
                            KungFu_Datatype dtype, KungFu_Op op,
                            const int32_t *tree, const char *name,
@@ -104,6 +146,32 @@ class Peer
                   KungFu_Datatype dtype, const char *name,
                   const DoneCallback &done);
 
+    // collectives on different streams can be in flight at the same time,
+    // e.g. for gradients and EMA weights, their chunks are sent in turn
+    int ReduceOnStream(const void *sendbuf, void *recvbuf, int count,
+                       KungFu_Datatype dtype, KungFu_Op op, const char *name,
+                       const char *stream, const DoneCallback &done);
+    int AllReduceOnStream(const void *sendbuf, void *recvbuf, int count,
+                          KungFu_Datatype dtype, KungFu_Op op,
+                          const char *name, const char *stream);
+    int AllReduceOnStream(const void *sendbuf, void *recvbuf, int count,
+                          KungFu_Datatype dtype, KungFu_Op op,
+                          const char *name, const char *stream,
+                          const DoneCallback &done);
+    int AllGatherOnStream(const void *sendbuf, int count,
+                          KungFu_Datatype dtype, void *recvbuf,
+                          const char *name, const char *stream);
+    int AllGatherOnStream(const void *sendbuf, int count,
+                          KungFu_Datatype dtype, void *recvbuf,
+                          const char *name, const char *stream,
+                          const DoneCallback &done);
+    int BroadcastOnStream(const void *sendbuf, void *recvbuf, int count,
+                          KungFu_Datatype dtype, const char *name,
+                          const char *stream);
+    int BroadcastOnStream(const void *sendbuf, void *recvbuf, int count,
+                          KungFu_Datatype dtype, const char *name,
+                          const char *stream, const DoneCallback &done);
+
     int LocalBroadcast(const void *sendbuf, void *recvbuf, int count,
                        KungFu_Datatype dtype, const char *name);
     int LocalBroadcast(const void *sendbuf, void *recvbuf, int count,
@@ -152,6 +220,7 @@ class Peer
     // control APIs
     int ResizeCluster(const uint32_t new_size, bool *changed, bool *detached);
     int ResizeClusterFromURL(bool *changed, bool *detached);
+    int MigrateRank(int rank, const char *host, bool *changed, bool *detached);
 
     int ProposeNewSize(int new_size);
 
@@ -12,12 +12,36 @@ extern int kungfu_get_cuda_index();
 
 // helpers APIs to access kungfu without tensorflow operators
 extern uint64_t kungfu_uid();
+extern uint64_t kungfu_seed();  // get the random seed of current rank
 extern int kungfu_detached();
 extern int kungfu_rank();        // get current rank
 extern int kungfu_size();        // get current size
 extern int kungfu_local_rank();  // get current local rank
 extern int kungfu_local_size();  // get current local size
+extern int kungfu_role_rank();   // get rank among peers of the same role
+extern int kungfu_role_size();   // get number of peers of the same role
 extern void kungfu_barrier();
+extern void kungfu_step_fence();
+extern int kungfu_begin_step();
+extern int kungfu_end_step(bool *changed, bool *detached);
+extern int kungfu_declare_tensor(const char *name, int dtype, const int *shape,
+                                 int ndim);
+extern int kungfu_check_tensor_schema();
+
+extern int kungfu_named_barrier(const char *name, int timeout_ms);
+extern int kungfu_kv_put(const char *key, const void *buf, int size);
+extern int kungfu_kv_get(const char *key, void *buf, int capacity);
+extern int64_t kungfu_get_tunable(const char *name);
+
+// collectives of numpy arrays, on a stream if it is not empty, see Peer::AllReduceOnStream
+extern int kungfu_all_reduce(const void *sendbuf, void *recvbuf, int count,
+                             int dtype, int op, const char *name,
+                             const char *stream);
+extern int kungfu_broadcast(const void *sendbuf, void *recvbuf, int count,
+                            int dtype, const char *name, const char *stream);
+extern int kungfu_all_gather(const void *sendbuf, int count, int dtype,
+                             void *recvbuf, const char *name,
+                             const char *stream);
 
 extern int kungfu_propose_new_size(int new_size);
 
@@ -13,6 +13,7 @@ enum KungFu_Strategy {
     KungFu_Clique,
     KungFu_BinaryTreeStar,
     KungFu_MultiBinaryTreeStar,
+    KungFu_DoubleBinaryTree,
     KungFu_AUTO,
 };
 
@@ -18,6 +18,44 @@ bool Peer::Detached() const { return GoKungfuDetached(); }
 
 uint64_t Peer::Uid() const { return GoKungfuUID(); }
 
+uint64_t Peer::Seed() const { return GoKungfuSeed(); }
+
+int Peer::StepFence() { return GoKungfuStepFence(); }
+
+int Peer::BeginStep() { return GoKungfuBeginStep(); }
+
+int Peer::EndStep(bool *changed, bool *detached)
+{
+    static_assert(sizeof(bool) == sizeof(char), "");
+    return GoKungfuEndStep(reinterpret_cast<char *>(changed),
+                           reinterpret_cast<char *>(detached));
+}
+
+int Peer::DeclareTensor(const char *name, KungFu_Datatype dtype,
+                        const int *shape, int ndim)
+{
+    return GoKungfuDeclareTensor(const_cast<char *>(name), dtype,
+                                 const_cast<int *>(shape), GoInt(ndim));
+}
+
+int Peer::CheckTensorSchema() { return GoKungfuCheckTensorSchema(); }
+
+int Peer::KVPut(const char *key, const void *buf, int size)
+{
+    return GoKungfuKVPut(const_cast<char *>(key), const_cast<void *>(buf),
+                         GoInt(size));
+}
+
+int Peer::KVGet(const char *key, void *buf, int capacity) const
+{
+    return GoKungfuKVGet(const_cast<char *>(key), buf, GoInt(capacity));
+}
+
+int64_t Peer::GetTunable(const char *name) const
+{
+    return GoKungfuGetTunable(const_cast<char *>(name));
+}
+
 int Peer::Noop(const DoneCallback &done)
 {
     return GoKungfuNoop(new CallbackWrapper(done));
@@ -108,6 +146,15 @@ int Peer::ResizeClusterFromURL(bool *changed, bool *detached)
                                         reinterpret_cast<char *>(detached));
 }
 
+int Peer::MigrateRank(int rank, const char *host, bool *changed,
+                      bool *detached)
+{
+    static_assert(sizeof(bool) == sizeof(char), "");
+    return GoKungfuMigrateRank(GoInt(rank), const_cast<char *>(host),
+                               reinterpret_cast<char *>(changed),
+                               reinterpret_cast<char *>(detached));
+}
+
 void Peer::LogStats() { GoLogStats(); }
 
 void Peer::CalcStats() { GoCalcStats(); }
@@ -15,6 +15,8 @@ void kungfu_python_finialize() { _default_peer.reset(nullptr); }
 
 uint64_t kungfu_uid() { return _default_peer->Uid(); }
 
+uint64_t kungfu_seed() { return _default_peer->Seed(); }
+
 int kungfu_detached() { return _default_peer->Detached(); }
 
 int kungfu_rank() { return _default_peer->Rank(); }
@@ -25,8 +27,77 @@ int kungfu_local_rank() { return _default_peer->LocalRank(); }
 
 int kungfu_local_size() { return _default_peer->LocalSize(); }
 
+int kungfu_role_rank() { return _default_peer->RoleRank(); }
+
+int kungfu_role_size() { return _default_peer->RoleSize(); }
+
 void kungfu_barrier() { _default_peer->Barrier(); }
 
+void kungfu_step_fence() { _default_peer->StepFence(); }
+
+int kungfu_begin_step() { return _default_peer->BeginStep(); }
+
+int kungfu_end_step(bool *changed, bool *detached)
+{
+    return _default_peer->EndStep(changed, detached);
+}
+
+int kungfu_declare_tensor(const char *name, int dtype, const int *shape,
+                          int ndim)
+{
+    return _default_peer->DeclareTensor(
+        name, static_cast<KungFu_Datatype>(dtype), shape, ndim);
+}
+
+int kungfu_check_tensor_schema()
+{
+    return _default_peer->CheckTensorSchema();
+}
+
+int kungfu_named_barrier(const char *name, int timeout_ms)
+{
+    return _default_peer->NamedBarrier(name, timeout_ms);
+}
+
+int kungfu_kv_put(const char *key, const void *buf, int size)
+{
+    return _default_peer->KVPut(key, buf, size);
+}
+
+int kungfu_kv_get(const char *key, void *buf, int capacity)
+{
+    return _default_peer->KVGet(key, buf, capacity);
+}
+
+int64_t kungfu_get_tunable(const char *name)
+{
+    return _default_peer->GetTunable(name);
+}
+
+int kungfu_all_reduce(const void *sendbuf, void *recvbuf, int count,
+                      int dtype, int op, const char *name, const char *stream)
+{
+    return _default_peer->AllReduceOnStream(
+        sendbuf, recvbuf, count, static_cast<KungFu_Datatype>(dtype),
+        static_cast<KungFu_Op>(op), name, stream);
+}
+
+int kungfu_broadcast(const void *sendbuf, void *recvbuf, int count, int dtype,
+                     const char *name, const char *stream)
+{
+    return _default_peer->BroadcastOnStream(
+        sendbuf, recvbuf, count, static_cast<KungFu_Datatype>(dtype), name,
+        stream);
+}
+
+int kungfu_all_gather(const void *sendbuf, int count, int dtype, void *recvbuf,
+                      const char *name, const char *stream)
+{
+    return _default_peer->AllGatherOnStream(
+        sendbuf, count, static_cast<KungFu_Datatype>(dtype), recvbuf, name,
+        stream);
+}
+
 int kungfu_propose_new_size(int new_size)
 {
     return _default_peer->ProposeNewSize(new_size);
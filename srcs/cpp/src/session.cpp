@@ -15,6 +15,10 @@ int Peer::LocalSize() const { return GoKungfuLocalSize(); }
 
 int Peer::HostCount() const { return GoKungfuHostCount(); }
 
+int Peer::RoleRank() const { return GoKungfuRoleRank(); }
+
+int Peer::RoleSize() const { return GoKungfuRoleSize(); }
+
 int Peer::Barrier() { return GoKungfuBarrier(nullptr); }
 
 int Peer::Barrier(const DoneCallback &done)
@@ -22,6 +26,11 @@ int Peer::Barrier(const DoneCallback &done)
     return GoKungfuBarrier(new CallbackWrapper(done));
 }
 
+int Peer::NamedBarrier(const char *name, int timeout_ms)
+{
+    return GoKungfuNamedBarrier(const_cast<char *>(name), GoInt(timeout_ms));
+}
+
 int Peer::Consensus(const void *buf, int count, KungFu_Datatype dtype, bool *ok,
                     const char *name)
 {
@@ -81,6 +90,23 @@ int Peer::CrossAllReduce(const void *sendbuf, void *recvbuf, int count,
         const_cast<char *>(name), new CallbackWrapper(done));
 }
 
+int Peer::RoleAllReduce(const void *sendbuf, void *recvbuf, int count,
+                        KungFu_Datatype dtype, KungFu_Op op, const char *name)
+{
+    return GoKungfuRoleAllReduce(const_cast<void *>(sendbuf), recvbuf,
+                                 GoInt(count), dtype, op,
+                                 const_cast<char *>(name), nullptr);
+}
+
+int Peer::RoleAllReduce(const void *sendbuf, void *recvbuf, int count,
+                        KungFu_Datatype dtype, KungFu_Op op, const char *name,
+                        const DoneCallback &done)
+{
+    return GoKungfuRoleAllReduce(
+        const_cast<void *>(sendbuf), recvbuf, GoInt(count), dtype, op,
+        const_cast<char *>(name), new CallbackWrapper(done));
+}
+
 int Peer::MonitoredAllReduce(const void *sendbuf, void *recvbuf, int count,
                              KungFu_Datatype dtype, KungFu_Op op,
                              const int32_t *tree, const char *name,
@@ -123,6 +149,75 @@ int Peer::Broadcast(const void *sendbuf, void *recvbuf, int count,
                              new CallbackWrapper(done));
 }
 
+int Peer::ReduceOnStream(const void *sendbuf, void *recvbuf, int count,
+                         KungFu_Datatype dtype, KungFu_Op op, const char *name,
+                         const char *stream, const DoneCallback &done)
+{
+    return GoKungfuReduceOnStream(
+        const_cast<void *>(sendbuf), recvbuf, GoInt(count), dtype, op,
+        const_cast<char *>(name), const_cast<char *>(stream),
+        new CallbackWrapper(done));
+}
+
+int Peer::AllReduceOnStream(const void *sendbuf, void *recvbuf, int count,
+                            KungFu_Datatype dtype, KungFu_Op op,
+                            const char *name, const char *stream)
+{
+    return GoKungfuAllReduceOnStream(
+        const_cast<void *>(sendbuf), recvbuf, GoInt(count), dtype, op,
+        const_cast<char *>(name), const_cast<char *>(stream), nullptr);
+}
+
+int Peer::AllReduceOnStream(const void *sendbuf, void *recvbuf, int count,
+                            KungFu_Datatype dtype, KungFu_Op op,
+                            const char *name, const char *stream,
+                            const DoneCallback &done)
+{
+    return GoKungfuAllReduceOnStream(
+        const_cast<void *>(sendbuf), recvbuf, GoInt(count), dtype, op,
+        const_cast<char *>(name), const_cast<char *>(stream),
+        new CallbackWrapper(done));
+}
+
+int Peer::AllGatherOnStream(const void *sendbuf, int count,
+                            KungFu_Datatype dtype, void *recvbuf,
+                            const char *name, const char *stream)
+{
+    return GoKungfuAllGatherOnStream(
+        const_cast<void *>(sendbuf), GoInt(count), dtype, recvbuf,
+        const_cast<char *>(name), const_cast<char *>(stream), nullptr);
+}
+
+int Peer::AllGatherOnStream(const void *sendbuf, int count,
+                            KungFu_Datatype dtype, void *recvbuf,
+                            const char *name, const char *stream,
+                            const DoneCallback &done)
+{
+    return GoKungfuAllGatherOnStream(
+        const_cast<void *>(sendbuf), GoInt(count), dtype, recvbuf,
+        const_cast<char *>(name), const_cast<char *>(stream),
+        new CallbackWrapper(done));
+}
+
+int Peer::BroadcastOnStream(const void *sendbuf, void *recvbuf, int count,
+                            KungFu_Datatype dtype, const char *name,
+                            const char *stream)
+{
+    return GoKungfuBroadcastOnStream(
+        const_cast<void *>(sendbuf), recvbuf, GoInt(count), dtype,
+        const_cast<char *>(name), const_cast<char *>(stream), nullptr);
+}
+
+int Peer::BroadcastOnStream(const void *sendbuf, void *recvbuf, int count,
+                            KungFu_Datatype dtype, const char *name,
+                            const char *stream, const DoneCallback &done)
+{
+    return GoKungfuBroadcastOnStream(
+        const_cast<void *>(sendbuf), recvbuf, GoInt(count), dtype,
+        const_cast<char *>(name), const_cast<char *>(stream),
+        new CallbackWrapper(done));
+}
+
 int Peer::LocalBroadcast(const void *sendbuf, void *recvbuf, int count,
                          KungFu_Datatype dtype, const char *name)
 {
@@ -60,13 +60,15 @@ static const std::map<std::string, KungFu_Op> kungfu_ops({
     {"min", KungFu_MIN},
     {"max", KungFu_MAX},
     {"prod", KungFu_PROD},
+    {"land", KungFu_LAND},
+    {"lor", KungFu_LOR},
 });
 
 // The AllReduce operator takes a single tensor (e.g. the computed gradient),
 // and reduce (by taking sum) with the peers, and finally returns a tensor with
 // exactly the same shape.
 REGISTER_KUNGFU_OP(AllReduce)
-    .Attr("T: {int32, int64, float16, float32, float64}")
+    .Attr("T: {int32, int64, float16, float32, float64, bfloat16, bool}")
     .Attr("op: string")
     .Input("input: T")
     .Output("output: T")
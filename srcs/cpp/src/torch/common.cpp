@@ -43,6 +43,8 @@ const std::map<std::string, KungFu_Op> _kungfu_ops({
     {"min", KungFu_MIN},
     {"max", KungFu_MAX},
     {"prod", KungFu_PROD},
+    {"land", KungFu_LAND},
+    {"lor", KungFu_LOR},
 });
 
 const std::map<std::string, Torch_Tensor_Type> _torch_tensor_types({
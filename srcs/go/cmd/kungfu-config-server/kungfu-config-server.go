@@ -6,7 +6,6 @@ import (
 	"net"
 	"net/http"
 	"net/url"
-	"os"
 	"strconv"
 	"time"
 
@@ -14,6 +13,7 @@ import (
 	"github.com/lsds/KungFu/srcs/go/log"
 	"github.com/lsds/KungFu/srcs/go/plan"
 	"github.com/lsds/KungFu/srcs/go/utils"
+	"github.com/lsds/KungFu/srcs/go/utils/strictjson"
 )
 
 var (
@@ -22,6 +22,8 @@ var (
 	initFile = flag.String("init", "", "")
 	ttl      = flag.Duration("ttl", 0, "time to live")
 	endpoint = flag.String("endpoint", "/config", "URL path for Rest API")
+	hook     = flag.String("pre-resize-hook", "", "command or HTTP endpoint consulted before accepting a new cluster")
+	push     = flag.Bool("push", false, "push accepted clusters to runners watching this server with -watch-config, instead of waiting for their polls")
 )
 
 func main() {
@@ -35,12 +37,7 @@ func main() {
 	log.Infof("listening %s", listenURL.String())
 	var initCluster *plan.Cluster
 	if len(*initFile) > 0 {
-		f, err := os.Open(*initFile)
-		if err != nil {
-			utils.ExitErr(err)
-		}
-		defer f.Close()
-		if err := utils.ReadJSON(f, &initCluster); err != nil {
+		if err := strictjson.ReadFile(*initFile, &initCluster); err != nil {
 			utils.ExitErr(err)
 		}
 	}
@@ -49,9 +46,16 @@ func main() {
 		ctx, cancel = context.WithTimeout(ctx, *ttl)
 		defer cancel()
 	}
+	cs := configserver.New(cancel, initCluster, *endpoint)
+	if len(*hook) > 0 {
+		cs.SetPreResizeHook(configserver.NewHook(*hook))
+	}
+	if *push {
+		cs.EnablePush()
+	}
 	srv := &http.Server{
 		Addr:    net.JoinHostPort("", strconv.Itoa(*port)),
-		Handler: logRequest(configserver.New(cancel, initCluster, *endpoint)),
+		Handler: logRequest(cs),
 	}
 	srv.SetKeepAlivesEnabled(false)
 	defer srv.Close()
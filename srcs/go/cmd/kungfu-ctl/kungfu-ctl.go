@@ -0,0 +1,318 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/elastic/configserver"
+	"github.com/lsds/KungFu/srcs/go/kungfu/elastic/configsource"
+	"github.com/lsds/KungFu/srcs/go/kungfu/envsnap"
+	"github.com/lsds/KungFu/srcs/go/kungfu/execution"
+	"github.com/lsds/KungFu/srcs/go/kungfu/features"
+	"github.com/lsds/KungFu/srcs/go/kungfu/peer"
+	"github.com/lsds/KungFu/srcs/go/kungfu/runner"
+	"github.com/lsds/KungFu/srcs/go/kungfu/tunables"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/client"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+	"github.com/lsds/KungFu/srcs/go/utils"
+)
+
+var (
+	hostList     = flag.String("H", plan.DefaultHostList.String(), "comma separated list of <internal IP>:<nslots>, as given to kungfu-run")
+	np           = flag.Int("np", 1, "number of peers, as given to kungfu-run")
+	peerList     = flag.String("P", "", "comma separated list of <host>:<port> of the peers, will override -H and -np if specified")
+	runners      = flag.String("runners", "", "comma separated list of <host>:<port> of runners to push to, in addition to the runners of the pushed cluster")
+	configServer = flag.String("config-server", "", "URL of the config server of the watch-mode job, for add-host, drain-host, remove-host and migrate-rank")
+	logDir       = flag.String("logdir", ".", "log dir of kungfu-run, where the environments of peers are saved, for diff-env")
+	runnerPort   = flag.Int("runner-port", int(plan.DefaultRunnerPort), "port of the runner started on the host given to add-host")
+	portRange    = plan.DefaultPortRange
+)
+
+func init() {
+	flag.Var(&portRange, "port-range", "port range of the peers, as given to kungfu-run")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] pause|resume|rolling-restart [<peers at a time>]|push <config file>|tune <name>=<value>...|feature <name>=on|off,...|add-host <ip>:<slots>|drain-host <ip>|remove-host <ip>|migrate-rank <rank> <ip>|dump-state <ip>:<debug port>|diff-env <rank|file> <rank|file>\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(flag.CommandLine.Output(), "Tunables: %s\n", strings.Join(tunables.Names(), ", "))
+		fmt.Fprintf(flag.CommandLine.Output(), "Features: %s\n", strings.Join(features.Names(), ", "))
+	}
+}
+
+var commands = map[string]string{
+	"pause":  peer.PauseName,
+	"resume": peer.ResumeName,
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 2 && flag.Arg(0) == "push" {
+		if err := push(flag.Arg(1)); err != nil {
+			utils.ExitErr(err)
+		}
+		return
+	}
+	if flag.NArg() >= 2 && flag.Arg(0) == "tune" {
+		if err := tune(flag.Args()[1:]); err != nil {
+			utils.ExitErr(err)
+		}
+		return
+	}
+	if flag.NArg() >= 2 && flag.Arg(0) == "feature" {
+		if err := feature(strings.Join(flag.Args()[1:], ",")); err != nil {
+			utils.ExitErr(err)
+		}
+		return
+	}
+	if flag.NArg() >= 1 && flag.NArg() <= 2 && flag.Arg(0) == "rolling-restart" {
+		if err := rollingRestart(flag.Arg(1)); err != nil {
+			utils.ExitErr(err)
+		}
+		return
+	}
+	if flag.NArg() == 2 && flag.Arg(0) == "dump-state" {
+		if err := dumpState(flag.Arg(1)); err != nil {
+			utils.ExitErr(err)
+		}
+		return
+	}
+	if flag.NArg() == 3 && flag.Arg(0) == "diff-env" {
+		if err := diffEnv(flag.Arg(1), flag.Arg(2)); err != nil {
+			utils.ExitErr(err)
+		}
+		return
+	}
+	if flag.NArg() == 3 && flag.Arg(0) == configserver.MigrateRank {
+		if err := migrateRank(flag.Arg(1), flag.Arg(2)); err != nil {
+			utils.ExitErr(err)
+		}
+		return
+	}
+	if flag.NArg() == 2 && isHostOp(flag.Arg(0)) {
+		if err := hostOp(flag.Arg(0), flag.Arg(1)); err != nil {
+			utils.ExitErr(err)
+		}
+		return
+	}
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	name, ok := commands[flag.Arg(0)]
+	if !ok {
+		flag.Usage()
+		os.Exit(1)
+	}
+	peers, err := getPeers()
+	if err != nil {
+		utils.ExitErr(err)
+	}
+	c := client.New(plan.PeerID{}, false)
+	var send execution.PeerFunc = func(id plan.PeerID) error {
+		return c.Send(id.WithName(name), nil, connection.ConnControl, connection.NoFlag)
+	}
+	if err := send.Par(peers); err != nil {
+		utils.ExitErr(err)
+	}
+	log.Infof("%s sent to %d peers", name, len(peers))
+}
+
+func getPeers() (plan.PeerList, error) {
+	if len(*peerList) > 0 {
+		return plan.ParsePeerList(*peerList)
+	}
+	hl, err := plan.ParseHostList(*hostList)
+	if err != nil {
+		return nil, err
+	}
+	return hl.Place(*np, portRange, plan.Constraints{})
+}
+
+// rollingRestart asks the peers to replace themselves by new peers, batch peers at a time at EndStep, the job must have a config server
+func rollingRestart(batch string) error {
+	if len(batch) == 0 {
+		batch = "1"
+	}
+	if n, err := strconv.Atoi(batch); err != nil || n <= 0 {
+		return fmt.Errorf("invalid number of peers at a time: %q", batch)
+	}
+	peers, err := getPeers()
+	if err != nil {
+		return err
+	}
+	c := client.New(plan.PeerID{}, false)
+	var send execution.PeerFunc = func(id plan.PeerID) error {
+		return c.Send(id.WithName(peer.RestartName), []byte(batch), connection.ConnControl, connection.NoFlag)
+	}
+	if err := send.Par(peers); err != nil {
+		return err
+	}
+	log.Infof("rolling restart of %s at a time requested to %d peers", batch, len(peers))
+	return nil
+}
+
+// push sends the versioned cluster in the file to the runners in watch mode, which apply it immediately
+func push(filename string) error {
+	bs, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var cfg configsource.Config
+	if err := cfg.Decode(bs); err != nil {
+		return err
+	}
+	targets := cfg.Cluster.Runners
+	if len(*runners) > 0 {
+		extra, err := plan.ParsePeerList(*runners)
+		if err != nil {
+			return err
+		}
+		others, _ := extra.Diff(targets)
+		targets = append(others, targets...)
+	}
+	c := client.New(plan.PeerID{}, false)
+	if err := configsource.Push(c, targets, cfg); err != nil {
+		return err
+	}
+	log.Infof("v%d pushed to %d runners", cfg.Version, len(targets))
+	return nil
+}
+
+// tune sends the assignments of tunables to the peers, which apply them at the next step fence
+func tune(args []string) error {
+	u, err := tunables.ParseUpdate(args)
+	if err != nil {
+		return err
+	}
+	peers, err := getPeers()
+	if err != nil {
+		return err
+	}
+	bs := u.Encode()
+	c := client.New(plan.PeerID{}, false)
+	var send execution.PeerFunc = func(id plan.PeerID) error {
+		return c.Send(id.WithName(tunables.TuneName), bs, connection.ConnControl, connection.NoFlag)
+	}
+	if err := send.Par(peers); err != nil {
+		return err
+	}
+	log.Infof("%s sent to %d peers", strings.Join(args, " "), len(peers))
+	return nil
+}
+
+// feature sends the overrides of features to the peers, which negotiate them at the next step fence
+func feature(arg string) error {
+	u, err := features.ParseUpdate(arg)
+	if err != nil {
+		return err
+	}
+	if _, unknown, err := u.Apply(0, true); err != nil {
+		return err
+	} else if len(unknown) > 0 {
+		log.Warnf("features unknown to this version: %s", strings.Join(unknown, ","))
+	}
+	peers, err := getPeers()
+	if err != nil {
+		return err
+	}
+	bs := u.Encode()
+	c := client.New(plan.PeerID{}, false)
+	var send execution.PeerFunc = func(id plan.PeerID) error {
+		return c.Send(id.WithName(features.FeatureName), bs, connection.ConnControl, connection.NoFlag)
+	}
+	if err := send.Par(peers); err != nil {
+		return err
+	}
+	log.Infof("%s sent to %d peers", arg, len(peers))
+	return nil
+}
+
+func isHostOp(name string) bool {
+	return name == configserver.AddHost || name == configserver.DrainHost || name == configserver.RemoveHost
+}
+
+// hostOp asks the config server to update the hosts of the cluster, which are applied by peers at the next stage
+func hostOp(name, host string) error {
+	if len(*configServer) == 0 {
+		return fmt.Errorf("%s requires -config-server", name)
+	}
+	op := configserver.HostOp{Op: name, Host: host}
+	if name == configserver.AddHost {
+		op.RunnerPort = uint16(*runnerPort)
+	}
+	if err := configserver.PostHostOp(http.DefaultClient, *configServer, op); err != nil {
+		return err
+	}
+	log.Infof("%s %s accepted by %s", name, host, *configServer)
+	return nil
+}
+
+// migrateRank asks the config server to move the worker of rank to host, the new worker takes over its state at the next stage
+func migrateRank(rank, host string) error {
+	if len(*configServer) == 0 {
+		return fmt.Errorf("%s requires -config-server", configserver.MigrateRank)
+	}
+	r, err := strconv.Atoi(rank)
+	if err != nil {
+		return err
+	}
+	op := configserver.HostOp{Op: configserver.MigrateRank, Host: host, Rank: r}
+	if err := configserver.PostHostOp(http.DefaultClient, *configServer, op); err != nil {
+		return err
+	}
+	log.Infof("migrating rank %d to %s accepted by %s", r, host, *configServer)
+	return nil
+}
+
+// dumpState writes the state of the runner serving the REST API at addr, i.e. started with -debug-port, to stdout
+func dumpState(addr string) error {
+	resp, err := http.Get("http://" + addr + runner.APIPrefix + "/state")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(bs)))
+	}
+	_, err = io.Copy(os.Stdout, resp.Body)
+	return err
+}
+
+// diffEnv prints the differences between the environments of two peers, given by their ranks in -logdir or the files of their snapshots
+func diffEnv(x, y string) error {
+	a, err := loadEnvSnapshot(x)
+	if err != nil {
+		return err
+	}
+	b, err := loadEnvSnapshot(y)
+	if err != nil {
+		return err
+	}
+	changes := envsnap.Diff(a, b)
+	if len(changes) == 0 {
+		fmt.Printf("no difference between rank %d (%s) and rank %d (%s)\n", a.Rank, a.Host, b.Rank, b.Host)
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "\t\trank %d (%s)\trank %d (%s)\n", a.Rank, a.Host, b.Rank, b.Host)
+	for _, c := range changes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Section, c.Key, c.A, c.B)
+	}
+	return w.Flush()
+}
+
+func loadEnvSnapshot(arg string) (*envsnap.Snapshot, error) {
+	if rank, err := strconv.Atoi(arg); err == nil {
+		return envsnap.LoadRank(*logDir, rank)
+	}
+	return envsnap.Load(arg)
+}
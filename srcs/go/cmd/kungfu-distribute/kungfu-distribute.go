@@ -16,6 +16,7 @@ import (
 	"github.com/lsds/KungFu/srcs/go/proc"
 	"github.com/lsds/KungFu/srcs/go/utils"
 	"github.com/lsds/KungFu/srcs/go/utils/runner/remote"
+	"github.com/lsds/KungFu/srcs/go/utils/ssh"
 	"github.com/lsds/KungFu/srcs/go/utils/xterm"
 )
 
@@ -84,5 +85,5 @@ func distribute(ctx context.Context, hl []runner.HostSpec, prog string, args []s
 		}
 		ps = append(ps, proc)
 	}
-	return remote.RemoteRunAll(ctx, *user, ps, *verboseLog, *logDir)
+	return remote.RemoteRunAll(ctx, ssh.Options{User: *user}, ps, *verboseLog, *logDir)
 }
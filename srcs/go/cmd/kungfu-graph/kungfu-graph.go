@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/kungfu/session"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/plan/graph"
+	"github.com/lsds/KungFu/srcs/go/utils"
+)
+
+var (
+	hostList  = flag.String("H", "", "comma separated list of <internal IP>:<nslots>, as given to kungfu-run, a single host of np slots if not specified")
+	np        = flag.Int("np", 1, "number of peers, as given to kungfu-run")
+	forest    = flag.String("forest", "", "comma separated fathers of ranks of a custom strategy, as given to AllReduceWith, will override -strategy if specified")
+	maxDegree = flag.Int("max-degree", 0, "max number of peers a peer can send to in broadcast or receive from in reduce, 0 for unbounded")
+	format    = flag.String("format", "dot", "dot | svg")
+	output    = flag.String("o", "", "file to render to, stdout if not specified")
+	strategy  = kb.DefaultStrategy
+
+	strategyOptions kb.StrategyOptions
+)
+
+func init() {
+	flag.Var(kb.StrategySpec{Strategy: &strategy, Options: &strategyOptions}, "strategy", fmt.Sprintf("all reduce strategy, followed by its options after ?, e.g. TREE?fanout=2, strategies are: %s", strings.Join(kb.StrategyNames(), " | ")))
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] check|render\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+}
+
+var (
+	errInvalidForest = errors.New("invalid forest")
+	errInvalidFormat = errors.New("invalid format")
+	errInvalidGraph  = errors.New("invalid strategy graph")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	var f func(name string, reduceGraphs, bcastGraphs []*graph.Graph) error
+	switch flag.Arg(0) {
+	case "check":
+		f = check
+	case "render":
+		f = render
+	default:
+		flag.Usage()
+		os.Exit(1)
+	}
+	name, reduceGraphs, bcastGraphs, err := getGraphs()
+	if err != nil {
+		utils.ExitErr(err)
+	}
+	if err := f(name, reduceGraphs, bcastGraphs); err != nil {
+		utils.ExitErr(err)
+	}
+}
+
+func getGraphs() (string, []*graph.Graph, []*graph.Graph, error) {
+	if len(*forest) > 0 {
+		var fathers []int
+		for _, s := range strings.Split(*forest, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				return "", nil, nil, errInvalidForest
+			}
+			fathers = append(fathers, n)
+		}
+		rg, bg, ok := session.ForestGraphs(fathers)
+		if !ok {
+			return "", nil, nil, errInvalidForest
+		}
+		return "forest", []*graph.Graph{rg}, []*graph.Graph{bg}, nil
+	}
+	hl := plan.HostList{{IPv4: plan.MustParseIPv4(`127.0.0.1`), Slots: *np}}
+	if len(*hostList) > 0 {
+		var err error
+		if hl, err = plan.ParseHostList(*hostList); err != nil {
+			return "", nil, nil, err
+		}
+	}
+	peers, err := hl.GenPeerList(*np, plan.DefaultPortRange)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	reduceGraphs, bcastGraphs := session.GlobalStrategyGraphs(peers, strategy, strategyOptions)
+	return kb.FormatStrategySpec(strategy, strategyOptions), reduceGraphs, bcastGraphs, nil
+}
+
+func check(name string, reduceGraphs, bcastGraphs []*graph.Graph) error {
+	var failed int
+	for i := range reduceGraphs {
+		errs := append(reduceGraphs[i].CheckReduce(*maxDegree), bcastGraphs[i].CheckBcast(*maxDegree)...)
+		for _, err := range errs {
+			log.Errorf("%s strategy #%d: %v", name, i, err)
+		}
+		if len(errs) > 0 {
+			failed++
+		}
+	}
+	if failed > 0 {
+		log.Errorf("%d of %d strategies of %s are invalid", failed, len(reduceGraphs), name)
+		return errInvalidGraph
+	}
+	log.Infof("%d strategies of %s are valid for %d peers", len(reduceGraphs), name, len(reduceGraphs[0].Nodes))
+	return nil
+}
+
+func render(name string, reduceGraphs, bcastGraphs []*graph.Graph) error {
+	var w io.Writer = os.Stdout
+	if len(*output) > 0 {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	switch *format {
+	case "dot":
+		writeDot(w, name, reduceGraphs, bcastGraphs)
+	case "svg":
+		writeSVG(w, name, reduceGraphs, bcastGraphs)
+	default:
+		return errInvalidFormat
+	}
+	return nil
+}
+
+func writeDot(w io.Writer, name string, reduceGraphs, bcastGraphs []*graph.Graph) {
+	fmt.Fprintf(w, "digraph %q {\n", name)
+	for i := range reduceGraphs {
+		reduceGraphs[i].WriteDot(w, fmt.Sprintf("reduce#%d", i))
+		bcastGraphs[i].WriteDot(w, fmt.Sprintf("bcast#%d", i))
+	}
+	fmt.Fprintf(w, "}\n")
+}
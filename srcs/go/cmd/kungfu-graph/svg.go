@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/lsds/KungFu/srcs/go/plan/graph"
+)
+
+const (
+	panelSize    = 360
+	vertexRadius = 14
+)
+
+// writeSVG draws the reduce and broadcast graphs of each strategy side by side in a row,
+// with vertices placed on a circle, and contributing vertices (with self-edges) filled.
+func writeSVG(w io.Writer, name string, reduceGraphs, bcastGraphs []*graph.Graph) {
+	width, height := 2*panelSize, len(reduceGraphs)*panelSize+30
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="12">`+"\n", width, height)
+	fmt.Fprintf(w, `<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="6" markerHeight="6" orient="auto"><path d="M 0 0 L 10 5 L 0 10 z"/></marker></defs>`+"\n")
+	fmt.Fprintf(w, `<text x="10" y="20" font-size="16">%s</text>`+"\n", name)
+	for i := range reduceGraphs {
+		y := 30 + i*panelSize
+		writePanel(w, fmt.Sprintf("reduce#%d", i), reduceGraphs[i], 0, y)
+		writePanel(w, fmt.Sprintf("bcast#%d", i), bcastGraphs[i], panelSize, y)
+	}
+	fmt.Fprintf(w, "</svg>\n")
+}
+
+func writePanel(w io.Writer, title string, g *graph.Graph, x0, y0 int) {
+	fmt.Fprintf(w, `<g transform="translate(%d,%d)">`+"\n", x0, y0)
+	fmt.Fprintf(w, `<rect x="5" y="5" width="%d" height="%d" fill="none" stroke="#ccc"/>`+"\n", panelSize-10, panelSize-10)
+	fmt.Fprintf(w, `<text x="15" y="25">%s</text>`+"\n", title)
+	n := len(g.Nodes)
+	c := float64(panelSize) / 2
+	r := c - 3*vertexRadius
+	pos := func(i int) (float64, float64) {
+		if n == 1 {
+			return c, c
+		}
+		a := 2*math.Pi*float64(i)/float64(n) - math.Pi/2
+		return c + r*math.Cos(a), c + r*math.Sin(a)
+	}
+	for i, node := range g.Nodes {
+		x1, y1 := pos(i)
+		for _, j := range node.Nexts {
+			x2, y2 := pos(j)
+			d := math.Hypot(x2-x1, y2-y1)
+			if d == 0 {
+				continue
+			}
+			dx, dy := (x2-x1)/d*vertexRadius, (y2-y1)/d*vertexRadius
+			fmt.Fprintf(w, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="black" marker-end="url(#arrow)"/>`+"\n", x1+dx, y1+dy, x2-dx, y2-dy)
+		}
+	}
+	for i, node := range g.Nodes {
+		x, y := pos(i)
+		fill := "white"
+		if node.SelfLoop {
+			fill = "#9cf"
+		}
+		fmt.Fprintf(w, `<circle cx="%.1f" cy="%.1f" r="%d" fill="%s" stroke="black"/>`+"\n", x, y, vertexRadius, fill)
+		fmt.Fprintf(w, `<text x="%.1f" y="%.1f" text-anchor="middle" dominant-baseline="central">%d</text>`+"\n", x, y, i)
+	}
+	fmt.Fprintf(w, "</g>\n")
+}
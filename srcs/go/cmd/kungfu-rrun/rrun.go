@@ -17,12 +17,31 @@ func init() { runner.Init(&f, os.Args) }
 
 func main() {
 	j := job.Job{
-		Strategy:  f.Strategy,
-		HostList:  f.HostList,
-		PortRange: f.PortRange,
-		Prog:      f.Prog,
-		Args:      f.Args,
-		LogDir:    f.LogDir,
+		ID:              f.JobID,
+		RankStore:       f.RankStore,
+		Strategy:        f.Strategy,
+		StrategyOptions: f.StrategyOptions,
+		HostList:        f.HostList,
+		PortRange:       f.PortRange,
+		Constraints:     f.Constraints,
+		Prog:            f.Prog,
+		Binaries:        f.Binaries,
+		Args:            f.Args,
+		Role:            f.Role,
+		Programs:        f.Programs,
+		LogDir:          f.LogDir,
+		Dir:             f.Dir,
+		EnvProbe:        f.EnvProbe,
+		Webhooks:        f.Webhooks,
+
+		StartStagger: f.StartStagger,
+
+		PinCores:      f.PinCores,
+		ReservedCores: f.ReservedCores,
+		Oversubscribe: f.Oversubscribe,
+		PreferFamily:  f.PreferFamily,
+
+		DegradedPolicy: f.DegradedPolicy,
 	}
 	ctx, cancel := context.WithCancel(context.Background())
 	if f.Timeout > 0 {
@@ -30,13 +49,21 @@ func main() {
 		defer cancel()
 	}
 	sp := runtime.SystemParameters{
-		User:            f.User,
+		SSH:             remote.SSHOptions(&f),
 		WorkerPortRange: f.PortRange,
 		RunnerPort:      uint16(f.Port),
 		HostList:        f.HostList,
 		ClusterSize:     f.ClusterSize,
 		Nic:             f.NIC,
 	}
+	if f.Preflight {
+		if err := remote.Preflight(ctx, sp.SSH, f.HostList); err != nil {
+			utils.ExitErr(err)
+		}
+	}
+	if err := remote.CheckPrograms(ctx, j, sp); err != nil {
+		utils.ExitErr(err)
+	}
 	if err := remote.RunStaticKungFuJob(ctx, j, sp, f.Quiet); err != nil {
 		utils.ExitErr(err)
 	}
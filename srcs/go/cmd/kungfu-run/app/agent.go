@@ -0,0 +1,154 @@
+package app
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/utils"
+)
+
+const installAgentCmd = `install-agent`
+
+// agentFlags make kungfu-run a persistent agent which waits for peers to propose clusters
+var agentFlags = []string{`-w`, `-k`, `-init-version`, `-1`}
+
+type agentUnit struct {
+	Name        string
+	User        string
+	ExecStart   string
+	Restart     string
+	RestartSec  time.Duration
+	LogDir      string
+	MemoryMax   string
+	CPUQuota    string
+	LimitNOFILE int
+	Envs        []string
+}
+
+var agentUnitTemplate = template.Must(template.New("unit").Parse(`[Unit]
+Description=KungFu agent {{.Name}}
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+{{- if .User}}
+User={{.User}}
+{{- end}}
+ExecStart={{.ExecStart}}
+{{- range .Envs}}
+Environment={{.}}
+{{- end}}
+Restart={{.Restart}}
+RestartSec={{.RestartSec.Seconds}}
+KillMode=control-group
+{{- if .LogDir}}
+StandardOutput=append:{{.LogDir}}/{{.Name}}.log
+StandardError=append:{{.LogDir}}/{{.Name}}.log
+{{- else}}
+StandardOutput=journal
+StandardError=journal
+{{- end}}
+{{- if .MemoryMax}}
+MemoryMax={{.MemoryMax}}
+{{- end}}
+{{- if .CPUQuota}}
+CPUQuota={{.CPUQuota}}
+{{- end}}
+{{- if gt .LimitNOFILE 0}}
+LimitNOFILE={{.LimitNOFILE}}
+{{- end}}
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+// installAgent generates a systemd unit running kungfu-run as a persistent agent of this host,
+// flags after -- are passed to the agent.
+func installAgent(args []string) {
+	var u agentUnit
+	var unitDir string
+	var dryRun, noStart bool
+	var envs string
+	fs := flag.NewFlagSet(args[0]+" "+installAgentCmd, flag.ExitOnError)
+	fs.StringVar(&u.Name, "name", "kungfu-agent", "name of the systemd service")
+	fs.StringVar(&u.User, "user", "", "user to run the agent, default is root")
+	fs.StringVar(&u.Restart, "restart", "on-failure", "restart policy: no | on-failure | always")
+	fs.DurationVar(&u.RestartSec, "restart-sec", 5*time.Second, "delay before restart")
+	fs.StringVar(&u.LogDir, "logdir", "", "append the agent output to <logdir>/<name>.log, default is journal")
+	fs.StringVar(&u.MemoryMax, "memory-max", "", "memory limit of the agent and its peers, e.g. 64G")
+	fs.StringVar(&u.CPUQuota, "cpu-quota", "", "CPU quota of the agent and its peers, e.g. 800%")
+	fs.IntVar(&u.LimitNOFILE, "limit-nofile", 65536, "limit of open files, 0 to use the system default")
+	fs.StringVar(&envs, "envs", "", "comma separated <key>=<value> environment variables of the agent")
+	fs.StringVar(&unitDir, "unit-dir", "/etc/systemd/system", "directory to install the unit file")
+	fs.BoolVar(&dryRun, "dry-run", false, "print the unit file instead of installing it")
+	fs.BoolVar(&noStart, "no-start", false, "install the unit file without enabling and starting it")
+	fs.Parse(args[2:])
+
+	exe, err := os.Executable()
+	if err != nil {
+		utils.ExitErr(err)
+	}
+	u.ExecStart = formatExecStart(append([]string{exe}, append(agentFlags, fs.Args()...)...))
+	if len(envs) > 0 {
+		for _, kv := range strings.Split(envs, ",") {
+			u.Envs = append(u.Envs, quoteUnit(kv))
+		}
+	}
+	b := &bytes.Buffer{}
+	if err := agentUnitTemplate.Execute(b, u); err != nil {
+		utils.ExitErr(err)
+	}
+	if dryRun {
+		fmt.Print(b.String())
+		return
+	}
+	filename := filepath.Join(unitDir, u.Name+".service")
+	// the unit may have secrets in Environment=, WriteFile keeps the mode of an existing file
+	if err := os.Chmod(filename, 0600); err != nil && !os.IsNotExist(err) {
+		utils.ExitErr(err)
+	}
+	if err := ioutil.WriteFile(filename, b.Bytes(), 0600); err != nil {
+		utils.ExitErr(err)
+	}
+	log.Infof("installed %s", filename)
+	if noStart {
+		return
+	}
+	for _, cmd := range [][]string{
+		{`systemctl`, `daemon-reload`},
+		{`systemctl`, `enable`, `--now`, u.Name},
+	} {
+		if out, err := exec.Command(cmd[0], cmd[1:]...).CombinedOutput(); err != nil {
+			utils.ExitErr(fmt.Errorf("%s: %v %s", strings.Join(cmd, " "), err, out))
+		}
+	}
+	log.Infof("%s enabled and started", u.Name)
+}
+
+// formatExecStart quotes the arguments as systemd parses ExecStart
+func formatExecStart(args []string) string {
+	var ss []string
+	for _, a := range args {
+		if len(a) == 0 || strings.ContainsAny(a, " \t\"'\\$%;") {
+			a = quoteUnit(strings.Replace(a, "$", "$$", -1))
+		}
+		ss = append(ss, a)
+	}
+	return strings.Join(ss, " ")
+}
+
+// quoteUnit quotes a value of a unit setting, with the specifiers escaped, as systemd expands them in ExecStart and Environment
+func quoteUnit(s string) string {
+	return strconv.Quote(strings.Replace(s, "%", "%%", -1))
+}
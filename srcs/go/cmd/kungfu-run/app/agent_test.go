@@ -0,0 +1,32 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/lsds/KungFu/srcs/go/utils/assert"
+)
+
+func Test_FormatExecStart(t *testing.T) {
+	for _, c := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{`/usr/bin/kungfu-run`, `-w`, `-np`, `4`}, `/usr/bin/kungfu-run -w -np 4`},
+		{[]string{`a b`, ``}, `"a b" ""`},
+		{[]string{`-logdir`, `/data/%h`}, `-logdir "/data/%%h"`},
+		{[]string{`$HOME`, `a;b`}, `"$$HOME" "a;b"`},
+		{[]string{`say "hi"`, `C:\tmp`, `it's`}, `"say \"hi\"" "C:\\tmp" "it's"`},
+	} {
+		got := formatExecStart(c.args)
+		if got != c.want {
+			t.Errorf("formatExecStart(%q) = %s, want %s", c.args, got, c.want)
+		}
+	}
+}
+
+func Test_QuoteUnit(t *testing.T) {
+	assert.True(quoteUnit(`KUNGFU_CONFIG_LOG_LEVEL=DEBUG`) == `"KUNGFU_CONFIG_LOG_LEVEL=DEBUG"`)
+	assert.True(quoteUnit(`NCCL_SOCKET_IFNAME=eth0 eth1`) == `"NCCL_SOCKET_IFNAME=eth0 eth1"`)
+	assert.True(quoteUnit(`TOKEN=a%b"c`) == `"TOKEN=a%%b\"c"`)
+	assert.True(quoteUnit("MSG=a\nb") == `"MSG=a\nb"`)
+}
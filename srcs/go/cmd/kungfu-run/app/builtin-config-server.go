@@ -6,19 +6,28 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
 	"github.com/lsds/KungFu/srcs/go/kungfu/elastic/configserver"
 	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/client"
 )
 
-func runBuiltinConfigServer(port int) {
+func runBuiltinConfigServer(port int, hooks []configserver.Hook, hosts *configserver.HostTable, audit *configserver.AuditLog) {
 	const endpoint = `/config`
 	addr := net.JoinHostPort("", strconv.Itoa(port))
 	log.Infof("running builtin config server listening %s%s", addr, endpoint)
 	_, cancel := context.WithCancel(context.TODO())
 	defer cancel()
+	cs := configserver.New(cancel, nil, endpoint)
+	if len(hooks) > 0 {
+		cs.SetPreResizeHook(configserver.Chain(hooks...))
+	}
+	cs.SetAuditLog(audit)
+	cs.SetHostTable(hosts)
 	srv := &http.Server{
 		Addr:    addr,
-		Handler: logRequest(configserver.New(cancel, nil, endpoint)),
+		Handler: logRequest(cs),
 	}
 	srv.SetKeepAlivesEnabled(false)
 	if err := srv.ListenAndServe(); err != nil {
@@ -32,3 +41,9 @@ func logRequest(h http.Handler) http.Handler {
 		h.ServeHTTP(w, req)
 	})
 }
+
+// newProbe measures the latency to a peer by ping
+func newProbe(self plan.PeerID) configserver.Probe {
+	c := client.New(self, config.UseUnixSock)
+	return c.Ping
+}
@@ -0,0 +1,22 @@
+package app
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/job"
+)
+
+// reportCheck prints the problems found by -check-only as JSON to stdout, for remote.CheckPrograms, and exits with 1 if there are any
+func reportCheck(err error) {
+	var r job.ProgramCheckError
+	if e, ok := err.(*job.ProgramCheckError); ok {
+		r = *e
+	} else if err != nil {
+		r.Problems = []string{err.Error()}
+	}
+	json.NewEncoder(os.Stdout).Encode(r)
+	if len(r.Problems) > 0 {
+		os.Exit(1)
+	}
+}
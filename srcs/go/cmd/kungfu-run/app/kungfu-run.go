@@ -2,30 +2,54 @@ package app
 
 import (
 	"context"
-	"fmt"
 	"os"
 	"path"
+	"runtime/debug"
+	"strings"
 	"time"
 
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/kungfu/elastic/configserver"
 	"github.com/lsds/KungFu/srcs/go/kungfu/job"
+	"github.com/lsds/KungFu/srcs/go/kungfu/launcher"
+	"github.com/lsds/KungFu/srcs/go/kungfu/perfreport"
 	"github.com/lsds/KungFu/srcs/go/kungfu/runner"
 	"github.com/lsds/KungFu/srcs/go/log"
 	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
 	"github.com/lsds/KungFu/srcs/go/utils"
-	"github.com/lsds/KungFu/srcs/go/utils/xterm"
+	"github.com/lsds/KungFu/srcs/go/utils/iostream"
 )
 
 func Main(args []string) {
+	if len(args) > 1 && args[1] == installAgentCmd {
+		installAgent(args)
+		return
+	}
 	var f runner.FlagSet
 	runner.Init(&f, args)
+	if f.CheckOnly {
+		log.SetOutput(os.Stderr) // stdout is left for the report
+	}
+	// the ranks sharing a slot are placed as if the host had more slots
+	f.HostList = f.HostList.Oversubscribe(f.Oversubscribe)
+	if f.Simulate {
+		runSimulation(&f)
+		return
+	}
 	if f.DelayStart > 0 {
 		log.Warnf("delay start for %s", f.DelayStart)
 		time.Sleep(f.DelayStart)
 	}
-	if f.BuiltinConfigPort > 0 {
-		go runBuiltinConfigServer(f.BuiltinConfigPort)
-	}
-	if logfile := f.Logfile; len(logfile) > 0 {
+	iostream.SetRotation(f.LogRotation)
+	if logfile := f.Logfile; len(logfile) > 0 && f.LogRotation.Enabled() {
+		if len(f.LogDir) > 0 {
+			logfile = path.Join(f.LogDir, logfile)
+		}
+		lf := iostream.NewRotatingFile(logfile, f.LogRotation)
+		defer lf.Close()
+		log.SetOutput(lf)
+	} else if len(logfile) > 0 {
 		if len(f.LogDir) > 0 {
 			logfile = path.Join(f.LogDir, logfile)
 		}
@@ -40,49 +64,128 @@ func Main(args []string) {
 		defer lf.Close()
 		log.SetOutput(lf)
 	}
+	if len(f.LogSinks) > 0 {
+		sinks, err := log.ParseSinks(strings.Join(f.LogSinks, ","))
+		if err != nil {
+			utils.ExitErr(err)
+		}
+		for _, s := range sinks {
+			log.AddSink(s)
+		}
+	}
+	defer log.CloseSinks()
 	t0 := time.Now()
 	defer func(prog string) { log.Debugf("%s finished, took %s", prog, time.Since(t0)) }(utils.ProgName())
+	if f.GCPercent > 0 {
+		debug.SetGCPercent(f.GCPercent)
+	}
+	if f.PerfReport {
+		r := perfreport.Start()
+		defer func(prog string) { log.Infof("perf report of %s:\n%s", prog, r.Report()) }(utils.ProgName())
+	}
+	// runners dial each other as peers do
+	config.PreferFamily = f.PreferFamily
+	connection.SetHostAddrs(f.HostList.PublicAddrs())
 	localhostIPv4, err := runner.InferSelfIPv4(f.Self, f.NIC)
 	if err != nil {
 		utils.ExitErr(err)
 	}
 	log.Debugf("Using self=%s", plan.FormatIPv4(localhostIPv4))
-	self := plan.PeerID{IPv4: localhostIPv4, Port: uint16(f.Port)}
-	var hl plan.HostList
-	var peers plan.PeerList
-	var runners plan.PeerList
-	// if len(f.HostList) > 0 {
-	{
-		hl = f.HostList
-		// hl, err = runner.ResolveHostList(f.HostList, f.NIC)
-		// if err != nil {
-		// 	utils.ExitErr(fmt.Errorf("failed to parse -H: %v", err))
-		// }
-		runners = hl.GenRunnerList(uint16(f.Port)) // FIXME: assuming runner port is the same
-		if _, ok := runners.Rank(self); !ok {
-			utils.ExitErr(fmt.Errorf("%s not in %s", self, runners))
+	self := plan.PeerID{IPv4: localhostIPv4, Port: f.HostList.RunnerPortOf(localhostIPv4, uint16(f.Port))}
+	j := job.Job{
+		ID:              f.JobID,
+		RankStore:       f.RankStore,
+		StartTime:       time.Unix(int64(f.JobStartTime), 0),
+		Strategy:        f.Strategy,
+		StrategyOptions: f.StrategyOptions,
+		HostList:        f.HostList,
+		PortRange:       f.PortRange,
+		Constraints:     f.Constraints,
+		RankMap:         f.RankMap,
+		Prog:            f.Prog,
+		Binaries:        f.Binaries,
+		Args:            f.Args,
+		Role:            f.Role,
+		Programs:        f.Programs,
+		LogDir:          f.LogDir,
+		Dir:             f.Dir,
+		EnvProbe:        f.EnvProbe,
+		AllowNVLink:     f.AllowNVLink,
+
+		StartStagger: f.StartStagger,
+
+		PinCores:      f.PinCores,
+		ReservedCores: f.ReservedCores,
+		Oversubscribe: f.Oversubscribe,
+		PreferFamily:  f.PreferFamily,
+
+		LeasePeriod:       f.LeasePeriod,
+		RescheduleEvicted: f.RescheduleEvicted,
+		DegradedPolicy:    f.DegradedPolicy,
+		TelemetryPeriod:   f.TelemetryPeriod,
+		LinkProbePeriod:   f.LinkProbePeriod,
+		JobQuota:          f.JobQuota,
+		JobTokens:         f.JobTokens,
+		Seed:              f.Seed,
+		LogSinks:          f.LogSinks,
+		Webhooks:          f.Webhooks,
+		PerfReport:        f.PerfReport,
+		GCPercent:         f.GCPercent,
+
+		MaxClockSkew:        f.MaxClockSkew,
+		RequireSyncedClocks: f.RequireSyncedClocks,
+	}
+	if f.Watch {
+		j.ConfigServer = f.ConfigServer
+	}
+	var ranks *runner.RankStore
+	if len(j.ID) > 0 {
+		if ranks, err = runner.OpenRankStore(j.RankStore, j.ID); err != nil {
+			utils.ExitErr(err)
 		}
-		peers, err = hl.GenPeerList(f.ClusterSize, f.PortRange)
-		if err != nil {
-			utils.ExitErr(fmt.Errorf("failed to create peers: %v", err))
+		if m, ok := ranks.Load(j.HostList, f.ClusterSize, j.PortRange); ok && len(j.RankMap) == 0 {
+			log.Infof("keeping the ranks of the last run of job %s", j.ID)
+			j.RankMap = m
+		}
+	}
+	l := launcher.New(launcher.Config{
+		Self:           self,
+		RunnerPort:     uint16(f.Port),
+		ClusterSize:    f.ClusterSize,
+		Job:            j,
+		Watch:          f.Watch,
+		Keep:           f.Keep,
+		InitVersion:    f.InitVersion,
+		DebugPort:      f.DebugPort,
+		DebugHost:      f.DebugHost,
+		WatchConfig:    f.WatchConfig,
+		WatchPeriod:    f.WatchPeriod,
+		Region:         f.Region,
+		Federation:     f.Federation,
+		FederationPort: f.FederationPort,
+		VerboseLog:     f.VerboseLog,
+		Summary:        f.Summary,
+		ForwardCrashes: f.ForwardCrashes,
+	})
+	cluster, err := l.InitCluster()
+	if err != nil {
+		utils.ExitErr(err)
+	}
+	err = j.CheckPrograms(*cluster, self.IPv4)
+	if f.CheckOnly {
+		reportCheck(err)
+		return
+	}
+	if err != nil {
+		utils.ExitErr(err)
+	}
+	if err := runner.WriteRankFiles(f.RankfileOut, f.RankMapOut, j.RankAssignments(*cluster)); err != nil {
+		utils.ExitErr(err)
+	}
+	if ranks != nil {
+		if err := ranks.Save(cluster.Workers); err != nil {
+			log.Warnf("failed to save the ranks of job %s: %v", j.ID, err)
 		}
-	} //else {
-	// peers, err = runner.ResolvePeerList(localhostIPv4, uint16(f.Port), f.PeerList)
-	// if err != nil {
-	// 	utils.ExitErr(fmt.Errorf("failed to resolve peers: %v", err))
-	// }
-	// log.Infof("-P resolved as %s", peers)
-	// }
-	j := job.Job{
-		StartTime:   time.Unix(int64(f.JobStartTime), 0),
-		Strategy:    f.Strategy,
-		Parent:      self,
-		HostList:    f.HostList,
-		PortRange:   f.PortRange,
-		Prog:        f.Prog,
-		Args:        f.Args,
-		LogDir:      f.LogDir,
-		AllowNVLink: f.AllowNVLink,
 	}
 	ctx, cancel := context.WithCancel(context.Background())
 	trap(cancel)
@@ -90,24 +193,34 @@ func Main(args []string) {
 		ctx, cancel = context.WithTimeout(ctx, f.Timeout)
 		defer cancel()
 	}
-	initCluster := plan.Cluster{
-		Runners: runners,
-		Workers: peers,
-	}
-	if f.Watch {
-		ch := make(chan runner.Stage, 1)
-		if f.InitVersion < 0 {
-			log.Infof(xterm.Blue.S("waiting to be initialized"))
-		} else {
-			ch <- runner.Stage{
-				Cluster: initCluster,
-				Version: f.InitVersion,
+	if f.BuiltinConfigPort > 0 {
+		var hooks []configserver.Hook
+		if len(f.PreResizeHook) > 0 {
+			hooks = append(hooks, configserver.NewHook(f.PreResizeHook))
+		}
+		if len(f.Provider) > 0 {
+			autoscaler, err := newAutoscaler(ctx, &f, j)
+			if err != nil {
+				utils.ExitErr(err)
 			}
+			defer autoscaler.Release(context.Background())
+			hooks = append(hooks, autoscaler.PreResize)
 		}
-		j.ConfigServer = f.ConfigServer
-		runner.WatchRun(ctx, self, runners, ch, j, f.Keep, f.DebugPort)
-	} else {
-		runner.SimpleRun(ctx, localhostIPv4, initCluster, j, f.VerboseLog)
+		var audit *configserver.AuditLog
+		if len(f.AuditLog) > 0 {
+			var err error
+			if audit, err = configserver.OpenAuditLog(f.AuditLog); err != nil {
+				utils.ExitErr(err)
+			}
+			defer audit.Close()
+		}
+		hosts := configserver.NewHostTable(f.HostList)
+		hooks = append(hooks, configserver.NewEvictionHook(f.EvictionPolicy, hosts.Live, newProbe(self), audit))
+		hooks = append(hooks, configserver.NewPlacementHook(hosts.Live, audit))
+		go runBuiltinConfigServer(f.BuiltinConfigPort, hooks, hosts, audit)
+	}
+	if err := l.Run(ctx); err != nil {
+		utils.ExitErr(err)
 	}
 }
 
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/elastic/provision"
+	"github.com/lsds/KungFu/srcs/go/kungfu/job"
+	"github.com/lsds/KungFu/srcs/go/kungfu/runner"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/proc"
+	"github.com/lsds/KungFu/srcs/go/utils/runner/remote"
+)
+
+var errProviderRequiresWatch = errors.New("-provider requires -w and -config-server")
+
+func newAutoscaler(ctx context.Context, f *runner.FlagSet, j job.Job) (*provision.Autoscaler, error) {
+	if !f.Watch || len(f.ConfigServer) == 0 {
+		return nil, errProviderRequiresWatch
+	}
+	p, err := provision.New(f.Provider, f.ProviderConfig)
+	if err != nil {
+		return nil, err
+	}
+	slots := 1
+	if ec2, ok := p.(*provision.EC2); ok && ec2.Slots > 0 {
+		slots = ec2.Slots
+	}
+	return &provision.Autoscaler{
+		Provider:     p,
+		Hosts:        f.HostList,
+		SlotsPerHost: slots,
+		RunnerPort:   uint16(f.Port),
+		Constraints:  f.Constraints,
+		Launch: func(_ context.Context, newHosts, allHosts plan.HostList) error {
+			go launchRunners(ctx, f, j, newHosts, allHosts)
+			return nil
+		},
+	}, nil
+}
+
+// launchRunners starts kungfu-run on new hosts via SSH, the runners wait to be initialized by the next update
+func launchRunners(ctx context.Context, f *runner.FlagSet, j job.Job, newHosts, allHosts plan.HostList) {
+	flags := []string{
+		`-w`,
+		`-k`,
+		`-init-version`, `-1`,
+		`-config-server`, f.ConfigServer,
+		`-H`, allHosts.String(),
+		`-port`, strconv.Itoa(f.Port),
+		`-port-range`, f.PortRange.String(),
+		`-strategy`, j.StrategySpec(),
+		`-logdir`, f.LogDir,
+	}
+	if len(j.Role) > 0 {
+		flags = append(flags, `-role`, j.Role)
+	}
+	if len(j.EnvProbe) > 0 {
+		flags = append(flags, `-env-probe`, strconv.Quote(j.EnvProbe))
+	}
+	var ps []proc.Proc
+	for _, h := range newHosts {
+		args := append([]string{`-self`, plan.FormatIPv4(h.IPv4)}, flags...)
+		ps = append(ps, proc.Proc{
+			Name:     plan.FormatIPv4(h.IPv4),
+			Prog:     `kungfu-run`,
+			Args:     append(args, j.ProgAndArgs()...),
+			Hostname: h.PublicAddr,
+		})
+	}
+	if err := remote.RemoteRunAll(ctx, remote.SSHOptions(f), ps, f.VerboseLog, f.LogDir); err != nil {
+		log.Errorf("runners on provisioned hosts failed: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/kungfu/env"
+	"github.com/lsds/KungFu/srcs/go/kungfu/peer"
+	"github.com/lsds/KungFu/srcs/go/kungfu/runner"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/utils"
+)
+
+const simulatedTensorSize = 1 << 16
+
+// runSimulation runs all peers as goroutines of this process over an in-memory transport
+func runSimulation(f *runner.FlagSet) {
+	if len(f.Prog) > 0 {
+		log.Warnf("%s is ignored in simulation mode", f.Prog)
+	}
+	config.InprocTransport = true
+	self := plan.PeerID{IPv4: plan.MustParseIPv4(`127.0.0.1`), Port: uint16(f.Port)}
+	hl := plan.HostList{{IPv4: self.IPv4, Slots: f.ClusterSize}}
+	peers, err := hl.GenPeerList(f.ClusterSize, f.PortRange)
+	if err != nil {
+		utils.ExitErr(fmt.Errorf("failed to create peers: %v", err))
+	}
+	log.Infof("simulating %d peers with strategy %s", len(peers), base.FormatStrategySpec(f.Strategy, f.StrategyOptions))
+	t0 := time.Now()
+	var wg sync.WaitGroup
+	errs := make([]error, len(peers))
+	for i, id := range peers {
+		wg.Add(1)
+		go func(i int, id plan.PeerID) {
+			defer wg.Done()
+			errs[i] = simulatePeer(&env.Config{
+				Self:               id,
+				Parent:             self,
+				InitRunners:        plan.PeerList{self},
+				InitPeers:          peers,
+				Strategy:           f.Strategy,
+				StrategyOptions:    f.StrategyOptions,
+				InitClusterVersion: "0",
+			}, f.SimulateSteps)
+		}(i, id)
+	}
+	wg.Wait()
+	if err := utils.MergeErrors(errs, "simulation"); err != nil {
+		utils.ExitErr(err)
+	}
+	log.Infof("simulated %d steps of %d peers, took %s", f.SimulateSteps, len(peers), time.Since(t0))
+}
+
+func simulatePeer(cfg *env.Config, steps int) error {
+	p, err := peer.NewFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	if err := p.Start(); err != nil {
+		return err
+	}
+	defer p.Close()
+	sess := p.CurrentSession()
+	if err := sess.Barrier(); err != nil {
+		return err
+	}
+	np, rank := sess.Size(), sess.Rank()
+	x := base.NewVector(simulatedTensorSize, base.F32)
+	y := base.NewVector(simulatedTensorSize, base.F32)
+	want := float32(np*(np+1)) / 2
+	for step := 0; step < steps; step++ {
+		xs := x.AsF32()
+		for i := range xs {
+			xs[i] = float32(rank + 1)
+		}
+		w := base.Workspace{
+			SendBuf: x,
+			RecvBuf: y,
+			OP:      base.SUM,
+			Name:    fmt.Sprintf("simulated-%d", step),
+		}
+		if err := sess.AllReduce(w); err != nil {
+			return err
+		}
+		for i, v := range y.AsF32() {
+			if v != want {
+				return fmt.Errorf("rank %d step %d: y[%d] = %f, want %f", rank, step, i, v, want)
+			}
+		}
+	}
+	return sess.Barrier()
+}
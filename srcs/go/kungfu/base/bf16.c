@@ -0,0 +1,60 @@
+#include "bf16.h"
+
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+// bfloat16 is the upper half of an IEEE 754 float32, so it is reduced in
+// float32 and rounded back to nearest even.
+
+static float bfloat16_to_float(uint16_t x)
+{
+    const uint32_t bits = (uint32_t)x << 16;
+    float f;
+    memcpy(&f, &bits, sizeof(f));
+    return f;
+}
+
+static uint16_t float_to_bfloat16(float f)
+{
+    uint32_t bits;
+    memcpy(&bits, &f, sizeof(bits));
+    if ((bits & 0x7fffffff) > 0x7f800000) {  // NaN, keep it quiet
+        return (uint16_t)((bits >> 16) | 0x40);
+    }
+    bits += 0x7fff + ((bits >> 16) & 1);
+    return (uint16_t)(bits >> 16);
+}
+
+void bfloat16_transform(void *pz, const void *px, const void *py, int len,
+                        KungFu_Op op)
+{
+    uint16_t *z       = (uint16_t *)pz;
+    const uint16_t *x = (const uint16_t *)px;
+    const uint16_t *y = (const uint16_t *)py;
+
+    for (int i = 0; i < len; ++i) {
+        const float a = bfloat16_to_float(x[i]);
+        const float b = bfloat16_to_float(y[i]);
+        float c;
+        switch (op) {
+        case KungFu_SUM:
+            c = a + b;
+            break;
+        case KungFu_MIN:
+            c = a < b ? a : b;
+            break;
+        case KungFu_MAX:
+            c = a > b ? a : b;
+            break;
+        case KungFu_PROD:
+            c = a * b;
+            break;
+        default:
+            fprintf(stderr, "unsupported op for bf16: %d\n", (int)(op));
+            exit(1);
+        }
+        z[i] = float_to_bfloat16(c);
+    }
+}
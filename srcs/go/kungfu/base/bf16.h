@@ -0,0 +1,13 @@
+#pragma once
+#include "kungfu/op.h"
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+extern void bfloat16_transform(void *z, const void *x, const void *y, int len,
+                               KungFu_Op op);
+
+#ifdef __cplusplus
+}
+#endif
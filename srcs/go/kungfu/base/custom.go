@@ -0,0 +1,106 @@
+package base
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ReduceFunc reduces x and y into z element-wise, z may be x or y.
+// It must be associative and commutative as the built-in ops, since contributions are reduced in any order along the graphs of strategies.
+type ReduceFunc func(z, x, y *Vector)
+
+// AggregateFunc aggregates the contributions of all peers into z element-wise, ordered by rank.
+// It needs not be associative, e.g. median and trimmed mean, since all contributions are gathered by every peer, which costs n times of the traffic of a reduction.
+type AggregateFunc func(z *Vector, xs []*Vector)
+
+// FirstCustomOP is the OP of the first registered custom reduction, after those of the built-in kernels
+const FirstCustomOP OP = 64
+
+type customOP struct {
+	name      string
+	reduce    ReduceFunc
+	aggregate AggregateFunc
+}
+
+var (
+	customMu  sync.RWMutex
+	customOPs = make(map[OP]customOP)
+
+	errDuplicatedOP = errors.New("duplicated op name")
+)
+
+// RegisterReduce registers a custom reduction invoked by the reduce kernels.
+// Custom reductions must be registered in the same order on all peers, since their OPs are assigned in order.
+func RegisterReduce(name string, f ReduceFunc) (OP, error) {
+	return registerOP(customOP{name: name, reduce: f})
+}
+
+// RegisterAggregate registers a custom aggregation, which AllReduce runs by gathering the contributions of all peers.
+// Custom aggregations must be registered in the same order on all peers, since their OPs are assigned in order.
+func RegisterAggregate(name string, f AggregateFunc) (OP, error) {
+	return registerOP(customOP{name: name, aggregate: f})
+}
+
+func registerOP(c customOP) (OP, error) {
+	customMu.Lock()
+	defer customMu.Unlock()
+	if _, ok := ParseOP(c.name); ok {
+		return 0, fmt.Errorf("%v: %s", errDuplicatedOP, c.name)
+	}
+	for _, d := range customOPs {
+		if d.name == c.name {
+			return 0, fmt.Errorf("%v: %s", errDuplicatedOP, c.name)
+		}
+	}
+	op := FirstCustomOP + OP(len(customOPs))
+	customOPs[op] = c
+	return op, nil
+}
+
+func lookupCustomOP(op OP) (customOP, bool) {
+	customMu.RLock()
+	defer customMu.RUnlock()
+	c, ok := customOPs[op]
+	return c, ok
+}
+
+// LookupOP returns the OP of a built-in or registered reduction by name
+func LookupOP(name string) (OP, bool) {
+	if op, ok := ParseOP(name); ok {
+		return op, true
+	}
+	customMu.RLock()
+	defer customMu.RUnlock()
+	for op, c := range customOPs {
+		if c.name == name {
+			return op, true
+		}
+	}
+	return 0, false
+}
+
+// ParseOP returns the OP of a built-in reduction by name
+func ParseOP(name string) (OP, bool) {
+	for op, s := range opNames {
+		if s == name {
+			return op, true
+		}
+	}
+	return 0, false
+}
+
+// IsAggregate reports whether op is a registered custom aggregation
+func (op OP) IsAggregate() bool {
+	c, ok := lookupCustomOP(op)
+	return ok && c.aggregate != nil
+}
+
+// Aggregate runs the custom aggregation op on the contributions xs into z
+func Aggregate(z *Vector, xs []*Vector, op OP) {
+	c, ok := lookupCustomOP(op)
+	if !ok || c.aggregate == nil {
+		panic(fmt.Sprintf("%s is not an aggregation", op))
+	}
+	c.aggregate(z, xs)
+}
@@ -0,0 +1,73 @@
+package base
+
+import (
+	"sort"
+	"testing"
+)
+
+func Test_CustomOP(t *testing.T) {
+	absMax, err := RegisterReduce("test-abs-max", func(z, x, y *Vector) {
+		zs, xs, ys := z.AsI32(), x.AsI32(), y.AsI32()
+		for i := range zs {
+			a, b := xs[i], ys[i]
+			if a < 0 {
+				a = -a
+			}
+			if b < 0 {
+				b = -b
+			}
+			if a < b {
+				a = b
+			}
+			zs[i] = a
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	median, err := RegisterAggregate("test-median", func(z *Vector, xs []*Vector) {
+		for i := range z.AsF32() {
+			var vs []float32
+			for _, x := range xs {
+				vs = append(vs, x.AsF32()[i])
+			}
+			sort.Slice(vs, func(i, j int) bool { return vs[i] < vs[j] })
+			z.AsF32()[i] = vs[len(vs)/2]
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RegisterReduce("test-median", nil); err == nil {
+		t.Errorf("duplicated name is registered")
+	}
+	if _, err := RegisterReduce("sum", nil); err == nil {
+		t.Errorf("built-in name is registered")
+	}
+	if absMax < FirstCustomOP || median != absMax+1 {
+		t.Errorf("unexpected ops %d, %d", absMax, median)
+	}
+	if op, ok := LookupOP("test-abs-max"); !ok || op != absMax || op.String() != "test-abs-max" {
+		t.Errorf("LookupOP(test-abs-max) = %d, %v", op, ok)
+	}
+	if op, ok := LookupOP("max"); !ok || op != MAX {
+		t.Errorf("LookupOP(max) = %d, %v", op, ok)
+	}
+	if !absMax.Supports(I32) || absMax.IsAggregate() || median.Supports(F32) || !median.IsAggregate() {
+		t.Errorf("unexpected kinds of custom ops")
+	}
+
+	x, y := NewVector(2, I32), NewVector(2, I32)
+	copy(x.AsI32(), []int32{-3, 1})
+	copy(y.AsI32(), []int32{2, -5})
+	Transform(y, x, absMax)
+	if got := y.AsI32(); got[0] != 3 || got[1] != 5 {
+		t.Errorf("Transform(abs-max) = %v", got)
+	}
+
+	z := NewVector(1, F32)
+	Aggregate(z, []*Vector{VectorF32([]float32{1}), VectorF32([]float32{100}), VectorF32([]float32{2})}, median)
+	if got := z.AsF32()[0]; got != 2 {
+		t.Errorf("Aggregate(median) = %v", got)
+	}
+}
@@ -26,6 +26,8 @@ uint32_t kungfu_type_size(KungFu_Datatype dt)
         CASE(KungFu_DOUBLE, double);
 
         CASE(KungFu_BOOL, char);
+
+        CASE(KungFu_BFLOAT16, uint16_t);  //
     default:
         fprintf(stderr, "unknown dtype: %d\n", (int)(dt));
         exit(1);
@@ -1,5 +1,7 @@
 package base
 
+import "fmt"
+
 // #include "kungfu/dtype.h"
 import "C"
 
@@ -19,6 +21,10 @@ const (
 	F16 DataType = C.KungFu_FLOAT16
 	F32 DataType = C.KungFu_FLOAT
 	F64 DataType = C.KungFu_DOUBLE
+
+	BF16 DataType = C.KungFu_BFLOAT16
+
+	Bool DataType = C.KungFu_BOOL
 )
 
 func (t DataType) Size() int {
@@ -39,8 +45,31 @@ var dtypeNames = map[DataType]string{
 	F16: "f16",
 	F32: "f32",
 	F64: "f64",
+
+	BF16: "bf16",
+
+	Bool: "bool",
 }
 
 func (t DataType) String() string {
 	return dtypeNames[t]
 }
+
+// ParseDataType returns the DataType named s, as printed by String.
+func ParseDataType(s string) (DataType, error) {
+	for t, name := range dtypeNames {
+		if name == s {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown dtype: %q", s)
+}
+
+// IsFloat reports whether t is a floating point type.
+func (t DataType) IsFloat() bool {
+	switch t {
+	case F16, BF16, F32, F64:
+		return true
+	}
+	return false
+}
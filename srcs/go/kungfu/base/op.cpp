@@ -3,6 +3,7 @@
 #include <cstdint>
 #include <functional>
 
+#include "bf16.h"
 #include "f16.h"
 #include "kungfu/op.h"
 
@@ -37,6 +38,12 @@ struct workspace {
         case KungFu_PROD:
             std::transform(x, x + n, y, z, std::multiplies<T>());
             break;
+        case KungFu_LAND:
+            std::transform(x, x + n, y, z, std::logical_and<T>());
+            break;
+        case KungFu_LOR:
+            std::transform(x, x + n, y, z, std::logical_or<T>());
+            break;
         default:
             exit(1);
         }
@@ -85,6 +92,12 @@ void std_transform_2(const void *input1, const void *input2, void *output,
 
         CASE(KungFu_FLOAT, float);
         CASE(KungFu_DOUBLE, double);
+
+        CASE(KungFu_BOOL, bool);
+
+    case KungFu_BFLOAT16:
+        bfloat16_transform(output, input1, input2, n, o);
+        break;
     default:
         exit(1);
     };
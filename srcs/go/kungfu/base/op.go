@@ -13,8 +13,48 @@ const (
 	MIN  OP = C.KungFu_MIN
 	MAX  OP = C.KungFu_MAX
 	PROD OP = C.KungFu_PROD
+	LAND OP = C.KungFu_LAND
+	LOR  OP = C.KungFu_LOR
 )
 
+var opNames = map[OP]string{
+	SUM:  "sum",
+	MIN:  "min",
+	MAX:  "max",
+	PROD: "prod",
+	LAND: "land",
+	LOR:  "lor",
+}
+
+func (op OP) String() string {
+	if c, ok := lookupCustomOP(op); ok {
+		return c.name
+	}
+	return opNames[op]
+}
+
+// Supports reports whether op has a reduction kernel for dtype t.
+// f16 can only be summed, and the logical ops are not defined on floats.
+// Custom reductions are given all types, while custom aggregations are not reductions.
+func (op OP) Supports(t DataType) bool {
+	if _, ok := dtypeNames[t]; !ok {
+		return false
+	}
+	if c, ok := lookupCustomOP(op); ok {
+		return c.reduce != nil
+	}
+	if _, ok := opNames[op]; !ok {
+		return false
+	}
+	switch {
+	case t == F16:
+		return op == SUM
+	case t.IsFloat():
+		return op != LAND && op != LOR
+	}
+	return true
+}
+
 // Transform performs y[i] += x[i] for vectors y and x
 func Transform(y, x *Vector, op OP) {
 	// Assuming Count and Type are consistent
@@ -23,6 +63,12 @@ func Transform(y, x *Vector, op OP) {
 
 // Transform2 performs z[i] = x[i] + y[i] for vectors z and x, y.
 func Transform2(z, x, y *Vector, op OP) {
+	if op >= FirstCustomOP {
+		if c, ok := lookupCustomOP(op); ok && c.reduce != nil {
+			c.reduce(z, x, y)
+			return
+		}
+	}
 	// Assuming Count and Type are consistent
 	C.std_transform_2(
 		// ptr(x.Data), // panic when x.Data is returned from bytes.Buffer
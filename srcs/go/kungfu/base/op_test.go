@@ -0,0 +1,91 @@
+package base
+
+import "testing"
+
+func Test_BF16(t *testing.T) {
+	const (
+		one      = 0x3f80 // 1
+		oneUlp   = 0x3f81 // 1 + 2^-7
+		twoUlps  = 0x3f82 // 1 + 2^-6
+		halfUlp  = 0x3b80 // 2^-8
+		aboveUlp = 0x3bc0 // 2^-8 + 2^-9
+		qNaN     = 0x7fc0
+		sNaN     = 0x7f81
+		inf      = 0x7f80
+		negInf   = 0xff80
+	)
+	x, y, z := NewVector(6, BF16), NewVector(6, BF16), NewVector(6, BF16)
+	copy(x.AsHalf(), []uint16{one, oneUlp, one, qNaN, sNaN, inf})
+	copy(y.AsHalf(), []uint16{halfUlp, halfUlp, aboveUlp, one, one, negInf})
+	Transform2(z, x, y, SUM)
+	got := z.AsHalf()
+	// ties are rounded to the even mantissa
+	if got[0] != one || got[1] != twoUlps || got[2] != oneUlp {
+		t.Errorf("SUM(bf16) = %04x, want rounded to nearest even", got[:3])
+	}
+	for _, b := range got[3:] {
+		if b&0x7f80 != 0x7f80 || b&0x7f == 0 {
+			t.Errorf("SUM(bf16) = %04x, want NaN", b)
+		}
+	}
+
+	copy(x.AsHalf(), []uint16{0x4000, 0xc000, 0x3f80, 0x4040, 0x0000, 0x0000}) // 2, -2, 1, 3, 0, 0
+	copy(y.AsHalf(), []uint16{0x3f80, 0x3f80, 0x4000, 0x4000, 0x8000, 0x8000}) // 1, 1, 2, 2, -0, -0
+	Transform2(z, x, y, MAX)
+	if got := z.AsHalf(); got[0] != 0x4000 || got[1] != 0x3f80 || got[2] != 0x4000 || got[3] != 0x4040 {
+		t.Errorf("MAX(bf16) = %04x", got)
+	}
+	Transform2(z, x, y, PROD)
+	if got := z.AsHalf(); got[0] != 0x4000 || got[1] != 0xc000 || got[2] != 0x4000 || got[3] != 0x40c0 {
+		t.Errorf("PROD(bf16) = %04x", got)
+	}
+}
+
+func Test_LogicalOPs(t *testing.T) {
+	x, y, z := NewVector(4, Bool), NewVector(4, Bool), NewVector(4, Bool)
+	copy(x.AsU8(), []byte{1, 1, 0, 0})
+	copy(y.AsU8(), []byte{1, 0, 1, 0})
+	Transform2(z, x, y, LAND)
+	if got := z.AsU8(); got[0] != 1 || got[1] != 0 || got[2] != 0 || got[3] != 0 {
+		t.Errorf("LAND(bool) = %v", got)
+	}
+	Transform2(z, x, y, LOR)
+	if got := z.AsU8(); got[0] != 1 || got[1] != 1 || got[2] != 1 || got[3] != 0 {
+		t.Errorf("LOR(bool) = %v", got)
+	}
+	Transform(y, x, LAND)
+	if got := y.AsU8(); got[0] != 1 || got[1] != 0 || got[2] != 0 || got[3] != 0 {
+		t.Errorf("Transform(LAND) = %v", got)
+	}
+}
+
+func Test_Supports(t *testing.T) {
+	for _, c := range []struct {
+		op   OP
+		t    DataType
+		want bool
+	}{
+		{SUM, F16, true},
+		{MIN, F16, false},
+		{MAX, F16, false},
+		{PROD, F16, false},
+		{LAND, F16, false},
+		{SUM, BF16, true},
+		{MIN, BF16, true},
+		{PROD, BF16, true},
+		{LAND, BF16, false},
+		{LOR, BF16, false},
+		{LOR, F32, false},
+		{LAND, F64, false},
+		{LAND, Bool, true},
+		{LOR, Bool, true},
+		{LOR, I32, true},
+		{MAX, I64, true},
+		{FirstCustomOP + 1000, I32, false},
+		{SUM, DataType(255), false},
+	} {
+		if got := c.op.Supports(c.t); got != c.want {
+			t.Errorf("%s.Supports(%s) = %v, want %v", c.op, c.t, got, c.want)
+		}
+	}
+}
@@ -16,6 +16,7 @@ const (
 	BinaryTree          Strategy = C.KungFu_BinaryTree
 	BinaryTreeStar      Strategy = C.KungFu_BinaryTreeStar
 	MultiBinaryTreeStar Strategy = C.KungFu_MultiBinaryTreeStar
+	DoubleBinaryTree    Strategy = C.KungFu_DoubleBinaryTree
 	Auto                Strategy = C.KungFu_AUTO
 )
 
@@ -31,6 +32,7 @@ var (
 		BinaryTree:          `BINARY_TREE`,
 		BinaryTreeStar:      `BINARY_TREE_STAR`,
 		MultiBinaryTreeStar: `MULTI_BINARY_TREE_STAR`,
+		DoubleBinaryTree:    `DOUBLE_BINARY_TREE`,
 		Auto:                `AUTO`,
 	}
 )
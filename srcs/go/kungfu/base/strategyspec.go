@@ -0,0 +1,158 @@
+package base
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Names of strategy options
+const (
+	ChunkOption  = `chunk`  // RING
+	FanoutOption = `fanout` // TREE
+	WindowOption = `window` // CLIQUE
+)
+
+// StrategyOptions tune the strategy they are given with, as NAME?key=value&key=value, e.g. RING?chunk=4MB
+type StrategyOptions struct {
+	Chunk  int // bytes of each part of an allreduce, parts are reduced concurrently, 0 for the default
+	Fanout int // hosts each host master broadcasts to, 0 for the first master to broadcast to all others
+	Window int // parts of an allreduce in flight at a time, 0 for all parts
+}
+
+var strategyOptionNames = map[Strategy][]string{
+	Ring:   {ChunkOption},
+	Tree:   {FanoutOption},
+	Clique: {WindowOption},
+}
+
+var (
+	errUnknownStrategyOption = errors.New("unknown strategy option")
+	errInvalidStrategyOption = errors.New("invalid strategy option")
+)
+
+// ParseStrategySpec parses a strategy name, case insensitive, followed by the options of the strategy
+func ParseStrategySpec(spec string) (*Strategy, *StrategyOptions, error) {
+	name, query := spec, ""
+	if i := strings.Index(spec, "?"); i >= 0 {
+		name, query = spec[:i], spec[i+1:]
+	}
+	s, err := ParseStrategy(strings.ToUpper(name))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%v: %q", err, name)
+	}
+	var o StrategyOptions
+	if len(query) == 0 {
+		return s, &o, nil
+	}
+	for _, kv := range strings.Split(query, "&") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return nil, nil, fmt.Errorf("%v: %q, expect <key>=<value>", errInvalidStrategyOption, kv)
+		}
+		if err := o.set(*s, parts[0], parts[1]); err != nil {
+			return nil, nil, err
+		}
+	}
+	return s, &o, nil
+}
+
+func (o *StrategyOptions) set(s Strategy, key, val string) error {
+	if !hasOption(s, key) {
+		return fmt.Errorf("%v of %s: %q, options are: %s", errUnknownStrategyOption, s, key, strings.Join(strategyOptionNames[s], " | "))
+	}
+	var n int
+	var err error
+	if key == ChunkOption {
+		n, err = parseSize(val)
+	} else {
+		n, err = strconv.Atoi(val)
+	}
+	if err != nil || n <= 0 {
+		return fmt.Errorf("%v: %s=%s", errInvalidStrategyOption, key, val)
+	}
+	switch key {
+	case ChunkOption:
+		o.Chunk = n
+	case FanoutOption:
+		o.Fanout = n
+	case WindowOption:
+		o.Window = n
+	}
+	return nil
+}
+
+func hasOption(s Strategy, key string) bool {
+	for _, k := range strategyOptionNames[s] {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatStrategySpec formats s and its options as ParseStrategySpec parses them, options of 0 are left out
+func FormatStrategySpec(s Strategy, o StrategyOptions) string {
+	values := map[string]int{
+		ChunkOption:  o.Chunk,
+		FanoutOption: o.Fanout,
+		WindowOption: o.Window,
+	}
+	var kvs []string
+	for k, v := range values {
+		if v > 0 {
+			kvs = append(kvs, k+"="+strconv.Itoa(v))
+		}
+	}
+	if len(kvs) == 0 {
+		return s.String()
+	}
+	sort.Strings(kvs)
+	return s.String() + "?" + strings.Join(kvs, "&")
+}
+
+var sizeUnits = []struct {
+	suffix string
+	n      int
+}{
+	{"GiB", 1 << 30}, {"GB", 1 << 30}, {"Gi", 1 << 30}, {"G", 1 << 30},
+	{"MiB", 1 << 20}, {"MB", 1 << 20}, {"Mi", 1 << 20}, {"M", 1 << 20},
+	{"KiB", 1 << 10}, {"KB", 1 << 10}, {"Ki", 1 << 10}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+// parseSize parses bytes with an optional binary unit, e.g. 4MB or 4Mi
+func parseSize(val string) (int, error) {
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(val, u.suffix) {
+			n, err := strconv.Atoi(strings.TrimSuffix(val, u.suffix))
+			return n * u.n, err
+		}
+	}
+	return strconv.Atoi(val)
+}
+
+// StrategySpec is the value of a -strategy flag, which sets a strategy and its options
+type StrategySpec struct {
+	Strategy *Strategy
+	Options  *StrategyOptions
+}
+
+func (f StrategySpec) String() string {
+	if f.Strategy == nil || f.Options == nil {
+		return ""
+	}
+	return FormatStrategySpec(*f.Strategy, *f.Options)
+}
+
+// Set implements flags.Value::Set
+func (f StrategySpec) Set(val string) error {
+	s, o, err := ParseStrategySpec(val)
+	if err != nil {
+		return err
+	}
+	*f.Strategy, *f.Options = *s, *o
+	return nil
+}
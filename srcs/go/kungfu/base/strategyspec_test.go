@@ -0,0 +1,35 @@
+package base
+
+import "testing"
+
+func Test_ParseStrategySpec(t *testing.T) {
+	tests := []struct {
+		spec string
+		s    Strategy
+		o    StrategyOptions
+		str  string
+	}{
+		{`RING`, Ring, StrategyOptions{}, `RING`},
+		{`ring?chunk=4MB`, Ring, StrategyOptions{Chunk: 4 << 20}, `RING?chunk=4194304`},
+		{`TREE?fanout=2`, Tree, StrategyOptions{Fanout: 2}, `TREE?fanout=2`},
+		{`CLIQUE?window=4`, Clique, StrategyOptions{Window: 4}, `CLIQUE?window=4`},
+	}
+	for _, tt := range tests {
+		s, o, err := ParseStrategySpec(tt.spec)
+		if err != nil {
+			t.Errorf("ParseStrategySpec(%q): %v", tt.spec, err)
+			continue
+		}
+		if *s != tt.s || *o != tt.o {
+			t.Errorf("ParseStrategySpec(%q) = %s, %+v", tt.spec, s, o)
+		}
+		if str := FormatStrategySpec(*s, *o); str != tt.str {
+			t.Errorf("FormatStrategySpec(%s, %+v) = %q, want %q", s, o, str, tt.str)
+		}
+	}
+	for _, spec := range []string{`RINGS`, `RING?fanout=2`, `RING?chunk=0`, `RING?chunk=4XB`, `TREE?fanout`, `STAR?window=2`} {
+		if _, _, err := ParseStrategySpec(spec); err == nil {
+			t.Errorf("ParseStrategySpec(%q) should fail", spec)
+		}
+	}
+}
@@ -71,6 +71,11 @@ func (b *Vector) AsI8() []int8 {
 	return *(*[]int8)(b.sliceHeader())
 }
 
+func (b *Vector) AsI16() []int16 {
+	assert.True(b.Type == I16)
+	return *(*[]int16)(b.sliceHeader())
+}
+
 func (b *Vector) AsI32() []int32 {
 	assert.True(b.Type == I32)
 	return *(*[]int32)(b.sliceHeader())
@@ -80,3 +85,46 @@ func (b *Vector) AsI64() []int64 {
 	assert.True(b.Type == I64)
 	return *(*[]int64)(b.sliceHeader())
 }
+
+func (b *Vector) AsU8() []uint8 {
+	assert.True(b.Type == U8 || b.Type == Bool)
+	return *(*[]uint8)(b.sliceHeader())
+}
+
+func (b *Vector) AsU16() []uint16 {
+	assert.True(b.Type == U16)
+	return *(*[]uint16)(b.sliceHeader())
+}
+
+func (b *Vector) AsU32() []uint32 {
+	assert.True(b.Type == U32)
+	return *(*[]uint32)(b.sliceHeader())
+}
+
+func (b *Vector) AsU64() []uint64 {
+	assert.True(b.Type == U64)
+	return *(*[]uint64)(b.sliceHeader())
+}
+
+// AsHalf returns the bits of the f16 or bf16 elements
+func (b *Vector) AsHalf() []uint16 {
+	assert.True(b.Type == F16 || b.Type == BF16)
+	return *(*[]uint16)(b.sliceHeader())
+}
+
+// VectorF32 returns a Vector sharing the memory of x
+func VectorF32(x []float32) *Vector {
+	if len(x) == 0 {
+		return NewVector(0, F32)
+	}
+	var bs []byte
+	sh := (*reflect.SliceHeader)(unsafe.Pointer(&bs))
+	sh.Data = uintptr(unsafe.Pointer(&x[0]))
+	sh.Len = len(x) * F32.Size()
+	sh.Cap = sh.Len
+	return &Vector{
+		Data:  bs,
+		Count: len(x),
+		Type:  F32,
+	}
+}
@@ -12,6 +12,7 @@ type Workspace struct {
 	RecvBuf *Vector // if RecvBuf == SendBuf, will perform inplace operation
 	OP      OP
 	Name    string
+	Stream  string // chunks of concurrent collectives on different streams are sent in turn
 }
 
 // 0 <= begin < end <= count - 1
@@ -21,6 +22,7 @@ func (w Workspace) slice(begin, end int) Workspace {
 		RecvBuf: w.RecvBuf.Slice(begin, end),
 		OP:      w.OP,
 		Name:    fmt.Sprintf("part::%s[%d:%d]", w.Name, begin, end),
+		Stream:  w.Stream,
 	}
 }
 
@@ -0,0 +1,124 @@
+// Package checksum detects peers drifting apart, e.g. by non-deterministic reductions or corrupted memory,
+// by comparing checksums of the results of allreduce, which must be bitwise identical on all peers.
+package checksum
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+// ReportName is the control message of a Report, sent by a peer to the first runner of its cluster
+const ReportName = "checksum"
+
+// Report is the checksum of the tensors reduced by a peer within Period steps
+type Report struct {
+	Peer    plan.PeerID
+	Version int // of the cluster
+	Step    int // the last step covered, counted from the start of the cluster version
+	Sum     uint64
+	Tensors int
+}
+
+func (r Report) Encode() []byte {
+	b := &bytes.Buffer{}
+	json.NewEncoder(b).Encode(r)
+	return b.Bytes()
+}
+
+func (r *Report) Decode(bs []byte) error {
+	return json.NewDecoder(bytes.NewBuffer(bs)).Decode(r)
+}
+
+// Rolling accumulates the checksum of the tensors reduced by a peer.
+// The sum doesn't depend on the order of the tensors, which is not deterministic with concurrent collectives.
+type Rolling struct {
+	mu      sync.Mutex
+	period  int
+	steps   int
+	sum     uint64
+	tensors int
+}
+
+// New creates a Rolling which reports every period steps
+func New(period int) *Rolling {
+	return &Rolling{period: period}
+}
+
+// Add folds the result of a reduction into the checksum
+func (r *Rolling) Add(name string, data []byte) {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write(data)
+	s := h.Sum64()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sum += s
+	r.tensors++
+}
+
+// Reset restarts the steps and the checksum, when the cluster changes
+func (r *Rolling) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.steps, r.sum, r.tensors = 0, 0, 0
+}
+
+// Step ends a step, it returns the Report of the last period steps at the end of each period
+func (r *Rolling) Step(self plan.PeerID, version int) (Report, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.steps++
+	if r.period <= 0 || r.steps%r.period != 0 {
+		return Report{}, false
+	}
+	rep := Report{Peer: self, Version: version, Step: r.steps, Sum: r.sum, Tensors: r.tensors}
+	r.sum, r.tensors = 0, 0
+	return rep, true
+}
+
+// Drift is a round of Reports which disagree
+type Drift struct {
+	Version  int
+	Step     int
+	Sum      uint64        // of the most peers
+	Diverged plan.PeerList // peers with another sum
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("checksums of %d peers diverged from %016x at step %d of v%d: %s", len(d.Diverged), d.Sum, d.Step, d.Version, d.Diverged)
+}
+
+// Compare returns the Drift of a round of Reports from all peers, if they don't agree
+func Compare(rs []Report) (Drift, bool) {
+	if len(rs) == 0 {
+		return Drift{}, false
+	}
+	counts := make(map[uint64]int)
+	for _, r := range rs {
+		counts[r.Sum]++
+	}
+	if len(counts) == 1 {
+		return Drift{}, false
+	}
+	d := Drift{Version: rs[0].Version, Step: rs[0].Step}
+	best := 0
+	for s, n := range counts {
+		if n > best || (n == best && s < d.Sum) {
+			d.Sum, best = s, n
+		}
+	}
+	for _, r := range rs {
+		if r.Sum != d.Sum {
+			d.Diverged = append(d.Diverged, r.Peer)
+		}
+	}
+	sort.Slice(d.Diverged, func(i, j int) bool { return d.Diverged[i].String() < d.Diverged[j].String() })
+	return d, true
+}
@@ -0,0 +1,49 @@
+package checksum
+
+import (
+	"testing"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+func Test_Rolling(t *testing.T) {
+	a, b := New(2), New(2)
+	a.Add("x", []byte{1, 2, 3})
+	a.Add("y", []byte{4})
+	b.Add("y", []byte{4})
+	b.Add("x", []byte{1, 2, 3})
+	if _, ok := a.Step(plan.PeerID{}, 1); ok {
+		t.Errorf("reported before the end of the period")
+	}
+	b.Step(plan.PeerID{}, 1)
+	ra, ok := a.Step(plan.PeerID{}, 1)
+	rb, _ := b.Step(plan.PeerID{}, 1)
+	if !ok || ra.Step != 2 || ra.Tensors != 2 {
+		t.Fatalf("unexpected report %+v", ra)
+	}
+	if ra.Sum != rb.Sum {
+		t.Errorf("checksum depends on the order of tensors: %x != %x", ra.Sum, rb.Sum)
+	}
+	a.Add("x", []byte{1, 2, 4})
+	a.Step(plan.PeerID{}, 1)
+	if r, _ := a.Step(plan.PeerID{}, 1); r.Sum == ra.Sum || r.Tensors != 1 {
+		t.Errorf("checksum not restarted after a report: %+v", r)
+	}
+	a.Reset()
+	if _, ok := a.Step(plan.PeerID{}, 2); ok {
+		t.Errorf("steps not restarted after reset")
+	}
+}
+
+func Test_Compare(t *testing.T) {
+	p := func(i int) plan.PeerID { return plan.PeerID{IPv4: 1, Port: uint16(10000 + i)} }
+	rs := []Report{{Peer: p(0), Sum: 1}, {Peer: p(1), Sum: 1}, {Peer: p(2), Sum: 1}}
+	if _, ok := Compare(rs); ok {
+		t.Errorf("unexpected drift")
+	}
+	rs[1].Sum = 2
+	d, ok := Compare(rs)
+	if !ok || d.Sum != 1 || len(d.Diverged) != 1 || d.Diverged[0] != p(1) {
+		t.Errorf("unexpected drift %s", d)
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,45 +23,292 @@ var (
 )
 
 const (
+	AdaptiveTimeoutsEnvKey     = `KUNGFU_CONFIG_ADAPTIVE_TIMEOUTS`
+	ByzantineFaultsEnvKey      = `KUNGFU_CONFIG_BYZANTINE_FAULTS`
+	ChecksumPeriodEnvKey       = `KUNGFU_CONFIG_CHECKSUM_PERIOD`
+	CliqueSubdivideEnvKey      = `KUNGFU_CONFIG_CLIQUE_SUBDIVIDE`
+	CompressStagesEnvKey       = `KUNGFU_CONFIG_COMPRESS_STAGES`
+	DatagramAckTimeoutEnvKey   = `KUNGFU_CONFIG_DATAGRAM_ACK_TIMEOUT`
+	DialRateEnvKey             = `KUNGFU_CONFIG_DIAL_RATE`
+	DPClipNormEnvKey           = `KUNGFU_CONFIG_DP_CLIP_NORM`
+	DPDeltaEnvKey              = `KUNGFU_CONFIG_DP_DELTA`
+	DPEpsilonEnvKey            = `KUNGFU_CONFIG_DP_EPSILON`
+	DPPrefixEnvKey             = `KUNGFU_CONFIG_DP_PREFIX`
+	DPTensorsEnvKey            = `KUNGFU_CONFIG_DP_TENSORS`
+	DuplicateConnDrainEnvKey   = `KUNGFU_CONFIG_DUPLICATE_CONN_DRAIN`
+	DuplicateConnPolicyEnvKey  = `KUNGFU_CONFIG_DUPLICATE_CONN_POLICY`
+	EnableDatagramEnvKey       = `KUNGFU_CONFIG_ENABLE_DATAGRAM`
 	EnableMonitoringEnvKey     = `KUNGFU_CONFIG_ENABLE_MONITORING`
 	EnableStallDetectionEnvKey = `KUNGFU_CONFIG_ENABLE_STALL_DETECTION`
+	FeaturesEnvKey             = `KUNGFU_CONFIG_FEATURES`
+	FeaturesFileEnvKey         = `KUNGFU_CONFIG_FEATURES_FILE`
+	ListenShardsEnvKey         = `KUNGFU_CONFIG_LISTEN_SHARDS`
 	LogLevelEnvKey             = `KUNGFU_CONFIG_LOG_LEVEL`
+	LogSinksEnvKey             = `KUNGFU_CONFIG_LOG_SINKS`
 	MonitoringPeriodEnvKey     = `KUNGFU_CONFIG_MONITORING_PERIOD`
+	MultiplexEnvKey            = `KUNGFU_CONFIG_MULTIPLEX`
+	NetemScenarioEnvKey        = `KUNGFU_CONFIG_NETEM_SCENARIO`
+	PerfReportEnvKey           = `KUNGFU_CONFIG_PERF_REPORT`
+	PreferFamilyEnvKey         = `KUNGFU_CONFIG_PREFER_FAMILY`
+	ProxyEnvKey                = `KUNGFU_CONFIG_PROXY`
+	PSCoalesceSizeEnvKey       = `KUNGFU_CONFIG_PS_COALESCE_SIZE`
+	PSCoalesceWindowEnvKey     = `KUNGFU_CONFIG_PS_COALESCE_WINDOW`
+	QueueAgeAlertEnvKey        = `KUNGFU_CONFIG_QUEUE_AGE_ALERT`
+	QueueAlertAfterEnvKey      = `KUNGFU_CONFIG_QUEUE_ALERT_AFTER`
+	QueueDepthAlertEnvKey      = `KUNGFU_CONFIG_QUEUE_DEPTH_ALERT`
+	ReconnectTimeoutEnvKey     = `KUNGFU_CONFIG_RECONNECT_TIMEOUT`
+	RecvSegmentSizeEnvKey      = `KUNGFU_CONFIG_RECV_SEGMENT_SIZE`
+	ReducePluginsEnvKey        = `KUNGFU_CONFIG_REDUCE_PLUGINS`
+	ReplayBufferSizeEnvKey     = `KUNGFU_CONFIG_REPLAY_BUFFER_SIZE`
+	ResizeSLOEnvKey            = `KUNGFU_CONFIG_RESIZE_SLO`
+	ServerRestartsEnvKey       = `KUNGFU_CONFIG_SERVER_RESTARTS`
+	ShareConnectionsEnvKey     = `KUNGFU_CONFIG_SHARE_CONNECTIONS`
+	StageFanoutEnvKey          = `KUNGFU_CONFIG_STAGE_FANOUT`
+	StateKeyEnvKey             = `KUNGFU_CONFIG_STATE_KEY`
+	StateKeyCmdEnvKey          = `KUNGFU_CONFIG_STATE_KEY_CMD`
 	StrategyHashMethodEnvKey   = `KUNGFU_CONFIG_STRATEGY_HASH_METHOD`
+	ThroughputPeriodEnvKey     = `KUNGFU_CONFIG_THROUGHPUT_PERIOD`
 	WaitRunnerTimeoutEnvKey    = `KUNGFU_CONFIG_WAIT_RUNNER_TIMEOUT`
+	WarmUpEnvKey               = `KUNGFU_CONFIG_WARM_UP`
 )
 
 var ConfigEnvKeys = []string{
+	AdaptiveTimeoutsEnvKey,
+	ByzantineFaultsEnvKey,
+	ChecksumPeriodEnvKey,
+	CliqueSubdivideEnvKey,
+	CompressStagesEnvKey,
+	DatagramAckTimeoutEnvKey,
+	DialRateEnvKey,
+	DPClipNormEnvKey,
+	DPDeltaEnvKey,
+	DPEpsilonEnvKey,
+	DPPrefixEnvKey,
+	DPTensorsEnvKey,
+	DuplicateConnDrainEnvKey,
+	DuplicateConnPolicyEnvKey,
+	EnableDatagramEnvKey,
 	EnableMonitoringEnvKey,
+	FeaturesEnvKey,
+	FeaturesFileEnvKey,
+	ListenShardsEnvKey,
 	MonitoringPeriodEnvKey,
 	LogLevelEnvKey,
+	LogSinksEnvKey,
+	MultiplexEnvKey,
+	NetemScenarioEnvKey,
+	PerfReportEnvKey,
+	PreferFamilyEnvKey,
+	ProxyEnvKey,
+	PSCoalesceSizeEnvKey,
+	PSCoalesceWindowEnvKey,
+	QueueAgeAlertEnvKey,
+	QueueAlertAfterEnvKey,
+	QueueDepthAlertEnvKey,
+	ReconnectTimeoutEnvKey,
+	RecvSegmentSizeEnvKey,
+	ReducePluginsEnvKey,
+	ReplayBufferSizeEnvKey,
+	ResizeSLOEnvKey,
+	ServerRestartsEnvKey,
+	ShareConnectionsEnvKey,
+	StageFanoutEnvKey,
+	StateKeyEnvKey,
+	StateKeyCmdEnvKey,
 	StrategyHashMethodEnvKey,
+	ThroughputPeriodEnvKey,
+	WarmUpEnvKey,
 }
 
 var (
+	AdaptiveTimeouts     = true // scale timeouts with the cluster size and measured round trip times, see package timeouts
+	ByzantineFaults      = 0    // faulty contributions tolerated by the robust aggregations, see package robust
+	ChecksumPeriod       = 0    // steps between the comparisons of the checksums of allreduce results across peers in watch mode, 0 to disable
+	CliqueSubdivide      = 16   // the CLIQUE strategy is subdivided by hosts if there are more peers on multiple hosts, see plan.GenHierarchicalClique, 0 to disable
+	CompressStages       = false
+	DatagramAckTimeout   = 5 * time.Millisecond // the least time a datagram is waited to be acknowledged, twice the RTT of its stream if longer
+	DialRate             = 0                    // TCP connections a peer dials per second at most, 0 for unlimited, to avoid SYN floods when large clusters form
+	DPClipNorm           = 1.0                  // L2 norm the contribution of each step is clipped to, with DPEpsilon > 0
+	DPDelta              = 1e-5                 // of the (epsilon, delta) guarantee, with DPEpsilon > 0
+	DPEpsilon            = 0.0                  // adds Gaussian noise to the contributions to float sum reductions named with DPPrefix if > 0, see privacy.Gaussian
+	DPPrefix             = `kungfu::dp::`       // only the reductions whose names start with it are privatized
+	DPTensors            = 1                    // privatized reductions per step, each is clipped to DPClipNorm/sqrt(DPTensors)
+	DuplicateConnDrain   = 5 * time.Second      // how long a replaced connection of a peer is drained before it is closed
+	DuplicateConnPolicy  = `REPLACE`            // what the server does when a peer connects again while connected: REPLACE | REJECT | KEEP
+	EnableDatagram       = false
+	InprocTransport      = false // all peers run in the same process, used by kungfu-run -simulate
 	EnableMonitoring     = false
 	EnableStallDetection = false
+	Features             = `` // comma separated features switched on, or off if prefixed by -, over FeaturesFile, see features.ParseUpdate
+	FeaturesFile         = `` // JSON file of features switched on or off, e.g. {"datagram": true}
+	ListenShards         = 1  // number of SO_REUSEPORT listeners of the TCP server, for hosts with many peers connecting at once
 	LogLevel             = `INFO`
+	LogSinks             = `` // comma separated URLs of log sinks, see log.OpenSink
 	MonitoringPeriod     = 1 * time.Second
+	Multiplex            = false            // connections to the peers of other hosts are relayed by the runners over one connection per pair of hosts, see connection.UseRelay
+	NetemScenario        = ``               // JSON file of simulated network conditions between peers, see connection.Scenario
+	PerfReport           = false            // log the GC and allocation activity of the Go runtime at exit, see perfreport.Report
+	PreferFamily         = 4                // address family dialed first, 4 or 6, when hosts also have public addresses, see connection.SetHostAddrs
+	Proxy                = ``               // comma separated [<IPv4>[:<port>]=]socks5|http://[<user>:<password>@]<host>:<port> to dial peers through, see connection.ProxyRules
+	PSCoalesceSize       = 4 << 20          // pending pushes of a worker are sent once they reach this size in bytes
+	PSCoalesceWindow     = time.Millisecond // pushes of a worker are coalesced for this long before they are sent, 0 to send at once
+	QueueAgeAlert        = 10 * time.Second // alert if the oldest message in a send queue is older, for QueueAlertAfter, 0 to disable
+	QueueAlertAfter      = 30 * time.Second
+	QueueDepthAlert      = 256              // alert if a send queue has more messages, for QueueAlertAfter, 0 to disable
+	ReconnectTimeout     = 10 * time.Second // how long a resumable connection is dialed again after it broke, see features.Resume
+	RecvSegmentSize      = 256 << 10        // larger chunks are reduced by segments while being received, 0 to disable, must be the same on all peers
+	ReducePlugins        = ``               // comma separated Go plugins of custom reductions, loaded in the same order by all peers, see package plugins
+	ReplayBufferSize     = 16 << 20         // bytes kept by the sender of a resumable connection until acknowledged, writes wait if it's full
+	ResizeSLO            = time.Duration(0) // warn if a resize takes longer, from the proposal to the first collective after it
+	ServerRestarts       = 3                // times the listeners of a server are bound again after they died, before the process exits
+	ShareConnections     = false            // always enabled for the CLIQUE strategy
+	StageFanout          = 4                // runners each runner forwards new stages to, over a tree rooted at the first runner, 0 for peers to send stages to all runners
+	StateKey             = ``               // base64 encoded AES key of state files at rest, see sealed.WriteFile
+	StateKeyCmd          = ``               // command printing StateKey, e.g. decrypting a data key by a KMS
 	StrategyHashMethod   = `NAME`
+	ThroughputPeriod     = 0     // steps of the windows the global throughput is measured over by all peers at the same steps, 0 to disable, see package throughput
+	WarmUp               = false // connect all edges of strategies once a session is created, so that the first step is not slowed down
 )
 
 func init() {
+	if val := os.Getenv(AdaptiveTimeoutsEnvKey); len(val) > 0 {
+		AdaptiveTimeouts = isTrue(val)
+	}
+	if val := os.Getenv(ByzantineFaultsEnvKey); len(val) > 0 {
+		ByzantineFaults = parseInt(val)
+	}
+	if val := os.Getenv(ChecksumPeriodEnvKey); len(val) > 0 {
+		ChecksumPeriod = parseInt(val)
+	}
+	if val := os.Getenv(CliqueSubdivideEnvKey); len(val) > 0 {
+		CliqueSubdivide = parseInt(val)
+	}
+	if val := os.Getenv(CompressStagesEnvKey); len(val) > 0 {
+		CompressStages = isTrue(val)
+	}
+	if val := os.Getenv(DialRateEnvKey); len(val) > 0 {
+		DialRate = parseInt(val)
+	}
+	if val := os.Getenv(DPClipNormEnvKey); len(val) > 0 {
+		DPClipNorm = parseFloat(val)
+	}
+	if val := os.Getenv(DPDeltaEnvKey); len(val) > 0 {
+		DPDelta = parseFloat(val)
+	}
+	if val := os.Getenv(DPEpsilonEnvKey); len(val) > 0 {
+		DPEpsilon = parseFloat(val)
+	}
+	if val := os.Getenv(DPPrefixEnvKey); len(val) > 0 {
+		DPPrefix = val
+	}
+	if val := os.Getenv(DPTensorsEnvKey); len(val) > 0 {
+		DPTensors = parseInt(val)
+	}
+	if val := os.Getenv(DuplicateConnDrainEnvKey); len(val) > 0 {
+		DuplicateConnDrain = parseDuration(val)
+	}
+	if val := os.Getenv(DuplicateConnPolicyEnvKey); len(val) > 0 {
+		DuplicateConnPolicy = strings.ToUpper(val)
+	}
+	if val := os.Getenv(DatagramAckTimeoutEnvKey); len(val) > 0 {
+		DatagramAckTimeout = parseDuration(val)
+	}
+	if val := os.Getenv(EnableDatagramEnvKey); len(val) > 0 {
+		EnableDatagram = isTrue(val)
+	}
 	if val := os.Getenv(EnableMonitoringEnvKey); len(val) > 0 {
 		EnableMonitoring = isTrue(val)
 	}
 	if val := os.Getenv(EnableStallDetectionEnvKey); len(val) > 0 {
 		EnableStallDetection = isTrue(val)
 	}
+	if val := os.Getenv(FeaturesEnvKey); len(val) > 0 {
+		Features = val
+	}
+	if val := os.Getenv(FeaturesFileEnvKey); len(val) > 0 {
+		FeaturesFile = val
+	}
 	if val := os.Getenv(MonitoringPeriodEnvKey); len(val) > 0 {
 		MonitoringPeriod = parseDuration(val)
 	}
+	if val := os.Getenv(MultiplexEnvKey); len(val) > 0 {
+		Multiplex = isTrue(val)
+	}
+	if val := os.Getenv(NetemScenarioEnvKey); len(val) > 0 {
+		NetemScenario = val
+	}
+	if val := os.Getenv(PerfReportEnvKey); len(val) > 0 {
+		PerfReport = isTrue(val)
+	}
+	if val := os.Getenv(PreferFamilyEnvKey); len(val) > 0 {
+		PreferFamily = parseInt(val)
+	}
+	if val := os.Getenv(ProxyEnvKey); len(val) > 0 {
+		Proxy = val
+	}
+	if val := os.Getenv(PSCoalesceSizeEnvKey); len(val) > 0 {
+		PSCoalesceSize = parseInt(val)
+	}
+	if val := os.Getenv(PSCoalesceWindowEnvKey); len(val) > 0 {
+		PSCoalesceWindow = parseDuration(val)
+	}
+	if val := os.Getenv(QueueAgeAlertEnvKey); len(val) > 0 {
+		QueueAgeAlert = parseDuration(val)
+	}
+	if val := os.Getenv(QueueAlertAfterEnvKey); len(val) > 0 {
+		QueueAlertAfter = parseDuration(val)
+	}
+	if val := os.Getenv(QueueDepthAlertEnvKey); len(val) > 0 {
+		QueueDepthAlert = parseInt(val)
+	}
+	if val := os.Getenv(ReconnectTimeoutEnvKey); len(val) > 0 {
+		ReconnectTimeout = parseDuration(val)
+	}
+	if val := os.Getenv(RecvSegmentSizeEnvKey); len(val) > 0 {
+		RecvSegmentSize = parseInt(val)
+	}
+	if val := os.Getenv(ReducePluginsEnvKey); len(val) > 0 {
+		ReducePlugins = val
+	}
+	if val := os.Getenv(ReplayBufferSizeEnvKey); len(val) > 0 {
+		ReplayBufferSize = parseInt(val)
+	}
+	if val := os.Getenv(ResizeSLOEnvKey); len(val) > 0 {
+		ResizeSLO = parseDuration(val)
+	}
+	if val := os.Getenv(ServerRestartsEnvKey); len(val) > 0 {
+		ServerRestarts = parseInt(val)
+	}
+	if val := os.Getenv(ShareConnectionsEnvKey); len(val) > 0 {
+		ShareConnections = isTrue(val)
+	}
+	if val := os.Getenv(StageFanoutEnvKey); len(val) > 0 {
+		StageFanout = parseInt(val)
+	}
+	if val := os.Getenv(StateKeyEnvKey); len(val) > 0 {
+		StateKey = val
+	}
+	if val := os.Getenv(StateKeyCmdEnvKey); len(val) > 0 {
+		StateKeyCmd = val
+	}
+	if val := os.Getenv(ListenShardsEnvKey); len(val) > 0 {
+		ListenShards = parseInt(val)
+	}
 	if val := os.Getenv(LogLevelEnvKey); len(val) > 0 {
 		LogLevel = strings.ToUpper(val) // FIXME: check enum value
 	}
+	if val := os.Getenv(LogSinksEnvKey); len(val) > 0 {
+		LogSinks = val
+	}
 	if val := os.Getenv(StrategyHashMethodEnvKey); len(val) > 0 {
 		StrategyHashMethod = strings.ToUpper(val) // FIXME: check enum value
 	}
+	if val := os.Getenv(ThroughputPeriodEnvKey); len(val) > 0 {
+		ThroughputPeriod = parseInt(val)
+	}
+	if val := os.Getenv(WarmUpEnvKey); len(val) > 0 {
+		WarmUp = isTrue(val)
+	}
 	if val := os.Getenv(WaitRunnerTimeoutEnvKey); len(val) > 0 {
 		WaitRunnerTimeout = parseDuration(val)
 	}
@@ -70,6 +318,22 @@ func isTrue(val string) bool {
 	return val == "true"
 }
 
+func parseInt(val string) int {
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		utils.ExitErr(err)
+	}
+	return n
+}
+
+func parseFloat(val string) float64 {
+	x, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		utils.ExitErr(err)
+	}
+	return x
+}
+
 func parseDuration(val string) time.Duration {
 	d, err := time.ParseDuration(val)
 	if err != nil {
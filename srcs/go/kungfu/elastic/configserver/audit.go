@@ -0,0 +1,64 @@
+package configserver
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+// AuditEntry is a decision made by the config server, saved as a line of JSON
+type AuditEntry struct {
+	Time      time.Time
+	Version   int
+	Event     string          // update | reject | evict | place | add-host | drain-host | remove-host
+	From      int             `json:",omitempty"`
+	To        int             `json:",omitempty"`
+	Policy    string          `json:",omitempty"`
+	Evictions []plan.Eviction `json:",omitempty"`
+	Moves     []plan.Move     `json:",omitempty"`
+	Error     string          `json:",omitempty"`
+}
+
+// AuditLog appends decisions to a file, a nil *AuditLog discards them
+type AuditLog struct {
+	sync.Mutex
+	f *os.File
+}
+
+func OpenAuditLog(filename string) (*AuditLog, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{f: f}, nil
+}
+
+func (a *AuditLog) Record(e AuditEntry) {
+	if a == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	bs, err := json.Marshal(e)
+	if err != nil {
+		log.Errorf("failed to encode audit entry: %v", err)
+		return
+	}
+	a.Lock()
+	defer a.Unlock()
+	if _, err := a.f.Write(append(bs, '\n')); err != nil {
+		log.Errorf("failed to write audit log: %v", err)
+	}
+}
+
+func (a *AuditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	return a.f.Close()
+}
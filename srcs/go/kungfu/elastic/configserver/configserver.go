@@ -3,35 +3,78 @@ package configserver
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"net/http"
+	"strconv"
 	"sync"
 
+	"github.com/lsds/KungFu/srcs/go/kungfu/elastic/configsource"
 	"github.com/lsds/KungFu/srcs/go/log"
 	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/client"
 	"github.com/lsds/KungFu/srcs/go/utils"
 )
 
 type ConfigServer struct {
 	sync.RWMutex
+	updating sync.Mutex // serializes updates, which consult the pre-resize hook without holding the lock
+
 	cancel  context.CancelFunc
 	Path    string
 	mux     http.ServeMux
 	cluster *plan.Cluster
 	version int
+
+	preResizeHook Hook
+	audit         *AuditLog
+	pusher        *client.Client
+	hosts         *HostTable
 }
 
-func New(cancel context.CancelFunc, initCluster *plan.Cluster, path string) http.Handler {
+func New(cancel context.CancelFunc, initCluster *plan.Cluster, path string) *ConfigServer {
 	s := &ConfigServer{
 		Path:    path,
 		cluster: initCluster,
 		cancel:  cancel,
+		hosts:   NewHostTable(nil),
 	}
 	s.mux.HandleFunc(s.Path, http.HandlerFunc(s.handleConfig))
+	s.mux.HandleFunc(s.Path+HostsPath, http.HandlerFunc(s.handleHosts))
+	s.mux.HandleFunc(s.Path+HostOpPath, http.HandlerFunc(s.handleHostOp))
 	s.mux.HandleFunc(`/stop`, http.HandlerFunc(s.stop))
 	return s
 }
 
+// SetPreResizeHook sets the hook to be consulted before a new cluster is accepted
+func (s *ConfigServer) SetPreResizeHook(h Hook) {
+	s.Lock()
+	defer s.Unlock()
+	s.preResizeHook = h
+}
+
+// SetAuditLog sets the log to record accepted and rejected updates
+func (s *ConfigServer) SetAuditLog(a *AuditLog) {
+	s.Lock()
+	defer s.Unlock()
+	s.audit = a
+}
+
+// SetHostTable sets the table to keep the resources reported by runners, e.g. shared with a placement hook
+func (s *ConfigServer) SetHostTable(t *HostTable) {
+	s.Lock()
+	defer s.Unlock()
+	s.hosts = t
+}
+
+func (s *ConfigServer) handleHosts(w http.ResponseWriter, req *http.Request) {
+	s.RLock()
+	t := s.hosts
+	s.RUnlock()
+	t.ServeHTTP(w, req)
+}
+
 func (s *ConfigServer) stop(w http.ResponseWriter, req *http.Request) {
 	s.cancel()
 }
@@ -64,11 +107,22 @@ func (s *ConfigServer) getConfig(w http.ResponseWriter, req *http.Request) {
 		fmt.Fprintf(w, "No Config Found.\n")
 		return
 	}
-	e := json.NewEncoder(w)
-	e.SetIndent("", "    ")
-	if err := e.Encode(s.cluster); err != nil {
+	bs, err := json.MarshalIndent(s.cluster, "", "    ")
+	if err != nil {
 		log.Errorf("failed to encode JSON: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h := fnv.New64a()
+	h.Write(bs)
+	etag := fmt.Sprintf(`"%d-%x"`, s.version, h.Sum64())
+	w.Header().Set("ETag", etag)
+	w.Header().Set(configsource.VersionHeader, strconv.Itoa(s.version))
+	if req.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
 	}
+	w.Write(append(bs, '\n'))
 }
 
 func (s *ConfigServer) putConfig(w http.ResponseWriter, req *http.Request) {
@@ -81,22 +135,74 @@ func (s *ConfigServer) putConfig(w http.ResponseWriter, req *http.Request) {
 		log.Errorf("invalid cluster config: %v", err)
 		return
 	}
+	s.updating.Lock()
+	defer s.updating.Unlock()
 	s.Lock()
-	defer s.Unlock()
 	if s.cluster == nil {
 		log.Infof("init first config to %d peers: %s", len(cluster.Workers), cluster)
 		s.version = 1
 		s.cluster = &cluster
+		s.push(nil)
+		s.Unlock()
 	} else if len(s.cluster.Workers) > 0 {
-		s.version++
-		s.cluster = &cluster
-		log.Infof("updated to %d peers: %s", len(cluster.Workers), cluster.Workers)
+		p := Proposal{Version: s.version + 1, Current: s.cluster, Proposed: cluster}
+		s.Unlock()
+		if code, err := s.update(p); err != nil {
+			http.Error(w, err.Error(), code)
+		}
 	} else {
+		s.Unlock()
 		log.Infof("config was cleared, update rejected")
 		w.WriteHeader(http.StatusForbidden)
 	}
 }
 
+var errConfigChanged = errors.New("config changed while the proposal was consulted")
+
+// update accepts the proposal after consulting the pre-resize hook,
+// it must be called with s.updating held but not the lock, which is not held while the hook runs.
+func (s *ConfigServer) update(p Proposal) (int, error) {
+	s.RLock()
+	hook, audit := s.preResizeHook, s.audit
+	s.RUnlock()
+	cluster := p.Proposed
+	if hook != nil {
+		accepted, err := hook(p)
+		if err != nil {
+			log.Warnf("update rejected: %v", err)
+			audit.Record(AuditEntry{
+				Version: p.Version,
+				Event:   "reject",
+				From:    len(p.Current.Workers),
+				To:      len(cluster.Workers),
+				Error:   err.Error(),
+			})
+			return http.StatusForbidden, err
+		}
+		if !accepted.Eq(cluster) {
+			log.Infof("proposal mutated by hook: %s -> %s", cluster.DebugString(), accepted.DebugString())
+		}
+		cluster = *accepted
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.cluster != p.Current {
+		return http.StatusConflict, errConfigChanged
+	}
+	s.audit.Record(AuditEntry{
+		Version: s.version + 1,
+		Event:   "update",
+		From:    len(s.cluster.Workers),
+		To:      len(cluster.Workers),
+	})
+	from := s.cluster
+	s.version++
+	s.cluster = &cluster
+	log.Infof("updated to %d peers: %s", len(cluster.Workers), cluster.Workers)
+	s.push(from)
+	return http.StatusOK, nil
+}
+
 func (s *ConfigServer) resetConfig(w http.ResponseWriter, req *http.Request) {
 	s.Lock()
 	defer s.Unlock()
@@ -0,0 +1,67 @@
+package configserver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+// Probe measures the latency to a worker
+type Probe func(plan.PeerID) (time.Duration, error)
+
+// NewEvictionHook creates a Hook which chooses the workers to remove by policy when a proposal shrinks the cluster.
+// Only proposals truncating the current workers (e.g. from ResizeCluster) are rewritten,
+// proposals removing specific workers (e.g. evicted by lease, or pinned by removing a host) are kept as they are.
+// hosts returns the latest resources of hosts for the load policy.
+func NewEvictionHook(policy plan.EvictionPolicy, hosts func() plan.HostList, probe Probe, audit *AuditLog) Hook {
+	return func(p Proposal) (*plan.Cluster, error) {
+		current := p.Current.Workers
+		n := len(p.Proposed.Workers)
+		if p.Pinned || n == 0 || n >= len(current) || !p.Proposed.Workers.Eq(current[:n]) {
+			return &p.Proposed, nil
+		}
+		var latencies map[plan.PeerID]time.Duration
+		if policy == plan.EvictSlowest && probe != nil {
+			latencies = probeAll(probe, current[1:])
+		}
+		workers, evictions := policy.Evict(current, len(current)-n, hosts(), latencies)
+		for _, e := range evictions {
+			log.Infof("evicting rank %d %s by %s policy: %s", e.Rank, e.Peer, policy, e.Reason)
+		}
+		audit.Record(AuditEntry{
+			Version:   p.Version,
+			Event:     "evict",
+			From:      len(current),
+			To:        n,
+			Policy:    string(policy),
+			Evictions: evictions,
+		})
+		cluster := p.Proposed.Clone()
+		cluster.Workers = workers
+		return &cluster, nil
+	}
+}
+
+func probeAll(probe Probe, pl plan.PeerList) map[plan.PeerID]time.Duration {
+	latencies := make(map[plan.PeerID]time.Duration)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, id := range pl {
+		wg.Add(1)
+		go func(id plan.PeerID) {
+			defer wg.Done()
+			d, err := probe(id)
+			if err != nil {
+				log.Warnf("failed to probe %s: %v", id, err)
+				return
+			}
+			mu.Lock()
+			latencies[id] = d
+			mu.Unlock()
+		}(id)
+	}
+	wg.Wait()
+	return latencies
+}
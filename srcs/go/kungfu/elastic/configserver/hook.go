@@ -0,0 +1,110 @@
+package configserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+const hookTimeout = 10 * time.Second
+
+// Proposal is sent to the pre-resize hook
+type Proposal struct {
+	Version  int
+	Current  *plan.Cluster
+	Proposed plan.Cluster
+	Pinned   bool // the workers to remove are chosen by the proposal, e.g. those on a removed host
+}
+
+// Hook is consulted with a proposal before it is accepted,
+// it returns the (possibly mutated) cluster to accept, or an error to veto the proposal.
+type Hook func(p Proposal) (*plan.Cluster, error)
+
+// NewHook creates a Hook from a HTTP(S) URL or a shell command.
+// The proposal is POSTed to the URL or written to stdin of the command as JSON,
+// an empty response accepts the proposal, otherwise the response is the cluster to accept.
+// A non-2xx status code or a non-zero exit code vetoes the proposal.
+func NewHook(spec string) Hook {
+	if strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://") {
+		return httpHook(spec)
+	}
+	return commandHook(spec)
+}
+
+// Chain creates a Hook which consults hooks in order, each with the proposal accepted by the previous one
+func Chain(hooks ...Hook) Hook {
+	return func(p Proposal) (*plan.Cluster, error) {
+		for _, h := range hooks {
+			c, err := h(p)
+			if err != nil {
+				return nil, err
+			}
+			p.Proposed = *c
+		}
+		return &p.Proposed, nil
+	}
+}
+
+func httpHook(url string) Hook {
+	client := http.Client{Timeout: hookTimeout}
+	return func(p Proposal) (*plan.Cluster, error) {
+		resp, err := client.Post(url, "application/json", encodeProposal(p))
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		bs, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode/100 != 2 {
+			return nil, fmt.Errorf("vetoed by %s: %s %s", url, resp.Status, strings.TrimSpace(string(bs)))
+		}
+		return parseHookResponse(bs, p)
+	}
+}
+
+func commandHook(cmd string) Hook {
+	return func(p Proposal) (*plan.Cluster, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+		defer cancel()
+		c := exec.CommandContext(ctx, "sh", "-c", cmd)
+		c.Stdin = encodeProposal(p)
+		stderr := &bytes.Buffer{}
+		c.Stderr = stderr
+		bs, err := c.Output()
+		if err != nil {
+			return nil, fmt.Errorf("vetoed by %q: %v %s", cmd, err, strings.TrimSpace(stderr.String()))
+		}
+		return parseHookResponse(bs, p)
+	}
+}
+
+func encodeProposal(p Proposal) io.Reader {
+	b := &bytes.Buffer{}
+	json.NewEncoder(b).Encode(p)
+	return b
+}
+
+func parseHookResponse(bs []byte, p Proposal) (*plan.Cluster, error) {
+	if len(bytes.TrimSpace(bs)) == 0 {
+		return &p.Proposed, nil
+	}
+	var cluster plan.Cluster
+	if err := json.Unmarshal(bs, &cluster); err != nil {
+		return nil, fmt.Errorf("invalid hook response: %v", err)
+	}
+	if err := cluster.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid cluster from hook: %v", err)
+	}
+	return &cluster, nil
+}
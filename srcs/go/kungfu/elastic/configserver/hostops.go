@@ -0,0 +1,180 @@
+package configserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/utils"
+)
+
+// HostOpPath is appended to the path of the config server for kungfu-ctl to add, drain and remove hosts, and to migrate ranks
+const HostOpPath = "/host"
+
+// Operations on hosts
+const (
+	AddHost     = "add-host"     // the host is available to the following resizes
+	DrainHost   = "drain-host"   // workers on the host are moved to other hosts
+	RemoveHost  = "remove-host"  // workers on the host are removed
+	MigrateRank = "migrate-rank" // the worker of the rank is replaced by a worker on the host, which takes over its state
+)
+
+// HostOp is an operation on a host of the cluster, which is accepted as the next version
+type HostOp struct {
+	Op         string `json:"op"`
+	Host       string `json:"host"`                  // <internal IP>:<nslots> for add-host, <internal IP> otherwise
+	RunnerPort uint16 `json:"runner_port,omitempty"` // of the runner already started on the added host
+	Rank       int    `json:"rank,omitempty"`        // of the worker moved to the host by migrate-rank
+}
+
+var (
+	errUnknownHostOp = errors.New("unknown host operation")
+	errNoCluster     = errors.New("no cluster to update")
+)
+
+// Add adds the host or updates its slots
+func (t *HostTable) Add(h plan.HostSpec) {
+	t.Lock()
+	defer t.Unlock()
+	for i := range t.hosts {
+		if t.hosts[i].IPv4 == h.IPv4 {
+			t.hosts[i].Slots = h.Slots
+			return
+		}
+	}
+	h.Resources = nil
+	t.hosts = append(t.hosts, h)
+}
+
+func (t *HostTable) Remove(ipv4 uint32) {
+	t.Lock()
+	defer t.Unlock()
+	var hl plan.HostList
+	for _, h := range t.hosts {
+		if h.IPv4 != ipv4 {
+			hl = append(hl, h)
+		}
+	}
+	t.hosts = hl
+}
+
+func (s *ConfigServer) handleHostOp(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
+		return
+	}
+	var op HostOp
+	if err := utils.ReadJSON(req.Body, &op); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hl, err := plan.ParseHostList(op.Host)
+	if err != nil || len(hl) != 1 {
+		http.Error(w, fmt.Sprintf("invalid host: %q", op.Host), http.StatusBadRequest)
+		return
+	}
+	if code, err := s.applyHostOp(op, hl[0]); err != nil {
+		http.Error(w, err.Error(), code)
+	}
+}
+
+func (s *ConfigServer) applyHostOp(op HostOp, h plan.HostSpec) (int, error) {
+	s.updating.Lock()
+	defer s.updating.Unlock()
+	p, code, err := s.proposeHostOp(op, h)
+	if err != nil {
+		return code, err
+	}
+	if code, err := s.update(*p); err != nil {
+		return code, err
+	}
+	s.RLock()
+	t, version := s.hosts, s.version
+	s.RUnlock()
+	switch op.Op {
+	case AddHost:
+		t.Add(h)
+	case DrainHost, RemoveHost:
+		t.Remove(h.IPv4)
+	}
+	log.Infof("%s %s accepted as v%d", op.Op, op.Host, version)
+	return http.StatusOK, nil
+}
+
+// proposeHostOp creates the proposal of the operation on the current cluster
+func (s *ConfigServer) proposeHostOp(op HostOp, h plan.HostSpec) (*Proposal, int, error) {
+	s.RLock()
+	defer s.RUnlock()
+	if s.cluster == nil || len(s.cluster.Workers) == 0 {
+		return nil, http.StatusNotFound, errNoCluster
+	}
+	p := Proposal{Version: s.version + 1, Current: s.cluster}
+	var moves []plan.Move
+	switch op.Op {
+	case AddHost:
+		port := op.RunnerPort
+		if port == 0 {
+			port = plan.DefaultRunnerPort
+		}
+		c, err := s.cluster.AddHost(h.IPv4, port)
+		if err != nil {
+			return nil, http.StatusConflict, err
+		}
+		p.Proposed = *c
+	case DrainHost:
+		c, ms, err := s.cluster.DrainHost(h.IPv4, s.hosts.Live())
+		if err != nil {
+			return nil, http.StatusConflict, err
+		}
+		p.Proposed, moves = *c, ms
+	case RemoveHost:
+		c, err := s.cluster.RemoveHost(h.IPv4)
+		if err != nil {
+			return nil, http.StatusConflict, err
+		}
+		p.Proposed, p.Pinned = *c, true
+	case MigrateRank:
+		c, err := s.cluster.Migrate(op.Rank, h.IPv4)
+		if err != nil {
+			return nil, http.StatusConflict, err
+		}
+		p.Proposed = *c
+		moves = []plan.Move{{From: s.cluster.Workers[op.Rank], To: c.Workers[op.Rank], Reason: fmt.Sprintf("rank %d migrated", op.Rank)}}
+	default:
+		return nil, http.StatusBadRequest, fmt.Errorf("%v: %q", errUnknownHostOp, op.Op)
+	}
+	for _, m := range moves {
+		log.Infof("moving worker %s to %s: %s", m.From, m.To, m.Reason)
+	}
+	s.audit.Record(AuditEntry{
+		Version: p.Version,
+		Event:   op.Op,
+		From:    len(p.Current.Workers),
+		To:      len(p.Proposed.Workers),
+		Moves:   moves,
+	})
+	return &p, http.StatusOK, nil
+}
+
+// PostHostOp sends the operation to the config server at url
+func PostHostOp(client *http.Client, url string, op HostOp) error {
+	bs, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(url+HostOpPath, "application/json", bytes.NewReader(bs))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package configserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/utils"
+)
+
+// HostsPath is appended to the path of the config server for runners to report free resources of their hosts
+const HostsPath = "/hosts"
+
+// HostReport is sent by a runner every -telemetry-period
+type HostReport struct {
+	Host      string             `json:"host"`
+	Resources plan.HostResources `json:"resources"`
+}
+
+// HostTable keeps the latest resources reported by runners
+type HostTable struct {
+	sync.Mutex
+	hosts plan.HostList
+}
+
+// NewHostTable creates a table of the given hosts, hosts not in it are added when they report
+func NewHostTable(hl plan.HostList) *HostTable {
+	t := &HostTable{}
+	for _, h := range hl {
+		h.Resources = nil
+		t.hosts = append(t.hosts, h)
+	}
+	return t
+}
+
+func (t *HostTable) Report(ipv4 uint32, r plan.HostResources) {
+	t.Lock()
+	defer t.Unlock()
+	for i := range t.hosts {
+		if t.hosts[i].IPv4 == ipv4 {
+			t.hosts[i].Resources = &r
+			return
+		}
+	}
+	// slots of unknown hosts are unknown, so no peer will be moved there
+	t.hosts = append(t.hosts, plan.HostSpec{IPv4: ipv4, PublicAddr: plan.FormatIPv4(ipv4), Resources: &r})
+}
+
+// Live returns the hosts with the latest resources
+func (t *HostTable) Live() plan.HostList {
+	t.Lock()
+	defer t.Unlock()
+	hl := make(plan.HostList, len(t.hosts))
+	copy(hl, t.hosts)
+	return hl
+}
+
+func (t *HostTable) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		var reports []HostReport
+		for _, h := range t.Live() {
+			if r, ok := h.Fresh(); ok {
+				reports = append(reports, HostReport{Host: plan.FormatIPv4(h.IPv4), Resources: *r})
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reports)
+	case http.MethodPut, http.MethodPost:
+		var r HostReport
+		if err := utils.ReadJSON(req.Body, &r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ipv4, err := plan.ParseIPv4(r.Host)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v: %q", err, r.Host), http.StatusBadRequest)
+			return
+		}
+		t.Report(ipv4, r.Resources)
+	default:
+		http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
+	}
+}
+
+// NewPlacementHook creates a Hook which moves workers added by a proposal away from hosts saturated by other jobs,
+// according to the latest resources of hosts.
+func NewPlacementHook(hosts func() plan.HostList, audit *AuditLog) Hook {
+	return func(p Proposal) (*plan.Cluster, error) {
+		var current plan.PeerList
+		if p.Current != nil {
+			current = p.Current.Workers
+		}
+		c, moves := p.Proposed.AvoidSaturated(current, hosts())
+		for _, m := range moves {
+			log.Infof("placing new worker %s on %s instead: %s", m.From, m.To, m.Reason)
+		}
+		if len(moves) > 0 {
+			audit.Record(AuditEntry{
+				Version: p.Version,
+				Event:   "place",
+				From:    len(current),
+				To:      len(c.Workers),
+				Moves:   moves,
+			})
+		}
+		return c, nil
+	}
+}
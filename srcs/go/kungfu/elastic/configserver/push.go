@@ -0,0 +1,34 @@
+package configserver
+
+import (
+	"github.com/lsds/KungFu/srcs/go/kungfu/elastic/configsource"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/client"
+)
+
+// EnablePush pushes every accepted cluster to the runners of the previous and the new cluster,
+// so that runners watching this server apply it without waiting for their next poll.
+func (s *ConfigServer) EnablePush() {
+	s.Lock()
+	defer s.Unlock()
+	s.pusher = client.New(plan.PeerID{}, false)
+}
+
+// push must be called with the lock held
+func (s *ConfigServer) push(from *plan.Cluster) {
+	if s.pusher == nil || s.cluster == nil {
+		return
+	}
+	runners := s.cluster.Runners
+	if from != nil {
+		removed, _ := from.Runners.Diff(s.cluster.Runners)
+		runners = append(removed, runners...)
+	}
+	c := configsource.Config{Version: s.version, Cluster: s.cluster.Clone()}
+	go func() {
+		if err := configsource.Push(s.pusher, runners, c); err != nil {
+			log.Warnf("failed to push v%d: %v", c.Version, err)
+		}
+	}()
+}
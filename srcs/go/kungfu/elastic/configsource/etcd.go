@@ -0,0 +1,192 @@
+package configsource
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/log"
+)
+
+var errEmptyKey = errors.New("etcd key is empty")
+
+// etcdSource watches a key through the JSON gateway of etcd v3,
+// the mod revision of the key is used as the cluster version unless the value carries one.
+type etcdSource struct {
+	endpoint string
+	key      string
+	period   time.Duration // backoff before reconnecting
+	client   http.Client
+}
+
+func newEtcdSource(scheme string, u *url.URL, period time.Duration) (*etcdSource, error) {
+	key := strings.TrimPrefix(u.Path, "/")
+	if len(key) == 0 {
+		return nil, errEmptyKey
+	}
+	return &etcdSource{
+		endpoint: scheme + "://" + u.Host,
+		key:      key,
+		period:   period,
+	}, nil
+}
+
+// int64 fields are encoded as strings by the gateway
+type etcdInt int64
+
+func (i *etcdInt) UnmarshalJSON(bs []byte) error {
+	n, err := strconv.ParseInt(strings.Trim(string(bs), `"`), 10, 64)
+	*i = etcdInt(n)
+	return err
+}
+
+type etcdKV struct {
+	Key         string  `json:"key"`
+	Value       string  `json:"value"`
+	ModRevision etcdInt `json:"mod_revision"`
+}
+
+type etcdHeader struct {
+	Revision etcdInt `json:"revision"`
+}
+
+type etcdRangeResponse struct {
+	Header etcdHeader `json:"header"`
+	KVs    []etcdKV   `json:"kvs"`
+}
+
+type etcdWatchResponse struct {
+	Result struct {
+		Header   etcdHeader `json:"header"`
+		Canceled bool       `json:"canceled"`
+		Events   []struct {
+			Type string `json:"type"`
+			KV   etcdKV `json:"kv"`
+		} `json:"events"`
+	} `json:"result"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (s *etcdSource) Watch(ctx context.Context, f func(Config)) error {
+	var rev int64 // the last revision seen
+	for {
+		if rev == 0 {
+			if r, err := s.get(ctx, f); err != nil {
+				log.Warnf("failed to get %s from etcd %s: %v", s.key, s.endpoint, err)
+			} else {
+				rev = r
+			}
+		}
+		if rev > 0 {
+			if err := s.watch(ctx, &rev, f); err != nil && ctx.Err() == nil {
+				log.Warnf("watch of %s on etcd %s broken: %v", s.key, s.endpoint, err)
+			}
+		}
+		if !sleep(ctx, s.period) {
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *etcdSource) post(ctx context.Context, path string, body interface{}) (*http.Response, error) {
+	buf := &bytes.Buffer{}
+	if err := json.NewEncoder(buf).Encode(body); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.endpoint+path, buf)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// get delivers the current value of the key, and returns the revision of the store
+func (s *etcdSource) get(ctx context.Context, f func(Config)) (int64, error) {
+	resp, err := s.post(ctx, "/v3/kv/range", map[string]string{
+		"key": base64.StdEncoding.EncodeToString([]byte(s.key)),
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	var r etcdRangeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return 0, err
+	}
+	for _, kv := range r.KVs {
+		s.deliver(kv, f)
+	}
+	return int64(r.Header.Revision), nil
+}
+
+// watch streams changes of the key after *rev, *rev is advanced as events arrive
+func (s *etcdSource) watch(ctx context.Context, rev *int64, f func(Config)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	resp, err := s.post(ctx, "/v3/watch", map[string]interface{}{
+		"create_request": map[string]string{
+			"key":            base64.StdEncoding.EncodeToString([]byte(s.key)),
+			"start_revision": strconv.FormatInt(*rev+1, 10),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	d := json.NewDecoder(resp.Body)
+	for {
+		var w etcdWatchResponse
+		if err := d.Decode(&w); err != nil {
+			return err
+		}
+		if w.Error != nil {
+			return errors.New(w.Error.Message)
+		}
+		if w.Result.Canceled {
+			*rev = 0 // e.g. compacted, start over from the current value
+			return errors.New("watch canceled")
+		}
+		for _, e := range w.Result.Events {
+			if e.Type == "DELETE" {
+				log.Warnf("%s deleted from etcd, keeping the current cluster", s.key)
+			} else {
+				s.deliver(e.KV, f)
+			}
+			*rev = int64(e.KV.ModRevision)
+		}
+	}
+}
+
+func (s *etcdSource) deliver(kv etcdKV, f func(Config)) {
+	bs, err := base64.StdEncoding.DecodeString(kv.Value)
+	if err != nil {
+		log.Warnf("invalid value of %s: %v", s.key, err)
+		return
+	}
+	c, err := decodeConfig(bs, strconv.FormatInt(int64(kv.ModRevision), 10))
+	if err != nil {
+		log.Warnf("invalid config in %s: %v", s.key, err)
+		return
+	}
+	f(*c)
+}
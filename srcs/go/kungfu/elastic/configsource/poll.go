@@ -0,0 +1,101 @@
+package configsource
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/log"
+)
+
+type fileSource struct {
+	path   string
+	period time.Duration
+}
+
+func (s *fileSource) Watch(ctx context.Context, f func(Config)) error {
+	var last time.Time
+	for {
+		if info, err := os.Stat(s.path); err != nil {
+			log.Warnf("failed to stat %s: %v", s.path, err)
+		} else if mt := info.ModTime(); !mt.Equal(last) {
+			if c, err := s.read(); err != nil {
+				log.Warnf("failed to read config from %s: %v", s.path, err)
+			} else {
+				last = mt
+				f(*c)
+			}
+		}
+		if !sleep(ctx, s.period) {
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *fileSource) read() (*Config, error) {
+	bs, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	return decodeConfig(bs, "")
+}
+
+// httpSource polls the URL with the ETag of the last response, so that unchanged configs are not transferred
+type httpSource struct {
+	url    string
+	period time.Duration
+	client http.Client
+	etag   string
+}
+
+func (s *httpSource) Watch(ctx context.Context, f func(Config)) error {
+	s.client.Timeout = s.period + 10*time.Second
+	for {
+		if c, err := s.poll(ctx); err != nil {
+			log.Warnf("failed to poll config from %s: %v", s.url, err)
+		} else if c != nil {
+			f(*c)
+		}
+		if !sleep(ctx, s.period) {
+			return ctx.Err()
+		}
+	}
+}
+
+// poll returns nil if the config is not modified since the last poll
+func (s *httpSource) poll(ctx context.Context) (*Config, error) {
+	req, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", "KungFu Config Source")
+	if len(s.etag) > 0 {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	bs, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	c, err := decodeConfig(bs, resp.Header.Get(VersionHeader))
+	if err != nil {
+		return nil, err
+	}
+	s.etag = resp.Header.Get("ETag")
+	return c, nil
+}
@@ -0,0 +1,47 @@
+package configsource
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/execution"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/client"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+)
+
+// PushName is the name of control messages which push a Config to runners in watch mode,
+// so that they don't have to wait for the next poll of their source.
+const PushName = "config"
+
+func (c Config) Encode() []byte {
+	bs, _ := json.Marshal(c)
+	return bs
+}
+
+// Decode decodes a Config pushed to runners, which must carry its version
+func (c *Config) Decode(bs []byte) error {
+	d, err := decodeConfig(bs, "")
+	if err != nil {
+		return err
+	}
+	*c = *d
+	return nil
+}
+
+// Push sends the Config to the runners in parallel
+func Push(c *client.Client, runners plan.PeerList, cfg Config) error {
+	bs := cfg.Encode()
+	var push execution.PeerFunc = func(id plan.PeerID) error {
+		return c.Send(id.WithName(PushName), bs, connection.ConnControl, connection.NoFlag)
+	}
+	return push.Par(runners)
+}
+
+// pushSource never polls, runners only apply the Configs pushed to them
+type pushSource struct{}
+
+func (pushSource) Watch(ctx context.Context, f func(Config)) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
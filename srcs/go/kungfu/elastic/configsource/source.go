@@ -0,0 +1,102 @@
+// Package configsource watches a cluster config published by a central controller,
+// so that runners in watch mode can be driven without a shared filesystem.
+package configsource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+// VersionHeader carries the cluster version when the body is a plain cluster
+const VersionHeader = `X-KungFu-Cluster-Version`
+
+// DefaultPeriod is the interval between polls of sources which can't be watched
+const DefaultPeriod = 1 * time.Second
+
+var (
+	errUnsupportedScheme = errors.New("unsupported config source")
+	errMissingVersion    = errors.New("config has no version")
+)
+
+// Config is a version of the cluster published by the source
+type Config struct {
+	Version int
+	Cluster plan.Cluster
+}
+
+// Source delivers every new Config to f until ctx is canceled
+type Source interface {
+	Watch(ctx context.Context, f func(Config)) error
+}
+
+// Open creates a Source from URL, options are
+// file://<path>, http(s)://<host>/<path>, etcd://<host>:<port>/<key>, etcd+https://<host>:<port>/<key> and push://.
+// Files and HTTP endpoints are polled every period, etcd keys are watched,
+// and push:// only takes Configs pushed to runners, which are accepted with any source.
+func Open(rawURL string, period time.Duration) (Source, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if period <= 0 {
+		period = DefaultPeriod
+	}
+	switch u.Scheme {
+	case "file":
+		return &fileSource{path: u.Path, period: period}, nil
+	case "http", "https":
+		return &httpSource{url: rawURL, period: period}, nil
+	case "etcd":
+		return newEtcdSource("http", u, period)
+	case "etcd+https":
+		return newEtcdSource("https", u, period)
+	case "push":
+		return pushSource{}, nil
+	}
+	return nil, fmt.Errorf("%v: %s", errUnsupportedScheme, rawURL)
+}
+
+// decodeConfig accepts either a JSON encoded Config, or a JSON encoded plan.Cluster with the version given separately
+func decodeConfig(bs []byte, version string) (*Config, error) {
+	var c struct {
+		Version *int
+		Cluster *plan.Cluster
+	}
+	if err := json.Unmarshal(bs, &c); err != nil {
+		return nil, err
+	}
+	if c.Cluster != nil {
+		if c.Version == nil {
+			return nil, errMissingVersion
+		}
+		return &Config{Version: *c.Version, Cluster: *c.Cluster}, c.Cluster.Validate()
+	}
+	if len(version) == 0 {
+		return nil, errMissingVersion
+	}
+	v, err := strconv.Atoi(version)
+	if err != nil {
+		return nil, err
+	}
+	var cluster plan.Cluster
+	if err := json.Unmarshal(bs, &cluster); err != nil {
+		return nil, err
+	}
+	return &Config{Version: v, Cluster: cluster}, cluster.Validate()
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
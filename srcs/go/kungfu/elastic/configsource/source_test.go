@@ -0,0 +1,36 @@
+package configsource
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+func Test_decodeConfig(t *testing.T) {
+	hl := plan.HostList{{IPv4: 1, Slots: 4}}
+	c := plan.Cluster{Runners: hl.GenRunnerList(plan.DefaultRunnerPort)}
+	d, _ := c.Resize(2)
+	plain, _ := json.Marshal(d)
+	versioned, _ := json.Marshal(Config{Version: 3, Cluster: *d})
+	for _, tt := range []struct {
+		bs      []byte
+		version string
+		want    int
+		ok      bool
+	}{
+		{plain, "7", 7, true},
+		{plain, "", 0, false},
+		{versioned, "", 3, true},
+		{versioned, "7", 3, true},
+	} {
+		got, err := decodeConfig(tt.bs, tt.version)
+		if ok := err == nil; ok != tt.ok {
+			t.Errorf("decodeConfig(%s, %q) error: %v", tt.bs, tt.version, err)
+			continue
+		}
+		if tt.ok && (got.Version != tt.want || !got.Cluster.Eq(*d)) {
+			t.Errorf("decodeConfig(%s, %q) = v%d %s", tt.bs, tt.version, got.Version, got.Cluster.DebugString())
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package provision
+
+import (
+	"context"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/elastic/configserver"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+// ProvisionTimeout limits the time of provisioning hosts for one proposal
+var ProvisionTimeout = 10 * time.Minute
+
+// Autoscaler provisions new hosts when a proposed cluster exceeds the capacity of the current hosts
+type Autoscaler struct {
+	Provider     Provider
+	Hosts        plan.HostList // hosts in the pool
+	SlotsPerHost int
+	RunnerPort   uint16
+	Constraints  plan.Constraints // of the placement of new workers
+
+	// Launch starts runners on the new hosts, given all hosts in the pool
+	Launch func(ctx context.Context, newHosts, allHosts plan.HostList) error
+
+	provisioned plan.HostList
+}
+
+// PreResize implements configserver.Hook
+func (a *Autoscaler) PreResize(p configserver.Proposal) (*plan.Cluster, error) {
+	need := len(p.Proposed.Workers) - a.Hosts.Cap()
+	if need <= 0 {
+		return &p.Proposed, nil
+	}
+	n := ceilDiv(need, a.slotsPerHost())
+	log.Infof("%d more slots required, provisioning %d hosts", need, n)
+	ctx, cancel := context.WithTimeout(context.Background(), ProvisionTimeout)
+	defer cancel()
+	hosts, err := a.Provider.Provision(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	a.provisioned = append(a.provisioned, hosts...)
+	if err := WaitSSH(ctx, hosts); err != nil {
+		return nil, err
+	}
+	a.Hosts = append(a.Hosts, hosts...)
+	if err := a.Launch(ctx, hosts, a.Hosts); err != nil {
+		return nil, err
+	}
+	c := plan.Cluster{
+		Runners: append(p.Proposed.Runners.Clone(), hosts.GenRunnerList(a.RunnerPort)...),
+		Workers: p.Proposed.Workers,
+	}
+	if p.Current != nil && len(p.Current.Workers) < len(c.Workers) {
+		c.Workers = p.Current.Workers.Clone()
+	}
+	return c.ResizeWithin(len(p.Proposed.Workers), a.Hosts, a.Constraints)
+}
+
+// Release terminates all hosts provisioned by the Autoscaler
+func (a *Autoscaler) Release(ctx context.Context) error {
+	if len(a.provisioned) == 0 {
+		return nil
+	}
+	if err := a.Provider.Terminate(ctx, a.provisioned); err != nil {
+		return err
+	}
+	a.provisioned = nil
+	return nil
+}
+
+func (a *Autoscaler) slotsPerHost() int {
+	if a.SlotsPerHost > 0 {
+		return a.SlotsPerHost
+	}
+	return 1
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
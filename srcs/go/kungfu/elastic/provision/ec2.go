@@ -0,0 +1,154 @@
+package provision
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+// EC2 provisions AWS EC2 instances with the aws command line tool
+type EC2 struct {
+	Region           string
+	ImageID          string
+	InstanceType     string
+	KeyName          string
+	SubnetID         string
+	SecurityGroupIDs []string
+	Slots            int
+	UsePublicAddr    bool // use public DNS name for SSH, otherwise the private IP
+
+	mu        sync.Mutex
+	instances map[uint32]string // private IPv4 -> instance ID
+}
+
+type ec2Instance struct {
+	InstanceId       string
+	PrivateIpAddress string
+	PublicDnsName    string
+}
+
+func (p *EC2) Provision(ctx context.Context, n int) (plan.HostList, error) {
+	args := []string{
+		`run-instances`,
+		`--image-id`, p.ImageID,
+		`--instance-type`, p.InstanceType,
+		`--count`, fmt.Sprintf("%d", n),
+	}
+	if len(p.KeyName) > 0 {
+		args = append(args, `--key-name`, p.KeyName)
+	}
+	if len(p.SubnetID) > 0 {
+		args = append(args, `--subnet-id`, p.SubnetID)
+	}
+	if len(p.SecurityGroupIDs) > 0 {
+		args = append(args, `--security-group-ids`)
+		args = append(args, p.SecurityGroupIDs...)
+	}
+	var run struct {
+		Instances []ec2Instance
+	}
+	if err := p.aws(ctx, &run, args...); err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, i := range run.Instances {
+		ids = append(ids, i.InstanceId)
+	}
+	log.Infof("launched %d EC2 instances: %s", len(ids), strings.Join(ids, ","))
+	if err := p.aws(ctx, nil, append([]string{`wait`, `instance-running`, `--instance-ids`}, ids...)...); err != nil {
+		return nil, err
+	}
+	var desc struct {
+		Reservations []struct {
+			Instances []ec2Instance
+		}
+	}
+	if err := p.aws(ctx, &desc, append([]string{`describe-instances`, `--instance-ids`}, ids...)...); err != nil {
+		return nil, err
+	}
+	var hl plan.HostList
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.instances == nil {
+		p.instances = make(map[uint32]string)
+	}
+	for _, r := range desc.Reservations {
+		for _, i := range r.Instances {
+			ipv4, err := plan.ParseIPv4(i.PrivateIpAddress)
+			if err != nil {
+				return nil, err
+			}
+			h := plan.HostSpec{IPv4: ipv4, Slots: p.slots(), PublicAddr: i.PrivateIpAddress}
+			if p.UsePublicAddr {
+				h.PublicAddr = i.PublicDnsName
+			}
+			p.instances[ipv4] = i.InstanceId
+			hl = append(hl, h)
+		}
+	}
+	return hl, nil
+}
+
+var errUnknownInstance = errors.New("host is not provisioned by this provider")
+
+func (p *EC2) Terminate(ctx context.Context, hosts plan.HostList) error {
+	var ids []string
+	p.mu.Lock()
+	for _, h := range hosts {
+		id, ok := p.instances[h.IPv4]
+		if !ok {
+			p.mu.Unlock()
+			return errUnknownInstance
+		}
+		ids = append(ids, id)
+	}
+	p.mu.Unlock()
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := p.aws(ctx, nil, append([]string{`terminate-instances`, `--instance-ids`}, ids...)...); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, h := range hosts {
+		delete(p.instances, h.IPv4)
+	}
+	log.Infof("terminated %d EC2 instances: %s", len(ids), strings.Join(ids, ","))
+	return nil
+}
+
+func (p *EC2) slots() int {
+	if p.Slots > 0 {
+		return p.Slots
+	}
+	return 1
+}
+
+// aws runs `aws ec2 <args>` and decodes the JSON output into result if not nil
+func (p *EC2) aws(ctx context.Context, result interface{}, args ...string) error {
+	args = append([]string{`ec2`}, args...)
+	if len(p.Region) > 0 {
+		args = append(args, `--region`, p.Region)
+	}
+	args = append(args, `--output`, `json`)
+	cmd := exec.CommandContext(ctx, `aws`, args...)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("aws %s: %v %s", strings.Join(args[:2], " "), err, strings.TrimSpace(stderr.String()))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(out, result)
+}
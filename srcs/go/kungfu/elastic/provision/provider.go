@@ -0,0 +1,76 @@
+package provision
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/utils"
+	"github.com/lsds/KungFu/srcs/go/utils/strictjson"
+)
+
+// Provider acquires and releases hosts from a cloud
+type Provider interface {
+	Provision(ctx context.Context, n int) (plan.HostList, error)
+	Terminate(ctx context.Context, hosts plan.HostList) error
+}
+
+// New creates a Provider by name, the config is decoded from a JSON file
+func New(name string, configFile string) (Provider, error) {
+	switch name {
+	case "ec2":
+		p := &EC2{}
+		if len(configFile) > 0 {
+			if err := readJSONFile(configFile, p); err != nil {
+				return nil, err
+			}
+		}
+		return p, nil
+	default:
+		return nil, fmt.Errorf("unknown provider: %q", name)
+	}
+}
+
+const sshPort = 22
+
+// WaitSSH waits until the SSH port of all hosts are reachable
+func WaitSSH(ctx context.Context, hosts plan.HostList) error {
+	errs := make([]error, len(hosts))
+	var wg sync.WaitGroup
+	for i, h := range hosts {
+		wg.Add(1)
+		go func(i int, addr string) {
+			errs[i] = waitTCP(ctx, addr)
+			wg.Done()
+		}(i, net.JoinHostPort(h.PublicAddr, strconv.Itoa(sshPort)))
+	}
+	wg.Wait()
+	return utils.MergeErrors(errs, "WaitSSH")
+}
+
+func waitTCP(ctx context.Context, addr string) error {
+	t0 := time.Now()
+	n, ok := utils.Poll(ctx, func() bool {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err != nil {
+			time.Sleep(time.Second)
+			return false
+		}
+		conn.Close()
+		return true
+	})
+	if !ok {
+		return fmt.Errorf("%s is not reachable after %d trials", addr, n)
+	}
+	log.Infof("%s is reachable after %s", addr, time.Since(t0))
+	return nil
+}
+
+func readJSONFile(filename string, i interface{}) error {
+	return strictjson.ReadFile(filename, i)
+}
@@ -3,21 +3,36 @@ package env
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
 	"github.com/lsds/KungFu/srcs/go/plan"
 )
 
 type Config struct {
-	ConfigServer string
-	Parent       plan.PeerID
-	InitRunners  plan.PeerList
-	Self         plan.PeerID
-	Strategy     kb.Strategy
+	ConfigServer    string
+	Parent          plan.PeerID
+	InitRunners     plan.PeerList
+	Self            plan.PeerID
+	Strategy        kb.Strategy
+	StrategyOptions kb.StrategyOptions
 
 	InitClusterVersion string
 	InitPeers          plan.PeerList
 
+	MigrationState string // file of the state handed over by the migrated peer
+	KVSnapshot     string // file of the initial snapshot of the cluster metadata store
+	StatsFile      string
+	LeasePeriod    time.Duration
+	Seed           uint64
+	Roles          *plan.RoleLayout // nil if no role is defined
+	TimeShare      *TimeShare       // nil if the slot of the peer isn't shared
+	HostAddrs      plan.HostAddrs   // public addresses of hosts, which may be IPv6
+	DegradedPolicy plan.DegradedPolicy
+	HostList       plan.HostList    // hosts the peers added by resize are placed on, with Constraints
+	Constraints    plan.Constraints // of the placement of the peers added by resize
+
 	Single bool
 }
 
@@ -41,7 +56,37 @@ func ParseConfigFromEnv() (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
-	strategy, err := kb.ParseStrategy(os.Getenv(AllReduceStrategyEnvKey))
+	strategy, strategyOptions, err := kb.ParseStrategySpec(os.Getenv(AllReduceStrategyEnvKey))
+	if err != nil {
+		return nil, err
+	}
+	leasePeriod, err := getLeasePeriodFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	seed, err := getSeedFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	roles, err := getRoleLayoutFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	timeShare, err := getTimeShareFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	hostAddrs, err := plan.ParseHostAddrs(os.Getenv(HostAddrsEnvKey))
+	if err != nil {
+		return nil, err
+	}
+	degradedPolicy := plan.DegradedEvict
+	if val := os.Getenv(DegradedPolicyEnvKey); len(val) > 0 {
+		if err := degradedPolicy.Set(val); err != nil {
+			return nil, err
+		}
+	}
+	hostList, constraints, err := getPlacementFromEnv()
 	if err != nil {
 		return nil, err
 	}
@@ -52,10 +97,39 @@ func ParseConfigFromEnv() (*Config, error) {
 		InitRunners:        initRunners,
 		InitPeers:          initPeers,
 		Strategy:           *strategy,
+		StrategyOptions:    *strategyOptions,
 		InitClusterVersion: os.Getenv(InitClusterVersionEnvKey),
+		MigrationState:     os.Getenv(MigrationStateEnvKey),
+		KVSnapshot:         os.Getenv(KVSnapshotEnvKey),
+		StatsFile:          os.Getenv(StatsFileEnvKey),
+		LeasePeriod:        leasePeriod,
+		Seed:               seed,
+		Roles:              roles,
+		TimeShare:          timeShare,
+		HostAddrs:          hostAddrs,
+		DegradedPolicy:     degradedPolicy,
+		HostList:           hostList,
+		Constraints:        constraints,
 	}, nil
 }
 
+func getPlacementFromEnv() (plan.HostList, plan.Constraints, error) {
+	var c plan.Constraints
+	val, ok := os.LookupEnv(HostListEnvKey)
+	if !ok {
+		return nil, c, nil
+	}
+	hl, err := plan.ParseHostList(val)
+	if err != nil {
+		return nil, c, err
+	}
+	if c.Require, err = plan.ParseLabels(os.Getenv(RequireEnvKey)); err != nil {
+		return nil, c, err
+	}
+	c.SpreadAcross = os.Getenv(SpreadAcrossEnvKey)
+	return hl, c, nil
+}
+
 func singleEnv() *Config {
 	pl, _ := plan.DefaultHostList.GenPeerList(1, plan.DefaultPortRange)
 	self := pl[0]
@@ -71,6 +145,30 @@ func getConfigServerFromEnv() string {
 	return os.Getenv(ConfigServerEnvKey)
 }
 
+func getLeasePeriodFromEnv() (time.Duration, error) {
+	val, ok := os.LookupEnv(LeasePeriodEnvKey)
+	if !ok {
+		return 0, nil
+	}
+	return time.ParseDuration(val)
+}
+
+func getSeedFromEnv() (uint64, error) {
+	val, ok := os.LookupEnv(SeedEnvKey)
+	if !ok {
+		return 0, nil
+	}
+	return strconv.ParseUint(val, 10, 64)
+}
+
+func getRoleLayoutFromEnv() (*plan.RoleLayout, error) {
+	val, ok := os.LookupEnv(RoleLayoutEnvKey)
+	if !ok {
+		return nil, nil
+	}
+	return plan.ParseRoleLayout(val)
+}
+
 func getSelfFromEnv() (*plan.PeerID, error) {
 	config, ok := os.LookupEnv(SelfSpecEnvKey)
 	if !ok {
@@ -15,4 +15,23 @@ const (
 	ProcStartTimestamp = `KUNGFU_PROC_START_TIMESTAMP`
 
 	AllowNvLink = `KUNGFU_ALLOW_NVLINK`
+
+	RoleEnvKey       = `KUNGFU_ROLE`        // role label of the program section in a MPMD job
+	RoleRankEnvKey   = `KUNGFU_ROLE_RANK`   // rank among peers of the same role
+	RoleLayoutEnvKey = `KUNGFU_ROLE_LAYOUT` // roles of all ranks, see plan.RoleLayout
+
+	MigrationStateEnvKey = `KUNGFU_MIGRATION_STATE`
+	KVSnapshotEnvKey     = `KUNGFU_KV_SNAPSHOT`     // file of the snapshot of the cluster metadata store when the peer was created
+	StatsFileEnvKey      = `KUNGFU_STATS_FILE`      // file to save the stats of the peer on exit
+	LeasePeriodEnvKey    = `KUNGFU_LEASE_PERIOD`    // the peer is evicted if it doesn't renew its lease with the parent within this period
+	TimeShareEnvKey      = `KUNGFU_TIME_SHARE`      // <turn>/<turns> of the peer among the ranks sharing its slot, see TimeShare
+	HostAddrsEnvKey      = `KUNGFU_HOST_ADDRS`      // public addresses of hosts, see plan.HostAddrs
+	DegradedPolicyEnvKey = `KUNGFU_DEGRADED_POLICY` // what happens once the peer reports its GPU unavailable, see plan.DegradedPolicy
+
+	HostListEnvKey     = `KUNGFU_HOST_LIST`     // hosts with their labels, set with placement constraints for the peers added by resize
+	RequireEnvKey      = `KUNGFU_REQUIRE`       // labels the hosts of the peers added by resize must have, see plan.Constraints
+	SpreadAcrossEnvKey = `KUNGFU_SPREAD_ACROSS` // label whose values the peers added by resize are spread across, see plan.Constraints
+
+	SeedEnvKey     = `KUNGFU_SEED`      // the job seed which per-rank seeds are derived from
+	RankSeedEnvKey = `KUNGFU_RANK_SEED` // the seed of the initial rank, use the Seed API to get the seed after resize
 )
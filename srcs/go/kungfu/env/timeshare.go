@@ -0,0 +1,39 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// TimeShare is the turn of a peer among the ranks sharing a slot of an oversubscribed host, see runner flag -oversubscribe
+type TimeShare struct {
+	Turn  int
+	Turns int
+}
+
+func (t TimeShare) String() string {
+	return fmt.Sprintf("%d/%d", t.Turn, t.Turns)
+}
+
+var errInvalidTimeShare = errors.New("invalid " + TimeShareEnvKey)
+
+func ParseTimeShare(val string) (*TimeShare, error) {
+	var t TimeShare
+	if _, err := fmt.Sscanf(val, "%d/%d", &t.Turn, &t.Turns); err != nil {
+		return nil, fmt.Errorf("%v: %q", errInvalidTimeShare, val)
+	}
+	if t.Turn < 0 || t.Turn >= t.Turns {
+		return nil, fmt.Errorf("%v: %q", errInvalidTimeShare, val)
+	}
+	return &t, nil
+}
+
+// getTimeShareFromEnv returns nil if the peer doesn't share its slot
+func getTimeShareFromEnv() (*TimeShare, error) {
+	val, ok := os.LookupEnv(TimeShareEnvKey)
+	if !ok {
+		return nil, nil
+	}
+	return ParseTimeShare(val)
+}
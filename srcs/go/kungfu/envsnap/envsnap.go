@@ -0,0 +1,266 @@
+// Package envsnap captures the environment of a worker when it starts, so that the environments of two ranks can be compared,
+// since a program that works on one rank but not on another almost always runs in a different environment.
+package envsnap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/proc"
+	"github.com/lsds/KungFu/srcs/go/utils"
+)
+
+// Suffix is the suffix of the files of Snapshots, which are saved next to the log files of workers
+const Suffix = `.env.json`
+
+// VersionScript prints <key>=<version> of the GPU software stack, - if not found
+const VersionScript = `PATH=$HOME/local/python/bin:$PATH
+v() { [ -n "$1" ] && echo "$1" || echo -; }
+echo gpu=$(v "$(nvidia-smi --query-gpu=name --format=csv,noheader 2>/dev/null | sort | uniq -c | awk '{$1=$1};1' | paste -sd ';' -)")
+echo driver=$(v "$(nvidia-smi --query-gpu=driver_version --format=csv,noheader 2>/dev/null | head -n 1)")
+echo cuda=$(v "$(nvcc --version 2>/dev/null | sed -n 's/.*release \([0-9.]*\).*/\1/p')")
+echo nccl=$(v "$(cat $NCCL_HOME/include/nccl.h /usr/include/nccl.h /usr/local/cuda/include/nccl.h 2>/dev/null | awk '/define NCCL_MAJOR/{a=$3} /define NCCL_MINOR/{b=$3} /define NCCL_PATCH/{c=$3} END{if(a!="")print a"."b"."c}')")
+echo python=$(v "$(python3 -c 'import platform; print(platform.python_version())' 2>/dev/null)")
+echo tensorflow=$(v "$(python3 -c 'import tensorflow as tf; print(tf.__version__)' 2>/dev/null)")
+`
+
+// VersionKeys are the keys printed by VersionScript
+var VersionKeys = []string{`gpu`, `driver`, `cuda`, `nccl`, `python`, `tensorflow`}
+
+// probeTimeout bounds the time of VersionScript and the probe hook
+const probeTimeout = 60 * time.Second
+
+// Snapshot is the environment of a worker when it started
+type Snapshot struct {
+	Peer     plan.PeerID
+	Rank     int
+	Version  int // of the cluster
+	Host     string
+	Taken    time.Time
+	Prog     string
+	Args     []string
+	Dir      string            `json:",omitempty"`
+	Envs     map[string]string // values of secrets are replaced by their fingerprints
+	Versions map[string]string // of the GPU software stack, see VersionScript
+	Packages map[string]string `json:",omitempty"` // listed by the probe hook, e.g. pip freeze
+	Errors   []string          `json:",omitempty"` // of the probes
+}
+
+// fingerprint hides a secret, while different secrets still have different fingerprints
+func fingerprint(value string) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(value)))[:19]
+}
+
+var (
+	versionsOnce sync.Once
+	versions     map[string]string
+	versionsErr  error
+)
+
+// hostVersions runs VersionScript once, since all workers of a host share the GPU software stack
+func hostVersions() (map[string]string, error) {
+	versionsOnce.Do(func() {
+		var bs []byte
+		bs, versionsErr = run(context.Background(), VersionScript, nil, "")
+		versions = parseLines(bs)
+	})
+	return versions, versionsErr
+}
+
+// Take captures the environment of the worker started by p, probe is a shell command listing packages, e.g. pip freeze, run in the environment of the worker.
+func Take(ctx context.Context, p proc.Proc, id plan.PeerID, rank, version int, probe string) Snapshot {
+	s := Snapshot{
+		Peer:    id,
+		Rank:    rank,
+		Version: version,
+		Taken:   time.Now(),
+		Prog:    p.Prog,
+		Args:    p.Args,
+		Dir:     p.Dir,
+		Envs:    make(map[string]string),
+	}
+	s.Host, _ = os.Hostname()
+	envs := p.Cmd().Env
+	for _, kv := range envs {
+		if i := strings.Index(kv, "="); i > 0 {
+			k, v := kv[:i], kv[i+1:]
+			if utils.IsSecret(k) {
+				v = fingerprint(v)
+			}
+			s.Envs[k] = v
+		}
+	}
+	var err error
+	if s.Versions, err = hostVersions(); err != nil {
+		s.Errors = append(s.Errors, fmt.Sprintf("versions: %v", err))
+	}
+	if len(probe) > 0 {
+		bs, err := run(ctx, probe, envs, p.Dir)
+		if err != nil {
+			s.Errors = append(s.Errors, fmt.Sprintf("probe: %v", err))
+		}
+		s.Packages = parseLines(bs)
+	}
+	return s
+}
+
+func run(ctx context.Context, script string, envs []string, dir string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, `sh`, `-c`, script)
+	cmd.Env = envs
+	cmd.Dir = dir
+	return cmd.Output()
+}
+
+// parseLines parses the lines of <name>==<version> of pip freeze, <name>=<version>=<build> of conda list --export,
+// <name> <version> <build> of conda list, and <key>=<value>, comments are skipped.
+func parseLines(bs []byte) map[string]string {
+	m := make(map[string]string)
+	s := bufio.NewScanner(bytes.NewReader(bs))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var k, v string
+		if i := strings.Index(line, "=="); i > 0 {
+			k, v = line[:i], line[i+2:]
+		} else if i := strings.Index(line, "="); i > 0 {
+			k, v = line[:i], line[i+1:]
+		} else if fs := strings.Fields(line); len(fs) > 1 {
+			k, v = fs[0], strings.Join(fs[1:], " ")
+		} else {
+			k = line
+		}
+		m[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return m
+}
+
+// Filename is the file of the Snapshot of a worker of a cluster version in dir
+func Filename(dir string, id plan.PeerID, version int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s.%d@%d%s", plan.FormatIPv4(id.IPv4), id.Port, version, Suffix))
+}
+
+// Save writes the Snapshot to its file in dir
+func (s Snapshot) Save(dir string) error {
+	bs, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(Filename(dir, s.Peer, s.Version), bs, 0644)
+}
+
+// Load reads a Snapshot from a file
+func Load(filename string) (*Snapshot, error) {
+	bs, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var s Snapshot
+	if err := json.Unmarshal(bs, &s); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return &s, nil
+}
+
+// LoadRank reads the latest Snapshot of a rank among the Snapshots in dir
+func LoadRank(dir string, rank int) (*Snapshot, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+Suffix))
+	if err != nil {
+		return nil, err
+	}
+	var latest *Snapshot
+	for _, f := range files {
+		s, err := Load(f)
+		if err != nil {
+			return nil, err
+		}
+		if s.Rank == rank && (latest == nil || s.Version > latest.Version || (s.Version == latest.Version && s.Taken.After(latest.Taken))) {
+			latest = s
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("no snapshot of rank %d in %s", rank, dir)
+	}
+	return latest, nil
+}
+
+// perPeer are environment variables which are expected to differ across ranks
+var perPeer = map[string]bool{
+	`KUNGFU_SELF_SPEC`:            true,
+	`KUNGFU_PROC_START_TIMESTAMP`: true,
+	`KUNGFU_RANK_SEED`:            true,
+	`KUNGFU_ROLE_RANK`:            true,
+	`KUNGFU_STATS_FILE`:           true,
+	`KUNGFU_MIGRATION_STATE`:      true,
+	`KUNGFU_KV_SNAPSHOT`:          true,
+	`CUDA_VISIBLE_DEVICES`:        true,
+	`KUNGFU_CUDA_VISIBLE_DEVICES`: true,
+}
+
+// Change is a value which differs between two Snapshots, - if missing
+type Change struct {
+	Section string // env, version, package or prog
+	Key     string
+	A, B    string
+}
+
+// Diff returns the values which differ between two Snapshots, except the environment variables expected to differ across ranks
+func Diff(a, b *Snapshot) []Change {
+	var cs []Change
+	if x, y := strings.Join(append([]string{a.Prog}, a.Args...), " "), strings.Join(append([]string{b.Prog}, b.Args...), " "); x != y {
+		cs = append(cs, Change{Section: `prog`, Key: `command`, A: x, B: y})
+	}
+	if a.Dir != b.Dir {
+		cs = append(cs, Change{Section: `prog`, Key: `dir`, A: a.Dir, B: b.Dir})
+	}
+	cs = append(cs, diffMaps(`env`, a.Envs, b.Envs, perPeer)...)
+	cs = append(cs, diffMaps(`version`, a.Versions, b.Versions, nil)...)
+	cs = append(cs, diffMaps(`package`, a.Packages, b.Packages, nil)...)
+	return cs
+}
+
+func diffMaps(section string, a, b map[string]string, ignored map[string]bool) []Change {
+	keys := make(map[string]struct{})
+	for k := range a {
+		keys[k] = struct{}{}
+	}
+	for k := range b {
+		keys[k] = struct{}{}
+	}
+	var cs []Change
+	for k := range keys {
+		if ignored[k] {
+			continue
+		}
+		x, okA := a[k]
+		y, okB := b[k]
+		if okA && okB && x == y {
+			continue
+		}
+		if !okA {
+			x = "-"
+		}
+		if !okB {
+			y = "-"
+		}
+		cs = append(cs, Change{Section: section, Key: k, A: x, B: y})
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].Key < cs[j].Key })
+	return cs
+}
@@ -0,0 +1,104 @@
+package envsnap
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/proc"
+)
+
+func Test_parseLines(t *testing.T) {
+	out := `# packages in environment
+numpy==1.19.5
+cudatoolkit=10.1.243=h6bb024c_0
+tensorflow-gpu            1.15.0               h0d30ee6_0
+python=3.7
+-e git+https://github.com/lsds/KungFu.git
+`
+	want := map[string]string{
+		`numpy`:          `1.19.5`,
+		`cudatoolkit`:    `10.1.243=h6bb024c_0`,
+		`tensorflow-gpu`: `1.15.0 h0d30ee6_0`,
+		`python`:         `3.7`,
+		`-e`:             `git+https://github.com/lsds/KungFu.git`,
+	}
+	got := parseLines([]byte(out))
+	if len(got) != len(want) {
+		t.Errorf("parsed %d packages, want %d: %v", len(got), len(want), got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s: got %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func Test_Diff(t *testing.T) {
+	a := &Snapshot{
+		Prog:     `python3`,
+		Args:     []string{`train.py`},
+		Envs:     map[string]string{`KUNGFU_SELF_SPEC`: `127.0.0.1:10000`, `LD_LIBRARY_PATH`: `/usr/local/cuda/lib64`, `API_TOKEN`: fingerprint(`a`)},
+		Versions: map[string]string{`cuda`: `10.1`},
+		Packages: map[string]string{`numpy`: `1.19.5`, `six`: `1.15.0`},
+	}
+	b := &Snapshot{
+		Prog:     `python3`,
+		Args:     []string{`train.py`},
+		Envs:     map[string]string{`KUNGFU_SELF_SPEC`: `127.0.0.1:10001`, `API_TOKEN`: fingerprint(`b`)},
+		Versions: map[string]string{`cuda`: `10.1`},
+		Packages: map[string]string{`numpy`: `1.18.0`, `six`: `1.15.0`},
+	}
+	cs := Diff(a, b)
+	want := []Change{
+		{`env`, `API_TOKEN`, fingerprint(`a`), fingerprint(`b`)},
+		{`env`, `LD_LIBRARY_PATH`, `/usr/local/cuda/lib64`, `-`},
+		{`package`, `numpy`, `1.19.5`, `1.18.0`},
+	}
+	if len(cs) != len(want) {
+		t.Fatalf("got %d changes, want %d: %v", len(cs), len(want), cs)
+	}
+	for i := range want {
+		if cs[i] != want[i] {
+			t.Errorf("#%d: got %v, want %v", i, cs[i], want[i])
+		}
+	}
+	if len(Diff(a, a)) != 0 {
+		t.Errorf("snapshot differs from itself")
+	}
+}
+
+func Test_Take(t *testing.T) {
+	versions = map[string]string{`cuda`: `-`} // don't run VersionScript
+	versionsOnce.Do(func() {})
+	dir, err := ioutil.TempDir("", "envsnap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := proc.Proc{Prog: `true`, Envs: proc.Envs{`DB_PASSWORD`: `hunter2`, `OMP_NUM_THREADS`: `4`}}
+	for i, id := range []plan.PeerID{{IPv4: 0x7f000001, Port: 10000}, {IPv4: 0x7f000001, Port: 10001}} {
+		s := Take(context.Background(), p, id, i, 1, `echo numpy==1.19.5`)
+		if s.Envs[`DB_PASSWORD`] == `hunter2` || s.Envs[`OMP_NUM_THREADS`] != `4` {
+			t.Errorf("unexpected environment %v", s.Envs)
+		}
+		if s.Packages[`numpy`] != `1.19.5` {
+			t.Errorf("unexpected packages %v", s.Packages)
+		}
+		if err := s.Save(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := LoadRank(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Peer.Port != 10001 {
+		t.Errorf("loaded %s as rank 1", s.Peer)
+	}
+	if _, err := LoadRank(dir, 2); err == nil {
+		t.Errorf("loaded a missing rank")
+	}
+}
@@ -0,0 +1,274 @@
+// Package features gates experimental subsystems by flags,
+// which are set for a run by a file and the environment, and for a peer by kungfu-ctl feature.
+package features
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/utils"
+	"github.com/lsds/KungFu/srcs/go/utils/strictjson"
+)
+
+// FeatureName is the name of the control message that overrides features of peers
+const FeatureName = "feature"
+
+// Names of features
+const (
+	Datagram       = "datagram"        // small control and collective messages are sent over UDP
+	CompressStages = "compress-stages" // cluster updates sent to runners are compressed
+	WarmUp         = "warm-up"         // all edges of strategies are connected once a session is created
+	Resume         = "resume"          // connections of the data plane are dialed again and retransmit after transient failures
+)
+
+// Feature is a flag of an experimental subsystem
+type Feature struct {
+	Name    string
+	Bit     uint // position in the Set exchanged by peers, must never be reused by another feature
+	Cluster bool // takes effect only if enabled on all peers, which is negotiated when a session is created
+	Static  bool // only read at start, can't be overridden by kungfu-ctl
+}
+
+// Known features, a peer of an older version doesn't know the newer features, which are negotiated as disabled by it.
+var Known = []Feature{
+	{Name: Datagram, Bit: 0, Cluster: true, Static: true},
+	{Name: CompressStages, Bit: 1},
+	{Name: WarmUp, Bit: 2, Cluster: true},
+	{Name: Resume, Bit: 3, Cluster: true},
+}
+
+// MaxBits is the size of the Set exchanged by peers
+const MaxBits = 64
+
+var (
+	errUnknownFeature = errors.New("unknown feature")
+	errStaticFeature  = errors.New("feature can't be changed at runtime")
+)
+
+func lookup(name string) (Feature, error) {
+	for _, f := range Known {
+		if f.Name == name {
+			return f, nil
+		}
+	}
+	return Feature{}, fmt.Errorf("%v: %s", errUnknownFeature, name)
+}
+
+func Names() []string {
+	var names []string
+	for _, f := range Known {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Set is a set of features by their bits
+type Set uint64
+
+func (s Set) Has(name string) bool {
+	f, err := lookup(name)
+	return err == nil && s&(1<<f.Bit) != 0
+}
+
+func (s Set) with(f Feature, on bool) Set {
+	if on {
+		return s | 1<<f.Bit
+	}
+	return s &^ (1 << f.Bit)
+}
+
+func (s Set) String() string {
+	var names []string
+	for _, f := range Known {
+		if s&(1<<f.Bit) != 0 {
+			names = append(names, f.Name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// Bits returns the Set as MaxBits flags of 0 and 1, which are negotiated by the MIN reduction
+func (s Set) Bits() []int8 {
+	bits := make([]int8, MaxBits)
+	for i := range bits {
+		bits[i] = int8(s >> uint(i) & 1)
+	}
+	return bits
+}
+
+func FromBits(bits []int8) Set {
+	var s Set
+	for i, b := range bits {
+		if b != 0 && i < MaxBits {
+			s |= 1 << uint(i)
+		}
+	}
+	return s
+}
+
+// Update is a list of features switched on or off, e.g. datagram,-warm-up or datagram=on,warm-up=off
+type Update map[string]bool
+
+func ParseUpdate(s string) (Update, error) {
+	u := make(Update)
+	for _, kv := range strings.Split(s, ",") {
+		if kv = strings.TrimSpace(kv); len(kv) == 0 {
+			continue
+		}
+		name, on := strings.TrimPrefix(kv, "-"), !strings.HasPrefix(kv, "-")
+		if parts := strings.SplitN(kv, "=", 2); len(parts) == 2 {
+			name = parts[0]
+			switch strings.ToLower(parts[1]) {
+			case "on", "true", "1":
+				on = true
+			case "off", "false", "0":
+				on = false
+			default:
+				return nil, fmt.Errorf("invalid value of feature %s: %s", name, parts[1])
+			}
+		}
+		u[name] = on
+	}
+	return u, nil
+}
+
+func (u Update) Encode() []byte {
+	bs, _ := json.Marshal(u)
+	return bs
+}
+
+func (u *Update) Decode(bs []byte) error {
+	return json.Unmarshal(bs, u)
+}
+
+// Apply switches the features of u in s, unknown features are returned to be warned about,
+// as they may be known by peers of other versions.
+func (u Update) Apply(s Set, runtime bool) (Set, []string, error) {
+	var unknown []string
+	for name, on := range u {
+		f, err := lookup(name)
+		if err != nil {
+			unknown = append(unknown, name)
+			continue
+		}
+		if runtime && f.Static {
+			return s, nil, fmt.Errorf("%v: %s", errStaticFeature, name)
+		}
+		s = s.with(f, on)
+	}
+	sort.Strings(unknown)
+	return s, unknown, nil
+}
+
+// Negotiate returns the effective features of a peer requesting local, given agreed, the features requested by all peers
+func Negotiate(local, agreed Set) Set {
+	var s Set
+	for _, f := range Known {
+		if f.Cluster {
+			s = s.with(f, agreed.Has(f.Name))
+		} else {
+			s = s.with(f, local.Has(f.Name))
+		}
+	}
+	return s
+}
+
+// defaults are given by the config of the subsystems before they were flagged
+func defaults() Set {
+	u := Update{
+		Datagram:       config.EnableDatagram,
+		CompressStages: config.CompressStages,
+		WarmUp:         config.WarmUp,
+	}
+	s, _, _ := u.Apply(0, false)
+	return s
+}
+
+// Load returns the features requested by config.FeaturesFile, then config.Features, over the defaults
+func Load() (Set, []string, error) {
+	s := defaults()
+	var unknown []string
+	if len(config.FeaturesFile) > 0 {
+		bs, err := ioutil.ReadFile(config.FeaturesFile)
+		if err != nil {
+			return s, nil, err
+		}
+		var u Update
+		if err := strictjson.Decode(config.FeaturesFile, bs, &u); err != nil {
+			return s, nil, err
+		}
+		var names []string
+		if s, names, err = u.Apply(s, false); err != nil {
+			return s, nil, err
+		}
+		unknown = append(unknown, names...)
+	}
+	if len(config.Features) > 0 {
+		u, err := ParseUpdate(config.Features)
+		if err != nil {
+			return s, nil, err
+		}
+		var names []string
+		if s, names, err = u.Apply(s, false); err != nil {
+			return s, nil, err
+		}
+		unknown = append(unknown, names...)
+	}
+	return s, unknown, nil
+}
+
+var state struct {
+	once      sync.Once
+	requested Set
+	effective uint64
+}
+
+func initState() {
+	state.once.Do(func() {
+		s, unknown, err := Load()
+		if err != nil {
+			utils.ExitErr(fmt.Errorf("invalid features: %v", err))
+		}
+		if len(unknown) > 0 {
+			log.Warnf("unknown features are ignored: %s", strings.Join(unknown, ","))
+		}
+		state.requested = s
+		atomic.StoreUint64(&state.effective, uint64(Negotiate(s, 0))) // cluster features are off until negotiated
+	})
+}
+
+// Requested returns the features requested for this process, before negotiation
+func Requested() Set {
+	initState()
+	return state.requested
+}
+
+// Enabled tells if the named feature is in effect
+func Enabled(name string) bool {
+	initState()
+	return Set(atomic.LoadUint64(&state.effective)).Has(name)
+}
+
+// Effective returns the features in effect
+func Effective() Set {
+	initState()
+	return Set(atomic.LoadUint64(&state.effective))
+}
+
+// SetEffective sets the features in effect, after negotiation
+func SetEffective(s Set) {
+	initState()
+	atomic.StoreUint64(&state.effective, uint64(s))
+}
@@ -0,0 +1,56 @@
+package features
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_ParseUpdate(t *testing.T) {
+	u, err := ParseUpdate("datagram, -warm-up,compress-stages=off")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Update{Datagram: true, WarmUp: false, CompressStages: false}); !reflect.DeepEqual(u, want) {
+		t.Errorf("ParseUpdate() = %v, want %v", u, want)
+	}
+	if _, err := ParseUpdate("warm-up=maybe"); err == nil {
+		t.Errorf("invalid value should fail")
+	}
+}
+
+func Test_Apply(t *testing.T) {
+	u := Update{WarmUp: true, "teleport": true}
+	s, unknown, err := u.Apply(0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Has(WarmUp) || s.Has(Datagram) {
+		t.Errorf("Apply() = %s", s)
+	}
+	if !reflect.DeepEqual(unknown, []string{"teleport"}) {
+		t.Errorf("unknown = %v", unknown)
+	}
+	if _, _, err := (Update{Datagram: false}).Apply(s, true); err == nil {
+		t.Errorf("static feature should not be changed at runtime")
+	}
+	if s, _, err := (Update{Datagram: true}).Apply(s, false); err != nil || !s.Has(Datagram) {
+		t.Errorf("static feature should be set at start: %s, %v", s, err)
+	}
+}
+
+func Test_Negotiate(t *testing.T) {
+	var local, other Set
+	local, _, _ = (Update{Datagram: true, WarmUp: true, CompressStages: true}).Apply(0, false)
+	other, _, _ = (Update{WarmUp: true}).Apply(0, false)
+	agreed := local & other // as reduced by MIN over the bits
+	if got := FromBits(local.Bits()); got != local {
+		t.Errorf("FromBits(Bits()) = %s, want %s", got, local)
+	}
+	s := Negotiate(local, agreed)
+	if s.Has(Datagram) || !s.Has(WarmUp) || !s.Has(CompressStages) {
+		t.Errorf("Negotiate() = %s", s)
+	}
+	if s := Negotiate(other, agreed); s.Has(CompressStages) {
+		t.Errorf("local feature of another peer should not be enabled: %s", s)
+	}
+}
@@ -0,0 +1,196 @@
+// Package formation tracks the progress of peers forming a cluster, which takes a while for hundreds of peers.
+// Peers report the phases of joining a cluster version to their runners, which forward them to the first runner of the cluster.
+package formation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+// ReportName is the control message of a Report, from a peer to its runner, and from a runner to the first runner
+const ReportName = "formation"
+
+// Phase is a phase of a peer joining a cluster, in the order of Phases
+type Phase string
+
+const (
+	Connecting Phase = "connecting" // to all peers, in the barrier of the new session
+	Exchanging Phase = "exchanging" // features, tunables and tensor schemas with all peers
+	WarmingUp  Phase = "warming up" // connecting all edges of the strategies, see config.WarmUp
+	Ready      Phase = "ready"
+)
+
+// Phases are the phases in order
+var Phases = []Phase{Connecting, Exchanging, WarmingUp, Ready}
+
+func (p Phase) order() int {
+	for i, q := range Phases {
+		if p == q {
+			return i
+		}
+	}
+	return -1
+}
+
+// Report is the phase of a peer joining a cluster version
+type Report struct {
+	Peer    plan.PeerID
+	Version int
+	Phase   Phase
+}
+
+func (r Report) Encode() []byte {
+	b := &bytes.Buffer{}
+	json.NewEncoder(b).Encode(r)
+	return b.Bytes()
+}
+
+func (r *Report) Decode(bs []byte) error {
+	return json.NewDecoder(bytes.NewBuffer(bs)).Decode(r)
+}
+
+// HostProgress is the number of peers of a host which are not ready
+type HostProgress struct {
+	Host    string `json:"host"`
+	Pending int    `json:"pending"`
+}
+
+// Progress is the progress of a cluster version, peers which didn't report any phase are not registered
+type Progress struct {
+	Version    int            `json:"version"`
+	Total      int            `json:"total"`
+	Registered int            `json:"registered"`
+	Phases     map[Phase]int  `json:"phases"`
+	Pending    []HostProgress `json:"pending"` // hosts with peers not ready, most pending first
+}
+
+// Done tells if all peers are ready
+func (p Progress) Done() bool {
+	return p.Phases[Ready] == p.Total
+}
+
+// maxPendingHosts is the number of pending hosts printed by String
+const maxPendingHosts = 5
+
+func (p Progress) String() string {
+	parts := []string{fmt.Sprintf("%d/%d peers ready", p.Phases[Ready], p.Total)}
+	for _, q := range Phases {
+		if n := p.Phases[q]; n > 0 && q != Ready {
+			parts = append(parts, fmt.Sprintf("%d %s", n, q))
+		}
+	}
+	if n := p.Total - p.Registered; n > 0 {
+		parts = append(parts, fmt.Sprintf("%d not registered", n))
+	}
+	s := fmt.Sprintf("v%d: %s", p.Version, strings.Join(parts, ", "))
+	if len(p.Pending) > 0 {
+		var hosts []string
+		for i, h := range p.Pending {
+			if i == maxPendingHosts {
+				hosts = append(hosts, fmt.Sprintf("and %d more", len(p.Pending)-i))
+				break
+			}
+			hosts = append(hosts, fmt.Sprintf("%s (%d)", h.Host, h.Pending))
+		}
+		s += ", pending hosts: " + strings.Join(hosts, ", ")
+	}
+	return s
+}
+
+// Tracker records the latest phase of each peer of the recent cluster versions
+type Tracker struct {
+	mu       sync.Mutex
+	workers  map[int]plan.PeerList
+	phases   map[int]map[plan.PeerID]Phase
+	expected int // the latest expected version
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		workers: make(map[int]plan.PeerList),
+		phases:  make(map[int]map[plan.PeerID]Phase),
+	}
+}
+
+// Expect starts tracking a cluster version, the versions before the previous one are forgotten
+func (t *Tracker) Expect(version int, workers plan.PeerList) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.workers) == 0 || version > t.expected {
+		t.expected = version
+	}
+	t.workers[version] = workers
+	for v := range t.workers {
+		if v < t.expected-1 {
+			delete(t.workers, v)
+		}
+	}
+	for v := range t.phases {
+		if v < t.expected-1 {
+			delete(t.phases, v)
+		}
+	}
+}
+
+// Record records a reported phase, unless the peer has reported a later phase of the same version
+func (t *Tracker) Record(r Report) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if r.Phase.order() < 0 {
+		return
+	}
+	phases, ok := t.phases[r.Version]
+	if !ok {
+		phases = make(map[plan.PeerID]Phase)
+		t.phases[r.Version] = phases
+	}
+	if p, ok := phases[r.Peer]; !ok || p.order() < r.Phase.order() {
+		phases[r.Peer] = r.Phase
+	}
+}
+
+// Latest returns the version expected last
+func (t *Tracker) Latest() (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.workers[t.expected]
+	return t.expected, ok
+}
+
+// Progress returns the progress of an expected version
+func (t *Tracker) Progress(version int) (Progress, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	workers, ok := t.workers[version]
+	if !ok {
+		return Progress{}, false
+	}
+	p := Progress{Version: version, Total: len(workers), Phases: make(map[Phase]int)}
+	pending := make(map[uint32]int)
+	for _, id := range workers {
+		phase, ok := t.phases[version][id]
+		if ok {
+			p.Registered++
+			p.Phases[phase]++
+		}
+		if phase != Ready {
+			pending[id.IPv4]++
+		}
+	}
+	for ipv4, n := range pending {
+		p.Pending = append(p.Pending, HostProgress{Host: plan.FormatIPv4(ipv4), Pending: n})
+	}
+	sort.Slice(p.Pending, func(i, j int) bool {
+		if a, b := p.Pending[i], p.Pending[j]; a.Pending != b.Pending {
+			return a.Pending > b.Pending
+		}
+		return p.Pending[i].Host < p.Pending[j].Host
+	})
+	return p, true
+}
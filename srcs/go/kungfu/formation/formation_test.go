@@ -0,0 +1,52 @@
+package formation
+
+import (
+	"testing"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+func Test_Tracker(t *testing.T) {
+	var workers plan.PeerList
+	for host := uint32(1); host <= 3; host++ {
+		for i := 0; i < 2; i++ {
+			workers = append(workers, plan.PeerID{IPv4: host, Port: uint16(10000 + i)})
+		}
+	}
+	tr := NewTracker()
+	tr.Record(Report{Peer: workers[0], Version: 1, Phase: Ready}) // before expected
+	tr.Expect(1, workers)
+	tr.Record(Report{Peer: workers[1], Version: 1, Phase: Exchanging})
+	tr.Record(Report{Peer: workers[1], Version: 1, Phase: Connecting}) // out of order
+	tr.Record(Report{Peer: workers[2], Version: 1, Phase: Ready})
+	tr.Record(Report{Peer: workers[3], Version: 1, Phase: Ready})
+	tr.Record(Report{Peer: workers[4], Version: 0, Phase: Ready})
+	p, ok := tr.Progress(1)
+	if !ok {
+		t.Fatal("version not expected")
+	}
+	if p.Done() || p.Registered != 4 || p.Phases[Ready] != 3 || p.Phases[Exchanging] != 1 {
+		t.Errorf("unexpected progress %+v", p)
+	}
+	if len(p.Pending) != 2 || p.Pending[0].Host != "0.0.0.3" || p.Pending[0].Pending != 2 || p.Pending[1].Pending != 1 {
+		t.Errorf("unexpected pending hosts %+v", p.Pending)
+	}
+	want := "v1: 3/6 peers ready, 1 exchanging, 2 not registered, pending hosts: 0.0.0.3 (2), 0.0.0.1 (1)"
+	if s := p.String(); s != want {
+		t.Errorf("got %q, want %q", s, want)
+	}
+	for _, id := range workers {
+		tr.Record(Report{Peer: id, Version: 1, Phase: Ready})
+	}
+	if p, _ := tr.Progress(1); !p.Done() || len(p.Pending) != 0 {
+		t.Errorf("unexpected progress %+v", p)
+	}
+	tr.Expect(2, workers)
+	tr.Expect(3, workers)
+	if _, ok := tr.Progress(1); ok {
+		t.Errorf("old version not forgotten")
+	}
+	if v, ok := tr.Latest(); !ok || v != 3 {
+		t.Errorf("Latest() = %d, %v", v, ok)
+	}
+}
@@ -0,0 +1,148 @@
+package job
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+var errProgramCheck = errors.New("programs can't be started")
+
+// ProgramCheckError lists all the problems of starting the programs of a job on a host
+type ProgramCheckError struct {
+	Problems []string
+}
+
+func (e *ProgramCheckError) Error() string {
+	return fmt.Sprintf("%v:\n\t%s", errProgramCheck, strings.Join(e.Problems, "\n\t"))
+}
+
+// CheckPrograms checks that the programs of the peers of cluster on host can be started in the working directory:
+// it exists, each program is found and executable, so is the interpreter of a script, and so is the script run by python.
+// It returns a *ProgramCheckError of all the problems found, so that they are reported at once before any peer is started.
+func (j Job) CheckPrograms(cluster plan.Cluster, host uint32) error {
+	var problems []string
+	if len(j.Dir) > 0 {
+		if info, err := os.Stat(j.Dir); err != nil {
+			problems = append(problems, fmt.Sprintf("working directory: %v", err))
+		} else if !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("working directory %s is not a directory", j.Dir))
+		}
+	}
+	checked := make(map[string]bool)
+	for _, p := range cluster.Workers.On(host) {
+		rank, _ := cluster.Workers.Rank(p)
+		prog, _ := j.programOf(rank, len(cluster.Workers))
+		cmd := strings.Join(append([]string{prog.Prog}, prog.Args...), " ")
+		if checked[cmd] {
+			continue
+		}
+		checked[cmd] = true
+		pathEnv := os.Getenv(`PATH`)
+		if val, ok := prog.Envs[`PATH`]; ok {
+			pathEnv = val
+		}
+		problems = append(problems, j.checkProgram(prog.Prog, prog.Args, pathEnv)...)
+	}
+	if len(problems) > 0 {
+		return &ProgramCheckError{Problems: problems}
+	}
+	return nil
+}
+
+func (j Job) checkProgram(prog string, args []string, pathEnv string) []string {
+	file, err := j.lookPath(prog, pathEnv)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var problems []string
+	if interp, ok := readShebang(file); ok {
+		if _, err := j.lookPath(interp, pathEnv); err != nil {
+			problems = append(problems, fmt.Sprintf("interpreter of %s: %v", prog, err))
+		}
+	}
+	if strings.HasPrefix(filepath.Base(prog), `python`) && len(args) > 0 && !strings.HasPrefix(args[0], `-`) {
+		script := args[0]
+		if !filepath.IsAbs(script) {
+			script = filepath.Join(j.Dir, script)
+		}
+		if _, err := os.Stat(script); err != nil {
+			problems = append(problems, fmt.Sprintf("script of %s: %v", prog, err))
+		}
+	}
+	return problems
+}
+
+// lookPath finds the executable file of prog, in the working directory if it has a slash, or else in pathEnv
+func (j Job) lookPath(prog, pathEnv string) (string, error) {
+	if strings.Contains(prog, `/`) {
+		file := prog
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(j.Dir, file)
+		}
+		if err := checkExecutable(file); err != nil {
+			return "", fmt.Errorf("%s: %v", prog, err)
+		}
+		return file, nil
+	}
+	for _, dir := range filepath.SplitList(pathEnv) {
+		if len(dir) == 0 {
+			dir = "."
+		}
+		file := filepath.Join(dir, prog)
+		if checkExecutable(file) == nil {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("%s: not found in PATH=%s", prog, pathEnv)
+}
+
+var (
+	errNotRegular    = errors.New("not a regular file")
+	errNotExecutable = errors.New("not executable")
+)
+
+func checkExecutable(file string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return errNotRegular
+	}
+	if info.Mode().Perm()&0111 == 0 {
+		return errNotExecutable
+	}
+	return nil
+}
+
+// readShebang returns the interpreter of the #! line of file, the program run by /usr/bin/env if it is used
+func readShebang(file string) (string, bool) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if (err != nil && len(line) == 0) || !strings.HasPrefix(line, `#!`) {
+		return "", false
+	}
+	fields := strings.Fields(strings.TrimPrefix(line, `#!`))
+	if len(fields) == 0 {
+		return "", false
+	}
+	if filepath.Base(fields[0]) != `env` {
+		return fields[0], true
+	}
+	for _, f := range fields[1:] {
+		if !strings.HasPrefix(f, `-`) {
+			return f, true
+		}
+	}
+	return "", false
+}
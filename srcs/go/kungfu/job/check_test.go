@@ -0,0 +1,51 @@
+package job
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+func Test_CheckPrograms(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kungfu-check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]struct {
+		text string
+		mode os.FileMode
+	}{
+		"ok.sh":      {"#!/bin/sh\n", 0755},
+		"missing.sh": {"#!/usr/bin/env -S kungfu-no-such-interpreter\n", 0755},
+		"plain.sh":   {"#!/bin/sh\n", 0644},
+	}
+	for name, f := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(f.text), f.mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hl := plan.HostList{{IPv4: plan.MustParseIPv4("127.0.0.1"), Slots: 4}}
+	cluster := plan.Cluster{Workers: hl.MustGenPeerList(4, plan.DefaultPortRange)}
+	host := hl[0].IPv4
+	j := Job{Prog: "./ok.sh", Dir: dir}
+	if err := j.CheckPrograms(cluster, host); err != nil {
+		t.Errorf("unexpected problems: %v", err)
+	}
+	j.Programs = []Program{
+		{Count: 1, Prog: "./missing.sh"},
+		{Count: 1, Prog: "./plain.sh"},
+		{Count: 1, Prog: "kungfu-no-such-program"},
+	}
+	err = j.CheckPrograms(cluster, host)
+	if e, ok := err.(*ProgramCheckError); !ok || len(e.Problems) != 3 {
+		t.Errorf("should report all problems, got: %v", err)
+	}
+	j = Job{Prog: "./ok.sh", Dir: filepath.Join(dir, "no-such-dir")}
+	if err := j.CheckPrograms(cluster, host); err == nil {
+		t.Errorf("missing working directory should be reported")
+	}
+}
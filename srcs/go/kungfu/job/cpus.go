@@ -0,0 +1,44 @@
+package job
+
+import (
+	"os/exec"
+	"runtime"
+	"sync"
+
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/utils/cpuset"
+)
+
+var (
+	tasksetOnce sync.Once
+	hasTaskset  bool
+)
+
+// pinCores wraps prog by taskset to run on the cores of peer in the partition of this host among its local peers
+func pinCores(peer plan.PeerID, peers plan.PeerList, reserved int, prog string, args []string) (string, []string) {
+	localRank, ok := peers.LocalRank(peer)
+	if !ok {
+		return prog, args
+	}
+	tasksetOnce.Do(func() {
+		_, err := exec.LookPath(`taskset`)
+		if hasTaskset = err == nil; !hasTaskset {
+			log.Warnf("peers are not pinned to cores: %v", err)
+		}
+	})
+	if !hasTaskset {
+		return prog, args
+	}
+	cpus := cpuset.Partition(cpuset.Nodes(), peers.LocalSize(peer), reserved)[localRank]
+	log.Debugf("pinning %s to cores %s", peer, cpus)
+	return `taskset`, append([]string{`-c`, cpus.String(), prog}, args...)
+}
+
+// cpuShare returns the number of CPUs of this host for each of its n local peers
+func cpuShare(n int) int {
+	if share := runtime.NumCPU() / n; share > 1 {
+		return share
+	}
+	return 1
+}
@@ -2,8 +2,10 @@ package job
 
 import (
 	"fmt"
+	"math/rand"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lsds/KungFu/srcs/go/kungfu/base"
@@ -15,17 +17,56 @@ import (
 )
 
 type Job struct {
-	StartTime    time.Time
-	ConfigServer string
-	Strategy     base.Strategy
-	Parent       plan.PeerID
-	HostList     plan.HostList
-	PortRange    plan.PortRange
-	Prog         string
-	Args         []string
-	LogDir       string
+	ID              string // the ranks of hosts are kept across runs of the same ID, see runner.RankStore
+	RankStore       string // directory of the runner.RankStore of each host, the default if empty
+	StartTime       time.Time
+	ConfigServer    string
+	Strategy        base.Strategy
+	StrategyOptions base.StrategyOptions
+	Parent          plan.PeerID
+	HostList        plan.HostList
+	PortRange       plan.PortRange
+	Constraints     plan.Constraints
+	RankMap         plan.RankMap // pins initial ranks to hosts and GPUs, overriding Constraints
+	Prog            string
+	Binaries        Binaries // Prog built for other platforms, selected by the runner of each host
+	Args            []string
+	Envs            proc.Envs // extra environment variables of the main program
+	LogDir          string
+	Dir             string // working directory of peers, that of the runner if empty
+	EnvProbe        string // shell command listing the packages in the environment of a worker, e.g. pip freeze, saved to LogDir with the environment
+
+	Role     string
+	Programs []Program
 
 	AllowNVLink bool
+
+	StartStagger time.Duration // each peer is started after a random delay up to this, so that large clusters don't connect all at once
+
+	PinCores      bool // pin peers sharing a host to disjoint cores by taskset
+	ReservedCores int  // cores of each NUMA node shared by the pinned peers, for the goroutines of rchannel
+
+	Oversubscribe int // ranks sharing each slot of a host, which take turns in their steps, 0 or 1 if slots are not shared
+
+	LeasePeriod       time.Duration       // peers must renew their leases with the parent within this period, 0 to disable
+	RescheduleEvicted bool                // move the rank of an evicted peer to another host, instead of shrinking the cluster
+	DegradedPolicy    plan.DegradedPolicy // what happens to a peer reporting its GPU unavailable, empty for plan.DegradedEvict
+	TelemetryPeriod   time.Duration       // runners report free resources of their hosts to the config server in this period, 0 to disable
+	LinkProbePeriod   time.Duration       // runners probe the link to one of the other runners in this period while idle, 0 to disable
+	JobQuota          int                 // jobs each user may have queued or running on the REST API of a runner, 0 for unlimited
+	JobTokens         string              // file of the users and their tokens accepted by the REST API of a runner for jobs, which are not accepted if empty
+
+	MaxClockSkew        time.Duration // runners check the clocks of each other once serving, 0 to skip the check
+	RequireSyncedClocks bool          // runners fail if a clock is skewed more than MaxClockSkew, instead of warning
+
+	Seed     uint64   // per-rank random seeds are derived from it
+	LogSinks []string // URLs of log sinks of peers, see log.OpenSink
+	Webhooks []string // fired by runners on cluster events, see runner.ParseWebhook
+
+	PerfReport bool // peers log the GC and allocation activity of their Go layer at exit
+	GCPercent  int  // GOGC of peers, 0 for the default
+
+	PreferFamily int // address family peers dial first, 4 or 6, 0 for the default
 }
 
 func (j Job) NewProc(peer plan.PeerID, gpuID int, initClusterVersion int, cluster plan.Cluster) proc.Proc {
@@ -37,14 +78,59 @@ func (j Job) NewProc(peer plan.PeerID, gpuID int, initClusterVersion int, cluste
 		env.ParentIDEnvKey:           j.Parent.String(),
 		env.PeerListEnvKey:           cluster.Workers.String(),
 		env.InitClusterVersionEnvKey: strconv.Itoa(initClusterVersion),
-		env.AllReduceStrategyEnvKey:  j.Strategy.String(),
+		env.AllReduceStrategyEnvKey:  j.StrategySpec(),
 		env.ConfigServerEnvKey:       j.ConfigServer,
 		env.AllowNvLink:              fmt.Sprintf("%v", j.AllowNVLink),
 	}
+	rank, _ := cluster.Workers.Rank(peer)
+	envs[env.SeedEnvKey] = strconv.FormatUint(j.Seed, 10)
+	envs[env.RankSeedEnvKey] = strconv.FormatUint(DeriveSeed(j.Seed, initClusterVersion, rank), 10)
+	prog, roleRank := j.programOf(rank, len(cluster.Workers))
+	if len(prog.Role) > 0 {
+		envs[env.RoleEnvKey] = prog.Role
+		envs[env.RoleRankEnvKey] = strconv.Itoa(roleRank)
+	}
+	if l := j.RoleLayout(); l != nil {
+		envs[env.RoleLayoutEnvKey] = l.String()
+	}
 	if len(j.ConfigServer) > 0 {
 		envs[env.ConfigServerEnvKey] = j.ConfigServer
 	}
+	if len(j.LogSinks) > 0 {
+		envs[config.LogSinksEnvKey] = strings.Join(j.LogSinks, ",")
+	}
+	if j.PerfReport {
+		envs[config.PerfReportEnvKey] = `true`
+	}
+	if j.GCPercent > 0 {
+		envs[`GOGC`] = strconv.Itoa(j.GCPercent)
+	}
+	if addrs := j.HostList.PublicAddrs(); len(addrs) > 0 {
+		envs[env.HostAddrsEnvKey] = addrs.String()
+	}
+	if j.PreferFamily > 0 {
+		envs[config.PreferFamilyEnvKey] = strconv.Itoa(j.PreferFamily)
+	}
+	if j.LeasePeriod > 0 {
+		envs[env.LeasePeriodEnvKey] = j.LeasePeriod.String()
+	}
+	if !j.Constraints.IsEmpty() {
+		envs[env.HostListEnvKey] = j.HostList.String()
+		envs[env.RequireEnvKey] = j.Constraints.Require.String()
+		envs[env.SpreadAcrossEnvKey] = j.Constraints.SpreadAcross
+	}
+	if len(j.DegradedPolicy) > 0 {
+		envs[env.DegradedPolicyEnvKey] = j.DegradedPolicy.String()
+	}
+	if j.Oversubscribe > 1 {
+		localRank, _ := cluster.Workers.LocalRank(peer)
+		gpuID = j.slotOf(gpuID)
+		envs[env.TimeShareEnvKey] = env.TimeShare{Turn: localRank % j.Oversubscribe, Turns: j.Oversubscribe}.String()
+	}
 	cudaIdx := strconv.Itoa(getCudaIndex(gpuID))
+	if gpu, ok := j.RankMap.GPUOf(rank, peer.IPv4); ok {
+		cudaIdx = strconv.Itoa(gpu)
+	}
 	envs[`KUNGFU_`+cudaVisibleDevicesKey] = cudaIdx
 	if j.AllowNVLink {
 		log.Warnf("Please set `config.gpu_options.visible_device_list = str(local_rank)`")
@@ -52,8 +138,14 @@ func (j Job) NewProc(peer plan.PeerID, gpuID int, initClusterVersion int, cluste
 		envs[cudaVisibleDevicesKey] = cudaIdx
 	}
 
-	allEnvs := proc.Merge(getConfigEnvs(), envs)
+	allEnvs := proc.Merge(proc.Merge(getConfigEnvs(), prog.Envs), envs)
 	allEnvs.AddIfMissing(`PYTHONUNBUFFERED`, `1`)
+	if j.Oversubscribe > 1 {
+		// the peers sharing the host split its CPUs, unless told otherwise
+		share := strconv.Itoa(cpuShare(cluster.Workers.LocalSize(peer)))
+		allEnvs.AddIfMissing(`GOMAXPROCS`, share)
+		allEnvs.AddIfMissing(`OMP_NUM_THREADS`, share)
+	}
 	var pubAddr string
 	for _, h := range j.HostList {
 		if h.IPv4 == peer.IPv4 {
@@ -61,14 +153,51 @@ func (j Job) NewProc(peer plan.PeerID, gpuID int, initClusterVersion int, cluste
 		}
 	}
 
+	progName, args := prog.Prog, prog.Args
+	if j.PinCores {
+		progName, args = pinCores(peer, cluster.Workers, j.ReservedCores, progName, args)
+	}
 	return proc.Proc{
 		Name:     fmt.Sprintf("%s.%d", plan.FormatIPv4(peer.IPv4), peer.Port),
-		Prog:     j.Prog,
-		Args:     j.Args,
+		Prog:     progName,
+		Args:     args,
 		Envs:     allEnvs,
 		Hostname: pubAddr,
 		LogDir:   j.LogDir,
+		Dir:      j.Dir,
+		Delay:    j.startDelay(),
+	}
+}
+
+// StrategySpec returns the strategy of the job followed by its options
+func (j Job) StrategySpec() string {
+	return base.FormatStrategySpec(j.Strategy, j.StrategyOptions)
+}
+
+func (j Job) startDelay() time.Duration {
+	if j.StartStagger <= 0 {
+		return 0
 	}
+	return time.Duration(rand.Int63n(int64(j.StartStagger)))
+}
+
+// RankAssignments describes where the ranks of cluster run, with the GPUs given to them by NewProc on this host
+func (j Job) RankAssignments(cluster plan.Cluster) []plan.RankAssignment {
+	return j.HostList.Assign(cluster.Workers, func(rank int, p plan.PeerID) int {
+		if gpu, ok := j.RankMap.GPUOf(rank, p.IPv4); ok {
+			return gpu
+		}
+		localRank, _ := cluster.Workers.LocalRank(p)
+		return getCudaIndex(j.slotOf(localRank))
+	})
+}
+
+// slotOf returns the slot shared by the local rank, which is the local rank unless the host is oversubscribed
+func (j Job) slotOf(localRank int) int {
+	if j.Oversubscribe > 1 {
+		return localRank / j.Oversubscribe
+	}
+	return localRank
 }
 
 func (j Job) CreateProcs(cluster plan.Cluster, host uint32) []proc.Proc {
@@ -84,6 +213,10 @@ func (j Job) CreateProcs(cluster plan.Cluster, host uint32) []proc.Proc {
 func (j Job) ProgAndArgs() []string {
 	a := []string{j.Prog}
 	a = append(a, j.Args...)
+	for _, p := range j.Programs {
+		a = append(a, ProgramSeparator)
+		a = append(a, p.Flags()...)
+	}
 	return a
 }
 
@@ -98,5 +231,15 @@ func getConfigEnvs() proc.Envs {
 }
 
 func (j Job) DebugString() string {
+	if len(j.Programs) > 0 || len(j.Binaries) > 0 {
+		s := fmt.Sprintf("job{prog=%s, args=%q", j.Prog, j.Args)
+		if len(j.Binaries) > 0 {
+			s += fmt.Sprintf(", binaries=%s", j.Binaries)
+		}
+		for _, p := range j.Programs {
+			s += ", " + p.DebugString()
+		}
+		return s + "}"
+	}
 	return fmt.Sprintf("job{prog=%s, args=%q}", j.Prog, j.Args)
 }
@@ -0,0 +1,70 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// LocalPlatform returns the <os>/<arch> of this host, e.g. linux/amd64, darwin/arm64
+func LocalPlatform() string {
+	return runtime.GOOS + "/" + runtime.GOARCH
+}
+
+// Binaries are builds of the main program for hosts of other platforms, keyed by <os>/<arch>,
+// so that a cluster can mix e.g. Apple Silicon dev boxes and x86 cloud nodes
+type Binaries map[string]string
+
+var errInvalidBinary = errors.New("invalid binary, expect <os>/<arch>=<path>")
+
+func (b Binaries) String() string {
+	var kvs []string
+	for _, p := range b.platforms() {
+		kvs = append(kvs, p+"="+b[p])
+	}
+	return strings.Join(kvs, ",")
+}
+
+// Set implements flags.Value::Set
+func (b *Binaries) Set(val string) error {
+	parts := strings.SplitN(val, "=", 2)
+	if len(parts) != 2 || len(parts[1]) == 0 {
+		return fmt.Errorf("%v: %q", errInvalidBinary, val)
+	}
+	if p := strings.Split(parts[0], "/"); len(p) != 2 || len(p[0]) == 0 || len(p[1]) == 0 {
+		return fmt.Errorf("%v: %q", errInvalidBinary, val)
+	}
+	if *b == nil {
+		*b = make(Binaries)
+	}
+	(*b)[parts[0]] = parts[1]
+	return nil
+}
+
+func (b Binaries) platforms() []string {
+	var ps []string
+	for p := range b {
+		ps = append(ps, p)
+	}
+	sort.Strings(ps)
+	return ps
+}
+
+// Flags returns the -prog-for flags of kungfu-run
+func (b Binaries) Flags() []string {
+	var args []string
+	for _, p := range b.platforms() {
+		args = append(args, `-prog-for`, p+"="+b[p])
+	}
+	return args
+}
+
+// Select returns the binary for the platform, or prog if there is none
+func (b Binaries) Select(prog string, platform string) string {
+	if bin, ok := b[platform]; ok {
+		return bin
+	}
+	return prog
+}
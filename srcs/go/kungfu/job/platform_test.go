@@ -0,0 +1,26 @@
+package job
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_Binaries(t *testing.T) {
+	var b Binaries
+	for _, val := range []string{"linux/amd64=./train", "darwin/arm64=./train-mac"} {
+		if err := b.Set(val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, val := range []string{"linux=./train", "linux/amd64=", "/arm64=./x", "./train"} {
+		if err := b.Set(val); err == nil {
+			t.Errorf("%q should be invalid", val)
+		}
+	}
+	if got := strings.Join(b.Flags(), " "); got != "-prog-for darwin/arm64=./train-mac -prog-for linux/amd64=./train" {
+		t.Errorf("unexpected flags: %s", got)
+	}
+	if b.Select("python3", "darwin/arm64") != "./train-mac" || b.Select("python3", "windows/amd64") != "python3" {
+		t.Errorf("unexpected selection")
+	}
+}
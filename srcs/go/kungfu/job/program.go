@@ -0,0 +1,73 @@
+package job
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/proc"
+)
+
+// ProgramSeparator separates the program sections of a MPMD job, like `prog1 : prog2` of mpirun
+const ProgramSeparator = `:`
+
+// Program is an additional program section of a MPMD job
+type Program struct {
+	Role  string
+	Count int
+	Prog  string
+	Args  []string
+	Envs  proc.Envs
+}
+
+// Flags returns the command line of the program section
+func (p Program) Flags() []string {
+	args := []string{`-np`, strconv.Itoa(p.Count)}
+	if len(p.Role) > 0 {
+		args = append(args, `-role`, p.Role)
+	}
+	for _, kv := range p.Envs.Assignments() {
+		args = append(args, `-env`, kv)
+	}
+	args = append(args, p.Prog)
+	return append(args, p.Args...)
+}
+
+func (p Program) DebugString() string {
+	return fmt.Sprintf("program{role=%s, np=%d, prog=%s, args=%q}", p.Role, p.Count, p.Prog, p.Args)
+}
+
+// programOf returns the program of the given rank and the rank among peers of the same program.
+// The additional programs take the last ranks, and the main program takes the rest.
+func (j Job) programOf(rank, size int) (Program, int) {
+	main := Program{Role: j.Role, Prog: j.Binaries.Select(j.Prog, LocalPlatform()), Args: j.Args, Envs: j.Envs}
+	offset := size
+	for _, p := range j.Programs {
+		offset -= p.Count
+	}
+	if rank < offset {
+		main.Count = offset
+		return main, rank
+	}
+	for _, p := range j.Programs {
+		if rank < offset+p.Count {
+			return p, rank - offset
+		}
+		offset += p.Count
+	}
+	return main, rank
+}
+
+// RoleLayout returns the roles of ranks, or nil if no program section has a role
+func (j Job) RoleLayout() *plan.RoleLayout {
+	l := plan.RoleLayout{Main: j.Role}
+	named := len(j.Role) > 0
+	for _, p := range j.Programs {
+		l.Sections = append(l.Sections, plan.RoleSection{Role: p.Role, Count: p.Count})
+		named = named || len(p.Role) > 0
+	}
+	if !named {
+		return nil
+	}
+	return &l
+}
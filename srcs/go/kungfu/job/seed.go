@@ -0,0 +1,17 @@
+package job
+
+// DeriveSeed derives the random seed of a rank in a cluster version from the job seed,
+// different ranks of the same version always get different seeds.
+func DeriveSeed(seed uint64, version, rank int) uint64 {
+	x := splitmix64(seed)
+	x = splitmix64(x + uint64(version))
+	return splitmix64(x + uint64(rank))
+}
+
+// splitmix64 is a bijection on uint64
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
@@ -0,0 +1,25 @@
+package job
+
+import "testing"
+
+func Test_DeriveSeed(t *testing.T) {
+	const np = 1024
+	for _, seed := range []uint64{0, 1, 42} {
+		for version := 0; version < 4; version++ {
+			seen := make(map[uint64]int)
+			for rank := 0; rank < np; rank++ {
+				s := DeriveSeed(seed, version, rank)
+				if r, ok := seen[s]; ok {
+					t.Errorf("seed %d version %d: rank %d and %d got the same seed", seed, version, r, rank)
+				}
+				seen[s] = rank
+			}
+		}
+	}
+	if DeriveSeed(1, 0, 0) == DeriveSeed(1, 1, 0) {
+		t.Errorf("seed should change with version")
+	}
+	if DeriveSeed(1, 0, 0) != DeriveSeed(1, 0, 0) {
+		t.Errorf("seed should be deterministic")
+	}
+}
@@ -0,0 +1,357 @@
+// Package kungfu is the collective API for Go programs launched by kungfu-run.
+//
+// Collectives are matched across peers by the order of calls, so all peers must
+// call them in the same order, as with MPI. The calls are counted from 0 again in each new session after a resize.
+package kungfu
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/kungfu/peer"
+	"github.com/lsds/KungFu/srcs/go/kungfu/throughput"
+	"github.com/lsds/KungFu/srcs/go/kungfu/tunables"
+)
+
+// Reduction operators of AllReduce
+const (
+	SUM  = kb.SUM
+	MIN  = kb.MIN
+	MAX  = kb.MAX
+	PROD = kb.PROD
+	LAND = kb.LAND
+	LOR  = kb.LOR
+)
+
+var (
+	errNotInitialized     = errors.New("kungfu is not initialized")
+	errAlreadyInitialized = errors.New("kungfu is already initialized")
+)
+
+var (
+	mu          sync.Mutex
+	defaultPeer *peer.Peer
+)
+
+// Init joins the cluster configured by kungfu-run, a single peer cluster is created if not launched by kungfu-run
+func Init() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if defaultPeer != nil {
+		return errAlreadyInitialized
+	}
+	p, err := peer.New()
+	if err != nil {
+		return err
+	}
+	if err := p.Start(); err != nil {
+		return err
+	}
+	defaultPeer = p
+	return nil
+}
+
+// Finalize leaves the cluster
+func Finalize() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if defaultPeer == nil {
+		return errNotInitialized
+	}
+	err := defaultPeer.Close()
+	defaultPeer = nil
+	return err
+}
+
+// Peer returns the underlying peer for APIs not covered by this package, e.g. resizing
+func Peer() *peer.Peer {
+	mu.Lock()
+	defer mu.Unlock()
+	return defaultPeer
+}
+
+func Rank() int {
+	return mustPeer().CurrentSession().Rank()
+}
+
+func ClusterSize() int {
+	return mustPeer().CurrentSession().Size()
+}
+
+func LocalRank() int {
+	return mustPeer().CurrentSession().LocalRank()
+}
+
+func LocalSize() int {
+	return mustPeer().CurrentSession().LocalSize()
+}
+
+// Barrier blocks until all peers have called it
+func Barrier() error {
+	p, err := getPeer()
+	if err != nil {
+		return err
+	}
+	return p.CurrentSession().Barrier()
+}
+
+// NamedBarrier blocks until all peers have called it with the same name, or fails with a *session.BarrierError
+// telling which ranks didn't arrive in time
+func NamedBarrier(name string, timeout time.Duration) error {
+	p, err := getPeer()
+	if err != nil {
+		return err
+	}
+	return p.CurrentSession().NamedBarrier(name, timeout)
+}
+
+// StepFence must be called by all peers once per step, it blocks while the job is paused by kungfu-ctl
+func StepFence() error {
+	p, err := getPeer()
+	if err != nil {
+		return err
+	}
+	return p.StepFence()
+}
+
+// BeginStep marks the start of a step, the cluster doesn't change until EndStep
+func BeginStep() error {
+	p, err := getPeer()
+	if err != nil {
+		return err
+	}
+	return p.BeginStep()
+}
+
+// EndStep must be called by all peers at the end of each step, it runs StepFence,
+// and applies the cluster changes of the config server, it returns whether the cluster changed and this peer is detached
+func EndStep() (bool, bool, error) {
+	p, err := getPeer()
+	if err != nil {
+		return false, false, err
+	}
+	return p.EndStep()
+}
+
+// MigrateRank must be called by all peers out of steps, it moves the peer of given rank to host, where a new peer takes over its state.
+// It returns whether the cluster changed and this peer is detached, as EndStep.
+func MigrateRank(rank int, host string) (bool, bool, error) {
+	p, err := getPeer()
+	if err != nil {
+		return false, false, err
+	}
+	return p.MigrateRank(rank, host)
+}
+
+// DeclareTensor declares a tensor to be reduced under name, see CheckTensorSchema
+func DeclareTensor(name string, dtype kb.DataType, shape []int) error {
+	p, err := getPeer()
+	if err != nil {
+		return err
+	}
+	return p.DeclareTensor(name, dtype, shape)
+}
+
+// CheckTensorSchema must be called by all peers, it fails with the name of a tensor declared differently by peers
+func CheckTensorSchema() error {
+	p, err := getPeer()
+	if err != nil {
+		return err
+	}
+	return p.CheckTensorSchema()
+}
+
+// AllReduce reduces x of all peers with op in place
+func AllReduce(x []float32, op kb.OP) error {
+	return AllReduceOnStream("", x, op)
+}
+
+// AllReduceOnStream is AllReduce on the named stream, collectives of different streams can be called concurrently,
+// e.g. for gradients and EMA weights, and their chunks are sent in turn. They are matched by the order of calls in each stream.
+func AllReduceOnStream(stream string, x []float32, op kb.OP) error {
+	p, err := getPeer()
+	if err != nil {
+		return err
+	}
+	v := kb.VectorF32(x)
+	w := kb.Workspace{SendBuf: v, RecvBuf: v, OP: op, Name: nextName(p, "allreduce", stream), Stream: stream}
+	return p.CurrentSession().AllReduce(w)
+}
+
+// PrivateAllReduce sums x of all peers in place, the contribution of each peer is clipped and noised if KUNGFU_CONFIG_DP_EPSILON is set,
+// see privacy.Gaussian. A step should call it KUNGFU_CONFIG_DP_TENSORS times at most.
+func PrivateAllReduce(x []float32) error {
+	p, err := getPeer()
+	if err != nil {
+		return err
+	}
+	v := kb.VectorF32(x)
+	w := kb.Workspace{SendBuf: v, RecvBuf: v, OP: kb.SUM, Name: config.DPPrefix + nextName(p, "private-allreduce", "")}
+	return p.CurrentSession().AllReduce(w)
+}
+
+// Broadcast overwrites x with that of rank 0
+func Broadcast(x []float32) error {
+	return BroadcastOnStream("", x)
+}
+
+// BroadcastOnStream is Broadcast on the named stream, see AllReduceOnStream
+func BroadcastOnStream(stream string, x []float32) error {
+	p, err := getPeer()
+	if err != nil {
+		return err
+	}
+	v := kb.VectorF32(x)
+	w := kb.Workspace{SendBuf: v, RecvBuf: v, Name: nextName(p, "broadcast", stream), Stream: stream}
+	return p.CurrentSession().Broadcast(w)
+}
+
+// Role returns the role of the current rank assigned by the job, e.g. trainer or evaluator
+func Role() string {
+	role, _ := mustPeer().Role()
+	return role
+}
+
+// RoleRank returns the rank among peers of the same role
+func RoleRank() int {
+	_, rank := mustPeer().Role()
+	return rank
+}
+
+// RoleSize returns the number of peers of the same role
+func RoleSize() int {
+	return len(mustPeer().RoleRanks())
+}
+
+// RoleAllReduce reduces x of peers of the same role with op in place
+func RoleAllReduce(x []float32, op kb.OP) error {
+	p, err := getPeer()
+	if err != nil {
+		return err
+	}
+	v := kb.VectorF32(x)
+	w := kb.Workspace{SendBuf: v, RecvBuf: v, OP: op, Name: nextName(p, "role-allreduce", "")}
+	return p.CurrentSession().GroupAllReduce(p.RoleRanks(), w)
+}
+
+// RoleBroadcast overwrites x with that of role rank 0
+func RoleBroadcast(x []float32) error {
+	p, err := getPeer()
+	if err != nil {
+		return err
+	}
+	v := kb.VectorF32(x)
+	w := kb.Workspace{SendBuf: v, RecvBuf: v, Name: nextName(p, "role-broadcast", "")}
+	return p.CurrentSession().GroupBroadcast(p.RoleRanks(), w)
+}
+
+// PSInit creates the named tensor on the parameter servers as x if it doesn't exist, see package ps
+func PSInit(name string, x []float32) error {
+	p, err := getPeer()
+	if err != nil {
+		return err
+	}
+	return p.PSInit(name, kb.VectorF32(x))
+}
+
+// PSPush reduces x into the named tensor on the parameter servers by op, pushes are sent in the background until PSFlush
+func PSPush(name string, x []float32, op kb.OP) error {
+	p, err := getPeer()
+	if err != nil {
+		return err
+	}
+	return p.PSPush(name, kb.VectorF32(x), op)
+}
+
+// PSFlush waits for the pushes of this peer to be applied by the parameter servers
+func PSFlush() error {
+	p, err := getPeer()
+	if err != nil {
+		return err
+	}
+	return p.PSFlush()
+}
+
+// PSPull overwrites x with the named tensor on the parameter servers, after the pushes of this peer are applied
+func PSPull(name string, x []float32) error {
+	p, err := getPeer()
+	if err != nil {
+		return err
+	}
+	return p.PSPull(name, kb.VectorF32(x))
+}
+
+// PSStop stops the parameter servers at the next EndStep
+func PSStop() error {
+	p, err := getPeer()
+	if err != nil {
+		return err
+	}
+	p.PSStop()
+	return nil
+}
+
+// ServePS serves the shards of a server rank until the workers call PSStop, servers must follow the steps of the workers
+func ServePS() error {
+	p, err := getPeer()
+	if err != nil {
+		return err
+	}
+	return p.ServePS()
+}
+
+// KVPut sets the key in the cluster metadata store, which survives resizes, kungfu-run must be in watch mode
+func KVPut(key string, value []byte) error {
+	p, err := getPeer()
+	if err != nil {
+		return err
+	}
+	return p.KVPut(key, value)
+}
+
+// KVGet returns the value of the key in the cluster metadata store
+func KVGet(key string) ([]byte, bool) {
+	return mustPeer().KVGet(key)
+}
+
+// AddSamples counts the samples processed in the current step, for the global throughput measured every KUNGFU_CONFIG_THROUGHPUT_PERIOD steps
+func AddSamples(n int) {
+	mustPeer().AddSamples(n)
+}
+
+// Throughputs returns the latest global throughput of each of the latest cluster versions, measured at the same steps by all peers
+func Throughputs() []throughput.Snapshot {
+	return mustPeer().Throughputs()
+}
+
+// Tunables returns the runtime knobs in effect, which are changed by kungfu-ctl tune at StepFence
+func Tunables() tunables.Tunables {
+	return mustPeer().Tunables()
+}
+
+func getPeer() (*peer.Peer, error) {
+	if p := Peer(); p != nil {
+		return p, nil
+	}
+	return nil, errNotInitialized
+}
+
+func mustPeer() *peer.Peer {
+	p, err := getPeer()
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// nextName names the n-th call of a collective on a stream in the current session, which is the same on all peers.
+func nextName(p *peer.Peer, op string, stream string) string {
+	if len(stream) > 0 {
+		op += "@" + stream
+	}
+	return fmt.Sprintf("kungfu::go::%s:%d", op, p.NextCall(op))
+}
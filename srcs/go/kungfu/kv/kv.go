@@ -0,0 +1,165 @@
+// Package kv is a small key-value store of cluster metadata, e.g. the learning rate, epoch number or dataset cursors.
+// The runner of the first host of the cluster is authoritative, it applies all writes in order
+// and replicates snapshots of the whole store to all runners, which pass them on to their local peers,
+// so that the store survives resizes as long as any runner keeps running.
+package kv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+// Names of control messages of the store
+const (
+	PutName      = "kv:put"      // a write, from a peer to its parent, and from a runner to the authoritative runner
+	SnapshotName = "kv:snapshot" // a snapshot, from the authoritative runner to runners, and from runners to peers
+	SyncName     = "kv:sync"     // a request of the latest snapshot, from a started peer to its parent
+)
+
+// Put is a write of a key, Seq orders the writes of the same writer
+type Put struct {
+	Writer plan.PeerID
+	Seq    uint64
+	Key    string
+	Value  []byte
+	Delete bool
+}
+
+func (p Put) Encode() []byte {
+	b := &bytes.Buffer{}
+	json.NewEncoder(b).Encode(p)
+	return b.Bytes()
+}
+
+func (p *Put) Decode(bs []byte) error {
+	return json.NewDecoder(bytes.NewBuffer(bs)).Decode(p)
+}
+
+// Snapshot is the whole store after Version writes
+type Snapshot struct {
+	Version uint64
+	Entries map[string][]byte
+	Applied map[string]uint64 // the last applied Seq of each writer
+}
+
+func (s Snapshot) Encode() []byte {
+	b := &bytes.Buffer{}
+	json.NewEncoder(b).Encode(s)
+	return b.Bytes()
+}
+
+func (s *Snapshot) Decode(bs []byte) error {
+	return json.NewDecoder(bytes.NewBuffer(bs)).Decode(s)
+}
+
+// Store is a replica of the store
+type Store struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	s    Snapshot
+}
+
+func New() *Store {
+	st := &Store{
+		s: Snapshot{
+			Entries: make(map[string][]byte),
+			Applied: make(map[string]uint64),
+		},
+	}
+	st.cond = sync.NewCond(&st.mu)
+	return st
+}
+
+// Apply applies a write on the authoritative replica, and returns the new snapshot,
+// a write which is not newer than the last one of its writer is ignored.
+func (st *Store) Apply(p Put) (Snapshot, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	writer := p.Writer.String()
+	if p.Seq <= st.s.Applied[writer] {
+		return st.s, false
+	}
+	s := st.s.clone()
+	if p.Delete {
+		delete(s.Entries, p.Key)
+	} else {
+		s.Entries[p.Key] = p.Value
+	}
+	s.Applied[writer] = p.Seq
+	s.Version++
+	st.set(s)
+	return s, true
+}
+
+// Accept replaces the replica with a newer snapshot
+func (st *Store) Accept(s Snapshot) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if s.Version <= st.s.Version {
+		return false
+	}
+	st.set(s.clone())
+	return true
+}
+
+func (st *Store) set(s Snapshot) {
+	st.s = s
+	st.cond.Broadcast()
+}
+
+func (st *Store) Get(key string) ([]byte, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	val, ok := st.s.Entries[key]
+	return val, ok
+}
+
+// Snapshot returns a copy of the replica
+func (st *Store) Snapshot() Snapshot {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.s.clone()
+}
+
+// Wait blocks until the write of the given Seq of the writer is in the replica
+func (st *Store) Wait(ctx context.Context, writer plan.PeerID, seq uint64) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			st.mu.Lock()
+			st.cond.Broadcast()
+			st.mu.Unlock()
+		case <-done:
+		}
+	}()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for st.s.Applied[writer.String()] < seq {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		st.cond.Wait()
+	}
+	return nil
+}
+
+func (s Snapshot) clone() Snapshot {
+	t := Snapshot{
+		Version: s.Version,
+		Entries: make(map[string][]byte, len(s.Entries)),
+		Applied: make(map[string]uint64, len(s.Applied)),
+	}
+	for k, v := range s.Entries {
+		t.Entries[k] = v
+	}
+	for k, v := range s.Applied {
+		t.Applied[k] = v
+	}
+	return t
+}
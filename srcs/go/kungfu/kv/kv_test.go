@@ -0,0 +1,42 @@
+package kv
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+func Test_Store(t *testing.T) {
+	leader, replica := New(), New()
+	a := plan.PeerID{IPv4: 1, Port: 10000}
+	b := plan.PeerID{IPv4: 1, Port: 10001}
+	for _, p := range []Put{
+		{Writer: a, Seq: 1, Key: "lr", Value: []byte("0.1")},
+		{Writer: b, Seq: 1, Key: "epoch", Value: []byte("1")},
+		{Writer: a, Seq: 1, Key: "lr", Value: []byte("0.2")}, // duplicated
+		{Writer: a, Seq: 2, Key: "epoch", Delete: true},
+	} {
+		if s, ok := leader.Apply(p); ok {
+			var t Snapshot
+			t.Decode(s.Encode())
+			replica.Accept(t)
+		}
+	}
+	s := replica.Snapshot()
+	if s.Version != 3 || string(s.Entries["lr"]) != "0.1" || len(s.Entries) != 1 {
+		t.Errorf("unexpected snapshot: %v", s)
+	}
+	if replica.Accept(Snapshot{Version: 2}) {
+		t.Errorf("outdated snapshot should be ignored")
+	}
+	if err := replica.Wait(context.Background(), a, 2); err != nil {
+		t.Errorf("Wait: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := replica.Wait(ctx, b, 2); err == nil {
+		t.Errorf("Wait should time out")
+	}
+}
@@ -0,0 +1,140 @@
+package launcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/utils"
+)
+
+// RegionLabel is added to hosts of a federated job, with the name of the region as value
+const RegionLabel = `region`
+
+const regionPath = `/federation/region`
+
+// Region is the part of a federated job managed by the launchers of a region
+type Region struct {
+	Name        string
+	HostList    plan.HostList
+	ClusterSize int
+	PortRange   plan.PortRange
+	Constraints plan.Constraints
+	Strategy    string
+}
+
+var (
+	errMissingRegion    = errors.New("region name is required to federate")
+	errDuplicatedRegion = errors.New("duplicated region")
+	errOverlappedRegion = errors.New("regions share hosts")
+	errStrategyMismatch = errors.New("regions use different strategies")
+)
+
+// Federate merges regions into a single cluster, regions are ordered by name and
+// peers of a region have consecutive ranks, so that collectives (e.g. RING) cross regions only at their boundaries.
+// It returns the cluster and the host list of all regions.
+func Federate(regions []Region, runnerPort uint16) (*plan.Cluster, plan.HostList, error) {
+	regions = append([]Region(nil), regions...)
+	sort.SliceStable(regions, func(i, j int) bool { return regions[i].Name < regions[j].Name })
+	var hl plan.HostList
+	var workers plan.PeerList
+	hosts := make(map[uint32]string)
+	for i, r := range regions {
+		if i > 0 && r.Name == regions[i-1].Name {
+			return nil, nil, fmt.Errorf("%v: %q", errDuplicatedRegion, r.Name)
+		}
+		if r.Strategy != regions[0].Strategy {
+			return nil, nil, fmt.Errorf("%v: %s uses %s, %s uses %s", errStrategyMismatch, regions[0].Name, regions[0].Strategy, r.Name, r.Strategy)
+		}
+		for _, h := range r.HostList {
+			if name, ok := hosts[h.IPv4]; ok {
+				return nil, nil, fmt.Errorf("%v: %s in %s and %s", errOverlappedRegion, plan.FormatIPv4(h.IPv4), name, r.Name)
+			}
+			hosts[h.IPv4] = r.Name
+			labels := make(plan.Labels)
+			for k, v := range h.Labels {
+				labels[k] = v
+			}
+			labels[RegionLabel] = r.Name
+			h.Labels = labels
+			hl = append(hl, h)
+		}
+		pl, err := r.HostList.Place(r.ClusterSize, r.PortRange, r.Constraints)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create peers in %s: %v", r.Name, err)
+		}
+		workers = append(workers, pl...)
+	}
+	return &plan.Cluster{
+		Runners: hl.GenRunnerList(runnerPort),
+		Workers: workers,
+	}, hl, nil
+}
+
+// serveRegion serves the local region to launchers of other regions
+func serveRegion(port int, r Region) (func(), error) {
+	bs, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	mux := &http.ServeMux{}
+	mux.HandleFunc(regionPath, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(bs)
+	})
+	ln, err := net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{Handler: mux}
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Errorf("federation server stopped: %v", err)
+		}
+	}()
+	log.Infof("serving region %s at %s%s", r.Name, ln.Addr(), regionPath)
+	return func() { srv.Close() }, nil
+}
+
+// fetchRegion gets the region from a launcher of another region, retrying until it is up or ctx is done
+func fetchRegion(ctx context.Context, addr string) (*Region, error) {
+	url := "http://" + addr + regionPath
+	client := http.Client{Timeout: 10 * time.Second}
+	ctx, cancel := context.WithTimeout(ctx, config.WaitRunnerTimeout)
+	defer cancel()
+	for i := 0; ; i++ {
+		r, err := func() (*Region, error) {
+			f, err := utils.OpenURL(url, &client, "KungFu Federation")
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			var r Region
+			if err := utils.ReadJSON(f, &r); err != nil {
+				return nil, err
+			}
+			return &r, nil
+		}()
+		if err == nil {
+			if i > 0 {
+				log.Infof("got region %s from %s after %d attempts", r.Name, addr, i+1)
+			}
+			return r, nil
+		}
+		log.Debugf("failed to fetch region from %s: %v", addr, err)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to fetch region from %s: %v", addr, err)
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package launcher
+
+import (
+	"testing"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+func Test_Federate(t *testing.T) {
+	pr := plan.DefaultPortRange
+	b := Region{Name: `b`, HostList: plan.HostList{{IPv4: 3, Slots: 4}}, ClusterSize: 3, PortRange: pr, Strategy: `RING`}
+	a := Region{Name: `a`, HostList: plan.HostList{{IPv4: 1, Slots: 2}, {IPv4: 2, Slots: 2}}, ClusterSize: 4, PortRange: pr, Strategy: `RING`}
+	c, hl, err := Federate([]Region{b, a}, 38080)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.Runners) != 3 || len(c.Workers) != 7 || len(hl) != 3 {
+		t.Errorf("unexpected cluster: %s", c.DebugString())
+	}
+	if c.Workers[0].IPv4 != 1 || c.Workers[4].IPv4 != 3 {
+		t.Errorf("peers are not ordered by region: %s", c.Workers)
+	}
+	if hl[2].Labels[RegionLabel] != `b` || len(b.HostList[0].Labels) != 0 {
+		t.Errorf("unexpected labels")
+	}
+	if _, _, err := Federate([]Region{a, a}, 38080); err == nil {
+		t.Errorf("duplicated region should fail")
+	}
+	b.Strategy = `STAR`
+	if _, _, err := Federate([]Region{a, b}, 38080); err == nil {
+		t.Errorf("strategy mismatch should fail")
+	}
+}
@@ -0,0 +1,176 @@
+// Package launcher runs the local part of a KungFu job, as kungfu-run does.
+package launcher
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/elastic/configsource"
+	"github.com/lsds/KungFu/srcs/go/kungfu/job"
+	"github.com/lsds/KungFu/srcs/go/kungfu/runner"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/utils/xterm"
+)
+
+// Config describes the job and how it is launched on this host
+type Config struct {
+	Self        plan.PeerID // the runner on this host, its port is replaced by the runner port of its host in Job.HostList if given
+	RunnerPort  uint16      // port of the runners on hosts without a runner port, Self.Port if 0
+	ClusterSize int
+	Job         job.Job // Job.Parent is set to Self
+
+	Watch       bool   // update peers to the cluster proposed by peers, otherwise peers are run once
+	Keep        bool   // stay alive after all local peers finished, watch mode only
+	InitVersion int    // -1 to wait for the first cluster from peers, watch mode only
+	DebugPort   int    // port of the HTTP debug server, watch mode only
+	DebugHost   string // address the HTTP debug server listens on, all addresses if empty
+
+	WatchConfig string        // URL of the config source driving the cluster, watch mode only
+	WatchPeriod time.Duration // interval between polls of the config source
+
+	Region         string   // name of the region of this host, federated mode only
+	Federation     []string // <host>:<port> of a launcher in each of the other regions, enables federated mode
+	FederationPort int      // port serving the region of this host to other regions
+
+	VerboseLog bool
+	Summary    string // file to save the summary, `-` for stdout
+
+	ForwardCrashes bool // print crash reports of local peers to stdout, for a remote launcher
+}
+
+// Launcher launches the local peers of a job
+type Launcher struct {
+	config    Config
+	federated *plan.Cluster
+}
+
+func New(config Config) *Launcher {
+	if config.RunnerPort == 0 {
+		config.RunnerPort = config.Self.Port
+	}
+	config.Self.Port = config.Job.HostList.RunnerPortOf(config.Self.IPv4, config.RunnerPort)
+	config.Job.Parent = config.Self
+	return &Launcher{config: config}
+}
+
+// InitCluster generates the initial cluster from the host list,
+// or returns the cluster of all regions once federated.
+func (l *Launcher) InitCluster() (*plan.Cluster, error) {
+	if l.federated != nil {
+		return l.federated, nil
+	}
+	j := l.config.Job
+	runners := j.HostList.GenRunnerList(l.config.RunnerPort)
+	if _, ok := runners.Rank(l.config.Self); !ok {
+		return nil, fmt.Errorf("%s not in %s", l.config.Self, runners)
+	}
+	var peers plan.PeerList
+	var err error
+	if len(j.RankMap) > 0 {
+		peers, err = j.HostList.PlaceByRankMap(j.RankMap, j.PortRange)
+	} else {
+		peers, err = j.HostList.Place(l.config.ClusterSize, j.PortRange, j.Constraints)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create peers: %v", err)
+	}
+	return &plan.Cluster{
+		Runners: runners,
+		Workers: peers,
+	}, nil
+}
+
+// Run runs the local peers until they all finished, or ctx is canceled
+func (l *Launcher) Run(ctx context.Context) error {
+	if len(l.config.Federation) > 0 {
+		stop, err := l.federate(ctx)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+	initCluster, err := l.InitCluster()
+	if err != nil {
+		return err
+	}
+	self := l.config.Self
+	summary := runner.NewSummaryRecorder(self, l.config.Summary)
+	summary.ForwardCrashes = l.config.ForwardCrashes
+	hooks, err := runner.NewNotifier(self, l.config.Job.Webhooks)
+	if err != nil {
+		return err
+	}
+	defer hooks.Wait()
+	if !l.config.Watch {
+		if l.config.Job.LeasePeriod > 0 {
+			log.Warnf("lease is ignored without watch mode")
+			l.config.Job.LeasePeriod = 0
+		}
+		return runner.SimpleRun(ctx, self, *initCluster, l.config.Job, l.config.VerboseLog, summary, hooks)
+	}
+	ch := make(chan runner.Stage, 1)
+	initial := *initCluster
+	if l.config.InitVersion < 0 {
+		log.Infof(xterm.Blue.S("waiting to be initialized"))
+		initial.Workers = nil
+	} else {
+		ch <- runner.Stage{
+			Cluster: *initCluster,
+			Version: l.config.InitVersion,
+		}
+	}
+	var source configsource.Source
+	if len(l.config.WatchConfig) > 0 {
+		if source, err = configsource.Open(l.config.WatchConfig, l.config.WatchPeriod); err != nil {
+			return err
+		}
+	}
+	var debugAddr string
+	if l.config.DebugPort > 0 {
+		debugAddr = net.JoinHostPort(l.config.DebugHost, strconv.Itoa(l.config.DebugPort))
+	}
+	return runner.WatchRun(ctx, self, initial, ch, source, l.config.Job, l.config.Keep, debugAddr, summary, hooks)
+}
+
+// federate exchanges regions with launchers of other regions, and replaces the host list of the job by all regions.
+// The returned function stops serving the local region.
+func (l *Launcher) federate(ctx context.Context) (func(), error) {
+	if len(l.config.Region) == 0 {
+		return nil, errMissingRegion
+	}
+	j := l.config.Job
+	local := Region{
+		Name:        l.config.Region,
+		HostList:    j.HostList,
+		ClusterSize: l.config.ClusterSize,
+		PortRange:   j.PortRange,
+		Constraints: j.Constraints,
+		Strategy:    j.StrategySpec(),
+	}
+	stop, err := serveRegion(l.config.FederationPort, local)
+	if err != nil {
+		return nil, err
+	}
+	regions := []Region{local}
+	for _, addr := range l.config.Federation {
+		r, err := fetchRegion(ctx, addr)
+		if err != nil {
+			stop()
+			return nil, err
+		}
+		regions = append(regions, *r)
+	}
+	cluster, hl, err := Federate(regions, l.config.RunnerPort)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	log.Infof("federated %d regions: %d hosts, %d peers", len(regions), len(hl), len(cluster.Workers))
+	l.config.Job.HostList = hl
+	l.federated = cluster
+	return stop, nil
+}
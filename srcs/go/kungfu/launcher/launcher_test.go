@@ -0,0 +1,26 @@
+package launcher
+
+import (
+	"testing"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/job"
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+func Test_InitClusterRunnerPort(t *testing.T) {
+	hl := plan.HostList{{IPv4: 1, Slots: 2}, {IPv4: 2, Slots: 2, RunnerPort: 38090}}
+	j := job.Job{HostList: hl, PortRange: plan.DefaultPortRange}
+	for _, self := range []plan.PeerID{{IPv4: 1, Port: 38080}, {IPv4: 2, Port: 38080}} {
+		l := New(Config{Self: self, ClusterSize: 4, Job: j})
+		c, err := l.InitCluster()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if c.Runners[0].Port != 38080 || c.Runners[1].Port != 38090 || len(c.Workers) != 4 {
+			t.Errorf("unexpected cluster: %s", c.DebugString())
+		}
+		if _, ok := c.Runners.Rank(l.config.Job.Parent); !ok {
+			t.Errorf("%s not in %s", l.config.Job.Parent, c.Runners)
+		}
+	}
+}
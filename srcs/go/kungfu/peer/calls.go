@@ -0,0 +1,32 @@
+package peer
+
+import "sync"
+
+// callCounter counts the calls of each collective, whose names are derived from the counts so that they are the same on all peers.
+// The counts are reset when a new session is installed, so that the peers joining it count from 0 as the others.
+type callCounter struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (c *callCounter) next(op string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls == nil {
+		c.calls = make(map[string]int)
+	}
+	n := c.calls[op]
+	c.calls[op]++
+	return n
+}
+
+func (c *callCounter) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = nil
+}
+
+// NextCall returns the number of previous calls of op in the current session, and counts this one
+func (p *Peer) NextCall(op string) int {
+	return p.calls.next(op)
+}
@@ -0,0 +1,28 @@
+package peer
+
+import (
+	"github.com/lsds/KungFu/srcs/go/kungfu/checksum"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+)
+
+// reportChecksum sends the checksum of the allreduce results of the last config.ChecksumPeriod steps
+// to the first runner of the cluster in background, which compares the checksums of all peers.
+func (p *Peer) reportChecksum() {
+	if p.checksum == nil {
+		return
+	}
+	p.Lock()
+	version, runners := p.clusterVersion, p.currentCluster.Runners
+	p.Unlock()
+	r, ok := p.checksum.Step(p.self, version)
+	if !ok || len(runners) == 0 {
+		return
+	}
+	target := runners[0]
+	go func() {
+		if err := p.router.Send(target.WithName(checksum.ReportName), r.Encode(), connection.ConnControl, connection.NoFlag); err != nil {
+			log.Debugf("failed to send checksum to %s: %v", target, err)
+		}
+	}()
+}
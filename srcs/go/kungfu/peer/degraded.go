@@ -0,0 +1,73 @@
+package peer
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/runner"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+)
+
+// degradedState tells if this peer lost its GPU, and if the peers agreed to use CPU collectives at the last step fence
+type degradedState struct {
+	mu      sync.Mutex
+	policy  plan.DegradedPolicy
+	reason  string
+	cpuOnly bool
+}
+
+// fence returns 1 if this peer continues without GPU by the cpu policy
+func (s *degradedState) fence() int8 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.reason) > 0 && s.policy == plan.DegradedCPU {
+		return 1
+	}
+	return 0
+}
+
+func (s *degradedState) agree(v int8) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cpuOnly := v != 0; cpuOnly != s.cpuOnly {
+		if cpuOnly {
+			log.Warnf("switching to CPU collectives, some peers continue without GPU")
+		} else {
+			log.Infof("switching back to GPU collectives, no peer is without GPU")
+		}
+		s.cpuOnly = cpuOnly
+	}
+}
+
+// ReportDegraded reports to the runner that the GPU of this peer became unavailable, e.g. after an Xid error or ECC fault.
+// By the evict policy, the runner kills this peer and removes it from the cluster in watch mode.
+// By the cpu policy, all peers agree to switch to CPU collectives at the next EndStep, see CPUOnly.
+func (p *Peer) ReportDegraded(reason string) error {
+	p.degraded.mu.Lock()
+	p.degraded.reason = reason
+	policy := p.degraded.policy
+	p.degraded.mu.Unlock()
+	if p.single {
+		return nil
+	}
+	bs, _ := json.Marshal(runner.DegradedReport{Reason: reason, Time: time.Now()})
+	if err := p.router.Send(p.parent.WithName(runner.DegradedName), bs, connection.ConnControl, connection.NoFlag); err != nil {
+		if policy == plan.DegradedCPU {
+			log.Warnf("failed to report degraded to %s: %v", p.parent, err)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// CPUOnly tells if the peers agreed at the last EndStep that some peers continue without GPU,
+// so that collectives must avoid the GPU, e.g. NCCL, until they leave the cluster.
+func (p *Peer) CPUOnly() bool {
+	p.degraded.mu.Lock()
+	defer p.degraded.mu.Unlock()
+	return p.degraded.cpuOnly
+}
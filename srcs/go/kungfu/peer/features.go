@@ -0,0 +1,76 @@
+package peer
+
+import (
+	"strings"
+	"sync"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/kungfu/features"
+	"github.com/lsds/KungFu/srcs/go/kungfu/session"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/rchannel/client"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+)
+
+// featureState holds the features requested by this peer, overridden by kungfu-ctl feature until negotiated at the next step fence
+type featureState struct {
+	mu        sync.Mutex
+	requested features.Set
+	pending   bool
+}
+
+func (s *featureState) init() {
+	s.requested = features.Requested()
+}
+
+func (s *featureState) get() (features.Set, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requested, s.pending
+}
+
+func (p *Peer) handleFeature(_name string, msg *connection.Message, conn connection.Connection) {
+	var u features.Update
+	if err := u.Decode(msg.Data); err != nil {
+		log.Warnf("invalid feature message from %s: %v", conn.Src(), err)
+		return
+	}
+	p.features.mu.Lock()
+	defer p.features.mu.Unlock()
+	s, unknown, err := u.Apply(p.features.requested, true)
+	if err != nil {
+		log.Warnf("features requested by %s rejected: %v", conn.Src(), err)
+		return
+	}
+	if len(unknown) > 0 {
+		log.Warnf("unknown features requested by %s are ignored: %s", conn.Src(), strings.Join(unknown, ","))
+	}
+	p.features.requested = s
+	p.features.pending = true
+	log.Infof("features requested by %s: %s, will negotiate at the next step fence", conn.Src(), s)
+}
+
+// negotiateFeatures enables the cluster features requested by all peers, and the local features requested by this peer
+func (p *Peer) negotiateFeatures(sess *session.Session) error {
+	local, _ := p.features.get()
+	x := kb.NewVector(features.MaxBits, kb.I8)
+	copy(x.AsI8(), local.Bits())
+	w := kb.Workspace{SendBuf: x, RecvBuf: x, OP: kb.MIN, Name: "kungfu::features", Stream: client.PriorityStream}
+	if err := sess.AllReduce(w); err != nil {
+		return err
+	}
+	s := features.Negotiate(local, features.FromBits(x.AsI8()))
+	p.features.mu.Lock()
+	p.features.pending = false
+	p.features.mu.Unlock()
+	if prev := features.Effective(); prev != s {
+		log.Infof("features in effect: %s, requested: %s", s, local)
+	}
+	features.SetEffective(s)
+	return nil
+}
+
+// Features returns the features in effect
+func (p *Peer) Features() features.Set {
+	return features.Effective()
+}
@@ -0,0 +1,83 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/kv"
+	"github.com/lsds/KungFu/srcs/go/kungfu/sealed"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+)
+
+// kvTimeout is the maximum time of a write to be replicated back to the writer
+const kvTimeout = 10 * time.Second
+
+var errKVTimeout = errors.New("kv write not replicated in time")
+
+func (p *Peer) handleKVSnapshot(_name string, msg *connection.Message, conn connection.Connection) {
+	var s kv.Snapshot
+	if err := s.Decode(msg.Data); err != nil {
+		log.Warnf("invalid kv snapshot from %s: %v", conn.Src(), err)
+		return
+	}
+	p.kv.Accept(s)
+}
+
+// loadKV loads the snapshot of the store saved by the parent when this peer was created
+func (p *Peer) loadKV(filename string) error {
+	bs, err := sealed.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var s kv.Snapshot
+	if err := s.Decode(bs); err != nil {
+		return err
+	}
+	p.kv.Accept(s)
+	return os.Remove(filename)
+}
+
+// syncKV requests the latest snapshot of the store from the parent
+func (p *Peer) syncKV() {
+	if err := p.router.Send(p.parent.WithName(kv.SyncName), nil, connection.ConnControl, connection.NoFlag); err != nil {
+		log.Debugf("failed to sync kv with %s: %v", p.parent, err)
+	}
+}
+
+// KVGet returns the value of the key in the local replica of the cluster metadata store
+func (p *Peer) KVGet(key string) ([]byte, bool) {
+	return p.kv.Get(key)
+}
+
+// KVPut sets the key in the cluster metadata store, it returns after the write is in the local replica.
+// The store is kept by kungfu-run in watch mode, and survives resizes.
+func (p *Peer) KVPut(key string, value []byte) error {
+	return p.kvWrite(kv.Put{Key: key, Value: value})
+}
+
+// KVDelete removes the key from the cluster metadata store
+func (p *Peer) KVDelete(key string) error {
+	return p.kvWrite(kv.Put{Key: key, Delete: true})
+}
+
+func (p *Peer) kvWrite(w kv.Put) error {
+	w.Writer = p.self
+	w.Seq = atomic.AddUint64(&p.kvSeq, 1)
+	if p.single {
+		p.kv.Apply(w)
+		return nil
+	}
+	if err := p.router.Send(p.parent.WithName(kv.PutName), w.Encode(), connection.ConnControl, connection.NoFlag); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kvTimeout)
+	defer cancel()
+	if err := p.kv.Wait(ctx, p.self, w.Seq); err != nil {
+		return errKVTimeout
+	}
+	return nil
+}
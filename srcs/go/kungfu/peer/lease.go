@@ -0,0 +1,27 @@
+package peer
+
+import (
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+)
+
+// leaseRenewals is the number of renewals sent within a lease period, so that a few lost renewals don't expire the lease
+const leaseRenewals = 3
+
+// renewLease keeps the lease of self with the parent alive until the peer is closed
+func (p *Peer) renewLease() {
+	tk := time.NewTicker(p.leasePeriod / leaseRenewals)
+	defer tk.Stop()
+	for {
+		if err := p.router.Send(p.parent.WithName("lease"), nil, connection.ConnControl, connection.NoFlag); err != nil {
+			log.Warnf("failed to renew lease with %s: %v", p.parent, err)
+		}
+		select {
+		case <-tk.C:
+		case <-p.closed:
+			return
+		}
+	}
+}
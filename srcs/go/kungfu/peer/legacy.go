@@ -17,10 +17,14 @@ func (p *Peer) getCurrentCluster() plan.Cluster {
 
 func (p *Peer) ProposeNewSize(newSize int) error {
 	cluster := p.getCurrentCluster()
-	newCluster, err := cluster.Resize(newSize)
+	newCluster, err := cluster.ResizeWithin(newSize, p.hostList, p.constraints)
 	if err != nil {
 		return err
 	}
+	return p.proposeCluster(newCluster)
+}
+
+func (p *Peer) proposeCluster(newCluster *plan.Cluster) error {
 	buf := &bytes.Buffer{}
 	if err := json.NewEncoder(buf).Encode(newCluster); err != nil {
 		return err
@@ -35,5 +39,8 @@ func (p *Peer) ProposeNewSize(newSize int) error {
 		return err
 	}
 	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proposal rejected: %s", resp.Status)
+	}
 	return nil
 }
@@ -0,0 +1,103 @@
+package peer
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/runner"
+	"github.com/lsds/KungFu/srcs/go/kungfu/sealed"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+	"github.com/lsds/KungFu/srcs/go/rchannel/handler"
+)
+
+// migrationState is the communication state handed over from a peer to its replacement
+type migrationState struct {
+	Source         plan.PeerID
+	ClusterVersion int
+	P2P            handler.PeerToPeerState
+	Pending        []handler.PendingMessage // received by collectives, but not consumed yet
+	Steps          int
+}
+
+// ProposeMigration proposes to move the peer of given rank to host
+func (p *Peer) ProposeMigration(rank int, host string) error {
+	ipv4, err := plan.ParseIPv4(host)
+	if err != nil {
+		return err
+	}
+	cluster := p.getCurrentCluster()
+	newCluster, err := cluster.Migrate(rank, ipv4)
+	if err != nil {
+		return err
+	}
+	return p.proposeCluster(newCluster)
+}
+
+// MigrateRank moves the peer of given rank to host, the state of the peer is restored on the new host.
+func (p *Peer) MigrateRank(rank int, host string) (bool, bool, error) {
+	if p.currentSession.Rank() == 0 {
+		if err := p.ProposeMigration(rank, host); err != nil {
+			log.Warnf("Peer::MigrateRank failed: %v", err)
+		}
+	}
+	return p.ResizeClusterFromURL()
+}
+
+// handover sends the state of self to the runner of its replacement in the new cluster,
+// a peer is replaced if its rank is taken by a peer which is not in the current cluster.
+// It returns the pending messages taken from the collective endpoint, which are put back if the cluster is not accepted.
+func (p *Peer) handover(cluster plan.Cluster) ([]handler.PendingMessage, error) {
+	rank, ok := p.currentCluster.Workers.Rank(p.self)
+	if !ok || cluster.Workers.Contains(p.self) || len(cluster.Workers) <= rank {
+		return nil, nil
+	}
+	target := cluster.Workers[rank]
+	if p.currentCluster.Workers.Contains(target) {
+		return nil, nil
+	}
+	runners := cluster.Runners.On(target.IPv4)
+	if len(runners) == 0 {
+		return nil, nil
+	}
+	pending := p.router.Collective.TakePending()
+	state, err := json.Marshal(migrationState{
+		Source:         p.self,
+		ClusterVersion: p.clusterVersion,
+		P2P:            p.router.P2P.Snapshot(),
+		Pending:        pending,
+		Steps:          p.step.count(),
+	})
+	if err != nil {
+		return pending, err
+	}
+	m := runner.Migration{Target: target, State: state}
+	log.Infof("handing over state of %d bytes to %s via %s", len(state), target, runners[0])
+	return pending, p.router.Send(runners[0].WithName("migrate"), m.Encode(), connection.ConnControl, 0)
+}
+
+// Steps returns the number of steps ended by EndStep, including those of the migrated peer replaced by this one
+func (p *Peer) Steps() int {
+	return p.step.count()
+}
+
+func (p *Peer) restore(filename string) error {
+	bs, err := sealed.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var s migrationState
+	if err := json.Unmarshal(bs, &s); err != nil {
+		return err
+	}
+	if err := p.router.P2P.Restore(s.P2P); err != nil {
+		return err
+	}
+	if err := p.router.Collective.RestorePending(s.Pending); err != nil {
+		return err
+	}
+	p.step.restore(s.Steps)
+	log.Infof("restored state of %s from v%d after %d steps, with %d pending messages", s.Source, s.ClusterVersion, s.Steps, len(s.Pending))
+	return os.Remove(filename)
+}
@@ -33,6 +33,24 @@ func (p *Peer) RequestRank(rank int, version, name string, buf *base.Vector) (bo
 	return p.Request(target, version, name, buf)
 }
 
+// PutBlob saves data of any size under name, other peers can fetch it with GetBlob
+func (p *Peer) PutBlob(name string, data []byte) {
+	p.router.P2P.PutBlob(name, data)
+}
+
+// GetBlob fetches the blob saved by the target peer, it returns false if the blob doesn't exist
+func (p *Peer) GetBlob(target plan.PeerID, name string) ([]byte, bool, error) {
+	return p.router.P2P.GetBlob(target.WithName(name))
+}
+
+func (p *Peer) GetBlobFromRank(rank int, name string) ([]byte, bool, error) {
+	sess := p.CurrentSession()
+	if rank < 0 || sess.Size() <= rank {
+		return nil, false, errInvalidRank
+	}
+	return p.GetBlob(sess.Peer(rank), name)
+}
+
 func asMessage(b *base.Vector) connection.Message {
 	return connection.Message{
 		Length: uint32(len(b.Data)),
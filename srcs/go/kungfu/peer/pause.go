@@ -0,0 +1,107 @@
+package peer
+
+import (
+	"sync"
+	"time"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/rchannel/client"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+)
+
+// Names of control messages sent by kungfu-ctl
+const (
+	PauseName  = "pause"
+	ResumeName = "resume"
+)
+
+type pauseState struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	requested bool
+}
+
+func (s *pauseState) init() {
+	s.cond = sync.NewCond(&s.mu)
+}
+
+func (s *pauseState) set(requested bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requested = requested
+	s.cond.Broadcast()
+}
+
+func (s *pauseState) get() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requested
+}
+
+func (s *pauseState) wait() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.requested {
+		s.cond.Wait()
+	}
+}
+
+func (p *Peer) handlePause(_name string, _msg *connection.Message, conn connection.Connection) {
+	log.Infof("pause requested by %s, will pause at the next step fence", conn.Src())
+	p.pause.set(true)
+}
+
+func (p *Peer) handleResume(_name string, _msg *connection.Message, conn connection.Connection) {
+	log.Infof("resume requested by %s", conn.Src())
+	p.pause.set(false)
+}
+
+// StepFence must be called by all peers once per step, it agrees on whether any peer was asked to pause, tune, override features, restart or stop the parameter servers,
+// and whether any peer continues without GPU, applies the requested tunables and features, and if paused, blocks until this peer is resumed, and then waits for all peers in a barrier.
+func (p *Peer) StepFence() error {
+	sess := p.CurrentSession()
+	x := kb.NewVector(7, kb.I8)
+	y := kb.NewVector(7, kb.I8)
+	if p.pause.get() {
+		x.AsI8()[0] = 1
+	}
+	if _, pending := p.tune.get(); pending {
+		x.AsI8()[1] = 1
+	}
+	if _, pending := p.features.get(); pending {
+		x.AsI8()[2] = 1
+	}
+	x.AsI8()[3], x.AsI8()[4] = p.restart.fence()
+	x.AsI8()[5] = p.ps.fence()
+	x.AsI8()[6] = p.degraded.fence()
+	w := kb.Workspace{SendBuf: x, RecvBuf: y, OP: kb.MAX, Name: "kungfu::step-fence", Stream: client.PriorityStream}
+	if err := sess.AllReduce(w); err != nil {
+		return err
+	}
+	if y.AsI8()[1] != 0 {
+		if err := p.applyTunables(sess); err != nil {
+			return err
+		}
+	}
+	if y.AsI8()[2] != 0 {
+		if err := p.negotiateFeatures(sess); err != nil {
+			return err
+		}
+	}
+	p.restart.agree(y.AsI8()[3], y.AsI8()[4])
+	p.ps.agree(y.AsI8()[5])
+	p.degraded.agree(y.AsI8()[6])
+	if y.AsI8()[0] == 0 {
+		return nil
+	}
+	p.pause.set(true) // some peers may not have received the pause message
+	t0 := time.Now()
+	log.Infof("paused at step fence")
+	p.pause.wait()
+	if err := sess.Barrier(); err != nil {
+		return err
+	}
+	log.Infof("resumed after paused for %s", time.Since(t0))
+	return nil
+}
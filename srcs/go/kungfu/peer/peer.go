@@ -5,17 +5,31 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"strconv"
 	"sync"
 	"time"
 
 	"github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/kungfu/checksum"
 	"github.com/lsds/KungFu/srcs/go/kungfu/config"
 	"github.com/lsds/KungFu/srcs/go/kungfu/env"
 	"github.com/lsds/KungFu/srcs/go/kungfu/execution"
+	"github.com/lsds/KungFu/srcs/go/kungfu/features"
+	"github.com/lsds/KungFu/srcs/go/kungfu/formation"
+	"github.com/lsds/KungFu/srcs/go/kungfu/job"
+	"github.com/lsds/KungFu/srcs/go/kungfu/kv"
+	"github.com/lsds/KungFu/srcs/go/kungfu/perfreport"
+	"github.com/lsds/KungFu/srcs/go/kungfu/plugins"
+	"github.com/lsds/KungFu/srcs/go/kungfu/ps"
+	"github.com/lsds/KungFu/srcs/go/kungfu/robust"
 	"github.com/lsds/KungFu/srcs/go/kungfu/runner"
+	"github.com/lsds/KungFu/srcs/go/kungfu/schema"
 	"github.com/lsds/KungFu/srcs/go/kungfu/session"
+	"github.com/lsds/KungFu/srcs/go/kungfu/throughput"
+	"github.com/lsds/KungFu/srcs/go/kungfu/timeouts"
+	"github.com/lsds/KungFu/srcs/go/kungfu/tunables"
 	"github.com/lsds/KungFu/srcs/go/log"
 	"github.com/lsds/KungFu/srcs/go/monitor"
 	"github.com/lsds/KungFu/srcs/go/plan"
@@ -29,14 +43,25 @@ type Peer struct {
 
 	// immutable
 	configServerURL    string
+	migrationState     string
+	kvSnapshot         string
+	statsFile          string
+	started            time.Time
+	leasePeriod        time.Duration
+	seed               uint64
+	roles              *plan.RoleLayout
+	hostList           plan.HostList
+	constraints        plan.Constraints
 	initClusterVersion int
 	parent             plan.PeerID
 	self               plan.PeerID
 	strategy           base.Strategy
+	strategyOptions    base.StrategyOptions
 	single             bool
 	router             *router
 	server             server.Server
 	httpClient         http.Client
+	closed             chan struct{}
 
 	// dynamic
 	clusterVersion int
@@ -45,6 +70,26 @@ type Peer struct {
 	updated        bool
 
 	detached bool
+	pause    pauseState
+	tune     tuneState
+	features featureState
+	restart  restartState
+	ps       psState
+	step     stepState
+	calls    callCounter
+	sent     sentStage
+	acks     *runner.StageAcks // of the Stages sent to the root of the fan-out tree
+	kv       *kv.Store
+	kvSeq    uint64
+	schema   *schema.Registry
+	checksum *checksum.Rolling // nil unless config.ChecksumPeriod > 0
+
+	throughput  *throughput.Window // nil unless config.ThroughputPeriod > 0
+	throughputs *throughput.History
+
+	perf      *perfreport.Recorder // nil unless config.PerfReport
+	timeShare *timeShare           // nil unless the slot of the peer is shared
+	degraded  degradedState
 }
 
 func New() (*Peer, error) {
@@ -56,7 +101,18 @@ func New() (*Peer, error) {
 }
 
 func NewFromConfig(cfg *env.Config) (*Peer, error) {
+	// builtin aggregations take their OPs before the plugins
+	if err := robust.Register(); err != nil {
+		return nil, err
+	}
+	if err := plugins.LoadAll(config.ReducePlugins); err != nil {
+		return nil, err
+	}
 	router := NewRouter(cfg.Self)
+	if config.ShareConnections || cfg.Strategy == base.Clique {
+		// clique would open a connection for each ordered pair of peers
+		router.client.ShareConnections(router)
+	}
 	server := server.New(cfg.Self, router, config.UseUnixSock)
 	var initClusterVersion int
 	if len(cfg.InitClusterVersion) > 0 {
@@ -70,18 +126,65 @@ func NewFromConfig(cfg *env.Config) (*Peer, error) {
 		Runners: cfg.InitRunners,
 		Workers: cfg.InitPeers,
 	}
-	return &Peer{
+	p := &Peer{
 		configServerURL:    cfg.ConfigServer,
+		migrationState:     cfg.MigrationState,
+		kvSnapshot:         cfg.KVSnapshot,
+		statsFile:          cfg.StatsFile,
+		leasePeriod:        cfg.LeasePeriod,
+		seed:               cfg.Seed,
+		roles:              cfg.Roles,
+		hostList:           cfg.HostList,
+		constraints:        cfg.Constraints,
 		parent:             cfg.Parent,
 		currentCluster:     initCluster,
 		self:               cfg.Self,
 		strategy:           cfg.Strategy,
+		strategyOptions:    cfg.StrategyOptions,
 		initClusterVersion: initClusterVersion,
 		clusterVersion:     initClusterVersion,
 		single:             cfg.Single,
 		router:             router,
 		server:             server,
-	}, nil
+		closed:             make(chan struct{}),
+		kv:                 kv.New(),
+		schema:             schema.New(),
+		acks:               runner.NewStageAcks(),
+	}
+	if config.ChecksumPeriod > 0 && !cfg.Single {
+		p.checksum = checksum.New(config.ChecksumPeriod)
+	}
+	if config.ThroughputPeriod > 0 && !cfg.Single {
+		p.throughput = throughput.New(config.ThroughputPeriod)
+	}
+	p.throughputs = throughput.NewHistory()
+	if config.PerfReport {
+		p.perf = perfreport.Start()
+	}
+	p.timeShare = newTimeShare(cfg.TimeShare)
+	p.degraded.policy = cfg.DegradedPolicy
+	if len(cfg.HostAddrs) > 0 {
+		connection.SetHostAddrs(cfg.HostAddrs)
+	}
+	if config.Multiplex && !cfg.Single && !config.InprocTransport {
+		connection.UseRelay(cfg.Parent)
+	}
+	p.pause.init()
+	p.tune.init(cfg.StrategyOptions)
+	p.features.init()
+	p.ps.init()
+	router.ctrlHandler.Register(PauseName, p.handlePause)
+	router.ctrlHandler.Register(ResumeName, p.handleResume)
+	router.ctrlHandler.Register(kv.SnapshotName, p.handleKVSnapshot)
+	router.ctrlHandler.Register(tunables.TuneName, p.handleTune)
+	router.ctrlHandler.Register(features.FeatureName, p.handleFeature)
+	router.ctrlHandler.Register(RestartName, p.handleRestart)
+	router.ctrlHandler.Register(runner.UpdateNackName, p.handleUpdateNack)
+	router.ctrlHandler.Register(runner.UpdateAckName, p.handleUpdateAck)
+	router.ctrlHandler.Register(ps.PushName, p.handlePSBatch)
+	router.ctrlHandler.Register(ps.ReplicaName, p.handlePSBatch)
+	router.ctrlHandler.Register(ps.AckName, p.handlePSAck)
+	return p, nil
 }
 
 func (p *Peer) Start() error {
@@ -98,18 +201,44 @@ func (p *Peer) Start() error {
 			}
 			log.Infof("Kungfu peer %s started, monitoring endpoint http://%s/metrics", p.self, monitorAddr)
 		}
+		if p.leasePeriod > 0 {
+			go p.renewLease()
+		}
+		go p.syncKV()
+		go p.watchQueues()
+	}
+	if len(p.migrationState) > 0 {
+		if err := p.restore(p.migrationState); err != nil {
+			return err
+		}
+	}
+	if len(p.kvSnapshot) > 0 {
+		if err := p.loadKV(p.kvSnapshot); err != nil {
+			log.Warnf("failed to load kv snapshot: %v", err)
+		}
 	}
 	p.Update()
+	p.started = time.Now()
 	return nil
 }
 
 func (p *Peer) Close() error {
+	close(p.closed)
 	if !p.single {
 		if config.EnableMonitoring {
 			monitor.StopServer()
 		}
 		p.server.Close() // TODO: check error
 	}
+	if len(p.statsFile) > 0 {
+		if err := saveStats(p.statsFile, p.started); err != nil {
+			log.Warnf("failed to save stats: %v", err)
+		}
+	}
+	if p.perf != nil {
+		log.Infof("perf report of %s:\n%s", p.self, p.perf.Report())
+	}
+	log.CloseSinks()
 	return nil
 }
 
@@ -124,6 +253,16 @@ func (p *Peer) UID() uint64 {
 	return (hi<<32 | lo)
 }
 
+// Seed returns the random seed of the current rank, which is derived from the job seed and changes on resize
+func (p *Peer) Seed() uint64 {
+	p.Lock()
+	defer p.Unlock()
+	if p.currentSession == nil {
+		p.updateTo(p.currentCluster.Workers)
+	}
+	return job.DeriveSeed(p.seed, p.clusterVersion, p.currentSession.Rank())
+}
+
 var errSelfNotInCluster = errors.New("self not in cluster")
 
 func (p *Peer) CurrentSession() *session.Session {
@@ -152,19 +291,63 @@ func (p *Peer) updateTo(pl plan.PeerList) bool {
 		return true
 	}
 	log.Debugf("Kungfu::updateTo v%d of %d peers: %s", p.clusterVersion, len(pl), pl)
+	timeouts.SetClusterSize(len(pl))
 	p.router.ResetConnections(pl, uint32(p.clusterVersion))
-	sess, exist := session.New(p.strategy, p.self, pl, p.router.client, p.router.Collective)
+	sess, exist := session.New(p.strategy, p.strategyOptions, p.self, pl, p.router.client, p.router.Collective)
 	if !exist {
 		return false
 	}
+	p.reportFormation(formation.Connecting)
+	p.rebalancePS(pl)
+	if err := p.checkStrategy(sess); err != nil {
+		utils.ExitErr(err)
+	}
 	if err := sess.Barrier(); err != nil {
 		utils.ExitErr(fmt.Errorf("barrier failed after newSession: %v", err))
 	}
+	p.reportFormation(formation.Exchanging)
+	if err := p.negotiateFeatures(sess); err != nil {
+		utils.ExitErr(fmt.Errorf("failed to negotiate features: %v", err))
+	}
+	if features.Enabled(features.WarmUp) {
+		p.reportFormation(formation.WarmingUp)
+		if err := sess.WarmUp(); err != nil {
+			utils.ExitErr(fmt.Errorf("warm up failed after newSession: %v", err))
+		}
+	}
+	if err := p.syncTunables(sess); err != nil {
+		utils.ExitErr(fmt.Errorf("failed to sync tunables: %v", err))
+	}
+	if err := p.checkSchema(sess); err != nil {
+		utils.ExitErr(err)
+	}
+	if p.checksum != nil {
+		p.checksum.Reset()
+		sess.TrackChecksums(p.checksum)
+	}
+	if p.throughput != nil {
+		p.throughput.Reset()
+	}
+	p.calls.reset()
 	p.currentSession = sess
 	p.updated = true
+	p.reportFormation(formation.Ready)
 	return true
 }
 
+// reportFormation tells the parent the phase of joining the cluster of the current version, see package formation
+func (p *Peer) reportFormation(phase formation.Phase) {
+	if p.single {
+		return
+	}
+	r := formation.Report{Peer: p.self, Version: p.clusterVersion, Phase: phase}
+	go func() {
+		if err := p.router.Send(p.parent.WithName(formation.ReportName), r.Encode(), connection.ConnControl, connection.NoFlag); err != nil {
+			log.Debugf("failed to report formation phase to %s: %v", p.parent, err)
+		}
+	}()
+}
+
 func (p *Peer) consensus(bs []byte) bool {
 	sess := p.CurrentSession()
 	ok, err := sess.BytesConsensus(bs, "")
@@ -183,17 +366,33 @@ func (p *Peer) propose(cluster plan.Cluster) (bool, bool) {
 		log.Debugf("ingore unchanged proposal")
 		return false, false
 	}
+	// handover before consensus, so that the state arrives before the update of any peer
+	pending, err := p.handover(cluster)
+	if err != nil {
+		log.Errorf("failed to handover state: %v", err)
+	}
 	if digest := cluster.Bytes(); !p.consensus(digest) {
 		log.Errorf("diverge proposal detected among %d peers! I proposed %s", len(cluster.Workers), cluster.Workers)
+		if err := p.router.Collective.RestorePending(pending); err != nil {
+			log.Warnf("failed to put back pending messages: %v", err)
+		}
 		return false, false
 	}
+	monitor.BeginTransition(p.clusterVersion+1, len(p.currentCluster.Workers), len(cluster.Workers))
 	{
 		stage := runner.Stage{
 			Version: p.clusterVersion + 1,
 			Cluster: cluster,
 		}
+		base := runner.Stage{
+			Version: p.clusterVersion,
+			Cluster: *p.currentCluster,
+		}
+		p.sent.set(stage)
+		fullName, full := runner.EncodeUpdate(stage, nil, features.Enabled(features.CompressStages))
+		deltaName, delta := runner.EncodeUpdate(stage, &base, features.Enabled(features.CompressStages))
 		var notify execution.PeerFunc = func(ctrl plan.PeerID) error {
-			ctx, cancel := context.WithTimeout(context.TODO(), config.WaitRunnerTimeout)
+			ctx, cancel := context.WithTimeout(context.TODO(), timeouts.StagePropagation())
 			defer cancel()
 			n, err := p.router.Wait(ctx, ctrl)
 			if err != nil {
@@ -202,11 +401,28 @@ func (p *Peer) propose(cluster plan.Cluster) (bool, bool) {
 			if n > 0 {
 				log.Warnf("%s is up after pinged %d times", ctrl, n+1)
 			}
-			return p.router.Send(ctrl.WithName("update"), stage.Encode(), connection.ConnControl, 0)
+			if base.Cluster.Runners.Contains(ctrl) {
+				return p.router.Send(ctrl.WithName(deltaName), delta, connection.ConnControl, 0)
+			}
+			return p.router.Send(ctrl.WithName(fullName), full, connection.ConnControl, 0)
 		}
-		if err := notify.Par(cluster.Runners); err != nil {
-			utils.ExitErr(err)
+		// runners forward the stage to each other over a fan-out tree
+		if targets := runner.StageTargets(cluster.Runners); len(targets) == len(cluster.Runners) {
+			if err := notify.Par(targets); err != nil {
+				utils.ExitErr(err)
+			}
+		} else if failed, err := p.notifyRoot(notify, stage); err != nil {
+			log.Warnf("failed to send v%d to the root of the fan-out tree: %v, sending to all runners", stage.Version, err)
+			if err := notify.Par(cluster.Runners); err != nil {
+				utils.ExitErr(err)
+			}
+		} else if len(failed) > 0 {
+			log.Warnf("v%d is not received by %d runners: %s, sending to them", stage.Version, len(failed), failed)
+			if err := notify.Par(failed); err != nil {
+				utils.ExitErr(err)
+			}
 		}
+		monitor.TransitionAcked()
 	}
 	func() {
 		p.Lock()
@@ -225,6 +441,9 @@ func (p *Peer) propose(cluster plan.Cluster) (bool, bool) {
 }
 
 func (p *Peer) ResizeCluster(newSize int) (bool, bool, error) {
+	if p.step.within() {
+		return false, false, errResizeInStep
+	}
 	if p.currentSession.Rank() == 0 {
 		if err := p.ProposeNewSize(newSize); err != nil {
 			log.Warnf("Peer::ResizeCluster failed: %v", err)
@@ -234,6 +453,12 @@ func (p *Peer) ResizeCluster(newSize int) (bool, bool, error) {
 }
 
 func (p *Peer) ResizeClusterFromURL() (bool, bool, error) {
+	if p.step.within() {
+		return false, false, errResizeInStep
+	}
+	if err := p.PSFlush(); err != nil {
+		log.Warnf("failed to flush pushes to parameter servers before resize: %v", err)
+	}
 	var cluster *plan.Cluster
 	for i := 0; ; i++ {
 		var err error
@@ -256,12 +481,29 @@ func (p *Peer) ResizeClusterFromURL() (bool, bool, error) {
 	changed, detached := p.propose(*cluster)
 	if detached {
 		p.detached = true
+		monitor.AbortTransition()
 	} else {
 		p.Update()
+		monitor.TransitionReady()
 	}
 	return changed, detached, nil
 }
 
+func saveStats(filename string, started time.Time) error {
+	r := monitor.Report{
+		Totals:      monitor.GetTotals(),
+		Started:     started,
+		Finished:    time.Now(),
+		Transitions: monitor.GetTransitions(),
+		Families:    monitor.GetFamilies(),
+	}
+	bs, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, bs, 0644)
+}
+
 func (p *Peer) getClusterConfig(url string) (*plan.Cluster, error) {
 	f, err := utils.OpenURL(url, &p.httpClient, fmt.Sprintf("KungFu Peer: %s", p.self))
 	if err != nil {
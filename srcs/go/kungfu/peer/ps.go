@@ -0,0 +1,433 @@
+package peer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/kungfu/execution"
+	"github.com/lsds/KungFu/srcs/go/kungfu/ps"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+)
+
+// psAckTimeout bounds the wait for a batch of updates to be applied by a server
+const psAckTimeout = 30 * time.Second
+
+var (
+	errNotPSServer  = errors.New("not a parameter server, see ps.ServerRole")
+	errNoPSServer   = errors.New("no parameter server in the cluster")
+	errPSAckTimeout = errors.New("updates not acknowledged by the parameter server in time")
+	errPSNotFound   = errors.New("tensor not found on the parameter servers")
+)
+
+// psState is the state of the parameter server mode, see package ps.
+// A server holds the shards it owns as the primary or the backup, a worker holds its pushes which are not sent yet.
+type psState struct {
+	shards  *ps.Shards
+	pending *ps.Coalescer
+	flushMu sync.Mutex // batches are sent in the order of the pushes
+	flusher sync.Once
+
+	mu      sync.Mutex
+	servers plan.PeerList // of the current session
+	seq     uint64
+	acks    map[uint64]chan struct{}
+	pulls   map[string]*psPull
+	err     error // of the last flush in the background, returned by the next PSFlush
+	stop    bool  // requested by PSStop, to be agreed at the next step fence
+	stopped bool
+}
+
+// psPull is a pull in flight, which concurrent pulls of the same tensor wait for
+type psPull struct {
+	done chan struct{}
+	data *kb.Vector
+	err  error
+}
+
+func (s *psState) init() {
+	s.shards = ps.NewShards()
+	s.pending = ps.NewCoalescer()
+	s.acks = make(map[uint64]chan struct{})
+	s.pulls = make(map[string]*psPull)
+}
+
+func (s *psState) setServers(servers plan.PeerList) plan.PeerList {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.servers
+	s.servers = servers
+	return old
+}
+
+func (s *psState) getServers() plan.PeerList {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.servers
+}
+
+func (s *psState) expect() (uint64, chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	ch := make(chan struct{})
+	s.acks[s.seq] = ch
+	return s.seq, ch
+}
+
+func (s *psState) ack(seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ch, ok := s.acks[seq]; ok {
+		close(ch)
+		delete(s.acks, seq)
+	}
+}
+
+func (s *psState) forget(seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.acks, seq)
+}
+
+func (s *psState) setErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *psState) takeErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.err
+	s.err = nil
+	return err
+}
+
+// joinPull returns the pull of the tensor in flight, and whether the caller is to run it
+func (s *psState) joinPull(name string) (*psPull, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.pulls[name]; ok {
+		return c, false
+	}
+	c := &psPull{done: make(chan struct{})}
+	s.pulls[name] = c
+	return c, true
+}
+
+func (s *psState) endPull(name string, c *psPull) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pulls, name)
+	close(c.done)
+}
+
+func (s *psState) requestStop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stop = true
+}
+
+// fence returns the value of this peer to be agreed at the step fence
+func (s *psState) fence() int8 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop {
+		return 1
+	}
+	return 0
+}
+
+func (s *psState) agree(stop int8) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = s.stopped || stop != 0
+}
+
+func (s *psState) isStopped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopped
+}
+
+// psServersOf returns the servers among the peers of a session
+func (p *Peer) psServersOf(pl plan.PeerList) plan.PeerList {
+	if p.roles == nil {
+		return nil
+	}
+	var servers plan.PeerList
+	for _, rank := range p.roles.Ranks(ps.ServerRole, len(pl)) {
+		servers = append(servers, pl[rank])
+	}
+	return servers
+}
+
+// PSInit creates the tensor on its servers as x if it doesn't exist, e.g. all workers push the initial weights.
+func (p *Peer) PSInit(name string, x *kb.Vector) error {
+	if err := p.psAdd(ps.Update{Name: name, Kind: ps.Init, Data: x}); err != nil {
+		return err
+	}
+	return p.PSFlush()
+}
+
+// PSPush reduces x into the tensor on its servers by op, which is created as x if it doesn't exist.
+// Pushes are coalesced for config.PSCoalesceWindow and sent in the background, PSFlush waits for them to be applied.
+func (p *Peer) PSPush(name string, x *kb.Vector, op kb.OP) error {
+	if !op.Supports(x.Type) {
+		return fmt.Errorf("op %s doesn't support %s", op, x.Type)
+	}
+	return p.psAdd(ps.Update{Name: name, Kind: ps.Reduce, OP: op, Data: x})
+}
+
+func (p *Peer) psAdd(u ps.Update) error {
+	p.CurrentSession() // the servers are known once there is a session
+	if len(p.ps.getServers()) == 0 {
+		return errNoPSServer
+	}
+	if size := p.ps.pending.Add(u); size >= config.PSCoalesceSize || config.PSCoalesceWindow <= 0 {
+		return p.PSFlush()
+	}
+	p.ps.flusher.Do(func() { go p.flushPSPeriodically() })
+	return nil
+}
+
+func (p *Peer) flushPSPeriodically() {
+	tk := time.NewTicker(config.PSCoalesceWindow)
+	defer tk.Stop()
+	for {
+		select {
+		case <-tk.C:
+			if err := p.flushPS(); err != nil {
+				log.Warnf("failed to flush pushes to parameter servers: %v", err)
+				p.ps.setErr(err)
+			}
+		case <-p.closed:
+			return
+		}
+	}
+}
+
+// PSFlush sends the pending pushes of this peer, and waits for them to be applied by the servers,
+// it returns the error of the pushes sent in the background since the last PSFlush if any.
+func (p *Peer) PSFlush() error {
+	if err := p.flushPS(); err != nil {
+		return err
+	}
+	return p.ps.takeErr()
+}
+
+func (p *Peer) flushPS() error {
+	p.ps.flushMu.Lock()
+	defer p.ps.flushMu.Unlock()
+	us := p.ps.pending.Take()
+	if len(us) == 0 {
+		return nil
+	}
+	servers := p.ps.getServers()
+	batches := make(map[plan.PeerID][]ps.Update)
+	var targets plan.PeerList
+	for _, u := range us {
+		primary, _, ok := ps.Owners(u.Name, servers)
+		if !ok {
+			return errNoPSServer
+		}
+		if _, ok := batches[primary]; !ok {
+			targets = append(targets, primary)
+		}
+		batches[primary] = append(batches[primary], u)
+	}
+	var f execution.PeerFunc = func(id plan.PeerID) error {
+		return p.sendPSBatch(id, ps.PushName, batches[id])
+	}
+	return f.Par(targets)
+}
+
+// sendPSBatch sends the updates to a server, and waits for them to be applied
+func (p *Peer) sendPSBatch(target plan.PeerID, name string, us []ps.Update) error {
+	seq, ch := p.ps.expect()
+	b := ps.Batch{Seq: seq, Updates: us}
+	if err := p.router.Send(target.WithName(name), b.Encode(), connection.ConnControl, connection.NoFlag); err != nil {
+		p.ps.forget(seq)
+		return err
+	}
+	select {
+	case <-ch:
+		return nil
+	case <-time.After(psAckTimeout):
+		p.ps.forget(seq)
+		return errPSAckTimeout
+	}
+}
+
+// PSPull copies the tensor from its primary server into buf, or from its backup if the primary fails,
+// after the pending pushes of this peer are applied. Concurrent pulls of the same tensor share a request.
+func (p *Peer) PSPull(name string, buf *kb.Vector) error {
+	if err := p.PSFlush(); err != nil {
+		return err
+	}
+	c, run := p.ps.joinPull(name)
+	if run {
+		c.data = kb.NewVector(buf.Count, buf.Type)
+		c.err = p.pullPS(name, c.data)
+		p.ps.endPull(name, c)
+	} else {
+		<-c.done
+	}
+	if c.err != nil {
+		return c.err
+	}
+	if c.data.Count != buf.Count || c.data.Type != buf.Type {
+		return fmt.Errorf("concurrent pulls of %s of different sizes", name)
+	}
+	buf.CopyFrom(c.data)
+	return nil
+}
+
+func (p *Peer) pullPS(name string, buf *kb.Vector) error {
+	primary, backup, ok := ps.Owners(name, p.ps.getServers())
+	if !ok {
+		return errNoPSServer
+	}
+	found, err := p.router.P2P.Request(primary.WithName(ps.Key(name)), "", asMessage(buf))
+	if (err != nil || !found) && backup != primary {
+		log.Debugf("failed to pull %s from %s, pulling from backup %s", name, primary, backup)
+		found, err = p.router.P2P.Request(backup.WithName(ps.Key(name)), "", asMessage(buf))
+	}
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errPSNotFound
+	}
+	return nil
+}
+
+// PSStop asks the servers to stop serving at the next step fence, which is agreed by all peers
+func (p *Peer) PSStop() {
+	p.ps.requestStop()
+}
+
+// ServePS serves the shards of a server rank until the workers call PSStop, or this peer is detached from the cluster.
+// Servers follow the steps of the workers, since resizes and the stop are agreed at the step fence.
+func (p *Peer) ServePS() error {
+	if role, _ := p.Role(); role != ps.ServerRole {
+		return errNotPSServer
+	}
+	for {
+		if err := p.BeginStep(); err != nil {
+			return err
+		}
+		_, detached, err := p.EndStep()
+		if err != nil {
+			return err
+		}
+		if detached || p.ps.isStopped() {
+			return nil
+		}
+	}
+}
+
+// handlePSBatch applies a batch of updates to the shards of this server, and saves them to the peer to peer store to be pulled.
+// A push is replicated to the backups before it's acknowledged, so that no acknowledged update is lost if a primary fails.
+func (p *Peer) handlePSBatch(name string, msg *connection.Message, conn connection.Connection) {
+	var b ps.Batch
+	if err := b.Decode(msg.Data); err != nil {
+		log.Warnf("invalid ps batch from %s: %v", conn.Src(), err)
+		return
+	}
+	servers := p.ps.getServers()
+	replicas := make(map[plan.PeerID][]ps.Update)
+	var backups plan.PeerList
+	for _, u := range b.Updates {
+		x, err := p.ps.shards.Apply(u)
+		if err != nil {
+			log.Warnf("ps update from %s: %v", conn.Src(), err)
+			continue
+		}
+		if err := p.router.P2P.Save(ps.Key(u.Name), x); err != nil {
+			log.Warnf("failed to save %s: %v", u.Name, err)
+		}
+		if name != ps.PushName {
+			continue
+		}
+		if _, backup, ok := ps.Owners(u.Name, servers); ok && backup != p.self {
+			if _, ok := replicas[backup]; !ok {
+				backups = append(backups, backup)
+			}
+			replicas[backup] = append(replicas[backup], u)
+		}
+	}
+	var f execution.PeerFunc = func(id plan.PeerID) error {
+		return p.sendPSBatch(id, ps.ReplicaName, replicas[id])
+	}
+	if err := f.Par(backups); err != nil {
+		log.Warnf("failed to replicate ps updates from %s: %v", conn.Src(), err)
+	}
+	if b.Seq == 0 {
+		return
+	}
+	bs := make([]byte, 8)
+	binary.LittleEndian.PutUint64(bs, b.Seq)
+	if err := p.router.Send(conn.Src().WithName(ps.AckName), bs, connection.ConnControl, connection.NoFlag); err != nil {
+		log.Warnf("failed to acknowledge ps updates of %s: %v", conn.Src(), err)
+	}
+}
+
+func (p *Peer) handlePSAck(_name string, msg *connection.Message, conn connection.Connection) {
+	if len(msg.Data) != 8 {
+		log.Warnf("invalid ps ack from %s", conn.Src())
+		return
+	}
+	p.ps.ack(binary.LittleEndian.Uint64(msg.Data))
+}
+
+// rebalancePS moves the shards to their owners among the servers of a new session, before the barrier of the session,
+// so that a server which joins gets its shards, and a backup which takes over from a failed primary gets a new backup.
+// A shard is handed over by its previous primary, or by its previous backup if the primary left, the shard is lost if both left.
+func (p *Peer) rebalancePS(pl plan.PeerList) {
+	servers := p.psServersOf(pl)
+	old := p.ps.setServers(servers)
+	if len(old) == 0 || !servers.Contains(p.self) {
+		return
+	}
+	handovers := make(map[plan.PeerID][]ps.Update)
+	var targets plan.PeerList
+	for _, name := range p.ps.shards.Names() {
+		primary, backup, _ := ps.Owners(name, old)
+		source := primary == p.self || (backup == p.self && !servers.Contains(primary))
+		newPrimary, newBackup, _ := ps.Owners(name, servers)
+		x, ok := p.ps.shards.Get(name)
+		if !ok {
+			continue
+		}
+		for _, id := range []plan.PeerID{newPrimary, newBackup} {
+			if !source || id == p.self || (id == newBackup && newBackup == newPrimary) {
+				continue
+			}
+			if _, ok := handovers[id]; !ok {
+				targets = append(targets, id)
+			}
+			handovers[id] = append(handovers[id], ps.Update{Name: name, Kind: ps.Set, Data: x})
+		}
+		if p.self != newPrimary && p.self != newBackup {
+			p.ps.shards.Delete(name)
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+	log.Infof("handing ps shards over to %d servers", len(targets))
+	var f execution.PeerFunc = func(id plan.PeerID) error {
+		return p.sendPSBatch(id, ps.ReplicaName, handovers[id])
+	}
+	if err := f.Par(targets); err != nil {
+		log.Errorf("failed to hand ps shards over: %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package peer
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/monitor"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/client"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+)
+
+const queueCheckPeriod = 1 * time.Second
+
+type queueKey struct {
+	remote   plan.PeerID
+	t        connection.ConnType
+	priority bool
+}
+
+func (p *Peer) queueGauges() []monitor.QueueGauge {
+	var gs []monitor.QueueGauge
+	for _, s := range p.router.client.QueueStats() {
+		gs = append(gs, monitor.QueueGauge{Remote: s.Peer, Type: queueType(s), Depth: s.Depth, OldestAge: s.OldestAge})
+	}
+	return gs
+}
+
+func queueType(s client.QueueStat) string {
+	if s.Priority {
+		return s.Type.String() + "+priority"
+	}
+	return s.Type.String()
+}
+
+func exceedsQueueThresholds(s client.QueueStat) bool {
+	return (config.QueueDepthAlert > 0 && s.Depth > config.QueueDepthAlert) ||
+		(config.QueueAgeAlert > 0 && s.OldestAge > config.QueueAgeAlert)
+}
+
+// watchQueues exports the send queues as metrics, and alerts the parent once a queue exceeds the thresholds for config.QueueAlertAfter
+func (p *Peer) watchQueues() {
+	monitor.SetQueueGauges(p.queueGauges)
+	if config.QueueDepthAlert <= 0 && config.QueueAgeAlert <= 0 {
+		return
+	}
+	exceeded := make(map[queueKey]time.Time)
+	alerted := make(map[queueKey]bool)
+	tk := time.NewTicker(queueCheckPeriod)
+	defer tk.Stop()
+	for {
+		select {
+		case <-tk.C:
+		case <-p.closed:
+			return
+		}
+		now := time.Now()
+		stillExceeded := make(map[queueKey]time.Time)
+		stillAlerted := make(map[queueKey]bool)
+		for _, s := range p.router.client.QueueStats() {
+			if !exceedsQueueThresholds(s) {
+				continue
+			}
+			k := queueKey{remote: s.Peer, t: s.Type, priority: s.Priority}
+			since, ok := exceeded[k]
+			if !ok {
+				since = now
+			}
+			stillExceeded[k] = since
+			stillAlerted[k] = alerted[k]
+			if !alerted[k] && now.Sub(since) >= config.QueueAlertAfter {
+				p.alertQueue(monitor.QueueAlert{Peer: p.self, Remote: s.Peer, Type: queueType(s), Depth: s.Depth, OldestAge: s.OldestAge, Since: since})
+				stillAlerted[k] = true
+			}
+		}
+		exceeded, alerted = stillExceeded, stillAlerted
+	}
+}
+
+// alertQueue logs the alert and sends it to the parent in background, the parent only listens in watch mode
+func (p *Peer) alertQueue(a monitor.QueueAlert) {
+	log.Warnf("%s", a)
+	bs, err := json.Marshal(a)
+	if err != nil {
+		return
+	}
+	go func() {
+		if err := p.router.Send(p.parent.WithName(monitor.QueueAlertName), bs, connection.ConnControl, connection.NoFlag); err != nil {
+			log.Debugf("failed to send queue alert to %s: %v", p.parent, err)
+		}
+	}()
+}
@@ -0,0 +1,136 @@
+package peer
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/rchannel/client"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+	"github.com/lsds/KungFu/srcs/go/utils"
+)
+
+// RestartName is the control message sent by kungfu-ctl rolling-restart, carrying the number of peers restarted at a time
+const RestartName = "restart"
+
+// maxRestartBatch bounds the number of peers restarted at a time, which is agreed at the step fence as an int8
+const maxRestartBatch = 127
+
+// restartState tracks a rolling restart: peers of the cluster when the restart is agreed at the step fence are replaced
+// by new peers on the same hosts, a batch at each EndStep, while the other peers wait for them in the barrier of the new session.
+type restartState struct {
+	mu        sync.Mutex
+	requested int // batch size requested by kungfu-ctl, to be agreed at the next step fence
+	batch     int // batch size of the agreed restart if this peer is yet to be replaced, 0 otherwise
+	rolling   int // batch size agreed at the last step fence, 0 if no peer is to be replaced
+}
+
+func (s *restartState) request(batch int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requested = batch
+}
+
+// fence returns the values of this peer to be agreed at the step fence
+func (s *restartState) fence() (int8, int8) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int8(s.requested), int8(s.batch)
+}
+
+// agree applies the values agreed at the step fence, all peers become stale if a new restart is requested
+func (s *restartState) agree(requested, batch int8) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if requested > 0 {
+		s.requested = 0
+		s.batch = int(requested)
+		s.rolling = int(requested)
+		return
+	}
+	s.rolling = int(batch)
+}
+
+// take returns the batch size agreed at the last step fence, once
+func (s *restartState) take() (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rolling := s.rolling
+	s.rolling = 0
+	return rolling, s.batch > 0
+}
+
+func (s *restartState) abort() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batch = 0
+}
+
+func (p *Peer) handleRestart(_name string, msg *connection.Message, conn connection.Connection) {
+	if len(p.configServerURL) == 0 {
+		log.Warnf("rolling restart requested by %s ignored, it requires a config server", conn.Src())
+		return
+	}
+	batch, err := strconv.Atoi(strings.TrimSpace(string(msg.Data)))
+	if err != nil || batch <= 0 {
+		batch = 1
+	}
+	if batch > maxRestartBatch {
+		batch = maxRestartBatch
+	}
+	log.Infof("rolling restart requested by %s, will restart %s at a time from the next step fence", conn.Src(), utils.Pluralize(batch, "peer", "peers"))
+	p.restart.request(batch)
+}
+
+// restartNext proposes to replace the next batch of peers yet to be restarted, which is applied by ResizeClusterFromURL in EndStep.
+// The root is restarted after all other peers, so that its replacement synchronises state from a peer which is not new.
+func (p *Peer) restartNext() error {
+	batch, stale := p.restart.take()
+	if batch == 0 {
+		return nil
+	}
+	sess := p.CurrentSession()
+	if sess.Size() == 1 {
+		log.Warnf("rolling restart aborted, the only peer can't be restarted")
+		p.restart.abort()
+		return nil
+	}
+	x := kb.NewVector(sess.Size(), kb.I8)
+	y := kb.NewVector(sess.Size(), kb.I8)
+	if stale {
+		x.AsI8()[sess.Rank()] = 1
+	}
+	w := kb.Workspace{SendBuf: x, RecvBuf: y, OP: kb.MAX, Name: "kungfu::restart", Stream: client.PriorityStream}
+	if err := sess.AllReduce(w); err != nil {
+		return err
+	}
+	if sess.Rank() != 0 {
+		return nil
+	}
+	var ranks []int
+	var left int
+	for rank, s := range y.AsI8() {
+		if s == 0 {
+			continue
+		}
+		left++
+		if rank > 0 && len(ranks) < batch {
+			ranks = append(ranks, rank)
+		}
+	}
+	if len(ranks) == 0 {
+		ranks = []int{0}
+	}
+	cluster := p.getCurrentCluster()
+	newCluster, err := cluster.Restart(ranks)
+	if err != nil {
+		return err
+	}
+	log.Infof("rolling restart: restarting ranks %v, %d of %d peers left", ranks, left, sess.Size())
+	if err := p.proposeCluster(newCluster); err != nil {
+		log.Warnf("rolling restart: %v, will retry at the next step", err)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package peer
+
+// Role returns the role of the current rank and the rank among peers of the same role.
+// All peers have the empty role if the job doesn't define any.
+func (p *Peer) Role() (string, int) {
+	sess := p.CurrentSession()
+	if p.roles == nil {
+		return "", sess.Rank()
+	}
+	return p.roles.RoleOf(sess.Rank(), sess.Size())
+}
+
+// RoleRanks returns the ranks of peers of the same role as the current rank, in the current session
+func (p *Peer) RoleRanks() []int {
+	sess := p.CurrentSession()
+	if p.roles == nil {
+		ranks := make([]int, sess.Size())
+		for i := range ranks {
+			ranks[i] = i
+		}
+		return ranks
+	}
+	role, _ := p.roles.RoleOf(sess.Rank(), sess.Size())
+	return p.roles.Ranks(role, sess.Size())
+}
@@ -60,6 +60,10 @@ func (r *router) Wait(ctx context.Context, target plan.PeerID) (int, error) {
 func (r *router) Handle(conn connection.Connection) (int, error) {
 	switch t := conn.Type(); t {
 	case connection.ConnCollective:
+		if connection.IsDuplex(conn) {
+			r.client.Adopt(conn)
+			defer r.client.Release(conn)
+		}
 		return r.Collective.Handle(conn)
 	case connection.ConnPeerToPeer:
 		return r.P2P.Handle(conn)
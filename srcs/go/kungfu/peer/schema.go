@@ -0,0 +1,85 @@
+package peer
+
+import (
+	"fmt"
+	"math"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/kungfu/schema"
+	"github.com/lsds/KungFu/srcs/go/kungfu/session"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/rchannel/client"
+)
+
+// schemaBlobName is the blob of the declared tensors, fetched by peers to name the differences
+const schemaBlobName = "kungfu::tensor-schema"
+
+// DeclareTensor declares a tensor that this peer will reduce under name,
+// all peers having declared tensors must declare the same, which is checked by CheckTensorSchema and after every resize.
+func (p *Peer) DeclareTensor(name string, dtype kb.DataType, shape []int) error {
+	if err := p.schema.Declare(schema.Tensor{Name: name, DType: dtype, Shape: shape}); err != nil {
+		return err
+	}
+	p.router.P2P.PutBlob(schemaBlobName, p.schema.Encode())
+	return nil
+}
+
+// CheckTensorSchema must be called by all peers, it returns an error naming a tensor declared differently by two peers.
+// Peers that haven't declared any tensor, e.g. those just joined, are not checked.
+func (p *Peer) CheckTensorSchema() error {
+	return p.checkSchema(p.CurrentSession())
+}
+
+func (p *Peer) checkSchema(sess *session.Session) error {
+	fp := p.schema.Fingerprint()
+	declared := fp != 0
+	lo, hi := kb.NewVector(1, kb.I64), kb.NewVector(1, kb.I64)
+	lo.AsI64()[0], hi.AsI64()[0] = math.MaxInt64, 0 // peers without declarations agree with any
+	if declared {
+		x := int64(fp>>2) + 1
+		lo.AsI64()[0], hi.AsI64()[0] = x, x
+	}
+	if err := sess.AllReduce(kb.Workspace{SendBuf: lo, RecvBuf: lo, OP: kb.MIN, Name: "kungfu::schema:min", Stream: client.PriorityStream}); err != nil {
+		return err
+	}
+	if err := sess.AllReduce(kb.Workspace{SendBuf: hi, RecvBuf: hi, OP: kb.MAX, Name: "kungfu::schema:max", Stream: client.PriorityStream}); err != nil {
+		return err
+	}
+	if hi.AsI64()[0] == 0 || lo.AsI64()[0] == hi.AsI64()[0] {
+		return nil
+	}
+	// compare with the first peer having declared tensors, to name the difference
+	ref := kb.NewVector(1, kb.I32)
+	ref.AsI32()[0] = math.MaxInt32
+	if declared {
+		ref.AsI32()[0] = int32(sess.Rank())
+	}
+	if err := sess.AllReduce(kb.Workspace{SendBuf: ref, RecvBuf: ref, OP: kb.MIN, Name: "kungfu::schema:ref", Stream: client.PriorityStream}); err != nil {
+		return err
+	}
+	diff := fmt.Errorf("%v, see the errors of other peers", schema.ErrDiverged)
+	if other := int(ref.AsI32()[0]); declared && other != sess.Rank() {
+		if err := p.diffSchema(sess, other); err != nil {
+			diff = err
+		}
+	}
+	// the reference peer must serve its blob until all peers have fetched it
+	if err := sess.Barrier(); err != nil {
+		log.Warnf("barrier failed after checking tensor schema: %v", err)
+	}
+	return diff
+}
+
+func (p *Peer) diffSchema(sess *session.Session, other int) error {
+	bs, ok, err := p.router.P2P.GetBlob(sess.Peer(other).WithName(schemaBlobName))
+	if err != nil || !ok {
+		log.Warnf("failed to fetch tensor schema of rank %d: %v", other, err)
+		return nil
+	}
+	ts, err := schema.Decode(bs)
+	if err != nil {
+		log.Warnf("invalid tensor schema of rank %d: %v", other, err)
+		return nil
+	}
+	return schema.Diff(p.schema.Tensors(), sess.Rank(), ts, other)
+}
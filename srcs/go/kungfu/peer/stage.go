@@ -0,0 +1,75 @@
+package peer
+
+import (
+	"sync"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/execution"
+	"github.com/lsds/KungFu/srcs/go/kungfu/features"
+	"github.com/lsds/KungFu/srcs/go/kungfu/runner"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+)
+
+// sentStage is the last Stage sent to runners, which is resent in full to a runner missing the base of its delta
+type sentStage struct {
+	mu    sync.Mutex
+	stage runner.Stage
+}
+
+func (s *sentStage) set(stage runner.Stage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stage = stage
+}
+
+func (s *sentStage) get() runner.Stage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stage
+}
+
+func (p *Peer) handleUpdateNack(_name string, msg *connection.Message, conn connection.Connection) {
+	version, err := runner.DecodeUpdateNack(msg.Data)
+	if err != nil {
+		log.Warnf("invalid update nack from %s: %v", conn.Src(), err)
+		return
+	}
+	s := p.sent.get()
+	if s.Version != version {
+		log.Warnf("%s asked for v%d, but the last sent is v%d", conn.Src(), version, s.Version)
+		return
+	}
+	name, bs := runner.EncodeUpdate(s, nil, features.Enabled(features.CompressStages))
+	log.Infof("resending v%d to %s in full", version, conn.Src())
+	go func() {
+		if err := p.router.Send(conn.Src().WithName(name), bs, connection.ConnControl, connection.NoFlag); err != nil {
+			log.Errorf("failed to resend v%d to %s: %v", version, conn.Src(), err)
+		}
+	}()
+}
+
+// notifyRoot sends a Stage to the root of the fan-out tree, and waits until it is forwarded to all runners,
+// it returns the runners which didn't receive it.
+func (p *Peer) notifyRoot(notify execution.PeerFunc, s runner.Stage) (plan.PeerList, error) {
+	root := s.Cluster.Runners[0]
+	p.acks.Expect(s.Version, root)
+	if err := notify(root); err != nil {
+		p.acks.Forget(s.Version, root)
+		return nil, err
+	}
+	ack, err := p.acks.Wait(s.Version, root, runner.StageAckTimeout(s.Cluster.Runners, root))
+	if err != nil {
+		return nil, err
+	}
+	return ack.Failed, nil
+}
+
+func (p *Peer) handleUpdateAck(_name string, msg *connection.Message, conn connection.Connection) {
+	var ack runner.StageAck
+	if err := ack.Decode(msg.Data); err != nil {
+		log.Warnf("invalid update ack from %s: %v", conn.Src(), err)
+		return
+	}
+	p.acks.Deliver(conn.Src(), ack)
+}
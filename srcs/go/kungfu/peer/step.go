@@ -0,0 +1,102 @@
+package peer
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/lsds/KungFu/srcs/go/log"
+)
+
+var (
+	errInStep       = errors.New("step already begun")
+	errNotInStep    = errors.New("step not begun")
+	errResizeInStep = errors.New("cluster can't change within a step, resize after EndStep")
+)
+
+// stepState tells if the peer is between BeginStep and EndStep,
+// the cluster is only changed out of steps so that no collective of a step spans two clusters.
+type stepState struct {
+	mu     sync.Mutex
+	inStep bool
+	steps  int
+}
+
+func (s *stepState) begin() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inStep {
+		return errInStep
+	}
+	s.inStep = true
+	return nil
+}
+
+// end returns the number of steps ended
+func (s *stepState) end() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.inStep {
+		return s.steps, errNotInStep
+	}
+	s.inStep = false
+	s.steps++
+	return s.steps, nil
+}
+
+func (s *stepState) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.steps
+}
+
+func (s *stepState) restore(steps int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.steps = steps
+}
+
+func (s *stepState) within() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inStep
+}
+
+// BeginStep marks the start of a step, the cluster stays the same until EndStep.
+// On an oversubscribed host, it waits for the turn of the peer among the ranks sharing its slot.
+func (p *Peer) BeginStep() error {
+	if err := p.step.begin(); err != nil {
+		return err
+	}
+	p.timeShare.begin()
+	return nil
+}
+
+// EndStep must be called by all peers at the end of each step begun by BeginStep,
+// it runs the StepFence, reports the checksum of the step and measures the global throughput if enabled, proposes the next batch of a rolling restart,
+// and applies the cluster changes of the config server if there is one.
+// It returns whether the cluster changed, and whether this peer is detached from it.
+func (p *Peer) EndStep() (bool, bool, error) {
+	steps, err := p.step.end()
+	if err != nil {
+		return false, false, err
+	}
+	p.timeShare.end()
+	if err := p.StepFence(); err != nil {
+		return false, false, err
+	}
+	p.reportChecksum()
+	if err := p.measureThroughput(); err != nil {
+		return false, false, err
+	}
+	if err := p.restartNext(); err != nil {
+		return false, false, err
+	}
+	if len(p.configServerURL) == 0 {
+		return false, false, nil
+	}
+	changed, detached, err := p.ResizeClusterFromURL()
+	if changed {
+		log.Infof("cluster changed after step %d", steps)
+	}
+	return changed, detached, err
+}
@@ -0,0 +1,41 @@
+package peer
+
+import (
+	"errors"
+	"fmt"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/kungfu/session"
+)
+
+var errStrategyMismatch = errors.New("peers use different strategies")
+
+// checkStrategy returns an error if a peer of sess uses another strategy or other options, with which collectives would hang.
+// They are exchanged by AllGather, which sends to each peer directly, as the graphs of the strategy can't be trusted before.
+func (p *Peer) checkStrategy(sess *session.Session) error {
+	x := encodeStrategy(p.strategy, p.strategyOptions)
+	n := x.Count
+	y := kb.NewVector(n*sess.Size(), kb.I64)
+	if err := sess.AllGather(kb.Workspace{SendBuf: x, RecvBuf: y, Name: "kungfu::strategy"}); err != nil {
+		return err
+	}
+	mine := kb.FormatStrategySpec(p.strategy, p.strategyOptions)
+	for r := 0; r < sess.Size(); r++ {
+		s, o := decodeStrategy(y.Slice(r*n, (r+1)*n))
+		if theirs := kb.FormatStrategySpec(s, o); theirs != mine {
+			return fmt.Errorf("%v: rank %d uses %s, rank %d uses %s", errStrategyMismatch, sess.Rank(), mine, r, theirs)
+		}
+	}
+	return nil
+}
+
+func encodeStrategy(s kb.Strategy, o kb.StrategyOptions) *kb.Vector {
+	x := kb.NewVector(4, kb.I64)
+	copy(x.AsI64(), []int64{int64(s), int64(o.Chunk), int64(o.Fanout), int64(o.Window)})
+	return x
+}
+
+func decodeStrategy(x *kb.Vector) (kb.Strategy, kb.StrategyOptions) {
+	v := x.AsI64()
+	return kb.Strategy(v[0]), kb.StrategyOptions{Chunk: int(v[1]), Fanout: int(v[2]), Window: int(v[3])}
+}
@@ -0,0 +1,71 @@
+package peer
+
+import (
+	"time"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/kungfu/throughput"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/rchannel/client"
+)
+
+// AddSamples counts the samples processed by this peer in the current step, for the global throughput.
+// Each step of a peer which doesn't count samples counts as a sample.
+func (p *Peer) AddSamples(n int) {
+	if p.throughput != nil {
+		p.throughput.Add(int64(n))
+	}
+}
+
+// Throughputs returns the latest global throughput of each of the latest cluster versions, measured every config.ThroughputPeriod steps
+func (p *Peer) Throughputs() []throughput.Snapshot {
+	return p.throughputs.Latest()
+}
+
+// measureThroughput reduces the samples and durations of all peers at the end of each window of steps,
+// which all peers close at the same step, since steps are counted from the start of the cluster version.
+func (p *Peer) measureThroughput() error {
+	if p.throughput == nil {
+		return nil
+	}
+	samples, d, step, ok := p.throughput.Step()
+	if !ok {
+		return nil
+	}
+	sess := p.CurrentSession()
+	x := kb.NewVector(1, kb.I64)
+	y := kb.NewVector(1, kb.I64)
+	x.AsI64()[0] = samples
+	w := kb.Workspace{SendBuf: x, RecvBuf: y, OP: kb.SUM, Name: "kungfu::throughput::samples", Stream: client.PriorityStream}
+	if err := sess.AllReduce(w); err != nil {
+		return err
+	}
+	samples = y.AsI64()[0]
+	x.AsI64()[0] = int64(d)
+	w = kb.Workspace{SendBuf: x, RecvBuf: y, OP: kb.MAX, Name: "kungfu::throughput::duration", Stream: client.PriorityStream}
+	if err := sess.AllReduce(w); err != nil {
+		return err
+	}
+	p.Lock()
+	version := p.clusterVersion
+	p.Unlock()
+	s := throughput.Snapshot{
+		Version:  version,
+		Peers:    sess.Size(),
+		Step:     step,
+		Steps:    config.ThroughputPeriod,
+		Samples:  samples,
+		Duration: time.Duration(y.AsI64()[0]),
+	}
+	prev, ok := p.throughputs.Add(s)
+	if sess.Rank() != 0 {
+		return nil
+	}
+	if ok {
+		log.Infof("throughput %s, %.2fx of %s", s, s.Speedup(prev), prev)
+	} else {
+		log.Debugf("throughput %s", s)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package peer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/env"
+)
+
+// timeShare staggers the steps of the ranks sharing a slot of an oversubscribed host,
+// the rank of turn k of n starts each step k/n of the duration of its last step later, so that they don't all compute at once.
+type timeShare struct {
+	env.TimeShare
+
+	mu    sync.Mutex
+	last  time.Duration // from the end of the stagger to EndStep in the last step
+	begun time.Time
+}
+
+func newTimeShare(t *env.TimeShare) *timeShare {
+	if t == nil || t.Turns <= 1 {
+		return nil
+	}
+	return &timeShare{TimeShare: *t}
+}
+
+func (t *timeShare) begin() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if d := t.last * time.Duration(t.Turn) / time.Duration(t.Turns); d > 0 {
+		time.Sleep(d)
+	}
+	t.begun = time.Now()
+}
+
+func (t *timeShare) end() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last = time.Since(t.begun)
+}
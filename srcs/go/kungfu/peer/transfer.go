@@ -0,0 +1,173 @@
+package peer
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/sealed"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/utils"
+)
+
+const (
+	transferChunkSize = 4 << 20
+	transferWindow    = 4 // max number of chunks in flight
+)
+
+var (
+	errBlobNotFound = errors.New("blob not found")
+	errBlobChanged  = errors.New("blob changed during transfer")
+)
+
+// transferState is saved beside the partial file, so that an interrupted transfer can be resumed
+type transferState struct {
+	Source     plan.PeerID
+	Name       string
+	Generation uint64
+	Total      int64
+	ChunkSize  int64
+	Done       []bool
+}
+
+func (s *transferState) matches(t transferState) bool {
+	return s.Name == t.Name && s.Generation == t.Generation && s.Total == t.Total && s.ChunkSize == t.ChunkSize && len(s.Done) == len(t.Done)
+}
+
+func loadTransferState(filename string) *transferState {
+	bs, err := sealed.ReadFile(filename)
+	if err != nil {
+		return nil
+	}
+	var s transferState
+	if err := json.Unmarshal(bs, &s); err != nil {
+		return nil
+	}
+	return &s
+}
+
+func (s *transferState) save(filename string) error {
+	bs, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return sealed.WriteFile(filename, bs, 0600)
+}
+
+// PullBlob fetches the blob saved by PutBlob on the target peer into filename in chunks,
+// an interrupted transfer of the same blob is resumed from the chunks already received.
+// It is used by a rejoining peer to pull the latest state from a healthy peer instead of shared storage.
+func (p *Peer) PullBlob(target plan.PeerID, name, filename string) error {
+	info, ok, err := p.router.P2P.GetBlobRange(target, name, 0, 0)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errBlobNotFound
+	}
+	partFile := filename + ".part"
+	stateFile := partFile + ".json"
+	state := transferState{
+		Source:     target,
+		Name:       name,
+		Generation: info.Generation,
+		Total:      info.Total,
+		ChunkSize:  transferChunkSize,
+		Done:       make([]bool, ceilDiv64(info.Total, transferChunkSize)),
+	}
+	if s := loadTransferState(stateFile); s != nil && s.matches(state) {
+		state.Done = s.Done
+	}
+	f, err := os.OpenFile(partFile, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := f.Truncate(state.Total); err != nil {
+		return err
+	}
+	var missing []int
+	for i, done := range state.Done {
+		if !done {
+			missing = append(missing, i)
+		}
+	}
+	if n := len(state.Done) - len(missing); n > 0 {
+		log.Infof("resuming transfer of %s from %s, %d/%d chunks received", name, target, n, len(state.Done))
+	}
+	var mu sync.Mutex
+	var changed bool
+	chunks := make(chan int)
+	errs := make([]error, transferWindow)
+	var wg sync.WaitGroup
+	for w := 0; w < transferWindow; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := range chunks {
+				if errs[w] != nil {
+					continue
+				}
+				if errs[w] = p.pullChunk(f, target, name, int64(i)*state.ChunkSize, state); errs[w] != nil {
+					if errs[w] == errBlobChanged {
+						mu.Lock()
+						changed = true
+						mu.Unlock()
+					}
+					continue
+				}
+				mu.Lock()
+				state.Done[i] = true
+				errs[w] = state.save(stateFile)
+				mu.Unlock()
+			}
+		}(w)
+	}
+	for _, i := range missing {
+		chunks <- i
+	}
+	close(chunks)
+	wg.Wait()
+	if changed {
+		os.Remove(stateFile)
+		return errBlobChanged
+	}
+	if err := utils.MergeErrors(errs, "PullBlob"); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := os.Rename(partFile, filename); err != nil {
+		return err
+	}
+	os.Remove(stateFile)
+	return nil
+}
+
+func (p *Peer) pullChunk(f *os.File, target plan.PeerID, name string, offset int64, state transferState) error {
+	chunk, ok, err := p.router.P2P.GetBlobRange(target, name, offset, state.ChunkSize)
+	if err != nil {
+		return err
+	}
+	if !ok || chunk.Generation != state.Generation || chunk.Total != state.Total {
+		return errBlobChanged
+	}
+	_, err = f.WriteAt(chunk.Data, offset)
+	return err
+}
+
+// PullBlobFromRank is PullBlob from the peer of given rank in the current session
+func (p *Peer) PullBlobFromRank(rank int, name, filename string) error {
+	sess := p.CurrentSession()
+	if rank < 0 || sess.Size() <= rank {
+		return errInvalidRank
+	}
+	return p.PullBlob(sess.Peer(rank), name, filename)
+}
+
+func ceilDiv64(a, b int64) int64 {
+	return (a + b - 1) / b
+}
@@ -0,0 +1,103 @@
+package peer
+
+import (
+	"sync"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/kungfu/session"
+	"github.com/lsds/KungFu/srcs/go/kungfu/tunables"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/rchannel/client"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+)
+
+// tuneState holds the tunables in effect, and those requested by kungfu-ctl tune which take effect at the next step fence
+type tuneState struct {
+	mu      sync.Mutex
+	current tunables.Tunables
+	pending tunables.Tunables
+}
+
+func (s *tuneState) init(opts kb.StrategyOptions) {
+	s.current = tunables.Default()
+	if opts.Chunk > 0 {
+		s.current.ChunkSize = opts.Chunk
+	}
+	s.pending = s.current
+}
+
+func (s *tuneState) get() (tunables.Tunables, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending, s.pending != s.current
+}
+
+func (s *tuneState) set(t tunables.Tunables) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = t
+	s.pending = t
+}
+
+func (p *Peer) handleTune(_name string, msg *connection.Message, conn connection.Connection) {
+	var u tunables.Update
+	if err := u.Decode(msg.Data); err != nil {
+		log.Warnf("invalid tune message from %s: %v", conn.Src(), err)
+		return
+	}
+	p.tune.mu.Lock()
+	defer p.tune.mu.Unlock()
+	t, err := u.Apply(p.tune.pending)
+	if err != nil {
+		log.Warnf("tune requested by %s rejected: %v", conn.Src(), err)
+		return
+	}
+	p.tune.pending = t
+	log.Infof("tune requested by %s: %s, will apply at the next step fence", conn.Src(), t)
+}
+
+// Tunables returns the runtime knobs in effect
+func (p *Peer) Tunables() tunables.Tunables {
+	p.tune.mu.Lock()
+	defer p.tune.mu.Unlock()
+	return p.tune.current
+}
+
+// applyTunables applies the requested tunables if all peers have requested the same,
+// otherwise they are retried at the next step fence, when the message may have arrived at all peers.
+func (p *Peer) applyTunables(sess *session.Session) error {
+	t, _ := p.tune.get()
+	ok, err := sess.BytesConsensus(t.Bytes(), "kungfu::tunables")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		log.Debugf("tunables diverge among peers, will retry at the next step fence")
+		return nil
+	}
+	p.tune.set(t)
+	sess.SetChunkSize(t.ChunkSize)
+	log.Infof("tunables applied: %s", t)
+	return nil
+}
+
+// syncTunables copies the tunables from rank 0 to the new session, so that peers joined by resize agree with the others
+func (p *Peer) syncTunables(sess *session.Session) error {
+	t := p.Tunables()
+	x := kb.NewVector(3, kb.I64)
+	x.AsI64()[0] = int64(t.ChunkSize)
+	x.AsI64()[1] = int64(t.FusionBufferSize)
+	if t.Compression {
+		x.AsI64()[2] = 1
+	}
+	w := kb.Workspace{SendBuf: x, RecvBuf: x, Name: "kungfu::sync-tunables", Stream: client.PriorityStream}
+	if err := sess.Broadcast(w); err != nil {
+		return err
+	}
+	t.ChunkSize = int(x.AsI64()[0])
+	t.FusionBufferSize = int(x.AsI64()[1])
+	t.Compression = x.AsI64()[2] != 0
+	p.tune.set(t)
+	sess.SetChunkSize(t.ChunkSize)
+	return nil
+}
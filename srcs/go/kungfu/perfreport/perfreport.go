@@ -0,0 +1,133 @@
+// Package perfreport reports how the Go runtime of a process spent memory and GC time over a run,
+// so that users can tell whether the allocations of the Go layer, e.g. of message buffers, are worth tuning.
+package perfreport
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/utils"
+)
+
+// topSites is the number of allocation sites in a Report
+const topSites = 10
+
+// Recorder remembers the state of the runtime when the run started
+type Recorder struct {
+	t0    time.Time
+	start runtime.MemStats
+}
+
+// Start starts recording, allocations are sampled by the default runtime.MemProfileRate
+func Start() *Recorder {
+	r := &Recorder{t0: time.Now()}
+	runtime.ReadMemStats(&r.start)
+	return r
+}
+
+// Site is a function allocating memory, outside of the runtime
+type Site struct {
+	Func    string
+	File    string
+	Line    int
+	Bytes   int64 // sampled, see runtime.MemProfile
+	Objects int64
+}
+
+// Report is the GC and allocation activity of the run
+type Report struct {
+	Duration      time.Duration
+	NumGC         uint32
+	PauseTotal    time.Duration
+	MaxPause      time.Duration // of the latest 256 GCs
+	GCCPUFraction float64
+	HeapStart     uint64 // bytes of live and not yet collected objects
+	HeapEnd       uint64
+	HeapSys       uint64 // bytes of heap obtained from the OS, which is never less than the peak heap
+	Allocated     uint64 // bytes allocated during the run
+	Mallocs       uint64
+	Sites         []Site // since the process started
+}
+
+// Report returns the activity since Start
+func (r *Recorder) Report() Report {
+	var end runtime.MemStats
+	runtime.ReadMemStats(&end)
+	rep := Report{
+		Duration:      time.Since(r.t0),
+		NumGC:         end.NumGC - r.start.NumGC,
+		PauseTotal:    time.Duration(end.PauseTotalNs - r.start.PauseTotalNs),
+		GCCPUFraction: end.GCCPUFraction,
+		HeapStart:     r.start.HeapAlloc,
+		HeapEnd:       end.HeapAlloc,
+		HeapSys:       end.HeapSys,
+		Allocated:     end.TotalAlloc - r.start.TotalAlloc,
+		Mallocs:       end.Mallocs - r.start.Mallocs,
+		Sites:         allocationSites(topSites),
+	}
+	for i := uint32(0); i < rep.NumGC && i < uint32(len(end.PauseNs)); i++ {
+		if d := time.Duration(end.PauseNs[(end.NumGC-i+255)%256]); d > rep.MaxPause {
+			rep.MaxPause = d
+		}
+	}
+	return rep
+}
+
+func (r Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "GC cycles: %d, paused %s in total, max %s, %.2f%% of CPU\n", r.NumGC, r.PauseTotal, r.MaxPause, r.GCCPUFraction*100)
+	fmt.Fprintf(&b, "heap: %s -> %s, %s from the OS\n", utils.ShowSize(int64(r.HeapStart)), utils.ShowSize(int64(r.HeapEnd)), utils.ShowSize(int64(r.HeapSys)))
+	fmt.Fprintf(&b, "allocated: %s in %d objects, %s", utils.ShowSize(int64(r.Allocated)), r.Mallocs, utils.ShowRate(utils.Rate(int64(r.Allocated), r.Duration)))
+	for i, s := range r.Sites {
+		fmt.Fprintf(&b, "\n#%d %s in %d objects: %s (%s:%d)", i+1, utils.ShowSize(s.Bytes), s.Objects, s.Func, path.Base(s.File), s.Line)
+	}
+	return b.String()
+}
+
+// allocationSites returns the n functions allocating the most bytes since the process started,
+// attributing the allocations of the runtime to their callers
+func allocationSites(n int) []Site {
+	runtime.GC() // publishes the allocations since the last GC to the profile
+	var records []runtime.MemProfileRecord
+	for {
+		m, ok := runtime.MemProfile(records, true)
+		if ok {
+			records = records[:m]
+			break
+		}
+		records = make([]runtime.MemProfileRecord, m+16)
+	}
+	sites := make(map[uintptr]*Site)
+	for _, rec := range records {
+		if rec.AllocBytes == 0 {
+			continue
+		}
+		frames := runtime.CallersFrames(rec.Stack())
+		for {
+			f, more := frames.Next()
+			if !strings.HasPrefix(f.Function, "runtime.") || !more {
+				s, ok := sites[f.Entry]
+				if !ok {
+					s = &Site{Func: f.Function, File: f.File, Line: f.Line}
+					sites[f.Entry] = s
+				}
+				s.Bytes += rec.AllocBytes
+				s.Objects += rec.AllocObjects
+				break
+			}
+		}
+	}
+	var ss []Site
+	for _, s := range sites {
+		ss = append(ss, *s)
+	}
+	sort.Slice(ss, func(i, j int) bool { return ss[i].Bytes > ss[j].Bytes })
+	if len(ss) > n {
+		ss = ss[:n]
+	}
+	return ss
+}
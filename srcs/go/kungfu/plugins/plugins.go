@@ -0,0 +1,103 @@
+// Package plugins loads custom reductions from Go plugins, e.g. median and trimmed mean for robust aggregation.
+// A plugin is built by go build -buildmode=plugin with the Go version of the runtime, it exports Name and one of Reduce and Aggregate,
+// which take vectors as bytes, so that the plugin doesn't depend on the packages of KungFu:
+//
+//	var Name = "median"
+//
+//	// Reduce must be associative and commutative, it's invoked by the reduce kernels
+//	func Reduce(dtype string, z, x, y []byte)
+//
+//	// Aggregate is given the contributions of all peers ordered by rank
+//	func Aggregate(dtype string, z []byte, xs [][]byte)
+//
+// WASM modules are not supported, no WASM runtime is linked.
+package plugins
+
+import (
+	"fmt"
+	"plugin"
+	"strings"
+	"sync"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/log"
+)
+
+var (
+	mu     sync.Mutex
+	loaded = make(map[string]kb.OP)
+)
+
+// LoadAll loads the plugins of a comma separated list of paths, in order, plugins already loaded are skipped
+func LoadAll(paths string) error {
+	for _, path := range strings.Split(paths, ",") {
+		if path = strings.TrimSpace(path); len(path) == 0 {
+			continue
+		}
+		if _, err := Load(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load registers the custom reduction of a plugin, and returns its OP
+func Load(path string) (kb.OP, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if op, ok := loaded[path]; ok {
+		return op, nil
+	}
+	p, err := plugin.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	name, err := lookupName(p)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", path, err)
+	}
+	var op kb.OP
+	if f, ok := lookup(p, "Reduce").(func(string, []byte, []byte, []byte)); ok {
+		op, err = kb.RegisterReduce(name, func(z, x, y *kb.Vector) {
+			f(z.Type.String(), z.Data, x.Data, y.Data)
+		})
+	} else if f, ok := lookup(p, "Aggregate").(func(string, []byte, [][]byte)); ok {
+		op, err = kb.RegisterAggregate(name, func(z *kb.Vector, xs []*kb.Vector) {
+			bs := make([][]byte, len(xs))
+			for i, x := range xs {
+				bs[i] = x.Data
+			}
+			f(z.Type.String(), z.Data, bs)
+		})
+	} else {
+		return 0, fmt.Errorf("%s: neither func Reduce(string, []byte, []byte, []byte) nor func Aggregate(string, []byte, [][]byte) is exported", path)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", path, err)
+	}
+	loaded[path] = op
+	log.Debugf("loaded %s reduction from %s as op %d", name, path, op)
+	return op, nil
+}
+
+func lookup(p *plugin.Plugin, symbol string) plugin.Symbol {
+	s, err := p.Lookup(symbol)
+	if err != nil {
+		return nil
+	}
+	return s
+}
+
+func lookupName(p *plugin.Plugin) (string, error) {
+	switch name := lookup(p, "Name").(type) {
+	case *string:
+		if len(*name) > 0 {
+			return *name, nil
+		}
+	case func() string:
+		if s := name(); len(s) > 0 {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("Name is not exported")
+}
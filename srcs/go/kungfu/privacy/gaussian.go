@@ -0,0 +1,114 @@
+// Package privacy applies differential privacy to the contributions of peers to reductions,
+// if KUNGFU_CONFIG_DP_EPSILON is set, so that DP-SGD can be trained by naming the gradient reductions with KUNGFU_CONFIG_DP_PREFIX.
+package privacy
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/log"
+)
+
+// Gaussian is the Gaussian mechanism: the contribution of each step is clipped to ClipNorm in L2 norm,
+// and noise of N(0, σ²/n) is added by each of the n contributors, so that the sum has noise of N(0, σ²),
+// where σ = ClipNorm * sqrt(2 ln(1.25/Delta)) / Epsilon.
+// A step contributes to Tensors reductions whose names start with Prefix, and each of them is clipped to ClipNorm/sqrt(Tensors),
+// so that the contributions of the step together are within ClipNorm.
+type Gaussian struct {
+	Epsilon  float64
+	Delta    float64
+	ClipNorm float64
+	Prefix   string
+	Tensors  int
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func NewGaussian(epsilon, delta, clipNorm float64, prefix string, tensors int) *Gaussian {
+	var seed int64
+	if err := binary.Read(crand.Reader, binary.LittleEndian, &seed); err != nil {
+		log.Warnf("failed to seed noise from crypto/rand: %v", err)
+	}
+	return &Gaussian{
+		Epsilon:  epsilon,
+		Delta:    delta,
+		ClipNorm: clipNorm,
+		Prefix:   prefix,
+		Tensors:  tensors,
+		rng:      rand.New(rand.NewSource(seed)),
+	}
+}
+
+var (
+	defaultOnce sync.Once
+	defaultMech *Gaussian
+)
+
+// Default returns the mechanism configured by KUNGFU_CONFIG_DP_*, nil if disabled
+func Default() *Gaussian {
+	defaultOnce.Do(func() {
+		if config.DPEpsilon > 0 {
+			defaultMech = NewGaussian(config.DPEpsilon, config.DPDelta, config.DPClipNorm, config.DPPrefix, config.DPTensors)
+			log.Infof("contributions to %d sum reductions per step named %s* are clipped to %g together and noised with σ=%g", defaultMech.Tensors, defaultMech.Prefix, defaultMech.ClipNorm, defaultMech.Sigma())
+		}
+	})
+	return defaultMech
+}
+
+// Sigma is the standard deviation of the noise of the sum
+func (g *Gaussian) Sigma() float64 {
+	return g.ClipNorm * math.Sqrt(2*math.Log(1.25/g.Delta)) / g.Epsilon
+}
+
+// Applies tells if the contributions of w are privatized, only float sum reductions named with Prefix are
+func (g *Gaussian) Applies(w kb.Workspace) bool {
+	return w.OP == kb.SUM && (w.SendBuf.Type == kb.F32 || w.SendBuf.Type == kb.F64) && strings.HasPrefix(w.Name, g.Prefix)
+}
+
+// Apply clips x and adds the share of noise of one of n contributors, in place
+func (g *Gaussian) Apply(x *kb.Vector, n int) {
+	sigma := g.Sigma() / math.Sqrt(float64(n))
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch x.Type {
+	case kb.F32:
+		xs := x.AsF32()
+		var norm float64
+		for _, v := range xs {
+			norm += float64(v) * float64(v)
+		}
+		scale := g.clipScale(math.Sqrt(norm))
+		for i, v := range xs {
+			xs[i] = float32(float64(v)*scale + g.rng.NormFloat64()*sigma)
+		}
+	case kb.F64:
+		xs := x.AsF64()
+		var norm float64
+		for _, v := range xs {
+			norm += v * v
+		}
+		scale := g.clipScale(math.Sqrt(norm))
+		for i, v := range xs {
+			xs[i] = v*scale + g.rng.NormFloat64()*sigma
+		}
+	}
+}
+
+// clipScale scales a tensor of the norm to its share of ClipNorm
+func (g *Gaussian) clipScale(norm float64) float64 {
+	clip := g.ClipNorm
+	if g.Tensors > 1 {
+		clip /= math.Sqrt(float64(g.Tensors))
+	}
+	if norm > clip {
+		return clip / norm
+	}
+	return 1
+}
@@ -0,0 +1,71 @@
+package privacy
+
+import (
+	"math"
+	"testing"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+)
+
+func Test_Gaussian(t *testing.T) {
+	g := NewGaussian(1, 1e-5, 1, `kungfu::dp::`, 1)
+	if s := g.Sigma(); math.Abs(s-4.8448) > 1e-3 {
+		t.Errorf("unexpected sigma: %f", s)
+	}
+	g.Epsilon = math.Inf(1) // no noise
+	x := kb.VectorF32([]float32{3, 4})
+	g.Apply(x, 4)
+	if xs := x.AsF32(); math.Abs(float64(xs[0])-0.6) > 1e-6 || math.Abs(float64(xs[1])-0.8) > 1e-6 {
+		t.Errorf("unexpected clipped: %v", xs)
+	}
+
+	g.Epsilon = 1
+	const n, np = 100000, 4
+	y := kb.NewVector(n, kb.F64)
+	g.Apply(y, np)
+	var sum, sq float64
+	for _, v := range y.AsF64() {
+		sum += v
+		sq += v * v
+	}
+	mean, std := sum/n, math.Sqrt(sq/n)
+	if want := g.Sigma() / 2; math.Abs(mean) > 0.05 || math.Abs(std-want) > 0.05 {
+		t.Errorf("unexpected noise: mean=%f std=%f, want std=%f", mean, std, want)
+	}
+}
+
+func Test_GaussianTensors(t *testing.T) {
+	g := NewGaussian(math.Inf(1), 1e-5, 1, `kungfu::dp::`, 4)
+	x := kb.VectorF32([]float32{3, 4})
+	y := kb.NewVector(2, kb.F64)
+	y.AsF64()[1] = 12
+	g.Apply(x, 1)
+	g.Apply(y, 1)
+	var norm float64
+	for _, v := range x.AsF32() {
+		norm += float64(v) * float64(v)
+	}
+	for _, v := range y.AsF64() {
+		norm += v * v
+	}
+	if want := math.Sqrt(2) / 2; math.Abs(math.Sqrt(norm)-want) > 1e-6 {
+		t.Errorf("unexpected norm of the step: %f, want %f", math.Sqrt(norm), want)
+	}
+}
+
+func Test_Applies(t *testing.T) {
+	g := NewGaussian(1, 1e-5, 1, `kungfu::dp::`, 1)
+	v := kb.NewVector(2, kb.F32)
+	for _, tc := range []struct {
+		w    kb.Workspace
+		want bool
+	}{
+		{kb.Workspace{SendBuf: v, RecvBuf: v, OP: kb.SUM, Name: `kungfu::dp::grad:0`}, true},
+		{kb.Workspace{SendBuf: v, RecvBuf: v, OP: kb.SUM, Name: `kungfu::go::allreduce:0`}, false},
+		{kb.Workspace{SendBuf: v, RecvBuf: v, OP: kb.MAX, Name: `kungfu::dp::grad:1`}, false},
+	} {
+		if got := g.Applies(tc.w); got != tc.want {
+			t.Errorf("Applies(%s, %s) = %v, want %v", tc.w.Name, tc.w.OP, got, tc.want)
+		}
+	}
+}
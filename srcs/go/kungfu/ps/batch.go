@@ -0,0 +1,99 @@
+package ps
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+)
+
+// Kind tells how an Update is applied to the shard of its tensor
+type Kind uint8
+
+const (
+	Reduce Kind = iota // the shard is reduced with the update by its OP, a missing shard is created as the update
+	Init               // the shard is created as the update if missing, e.g. the initial weights pushed by all workers
+	Set                // the shard is replaced, e.g. by a server handing the shard over to its new owner
+)
+
+// Update is an update of the shard of a tensor
+type Update struct {
+	Name string
+	Kind Kind
+	OP   kb.OP
+	Data *kb.Vector
+}
+
+// Batch is the updates sent to a server in a message, Seq is acknowledged if not 0
+type Batch struct {
+	Seq     uint64
+	Updates []Update
+}
+
+var (
+	endian = binary.LittleEndian
+
+	errInvalidBatch = errors.New("invalid ps batch")
+)
+
+type updateHeader struct {
+	NameLen uint16
+	Kind    uint8
+	OP      int32
+	Type    int32
+	Count   uint32
+}
+
+func (b Batch) Encode() []byte {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, endian, b.Seq)
+	binary.Write(buf, endian, uint32(len(b.Updates)))
+	for _, u := range b.Updates {
+		h := updateHeader{
+			NameLen: uint16(len(u.Name)),
+			Kind:    uint8(u.Kind),
+			OP:      int32(u.OP),
+			Type:    int32(u.Data.Type),
+			Count:   uint32(u.Data.Count),
+		}
+		binary.Write(buf, endian, h)
+		buf.WriteString(u.Name)
+		buf.Write(u.Data.Data)
+	}
+	return buf.Bytes()
+}
+
+func (b *Batch) Decode(bs []byte) error {
+	r := bytes.NewReader(bs)
+	var n uint32
+	if err := binary.Read(r, endian, &b.Seq); err != nil {
+		return errInvalidBatch
+	}
+	if err := binary.Read(r, endian, &n); err != nil {
+		return errInvalidBatch
+	}
+	b.Updates = nil
+	for i := 0; i < int(n); i++ {
+		var h updateHeader
+		if err := binary.Read(r, endian, &h); err != nil {
+			return errInvalidBatch
+		}
+		name := make([]byte, h.NameLen)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return errInvalidBatch
+		}
+		t := kb.DataType(h.Type)
+		if len(t.String()) == 0 || int(h.Count)*t.Size() > r.Len() {
+			return errInvalidBatch
+		}
+		x := kb.NewVector(int(h.Count), t)
+		io.ReadFull(r, x.Data)
+		b.Updates = append(b.Updates, Update{Name: string(name), Kind: Kind(h.Kind), OP: kb.OP(h.OP), Data: x})
+	}
+	if r.Len() > 0 {
+		return errInvalidBatch
+	}
+	return nil
+}
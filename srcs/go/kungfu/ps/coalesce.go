@@ -0,0 +1,66 @@
+package ps
+
+import (
+	"sync"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+)
+
+// Coalescer holds the updates of a worker which are not sent yet, and coalesces the updates of the same tensor,
+// so that a tensor pushed many times within the coalescing window is sent once.
+type Coalescer struct {
+	mu      sync.Mutex
+	pending []*Update
+	last    map[string]*Update // the last pending update of each tensor, into which the next update may be coalesced
+	size    int
+}
+
+func NewCoalescer() *Coalescer {
+	return &Coalescer{last: make(map[string]*Update)}
+}
+
+// Add adds a copy of the update, and returns the size of the pending updates in bytes
+func (c *Coalescer) Add(u Update) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := c.last[u.Name]; ok && coalescable(p, &u) {
+		if u.Kind == Reduce {
+			kb.Transform(p.Data, u.Data, u.OP)
+		} else {
+			p.Data.CopyFrom(u.Data)
+		}
+		return c.size
+	}
+	u.Data = clone(u.Data)
+	c.pending = append(c.pending, &u)
+	c.last[u.Name] = &u
+	c.size += len(u.Data.Data)
+	return c.size
+}
+
+func coalescable(p, u *Update) bool {
+	if p.Data.Count != u.Data.Count || p.Data.Type != u.Data.Type {
+		return false
+	}
+	switch u.Kind {
+	case Reduce:
+		return p.Kind == Reduce && p.OP == u.OP
+	case Set:
+		return p.Kind == Set
+	}
+	return false
+}
+
+// Take removes and returns the pending updates in the order they were added
+func (c *Coalescer) Take() []Update {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var us []Update
+	for _, u := range c.pending {
+		us = append(us, *u)
+	}
+	c.pending = nil
+	c.last = make(map[string]*Update)
+	c.size = 0
+	return us
+}
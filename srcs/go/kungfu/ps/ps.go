@@ -0,0 +1,55 @@
+// Package ps is the parameter server mode, an alternative to AllReduce which still beats it for some sparse workloads.
+// The ranks of ServerRole hold the shards of named tensors, which the other ranks update by pushes and read by pulls.
+// Each tensor is owned by a primary server, which replicates the updates to a backup server,
+// so that the backup takes over when the primary leaves the cluster.
+package ps
+
+import (
+	"hash/fnv"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+// ServerRole is the role of the server ranks, e.g. kungfu-run -np 4 train : -np 2 -role server serve
+const ServerRole = "server"
+
+// Names of control messages
+const (
+	PushName    = "kungfu::ps::push"    // a Batch of updates, from a worker to the primary
+	ReplicaName = "kungfu::ps::replica" // a Batch applied without forwarding, from the primary to the backup, and from a server to the new owners
+	AckName     = "kungfu::ps::ack"     // the Seq of an applied Batch, to its sender
+)
+
+// Key is the name of a tensor in the peer to peer store of its servers, from which it is pulled
+func Key(name string) string {
+	return "kungfu::ps::" + name
+}
+
+// Owners returns the primary and the backup servers of a tensor by rendezvous hashing,
+// so that only the tensors of a server which joins or leaves move to other servers.
+// The backup is the primary if there is only one server.
+func Owners(name string, servers plan.PeerList) (plan.PeerID, plan.PeerID, bool) {
+	var primary, backup plan.PeerID
+	var first, second uint64
+	for i, id := range servers {
+		w := weight(name, id)
+		if i == 0 || w > first {
+			primary, backup = id, primary
+			first, second = w, first
+			if i == 0 {
+				backup, second = id, w
+			}
+		} else if backup == primary || w > second {
+			backup, second = id, w
+		}
+	}
+	return primary, backup, len(servers) > 0
+}
+
+func weight(name string, id plan.PeerID) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(id.String()))
+	return h.Sum64()
+}
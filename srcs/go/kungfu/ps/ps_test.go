@@ -0,0 +1,100 @@
+package ps
+
+import (
+	"fmt"
+	"testing"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+func Test_Owners(t *testing.T) {
+	var servers plan.PeerList
+	for i := 0; i < 4; i++ {
+		servers = append(servers, plan.PeerID{IPv4: 1, Port: uint16(10000 + i)})
+	}
+	if _, _, ok := Owners("x", nil); ok {
+		t.Errorf("owners without servers")
+	}
+	if p, b, _ := Owners("x", servers[:1]); p != servers[0] || b != servers[0] {
+		t.Errorf("single server is not both primary and backup: %s %s", p, b)
+	}
+	left := servers[1]
+	others := servers.Others(left)
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("t%d", i)
+		p, b, _ := Owners(name, servers)
+		if p == b {
+			t.Fatalf("%s: primary is the backup", name)
+		}
+		q, c, _ := Owners(name, others)
+		switch {
+		case p == left && q != b:
+			t.Errorf("%s: backup %s didn't take over from %s, got %s", name, b, p, q)
+		case p != left && q != p:
+			t.Errorf("%s: primary moved from %s to %s", name, p, q)
+		case b != left && p != left && c != b:
+			t.Errorf("%s: backup moved from %s to %s", name, b, c)
+		}
+	}
+}
+
+func Test_Batch(t *testing.T) {
+	x := kb.VectorF32([]float32{1, 2, 3})
+	y := kb.NewVector(2, kb.I64)
+	b := Batch{Seq: 7, Updates: []Update{
+		{Name: "x", Kind: Reduce, OP: kb.MAX, Data: x},
+		{Name: "y", Kind: Set, Data: y},
+	}}
+	var c Batch
+	if err := c.Decode(b.Encode()); err != nil {
+		t.Fatal(err)
+	}
+	if c.Seq != 7 || len(c.Updates) != 2 || c.Updates[0].OP != kb.MAX || c.Updates[1].Kind != Set || c.Updates[1].Data.Type != kb.I64 {
+		t.Fatalf("unexpected batch %+v", c)
+	}
+	if got := c.Updates[0].Data.AsF32(); got[2] != 3 {
+		t.Errorf("unexpected data %v", got)
+	}
+	if err := c.Decode(b.Encode()[:20]); err == nil {
+		t.Errorf("truncated batch decoded")
+	}
+}
+
+func Test_Coalescer(t *testing.T) {
+	c := NewCoalescer()
+	c.Add(Update{Name: "w", Kind: Init, Data: kb.VectorF32([]float32{0})})
+	c.Add(Update{Name: "g", Kind: Reduce, OP: kb.SUM, Data: kb.VectorF32([]float32{1})})
+	c.Add(Update{Name: "g", Kind: Reduce, OP: kb.SUM, Data: kb.VectorF32([]float32{2})})
+	c.Add(Update{Name: "g", Kind: Reduce, OP: kb.MAX, Data: kb.VectorF32([]float32{5})})
+	if size := c.Add(Update{Name: "g", Kind: Reduce, OP: kb.MAX, Data: kb.VectorF32([]float32{4})}); size != 12 {
+		t.Errorf("pending size is %d", size)
+	}
+	us := c.Take()
+	if len(us) != 3 || us[0].Name != "w" || us[1].Data.AsF32()[0] != 3 || us[2].Data.AsF32()[0] != 5 {
+		t.Fatalf("unexpected updates %+v", us)
+	}
+	if us := c.Take(); len(us) != 0 {
+		t.Errorf("updates taken twice")
+	}
+}
+
+func Test_Shards(t *testing.T) {
+	s := NewShards()
+	s.Apply(Update{Name: "w", Kind: Init, Data: kb.VectorF32([]float32{1, 1})})
+	s.Apply(Update{Name: "w", Kind: Init, Data: kb.VectorF32([]float32{9, 9})})
+	x, err := s.Apply(Update{Name: "w", Kind: Reduce, OP: kb.SUM, Data: kb.VectorF32([]float32{1, 2})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := x.AsF32(); got[0] != 2 || got[1] != 3 {
+		t.Errorf("unexpected shard %v", got)
+	}
+	if _, err := s.Apply(Update{Name: "w", Kind: Reduce, OP: kb.SUM, Data: kb.VectorF32([]float32{1})}); err == nil {
+		t.Errorf("push of a different size applied")
+	}
+	s.Apply(Update{Name: "w", Kind: Set, Data: kb.VectorF32([]float32{7})})
+	if x, _ := s.Get("w"); x.Count != 1 || x.AsF32()[0] != 7 {
+		t.Errorf("shard not replaced")
+	}
+}
@@ -0,0 +1,76 @@
+package ps
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+)
+
+// Shards are the tensors held by a server, as the primary or the backup
+type Shards struct {
+	mu     sync.Mutex
+	shards map[string]*kb.Vector
+}
+
+func NewShards() *Shards {
+	return &Shards{shards: make(map[string]*kb.Vector)}
+}
+
+// Apply applies the update, and returns a copy of the shard after the update
+func (s *Shards) Apply(u Update) (*kb.Vector, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	x, ok := s.shards[u.Name]
+	if ok && u.Kind != Set && (x.Count != u.Data.Count || x.Type != u.Data.Type) {
+		return nil, fmt.Errorf("%s: %d %s pushed to a shard of %d %s", u.Name, u.Data.Count, u.Data.Type, x.Count, x.Type)
+	}
+	switch {
+	case !ok || u.Kind == Set:
+		x = kb.NewVector(u.Data.Count, u.Data.Type)
+		x.CopyFrom(u.Data)
+		s.shards[u.Name] = x
+	case u.Kind == Reduce:
+		if !u.OP.Supports(x.Type) {
+			return nil, fmt.Errorf("%s: op %s doesn't support %s", u.Name, u.OP, x.Type)
+		}
+		kb.Transform(x, u.Data, u.OP)
+	}
+	return clone(x), nil
+}
+
+// Get returns a copy of the shard
+func (s *Shards) Get(name string) (*kb.Vector, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	x, ok := s.shards[name]
+	if !ok {
+		return nil, false
+	}
+	return clone(x), true
+}
+
+// Names returns the names of the shards in order
+func (s *Shards) Names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for name := range s.shards {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Shards) Delete(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.shards, name)
+}
+
+func clone(x *kb.Vector) *kb.Vector {
+	y := kb.NewVector(x.Count, x.Type)
+	y.CopyFrom(x)
+	return y
+}
@@ -0,0 +1,61 @@
+package robust
+
+import "math"
+
+// f16ToF32 converts IEEE 754 half precision bits to float32
+func f16ToF32(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	frac := uint32(h & 0x3ff)
+	switch exp {
+	case 0: // zero or subnormal
+		f := float32(math.Ldexp(float64(frac), -24))
+		if sign != 0 {
+			f = -f
+		}
+		return f
+	case 0x1f: // inf or NaN
+		return math.Float32frombits(sign | 0x7f800000 | frac<<13)
+	}
+	return math.Float32frombits(sign | (exp+127-15)<<23 | frac<<13)
+}
+
+// f32ToF16 converts float32 to IEEE 754 half precision bits, rounding to nearest even
+func f32ToF16(f float32) uint16 {
+	sign := uint16(math.Float32bits(f)>>16) & 0x8000
+	x := math.Abs(float64(f))
+	switch {
+	case math.IsNaN(x):
+		return sign | 0x7e00
+	case x >= 65520: // rounds up to inf
+		return sign | 0x7c00
+	case x < math.Ldexp(1, -14): // subnormal, which rounds up to the least normal as 0x0400
+		return sign | uint16(math.RoundToEven(math.Ldexp(x, 24)))
+	}
+	frac, exp := math.Frexp(x) // x = frac * 2^exp, 0.5 <= frac < 1
+	exp--
+	m := math.RoundToEven((2*frac - 1) * 1024)
+	if m == 1024 {
+		m = 0
+		exp++
+	}
+	if exp > 15 {
+		return sign | 0x7c00
+	}
+	return sign | uint16(exp+15)<<10 | uint16(m)
+}
+
+// bf16ToF32 converts bfloat16 bits to float32
+func bf16ToF32(h uint16) float32 {
+	return math.Float32frombits(uint32(h) << 16)
+}
+
+// f32ToBF16 converts float32 to bfloat16 bits, rounding to nearest even
+func f32ToBF16(f float32) uint16 {
+	bits := math.Float32bits(f)
+	if math.IsNaN(float64(f)) {
+		return uint16(bits>>16) | 0x40
+	}
+	bits += 0x7fff + (bits>>16)&1
+	return uint16(bits >> 16)
+}
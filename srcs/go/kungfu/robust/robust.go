@@ -0,0 +1,316 @@
+// Package robust provides Byzantine-robust aggregations, which tolerate up to KUNGFU_CONFIG_BYZANTINE_FAULTS faulty or malicious contributions,
+// for federated deployments where the inputs of workers aren't trusted. They are custom aggregations run by AllReduce, looked up by name as
+// other reductions: coordinate-median takes the median of each element, krum takes the contribution closest to its nearest neighbours.
+package robust
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/log"
+)
+
+const (
+	MedianName = `coordinate-median`
+	KrumName   = `krum`
+)
+
+var (
+	registerOnce sync.Once
+	registerErr  error
+)
+
+// Register registers the aggregations with config.ByzantineFaults, once per process.
+// It must be called before loading plugins, so that all peers assign the same OPs to them.
+func Register() error {
+	registerOnce.Do(func() {
+		f := config.ByzantineFaults
+		if _, registerErr = kb.RegisterAggregate(MedianName, Median(f)); registerErr != nil {
+			return
+		}
+		_, registerErr = kb.RegisterAggregate(KrumName, Krum(f))
+	})
+	return registerErr
+}
+
+// Median returns the coordinate-wise median, which tolerates f faulty contributions out of n if n > 2f.
+// NaN is ordered above +Inf, so that a NaN contribution is an outlier as any other. The median of an even n is the mean of the middle two,
+// rounded down for i64 and u64, which are compared natively, as they don't fit in float64 above 2^53.
+func Median(f int) kb.AggregateFunc {
+	return func(z *kb.Vector, xs []*kb.Vector) {
+		checkFaults(MedianName, len(xs), f, 2*f+1)
+		switch z.Type {
+		case kb.I64:
+			medianI64(z, xs)
+			return
+		case kb.U64:
+			medianU64(z, xs)
+			return
+		}
+		all := make([][]float64, len(xs))
+		for j, x := range xs {
+			all[j] = floats(x)
+		}
+		n := len(xs)
+		vs := make([]float64, n)
+		ys := make([]float64, z.Count)
+		for i := range ys {
+			for j := range all {
+				vs[j] = all[j][i]
+			}
+			sort.Slice(vs, func(a, b int) bool { return less(vs[a], vs[b]) })
+			if ys[i] = vs[n/2]; n%2 == 0 {
+				ys[i] = (vs[n/2-1] + vs[n/2]) / 2
+			}
+		}
+		store(z, ys)
+	}
+}
+
+// Krum returns the aggregation choosing the contribution of the least sum of squared distances to its n - f - 2 nearest neighbours,
+// which tolerates f faulty contributions out of n if n > 2f + 2. Ties are broken by the lowest rank, so that all peers choose the same.
+// Distances from a contribution with NaN or Inf are +Inf, so that it is never chosen over a finite one.
+// Distances are computed in float64, which rounds i64 and u64 above 2^53, while the chosen contribution is copied as it is.
+func Krum(f int) kb.AggregateFunc {
+	return func(z *kb.Vector, xs []*kb.Vector) {
+		n := len(xs)
+		checkFaults(KrumName, n, f, 2*f+3)
+		all := make([][]float64, n)
+		for j, x := range xs {
+			all[j] = floats(x)
+		}
+		m := n - f - 2
+		if m < 1 {
+			m = 1
+		}
+		if m > n-1 {
+			m = n - 1
+		}
+		dist := make([][]float64, n)
+		for i := range dist {
+			dist[i] = make([]float64, n)
+		}
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				dist[i][j] = squaredDistance(all[i], all[j])
+				dist[j][i] = dist[i][j]
+			}
+		}
+		best, bestScore := -1, 0.0
+		for i := 0; i < n; i++ {
+			var ds []float64
+			for j := 0; j < n; j++ {
+				if j != i {
+					ds = append(ds, dist[i][j])
+				}
+			}
+			sort.Float64s(ds)
+			var score float64
+			for _, d := range ds[:m] {
+				score += d
+			}
+			if best < 0 || score < bestScore {
+				best, bestScore = i, score
+			}
+		}
+		z.CopyFrom(xs[best])
+	}
+}
+
+// squaredDistance returns +Inf instead of NaN, e.g. if x or y has NaN or Inf
+func squaredDistance(x, y []float64) float64 {
+	var d float64
+	for i := range x {
+		d += (x[i] - y[i]) * (x[i] - y[i])
+	}
+	if math.IsNaN(d) {
+		return math.Inf(1)
+	}
+	return d
+}
+
+// less orders NaN above all numbers, and equal to itself
+func less(a, b float64) bool {
+	if math.IsNaN(a) {
+		return false
+	}
+	return a < b || math.IsNaN(b)
+}
+
+func medianI64(z *kb.Vector, xs []*kb.Vector) {
+	n := len(xs)
+	vs := make([]int64, n)
+	for i := range z.AsI64() {
+		for j, x := range xs {
+			vs[j] = x.AsI64()[i]
+		}
+		sort.Slice(vs, func(a, b int) bool { return vs[a] < vs[b] })
+		m := vs[n/2]
+		if n%2 == 0 {
+			lo := vs[n/2-1]
+			m = lo + int64((uint64(m)-uint64(lo))/2) // without overflow
+		}
+		z.AsI64()[i] = m
+	}
+}
+
+func medianU64(z *kb.Vector, xs []*kb.Vector) {
+	n := len(xs)
+	vs := make([]uint64, n)
+	for i := range z.AsU64() {
+		for j, x := range xs {
+			vs[j] = x.AsU64()[i]
+		}
+		sort.Slice(vs, func(a, b int) bool { return vs[a] < vs[b] })
+		m := vs[n/2]
+		if n%2 == 0 {
+			lo := vs[n/2-1]
+			m = lo + (m-lo)/2
+		}
+		z.AsU64()[i] = m
+	}
+}
+
+var warned sync.Map
+
+// checkFaults warns once for each aggregation if n contributions are less than the min needed to tolerate f faulty ones
+func checkFaults(name string, n, f, min int) {
+	if n >= min {
+		return
+	}
+	if _, loaded := warned.LoadOrStore(name, true); !loaded {
+		log.Warnf("%s of %d contributions can't tolerate %d faulty ones, which needs at least %d, see %s", name, n, f, min, config.ByzantineFaultsEnvKey)
+	}
+}
+
+// floats converts the elements of x to float64, f16 and bf16 through float32, and bool to 0 or 1
+func floats(x *kb.Vector) []float64 {
+	ys := make([]float64, x.Count)
+	switch x.Type {
+	case kb.F16:
+		for i, v := range x.AsHalf() {
+			ys[i] = float64(f16ToF32(v))
+		}
+	case kb.BF16:
+		for i, v := range x.AsHalf() {
+			ys[i] = float64(bf16ToF32(v))
+		}
+	case kb.F32:
+		for i, v := range x.AsF32() {
+			ys[i] = float64(v)
+		}
+	case kb.F64:
+		copy(ys, x.AsF64())
+	case kb.I8:
+		for i, v := range x.AsI8() {
+			ys[i] = float64(v)
+		}
+	case kb.I16:
+		for i, v := range x.AsI16() {
+			ys[i] = float64(v)
+		}
+	case kb.I32:
+		for i, v := range x.AsI32() {
+			ys[i] = float64(v)
+		}
+	case kb.I64:
+		for i, v := range x.AsI64() {
+			ys[i] = float64(v)
+		}
+	case kb.U8, kb.Bool:
+		for i, v := range x.AsU8() {
+			ys[i] = float64(v)
+		}
+	case kb.U16:
+		for i, v := range x.AsU16() {
+			ys[i] = float64(v)
+		}
+	case kb.U32:
+		for i, v := range x.AsU32() {
+			ys[i] = float64(v)
+		}
+	case kb.U64:
+		for i, v := range x.AsU64() {
+			ys[i] = float64(v)
+		}
+	default:
+		panic(fmt.Sprintf("robust aggregations don't support %s", x.Type))
+	}
+	return ys
+}
+
+// store converts ys to the elements of z, the median of bools is true if more than half are
+func store(z *kb.Vector, ys []float64) {
+	switch z.Type {
+	case kb.F16:
+		zs := z.AsHalf()
+		for i, y := range ys {
+			zs[i] = f32ToF16(float32(y))
+		}
+	case kb.BF16:
+		zs := z.AsHalf()
+		for i, y := range ys {
+			zs[i] = f32ToBF16(float32(y))
+		}
+	case kb.F32:
+		zs := z.AsF32()
+		for i, y := range ys {
+			zs[i] = float32(y)
+		}
+	case kb.F64:
+		copy(z.AsF64(), ys)
+	case kb.I8:
+		zs := z.AsI8()
+		for i, y := range ys {
+			zs[i] = int8(y)
+		}
+	case kb.I16:
+		zs := z.AsI16()
+		for i, y := range ys {
+			zs[i] = int16(y)
+		}
+	case kb.I32:
+		zs := z.AsI32()
+		for i, y := range ys {
+			zs[i] = int32(y)
+		}
+	case kb.I64:
+		zs := z.AsI64()
+		for i, y := range ys {
+			zs[i] = int64(y)
+		}
+	case kb.Bool:
+		zs := z.AsU8()
+		for i, y := range ys {
+			if zs[i] = 0; y > 0.5 {
+				zs[i] = 1
+			}
+		}
+	case kb.U8:
+		zs := z.AsU8()
+		for i, y := range ys {
+			zs[i] = uint8(y)
+		}
+	case kb.U16:
+		zs := z.AsU16()
+		for i, y := range ys {
+			zs[i] = uint16(y)
+		}
+	case kb.U32:
+		zs := z.AsU32()
+		for i, y := range ys {
+			zs[i] = uint32(y)
+		}
+	case kb.U64:
+		zs := z.AsU64()
+		for i, y := range ys {
+			zs[i] = uint64(y)
+		}
+	default:
+		panic(fmt.Sprintf("robust aggregations don't support %s", z.Type))
+	}
+}
@@ -0,0 +1,169 @@
+package robust
+
+import (
+	"math"
+	"testing"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+)
+
+func Test_Median(t *testing.T) {
+	xs := []*kb.Vector{
+		kb.VectorF32([]float32{1, 10}),
+		kb.VectorF32([]float32{2, 20}),
+		kb.VectorF32([]float32{1e9, -1e9}), // faulty
+	}
+	z := kb.NewVector(2, kb.F32)
+	Median(1)(z, xs)
+	if zs := z.AsF32(); zs[0] != 2 || zs[1] != 10 {
+		t.Errorf("unexpected median: %v", zs)
+	}
+	Median(1)(z, xs[:2])
+	if zs := z.AsF32(); zs[0] != 1.5 || zs[1] != 15 {
+		t.Errorf("unexpected median of even contributions: %v", zs)
+	}
+}
+
+func Test_Krum(t *testing.T) {
+	xs := []*kb.Vector{
+		vectorF64([]float64{100, 100}), // faulty
+		vectorF64([]float64{1, 1}),
+		vectorF64([]float64{1.1, 0.9}),
+		vectorF64([]float64{0.9, 1}),
+		vectorF64([]float64{-50, 80}), // faulty
+		vectorF64([]float64{1, 1.2}),
+		vectorF64([]float64{1.2, 1}),
+	}
+	z := kb.NewVector(2, kb.F64)
+	Krum(2)(z, xs)
+	if zs := z.AsF64(); zs[0] != 1 || zs[1] != 1 {
+		t.Errorf("unexpected krum: %v", zs)
+	}
+}
+
+func Test_NonFinite(t *testing.T) {
+	nan := math.NaN()
+	for _, attack := range []float64{nan, math.Inf(1), math.Inf(-1)} {
+		xs := []*kb.Vector{
+			vectorF64([]float64{attack, 1}), // faulty
+			vectorF64([]float64{1, 1}),
+			vectorF64([]float64{1.1, 0.9}),
+			vectorF64([]float64{0.9, 1}),
+			vectorF64([]float64{1, 1.2}),
+		}
+		z := kb.NewVector(2, kb.F64)
+		Krum(1)(z, xs)
+		if zs := z.AsF64(); zs[0] != 1 || zs[1] != 1 {
+			t.Errorf("unexpected krum with %g at rank 0: %v", attack, zs)
+		}
+		Median(1)(z, xs[:3])
+		if zs := z.AsF64(); zs[0] != 1.1 && zs[0] != 1 || zs[1] != 1 {
+			t.Errorf("unexpected median with %g at rank 0: %v", attack, zs)
+		}
+	}
+}
+
+func Test_Median64(t *testing.T) {
+	const big = 1<<62 + 1 // not representable in float64
+	xs := []*kb.Vector{vectorOf(kb.I64, []float64{0}), vectorOf(kb.I64, []float64{0}), vectorOf(kb.I64, []float64{0})}
+	for i, v := range []int64{big, big + 2, math.MaxInt64} {
+		xs[i].AsI64()[0] = v
+	}
+	z := kb.NewVector(1, kb.I64)
+	Median(1)(z, xs)
+	if got := z.AsI64()[0]; got != big+2 {
+		t.Errorf("median of i64 is %d, expect %d", got, int64(big+2))
+	}
+	Median(1)(z, xs[:2])
+	if got := z.AsI64()[0]; got != big+1 {
+		t.Errorf("median of even i64 is %d, expect %d", got, int64(big+1))
+	}
+	xs[0].AsI64()[0], xs[1].AsI64()[0] = math.MinInt64, math.MaxInt64
+	Median(1)(z, xs[:2])
+	if got := z.AsI64()[0]; got != -1 {
+		t.Errorf("median of the extremes of i64 is %d, expect -1", got)
+	}
+	us := []*kb.Vector{kb.NewVector(1, kb.U64), kb.NewVector(1, kb.U64)}
+	us[0].AsU64()[0], us[1].AsU64()[0] = math.MaxUint64, math.MaxUint64-2
+	u := kb.NewVector(1, kb.U64)
+	Median(1)(u, us)
+	if got := u.AsU64()[0]; got != math.MaxUint64-1 {
+		t.Errorf("median of u64 is %d, expect %d", got, uint64(math.MaxUint64-1))
+	}
+}
+
+func Test_AllDtypes(t *testing.T) {
+	for _, dtype := range []kb.DataType{kb.U8, kb.U16, kb.U32, kb.U64, kb.I8, kb.I16, kb.I32, kb.I64, kb.F16, kb.F32, kb.F64, kb.BF16} {
+		xs := []*kb.Vector{
+			vectorOf(dtype, []float64{1, 100}),
+			vectorOf(dtype, []float64{2, 3}),
+			vectorOf(dtype, []float64{120, 2}), // faulty
+		}
+		z := kb.NewVector(2, dtype)
+		Median(1)(z, xs)
+		if zs := floats(z); zs[0] != 2 || zs[1] != 3 {
+			t.Errorf("unexpected median of %s: %v", dtype, zs)
+		}
+		xs = []*kb.Vector{
+			vectorOf(dtype, []float64{1, 4}),
+			vectorOf(dtype, []float64{2, 3}),
+			vectorOf(dtype, []float64{3, 3}),
+			vectorOf(dtype, []float64{120, 2}), // faulty
+		}
+		Krum(0)(z, xs)
+		if zs := floats(z); zs[0] != 2 || zs[1] != 3 {
+			t.Errorf("unexpected krum of %s: %v", dtype, zs)
+		}
+	}
+}
+
+func Test_MedianBool(t *testing.T) {
+	xs := []*kb.Vector{
+		vectorOf(kb.Bool, []float64{1, 0, 1}),
+		vectorOf(kb.Bool, []float64{1, 0, 0}),
+		vectorOf(kb.Bool, []float64{0, 1, 1}),
+	}
+	z := kb.NewVector(3, kb.Bool)
+	Median(1)(z, xs)
+	if zs := z.AsU8(); zs[0] != 1 || zs[1] != 0 || zs[2] != 1 {
+		t.Errorf("unexpected median of bools: %v", zs)
+	}
+	Median(1)(z, xs[:2])
+	if zs := z.AsU8(); zs[0] != 1 || zs[1] != 0 || zs[2] != 0 {
+		t.Errorf("unexpected median of even bools: %v", zs)
+	}
+}
+
+func Test_Half(t *testing.T) {
+	for _, f := range []float32{0, 1, -2.5, 0.1, 65504, 6.1035156e-05, 5.9604645e-08} {
+		if g := f16ToF32(f32ToF16(f)); math.Abs(float64(g-f)) > math.Abs(float64(f))/1024 {
+			t.Errorf("f16 of %g is %g", f, g)
+		}
+		if g := bf16ToF32(f32ToBF16(f)); math.Abs(float64(g-f)) > math.Abs(float64(f))/128 {
+			t.Errorf("bf16 of %g is %g", f, g)
+		}
+	}
+	for _, f := range []float32{1e6, float32(math.Inf(1))} {
+		if h := f32ToF16(f); h != 0x7c00 {
+			t.Errorf("f16 of %g is %#x, expect inf", f, h)
+		}
+	}
+	if h := f32ToF16(1 + 1.0/2048); h != 0x3c00 {
+		t.Errorf("f16 of 1+2^-11 is %#x, expect 1 rounded to even", h)
+	}
+	if f := f16ToF32(0x7e00); !math.IsNaN(float64(f)) {
+		t.Errorf("f16 NaN is %g", f)
+	}
+}
+
+func vectorOf(dtype kb.DataType, x []float64) *kb.Vector {
+	v := kb.NewVector(len(x), dtype)
+	store(v, x)
+	return v
+}
+
+func vectorF64(x []float64) *kb.Vector {
+	v := kb.NewVector(len(x), kb.F64)
+	copy(v.AsF64(), x)
+	return v
+}
@@ -0,0 +1,512 @@
+package runner
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/job"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/proc"
+	"github.com/lsds/KungFu/srcs/go/utils"
+	"github.com/lsds/KungFu/srcs/go/utils/runner/local"
+)
+
+// APIPrefix prefixes the paths of the REST API of the HTTP server of watch mode,
+// the jobs are served with -job-tokens only, to the requests of a token in the header Authorization: Bearer <token>, on behalf of its user:
+//
+//	POST   /v1/jobs       submit a JobRequest, responds the JobInfo
+//	                      a job preempts the running job of a lower priority, which is drained by SIGTERM and queued again
+//	GET    /v1/jobs       list all jobs, with secrets redacted
+//	GET    /v1/jobs/{id}  get a job
+//	DELETE /v1/jobs/{id}  cancel a queued or running job
+//	GET    /v1/peers      list the workers of the latest cluster
+//	GET    /v1/alerts     list the latest send queue alerts of local peers
+//	GET    /v1/state      dump the internal State of the runner, with secrets redacted
+//	GET    /v1/links      list the probed bandwidth of the links to other runners, filtered by ?peer=<ip:port>&since=<duration>, e.g. since=1h
+const APIPrefix = "/v1"
+
+// JobRequest is a program submitted to run with np local peers, in addition to the watched workers
+type JobRequest struct {
+	Prog     string            `json:"prog"`
+	Args     []string          `json:"args,omitempty"`
+	Envs     map[string]string `json:"envs,omitempty"`
+	NP       int               `json:"np"`
+	User     string            `json:"user,omitempty"`     // whose quota the job counts against, set to the user of the token of the request
+	Priority int               `json:"priority,omitempty"` // jobs of higher priorities run first
+}
+
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCanceled  JobStatus = "canceled"
+)
+
+// JobPeer is the outcome of a peer of a submitted job
+type JobPeer struct {
+	Rank     int           `json:"rank"`
+	Peer     string        `json:"peer"`
+	ExitCode int           `json:"exit_code"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+
+	Crash *local.CrashReport `json:"crash,omitempty"`
+}
+
+// JobInfo is the status of a submitted job
+type JobInfo struct {
+	ID        int        `json:"id"`
+	Status    JobStatus  `json:"status"`
+	Request   JobRequest `json:"request"`
+	Submitted time.Time  `json:"submitted"`
+	Started   *time.Time `json:"started,omitempty"`
+	Finished  *time.Time `json:"finished,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Peers     []JobPeer  `json:"peers,omitempty"`
+
+	Preemptions int `json:"preemptions,omitempty"` // times the job was preempted and queued again
+}
+
+var (
+	errEmptyProg      = errors.New("prog is required")
+	errJobNotFound    = errors.New("job not found")
+	errJobFinished    = errors.New("job already finished")
+	errNotEnoughSlots = errors.New("np exceeds the slots of this host")
+	errTooManyJobs    = errors.New("too many queued jobs")
+	errQuotaExceeded  = errors.New("job quota of user exceeded")
+	errUnauthorized   = errors.New("a valid job token is required")
+)
+
+// maxQueuedJobs bounds the jobs waiting to run
+const maxQueuedJobs = 1024
+
+// jobQueue runs submitted jobs one by one on the host of the runner, by their priorities then their submission.
+// Peers of a job take ports from the end of the port range, while watched workers take ports from the beginning.
+type jobQueue struct {
+	self     plan.PeerID
+	template job.Job
+	slots    int
+	quota    int               // jobs each user may have queued or running, 0 for unlimited
+	tokens   map[string]string // users of the tokens
+
+	mu        sync.Mutex
+	jobs      []*JobInfo
+	pending   []*JobInfo // queued jobs
+	running   *JobInfo
+	cancels   map[int]context.CancelFunc
+	preempted map[int]bool // running jobs being drained to be queued again
+	wake      chan struct{}
+}
+
+func newJobQueue(self plan.PeerID, j job.Job) (*jobQueue, error) {
+	tokens, err := readJobTokens(j.JobTokens)
+	if err != nil {
+		return nil, err
+	}
+	t := j
+	t.ConfigServer = ""
+	t.RankMap = nil
+	t.Role = ""
+	t.Programs = nil
+	t.Binaries = nil
+	t.LeasePeriod = 0
+	t.JobTokens = ""
+	return &jobQueue{
+		self:      self,
+		template:  t,
+		slots:     j.HostList.SlotOf(self.IPv4),
+		quota:     j.JobQuota,
+		tokens:    tokens,
+		cancels:   make(map[int]context.CancelFunc),
+		preempted: make(map[int]bool),
+		wake:      make(chan struct{}, 1),
+	}, nil
+}
+
+// readJobTokens reads the users of the tokens of a file, of lines <user> <token>, empty lines and those starting with # are skipped
+func readJobTokens(filename string) (map[string]string, error) {
+	bs, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make(map[string]string)
+	for i, line := range strings.Split(string(bs), "\n") {
+		if line = strings.TrimSpace(line); len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expect <user> <token>", filename, i+1)
+		}
+		tokens[fields[1]] = fields[0]
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("no job token in %s", filename)
+	}
+	return tokens, nil
+}
+
+// authorize returns the user of the token in the header Authorization: Bearer <token> of req, if it is one of the tokens
+func (q *jobQueue) authorize(req *http.Request) (string, bool) {
+	const prefix = "Bearer "
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) {
+		return "", false
+	}
+	given := []byte(strings.TrimPrefix(auth, prefix))
+	var user string
+	var ok bool
+	for t, u := range q.tokens {
+		if subtle.ConstantTimeCompare(given, []byte(t)) == 1 {
+			user, ok = u, true
+		}
+	}
+	return user, ok
+}
+
+func (q *jobQueue) submit(r JobRequest) (*JobInfo, error) {
+	if len(r.Prog) == 0 {
+		return nil, errEmptyProg
+	}
+	if r.NP <= 0 {
+		r.NP = 1
+	}
+	if r.NP > q.slots {
+		return nil, fmt.Errorf("%v: %d > %d", errNotEnoughSlots, r.NP, q.slots)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) >= maxQueuedJobs {
+		return nil, errTooManyJobs
+	}
+	if n := q.activeJobsOf(r.User); q.quota > 0 && n >= q.quota {
+		return nil, fmt.Errorf("%v: %q has %d of %d jobs queued or running", errQuotaExceeded, r.User, n, q.quota)
+	}
+	info := &JobInfo{
+		ID:        len(q.jobs) + 1,
+		Status:    JobQueued,
+		Request:   r,
+		Submitted: time.Now(),
+	}
+	q.jobs = append(q.jobs, info)
+	q.enqueue(info)
+	log.Infof("job #%d submitted with priority %d: %s", info.ID, r.Priority, strings.Join(append([]string{r.Prog}, r.Args...), " "))
+	if cur := q.running; cur != nil && r.Priority > cur.Request.Priority && !q.preempted[cur.ID] {
+		log.Infof("job #%d of priority %d preempted by job #%d of priority %d", cur.ID, cur.Request.Priority, info.ID, r.Priority)
+		q.preempted[cur.ID] = true
+		q.cancels[cur.ID]()
+	}
+	return info, nil
+}
+
+// activeJobsOf counts the jobs of user which are queued or running, q.mu must be held
+func (q *jobQueue) activeJobsOf(user string) int {
+	var n int
+	for _, info := range q.jobs {
+		if info.Request.User == user && (info.Status == JobQueued || info.Status == JobRunning) {
+			n++
+		}
+	}
+	return n
+}
+
+// enqueue inserts a queued job after the jobs of higher or equal priorities submitted before it, q.mu must be held
+func (q *jobQueue) enqueue(info *JobInfo) {
+	i := sort.Search(len(q.pending), func(i int) bool {
+		p := q.pending[i]
+		if p.Request.Priority != info.Request.Priority {
+			return p.Request.Priority < info.Request.Priority
+		}
+		return p.ID > info.ID
+	})
+	q.pending = append(q.pending, nil)
+	copy(q.pending[i+1:], q.pending[i:])
+	q.pending[i] = info
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next takes the first queued job, if any
+func (q *jobQueue) next() *JobInfo {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		return nil
+	}
+	info := q.pending[0]
+	q.pending = q.pending[1:]
+	return info
+}
+
+// get returns a job, with the secrets of its request redacted
+func (q *jobQueue) get(id int) (JobInfo, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if id <= 0 || id > len(q.jobs) {
+		return JobInfo{}, false
+	}
+	return redactJob(*q.jobs[id-1]), true
+}
+
+// list returns all jobs, with the secrets of their requests redacted
+func (q *jobQueue) list() []JobInfo {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	infos := make([]JobInfo, 0, len(q.jobs))
+	for _, info := range q.jobs {
+		infos = append(infos, redactJob(*info))
+	}
+	return infos
+}
+
+func (q *jobQueue) cancel(id int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if id <= 0 || id > len(q.jobs) {
+		return errJobNotFound
+	}
+	info := q.jobs[id-1]
+	switch info.Status {
+	case JobQueued:
+		info.Status = JobCanceled
+		for i, p := range q.pending {
+			if p == info {
+				q.pending = append(q.pending[:i], q.pending[i+1:]...)
+				break
+			}
+		}
+	case JobRunning:
+		delete(q.preempted, id) // canceled rather than queued again
+		q.cancels[id]()
+	default:
+		return errJobFinished
+	}
+	return nil
+}
+
+func (q *jobQueue) run(ctx context.Context) {
+	for {
+		if info := q.next(); info != nil {
+			q.runJob(ctx, info)
+			continue
+		}
+		select {
+		case <-q.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (q *jobQueue) runJob(ctx context.Context, info *JobInfo) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	q.mu.Lock()
+	if info.Status == JobCanceled {
+		q.mu.Unlock()
+		return
+	}
+	t0 := time.Now()
+	info.Status = JobRunning
+	info.Started = &t0
+	info.Finished = nil
+	info.Error = ""
+	info.Peers = nil
+	q.running = info
+	q.cancels[info.ID] = cancel
+	r := info.Request
+	q.mu.Unlock()
+
+	j := q.template
+	j.Prog = r.Prog
+	j.Args = r.Args
+	j.Envs = make(proc.Envs)
+	for k, v := range r.Envs {
+		j.Envs[k] = v
+	}
+	cluster := plan.Cluster{
+		Runners: plan.PeerList{q.self},
+	}
+	for i := 0; i < r.NP; i++ {
+		cluster.Workers = append(cluster.Workers, plan.PeerID{IPv4: q.self.IPv4, Port: j.PortRange.End - uint16(r.NP-1-i)})
+	}
+	procs := j.CreateProcs(cluster, q.self.IPv4)
+	log.Infof("running job #%d with %s", info.ID, utils.Pluralize(r.NP, "peer", "peers"))
+	results, err := local.RunAllWithResults(jobCtx, procs, true)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t1 := time.Now()
+	q.running = nil
+	delete(q.cancels, info.ID)
+	if q.preempted[info.ID] && ctx.Err() == nil {
+		delete(q.preempted, info.ID)
+		info.Status = JobQueued
+		info.Preemptions++
+		q.enqueue(info)
+		log.Infof("job #%d drained after %s, queued again", info.ID, t1.Sub(t0))
+		return
+	}
+	delete(q.preempted, info.ID)
+	info.Finished = &t1
+	for i, res := range results {
+		p := JobPeer{Rank: i, Peer: cluster.Workers[i].String(), ExitCode: exitCode(res.Err), Duration: res.Duration, Crash: res.Crash}
+		if res.Err != nil {
+			p.Error = res.Err.Error()
+		}
+		info.Peers = append(info.Peers, p)
+	}
+	switch {
+	case jobCtx.Err() != nil:
+		info.Status = JobCanceled
+	case err != nil:
+		info.Status = JobFailed
+		info.Error = err.Error()
+	default:
+		info.Status = JobSucceeded
+	}
+	log.Infof("job #%d %s, took %s", info.ID, info.Status, t1.Sub(t0))
+}
+
+// PeerInfo is a worker of the latest cluster
+type PeerInfo struct {
+	Rank  int    `json:"rank"`
+	Peer  string `json:"peer"`
+	Local bool   `json:"local"` // run by this runner
+
+	Degraded *DegradedReport `json:"degraded,omitempty"` // if the local peer reported its GPU unavailable
+}
+
+// PeersInfo is the latest cluster known by the runner
+type PeersInfo struct {
+	Version int        `json:"version"`
+	Peers   []PeerInfo `json:"peers"`
+}
+
+func (h *Handler) peersInfo() PeersInfo {
+	var info PeersInfo
+	info.Peers = []PeerInfo{}
+	v, ok := h.latest()
+	if !ok {
+		return info
+	}
+	s, _ := h.lookup(v)
+	info.Version = v
+	for rank, id := range s.Cluster.Workers {
+		pi := PeerInfo{Rank: rank, Peer: id.String(), Local: id.IPv4 == h.self.IPv4}
+		if r, ok := h.degradedReport(id); ok {
+			pi.Degraded = &r
+		}
+		info.Peers = append(info.Peers, pi)
+	}
+	return info
+}
+
+func (h *Handler) serveAPI(w http.ResponseWriter, req *http.Request) {
+	path := strings.TrimPrefix(req.URL.Path, APIPrefix)
+	switch {
+	case path == "/peers" && req.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, h.peersInfo())
+	case path == "/alerts" && req.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, h.queueAlerts())
+	case path == "/state" && req.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, h.State())
+	case path == "/links" && req.Method == http.MethodGet:
+		var since time.Time
+		if s := req.URL.Query().Get("since"); len(s) > 0 {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			since = time.Now().Add(-d)
+		}
+		writeJSON(w, http.StatusOK, h.links.list(req.URL.Query().Get("peer"), since))
+	case path == "/jobs" && h.jobs == nil, strings.HasPrefix(path, "/jobs/") && h.jobs == nil:
+		http.Error(w, "jobs are not accepted by this runner", http.StatusNotFound)
+	case path == "/jobs" || strings.HasPrefix(path, "/jobs/"):
+		user, ok := h.jobs.authorize(req)
+		if !ok {
+			http.Error(w, errUnauthorized.Error(), http.StatusUnauthorized)
+			return
+		}
+		h.serveJobs(w, req, path, user)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// serveJobs serves the requests of user under /jobs
+func (h *Handler) serveJobs(w http.ResponseWriter, req *http.Request, path, user string) {
+	switch {
+	case path == "/jobs" && req.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, h.jobs.list())
+	case path == "/jobs" && req.Method == http.MethodPost:
+		var r JobRequest
+		if err := utils.ReadJSON(req.Body, &r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.User = user
+		submitted, err := h.jobs.submit(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		info, _ := h.jobs.get(submitted.ID)
+		writeJSON(w, http.StatusCreated, info)
+	case strings.HasPrefix(path, "/jobs/"):
+		id, err := strconv.Atoi(strings.TrimPrefix(path, "/jobs/"))
+		if err != nil {
+			http.Error(w, errJobNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		switch req.Method {
+		case http.MethodGet:
+			info, ok := h.jobs.get(id)
+			if !ok {
+				http.Error(w, errJobNotFound.Error(), http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, info)
+		case http.MethodDelete:
+			if err := h.jobs.cancel(id); err != nil {
+				code := http.StatusConflict
+				if err == errJobNotFound {
+					code = http.StatusNotFound
+				}
+				http.Error(w, err.Error(), code)
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
+		}
+	default:
+		http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	e := json.NewEncoder(w)
+	e.SetIndent("", "    ")
+	e.Encode(v)
+}
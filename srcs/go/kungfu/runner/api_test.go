@@ -0,0 +1,149 @@
+package runner
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func newTestJobQueue(slots, quota int) *jobQueue {
+	return &jobQueue{
+		slots:     slots,
+		quota:     quota,
+		cancels:   make(map[int]context.CancelFunc),
+		preempted: make(map[int]bool),
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+func Test_JobQueuePriority(t *testing.T) {
+	q := newTestJobQueue(4, 0)
+	for _, p := range []int{0, 1, 0, 2, 1} {
+		if _, err := q.submit(JobRequest{Prog: "true", Priority: p}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.cancel(3); err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for info := q.next(); info != nil; info = q.next() {
+		ids = append(ids, info.ID)
+	}
+	want := []int{4, 2, 5, 1}
+	if len(ids) != len(want) {
+		t.Fatalf("jobs run in order %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("jobs run in order %v, want %v", ids, want)
+		}
+	}
+}
+
+func Test_JobQueueQuota(t *testing.T) {
+	q := newTestJobQueue(4, 2)
+	for i, r := range []struct {
+		user string
+		ok   bool
+	}{
+		{"alice", true},
+		{"alice", true},
+		{"alice", false},
+		{"bob", true},
+	} {
+		if _, err := q.submit(JobRequest{Prog: "true", User: r.user}); (err == nil) != r.ok {
+			t.Errorf("#%d submit by %s: %v", i, r.user, err)
+		}
+	}
+	q.cancel(1)
+	if _, err := q.submit(JobRequest{Prog: "true", User: "alice"}); err != nil {
+		t.Errorf("submit after cancel: %v", err)
+	}
+}
+
+func Test_JobQueuePreempt(t *testing.T) {
+	q := newTestJobQueue(4, 0)
+	low, _ := q.submit(JobRequest{Prog: "true"})
+	q.next()
+	var canceled bool
+	q.running = low
+	low.Status = JobRunning
+	q.cancels[low.ID] = func() { canceled = true }
+	if _, err := q.submit(JobRequest{Prog: "true"}); err != nil || canceled {
+		t.Fatalf("job of the same priority preempted: %v", err)
+	}
+	high, err := q.submit(JobRequest{Prog: "true", Priority: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !canceled || !q.preempted[low.ID] {
+		t.Fatalf("running job not preempted")
+	}
+	if next := q.next(); next != high {
+		t.Errorf("job #%d runs after preemption, want #%d", next.ID, high.ID)
+	}
+}
+
+func Test_JobTokens(t *testing.T) {
+	f, err := ioutil.TempFile("", "job-tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# users and tokens of the REST API\nalice secret-a\n\n  bob  secret-b  \n")
+	f.Close()
+	tokens, err := readJobTokens(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{jobs: newTestJobQueue(1, 1)}
+	h.jobs.tokens = tokens
+	for i, r := range []struct {
+		auth string
+		code int
+	}{
+		{"Bearer secret-a", http.StatusCreated},
+		{"Bearer secret-a", http.StatusBadRequest}, // quota of alice exceeded
+		{"Bearer secret-b", http.StatusCreated},
+		{"Bearer secret-c", http.StatusUnauthorized},
+		{"secret-a", http.StatusUnauthorized},
+		{"", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(http.MethodPost, APIPrefix+"/jobs", strings.NewReader(`{"prog": "true", "user": "carol"}`))
+		if len(r.auth) > 0 {
+			req.Header.Set("Authorization", r.auth)
+		}
+		w := httptest.NewRecorder()
+		h.serveAPI(w, req)
+		if w.Code != r.code {
+			t.Errorf("#%d submit with %q responded %d, expect %d", i, r.auth, w.Code, r.code)
+		}
+	}
+	for i, user := range []string{"alice", "bob"} {
+		if got := h.jobs.jobs[i].Request.User; got != user {
+			t.Errorf("job #%d is submitted by %q, expect %q", i+1, got, user)
+		}
+	}
+}
+
+func Test_ListJobsRedacted(t *testing.T) {
+	q := newTestJobQueue(1, 0)
+	if _, err := q.submit(JobRequest{Prog: "true", Envs: map[string]string{"API_TOKEN": "xyz", "N": "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	envs := q.list()[0].Request.Envs
+	if envs["API_TOKEN"] != redacted || envs["N"] != "1" {
+		t.Errorf("unexpected envs of listed job: %v", envs)
+	}
+	if info, _ := q.get(1); info.Request.Envs["API_TOKEN"] != redacted {
+		t.Errorf("envs of job not redacted: %v", info.Request.Envs)
+	}
+	if q.jobs[0].Request.Envs["API_TOKEN"] != "xyz" {
+		t.Errorf("envs of queued job redacted")
+	}
+}
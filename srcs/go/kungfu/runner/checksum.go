@@ -0,0 +1,59 @@
+package runner
+
+import (
+	"github.com/lsds/KungFu/srcs/go/kungfu/checksum"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+)
+
+// maxDrifts is the number of latest drifts kept for the State
+const maxDrifts = 100
+
+type checksumRound struct {
+	version int
+	step    int
+}
+
+// handleContrlChecksum collects the checksums reported by all workers of a cluster version,
+// and compares them once the last one arrives.
+func (h *Handler) handleContrlChecksum(_name string, msg *connection.Message, conn connection.Connection) {
+	var r checksum.Report
+	if err := r.Decode(msg.Data); err != nil {
+		log.Warnf("invalid checksum from %s: %v", conn.Src(), err)
+		return
+	}
+	s, ok := h.lookup(r.Version)
+	if !ok || !s.Cluster.Workers.Contains(r.Peer) {
+		log.Debugf("ignored checksum of %s for unknown v%d", r.Peer, r.Version)
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for k := range h.checksums {
+		if k.version < r.Version {
+			delete(h.checksums, k) // peers of older versions never report again
+		}
+	}
+	k := checksumRound{version: r.Version, step: r.Step}
+	for _, prev := range h.checksums[k] {
+		if prev.Peer == r.Peer {
+			return
+		}
+	}
+	h.checksums[k] = append(h.checksums[k], r)
+	if len(h.checksums[k]) < len(s.Cluster.Workers) {
+		return
+	}
+	rs := h.checksums[k]
+	delete(h.checksums, k)
+	d, diverged := checksum.Compare(rs)
+	if !diverged {
+		log.Debugf("checksums of %d peers agree at step %d of v%d", len(rs), r.Step, r.Version)
+		return
+	}
+	log.Errorf("%s", d)
+	h.drifts = append(h.drifts, d)
+	if len(h.drifts) > maxDrifts {
+		h.drifts = h.drifts[len(h.drifts)-maxDrifts:]
+	}
+}
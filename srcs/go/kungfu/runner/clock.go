@@ -0,0 +1,89 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/kungfu/execution"
+	"github.com/lsds/KungFu/srcs/go/kungfu/job"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/client"
+)
+
+const clockSamples = 5
+
+// checkClocks checks the clock skew between runners as configured by j, once self is serving clock queries,
+// so that the other runners can query it until they finished their checks.
+func checkClocks(ctx context.Context, self plan.PeerID, runners plan.PeerList, j job.Job) error {
+	if j.MaxClockSkew <= 0 {
+		return nil
+	}
+	return CheckClockSkew(ctx, self, runners, j.MaxClockSkew, j.RequireSyncedClocks)
+}
+
+// CheckClockSkew estimates the clock skew between self and other runners,
+// it returns an error if the skew of any runner exceeds threshold and required is true.
+func CheckClockSkew(ctx context.Context, self plan.PeerID, runners plan.PeerList, threshold time.Duration, required bool) error {
+	others := runners.Others(self)
+	if len(others) == 0 {
+		return nil
+	}
+	c := client.New(self, config.UseUnixSock)
+	var mu sync.Mutex
+	var skewed []string
+	var measure execution.PeerFunc = func(r plan.PeerID) error {
+		ctx, cancel := context.WithTimeout(ctx, config.WaitRunnerTimeout)
+		defer cancel()
+		if _, ok := c.Wait(ctx, r); !ok {
+			return fmt.Errorf("%s is not reachable", r)
+		}
+		skew, err := estimateClockSkew(c, r)
+		if err != nil {
+			return err
+		}
+		log.Debugf("clock skew of %s: %s", r, skew)
+		if abs(skew) > threshold {
+			log.Warnf("clock skew of %s is %s, exceeds %s", r, skew, threshold)
+			mu.Lock()
+			skewed = append(skewed, r.String())
+			mu.Unlock()
+		}
+		return nil
+	}
+	if err := measure.Par(others); err != nil {
+		log.Warnf("failed to check clock skew: %v", err)
+		if required {
+			return err
+		}
+	}
+	if len(skewed) > 0 && required {
+		return fmt.Errorf("clock of %d runners not synced: %s", len(skewed), skewed)
+	}
+	return nil
+}
+
+// estimateClockSkew takes the offset sampled with the minimal round trip time
+func estimateClockSkew(c *client.Client, target plan.PeerID) (time.Duration, error) {
+	var best, minRTT time.Duration
+	for i := 0; i < clockSamples; i++ {
+		offset, rtt, err := c.Clock(target)
+		if err != nil {
+			return 0, err
+		}
+		if i == 0 || rtt < minRTT {
+			best, minRTT = offset, rtt
+		}
+	}
+	return best, nil
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,69 @@
+package runner
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+)
+
+// DegradedName is the name of control messages by which a peer reports to its runner that its GPU became unavailable
+const DegradedName = "degraded"
+
+// DegradedReport is sent by a peer once its GPU became unavailable, e.g. after an Xid error or ECC fault
+type DegradedReport struct {
+	Reason string    `json:"reason"`
+	Time   time.Time `json:"time"`
+}
+
+func (h *Handler) handleContrlDegraded(_name string, msg *connection.Message, conn connection.Connection) {
+	var r DegradedReport
+	if err := json.Unmarshal(msg.Data, &r); err != nil {
+		log.Warnf("invalid degraded report from %s: %v", conn.Src(), err)
+		return
+	}
+	id := conn.Src()
+	log.Warnf("%s reported its GPU unavailable: %s", id, r.Reason)
+	h.mu.Lock()
+	_, reported := h.degraded[id]
+	h.degraded[id] = r
+	h.mu.Unlock()
+	if reported {
+		return
+	}
+	select {
+	case h.onDegraded <- id:
+	default:
+		log.Warnf("degraded report of %s dropped, too many pending", id)
+	}
+}
+
+func (h *Handler) degradedReport(id plan.PeerID) (DegradedReport, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	r, ok := h.degraded[id]
+	return r, ok
+}
+
+// dropDegraded forgets the report of a peer which is no longer running
+func (h *Handler) dropDegraded(id plan.PeerID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.degraded, id)
+}
+
+// handleDegraded evicts a local peer reported degraded by the evict policy,
+// by the cpu policy, the peers agree to switch to CPU collectives by themselves.
+func (w *watcher) handleDegraded(id plan.PeerID) {
+	if w.job.DegradedPolicy == plan.DegradedCPU {
+		log.Infof("%s continues without GPU, all peers switch to CPU collectives", id)
+		return
+	}
+	if _, ok := w.gs[id]; !ok || w.isEvicted(id) {
+		return
+	}
+	log.Warnf("evicting %s of unavailable GPU", id)
+	w.evict(id)
+}
@@ -0,0 +1,25 @@
+package runner
+
+import (
+	"context"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/envsnap"
+	"github.com/lsds/KungFu/srcs/go/kungfu/job"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/proc"
+)
+
+// saveEnvSnapshot saves the environment of a starting worker next to its log files, for kungfu-ctl diff-env
+func saveEnvSnapshot(ctx context.Context, j job.Job, p proc.Proc, id plan.PeerID, rank, version int) {
+	if len(j.LogDir) == 0 {
+		return
+	}
+	s := envsnap.Take(ctx, p, id, rank, version, j.EnvProbe)
+	for _, e := range s.Errors {
+		log.Warnf("environment of %s not fully captured: %s", id, e)
+	}
+	if err := s.Save(j.LogDir); err != nil {
+		log.Warnf("failed to save environment of %s: %v", id, err)
+	}
+}
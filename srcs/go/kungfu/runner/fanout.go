@@ -0,0 +1,203 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/kungfu/timeouts"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+)
+
+// UpdateAckName is the control message a runner replies to a new Stage with, once the runners of its subtree of the fan-out tree have received it
+const UpdateAckName = "update-ack"
+
+// StageTargets returns the runners a peer sends a new Stage to, which is the root of the fan-out tree of config.StageFanout,
+// so that a Stage reaches all runners in O(log n) hops, or all runners if the fan-out is 0.
+func StageTargets(runners plan.PeerList) plan.PeerList {
+	if config.StageFanout <= 0 || len(runners) == 0 {
+		return runners
+	}
+	return runners[:1]
+}
+
+// stageChildren returns the children of id in the fan-out tree of runners, the children of the i-th runner are the (i*fanout+1)-th to (i*fanout+fanout)-th
+func stageChildren(runners plan.PeerList, id plan.PeerID, fanout int) plan.PeerList {
+	i, ok := runners.Rank(id)
+	if !ok || fanout <= 0 {
+		return nil
+	}
+	var children plan.PeerList
+	for j := i*fanout + 1; j <= i*fanout+fanout && j < len(runners); j++ {
+		children = append(children, runners[j])
+	}
+	return children
+}
+
+// stageHeight returns the height of the subtree of id in the fan-out tree of runners
+func stageHeight(runners plan.PeerList, id plan.PeerID, fanout int) int {
+	var height int
+	for _, c := range stageChildren(runners, id, fanout) {
+		if h := stageHeight(runners, c, fanout) + 1; h > height {
+			height = h
+		}
+	}
+	return height
+}
+
+// StageAckTimeout returns how long to wait for the ack of a Stage sent to id, each level of its subtree may wait for an unreachable runner and its children
+func StageAckTimeout(runners plan.PeerList, id plan.PeerID) time.Duration {
+	return time.Duration(2*(stageHeight(runners, id, config.StageFanout)+1)) * timeouts.StagePropagation()
+}
+
+// StageAck acknowledges a Stage for the subtree of a runner, with the runners of the subtree which didn't receive it
+type StageAck struct {
+	Version int
+	Failed  plan.PeerList `json:",omitempty"`
+}
+
+func (a StageAck) Encode() []byte {
+	b := &bytes.Buffer{}
+	json.NewEncoder(b).Encode(a)
+	return b.Bytes()
+}
+
+func (a *StageAck) Decode(bs []byte) error {
+	b := bytes.NewBuffer(bs)
+	return json.NewDecoder(b).Decode(a)
+}
+
+type stageAckKey struct {
+	version int
+	from    plan.PeerID
+}
+
+// StageAcks passes the StageAcks received to the senders of the Stages waiting for them
+type StageAcks struct {
+	mu      sync.Mutex
+	waiting map[stageAckKey]chan StageAck
+}
+
+func NewStageAcks() *StageAcks {
+	return &StageAcks{waiting: make(map[stageAckKey]chan StageAck)}
+}
+
+// Expect starts waiting for the ack of version from a runner, it is called before the Stage is sent, and followed by Wait or Forget
+func (a *StageAcks) Expect(version int, from plan.PeerID) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.waiting[stageAckKey{version: version, from: from}] = make(chan StageAck, 1)
+}
+
+// Wait returns the ack expected by Expect, or an error if it doesn't arrive within timeout
+func (a *StageAcks) Wait(version int, from plan.PeerID, timeout time.Duration) (*StageAck, error) {
+	key := stageAckKey{version: version, from: from}
+	a.mu.Lock()
+	ch, ok := a.waiting[key]
+	a.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("ack of v%d from %s is not expected", version, from)
+	}
+	defer a.Forget(version, from)
+	select {
+	case ack := <-ch:
+		return &ack, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("%s didn't acknowledge v%d in %s", from, version, timeout)
+	}
+}
+
+// Forget stops waiting for the ack of version from a runner, e.g. when the Stage failed to be sent
+func (a *StageAcks) Forget(version int, from plan.PeerID) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.waiting, stageAckKey{version: version, from: from})
+}
+
+// Deliver passes an ack to its waiter, the acks not waited for are dropped
+func (a *StageAcks) Deliver(from plan.PeerID, ack StageAck) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if ch, ok := a.waiting[stageAckKey{version: ack.Version, from: from}]; ok {
+		select {
+		case ch <- ack:
+		default:
+		}
+	}
+}
+
+// stageForward is the forwarding of a new Stage to the subtree of this runner
+type stageForward struct {
+	done   chan struct{}
+	failed plan.PeerList // the runners of the subtree which didn't receive the Stage, set before done is closed
+}
+
+// forward sends a new Stage to the children of this runner in the fan-out tree in parallel, and waits for their acks,
+// the Stage is sent to the children of a child which fails instead, so that its subtree still receives it.
+// It returns the runners of the subtree which didn't receive the Stage.
+func (h *Handler) forward(s Stage) plan.PeerList {
+	fanout := config.StageFanout
+	base, hasBase := h.lookup(s.Version - 1)
+	var mu sync.Mutex
+	var failed plan.PeerList
+	var wg sync.WaitGroup
+	var send func(id plan.PeerID)
+	send = func(id plan.PeerID) {
+		defer wg.Done()
+		ack, err := h.sendStageAcked(id, s, base, hasBase)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			log.Warnf("failed to forward v%d to %s: %v, forwarding to its children", s.Version, id, err)
+			failed = append(failed, id)
+			for _, c := range stageChildren(s.Cluster.Runners, id, fanout) {
+				wg.Add(1)
+				go send(c)
+			}
+			return
+		}
+		failed = append(failed, ack.Failed...)
+	}
+	for _, c := range stageChildren(s.Cluster.Runners, h.self, fanout) {
+		wg.Add(1)
+		go send(c)
+	}
+	wg.Wait()
+	if len(failed) > 0 {
+		log.Errorf("v%d is not received by %d runners: %s", s.Version, len(failed), failed)
+	}
+	return failed
+}
+
+// sendStageAcked sends s to a runner, and waits for the ack of its subtree
+func (h *Handler) sendStageAcked(id plan.PeerID, s, base Stage, hasBase bool) (*StageAck, error) {
+	h.acks.Expect(s.Version, id)
+	if err := h.sendStage(id, s, base, hasBase); err != nil {
+		h.acks.Forget(s.Version, id)
+		return nil, err
+	}
+	return h.acks.Wait(s.Version, id, StageAckTimeout(s.Cluster.Runners, id))
+}
+
+// sendStage sends s to a runner once it is up, as the delta from base if the runner has base
+func (h *Handler) sendStage(id plan.PeerID, s, base Stage, hasBase bool) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), timeouts.StagePropagation())
+	defer cancel()
+	if _, ok := h.client.Wait(ctx, id); !ok {
+		return fmt.Errorf("%s is not up: %v", id, ctx.Err())
+	}
+	var name string
+	var bs []byte
+	if hasBase && base.Cluster.Runners.Contains(id) {
+		name, bs = EncodeUpdate(s, &base, config.CompressStages)
+	} else {
+		name, bs = EncodeUpdate(s, nil, config.CompressStages)
+	}
+	return h.client.Send(id.WithName(name), bs, connection.ConnControl, connection.NoFlag)
+}
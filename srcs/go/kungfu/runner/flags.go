@@ -4,13 +4,20 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"strings"
 	"time"
 
 	"github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/kungfu/elastic/configsource"
+	"github.com/lsds/KungFu/srcs/go/kungfu/env"
+	"github.com/lsds/KungFu/srcs/go/kungfu/features"
+	"github.com/lsds/KungFu/srcs/go/kungfu/job"
 	"github.com/lsds/KungFu/srcs/go/plan"
 	"github.com/lsds/KungFu/srcs/go/plan/hostfile"
 	"github.com/lsds/KungFu/srcs/go/utils"
+	"github.com/lsds/KungFu/srcs/go/utils/iostream"
 )
 
 func Init(f *FlagSet, args []string) {
@@ -24,17 +31,36 @@ func Init(f *FlagSet, args []string) {
 		utils.LogCudaEnv()
 		utils.LogNCCLEnv()
 	}
+	// fail before starting peers, which would all fail on the same features
+	if _, _, err := features.Load(); err != nil {
+		utils.ExitErr(fmt.Errorf("invalid features: %v", err))
+	}
 }
 
 type FlagSet struct {
-	ConfigServer string
-	ClusterSize  int
-	hostList     string
-	hostFile     string
-	HostList     plan.HostList
-	peerList     string
+	ConfigServer   string
+	PreResizeHook  string
+	EvictionPolicy plan.EvictionPolicy
+	DegradedPolicy plan.DegradedPolicy
+	AuditLog       string
+	ClusterSize    int
+	hostList       string
+	hostFile       string
+	HostList       plan.HostList
+	peerList       string
+	Constraints    plan.Constraints
+	rankMapFile    string
+	RankMap        plan.RankMap
+	RankfileOut    string
+	RankMapOut     string
+	JobID          string
+	RankStore      string
 
-	User string
+	User          string
+	SSHProxy      string
+	ForwardAgent  bool
+	HostKeyPolicy string
+	Preflight     bool
 
 	PortRange plan.PortRange
 
@@ -44,21 +70,69 @@ type FlagSet struct {
 	NIC         string
 	AllowNVLink bool
 
-	Strategy base.Strategy
+	PinCores      bool
+	ReservedCores int
+
+	StartStagger time.Duration
+
+	Oversubscribe int
+	PreferFamily  int
+
+	MaxClockSkew        time.Duration
+	RequireSyncedClocks bool
+
+	Strategy        base.Strategy
+	StrategyOptions base.StrategyOptions
 
 	Port        int
 	DebugPort   int
+	DebugHost   string
 	Watch       bool
+	WatchConfig string
+	WatchPeriod time.Duration
 	Keep        bool
 	InitVersion int
 
-	Logfile string
-	LogDir  string
-	Quiet   bool
+	Region         string
+	federation     string
+	Federation     []string
+	FederationPort int
+
+	LeasePeriod       time.Duration
+	RescheduleEvicted bool
+	TelemetryPeriod   time.Duration
+	LinkProbePeriod   time.Duration
+	JobQuota          int
+	JobTokens         string
+	Seed              uint64
+
+	Logfile        string
+	LogDir         string
+	EnvProbe       string
+	LogSinks       []string
+	logMaxSize     int
+	LogRotation    iostream.Rotation
+	Quiet          bool
+	Summary        string
+	ForwardCrashes bool
+	Webhooks       []string
+	PerfReport     bool
+	GCPercent      int
 
 	JobStartTime int
+	Dir          string
+	CheckOnly    bool
 	Prog         string
+	Binaries     job.Binaries
 	Args         []string
+	Role         string
+	Programs     []job.Program
+
+	Provider       string
+	ProviderConfig string
+
+	Simulate      bool
+	SimulateSteps int
 
 	// debug and testing flags
 	BuiltinConfigPort int
@@ -67,11 +141,22 @@ type FlagSet struct {
 
 func (f *FlagSet) Register(flag *flag.FlagSet) {
 	flag.IntVar(&f.ClusterSize, "np", 1, "number of peers")
-	flag.StringVar(&f.hostList, "H", plan.DefaultHostList.String(), "comma separated list of <internal IP>:<nslots>[:<public addr>]")
+	flag.StringVar(&f.hostList, "H", plan.DefaultHostList.String(), "comma separated list of <internal IP>:<nslots>[:<public addr>][:<key>=<value>]..., where runner_port=<port> overrides -port of the host")
 	flag.StringVar(&f.hostFile, "hostfile", "", "path to hostfile, will override -H if specified")
 	flag.StringVar(&f.peerList, "P", "", "comma separated list of <host>:<port>[:slot]")
+	flag.Var(&f.Constraints.Require, "require", "comma separated <key>=<value> labels, only place peers on hosts having all of them")
+	flag.StringVar(&f.Constraints.SpreadAcross, "spread-across", "", "spread peers evenly across hosts of different values of this label")
+	flag.StringVar(&f.rankMapFile, "rankmap", "", "path to a file of lines of <rank> <host> [gpu=<index>], pins the initial ranks to hosts and GPUs, overriding -require and -spread-across")
+	flag.StringVar(&f.RankfileOut, "rankfile-out", "", "write an OpenMPI rankfile of the initial ranks to this file, for external tools")
+	flag.StringVar(&f.RankMapOut, "rankmap-out", "", "write a JSON rank map of the initial ranks, with their hosts, slots and GPUs, to this file")
+	flag.StringVar(&f.JobID, "job-id", "", "ID of the job, a resumed run of the same ID keeps the rank of each host and slot, so that data shards cached on hosts stay valid")
+	flag.StringVar(&f.RankStore, "rank-store", "", "directory of each host keeping the ranks of the runs of -job-id, $HOME/.kungfu/ranks if empty")
 
 	flag.StringVar(&f.User, "u", "", "user name for ssh")
+	flag.StringVar(&f.SSHProxy, "ssh-proxy", "", "[user@]host[:port] of the jump host to reach all hosts by ssh, overridden by ssh_proxy=<jump host> of hosts in -hostfile")
+	flag.BoolVar(&f.ForwardAgent, "ssh-forward-agent", false, "forward the local ssh-agent to the remote runners")
+	flag.StringVar(&f.HostKeyPolicy, "ssh-host-key-policy", "insecure", "which host keys ssh trusts, options are: insecure | known-hosts | accept-new")
+	flag.BoolVar(&f.Preflight, "preflight", false, "check that GPU, driver, CUDA, NCCL, Python and TensorFlow versions match across hosts before launching, kungfu-rrun only")
 
 	f.PortRange = plan.DefaultPortRange
 	flag.Var(&f.PortRange, "port-range", "port range for the peers")
@@ -81,27 +166,77 @@ func (f *FlagSet) Register(flag *flag.FlagSet) {
 	flag.BoolVar(&f.VerboseLog, "v", true, "show task log")
 	flag.StringVar(&f.NIC, "nic", "", "network interface name, for infer self IP")
 	flag.BoolVar(&f.AllowNVLink, "allow-nvlink", false, "allow NCCL to discover NVLink")
+	flag.BoolVar(&f.PinCores, "pin-cores", false, "pin peers sharing a host to disjoint cores, spread over NUMA nodes")
+	flag.IntVar(&f.ReservedCores, "reserved-cores", 1, "cores of each NUMA node shared by all pinned peers, for the goroutines of rchannel")
+	flag.DurationVar(&f.StartStagger, "stagger", 0, "start each local peer after a random delay up to this, to spread the connections of large clusters, see also "+config.DialRateEnvKey)
+	flag.IntVar(&f.Oversubscribe, "oversubscribe", 1, "ranks sharing each slot of the hosts, which split its CPUs and GPU and take turns in their steps, for debugging large clusters on small hardware")
+	flag.IntVar(&f.PreferFamily, "prefer-family", 4, "address family, 4 or 6, dialed first by peers and runners, when public addresses of hosts also resolve to the other family")
+	flag.DurationVar(&f.MaxClockSkew, "max-clock-skew", 100*time.Millisecond, "warn if clock skew between hosts exceeds this threshold")
+	flag.BoolVar(&f.RequireSyncedClocks, "require-synced-clocks", false, "fail if clock skew between hosts exceeds -max-clock-skew")
 
 	f.Strategy = base.DefaultStrategy
-	flag.Var(&f.Strategy, "strategy", fmt.Sprintf("all reduce strategy, options are: %s", strings.Join(base.StrategyNames(), " | ")))
+	flag.Var(base.StrategySpec{Strategy: &f.Strategy, Options: &f.StrategyOptions}, "strategy", fmt.Sprintf("all reduce strategy, followed by its options after ?, e.g. RING?chunk=4MB, TREE?fanout=2 or CLIQUE?window=4, strategies are: %s", strings.Join(base.StrategyNames(), " | ")))
 
-	flag.IntVar(&f.Port, "port", int(plan.DefaultRunnerPort), "port for rchannel")
-	flag.IntVar(&f.DebugPort, "debug-port", 0, "port for HTTP debug server")
+	flag.IntVar(&f.Port, "port", int(plan.DefaultRunnerPort), "port for rchannel, of all runners unless given by runner_port of a host")
+	flag.IntVar(&f.DebugPort, "debug-port", 0, "port for HTTP debug server, which also serves the REST API under /v1 in watch mode")
+	flag.StringVar(&f.DebugHost, "debug-host", "127.0.0.1", "address the HTTP debug server listens on, e.g. 0.0.0.0 to serve other hosts")
 	flag.BoolVar(&f.Watch, "w", false, "watch config")
+	flag.StringVar(&f.WatchConfig, "watch-config", "", "drive the cluster from file://<path>, http(s)://<url>, etcd[+https]://<host>:<port>/<key> or push://, configs pushed by kungfu-ctl or kungfu-config-server -push are applied without waiting for -watch-period, only in watch mode")
+	flag.DurationVar(&f.WatchPeriod, "watch-period", configsource.DefaultPeriod, "interval between polls of -watch-config")
 	flag.BoolVar(&f.Keep, "k", false, "stay alive after works finished")
+	flag.StringVar(&f.Region, "region", "", "name of the region of the hosts in -H, required with -federate")
+	flag.StringVar(&f.federation, "federate", "", "comma separated <host>:<port> of a kungfu-run in each of the other regions, peers of all regions form a single cluster")
+	flag.IntVar(&f.FederationPort, "federation-port", int(plan.DefaultRunnerPort)+8, "port serving the region to kungfu-run of other regions")
 	flag.IntVar(&f.InitVersion, "init-version", 0, "initial cluster version")
+	flag.DurationVar(&f.LeasePeriod, "lease", 0, "evict a peer if it doesn't renew its lease within this period, the first renewal is expected within this period since it started, only in watch mode")
+	flag.BoolVar(&f.RescheduleEvicted, "reschedule-evicted", false, "move the rank of an evicted peer to another host with a free slot")
+	flag.DurationVar(&f.TelemetryPeriod, "telemetry-period", 0, "report free memory, load and GPUs of this host to the config server in this period, only in watch mode")
+	flag.DurationVar(&f.LinkProbePeriod, "link-probe-period", 0, "probe the bandwidth of the link to one of the other runners in this period while the network of this host is idle, the history is served by the REST API at /v1/links, only in watch mode")
+	flag.IntVar(&f.JobQuota, "job-quota", 0, "jobs each user of -job-tokens may have queued or running on the REST API at once, 0 for unlimited, only in watch mode")
+	flag.StringVar(&f.JobTokens, "job-tokens", "", "file of lines <user> <token>, the REST API requires one of the tokens to submit, list and cancel jobs, which count against the -job-quota of its user, jobs are not accepted without it, only in watch mode")
+	flag.Uint64Var(&f.Seed, "seed", 0, "job seed, which the random seeds of ranks are derived from at every cluster version")
 	flag.StringVar(&f.ConfigServer, "config-server", "", "config server URL")
+	flag.StringVar(&f.PreResizeHook, "pre-resize-hook", "", "command or HTTP endpoint consulted by the builtin config server before accepting a new cluster")
+	f.EvictionPolicy = plan.EvictHighestRank
+	flag.Var(&f.EvictionPolicy, "eviction-policy", fmt.Sprintf("which peers the builtin config server removes first on scale-down, options are: %s", strings.Join(plan.EvictionPolicyNames(), " | ")))
+	f.DegradedPolicy = plan.DegradedEvict
+	flag.Var(&f.DegradedPolicy, "degraded-policy", fmt.Sprintf("what happens to a peer reporting its GPU unavailable, evict in watch mode or switch all peers to CPU collectives, options are: %s", strings.Join(plan.DegradedPolicyNames(), " | ")))
+	flag.StringVar(&f.AuditLog, "audit-log", "", "append decisions of the builtin config server to this file as JSON lines")
 
 	flag.IntVar(&f.JobStartTime, "t0", int(time.Now().Unix()), "job start timestamp")
 	flag.StringVar(&f.Logfile, "logfile", "", "path to log file")
-	flag.StringVar(&f.LogDir, "logdir", "", "path to log dir")
+	flag.StringVar(&f.LogDir, "logdir", "", "path to log dir, environments of peers are also saved there for kungfu-ctl diff-env")
+	flag.StringVar(&f.Dir, "workdir", "", "working directory of peers, that of kungfu-run if empty")
+	flag.BoolVar(&f.CheckOnly, "check-only", false, "only check that the programs of local peers can be started, and print the problems found as JSON")
+	flag.StringVar(&f.EnvProbe, "env-probe", "", "shell command listing the packages in the environment of each peer, e.g. 'pip freeze', saved to -logdir at start")
+	flag.IntVar(&f.logMaxSize, "log-max-size", 0, "rotate -logfile and log files of peers when they exceed this number of MiB, 0 to disable")
+	flag.DurationVar(&f.LogRotation.Period, "log-rotate-period", 0, "rotate -logfile and log files of peers when they are older than this, 0 to disable")
+	flag.DurationVar(&f.LogRotation.MaxAge, "log-max-age", 0, "remove rotated log files older than this, 0 to keep all")
+	flag.BoolVar(&f.LogRotation.Compress, "log-compress", false, "gzip rotated log files")
+	flag.Var((*logSinkFlags)(&f.LogSinks), "log-sink", "also send logs of kungfu-run and peers to syslog://[<host>:<port>], fluentd://<host>:<port> or cloudwatch://<group>/<stream>, can be repeated")
 	flag.BoolVar(&f.Quiet, "q", false, "don't log debug info")
+	flag.StringVar(&f.Summary, "summary", "", "save a JSON summary of local peers to the file at exit, - for stdout")
+	flag.Var((*webhookFlags)(&f.Webhooks), "webhook", "[<event>,...=]<url> POSTed a JSON payload on scale-up, scale-down, peer-failure and job-complete, or only on the given events, can be repeated")
+	flag.BoolVar(&f.PerfReport, "perf-report", false, "log GC pauses, heap growth and top allocation sites of kungfu-run and the Go layer of peers at exit")
+	flag.IntVar(&f.GCPercent, "gc-percent", 0, "GOGC of kungfu-run and peers, trading memory for less GC time, 0 to keep the default")
+	flag.BoolVar(&f.ForwardCrashes, "forward-crashes", false, "print crash reports of local peers to stdout, used when launched by kungfu-rrun")
+	flag.Var(&f.Binaries, "prog-for", "<os>/<arch>=<path> of the main program on hosts of the platform, e.g. darwin/arm64=./train-mac, can be repeated")
+	flag.StringVar(&f.Role, "role", "", "role label of the main program, exposed to peers as "+env.RoleEnvKey)
+
+	flag.StringVar(&f.Provider, "provider", "", "provision new hosts from a cloud when the builtin config server is asked to scale up, options are: ec2")
+	flag.StringVar(&f.ProviderConfig, "provider-config", "", "path to JSON config of the provider")
+
+	flag.BoolVar(&f.Simulate, "simulate", false, "run all peers as goroutines of this process over an in-memory transport, for developing strategies")
+	flag.IntVar(&f.SimulateSteps, "simulate-steps", 10, "number of all-reduce steps run by each simulated peer")
 
 	flag.DurationVar(&f.DelayStart, "delay", 0, "delay start for testing purpose")
 	flag.IntVar(&f.BuiltinConfigPort, "builtin-config-port", 0, "will run a builtin config server if not zero")
 }
 
-var errMissingProgramName = errors.New("missing program name")
+var (
+	errMissingProgramName = errors.New("missing program name")
+	errInvalidFamily      = errors.New("-prefer-family must be 4 or 6")
+)
 
 func (f *FlagSet) Parse(args []string) error {
 	commandLine := flag.NewFlagSet(args[0], flag.ExitOnError)
@@ -110,12 +245,40 @@ func (f *FlagSet) Parse(args []string) error {
 	if err := f.resolveHostList(); err != nil {
 		return err
 	}
-	args = commandLine.Args()
+	if err := f.resolveRankMap(commandLine); err != nil {
+		return err
+	}
+	if f.PreferFamily != 4 && f.PreferFamily != 6 {
+		return fmt.Errorf("%v: %d", errInvalidFamily, f.PreferFamily)
+	}
+	f.LogRotation.MaxSize = int64(f.logMaxSize) << 20
+	f.Federation = nil
+	if len(f.federation) > 0 {
+		f.Federation = strings.Split(f.federation, ",")
+	}
+	sections := splitSections(commandLine.Args())
+	args = sections[0]
+	if f.Simulate && len(sections) == 1 && len(args) == 0 {
+		return nil
+	}
 	if len(args) < 1 {
 		return errMissingProgramName
 	}
 	f.Prog = args[0]
 	f.Args = args[1:]
+	f.Programs = nil
+	n := f.ClusterSize
+	for _, s := range sections[1:] {
+		p, err := parseProgram(s)
+		if err != nil {
+			return err
+		}
+		f.Programs = append(f.Programs, *p)
+		n -= p.Count
+	}
+	if n < 1 {
+		return errInvalidProgramCount
+	}
 	return nil
 }
 
@@ -135,3 +298,43 @@ func (f *FlagSet) resolveHostList() error {
 	}
 	return nil
 }
+
+var errRankMapSize = errors.New("size of -rankmap doesn't match -np")
+
+// resolveRankMap loads -rankmap, which also gives -np if it is not specified
+func (f *FlagSet) resolveRankMap(commandLine *flag.FlagSet) error {
+	f.RankMap = nil
+	if len(f.rankMapFile) == 0 {
+		return nil
+	}
+	bs, err := ioutil.ReadFile(f.rankMapFile)
+	if err != nil {
+		return err
+	}
+	m, err := plan.ParseRankMap(string(bs))
+	if err != nil {
+		return err
+	}
+	var npSet bool
+	commandLine.Visit(func(fl *flag.Flag) { npSet = npSet || fl.Name == "np" })
+	if !npSet {
+		f.ClusterSize = len(m)
+	} else if f.ClusterSize != len(m) {
+		return fmt.Errorf("%v: %d != %d", errRankMapSize, len(m), f.ClusterSize)
+	}
+	f.RankMap = m
+	return nil
+}
+
+// logSinkFlags is a repeatable flag of log sink URLs
+type logSinkFlags []string
+
+func (s *logSinkFlags) String() string {
+	return strings.Join(*s, ",")
+}
+
+// Set implements flags.Value::Set
+func (s *logSinkFlags) Set(val string) error {
+	*s = append(*s, val)
+	return nil
+}
@@ -26,3 +26,21 @@ func Test_flag(t *testing.T) {
 		}
 	}
 }
+
+func Test_ParsePrograms(t *testing.T) {
+	var f FlagSet
+	args := []string{`kungfu-run`, `-np`, `9`, `-role`, `trainer`, `python3`, `train.py`, `:`, `-np`, `1`, `-role`, `evaluator`, `-env`, `X=1`, `python3`, `eval.py`, `--once`}
+	if err := f.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	if f.Prog != `python3` || len(f.Args) != 1 || f.Role != `trainer` {
+		t.Errorf("failed to parse main program")
+	}
+	if len(f.Programs) != 1 {
+		t.Fatalf("expect %d programs, got %d", 1, len(f.Programs))
+	}
+	p := f.Programs[0]
+	if p.Count != 1 || p.Role != `evaluator` || p.Envs[`X`] != `1` || p.Prog != `python3` || len(p.Args) != 2 {
+		t.Errorf("failed to parse program section: %s", p.DebugString())
+	}
+}
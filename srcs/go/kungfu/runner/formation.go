@@ -0,0 +1,137 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/kungfu/formation"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/client"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+	"github.com/lsds/KungFu/srcs/go/rchannel/handler"
+	"github.com/lsds/KungFu/srcs/go/rchannel/server"
+	"github.com/lsds/KungFu/srcs/go/utils"
+)
+
+// formationPeriod is the period the first runner prints the progress of cluster formation at,
+// nothing is printed if the cluster is formed within the first period.
+const formationPeriod = 3 * time.Second
+
+// routeFormation records a formation report if self is the first runner of the cluster, or forwards it to the first runner
+func routeFormation(self plan.PeerID, c *client.Client, t *formation.Tracker, runners plan.PeerList, msg *connection.Message, src plan.PeerID) {
+	var r formation.Report
+	if err := r.Decode(msg.Data); err != nil {
+		log.Warnf("invalid formation report from %s: %v", src, err)
+		return
+	}
+	if len(runners) == 0 {
+		return
+	}
+	if leader := runners[0]; leader != self {
+		if err := c.Send(leader.WithName(formation.ReportName), msg.Data, connection.ConnControl, connection.NoFlag); err != nil {
+			log.Debugf("failed to forward formation report to %s: %v", leader, err)
+		}
+		return
+	}
+	t.Record(r)
+}
+
+func (h *Handler) handleContrlFormation(_name string, msg *connection.Message, conn connection.Connection) {
+	cluster, _ := h.latestCluster()
+	routeFormation(h.self, h.client, h.formation, cluster.Runners, msg, conn.Src())
+}
+
+// watchFormation prints the progress of a cluster version every formationPeriod until all its peers are ready, or a later version is expected
+func watchFormation(ctx context.Context, t *formation.Tracker, version int) {
+	t0 := time.Now()
+	tk := time.NewTicker(formationPeriod / 10)
+	defer tk.Stop()
+	var printed time.Time
+	for {
+		select {
+		case <-tk.C:
+		case <-ctx.Done():
+			return
+		}
+		if latest, _ := t.Latest(); latest != version {
+			return
+		}
+		p, ok := t.Progress(version)
+		if !ok {
+			return
+		}
+		if p.Done() {
+			if !printed.IsZero() {
+				log.Infof("cluster v%d of %s formed after %s", version, utils.Pluralize(p.Total, "peer", "peers"), time.Since(t0))
+			}
+			return
+		}
+		if now := time.Now(); now.Sub(t0) >= formationPeriod && now.Sub(printed) >= formationPeriod {
+			log.Infof("forming cluster %s", p)
+			printed = now
+		}
+	}
+}
+
+// formationHandler serves formation reports and relays connections in simple mode, in which the runner doesn't serve control messages otherwise
+type formationHandler struct {
+	self    plan.PeerID
+	runners plan.PeerList
+	tracker *formation.Tracker
+	client  *client.Client
+	relay   *relay
+	ping    handler.PingHandler
+}
+
+func (f *formationHandler) Handle(conn connection.Connection) (int, error) {
+	switch t := conn.Type(); t {
+	case connection.ConnControl:
+		return connection.Stream(conn, connection.Accept, f.handleControl)
+	case connection.ConnPing:
+		return f.ping.Handle(conn)
+	case connection.ConnRelay:
+		return f.relay.handleRelay(conn)
+	case connection.ConnMux:
+		return f.relay.handleMux(conn)
+	default:
+		return 0, fmt.Errorf("%v: %s from %s", connection.ErrInvalidConnectionType, t, conn.Src())
+	}
+}
+
+func (f *formationHandler) handleControl(name string, msg *connection.Message, conn connection.Connection) {
+	if name != formation.ReportName {
+		log.Debugf("ignored control message %s from %s in simple mode", name, conn.Src())
+		return
+	}
+	routeFormation(f.self, f.client, f.tracker, f.runners, msg, conn.Src())
+}
+
+// serveFormation serves the formation reports of a simple run, and prints the progress on the first runner.
+// The returned function stops serving.
+func serveFormation(ctx context.Context, self plan.PeerID, cluster plan.Cluster) func() {
+	f := &formationHandler{
+		self:    self,
+		runners: cluster.Runners,
+		tracker: formation.NewTracker(),
+		client:  client.New(self, config.UseUnixSock),
+		relay:   newRelay(self, func() plan.PeerList { return cluster.Runners }),
+		ping:    handler.PingHandler{Digest: digestOf(cluster.Workers)},
+	}
+	f.tracker.Expect(0, cluster.Workers)
+	srv := server.New(self, f, config.UseUnixSock)
+	if err := srv.Start(); err != nil {
+		log.Warnf("formation progress is not reported: %v", err)
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	if isFirstRunner(cluster.Runners, self.IPv4) {
+		go watchFormation(ctx, f.tracker, 0)
+	}
+	return func() {
+		cancel()
+		srv.Close()
+	}
+}
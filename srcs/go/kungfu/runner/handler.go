@@ -7,10 +7,20 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/lsds/KungFu/srcs/go/kungfu/checksum"
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/kungfu/elastic/configsource"
+	"github.com/lsds/KungFu/srcs/go/kungfu/formation"
+	"github.com/lsds/KungFu/srcs/go/kungfu/kv"
 	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/monitor"
 	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/client"
 	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
 	"github.com/lsds/KungFu/srcs/go/rchannel/handler"
 	"github.com/lsds/KungFu/srcs/go/utils"
@@ -39,13 +49,31 @@ func (s Stage) Eq(t Stage) bool {
 type Handler struct {
 	self plan.PeerID
 
-	mu       sync.RWMutex
-	versions map[int]Stage
-	ch       chan Stage
-	cancel   context.CancelFunc
+	mu         sync.RWMutex
+	versions   map[int]Stage
+	forwards   map[int]*stageForward // of the Stages received from peers and runners
+	applied    int                   // version of the Stage run by the watcher
+	migrations map[plan.PeerID][]byte
+	leases     map[plan.PeerID]time.Time
+	alerts     []monitor.QueueAlert // the latest maxAlerts received from local peers
+	degraded   map[plan.PeerID]DegradedReport
+	onDegraded chan plan.PeerID   // local peers newly reported degraded, handled by the watcher
+	inbound    map[inboundKey]int // connections being served
+	checksums  map[checksumRound][]checksum.Report
+	drifts     []checksum.Drift // the latest maxDrifts detected
+	ch         chan Stage
+	cancel     context.CancelFunc
+	kv         *kv.Store
+	formation  *formation.Tracker // progress of the cluster versions, on the first runner
+	client     *client.Client
+	acks       *StageAcks // of the Stages forwarded to the children in the fan-out tree
+	relay      *relay
 
 	controlHandlers map[string]connection.MsgHandleFunc
 	pingHandler     *handler.PingHandler
+
+	jobs  *jobQueue    // jobs submitted by the REST API, nil if not accepted
+	links *linkHistory // probed in the background if enabled
 }
 
 func (h *Handler) Self() plan.PeerID {
@@ -56,22 +84,57 @@ func NewHandler(self plan.PeerID, ch chan Stage, cancel context.CancelFunc) *Han
 	h := &Handler{
 		self:            self,
 		versions:        make(map[int]Stage),
+		forwards:        make(map[int]*stageForward),
+		migrations:      make(map[plan.PeerID][]byte),
+		leases:          make(map[plan.PeerID]time.Time),
+		degraded:        make(map[plan.PeerID]DegradedReport),
+		onDegraded:      make(chan plan.PeerID, 16),
+		inbound:         make(map[inboundKey]int),
+		checksums:       make(map[checksumRound][]checksum.Report),
 		ch:              ch,
 		cancel:          cancel,
+		kv:              kv.New(),
+		formation:       formation.NewTracker(),
+		client:          client.New(self, config.UseUnixSock),
+		acks:            NewStageAcks(),
 		controlHandlers: make(map[string]connection.MsgHandleFunc),
 		pingHandler:     &handler.PingHandler{},
+		links:           newLinkHistory(),
 	}
-	h.controlHandlers["update"] = h.handleContrlUpdate
+	h.relay = newRelay(self, func() plan.PeerList {
+		cluster, _ := h.latestCluster()
+		return cluster.Runners
+	})
+	h.controlHandlers[UpdateName] = h.handleContrlUpdate
+	h.controlHandlers[CompressedUpdateName] = h.handleContrlUpdate
+	h.controlHandlers[DeltaUpdateName] = h.handleContrlUpdate
+	h.controlHandlers[UpdateNackName] = h.handleContrlUpdateNack
+	h.controlHandlers[UpdateAckName] = h.handleContrlUpdateAck
+	h.controlHandlers[RestartedName] = h.handleContrlRestarted
 	h.controlHandlers["exit"] = h.handleContrlExit
+	h.controlHandlers["migrate"] = h.handleContrlMigrate
+	h.controlHandlers["lease"] = h.handleContrlLease
+	h.controlHandlers[monitor.QueueAlertName] = h.handleContrlQueueAlert
+	h.controlHandlers[DegradedName] = h.handleContrlDegraded
+	h.controlHandlers[checksum.ReportName] = h.handleContrlChecksum
+	h.controlHandlers[kv.PutName] = h.handleContrlKVPut
+	h.controlHandlers[kv.SnapshotName] = h.handleContrlKVSnapshot
+	h.controlHandlers[kv.SyncName] = h.handleContrlKVSync
+	h.controlHandlers[formation.ReportName] = h.handleContrlFormation
 	return h
 }
 
 func (h *Handler) Handle(conn connection.Connection) (int, error) {
+	defer h.trackInbound(conn)()
 	switch t := conn.Type(); t {
 	case connection.ConnControl:
 		return connection.Stream(conn, connection.Accept, h.handleControl)
 	case connection.ConnPing:
 		return h.pingHandler.Handle(conn)
+	case connection.ConnRelay:
+		return h.relay.handleRelay(conn)
+	case connection.ConnMux:
+		return h.relay.handleMux(conn)
 	default:
 		return 0, fmt.Errorf("%v: %s from %s", connection.ErrInvalidConnectionType, t, conn.Src())
 	}
@@ -82,39 +145,310 @@ func (h *Handler) handleControl(name string, msg *connection.Message, conn conne
 	handle, ok := h.controlHandlers[name]
 	if !ok {
 		log.Warnf("invalid control messaeg: %s", name)
+		return
 	}
 	handle(name, msg, conn)
 }
 
 var errInconsistentUpdate = errors.New("inconsistent update detected")
 
-func (h *Handler) handleContrlUpdate(_name string, msg *connection.Message, _conn connection.Connection) {
-	var s Stage
-	if err := s.Decode(msg.Data); err != nil {
+func (h *Handler) handleContrlUpdate(name string, msg *connection.Message, conn connection.Connection) {
+	s, err := decodeUpdate(name, msg.Data, h.lookup)
+	if e, ok := err.(missingBaseError); ok {
+		log.Warnf("%v from %s, asking for the full stage", e, conn.Src())
+		go func(src plan.PeerID) {
+			if err := h.client.Send(src.WithName(UpdateNackName), EncodeUpdateNack(e.Version), connection.ConnControl, connection.NoFlag); err != nil {
+				log.Errorf("failed to ask %s for v%d: %v", src, e.Version, err)
+			}
+		}(conn.Src())
+		return
+	}
+	if err != nil {
 		log.Warnf("invalid update message: %v", err)
 		return
 	}
-	func() {
-		h.mu.Lock()
-		defer h.mu.Unlock()
-		if val, ok := h.versions[s.Version]; ok {
-			if !val.Eq(s) {
-				utils.ExitErr(errInconsistentUpdate)
-			}
-			return
+	isNew, err := h.accept(*s)
+	if err != nil {
+		utils.ExitErr(err)
+	}
+	go func(src plan.PeerID) {
+		var failed plan.PeerList
+		if isNew {
+			failed = h.forward(*s)
+			h.forwarded(s.Version, failed)
+		} else {
+			failed = h.waitForward(s.Version)
+		}
+		ack := StageAck{Version: s.Version, Failed: failed}
+		if err := h.client.Send(src.WithName(UpdateAckName), ack.Encode(), connection.ConnControl, connection.NoFlag); err != nil {
+			log.Warnf("failed to acknowledge v%d to %s: %v", s.Version, src, err)
+		}
+	}(conn.Src())
+}
+
+func (h *Handler) handleContrlUpdateAck(_name string, msg *connection.Message, conn connection.Connection) {
+	var ack StageAck
+	if err := ack.Decode(msg.Data); err != nil {
+		log.Warnf("invalid update ack from %s: %v", conn.Src(), err)
+		return
+	}
+	h.acks.Deliver(conn.Src(), ack)
+}
+
+// forwarded records the result of forwarding a Stage, for the acks of its duplicates
+func (h *Handler) forwarded(version int, failed plan.PeerList) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if f, ok := h.forwards[version]; ok {
+		f.failed = failed
+		close(f.done)
+	}
+}
+
+// waitForward returns the runners which didn't receive a Stage once it is forwarded, the Stages not received from peers and runners are not forwarded
+func (h *Handler) waitForward(version int) plan.PeerList {
+	h.mu.RLock()
+	f, ok := h.forwards[version]
+	h.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	<-f.done
+	return f.failed
+}
+
+// handleContrlUpdateNack resends a Stage forwarded by this runner in full, to a runner which doesn't have the base of its delta
+func (h *Handler) handleContrlUpdateNack(_name string, msg *connection.Message, conn connection.Connection) {
+	version, err := DecodeUpdateNack(msg.Data)
+	if err != nil {
+		log.Warnf("invalid update nack from %s: %v", conn.Src(), err)
+		return
+	}
+	s, ok := h.lookup(version)
+	if !ok {
+		log.Warnf("%s asked for unknown v%d", conn.Src(), version)
+		return
+	}
+	name, bs := EncodeUpdate(s, nil, config.CompressStages)
+	go func(src plan.PeerID) {
+		if err := h.client.Send(src.WithName(name), bs, connection.ConnControl, connection.NoFlag); err != nil {
+			log.Errorf("failed to resend v%d to %s: %v", version, src, err)
+		}
+	}(conn.Src())
+}
+
+// RestartedName is the control message a runner announces the restart of its server with, carrying the decimal latest version it knows
+const RestartedName = "restarted"
+
+// announce tells the other runners of the latest cluster, or of the initial runners if no Stage is known yet,
+// that the server of this runner restarted, so that the latest Stage is resent if this runner missed it while its server was down.
+func (h *Handler) announce(initial plan.PeerList) {
+	runners := initial
+	if cluster, ok := h.latestCluster(); ok {
+		runners = cluster.Runners
+	}
+	version, ok := h.latest()
+	if !ok {
+		version = -1
+	}
+	bs := []byte(strconv.Itoa(version))
+	others := runners.Others(h.self)
+	for _, r := range others {
+		if err := h.client.Send(r.WithName(RestartedName), bs, connection.ConnControl, connection.NoFlag); err != nil {
+			log.Warnf("failed to announce restart to %s: %v", r, err)
+		}
+	}
+	log.Infof("announced restart to %d runners at v%d", len(others), version)
+}
+
+// handleContrlRestarted resends the latest Stage to a runner whose server restarted, if it announced an older version.
+// Only the first of the other runners of the Stage resends it.
+func (h *Handler) handleContrlRestarted(_name string, msg *connection.Message, conn connection.Connection) {
+	version, err := strconv.Atoi(string(msg.Data))
+	if err != nil {
+		log.Warnf("invalid restart announcement from %s: %v", conn.Src(), err)
+		return
+	}
+	src := conn.Src()
+	latest, ok := h.latest()
+	if !ok || latest <= version {
+		return
+	}
+	s, ok := h.lookup(latest)
+	if !ok || !s.Cluster.Runners.Contains(src) {
+		return
+	}
+	if others := s.Cluster.Runners.Others(src); len(others) == 0 || others[0] != h.self {
+		return
+	}
+	log.Infof("%s restarted at v%d, resending v%d", src, version, latest)
+	go func() {
+		if err := h.sendStage(src, s, Stage{}, false); err != nil {
+			log.Warnf("failed to resend v%d to %s: %v", latest, src, err)
 		}
-		h.versions[s.Version] = s
-		h.ch <- s
-		log.Debugf("update to v%d with %s", s.Version, s.Cluster.DebugString())
 	}()
 }
 
+// AcceptPushes applies the Configs pushed by kungfu-ctl or a config server, in addition to those of the config source
+func (h *Handler) AcceptPushes() {
+	h.controlHandlers[configsource.PushName] = h.handleContrlPush
+}
+
+func (h *Handler) handleContrlPush(_name string, msg *connection.Message, conn connection.Connection) {
+	var c configsource.Config
+	if err := c.Decode(msg.Data); err != nil {
+		log.Warnf("invalid config pushed by %s: %v", conn.Src(), err)
+		return
+	}
+	log.Debugf("v%d pushed by %s", c.Version, conn.Src())
+	h.Propose(Stage{Version: c.Version, Cluster: c.Cluster})
+}
+
+// Propose updates to a Stage published by a config source, Stages not newer than the latest known one are ignored
+func (h *Handler) Propose(s Stage) {
+	if latest, ok := h.latest(); ok && s.Version < latest {
+		log.Debugf("ignored outdated v%d, latest is v%d", s.Version, latest)
+		return
+	}
+	isNew, err := h.accept(s)
+	if err != nil {
+		log.Warnf("ignored v%d from config source: %v", s.Version, err)
+		return
+	}
+	if isNew {
+		h.forwarded(s.Version, nil)
+	}
+}
+
+// accept records a Stage and passes it to the watcher, it returns true if the Stage is new
+func (h *Handler) accept(s Stage) (bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if val, ok := h.versions[s.Version]; ok {
+		if !val.Eq(s) {
+			return false, errInconsistentUpdate
+		}
+		return false, nil
+	}
+	h.versions[s.Version] = s
+	h.forwards[s.Version] = &stageForward{done: make(chan struct{})}
+	h.ch <- s
+	log.Debugf("update to v%d with %s", s.Version, s.Cluster.DebugString())
+	return true, nil
+}
+
+func (h *Handler) latest() (int, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var v int
+	var ok bool
+	for version := range h.versions {
+		if !ok || version > v {
+			v, ok = version, true
+		}
+	}
+	return v, ok
+}
+
+func (h *Handler) lookup(version int) (Stage, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	s, ok := h.versions[version]
+	return s, ok
+}
+
+// record keeps the Stage which was not received from peers, e.g. the initial Stage, as the base of later deltas
+func (h *Handler) record(s Stage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.applied = s.Version
+	if _, ok := h.versions[s.Version]; !ok {
+		h.versions[s.Version] = s
+	}
+}
+
 func (h *Handler) handleContrlExit(_name string, msg *connection.Message, _conn connection.Connection) {
 	log.Infof("exit control message received.")
 	h.cancel()
 }
 
+func (h *Handler) handleContrlMigrate(_name string, msg *connection.Message, conn connection.Connection) {
+	var m Migration
+	if err := m.Decode(msg.Data); err != nil {
+		log.Warnf("invalid migrate message: %v", err)
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.migrations[m.Target] = m.State
+	log.Infof("received state of %s for %s", conn.Src(), m.Target)
+}
+
+func (h *Handler) handleContrlLease(_name string, msg *connection.Message, conn connection.Connection) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.leases[conn.Src()] = time.Now()
+}
+
+const maxAlerts = 100
+
+func (h *Handler) handleContrlQueueAlert(_name string, msg *connection.Message, conn connection.Connection) {
+	var a monitor.QueueAlert
+	if err := json.Unmarshal(msg.Data, &a); err != nil {
+		log.Warnf("invalid queue alert from %s: %v", conn.Src(), err)
+		return
+	}
+	log.Warnf("backpressure: %s", a)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.alerts = append(h.alerts, a)
+	if len(h.alerts) > maxAlerts {
+		h.alerts = h.alerts[len(h.alerts)-maxAlerts:]
+	}
+}
+
+func (h *Handler) queueAlerts() []monitor.QueueAlert {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return append([]monitor.QueueAlert{}, h.alerts...)
+}
+
+// GrantLease starts the lease of a peer when it starts, so that it expires if the peer never renews it
+func (h *Handler) GrantLease(id plan.PeerID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.leases[id] = time.Now()
+}
+
+// LeaseExpired returns true if the lease of the peer was granted or renewed, but not renewed within the period since
+func (h *Handler) LeaseExpired(id plan.PeerID, period time.Duration) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	renewed, ok := h.leases[id]
+	return ok && time.Since(renewed) > period
+}
+
+// DropLease forgets the lease of a peer which is no longer running
+func (h *Handler) DropLease(id plan.PeerID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.leases, id)
+}
+
+// TakeMigrationState returns the state handed over to a new worker, if any
+func (h *Handler) TakeMigrationState(id plan.PeerID) ([]byte, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	state, ok := h.migrations[id]
+	delete(h.migrations, id)
+	return state, ok
+}
+
 func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if strings.HasPrefix(req.URL.Path, APIPrefix+"/") {
+		h.serveAPI(w, req)
+		return
+	}
 	e := json.NewEncoder(w)
 	e.SetIndent("", "    ")
 	h.mu.RLock()
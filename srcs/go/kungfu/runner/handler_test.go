@@ -0,0 +1,163 @@
+package runner
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/server"
+)
+
+func freePort(t *testing.T) uint16 {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return uint16(l.Addr().(*net.TCPAddr).Port)
+}
+
+// startHandler serves a runner Handler on a free port, the Stages it accepts are sent to the returned channel
+func startHandler(t *testing.T) (*Handler, chan Stage, func()) {
+	self := plan.PeerID{IPv4: plan.MustParseIPv4("127.0.0.1"), Port: freePort(t)}
+	ch := make(chan Stage, 16)
+	_, cancel := context.WithCancel(context.TODO())
+	h := NewHandler(self, ch, cancel)
+	srv := server.New(self, h, config.UseUnixSock)
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return h, ch, func() {
+		srv.Close()
+		cancel()
+	}
+}
+
+func waitStage(t *testing.T, ch chan Stage, version int) {
+	select {
+	case s := <-ch:
+		if s.Version != version {
+			t.Fatalf("got v%d, expect v%d", s.Version, version)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("v%d not received", version)
+	}
+}
+
+func Test_ResendMissingBase(t *testing.T) {
+	a, _, stopA := startHandler(t)
+	defer stopA()
+	b, chB, stopB := startHandler(t)
+	defer stopB()
+	base := Stage{Version: 1, Cluster: plan.Cluster{Runners: plan.PeerList{a.self, b.self}}}
+	s := Stage{Version: 2, Cluster: plan.Cluster{Runners: base.Cluster.Runners, Workers: plan.PeerList{{IPv4: a.self.IPv4, Port: 10000}}}}
+	a.record(base)
+	a.record(s)
+	if _, err := a.sendStageAcked(b.self, s, base, true); err != nil {
+		t.Fatal(err)
+	}
+	waitStage(t, chB, s.Version)
+	if got, ok := b.lookup(s.Version); !ok || !got.Eq(s) {
+		t.Errorf("v%d is not resent in full", s.Version)
+	}
+}
+
+func Test_ResendAfterRestart(t *testing.T) {
+	a, _, stopA := startHandler(t)
+	defer stopA()
+	b, chB, stopB := startHandler(t)
+	defer stopB()
+	old := Stage{Version: 1, Cluster: plan.Cluster{Runners: plan.PeerList{a.self, b.self}}}
+	s := Stage{Version: 2, Cluster: plan.Cluster{Runners: old.Cluster.Runners, Workers: plan.PeerList{{IPv4: a.self.IPv4, Port: 10000}}}}
+	a.record(old)
+	a.record(s)
+	b.record(old)
+	b.announce(nil)
+	waitStage(t, chB, s.Version)
+	b.waitForward(s.Version)
+}
+
+// startTree serves n runner Handlers, which forward the Stages to each other over a fan-out tree of fanout
+func startTree(t *testing.T, n, fanout int) ([]*Handler, []chan Stage, []func(), plan.PeerList) {
+	config.StageFanout = fanout
+	var hs []*Handler
+	var chs []chan Stage
+	var stops []func()
+	var runners plan.PeerList
+	for i := 0; i < n; i++ {
+		h, ch, stop := startHandler(t)
+		hs, chs, stops = append(hs, h), append(chs, ch), append(stops, stop)
+		runners = append(runners, h.self)
+	}
+	return hs, chs, stops, runners
+}
+
+func Test_ForwardToAllRunners(t *testing.T) {
+	defer func(fanout int) { config.StageFanout = fanout }(config.StageFanout)
+	hs, chs, stops, runners := startTree(t, 7, 2)
+	for _, stop := range stops {
+		defer stop()
+	}
+	src, _, stopSrc := startHandler(t)
+	defer stopSrc()
+	s := Stage{Version: 1, Cluster: plan.Cluster{Runners: runners}}
+	ack, err := src.sendStageAcked(hs[0].self, s, Stage{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ack.Failed) > 0 {
+		t.Errorf("v%d is not received by %s", s.Version, ack.Failed)
+	}
+	for _, ch := range chs {
+		waitStage(t, ch, s.Version)
+	}
+}
+
+func Test_AckFailedSubtree(t *testing.T) {
+	defer func(fanout int) { config.StageFanout = fanout }(config.StageFanout)
+	defer func(timeout time.Duration) { config.WaitRunnerTimeout = timeout }(config.WaitRunnerTimeout)
+	config.WaitRunnerTimeout = 500 * time.Millisecond
+	hs, chs, stops, runners := startTree(t, 7, 2)
+	const down = 1 // the children of runner #1 are #3 and #4
+	for i, stop := range stops {
+		if i != down {
+			defer stop()
+		}
+	}
+	stops[down]()
+	src, _, stopSrc := startHandler(t)
+	defer stopSrc()
+	s := Stage{Version: 1, Cluster: plan.Cluster{Runners: runners}}
+	ack, err := src.sendStageAcked(hs[0].self, s, Stage{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ack.Failed.Eq(plan.PeerList{runners[down]}) {
+		t.Errorf("failed runners of v%d are %s, expect %s", s.Version, ack.Failed, runners[down])
+	}
+	for i, ch := range chs {
+		if i != down {
+			waitStage(t, ch, s.Version)
+		}
+	}
+}
+
+func Test_LeaseExpired(t *testing.T) {
+	h := NewHandler(plan.PeerID{}, make(chan Stage, 1), func() {})
+	id := plan.PeerID{IPv4: plan.MustParseIPv4("127.0.0.1"), Port: 10000}
+	const period = 20 * time.Millisecond
+	if h.LeaseExpired(id, period) {
+		t.Errorf("lease of a peer which is not running should not expire")
+	}
+	h.GrantLease(id)
+	if h.LeaseExpired(id, period) {
+		t.Errorf("lease should not expire within the period")
+	}
+	time.Sleep(2 * period)
+	if !h.LeaseExpired(id, period) {
+		t.Errorf("lease of a peer which never renewed it should expire")
+	}
+}
@@ -0,0 +1,98 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/kv"
+	"github.com/lsds/KungFu/srcs/go/kungfu/sealed"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+)
+
+// latestCluster returns the cluster of the latest known Stage
+func (h *Handler) latestCluster() (plan.Cluster, bool) {
+	v, ok := h.latest()
+	if !ok {
+		return plan.Cluster{}, false
+	}
+	s, ok := h.lookup(v)
+	return s.Cluster, ok
+}
+
+// handleContrlKVPut applies the write if self is the first runner of the cluster, or forwards it to the first runner
+func (h *Handler) handleContrlKVPut(_name string, msg *connection.Message, conn connection.Connection) {
+	var p kv.Put
+	if err := p.Decode(msg.Data); err != nil {
+		log.Warnf("invalid kv put from %s: %v", conn.Src(), err)
+		return
+	}
+	cluster, ok := h.latestCluster()
+	if !ok || len(cluster.Runners) == 0 {
+		log.Warnf("dropped kv put from %s before the cluster is known", conn.Src())
+		return
+	}
+	if leader := cluster.Runners[0]; leader != h.self {
+		if err := h.client.Send(leader.WithName(kv.PutName), msg.Data, connection.ConnControl, connection.NoFlag); err != nil {
+			log.Warnf("failed to forward kv put to %s: %v", leader, err)
+		}
+		return
+	}
+	if s, ok := h.kv.Apply(p); ok {
+		h.replicateKV(s, cluster)
+	}
+}
+
+func (h *Handler) handleContrlKVSnapshot(_name string, msg *connection.Message, conn connection.Connection) {
+	var s kv.Snapshot
+	if err := s.Decode(msg.Data); err != nil {
+		log.Warnf("invalid kv snapshot from %s: %v", conn.Src(), err)
+		return
+	}
+	if !h.kv.Accept(s) {
+		return
+	}
+	if cluster, ok := h.latestCluster(); ok {
+		h.sendKV(s, cluster.Workers.On(h.self.IPv4))
+	}
+}
+
+func (h *Handler) handleContrlKVSync(_name string, _msg *connection.Message, conn connection.Connection) {
+	h.sendKV(h.kv.Snapshot(), plan.PeerList{conn.Src()})
+}
+
+// syncKV sends the store to all runners of a new cluster if self is the first of them,
+// so that runners which joined the cluster catch up.
+func (h *Handler) syncKV(cluster plan.Cluster) {
+	if len(cluster.Runners) == 0 || cluster.Runners[0] != h.self {
+		return
+	}
+	if s := h.kv.Snapshot(); s.Version > 0 {
+		h.replicateKV(s, cluster)
+	}
+}
+
+func (h *Handler) replicateKV(s kv.Snapshot, cluster plan.Cluster) {
+	h.sendKV(s, cluster.Runners.Others(h.self))
+	h.sendKV(s, cluster.Workers.On(h.self.IPv4))
+}
+
+// saveKVSnapshot writes the snapshot to a file which will be loaded by the new worker
+func saveKVSnapshot(id plan.PeerID, s kv.Snapshot) (string, error) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("kungfu-kv-%s-%d.json", plan.FormatIPv4(id.IPv4), id.Port))
+	if err := sealed.WriteFile(filename, s.Encode(), 0600); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
+
+func (h *Handler) sendKV(s kv.Snapshot, targets plan.PeerList) {
+	bs := s.Encode()
+	for _, id := range targets {
+		if err := h.client.Send(id.WithName(kv.SnapshotName), bs, connection.ConnControl, connection.NoFlag); err != nil {
+			log.Warnf("failed to send kv snapshot v%d to %s: %v", s.Version, id, err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/utils"
+)
+
+// checkLeases evicts the local peers which failed to renew their leases
+func (w *watcher) checkLeases() {
+	for id := range w.gs {
+		if w.isEvicted(id) {
+			continue
+		}
+		if w.handler.LeaseExpired(id, w.job.LeasePeriod) {
+			log.Warnf("lease of %s expired after %s, evicting", id, w.job.LeasePeriod)
+			w.evict(id)
+		}
+	}
+}
+
+func (w *watcher) isEvicted(id plan.PeerID) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.evicted[id]
+}
+
+// evict kills the peer, its slot is reclaimed when the process exits
+func (w *watcher) evict(id plan.PeerID) {
+	w.mu.Lock()
+	w.evicted[id] = true
+	cancel := w.cancels[id]
+	w.mu.Unlock()
+	cancel()
+	w.handler.DropLease(id)
+	if len(w.job.ConfigServer) == 0 {
+		return
+	}
+	go func() {
+		if err := w.proposeEviction(id); err != nil {
+			log.Errorf("failed to propose cluster without %s: %v", id, err)
+		}
+	}()
+}
+
+// proposeEviction asks the config server to remove the evicted peer from the cluster,
+// or to move its rank to another host if RescheduleEvicted is set.
+func (w *watcher) proposeEviction(id plan.PeerID) error {
+	var client http.Client
+	userAgent := fmt.Sprintf("KungFu Runner: %s", w.parent)
+	f, err := utils.OpenURL(w.job.ConfigServer, &client, userAgent)
+	if err != nil {
+		return err
+	}
+	var cluster plan.Cluster
+	err = json.NewDecoder(f).Decode(&cluster)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	rank, ok := cluster.Workers.Rank(id)
+	if !ok {
+		return nil
+	}
+	newCluster := cluster.Clone()
+	newCluster.Workers = cluster.Workers.Others(id)
+	if w.job.RescheduleEvicted {
+		if ipv4, ok := w.spareHost(cluster, id.IPv4); ok {
+			c, err := cluster.Migrate(rank, ipv4)
+			if err != nil {
+				return err
+			}
+			newCluster = *c
+			log.Infof("rescheduling rank %d of %s to %s", rank, id, plan.FormatIPv4(ipv4))
+		} else {
+			log.Warnf("no spare slot for rank %d of %s, shrinking the cluster", rank, id)
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := json.NewEncoder(buf).Encode(newCluster); err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, w.job.ConfigServer, buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proposal rejected: %s", resp.Status)
+	}
+	return nil
+}
+
+// spareHost returns the least loaded host other than the given one which has a free slot
+func (w *watcher) spareHost(cluster plan.Cluster, except uint32) (uint32, bool) {
+	var best uint32
+	var bestFree int
+	for _, r := range cluster.Runners {
+		if r.IPv4 == except {
+			continue
+		}
+		if free := w.job.HostList.SlotOf(r.IPv4) - len(cluster.Workers.On(r.IPv4)); free > bestFree {
+			best, bestFree = r.IPv4, free
+		}
+	}
+	return best, bestFree > 0
+}
@@ -0,0 +1,196 @@
+package runner
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/utils"
+)
+
+const (
+	linkProbeSize  = 1 << 20 // bytes sent and echoed back by a probe
+	maxLinkSamples = 8640    // kept for each link, a day of samples at the period of 10s
+	idleTraffic    = 1 << 20 // bytes per second of the host, below which the network is considered idle
+)
+
+// LinkSample is a probe of the link to another runner
+type LinkSample struct {
+	Time      time.Time     `json:"time"`
+	RTT       time.Duration `json:"rtt"`
+	Bandwidth float64       `json:"bandwidth"` // bytes per second, 0 if the probe failed
+	Error     string        `json:"error,omitempty"`
+}
+
+// LinkInfo is the history of the link to another runner
+type LinkInfo struct {
+	Peer     string       `json:"peer"`
+	Baseline float64      `json:"baseline"` // median bandwidth of the history
+	Degraded bool         `json:"degraded"` // the latest bandwidth is below half of the Baseline
+	Samples  []LinkSample `json:"samples"`
+}
+
+// linkHistory keeps the latest probes of the links to other runners
+type linkHistory struct {
+	mu    sync.Mutex
+	links map[plan.PeerID][]LinkSample
+}
+
+func newLinkHistory() *linkHistory {
+	return &linkHistory{links: make(map[plan.PeerID][]LinkSample)}
+}
+
+func (l *linkHistory) add(id plan.PeerID, s LinkSample) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	before := linkInfo(id, l.links[id])
+	ss := append(l.links[id], s)
+	if len(ss) > maxLinkSamples {
+		ss = ss[len(ss)-maxLinkSamples:]
+	}
+	l.links[id] = ss
+	if after := linkInfo(id, ss); after.Degraded && !before.Degraded {
+		log.Warnf("link to %s degraded to %s, baseline %s", id, utils.ShowRate(s.Bandwidth), utils.ShowRate(after.Baseline))
+	} else if before.Degraded && !after.Degraded {
+		log.Infof("link to %s recovered to %s", id, utils.ShowRate(s.Bandwidth))
+	}
+}
+
+// list returns the samples taken after since of the links to peer, or all links if peer is empty
+func (l *linkHistory) list(peer string, since time.Time) []LinkInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	infos := []LinkInfo{}
+	for id, ss := range l.links {
+		if len(peer) > 0 && id.String() != peer {
+			continue
+		}
+		info := linkInfo(id, ss)
+		i := sort.Search(len(ss), func(i int) bool { return ss[i].Time.After(since) })
+		info.Samples = append([]LinkSample{}, ss[i:]...)
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Peer < infos[j].Peer })
+	return infos
+}
+
+// linkInfo summarizes the samples of a link, failed probes are counted as degraded
+func linkInfo(id plan.PeerID, ss []LinkSample) LinkInfo {
+	info := LinkInfo{Peer: id.String(), Samples: ss}
+	var bws []float64
+	for _, s := range ss {
+		if len(s.Error) == 0 {
+			bws = append(bws, s.Bandwidth)
+		}
+	}
+	if len(bws) > 0 {
+		sort.Float64s(bws)
+		info.Baseline = bws[len(bws)/2]
+	}
+	if n := len(ss); n > 0 {
+		last := ss[n-1]
+		info.Degraded = len(last.Error) > 0 || last.Bandwidth < info.Baseline/2
+	}
+	return info
+}
+
+// probeLinks probes the link to one of the other runners every period, in turn, while the network of the host is idle
+func (h *Handler) probeLinks(ctx context.Context, period time.Duration) {
+	tk := time.NewTicker(period)
+	defer tk.Stop()
+	var traffic trafficMeter
+	var next int
+	for {
+		select {
+		case <-tk.C:
+		case <-ctx.Done():
+			return
+		}
+		if r, ok := traffic.rate(); ok && r > idleTraffic {
+			log.Debugf("link probe skipped, host traffic: %s", utils.ShowRate(r))
+			continue
+		}
+		cluster, ok := h.latestCluster()
+		if !ok {
+			continue
+		}
+		var targets plan.PeerList
+		for _, r := range cluster.Runners {
+			if r != h.self {
+				targets = append(targets, r)
+			}
+		}
+		if len(targets) == 0 {
+			continue
+		}
+		target := targets[next%len(targets)]
+		next++
+		s := LinkSample{Time: time.Now()}
+		var err error
+		if s.RTT, s.Bandwidth, err = h.client.Probe(target, linkProbeSize); err != nil {
+			s.Bandwidth, s.Error = 0, err.Error()
+		}
+		h.links.add(target, s)
+	}
+}
+
+// trafficMeter measures the traffic of the host from /proc/net/dev, except the loopback
+type trafficMeter struct {
+	last  uint64
+	lastT time.Time
+}
+
+// rate returns the bytes per second received and sent since the last call, it returns false on the first call or if unavailable
+func (m *trafficMeter) rate() (float64, bool) {
+	n, err := hostTraffic()
+	if err != nil {
+		return 0, false
+	}
+	t, last, lastT := time.Now(), m.last, m.lastT
+	m.last, m.lastT = n, t
+	if lastT.IsZero() || n < last {
+		return 0, false
+	}
+	return utils.Rate(int64(n-last), t.Sub(lastT)), true
+}
+
+func hostTraffic() (uint64, error) {
+	f, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return parseNetDev(f)
+}
+
+// parseNetDev sums the bytes received and sent by all interfaces but lo, from the format of /proc/net/dev
+func parseNetDev(r io.Reader) (uint64, error) {
+	var total uint64
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		kv := strings.SplitN(s.Text(), ":", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "lo" {
+			continue
+		}
+		fields := strings.Fields(kv[1])
+		if len(fields) < 9 {
+			continue
+		}
+		for _, i := range []int{0, 8} { // receive bytes, transmit bytes
+			n, err := strconv.ParseUint(fields[i], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			total += n
+		}
+	}
+	return total, s.Err()
+}
@@ -0,0 +1,51 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+func Test_LinkHistory(t *testing.T) {
+	l := newLinkHistory()
+	a := plan.PeerID{IPv4: plan.MustParseIPv4(`192.168.1.11`), Port: 38080}
+	b := plan.PeerID{IPv4: plan.MustParseIPv4(`192.168.1.12`), Port: 38080}
+	t0 := time.Now()
+	for i, bw := range []float64{100, 110, 90, 105, 40} {
+		l.add(a, LinkSample{Time: t0.Add(time.Duration(i) * time.Second), Bandwidth: bw})
+	}
+	l.add(b, LinkSample{Time: t0, Error: "connection refused"})
+
+	infos := l.list("", time.Time{})
+	if len(infos) != 2 {
+		t.Fatalf("got %d links, want 2", len(infos))
+	}
+	if info := infos[0]; info.Peer != a.String() || info.Baseline != 100 || !info.Degraded || len(info.Samples) != 5 {
+		t.Errorf("unexpected link: %+v", info)
+	}
+	if info := infos[1]; !info.Degraded {
+		t.Errorf("failed link should be degraded: %+v", info)
+	}
+	infos = l.list(a.String(), t0.Add(2*time.Second))
+	if len(infos) != 1 || len(infos[0].Samples) != 2 {
+		t.Errorf("unexpected links since t0+2s: %+v", infos)
+	}
+}
+
+func Test_parseNetDev(t *testing.T) {
+	const netDev = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo: 5000      10    0    0    0     0          0         0     5000      10    0    0    0     0       0          0
+  eth0: 1000      10    0    0    0     0          0         0      200       2    0    0    0     0       0          0
+  eth1:   30       1    0    0    0     0          0         0        4       1    0    0    0     0       0          0
+`
+	n, err := parseNetDev(strings.NewReader(netDev))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1234 {
+		t.Errorf("got %d bytes, want 1234", n)
+	}
+}
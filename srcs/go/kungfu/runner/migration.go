@@ -0,0 +1,38 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/sealed"
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+// Migration carries the state of a migrating worker to the runner of its replacement
+type Migration struct {
+	Target plan.PeerID
+	State  []byte
+}
+
+func (m Migration) Encode() []byte {
+	b := &bytes.Buffer{}
+	json.NewEncoder(b).Encode(m)
+	return b.Bytes()
+}
+
+func (m *Migration) Decode(bs []byte) error {
+	b := bytes.NewBuffer(bs)
+	return json.NewDecoder(b).Decode(m)
+}
+
+// saveMigrationState writes the state to a file which will be loaded by the new worker
+func saveMigrationState(id plan.PeerID, state []byte) (string, error) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("kungfu-migration-%s-%d.json", plan.FormatIPv4(id.IPv4), id.Port))
+	if err := sealed.WriteFile(filename, state, 0600); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
@@ -0,0 +1,71 @@
+package runner
+
+import (
+	"errors"
+	"flag"
+	"strings"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/job"
+	"github.com/lsds/KungFu/srcs/go/proc"
+)
+
+var (
+	errInvalidEnv          = errors.New("invalid env, K=V is expected")
+	errInvalidProgramCount = errors.New("invalid number of peers for program")
+)
+
+type envFlags proc.Envs
+
+func (e envFlags) String() string {
+	var kvs []string
+	for k, v := range e {
+		kvs = append(kvs, k+"="+v)
+	}
+	return strings.Join(kvs, ",")
+}
+
+// Set implements flags.Value::Set
+func (e envFlags) Set(val string) error {
+	parts := strings.SplitN(val, "=", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 {
+		return errInvalidEnv
+	}
+	e[parts[0]] = parts[1]
+	return nil
+}
+
+// splitSections splits args by job.ProgramSeparator
+func splitSections(args []string) [][]string {
+	var sections [][]string
+	var s []string
+	for _, a := range args {
+		if a == job.ProgramSeparator {
+			sections = append(sections, s)
+			s = nil
+			continue
+		}
+		s = append(s, a)
+	}
+	return append(sections, s)
+}
+
+// parseProgram parses a program section of the form: [-np <n>] [-role <role>] [-env K=V]... <prog> [args...]
+func parseProgram(args []string) (*job.Program, error) {
+	p := job.Program{Envs: make(proc.Envs)}
+	fs := flag.NewFlagSet(job.ProgramSeparator, flag.ContinueOnError)
+	fs.IntVar(&p.Count, "np", 1, "number of peers running the program")
+	fs.StringVar(&p.Role, "role", "", "role label of the program")
+	fs.Var(envFlags(p.Envs), "env", "K=V, extra env of the program, can be repeated")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if p.Count < 1 {
+		return nil, errInvalidProgramCount
+	}
+	if fs.NArg() < 1 {
+		return nil, errMissingProgramName
+	}
+	p.Prog = fs.Arg(0)
+	p.Args = fs.Args()[1:]
+	return &p, nil
+}
@@ -0,0 +1,30 @@
+package runner
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+// WriteRankFiles writes the assignments as an OpenMPI rankfile and as a JSON rank map, to the files that are not empty
+func WriteRankFiles(rankfile, rankmap string, as []plan.RankAssignment) error {
+	if len(rankfile) > 0 {
+		if err := ioutil.WriteFile(rankfile, []byte(plan.FormatRankfile(as)), 0644); err != nil {
+			return err
+		}
+		log.Infof("rankfile of %d ranks written to %s", len(as), rankfile)
+	}
+	if len(rankmap) > 0 {
+		bs, err := json.MarshalIndent(as, "", "    ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(rankmap, append(bs, '\n'), 0644); err != nil {
+			return err
+		}
+		log.Infof("rank map of %d ranks written to %s", len(as), rankmap)
+	}
+	return nil
+}
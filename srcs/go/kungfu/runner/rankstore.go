@@ -0,0 +1,121 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/kungfu/execution"
+	"github.com/lsds/KungFu/srcs/go/kungfu/job"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/client"
+)
+
+var (
+	errInvalidJobID = errors.New("invalid job ID")
+	errRanksDiffer  = errors.New("ranks of the initial cluster differ between runners")
+)
+
+// RankStore keeps the ranks of the initial cluster of each job ID on this host, across runs of the job.
+// Runners of all hosts must agree on the ranks, they do as long as they all ran the last run of the job:
+// the stored ranks are only kept if they fit the hosts of the new run, and checkRanks fails the run otherwise.
+type RankStore struct {
+	filename string
+}
+
+// OpenRankStore opens the store of the job in dir, $HOME/.kungfu/ranks if dir is empty
+func OpenRankStore(dir, jobID string) (*RankStore, error) {
+	if len(jobID) == 0 || strings.ContainsAny(jobID, `/\`) || jobID == `.` || jobID == `..` {
+		return nil, fmt.Errorf("%v: %q", errInvalidJobID, jobID)
+	}
+	if len(dir) == 0 {
+		dir = path.Join(os.Getenv(`HOME`), `.kungfu`, `ranks`)
+	}
+	return &RankStore{filename: path.Join(dir, jobID+`.rankmap`)}, nil
+}
+
+// Load returns the ranks of the last run of the job, if there are np of them and they fit hl
+func (s *RankStore) Load(hl plan.HostList, np int, pr plan.PortRange) (plan.RankMap, bool) {
+	bs, err := ioutil.ReadFile(s.filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("failed to load ranks of the last run: %v", err)
+		}
+		return nil, false
+	}
+	m, err := plan.ParseRankMap(string(bs))
+	if err != nil {
+		log.Warnf("ignored ranks of the last run in %s: %v", s.filename, err)
+		return nil, false
+	}
+	if len(m) != np {
+		log.Warnf("ignored ranks of the last run in %s: %d ranks != %d", s.filename, len(m), np)
+		return nil, false
+	}
+	if _, err := hl.PlaceByRankMap(m, pr); err != nil {
+		log.Warnf("ignored ranks of the last run in %s: %v", s.filename, err)
+		return nil, false
+	}
+	return m, true
+}
+
+// Save keeps the ranks of peers for the next run of the job
+func (s *RankStore) Save(peers plan.PeerList) error {
+	if err := os.MkdirAll(path.Dir(s.filename), os.ModePerm); err != nil {
+		return err
+	}
+	text := plan.RankMapOf(peers).String() + "\n"
+	return ioutil.WriteFile(s.filename, []byte(text), 0644)
+}
+
+// digestOf digests the peers of a cluster, runners of a job compare their initial clusters by it
+func digestOf(workers plan.PeerList) []byte {
+	d := sha256.Sum256(workers.Bytes())
+	return d[:]
+}
+
+// checkRanks checks that the other runners of a job with an ID placed the peers of the initial cluster as self did,
+// since each of them loaded the ranks of the last run from its own RankStore. The runners serve digestOf the initial cluster.
+func checkRanks(ctx context.Context, self plan.PeerID, cluster plan.Cluster, j job.Job) error {
+	others := cluster.Runners.Others(self)
+	if len(j.ID) == 0 || len(cluster.Workers) == 0 || len(others) == 0 {
+		return nil
+	}
+	digest := digestOf(cluster.Workers)
+	c := client.New(self, config.UseUnixSock)
+	var mu sync.Mutex
+	var differ []string
+	var compare execution.PeerFunc = func(r plan.PeerID) error {
+		ctx, cancel := context.WithTimeout(ctx, config.WaitRunnerTimeout)
+		defer cancel()
+		if _, ok := c.Wait(ctx, r); !ok {
+			return fmt.Errorf("%s is not reachable", r)
+		}
+		d, err := c.Digest(r, len(digest))
+		if err != nil {
+			return fmt.Errorf("failed to get the ranks of %s: %v", r, err)
+		}
+		if !bytes.Equal(d, digest) {
+			mu.Lock()
+			differ = append(differ, r.String())
+			mu.Unlock()
+		}
+		return nil
+	}
+	if err := compare.Par(others); err != nil {
+		return err
+	}
+	if len(differ) > 0 {
+		return fmt.Errorf("%v: %s, remove the ranks of job %s on all hosts or pass the same -rankmap", errRanksDiffer, differ, j.ID)
+	}
+	return nil
+}
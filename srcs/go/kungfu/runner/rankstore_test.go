@@ -0,0 +1,71 @@
+package runner
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/kungfu/job"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/handler"
+	"github.com/lsds/KungFu/srcs/go/rchannel/server"
+)
+
+func Test_RankStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kungfu-ranks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := OpenRankStore(dir, "../x"); err == nil {
+		t.Errorf("job ID with / should be rejected")
+	}
+	s, err := OpenRankStore(dir, "job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hl, _ := plan.ParseHostList("192.168.1.2:2,192.168.1.3:2")
+	if _, ok := s.Load(hl, 3, plan.DefaultPortRange); ok {
+		t.Errorf("nothing should be loaded before the first run")
+	}
+	peers, _ := plan.ParsePeerList("192.168.1.3:10000,192.168.1.2:10000,192.168.1.3:10001")
+	if err := s.Save(peers); err != nil {
+		t.Fatal(err)
+	}
+	m, ok := s.Load(hl, 3, plan.DefaultPortRange)
+	if !ok {
+		t.Fatalf("ranks of the last run should be kept")
+	}
+	if pl, _ := hl.PlaceByRankMap(m, plan.DefaultPortRange); pl.String() != peers.String() {
+		t.Errorf("ranks not kept: %s, want %s", pl, peers)
+	}
+	if _, ok := s.Load(hl, 4, plan.DefaultPortRange); ok {
+		t.Errorf("ranks of a different cluster size should be ignored")
+	}
+	if _, ok := s.Load(hl[:1], 3, plan.DefaultPortRange); ok {
+		t.Errorf("ranks on a missing host should be ignored")
+	}
+}
+
+func Test_CheckRanks(t *testing.T) {
+	peers, _ := plan.ParsePeerList("192.168.1.3:10000,192.168.1.2:10000,192.168.1.3:10001")
+	self := plan.PeerID{IPv4: plan.MustParseIPv4("127.0.0.1"), Port: freePort(t)}
+	other := plan.PeerID{IPv4: self.IPv4, Port: freePort(t)}
+	srv := server.New(other, &handler.PingHandler{Digest: digestOf(peers)}, config.UseUnixSock)
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	j := job.Job{ID: "job-1"}
+	cluster := plan.Cluster{Runners: plan.PeerList{self, other}, Workers: peers}
+	if err := checkRanks(context.TODO(), self, cluster, j); err != nil {
+		t.Errorf("same ranks should pass: %v", err)
+	}
+	cluster.Workers = plan.PeerList{peers[1], peers[0], peers[2]}
+	if err := checkRanks(context.TODO(), self, cluster, j); err == nil || !strings.Contains(err.Error(), errRanksDiffer.Error()) {
+		t.Errorf("different ranks should fail, got %v", err)
+	}
+}
@@ -0,0 +1,203 @@
+package runner
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+	"github.com/lsds/KungFu/srcs/go/rchannel/mux"
+)
+
+// relay carries the connections of the local peers to the peers of another host as streams of one ConnMux connection
+// between the runners of the two hosts, see connection.UseRelay.
+type relay struct {
+	self    plan.PeerID
+	runners func() plan.PeerList
+
+	mu    sync.Mutex
+	links map[uint32]*muxLink // by the IPv4 of the other host
+}
+
+// muxLink is the session with the runner of another host, ready is closed once it's dialed or failed
+type muxLink struct {
+	ready chan struct{}
+	sess  *mux.Session
+	err   error
+}
+
+func newRelay(self plan.PeerID, runners func() plan.PeerList) *relay {
+	return &relay{
+		self:    self,
+		runners: runners,
+		links:   make(map[uint32]*muxLink),
+	}
+}
+
+// handleRelay relays a ConnRelay connection from a local peer
+func (r *relay) handleRelay(conn connection.Connection) (int, error) {
+	dest, err := connection.AcceptRelay(conn)
+	if err != nil {
+		return 0, err
+	}
+	st, err := r.open(conn.Src(), dest)
+	if err != nil {
+		connection.AckRelay(conn, false)
+		return 0, fmt.Errorf("failed to relay %s to %s: %v", conn.Src(), dest, err)
+	}
+	if err := connection.AckRelay(conn, true); err != nil {
+		st.Reset()
+		return 0, err
+	}
+	connection.Splice(conn.Conn(), st)
+	return 0, nil
+}
+
+// handleMux serves a ConnMux connection from the runner of another host, which is also used to relay to that host
+func (r *relay) handleMux(conn connection.Connection) (int, error) {
+	ipv4 := conn.Src().IPv4
+	sess := mux.NewSession(conn.Conn(), false, r.accept)
+	r.mu.Lock()
+	if l, ok := r.links[ipv4]; !ok || isDone(l) {
+		l = &muxLink{ready: make(chan struct{}), sess: sess}
+		close(l.ready)
+		r.links[ipv4] = l
+	}
+	r.mu.Unlock()
+	err := sess.Serve()
+	r.drop(ipv4, sess)
+	if err == mux.ErrSessionClosed {
+		return 0, nil
+	}
+	return 0, err
+}
+
+// accept connects a stream opened by the runner of another host to a local peer
+func (r *relay) accept(st *mux.Stream, header []byte) {
+	src, dest, ok := decodeRoute(header)
+	if !ok || dest.IPv4 != r.self.IPv4 {
+		log.Warnf("refused to relay invalid route %x", header)
+		st.Reset()
+		return
+	}
+	addr := net.UnixAddr{Name: dest.SockFile(), Net: "unix"}
+	conn, err := net.DialUnix(addr.Net, nil, &addr)
+	if err != nil {
+		log.Debugf("failed to relay %s to %s: %v", src, dest, err)
+		st.Reset()
+		return
+	}
+	connection.Splice(conn, st)
+}
+
+func (r *relay) open(src, dest plan.PeerID) (*mux.Stream, error) {
+	sess, err := r.session(dest.IPv4)
+	if err != nil {
+		return nil, err
+	}
+	return sess.Open(encodeRoute(src, dest))
+}
+
+// session returns the session with the runner of a host, which is dialed once by the first connection relayed to the host
+func (r *relay) session(ipv4 uint32) (*mux.Session, error) {
+	r.mu.Lock()
+	l, ok := r.links[ipv4]
+	if ok && isDone(l) {
+		delete(r.links, ipv4)
+		ok = false
+	}
+	if ok {
+		r.mu.Unlock()
+		<-l.ready
+		return l.sess, l.err
+	}
+	l = &muxLink{ready: make(chan struct{})}
+	r.links[ipv4] = l
+	r.mu.Unlock()
+	l.sess, l.err = r.dial(ipv4)
+	close(l.ready)
+	if l.err != nil {
+		r.mu.Lock()
+		if r.links[ipv4] == l {
+			delete(r.links, ipv4)
+		}
+		r.mu.Unlock()
+	}
+	return l.sess, l.err
+}
+
+func (r *relay) dial(ipv4 uint32) (*mux.Session, error) {
+	var target *plan.PeerID
+	for _, runner := range r.runners() {
+		if runner.IPv4 == ipv4 {
+			target = &runner
+			break
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("no runner on %s", plan.FormatIPv4(ipv4))
+	}
+	conn, err := connection.Open(*target, r.self, connection.ConnMux, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	sess := mux.NewSession(conn.Conn(), true, r.accept)
+	go func() {
+		if err := sess.Serve(); err != mux.ErrSessionClosed {
+			log.Warnf("multiplexed connection to %s broke: %v", target, err)
+		}
+		r.drop(ipv4, sess)
+	}()
+	log.Debugf("relaying connections to peers of %s through %s", plan.FormatIPv4(ipv4), target)
+	return sess, nil
+}
+
+func (r *relay) drop(ipv4 uint32, sess *mux.Session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if l, ok := r.links[ipv4]; ok && l.sess == sess {
+		delete(r.links, ipv4)
+	}
+}
+
+// isDone tells if the session of a dialed link is closed
+func isDone(l *muxLink) bool {
+	select {
+	case <-l.ready:
+	default:
+		return false
+	}
+	if l.sess == nil {
+		return true
+	}
+	select {
+	case <-l.sess.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// routeSize is the size of the header of a relayed stream, the destination and the source peers
+const routeSize = 12
+
+func encodeRoute(src, dest plan.PeerID) []byte {
+	bs := make([]byte, routeSize)
+	binary.BigEndian.PutUint32(bs[0:], dest.IPv4)
+	binary.BigEndian.PutUint16(bs[4:], dest.Port)
+	binary.BigEndian.PutUint32(bs[6:], src.IPv4)
+	binary.BigEndian.PutUint16(bs[10:], src.Port)
+	return bs
+}
+
+func decodeRoute(bs []byte) (plan.PeerID, plan.PeerID, bool) {
+	if len(bs) != routeSize {
+		return plan.PeerID{}, plan.PeerID{}, false
+	}
+	dest := plan.PeerID{IPv4: binary.BigEndian.Uint32(bs[0:]), Port: binary.BigEndian.Uint16(bs[4:])}
+	src := plan.PeerID{IPv4: binary.BigEndian.Uint32(bs[6:]), Port: binary.BigEndian.Uint16(bs[10:])}
+	return src, dest, true
+}
@@ -2,6 +2,8 @@ package runner
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/lsds/KungFu/srcs/go/kungfu/job"
 	"github.com/lsds/KungFu/srcs/go/log"
@@ -10,12 +12,47 @@ import (
 	"github.com/lsds/KungFu/srcs/go/utils/runner/local"
 )
 
-func SimpleRun(ctx context.Context, selfIPv4 uint32, cluster plan.Cluster, j job.Job, verboseLog bool) {
+func SimpleRun(ctx context.Context, self plan.PeerID, cluster plan.Cluster, j job.Job, verboseLog bool, summary *SummaryRecorder, hooks *Notifier) error {
+	selfIPv4 := self.IPv4
 	procs := j.CreateProcs(cluster, selfIPv4)
-	log.Infof("will parallel run %d instances of %s with %q", len(procs), j.Prog, j.Args)
-	d, err := utils.Measure(func() error { return local.RunAll(ctx, procs, verboseLog) })
+	ids := cluster.Workers.On(selfIPv4)
+	defer serveFormation(ctx, self, cluster)()
+	if err := checkClocks(ctx, self, cluster.Runners, j); err != nil {
+		return err
+	}
+	if err := checkRanks(ctx, self, cluster, j); err != nil {
+		return err
+	}
+	summary.Resized(len(cluster.Workers))
+	var snapshots sync.WaitGroup
+	for i := range procs {
+		summary.Prepare(&procs[i], ids[i], 0)
+		rank, _ := cluster.Workers.Rank(ids[i])
+		snapshots.Add(1)
+		go func(i int) {
+			saveEnvSnapshot(ctx, j, procs[i], ids[i], rank, 0)
+			snapshots.Done()
+		}(i)
+	}
+	log.Infof("will parallel run %d local instances of %s", len(procs), j.DebugString())
+	var results []local.Result
+	d, err := utils.Measure(func() error {
+		var err error
+		results, err = local.RunAllWithResults(ctx, procs, verboseLog)
+		return err
+	})
 	log.Infof("all %d/%d local peers finished, took %s", len(procs), len(cluster.Workers), d)
-	if err != nil {
-		utils.ExitErr(err)
+	snapshots.Wait()
+	for i, r := range results {
+		rank, _ := cluster.Workers.Rank(ids[i])
+		summary.Finished(ids[i], rank, 0, r)
+		if r.Err != nil && !canceled(r.Err) {
+			hooks.Fire(failureEvent(ids[i], rank, 0, len(cluster.Workers), r.Err))
+		}
+	}
+	summary.Save()
+	if isFirstRunner(cluster.Runners, selfIPv4) {
+		hooks.Fire(completeEvent(0, len(cluster.Workers), time.Since(j.StartTime), err))
 	}
+	return err
 }
@@ -0,0 +1,176 @@
+package runner
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+// Names of control messages carrying a Stage
+const (
+	UpdateName           = "update"       // JSON encoded Stage
+	CompressedUpdateName = "update-z"     // deflate compressed JSON encoded Stage
+	DeltaUpdateName      = "update-delta" // JSON encoded StageDelta
+	UpdateNackName       = "update-nack"  // decimal version of a StageDelta whose base is missing, the Stage is resent in full
+)
+
+// minCompressSize is the minimal size of a Stage message to be compressed
+const minCompressSize = 1024
+
+// StageDelta encodes a Stage by the peers added to and removed from a previous Stage
+type StageDelta struct {
+	Version     int
+	BaseVersion int
+
+	AddedRunners   plan.PeerList `json:",omitempty"`
+	RemovedRunners plan.PeerList `json:",omitempty"`
+	AddedWorkers   plan.PeerList `json:",omitempty"`
+	RemovedWorkers plan.PeerList `json:",omitempty"`
+}
+
+// NewStageDelta returns the delta from base to s, it returns false if s can't be reconstructed from the delta,
+// e.g. the order of remaining peers is changed.
+func NewStageDelta(base, s Stage) (*StageDelta, bool) {
+	d := &StageDelta{
+		Version:     s.Version,
+		BaseVersion: base.Version,
+	}
+	d.RemovedRunners, d.AddedRunners = base.Cluster.Runners.Diff(s.Cluster.Runners)
+	d.RemovedWorkers, d.AddedWorkers = base.Cluster.Workers.Diff(s.Cluster.Workers)
+	t, err := d.Apply(base)
+	if err != nil || !t.Eq(s) {
+		return nil, false
+	}
+	return d, true
+}
+
+var errBaseVersionMismatch = errors.New("base version mismatch")
+
+// Apply reconstructs the Stage from its base, the added peers are appended after the remaining ones.
+func (d StageDelta) Apply(base Stage) (Stage, error) {
+	if base.Version != d.BaseVersion {
+		return Stage{}, errBaseVersionMismatch
+	}
+	return Stage{
+		Version: d.Version,
+		Cluster: plan.Cluster{
+			Runners: applyDelta(base.Cluster.Runners, d.AddedRunners, d.RemovedRunners),
+			Workers: applyDelta(base.Cluster.Workers, d.AddedWorkers, d.RemovedWorkers),
+		},
+	}, nil
+}
+
+func applyDelta(pl, added, removed plan.PeerList) plan.PeerList {
+	_, kept := removed.Diff(pl)
+	return append(kept, added...)
+}
+
+func (d StageDelta) Encode() []byte {
+	b := &bytes.Buffer{}
+	json.NewEncoder(b).Encode(d)
+	return b.Bytes()
+}
+
+func (d *StageDelta) Decode(bs []byte) error {
+	b := bytes.NewBuffer(bs)
+	return json.NewDecoder(b).Decode(d)
+}
+
+// EncodeUpdate encodes s as a control message for a runner,
+// the delta from base is used if the runner has it, otherwise the full Stage is optionally compressed.
+func EncodeUpdate(s Stage, base *Stage, compress bool) (string, []byte) {
+	if base != nil {
+		if d, ok := NewStageDelta(*base, s); ok {
+			return DeltaUpdateName, d.Encode()
+		}
+	}
+	bs := s.Encode()
+	if compress && len(bs) >= minCompressSize {
+		if z, err := deflate(bs); err == nil {
+			return CompressedUpdateName, z
+		}
+	}
+	return UpdateName, bs
+}
+
+func deflate(bs []byte) ([]byte, error) {
+	b := &bytes.Buffer{}
+	w, err := flate.NewWriter(b, flate.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(bs); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func inflate(bs []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(bs))
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// missingBaseError is returned by decodeUpdate for a StageDelta whose base Stage is unknown
+type missingBaseError struct {
+	Version     int
+	BaseVersion int
+}
+
+func (e missingBaseError) Error() string {
+	return fmt.Sprintf("missing base v%d of v%d", e.BaseVersion, e.Version)
+}
+
+// EncodeUpdateNack encodes the reply to a StageDelta of version whose base is missing
+func EncodeUpdateNack(version int) []byte {
+	return []byte(strconv.Itoa(version))
+}
+
+// DecodeUpdateNack returns the version of the Stage to resend in full
+func DecodeUpdateNack(bs []byte) (int, error) {
+	return strconv.Atoi(string(bs))
+}
+
+// decodeUpdate decodes a control message encoded by EncodeUpdate, lookup returns the base Stage of a delta
+func decodeUpdate(name string, bs []byte, lookup func(version int) (Stage, bool)) (*Stage, error) {
+	var s Stage
+	switch name {
+	case UpdateName:
+		if err := s.Decode(bs); err != nil {
+			return nil, err
+		}
+	case CompressedUpdateName:
+		bs, err := inflate(bs)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.Decode(bs); err != nil {
+			return nil, err
+		}
+	case DeltaUpdateName:
+		var d StageDelta
+		if err := d.Decode(bs); err != nil {
+			return nil, err
+		}
+		base, ok := lookup(d.BaseVersion)
+		if !ok {
+			return nil, missingBaseError{Version: d.Version, BaseVersion: d.BaseVersion}
+		}
+		var err error
+		if s, err = d.Apply(base); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid update message: %s", name)
+	}
+	return &s, nil
+}
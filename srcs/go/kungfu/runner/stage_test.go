@@ -0,0 +1,91 @@
+package runner
+
+import (
+	"math"
+	"testing"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+func fakeStage(version int, hosts int, np int) Stage {
+	hl := make(plan.HostList, hosts)
+	for i := range hl {
+		hl[i] = plan.HostSpec{IPv4: uint32(i + 1), Slots: 1000}
+	}
+	c := plan.Cluster{Runners: hl.GenRunnerList(plan.DefaultRunnerPort)}
+	d, _ := c.Resize(np)
+	return Stage{Version: version, Cluster: *d}
+}
+
+func Test_EncodeUpdate(t *testing.T) {
+	base := fakeStage(1, 16, 1000)
+	lookup := func(v int) (Stage, bool) { return base, v == base.Version }
+	moreRunners := fakeStage(2, 20, 0)
+	moreRunners.Cluster.Workers = base.Cluster.Workers
+	for _, s := range []Stage{fakeStage(2, 16, 1200), fakeStage(2, 16, 800), moreRunners} {
+		name, bs := EncodeUpdate(s, &base, false)
+		if name != DeltaUpdateName {
+			t.Errorf("expect %s, got %s", DeltaUpdateName, name)
+		}
+		if full := s.Encode(); len(bs) >= len(full) {
+			t.Errorf("delta of %d bytes is not smaller than %d", len(bs), len(full))
+		}
+		got, err := decodeUpdate(name, bs, lookup)
+		if err != nil || !got.Eq(s) {
+			t.Errorf("decode %s failed: %v", name, err)
+		}
+	}
+	{
+		s := base
+		s.Version = 2
+		s.Cluster.Workers = s.Cluster.Workers.Clone()
+		s.Cluster.Workers[0], s.Cluster.Workers[1] = s.Cluster.Workers[1], s.Cluster.Workers[0]
+		if _, ok := NewStageDelta(base, s); ok {
+			t.Errorf("reordered workers should not be encoded as delta")
+		}
+		name, bs := EncodeUpdate(s, &base, true)
+		if name != CompressedUpdateName {
+			t.Errorf("expect %s, got %s", CompressedUpdateName, name)
+		}
+		got, err := decodeUpdate(name, bs, lookup)
+		if err != nil || !got.Eq(s) {
+			t.Errorf("decode %s failed: %v", name, err)
+		}
+	}
+	if _, err := decodeUpdate(DeltaUpdateName, StageDelta{Version: 4, BaseVersion: 3}.Encode(), lookup); err != (missingBaseError{Version: 4, BaseVersion: 3}) {
+		t.Errorf("delta with missing base should fail with missingBaseError, got %v", err)
+	}
+}
+
+func Test_stageChildren(t *testing.T) {
+	for _, n := range []int{1, 2, 5, 21, 100} {
+		var runners plan.PeerList
+		for i := 0; i < n; i++ {
+			runners = append(runners, plan.PeerID{IPv4: uint32(i + 1), Port: 38080})
+		}
+		const fanout = 4
+		depth := map[plan.PeerID]int{runners[0]: 0}
+		queue := plan.PeerList{runners[0]}
+		var maxDepth int
+		for len(queue) > 0 {
+			id := queue[0]
+			queue = queue[1:]
+			for _, c := range stageChildren(runners, id, fanout) {
+				if _, ok := depth[c]; ok {
+					t.Fatalf("%s is reached twice among %d runners", c, n)
+				}
+				depth[c] = depth[id] + 1
+				if depth[c] > maxDepth {
+					maxDepth = depth[c]
+				}
+				queue = append(queue, c)
+			}
+		}
+		if len(depth) != n {
+			t.Errorf("%d of %d runners are reached", len(depth), n)
+		}
+		if want := int(math.Ceil(math.Log(float64(3*n+1))/math.Log(fanout))) - 1; maxDepth > want {
+			t.Errorf("depth of the tree of %d runners is %d, want <= %d", n, maxDepth, want)
+		}
+	}
+}
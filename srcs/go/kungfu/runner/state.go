@@ -0,0 +1,239 @@
+package runner
+
+import (
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/checksum"
+	"github.com/lsds/KungFu/srcs/go/kungfu/formation"
+	"github.com/lsds/KungFu/srcs/go/monitor"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+	"github.com/lsds/KungFu/srcs/go/utils"
+)
+
+const (
+	redacted    = "<redacted>"
+	redactedURL = "xxxxx" // not escaped in URLs, as by url.URL.Redacted of later Go versions
+)
+
+// StageState is a Stage known by the runner
+type StageState struct {
+	Version int      `json:"version"`
+	Workers []string `json:"workers"`
+	Runners []string `json:"runners"`
+}
+
+// PeerHealth is what the runner knows about the liveness of a worker of the applied Stage
+type PeerHealth struct {
+	Rank     int            `json:"rank"`
+	Peer     string         `json:"peer"`
+	Local    bool           `json:"local"`               // run by this runner
+	LeaseAge *time.Duration `json:"lease_age,omitempty"` // since the lease was renewed, nil if never
+	Alerts   int            `json:"alerts"`              // send queue alerts among the latest received
+}
+
+// ConnSummary summarizes the connections of a kind between the runner and a peer
+type ConnSummary struct {
+	Peer      string        `json:"peer"`
+	Type      string        `json:"type"`
+	Inbound   bool          `json:"inbound"`
+	Count     int           `json:"count"`
+	Depth     int           `json:"depth,omitempty"`      // messages queued or being sent, outbound only
+	OldestAge time.Duration `json:"oldest_age,omitempty"` // outbound only
+}
+
+// State is a snapshot of the internal state of a runner, to be attached to bug reports.
+// Secrets, e.g. tokens and keys in environment variables, URLs and arguments, are redacted.
+type State struct {
+	Self        string               `json:"self"`
+	Taken       time.Time            `json:"taken"`
+	Stage       *StageState          `json:"stage"`   // the applied Stage, nil before the first one
+	Pending     []StageState         `json:"pending"` // proposed Stages newer than the applied one
+	Peers       []PeerHealth         `json:"peers"`
+	Connections []ConnSummary        `json:"connections"`
+	Alerts      []monitor.QueueAlert `json:"alerts"`
+	Drifts      []checksum.Drift     `json:"drifts"` // checksums of allreduce results which diverged across peers
+	KVVersion   uint64               `json:"kv_version"`
+	Formation   *formation.Progress  `json:"formation,omitempty"` // of the latest Stage, on the first runner
+	Jobs        []JobInfo            `json:"jobs,omitempty"`
+	Envs        map[string]string    `json:"envs"` // KUNGFU_ environment variables of the runner
+}
+
+type inboundKey struct {
+	src plan.PeerID
+	t   connection.ConnType
+}
+
+func newStageState(s Stage) StageState {
+	return StageState{
+		Version: s.Version,
+		Workers: peerStrings(s.Cluster.Workers),
+		Runners: peerStrings(s.Cluster.Runners),
+	}
+}
+
+func peerStrings(pl plan.PeerList) []string {
+	ss := make([]string, len(pl))
+	for i, id := range pl {
+		ss[i] = id.String()
+	}
+	return ss
+}
+
+func (h *Handler) trackInbound(conn connection.Connection) func() {
+	key := inboundKey{src: conn.Src(), t: conn.Type()}
+	h.mu.Lock()
+	h.inbound[key]++
+	h.mu.Unlock()
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.inbound[key]--; h.inbound[key] <= 0 {
+			delete(h.inbound, key)
+		}
+	}
+}
+
+// State takes a snapshot of the runner
+func (h *Handler) State() State {
+	st := State{
+		Self:      h.self.String(),
+		Taken:     time.Now(),
+		Pending:   []StageState{},
+		Peers:     []PeerHealth{},
+		KVVersion: h.kv.Snapshot().Version,
+		Envs:      kungfuEnvs(),
+	}
+	for _, s := range h.client.QueueStats() {
+		st.Connections = append(st.Connections, ConnSummary{Peer: s.Peer.String(), Type: s.Type.String(), Count: 1, Depth: s.Depth, OldestAge: s.OldestAge})
+	}
+	if h.jobs != nil {
+		st.Jobs = h.jobs.list()
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	applied, ok := h.versions[h.applied]
+	if ok {
+		s := newStageState(applied)
+		st.Stage = &s
+	}
+	var pending []int
+	for v := range h.versions {
+		if !ok || v > h.applied {
+			pending = append(pending, v)
+		}
+	}
+	sort.Ints(pending)
+	for _, v := range pending {
+		st.Pending = append(st.Pending, newStageState(h.versions[v]))
+	}
+	alerts := make(map[plan.PeerID]int)
+	for _, a := range h.alerts {
+		alerts[a.Peer]++
+	}
+	for rank, id := range applied.Cluster.Workers {
+		p := PeerHealth{Rank: rank, Peer: id.String(), Local: id.IPv4 == h.self.IPv4, Alerts: alerts[id]}
+		if renewed, ok := h.leases[id]; ok {
+			age := st.Taken.Sub(renewed)
+			p.LeaseAge = &age
+		}
+		st.Peers = append(st.Peers, p)
+	}
+	for k, n := range h.inbound {
+		st.Connections = append(st.Connections, ConnSummary{Peer: k.src.String(), Type: k.t.String(), Inbound: true, Count: n})
+	}
+	sort.Slice(st.Connections, func(i, j int) bool {
+		a, b := st.Connections[i], st.Connections[j]
+		if a.Peer != b.Peer {
+			return a.Peer < b.Peer
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return !a.Inbound && b.Inbound
+	})
+	if isFirstRunner(applied.Cluster.Runners, h.self.IPv4) {
+		if p, ok := h.formation.Progress(h.applied); ok {
+			st.Formation = &p
+		}
+	}
+	st.Alerts = append([]monitor.QueueAlert{}, h.alerts...)
+	st.Drifts = append([]checksum.Drift{}, h.drifts...)
+	return st
+}
+
+func kungfuEnvs() map[string]string {
+	envs := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if i := strings.Index(kv, "="); i >= 0 && strings.HasPrefix(kv, `KUNGFU_`) {
+			envs[kv[:i]] = redactValue(kv[:i], kv[i+1:])
+		}
+	}
+	return envs
+}
+
+func redactJob(info JobInfo) JobInfo {
+	info.Request = redactRequest(info.Request)
+	return info
+}
+
+func redactRequest(r JobRequest) JobRequest {
+	t := r
+	t.Args = make([]string, len(r.Args))
+	for i, a := range r.Args {
+		t.Args[i] = redactArg(a)
+	}
+	if r.Envs != nil {
+		t.Envs = make(map[string]string, len(r.Envs))
+		for k, v := range r.Envs {
+			t.Envs[k] = redactValue(k, v)
+		}
+	}
+	return t
+}
+
+func redactValue(name, value string) string {
+	if utils.IsSecret(name) {
+		return redacted
+	}
+	return redactURL(value)
+}
+
+// redactArg redacts the value of an argument of the form -name=value
+func redactArg(a string) string {
+	if i := strings.Index(a, "="); i > 0 && strings.HasPrefix(a, "-") {
+		return a[:i+1] + redactValue(a[:i], a[i+1:])
+	}
+	return redactURL(a)
+}
+
+// redactURL redacts the password and the secret query parameters of a URL, other values are returned as they are
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || len(u.Scheme) == 0 || len(u.Host) == 0 {
+		return s
+	}
+	changed := false
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redactedURL)
+			changed = true
+		}
+	}
+	q := u.Query()
+	for k := range q {
+		if utils.IsSecret(k) {
+			q.Set(k, redactedURL)
+			changed = true
+		}
+	}
+	if !changed {
+		return s
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
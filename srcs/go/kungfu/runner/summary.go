@@ -0,0 +1,204 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/env"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/monitor"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/proc"
+	"github.com/lsds/KungFu/srcs/go/utils/runner/local"
+)
+
+// SummaryMarker prefixes the summary line when the summary is written to stdout
+const SummaryMarker = `KUNGFU_RUN_SUMMARY: `
+
+// PeerSummary is the outcome of a local peer
+type PeerSummary struct {
+	Peer     plan.PeerID
+	Rank     int
+	Version  int
+	ExitCode int
+	Error    string `json:",omitempty"`
+	Duration time.Duration
+	Restarts int
+	Stats    *monitor.Totals `json:",omitempty"` // reported by the peer on exit
+	Started  *time.Time      `json:",omitempty"` // reported by the peer on exit
+	Finished *time.Time      `json:",omitempty"`
+
+	Transitions []monitor.Transition `json:",omitempty"` // resizes observed by the peer
+	Families    map[string]int       `json:",omitempty"` // address family each remote peer was dialed over by the peer
+
+	Crash *local.CrashReport `json:",omitempty"` // if the peer exited abnormally on its own
+}
+
+// Summary is the machine-readable summary of the local peers of a kungfu-run
+type Summary struct {
+	Runner          plan.PeerID
+	StartTime       time.Time
+	Duration        time.Duration
+	PeakClusterSize int
+	Peers           []PeerSummary
+
+	EgressBytes    int64
+	CollectiveTime time.Duration
+
+	// the span of the work reported by the local peers, excluding the time to spawn and initialize them
+	WorkStart *time.Time `json:",omitempty"`
+	WorkEnd   *time.Time `json:",omitempty"`
+}
+
+// CrashMarker prefixes a crash report of a local peer forwarded to the launcher on stdout
+const CrashMarker = `KUNGFU_RUN_CRASH: `
+
+// ForwardedCrash is a crash report forwarded to the launcher
+type ForwardedCrash struct {
+	Peer    plan.PeerID
+	Rank    int
+	Version int
+	Crash   local.CrashReport
+}
+
+// SavedAt is the local time when the summary was saved
+func (s Summary) SavedAt() time.Time {
+	return s.StartTime.Add(s.Duration)
+}
+
+// SummaryRecorder collects the Summary while the job is running
+type SummaryRecorder struct {
+	sync.Mutex
+	filename string
+	summary  Summary
+
+	ForwardCrashes bool // print crash reports to stdout as soon as peers crashed, for the launcher of kungfu-run
+}
+
+// NewSummaryRecorder creates a SummaryRecorder, the summary is saved to filename, or stdout if filename is `-`
+func NewSummaryRecorder(self plan.PeerID, filename string) *SummaryRecorder {
+	return &SummaryRecorder{
+		filename: filename,
+		summary: Summary{
+			Runner:    self,
+			StartTime: time.Now(),
+		},
+	}
+}
+
+func (r *SummaryRecorder) Resized(size int) {
+	r.Lock()
+	defer r.Unlock()
+	if size > r.summary.PeakClusterSize {
+		r.summary.PeakClusterSize = size
+	}
+}
+
+// Prepare asks the peer to save its stats on exit
+func (r *SummaryRecorder) Prepare(p *proc.Proc, id plan.PeerID, version int) {
+	if len(r.filename) == 0 {
+		return
+	}
+	p.Envs[env.StatsFileEnvKey] = statsFile(id, version)
+}
+
+func (r *SummaryRecorder) Finished(id plan.PeerID, rank int, version int, result local.Result) {
+	s := PeerSummary{
+		Peer:     id,
+		Rank:     rank,
+		Version:  version,
+		ExitCode: exitCode(result.Err),
+		Duration: result.Duration,
+		Restarts: result.Restarts,
+		Crash:    result.Crash,
+	}
+	if result.Err != nil {
+		s.Error = result.Err.Error()
+	}
+	if c := result.Crash; c != nil {
+		log.Errorf("crash report of %s (rank %d): %s", id, rank, c)
+		if r.ForwardCrashes {
+			if bs, err := json.Marshal(ForwardedCrash{Peer: id, Rank: rank, Version: version, Crash: *c}); err == nil {
+				fmt.Printf("%s%s\n", CrashMarker, bs)
+			}
+		}
+	}
+	if len(r.filename) > 0 {
+		filename := statsFile(id, version)
+		if bs, err := ioutil.ReadFile(filename); err == nil {
+			var r monitor.Report
+			if err := json.Unmarshal(bs, &r); err == nil {
+				s.Stats = &r.Totals
+				if !r.Started.IsZero() {
+					s.Started, s.Finished = &r.Started, &r.Finished
+				}
+				s.Transitions = r.Transitions
+				s.Families = r.Families
+			}
+			os.Remove(filename)
+		}
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.summary.Peers = append(r.summary.Peers, s)
+}
+
+// Save writes the summary, it does nothing if no destination was given
+func (r *SummaryRecorder) Save() {
+	if len(r.filename) == 0 {
+		return
+	}
+	r.Lock()
+	s := r.summary
+	s.Peers = append([]PeerSummary(nil), r.summary.Peers...)
+	r.Unlock()
+	s.Duration = time.Since(s.StartTime)
+	sort.SliceStable(s.Peers, func(i, j int) bool { return s.Peers[i].Rank < s.Peers[j].Rank })
+	for _, p := range s.Peers {
+		if p.Stats != nil {
+			s.EgressBytes += p.Stats.EgressBytes
+			s.CollectiveTime += p.Stats.CollectiveTime
+		}
+		if p.Started != nil {
+			if s.WorkStart == nil || p.Started.Before(*s.WorkStart) {
+				s.WorkStart = p.Started
+			}
+			if s.WorkEnd == nil || p.Finished.After(*s.WorkEnd) {
+				s.WorkEnd = p.Finished
+			}
+		}
+	}
+	bs, err := json.Marshal(s)
+	if err != nil {
+		log.Errorf("failed to encode summary: %v", err)
+		return
+	}
+	if r.filename == "-" {
+		fmt.Printf("%s%s\n", SummaryMarker, bs)
+		return
+	}
+	if err := ioutil.WriteFile(r.filename, bs, 0644); err != nil {
+		log.Errorf("failed to save summary: %v", err)
+	}
+}
+
+func statsFile(id plan.PeerID, version int) string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("kungfu-stats-%s-%d@%d.json", plan.FormatIPv4(id.IPv4), id.Port, version))
+}
+
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if e, ok := err.(*exec.ExitError); ok {
+		return e.ExitCode()
+	}
+	return -1
+}
@@ -0,0 +1,141 @@
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/elastic/configserver"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+const nvidiaSmiTimeout = 5 * time.Second
+
+// reportResources sends the free resources of this host to the config server every period
+func reportResources(ctx context.Context, configServer string, self plan.PeerID, period time.Duration) {
+	url := configServer + configserver.HostsPath
+	client := http.Client{Timeout: period}
+	userAgent := fmt.Sprintf("KungFu Runner: %s", self)
+	tk := time.NewTicker(period)
+	defer tk.Stop()
+	for {
+		r := sampleHost(self.IPv4)
+		bs, _ := json.Marshal(r)
+		req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(bs))
+		if err != nil {
+			log.Errorf("failed to report resources: %v", err)
+			return
+		}
+		req.Header.Set("User-Agent", userAgent)
+		if resp, err := client.Do(req); err != nil {
+			log.Debugf("failed to report resources to %s: %v", url, err)
+		} else {
+			resp.Body.Close()
+			if resp.StatusCode/100 != 2 {
+				log.Debugf("failed to report resources to %s: %s", url, resp.Status)
+			}
+		}
+		select {
+		case <-tk.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sampleHost measures the free resources of this host
+func sampleHost(ipv4 uint32) configserver.HostReport {
+	r := plan.HostResources{
+		CPUs:     runtime.NumCPU(),
+		FreeGPUs: freeGPUs(),
+		Updated:  time.Now(),
+	}
+	if n, err := memAvailable(); err == nil {
+		r.MemAvailable = n
+	}
+	if l, err := loadAverage(); err == nil {
+		r.Load1 = l
+	}
+	return configserver.HostReport{Host: plan.FormatIPv4(ipv4), Resources: r}
+}
+
+// memAvailable reads MemAvailable from /proc/meminfo
+func memAvailable() (uint64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			return kb << 10, err
+		}
+	}
+	return 0, fmt.Errorf("MemAvailable not found")
+}
+
+// loadAverage reads the load average of the last minute from /proc/loadavg
+func loadAverage() (float64, error) {
+	bs, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(bs))
+	if len(fields) < 1 {
+		return 0, fmt.Errorf("invalid /proc/loadavg: %q", bs)
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// freeGPUs counts GPUs without compute processes by nvidia-smi, it returns -1 if there is no nvidia-smi
+func freeGPUs() int {
+	gpus, err := nvidiaSmi("--query-gpu=uuid")
+	if err != nil {
+		return -1
+	}
+	apps, err := nvidiaSmi("--query-compute-apps=gpu_uuid")
+	if err != nil {
+		return -1
+	}
+	busy := make(map[string]bool)
+	for _, uuid := range apps {
+		busy[uuid] = true
+	}
+	var n int
+	for _, uuid := range gpus {
+		if !busy[uuid] {
+			n++
+		}
+	}
+	return n
+}
+
+func nvidiaSmi(query string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), nvidiaSmiTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "nvidia-smi", query, "--format=csv,noheader").Output()
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
@@ -3,13 +3,14 @@ package runner
 import (
 	"context"
 	"fmt"
-	"net"
 	"net/http"
-	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/kungfu/elastic/configsource"
+	"github.com/lsds/KungFu/srcs/go/kungfu/env"
 	"github.com/lsds/KungFu/srcs/go/kungfu/job"
 	"github.com/lsds/KungFu/srcs/go/log"
 	"github.com/lsds/KungFu/srcs/go/plan"
@@ -22,6 +23,7 @@ import (
 
 type watcher struct {
 	server  server.Server
+	handler *Handler
 	parent  plan.PeerID
 	parents plan.PeerList
 
@@ -34,9 +36,16 @@ type watcher struct {
 	keep    bool
 
 	current plan.Cluster
+	version int
 	running int32
 	gs      map[plan.PeerID]*sync.WaitGroup
 	gpuPool *job.GPUPool
+	summary *SummaryRecorder
+	hooks   *Notifier
+
+	mu      sync.Mutex
+	cancels map[plan.PeerID]context.CancelFunc
+	evicted map[plan.PeerID]bool
 }
 
 func (w *watcher) create(id plan.PeerID, s Stage) {
@@ -48,8 +57,36 @@ func (w *watcher) create(id plan.PeerID, s Stage) {
 		log.Errorf("gpuID = %d", gpuID)
 	}
 	proc := w.job.NewProc(id, gpuID, s.Version, s.Cluster)
+	w.summary.Prepare(&proc, id, s.Version)
+	if state, ok := w.handler.TakeMigrationState(id); ok {
+		if filename, err := saveMigrationState(id, state); err != nil {
+			log.Errorf("failed to save migration state for %s: %v", id, err)
+		} else {
+			proc.Envs[env.MigrationStateEnvKey] = filename
+		}
+	}
+	if s := w.handler.kv.Snapshot(); s.Version > 0 {
+		if filename, err := saveKVSnapshot(id, s); err != nil {
+			log.Errorf("failed to save kv snapshot for %s: %v", id, err)
+		} else {
+			proc.Envs[env.KVSnapshotEnvKey] = filename
+		}
+	}
+	ctx, cancel := context.WithCancel(w.ctx)
+	w.mu.Lock()
+	w.cancels[id] = cancel
+	delete(w.evicted, id)
+	w.mu.Unlock()
+	if w.job.LeasePeriod > 0 {
+		w.handler.GrantLease(id)
+	}
+	rank, _ := s.Cluster.Workers.Rank(id)
+	go saveEnvSnapshot(ctx, w.job, proc, id, rank, s.Version)
 	go func(g *sync.WaitGroup) {
-		runProc(w.ctx, w.cancel, proc, s.Version, w.job.LogDir)
+		runProc(ctx, w.cancel, proc, id, rank, s.Version, len(s.Cluster.Workers), w.job.LogDir, w.summary, w.hooks, func() bool { return w.isEvicted(id) })
+		cancel()
+		w.handler.DropLease(id)
+		w.handler.dropDegraded(id)
 		g.Done()
 		w.gpuPool.Put(gpuID)
 		w.stopped <- id
@@ -59,10 +96,16 @@ func (w *watcher) create(id plan.PeerID, s Stage) {
 func (w *watcher) delete(id plan.PeerID) {
 	w.gs[id].Wait()
 	delete(w.gs, id)
+	w.mu.Lock()
+	delete(w.cancels, id)
+	delete(w.evicted, id)
+	w.mu.Unlock()
 }
 
 func (w *watcher) update(s Stage) {
+	w.handler.record(s)
 	w.server.SetToken(uint32(s.Version))
+	w.summary.Resized(len(s.Cluster.Workers))
 	if w.current.Workers.Disjoint(s.Cluster.Workers) {
 		log.Errorf("full update detected: %s -> %s", w.current.DebugString(), s.Cluster.DebugString())
 	}
@@ -79,45 +122,91 @@ func (w *watcher) update(s Stage) {
 		w.create(id, s)
 	}
 	log.Debugf("%s created: %d - %d + %d = %d", utils.Pluralize(len(add), "peer", "peers"), len(w.current.Workers), len(del), len(add), len(s.Cluster.Workers))
+	if e, ok := resizeEvent(w.current, s.Cluster, s.Version); ok && len(w.current.Workers) > 0 && isFirstRunner(s.Cluster.Runners, w.parent.IPv4) {
+		w.hooks.Fire(e)
+	}
 	w.current = s.Cluster
+	w.version = s.Version
+	go w.handler.syncKV(s.Cluster)
+	w.handler.formation.Expect(s.Version, s.Cluster.Workers)
+	if isFirstRunner(s.Cluster.Runners, w.parent.IPv4) {
+		go watchFormation(w.ctx, w.handler.formation, s.Version)
+	}
 }
 
-func (w *watcher) watchRun(globalCtx context.Context) {
+// watchRun returns nil after all local peers finished, or the error canceling the watch
+func (w *watcher) watchRun(globalCtx context.Context) error {
+	var leaseCheck <-chan time.Time
+	if w.job.LeasePeriod > 0 {
+		tk := time.NewTicker(w.job.LeasePeriod / 2)
+		defer tk.Stop()
+		leaseCheck = tk.C
+	}
 	for {
 		select {
+		case <-leaseCheck:
+			w.checkLeases()
+		case id := <-w.handler.onDegraded:
+			w.handleDegraded(id)
 		case s := <-w.ch:
 			w.update(s)
 		case <-w.stopped:
 			n := atomic.AddInt32(&w.running, -1)
 			log.Debugf("%s are still running on this host", utils.Pluralize(int(n), "peer", "peers"))
 			if n == 0 && !w.keep {
-				return
+				return nil
 			}
 		case <-w.ctx.Done():
 			log.Errorf("canceled: %v", w.ctx.Err())
-			return
+			return w.ctx.Err()
 		case <-globalCtx.Done():
 			log.Errorf("canceled: %v", globalCtx.Err())
-			return
+			return globalCtx.Err()
 		}
 	}
 }
 
-func WatchRun(ctx context.Context, self plan.PeerID, runners plan.PeerList, ch chan Stage, j job.Job, keep bool, debugPort int) {
+// WatchRun runs local peers of the Stages received from peers, and from source if it is not nil.
+// The Workers of initial are empty if the runners wait for the first Stage.
+func WatchRun(ctx context.Context, self plan.PeerID, initial plan.Cluster, ch chan Stage, source configsource.Source, j job.Job, keep bool, debugAddr string, summary *SummaryRecorder, hooks *Notifier) error {
 	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	globalCtx, globalCancel := context.WithCancel(ctx)
+	runners := initial.Runners
 	handler := NewHandler(self, ch, globalCancel)
-	if debugPort > 0 {
-		log.Infof("debug server: http://127.0.0.1:%d/", debugPort)
-		go http.ListenAndServe(net.JoinHostPort("", strconv.Itoa(debugPort)), handler)
+	handler.pingHandler.Digest = digestOf(initial.Workers)
+	if source != nil {
+		handler.AcceptPushes()
+	}
+	if len(debugAddr) > 0 {
+		if len(j.JobTokens) > 0 {
+			jobs, err := newJobQueue(self, j)
+			if err != nil {
+				return err
+			}
+			handler.jobs = jobs
+			go handler.jobs.run(globalCtx)
+		}
+		log.Infof("debug server: http://%s/, REST API: http://%s%s/", debugAddr, debugAddr, APIPrefix)
+		go http.ListenAndServe(debugAddr, handler)
+	} else if len(j.JobTokens) > 0 {
+		log.Warnf("jobs are not accepted without -debug-port")
 	}
 	server := server.New(self, handler, config.UseUnixSock)
+	server.OnRestart(func() { handler.announce(runners) })
 	if err := server.Start(); err != nil {
-		utils.ExitErr(err)
+		return err
 	}
 	defer server.Close()
+	if err := checkClocks(ctx, self, runners, j); err != nil {
+		return err
+	}
+	if err := checkRanks(ctx, self, initial, j); err != nil {
+		return err
+	}
 	watcher := &watcher{
 		server:  server,
+		handler: handler,
 		parent:  self,
 		parents: runners,
 		job:     j,
@@ -128,22 +217,56 @@ func WatchRun(ctx context.Context, self plan.PeerID, runners plan.PeerList, ch c
 		stopped: make(chan plan.PeerID, 1),
 		gs:      make(map[plan.PeerID]*sync.WaitGroup),
 		gpuPool: job.NewGPUPool(j.HostList.SlotOf(self.IPv4)),
+		summary: summary,
+		hooks:   hooks,
+		cancels: make(map[plan.PeerID]context.CancelFunc),
+		evicted: make(map[plan.PeerID]bool),
+	}
+	if source != nil {
+		go func() {
+			err := source.Watch(globalCtx, func(c configsource.Config) {
+				handler.Propose(Stage{Version: c.Version, Cluster: c.Cluster})
+			})
+			log.Debugf("config source stopped: %v", err)
+		}()
+	}
+	if j.TelemetryPeriod > 0 && len(j.ConfigServer) > 0 {
+		go reportResources(globalCtx, j.ConfigServer, self, j.TelemetryPeriod)
+	}
+	if j.LinkProbePeriod > 0 {
+		go handler.probeLinks(globalCtx, j.LinkProbePeriod)
 	}
 	log.Infof("watching config server")
-	watcher.watchRun(globalCtx)
+	err := watcher.watchRun(globalCtx)
+	summary.Save()
+	if isFirstRunner(watcher.current.Runners, self.IPv4) {
+		hooks.Fire(completeEvent(watcher.version, len(watcher.current.Workers), time.Since(j.StartTime), err))
+	}
 	log.Infof(xterm.Blue.S("stop watching"))
+	return nil
 }
 
-func runProc(ctx context.Context, cancel context.CancelFunc, p proc.Proc, version int, logDir string) {
+func runProc(ctx context.Context, cancel context.CancelFunc, p proc.Proc, id plan.PeerID, rank, version, size int, logDir string, summary *SummaryRecorder, hooks *Notifier, evicted func() bool) {
 	r := &local.Runner{
 		Name:          p.Name,
 		LogDir:        logDir,
 		LogFilePrefix: fmt.Sprintf("%s@%d", p.Name, version),
 		VerboseLog:    true,
 	}
-	if err := r.TryRun(ctx, p); err != nil {
+	result := r.TryRunWithResult(ctx, p)
+	summary.Finished(id, rank, version, result)
+	if err := result.Err; err != nil {
+		if evicted() {
+			log.Infof("%s evicted: %v", p.Name, err)
+			return
+		}
 		log.Infof("%s finished with error: %v", p.Name, err)
 		cancel()
+		summary.Save()
+		if !canceled(err) {
+			hooks.Fire(failureEvent(id, rank, version, size, err))
+		}
+		hooks.Wait()
 		utils.ExitErr(err) // FIXME: graceful shutdown
 		return
 	}
@@ -0,0 +1,264 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/utils"
+)
+
+// Events of a job that webhooks are fired on
+const (
+	EventScaleUp     = `scale-up`     // fired by the first runner
+	EventScaleDown   = `scale-down`   // fired by the first runner
+	EventPeerFailure = `peer-failure` // fired by the runner of the peer
+	EventJobComplete = `job-complete` // fired by the first runner when its local peers finished
+)
+
+var allEvents = []string{EventScaleUp, EventScaleDown, EventPeerFailure, EventJobComplete}
+
+const (
+	webhookTimeout  = 5 * time.Second
+	webhookAttempts = 3
+	webhookDrain    = 10 * time.Second // pending deliveries are abandoned after it at exit
+)
+
+// Webhook is an HTTP endpoint receiving POSTs of Event as JSON, parsed from [<event>,...=]<url>, e.g.
+// peer-failure,job-complete=https://hooks.slack.com/services/...
+type Webhook struct {
+	Events []string // all events if empty
+	URL    string
+}
+
+var errInvalidWebhook = fmt.Errorf("invalid webhook, expect [<event>,...=]http(s)://<url>, events are: %s", strings.Join(allEvents, ", "))
+
+func ParseWebhook(s string) (*Webhook, error) {
+	var h Webhook
+	if i := strings.Index(s, "="); i >= 0 && !strings.Contains(s[:i], "://") {
+		for _, e := range strings.Split(s[:i], ",") {
+			if !isEvent(e) {
+				return nil, errInvalidWebhook
+			}
+			h.Events = append(h.Events, e)
+		}
+		s = s[i+1:]
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return nil, errInvalidWebhook
+	}
+	h.URL = s
+	return &h, nil
+}
+
+func isEvent(e string) bool {
+	for _, x := range allEvents {
+		if e == x {
+			return true
+		}
+	}
+	return false
+}
+
+func (h Webhook) subscribes(e string) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, x := range h.Events {
+		if x == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is the payload of webhooks
+type Event struct {
+	Event       string
+	Text        string `json:"text"` // human readable, shown by Slack compatible receivers
+	Time        time.Time
+	Runner      string
+	Version     int
+	ClusterSize int
+	PrevSize    int           `json:",omitempty"` // of scale events
+	Peers       []string      `json:",omitempty"` // added, removed or failed peers
+	Duration    time.Duration `json:",omitempty"` // of job-complete
+	Error       string        `json:",omitempty"`
+}
+
+// Notifier fires the webhooks of a job, in background
+type Notifier struct {
+	self   plan.PeerID
+	hooks  []Webhook
+	client http.Client
+	wg     sync.WaitGroup
+}
+
+// NewNotifier returns nil if there is no webhook, which is a valid Notifier firing nothing
+func NewNotifier(self plan.PeerID, webhooks []string) (*Notifier, error) {
+	if len(webhooks) == 0 {
+		return nil, nil
+	}
+	n := &Notifier{
+		self:   self,
+		client: http.Client{Timeout: webhookTimeout},
+	}
+	for _, s := range webhooks {
+		h, err := ParseWebhook(s)
+		if err != nil {
+			return nil, err
+		}
+		n.hooks = append(n.hooks, *h)
+	}
+	return n, nil
+}
+
+// Fire posts e to the webhooks subscribing to it, without waiting for the deliveries
+func (n *Notifier) Fire(e Event) {
+	if n == nil {
+		return
+	}
+	e.Time = time.Now()
+	e.Runner = n.self.String()
+	bs, err := json.Marshal(e)
+	if err != nil {
+		log.Errorf("failed to encode %s event: %v", e.Event, err)
+		return
+	}
+	for _, h := range n.hooks {
+		if !h.subscribes(e.Event) {
+			continue
+		}
+		n.wg.Add(1)
+		go func(url string) {
+			defer n.wg.Done()
+			if err := n.post(url, bs); err != nil {
+				log.Warnf("failed to fire %s webhook %s: %v", e.Event, url, err)
+			}
+		}(h.URL)
+	}
+}
+
+// Wait waits the pending deliveries for at most webhookDrain, it must be called before exit
+func (n *Notifier) Wait() {
+	if n == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(webhookDrain):
+		log.Warnf("webhooks not delivered in %s", webhookDrain)
+	}
+}
+
+func (n *Notifier) post(url string, body []byte) error {
+	var err error
+	for i := 0; i < webhookAttempts; i++ {
+		if i > 0 {
+			time.Sleep(time.Duration(i) * time.Second)
+		}
+		var resp *http.Response
+		if resp, err = n.client.Post(url, "application/json", bytes.NewReader(body)); err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 == 2 {
+			return nil
+		}
+		if err = fmt.Errorf("%s", resp.Status); resp.StatusCode/100 == 4 {
+			return err // won't be accepted by retrying
+		}
+	}
+	return err
+}
+
+// resizeEvent describes the change from cluster a to b, it returns false if the size is not changed
+func resizeEvent(a, b plan.Cluster, version int) (Event, bool) {
+	removed, added := a.Workers.Diff(b.Workers)
+	e := Event{Version: version, ClusterSize: len(b.Workers), PrevSize: len(a.Workers)}
+	switch {
+	case e.ClusterSize > e.PrevSize:
+		e.Event, e.Peers = EventScaleUp, peerNames(added)
+		e.Text = fmt.Sprintf("scaled up from %d to %s at v%d", e.PrevSize, utils.Pluralize(e.ClusterSize, "peer", "peers"), version)
+	case e.ClusterSize < e.PrevSize:
+		e.Event, e.Peers = EventScaleDown, peerNames(removed)
+		e.Text = fmt.Sprintf("scaled down from %d to %s at v%d", e.PrevSize, utils.Pluralize(e.ClusterSize, "peer", "peers"), version)
+	default:
+		return e, false
+	}
+	return e, true
+}
+
+// canceled tells if a peer was stopped by the runner rather than failed
+func canceled(err error) bool {
+	return err == context.Canceled || err == context.DeadlineExceeded
+}
+
+func peerNames(ps plan.PeerList) []string {
+	var names []string
+	for _, p := range ps {
+		names = append(names, p.String())
+	}
+	return names
+}
+
+func failureEvent(id plan.PeerID, rank, version, size int, err error) Event {
+	return Event{
+		Event:       EventPeerFailure,
+		Text:        fmt.Sprintf("peer %s of rank %d failed at v%d: %v", id, rank, version, err),
+		Version:     version,
+		ClusterSize: size,
+		Peers:       []string{id.String()},
+		Error:       err.Error(),
+	}
+}
+
+func completeEvent(version, size int, d time.Duration, err error) Event {
+	e := Event{
+		Event:       EventJobComplete,
+		Text:        fmt.Sprintf("job of %s finished in %s", utils.Pluralize(size, "peer", "peers"), d),
+		Version:     version,
+		ClusterSize: size,
+		Duration:    d,
+	}
+	if err != nil {
+		e.Text = fmt.Sprintf("job of %s failed in %s: %v", utils.Pluralize(size, "peer", "peers"), d, err)
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// webhookFlags is a repeatable flag of webhooks
+type webhookFlags []string
+
+func (s *webhookFlags) String() string {
+	return strings.Join(*s, " ")
+}
+
+// Set implements flags.Value::Set
+func (s *webhookFlags) Set(val string) error {
+	if _, err := ParseWebhook(val); err != nil {
+		return err
+	}
+	*s = append(*s, val)
+	return nil
+}
+
+// isFirstRunner tells if the runner on host fires the events of the whole job
+func isFirstRunner(runners plan.PeerList, host uint32) bool {
+	return len(runners) > 0 && runners[0].IPv4 == host
+}
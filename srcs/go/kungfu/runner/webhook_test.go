@@ -0,0 +1,46 @@
+package runner
+
+import "testing"
+
+func Test_ParseWebhook(t *testing.T) {
+	tests := []struct {
+		s      string
+		events int
+		url    string
+	}{
+		{"http://127.0.0.1:8080/hook", 0, "http://127.0.0.1:8080/hook"},
+		{"https://example.com/hook?a=b", 0, "https://example.com/hook?a=b"},
+		{"peer-failure,job-complete=https://example.com/hook?a=b", 2, "https://example.com/hook?a=b"},
+	}
+	for _, tt := range tests {
+		h, err := ParseWebhook(tt.s)
+		if err != nil {
+			t.Fatalf("ParseWebhook(%q): %v", tt.s, err)
+		}
+		if len(h.Events) != tt.events || h.URL != tt.url {
+			t.Errorf("ParseWebhook(%q) = %v", tt.s, h)
+		}
+	}
+	for _, s := range []string{"", "example.com/hook", "ftp://example.com", "crash=http://example.com"} {
+		if _, err := ParseWebhook(s); err == nil {
+			t.Errorf("ParseWebhook(%q) should fail", s)
+		}
+	}
+	h, _ := ParseWebhook("scale-up=http://example.com")
+	if !h.subscribes(EventScaleUp) || h.subscribes(EventScaleDown) {
+		t.Errorf("unexpected subscriptions of %v", h)
+	}
+}
+
+func Test_ResizeEvent(t *testing.T) {
+	a, b := fakeStage(1, 2, 4).Cluster, fakeStage(2, 2, 6).Cluster
+	if e, ok := resizeEvent(a, b, 2); !ok || e.Event != EventScaleUp || len(e.Peers) != 2 {
+		t.Errorf("unexpected event %v", e)
+	}
+	if e, ok := resizeEvent(b, a, 3); !ok || e.Event != EventScaleDown || len(e.Peers) != 2 || e.PrevSize != 6 {
+		t.Errorf("unexpected event %v", e)
+	}
+	if _, ok := resizeEvent(a, a, 4); ok {
+		t.Errorf("unexpected event without resize")
+	}
+}
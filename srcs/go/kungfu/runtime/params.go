@@ -2,10 +2,11 @@ package runtime
 
 import (
 	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/utils/ssh"
 )
 
 type SystemParameters struct {
-	User            string
+	SSH             ssh.Options
 	WorkerPortRange plan.PortRange
 	RunnerPort      uint16
 	HostList        plan.HostList
@@ -0,0 +1,139 @@
+// Package schema records the tensors that a peer will reduce, so that peers can check they agree on them.
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+)
+
+// Tensor is the declaration of a tensor reduced under Name
+type Tensor struct {
+	Name  string
+	DType kb.DataType
+	Shape []int
+}
+
+func (t Tensor) String() string {
+	return fmt.Sprintf("%s%v", t.DType, t.Shape)
+}
+
+func (t Tensor) eq(u Tensor) bool {
+	if t.Name != u.Name || t.DType != u.DType || len(t.Shape) != len(u.Shape) {
+		return false
+	}
+	for i := range t.Shape {
+		if t.Shape[i] != u.Shape[i] {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	errEmptyName  = errors.New("empty tensor name")
+	errRedeclared = errors.New("tensor redeclared")
+)
+
+// ErrDiverged is the error of peers that declared different tensors
+var ErrDiverged = errors.New("tensor schema diverges among peers")
+
+// Registry is the set of tensors declared by a peer
+type Registry struct {
+	mu      sync.Mutex
+	tensors map[string]Tensor
+}
+
+func New() *Registry {
+	return &Registry{tensors: make(map[string]Tensor)}
+}
+
+// Declare adds t, declaring the same tensor again is allowed, but not with another dtype or shape
+func (r *Registry) Declare(t Tensor) error {
+	if len(t.Name) == 0 {
+		return errEmptyName
+	}
+	for _, d := range t.Shape {
+		if d < 0 {
+			return fmt.Errorf("invalid shape of tensor %s: %v", t.Name, t.Shape)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if prev, ok := r.tensors[t.Name]; ok && !prev.eq(t) {
+		return fmt.Errorf("%v: %s was %s, now %s", errRedeclared, t.Name, prev, t)
+	}
+	t.Shape = append([]int{}, t.Shape...)
+	r.tensors[t.Name] = t
+	return nil
+}
+
+// Tensors returns the declared tensors sorted by name
+func (r *Registry) Tensors() []Tensor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ts []Tensor
+	for _, t := range r.tensors {
+		ts = append(ts, t)
+	}
+	sort.Slice(ts, func(i, j int) bool { return ts[i].Name < ts[j].Name })
+	return ts
+}
+
+// Encode returns the canonical encoding of the declared tensors
+func (r *Registry) Encode() []byte {
+	bs, _ := json.Marshal(r.Tensors())
+	return bs
+}
+
+func Decode(bs []byte) ([]Tensor, error) {
+	var ts []Tensor
+	if err := json.Unmarshal(bs, &ts); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// Fingerprint is a hash of the declared tensors, 0 if none is declared
+func (r *Registry) Fingerprint() uint64 {
+	ts := r.Tensors()
+	if len(ts) == 0 {
+		return 0
+	}
+	bs, _ := json.Marshal(ts)
+	h := fnv.New64a()
+	h.Write(bs)
+	if x := h.Sum64(); x != 0 {
+		return x
+	}
+	return 1
+}
+
+// Diff names the first tensor declared differently by this peer of rank and the peer of rank other
+func Diff(ts []Tensor, rank int, others []Tensor, other int) error {
+	mine := make(map[string]Tensor)
+	for _, t := range ts {
+		mine[t.Name] = t
+	}
+	for _, u := range others {
+		t, ok := mine[u.Name]
+		if !ok {
+			return fmt.Errorf("%v: tensor %s is %s on rank %d, but not declared on rank %d", ErrDiverged, u.Name, u, other, rank)
+		}
+		if !t.eq(u) {
+			return fmt.Errorf("%v: tensor %s is %s on rank %d, but %s on rank %d", ErrDiverged, u.Name, u, other, t, rank)
+		}
+		delete(mine, u.Name)
+	}
+	for _, t := range ts {
+		if _, ok := mine[t.Name]; ok {
+			return fmt.Errorf("%v: tensor %s is %s on rank %d, but not declared on rank %d", ErrDiverged, t.Name, t, rank, other)
+		}
+	}
+	return nil
+}
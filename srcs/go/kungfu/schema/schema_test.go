@@ -0,0 +1,55 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+)
+
+func Test_Declare(t *testing.T) {
+	r := New()
+	if r.Fingerprint() != 0 {
+		t.Errorf("empty registry should have no fingerprint")
+	}
+	if err := r.Declare(Tensor{Name: "w", DType: kb.F32, Shape: []int{3, 4}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Declare(Tensor{Name: "w", DType: kb.F32, Shape: []int{3, 4}}); err != nil {
+		t.Errorf("redeclaring the same tensor should be allowed: %v", err)
+	}
+	if err := r.Declare(Tensor{Name: "w", DType: kb.F32, Shape: []int{4, 3}}); err == nil {
+		t.Errorf("redeclaring with another shape should fail")
+	}
+	if err := r.Declare(Tensor{Name: "", DType: kb.F32}); err == nil {
+		t.Errorf("empty name should fail")
+	}
+	ts, err := Decode(r.Encode())
+	if err != nil || len(ts) != 1 || !ts[0].eq(r.Tensors()[0]) {
+		t.Errorf("Decode(Encode()) = %v, %v", ts, err)
+	}
+}
+
+func Test_Diff(t *testing.T) {
+	a, b := New(), New()
+	a.Declare(Tensor{Name: "w", DType: kb.F32, Shape: []int{3, 4}})
+	a.Declare(Tensor{Name: "b", DType: kb.F32, Shape: []int{4}})
+	b.Declare(Tensor{Name: "b", DType: kb.F32, Shape: []int{4}})
+	b.Declare(Tensor{Name: "w", DType: kb.F32, Shape: []int{3, 4}})
+	if a.Fingerprint() != b.Fingerprint() {
+		t.Errorf("fingerprints should not depend on the order of declarations")
+	}
+	if err := Diff(a.Tensors(), 0, b.Tensors(), 1); err != nil {
+		t.Errorf("unexpected diff: %v", err)
+	}
+	b.Declare(Tensor{Name: "v", DType: kb.F16, Shape: []int{2}})
+	if err := Diff(a.Tensors(), 0, b.Tensors(), 1); err == nil || !strings.Contains(err.Error(), "tensor v") {
+		t.Errorf("expect v to be reported, got %v", err)
+	}
+	c := New()
+	c.Declare(Tensor{Name: "b", DType: kb.F32, Shape: []int{4}})
+	c.Declare(Tensor{Name: "w", DType: kb.F32, Shape: []int{4, 3}})
+	if err := Diff(c.Tensors(), 2, a.Tensors(), 0); err == nil || !strings.Contains(err.Error(), "tensor w is f32[3 4] on rank 0, but f32[4 3] on rank 2") {
+		t.Errorf("expect w to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+// Package sealed encrypts state files at rest with AES-GCM, if a key is configured by
+// KUNGFU_CONFIG_STATE_KEY or KUNGFU_CONFIG_STATE_KEY_CMD, e.g. a command calling a KMS to decrypt a data key.
+package sealed
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+)
+
+// magic prefixes sealed files, files without it are read as plaintext if no state key is configured
+var magic = []byte("KFSEALED1\n")
+
+var (
+	errInvalidKey = errors.New("state key must be 16, 24 or 32 bytes encoded in base64")
+	errNoKey      = errors.New("file is sealed but no state key is configured")
+	errNotSealed  = errors.New("file is not sealed but a state key is configured")
+	errTruncated  = errors.New("sealed file is truncated")
+)
+
+var (
+	keyOnce sync.Once
+	keyAEAD cipher.AEAD
+	keyErr  error
+)
+
+func getAEAD() (cipher.AEAD, error) {
+	keyOnce.Do(func() {
+		keyAEAD, keyErr = loadAEAD(config.StateKey, config.StateKeyCmd)
+	})
+	return keyAEAD, keyErr
+}
+
+func loadAEAD(key, cmd string) (cipher.AEAD, error) {
+	if len(key) == 0 && len(cmd) > 0 {
+		out, err := exec.Command("sh", "-c", cmd).Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get state key from %q: %v", cmd, err)
+		}
+		key = string(out)
+	}
+	if len(key) == 0 {
+		return nil, nil
+	}
+	return NewAEAD(strings.TrimSpace(key))
+}
+
+// NewAEAD creates the cipher of a base64 encoded AES key
+func NewAEAD(key string) (cipher.AEAD, error) {
+	k, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, errInvalidKey
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, errInvalidKey
+	}
+	return cipher.NewGCM(block)
+}
+
+// Seal encrypts data, the base name of the file is authenticated so that sealed files can't be swapped
+func Seal(aead cipher.AEAD, name string, data []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append(append([]byte{}, magic...), nonce...)
+	return aead.Seal(out, nonce, data, []byte(name)), nil
+}
+
+// Open decrypts data sealed by Seal, data without the magic prefix is returned as is if aead is nil,
+// and rejected otherwise, so that a planted plaintext file can't replace a sealed one.
+func Open(aead cipher.AEAD, name string, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, magic) {
+		if aead != nil {
+			return nil, errNotSealed
+		}
+		return data, nil
+	}
+	if aead == nil {
+		return nil, errNoKey
+	}
+	data = data[len(magic):]
+	if len(data) < aead.NonceSize() {
+		return nil, errTruncated
+	}
+	nonce, data := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, data, []byte(name))
+}
+
+// WriteFile writes data to filename, encrypted if a state key is configured
+func WriteFile(filename string, data []byte, perm os.FileMode) error {
+	aead, err := getAEAD()
+	if err != nil {
+		return err
+	}
+	if aead != nil {
+		if data, err = Seal(aead, filepath.Base(filename), data); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(filename, data, perm)
+}
+
+// ReadFile reads filename written by WriteFile, or a plaintext file if no state key is configured
+func ReadFile(filename string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := getAEAD()
+	if err != nil {
+		return nil, err
+	}
+	return Open(aead, filepath.Base(filename), data)
+}
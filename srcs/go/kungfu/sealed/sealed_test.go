@@ -0,0 +1,54 @@
+package sealed
+
+import (
+	"bytes"
+	"testing"
+)
+
+const testKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=" // 32 bytes
+
+func TestSealOpen(t *testing.T) {
+	aead, err := NewAEAD(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(`{"Runners":"10.0.0.1:38080"}`)
+	sealed, err := Seal(aead, "kv.json", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, data) {
+		t.Errorf("plaintext in sealed data")
+	}
+	if got, err := Open(aead, "kv.json", sealed); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Open() = %q, %v", got, err)
+	}
+	if _, err := Open(aead, "other.json", sealed); err == nil {
+		t.Errorf("sealed data of another file should be rejected")
+	}
+	sealed[len(sealed)-1] ^= 1
+	if _, err := Open(aead, "kv.json", sealed); err == nil {
+		t.Errorf("tampered data should be rejected")
+	}
+	if _, err := Open(nil, "kv.json", sealed); err != errNoKey {
+		t.Errorf("sealed data without key should be rejected, got %v", err)
+	}
+	if got, err := Open(nil, "kv.json", data); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("plaintext should be read as is, got %q, %v", got, err)
+	}
+	if _, err := Open(aead, "kv.json", data); err != errNotSealed {
+		t.Errorf("plaintext with key should be rejected, got %v", err)
+	}
+}
+
+func TestLoadAEAD(t *testing.T) {
+	if aead, err := loadAEAD("", ""); aead != nil || err != nil {
+		t.Errorf("no key should disable sealing")
+	}
+	if _, err := loadAEAD("", "echo "+testKey); err != nil {
+		t.Errorf("failed to load key from command: %v", err)
+	}
+	if _, err := loadAEAD("c2hvcnQ=", ""); err == nil {
+		t.Errorf("short key should be rejected")
+	}
+}
@@ -0,0 +1,24 @@
+package session
+
+import (
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+)
+
+// aggregate runs a custom aggregation by gathering the contributions of all peers, see kb.AggregateFunc
+func (sess *Session) aggregate(w kb.Workspace) error {
+	if w.IsEmpty() {
+		return nil
+	}
+	count := w.SendBuf.Count
+	all := kb.NewVector(count*sess.Size(), w.SendBuf.Type)
+	g := kb.Workspace{SendBuf: w.SendBuf, RecvBuf: all, OP: w.OP, Name: w.Name}
+	if err := sess.runAllGather(g); err != nil {
+		return err
+	}
+	xs := make([]*kb.Vector, sess.Size())
+	for i := range xs {
+		xs[i] = all.Slice(i*count, (i+1)*count)
+	}
+	kb.Aggregate(w.RecvBuf, xs, w.OP)
+	return nil
+}
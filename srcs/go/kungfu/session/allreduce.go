@@ -3,13 +3,26 @@ package session
 import (
 	"github.com/lsds/KungFu/srcs/go/kungfu/base"
 	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/kungfu/checksum"
 	"github.com/lsds/KungFu/srcs/go/plan"
 	"github.com/lsds/KungFu/srcs/go/plan/graph"
 	"github.com/lsds/KungFu/srcs/go/utils/assert"
 )
 
 func (sess *Session) AllReduce(w base.Workspace) error {
-	return sess.runStrategies(w, plan.EvenPartition, sess.globalStrategies)
+	w = privatize(w, sess.Size())
+	if w.OP.IsAggregate() {
+		if err := sess.aggregate(w); err != nil {
+			return err
+		}
+		sess.addChecksum(w)
+		return nil
+	}
+	if err := sess.runStrategies(w, plan.EvenPartition, sess.globalStrategies); err != nil {
+		return err
+	}
+	sess.addChecksum(w)
+	return nil
 }
 
 //AllReduceWith persoms an AllReduce collective communication operation
@@ -31,7 +44,30 @@ func (sess *Session) AllReduceWith(tree []int32, w kb.Workspace) error {
 		sl = sess.globalStrategies
 	}
 
-	return sess.runMonitoredStrategies(w, plan.EvenPartition, sl)
+	w = privatize(w, sess.Size())
+	if w.OP.IsAggregate() {
+		if err := sess.aggregate(w); err != nil {
+			return err
+		}
+		sess.addChecksum(w)
+		return nil
+	}
+	if err := sess.runMonitoredStrategies(w, plan.EvenPartition, sl); err != nil {
+		return err
+	}
+	sess.addChecksum(w)
+	return nil
+}
+
+// TrackChecksums folds the results of AllReduce into r, see package checksum
+func (sess *Session) TrackChecksums(r *checksum.Rolling) {
+	sess.checksum = r
+}
+
+func (sess *Session) addChecksum(w base.Workspace) {
+	if sess.checksum != nil {
+		sess.checksum.Add(w.Name, w.RecvBuf.Data)
+	}
 }
 
 // CrossAllReduce performs allreduce across all local roots.
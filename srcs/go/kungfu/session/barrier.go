@@ -0,0 +1,96 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/client"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+)
+
+var errInvalidBarrierTimeout = errors.New("timeout of named barrier must be positive")
+
+// BarrierError tells which ranks arrived at a named barrier before it timed out
+type BarrierError struct {
+	Name    string
+	Timeout time.Duration
+	Arrived []int
+	Missing []int // nil if unknown, because rank 0 didn't respond
+}
+
+func (e *BarrierError) Error() string {
+	if e.Missing == nil {
+		return fmt.Sprintf("barrier %q timed out after %s: rank %d didn't respond", e.Name, e.Timeout, defaultRoot)
+	}
+	return fmt.Sprintf("barrier %q timed out after %s: ranks %v arrived, ranks %v didn't", e.Name, e.Timeout, e.Arrived, e.Missing)
+}
+
+// NamedBarrier blocks until all peers have called it with the same name, or fails with a *BarrierError after timeout.
+// Rank 0 collects the arrivals, and tells the others who arrived once all arrived or it timed out.
+// The others wait twice the timeout for rank 0, since it may arrive later than them.
+func (sess *Session) NamedBarrier(name string, timeout time.Duration) error {
+	if timeout <= 0 {
+		return errInvalidBarrierTimeout
+	}
+	sess.Lock()
+	gen := sess.barrierGens[name]
+	sess.barrierGens[name]++
+	sess.Unlock()
+	msgName := fmt.Sprintf("kungfu::barrier::%s#%d", name, gen)
+	root := sess.peers[defaultRoot]
+	var arrived []byte
+	var sendErr error // the missing peers may be gone, so it is returned only if all arrived
+	if sess.rank == defaultRoot {
+		arrived = sess.collectArrivals(msgName, timeout)
+		w := kb.Workspace{Name: msgName, Stream: client.PriorityStream}
+		buf := &kb.Vector{Data: arrived, Count: len(arrived), Type: kb.U8}
+		sendErr = sess.sendAll(w, sess.peers.Others(sess.self), buf, connection.NoFlag)
+	} else {
+		if err := sess.client.SendOnStream(client.PriorityStream, root.WithName(msgName), []byte{1}, connection.ConnCollective, connection.NoFlag); err != nil {
+			return err
+		}
+		m, ok := sess.collectiveHandler.RecvTimeout(root.WithName(msgName), 2*timeout)
+		if !ok {
+			return &BarrierError{Name: name, Timeout: timeout, Arrived: []int{sess.rank}}
+		}
+		arrived = m.Data
+	}
+	e := &BarrierError{Name: name, Timeout: timeout}
+	for rank, a := range arrived {
+		if a == 1 {
+			e.Arrived = append(e.Arrived, rank)
+		} else {
+			e.Missing = append(e.Missing, rank)
+		}
+	}
+	if len(e.Missing) > 0 {
+		return e
+	}
+	return sendErr
+}
+
+// collectArrivals waits for the arrivals of all other peers at rank 0, until timeout
+func (sess *Session) collectArrivals(msgName string, timeout time.Duration) []byte {
+	arrived := make([]byte, len(sess.peers))
+	arrived[sess.rank] = 1
+	deadline := time.Now().Add(timeout)
+	var wg sync.WaitGroup
+	for rank, peer := range sess.peers {
+		if rank == sess.rank {
+			continue
+		}
+		wg.Add(1)
+		go func(rank int, peer plan.PeerID) {
+			defer wg.Done()
+			if _, ok := sess.collectiveHandler.RecvTimeout(peer.WithName(msgName), time.Until(deadline)); ok {
+				arrived[rank] = 1
+			}
+		}(rank, peer)
+	}
+	wg.Wait()
+	return arrived
+}
@@ -0,0 +1,55 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+var errNotInGroup = errors.New("self not in group")
+
+// groupStrategies returns the strategies of the group of ranks, which must be sorted
+func (sess *Session) groupStrategies(ranks []int) (strategyList, error) {
+	var in bool
+	for _, r := range ranks {
+		if r < 0 || r >= len(sess.peers) {
+			return nil, fmt.Errorf("invalid rank %d in group of %d peers", r, len(sess.peers))
+		}
+		in = in || r == sess.rank
+	}
+	if !in {
+		return nil, errNotInGroup
+	}
+	key := fmt.Sprint(ranks)
+	sess.groupsLock.Lock()
+	defer sess.groupsLock.Unlock()
+	sl, ok := sess.groups[key]
+	if !ok {
+		sl = createSubsetStrategies(len(sess.peers), ranks, sess.strategy)
+		sess.groups[key] = sl
+	}
+	return sl, nil
+}
+
+// GroupAllReduce performs all reduce among the given ranks only, all of them must call it with the same ranks
+func (sess *Session) GroupAllReduce(ranks []int, w kb.Workspace) error {
+	sl, err := sess.groupStrategies(ranks)
+	if err != nil {
+		return err
+	}
+	w = privatize(w, len(ranks))
+	return sess.runStrategies(w, plan.EvenPartition, sl)
+}
+
+// GroupBroadcast broadcasts from the first of the given ranks to the others
+func (sess *Session) GroupBroadcast(ranks []int, w kb.Workspace) error {
+	sl, err := sess.groupStrategies(ranks)
+	if err != nil {
+		return err
+	}
+	defer timeCollective(time.Now())
+	return sess.runGraphs(w, sl[0].bcastGraph)
+}
@@ -13,7 +13,8 @@ import (
 )
 
 func (sess *Session) runMonitoredStrategiesWithHash(w kb.Workspace, p kb.PartitionFunc, strategies strategyList, strategyHash strategyHashFunc) error {
-	k := ceilDiv(w.RecvBuf.Count*w.RecvBuf.Type.Size(), chunkSize)
+	defer timeCollective(time.Now())
+	k := ceilDiv(w.RecvBuf.Count*w.RecvBuf.Type.Size(), sess.getChunkSize())
 	errs := make([]error, k)
 	var wg sync.WaitGroup
 	for i, w := range w.Split(p, k) {
@@ -0,0 +1,19 @@
+package session
+
+import (
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/kungfu/privacy"
+)
+
+// privatize clips and noises the contribution of this peer to a reduction among n peers, if differential privacy is configured and w is named with its prefix.
+// The contribution is written to w.RecvBuf and reduced in place, so that w.SendBuf is left untouched.
+func privatize(w kb.Workspace, n int) kb.Workspace {
+	g := privacy.Default()
+	if g == nil || w.IsEmpty() || !g.Applies(w) {
+		return w
+	}
+	w.Forward()
+	g.Apply(w.RecvBuf, n)
+	w.SendBuf = w.RecvBuf
+	return w
+}
@@ -1,11 +1,17 @@
 package session
 
 import (
+	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/kungfu/checksum"
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
 	"github.com/lsds/KungFu/srcs/go/kungfu/execution"
 	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/monitor"
 	"github.com/lsds/KungFu/srcs/go/plan"
 	"github.com/lsds/KungFu/srcs/go/plan/graph"
 	"github.com/lsds/KungFu/srcs/go/rchannel/client"
@@ -34,9 +40,18 @@ type Session struct {
 	collectiveHandler *handler.CollectiveEndpoint
 	strategyHash      strategyHashFunc
 	strategyStats     []StrategyStatSnapshot
+	strategy          kb.Strategy
+	chunkSize         int64             // accessed atomically
+	window            int               // parts of a workspace in flight at a time, 0 for all
+	checksum          *checksum.Rolling // of the results of AllReduce, nil if not tracked
+
+	groupsLock sync.Mutex
+	groups     map[string]strategyList // strategies of groups of ranks, created on first use
+
+	barrierGens map[string]int // number of calls of each named barrier, guarded by the session lock
 }
 
-func New(strategy kb.Strategy, self plan.PeerID, pl plan.PeerList, client *client.Client, collectiveHandler *handler.CollectiveEndpoint) (*Session, bool) {
+func New(strategy kb.Strategy, opts kb.StrategyOptions, self plan.PeerID, pl plan.PeerList, client *client.Client, collectiveHandler *handler.CollectiveEndpoint) (*Session, bool) {
 	rank, ok := pl.Rank(self)
 	if !ok {
 		return nil, false
@@ -50,7 +65,7 @@ func New(strategy kb.Strategy, self plan.PeerID, pl plan.PeerList, client *clien
 	}
 	sess := &Session{
 		localStrategies:   genLocalStrategyList(pl),
-		globalStrategies:  genGlobalStrategyList(pl, strategy),
+		globalStrategies:  genGlobalStrategyList(pl, strategy, opts),
 		crossStrategies:   genCrossStrategyList(pl, strategy),
 		self:              self,
 		peers:             pl,
@@ -61,6 +76,11 @@ func New(strategy kb.Strategy, self plan.PeerID, pl plan.PeerList, client *clien
 		client:            client,
 		collectiveHandler: collectiveHandler,
 		strategyHash:      getStrategyHash(),
+		strategy:          strategy,
+		chunkSize:         defaultChunkSize,
+		window:            opts.Window,
+		groups:            make(map[string]strategyList),
+		barrierGens:       make(map[string]int),
 	}
 	return sess, true
 }
@@ -104,6 +124,7 @@ func (sess *Session) barrier() error {
 		RecvBuf: kb.NewVector(count, dtype),
 		OP:      kb.SUM,
 		Name:    "kungfu::barrier", // TODO: use tag
+		Stream:  client.PriorityStream,
 	}
 	return sess.runStrategies(w, plan.EvenPartition, sess.globalStrategies)
 }
@@ -124,8 +145,8 @@ func (sess *Session) BytesConsensus(bs []byte, name string) (bool, error) {
 		y := kb.NewVector(1, kb.I32)
 		z := kb.NewVector(1, kb.I32)
 		x.AsI32()[0] = int32(n)
-		w1 := kb.Workspace{SendBuf: x, RecvBuf: y, OP: kb.MIN, Name: ":consensus:len:min:" + name}
-		w2 := kb.Workspace{SendBuf: x, RecvBuf: z, OP: kb.MAX, Name: ":consensus:len:max:" + name}
+		w1 := kb.Workspace{SendBuf: x, RecvBuf: y, OP: kb.MIN, Name: ":consensus:len:min:" + name, Stream: client.PriorityStream}
+		w2 := kb.Workspace{SendBuf: x, RecvBuf: z, OP: kb.MAX, Name: ":consensus:len:max:" + name, Stream: client.PriorityStream}
 		assert.OK(sess.AllReduce(w1))
 		assert.OK(sess.AllReduce(w2))
 		if !utils.BytesEq(y.Data, z.Data) {
@@ -139,8 +160,8 @@ func (sess *Session) BytesConsensus(bs []byte, name string) (bool, error) {
 		x := &kb.Vector{Data: bs, Count: n, Type: kb.U8}
 		y := kb.NewVector(n, kb.U8)
 		z := kb.NewVector(n, kb.U8)
-		w1 := kb.Workspace{SendBuf: x, RecvBuf: y, OP: kb.MIN, Name: ":consensus:min:" + name}
-		w2 := kb.Workspace{SendBuf: x, RecvBuf: z, OP: kb.MAX, Name: ":consensus:max:" + name}
+		w1 := kb.Workspace{SendBuf: x, RecvBuf: y, OP: kb.MIN, Name: ":consensus:min:" + name, Stream: client.PriorityStream}
+		w2 := kb.Workspace{SendBuf: x, RecvBuf: z, OP: kb.MAX, Name: ":consensus:max:" + name, Stream: client.PriorityStream}
 		assert.OK(sess.AllReduce(w1))
 		assert.OK(sess.AllReduce(w2))
 		if !utils.BytesEq(y.Data, z.Data) {
@@ -151,22 +172,35 @@ func (sess *Session) BytesConsensus(bs []byte, name string) (bool, error) {
 }
 
 func (sess *Session) Reduce(w kb.Workspace) error {
+	defer timeCollective(time.Now())
+	if err := checkReducible(w); err != nil {
+		return err
+	}
 	strategy := sess.globalStrategies[0] // Assuming len(sess.globalStrategies) > 0
+	w = privatize(w, sess.Size())
 	return sess.runGraphs(w, strategy.reduceGraph)
 }
 
 func (sess *Session) Broadcast(w kb.Workspace) error {
+	defer timeCollective(time.Now())
 	strategy := sess.globalStrategies[0] // Assuming len(sess.globalStrategies) > 0
 	return sess.runGraphs(w, strategy.bcastGraph)
 }
 
 func (sess *Session) Gather(w kb.Workspace) error {
+	defer timeCollective(time.Now())
 	// TODO: validate input
 	return sess.runGather(w)
 }
 
+func timeCollective(t0 time.Time) {
+	monitor.AddCollective(time.Since(t0))
+}
+
+// LocalReduce is the first step of hierarchical all-reduce, so the contribution is privatized as one of all peers
 func (sess *Session) LocalReduce(w kb.Workspace) error {
 	strategy := sess.localStrategies[0] // len(sess.localStrategies) == 1
+	w = privatize(w, sess.Size())
 	return sess.runGraphs(w, strategy.reduceGraph)
 }
 
@@ -185,7 +219,7 @@ func asMessage(b *kb.Vector) connection.Message {
 func (sess *Session) runGather(w kb.Workspace) error {
 	if sess.rank != defaultRoot {
 		peer := sess.peers[defaultRoot]
-		return sess.client.Send(peer.WithName(w.Name), w.SendBuf.Data, connection.ConnCollective, connection.NoFlag)
+		return sess.client.SendOnStream(w.Stream, peer.WithName(w.Name), w.SendBuf.Data, connection.ConnCollective, connection.NoFlag)
 	}
 	var wg sync.WaitGroup
 	count := w.SendBuf.Count
@@ -206,6 +240,20 @@ func (sess *Session) runGather(w kb.Workspace) error {
 	return nil // FIXME: handle errors
 }
 
+// sendAll sends buf to peers in parallel, it is encoded once and shared by all sends if there are many peers
+func (sess *Session) sendAll(w kb.Workspace, peers plan.PeerList, buf *kb.Vector, flags uint32) error {
+	var send execution.PeerFunc = func(peer plan.PeerID) error {
+		return sess.client.SendOnStream(w.Stream, peer.WithName(w.Name), buf.Data, connection.ConnCollective, flags)
+	}
+	if len(peers) > 1 {
+		e := connection.EncodeMessage(w.Name, asMessage(buf), flags, len(peers))
+		send = func(peer plan.PeerID) error {
+			return sess.client.SendEncodedOnStream(w.Stream, peer.WithName(w.Name), e, connection.ConnCollective)
+		}
+	}
+	return send.Par(peers)
+}
+
 func isIsolated(rank int, graphs ...*graph.Graph) bool {
 	for _, g := range graphs {
 		if !g.IsIsolated(rank) {
@@ -231,11 +279,16 @@ func (sess *Session) runGraphs(w kb.Workspace, graphs ...*graph.Graph) error {
 		}
 		return w.SendBuf
 	}
-	var sendOnto execution.PeerFunc = func(peer plan.PeerID) error {
-		return sess.client.Send(peer.WithName(w.Name), effectiveBuffer().Data, connection.ConnCollective, connection.NoFlag)
+	segmentSize := recvSegmentSize(w.SendBuf)
+	sendOnto := func(peers plan.PeerList) error {
+		flags := connection.NoFlag
+		if segmentSize > 0 {
+			flags = connection.RecvSegments
+		}
+		return sess.sendAll(w, peers, effectiveBuffer(), flags)
 	}
-	var sendInto execution.PeerFunc = func(peer plan.PeerID) error {
-		return sess.client.Send(peer.WithName(w.Name), effectiveBuffer().Data, connection.ConnCollective, connection.WaitRecvBuf)
+	sendInto := func(peers plan.PeerList) error {
+		return sess.sendAll(w, peers, effectiveBuffer(), connection.WaitRecvBuf)
 	}
 
 	var lock sync.Mutex
@@ -250,6 +303,26 @@ func (sess *Session) runGraphs(w kb.Workspace, graphs ...*graph.Graph) error {
 		return nil
 	}
 
+	// recvOntoSegments reduces each segment into RecvBuf while the next segment is being received,
+	// RecvBuf must be initialized before.
+	var recvOntoSegments execution.PeerFunc = func(peer plan.PeerID) error {
+		size := w.RecvBuf.Type.Size()
+		err := sess.collectiveHandler.RecvSegments(peer.WithName(w.Name), len(w.RecvBuf.Data), segmentSize, func(offset int, seg []byte) {
+			x := w.RecvBuf.Slice(offset/size, (offset+len(seg))/size)
+			b := &kb.Vector{Data: seg, Count: x.Count, Type: x.Type}
+			lock.Lock()
+			kb.Transform2(x, x, b, w.OP)
+			lock.Unlock()
+		})
+		if err != nil {
+			return err
+		}
+		lock.Lock()
+		recvCount++
+		lock.Unlock()
+		return nil
+	}
+
 	var recvInto execution.PeerFunc = func(peer plan.PeerID) error {
 		sess.collectiveHandler.RecvInto(peer.WithName(w.Name), asMessage(w.RecvBuf))
 		recvCount++
@@ -260,10 +333,19 @@ func (sess *Session) runGraphs(w kb.Workspace, graphs ...*graph.Graph) error {
 		prevs := sess.peers.Select(g.Prevs(sess.rank))
 		nexts := sess.peers.Select(g.Nexts(sess.rank))
 		if g.IsSelfLoop(sess.rank) {
-			if err := recvOnto.Par(prevs); err != nil {
+			// contributions of all prevs are reduced into one buffer as they arrive, which is sent once to each next,
+			// so an interior node of a reduce tree sends one message upward regardless of its fan-in
+			recv := recvOnto
+			if segmentSize > 0 && len(prevs) > 0 {
+				if recvCount == 0 && !w.IsInplace() {
+					w.Forward()
+				}
+				recv = recvOntoSegments
+			}
+			if err := recv.Par(prevs); err != nil {
 				return err
 			}
-			if err := sendOnto.Par(nexts); err != nil {
+			if err := sendOnto(nexts); err != nil {
 				return err
 			}
 		} else {
@@ -277,7 +359,7 @@ func (sess *Session) runGraphs(w kb.Workspace, graphs ...*graph.Graph) error {
 					return err
 				}
 			}
-			if err := sendInto.Par(nexts); err != nil {
+			if err := sendInto(nexts); err != nil {
 				return err
 			}
 		}
@@ -285,11 +367,30 @@ func (sess *Session) runGraphs(w kb.Workspace, graphs ...*graph.Graph) error {
 	return nil
 }
 
+// recvSegmentSize returns the size of segments to receive b by, or 0 if b is not large enough
+func recvSegmentSize(b *kb.Vector) int {
+	size := config.RecvSegmentSize - config.RecvSegmentSize%b.Type.Size()
+	if size <= 0 || len(b.Data) <= size {
+		return 0
+	}
+	return size
+}
+
 const (
-	Mi        = 1 << 20
-	chunkSize = 1 * Mi
+	Mi               = 1 << 20
+	defaultChunkSize = 1 * Mi
 )
 
+// SetChunkSize sets the size in bytes of the parts of a workspace that are reduced concurrently,
+// it must be the same on all peers, and changed between collectives.
+func (sess *Session) SetChunkSize(n int) {
+	atomic.StoreInt64(&sess.chunkSize, int64(n))
+}
+
+func (sess *Session) getChunkSize() int {
+	return int(atomic.LoadInt64(&sess.chunkSize))
+}
+
 func ceilDiv(a, b int) int {
 	if a%b == 0 {
 		return a / b
@@ -298,13 +399,27 @@ func ceilDiv(a, b int) int {
 }
 
 func (sess *Session) runStrategiesWithHash(w kb.Workspace, p kb.PartitionFunc, strategies strategyList, strategyHash strategyHashFunc) error {
-	k := ceilDiv(w.RecvBuf.Count*w.RecvBuf.Type.Size(), chunkSize)
+	if err := checkReducible(w); err != nil {
+		return err
+	}
+	defer timeCollective(time.Now())
+	k := ceilDiv(w.RecvBuf.Count*w.RecvBuf.Type.Size(), sess.getChunkSize())
 	errs := make([]error, k)
+	var window chan struct{}
+	if sess.window > 0 {
+		window = make(chan struct{}, sess.window)
+	}
 	var wg sync.WaitGroup
 	for i, w := range w.Split(p, k) {
+		if window != nil {
+			window <- struct{}{} // in the order of parts, which is the same on all peers
+		}
 		wg.Add(1)
 		go func(i int, w kb.Workspace, s strategy) {
 			errs[i] = sess.runGraphs(w, s.reduceGraph, s.bcastGraph)
+			if window != nil {
+				<-window
+			}
 			wg.Done()
 		}(i, w, strategies.choose(int(strategyHash(i, w.Name))))
 	}
@@ -316,6 +431,14 @@ func (sess *Session) runStrategies(w kb.Workspace, p kb.PartitionFunc, strategie
 	return sess.runStrategiesWithHash(w, p, strategies, sess.strategyHash)
 }
 
+// checkReducible rejects a dtype that op has no kernel for, which would otherwise abort the process while reducing.
+func checkReducible(w kb.Workspace) error {
+	if !w.OP.Supports(w.RecvBuf.Type) {
+		return fmt.Errorf("%s reduction is not supported for %s: %s", w.OP, w.RecvBuf.Type, w.Name)
+	}
+	return nil
+}
+
 func boolToInt8(v bool) int8 {
 	if v {
 		return 1
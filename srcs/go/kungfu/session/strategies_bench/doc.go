@@ -0,0 +1,5 @@
+// Package strategies_bench benchmarks all reduce strategies with peers running as goroutines over the in-memory transport,
+// so that regressions of strategies and graphs are caught without a cluster:
+//
+//	go test -run NONE -bench . ./kungfu/session/strategies_bench/
+package strategies_bench
@@ -0,0 +1,136 @@
+package strategies_bench
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/kungfu/env"
+	"github.com/lsds/KungFu/srcs/go/kungfu/peer"
+	"github.com/lsds/KungFu/srcs/go/kungfu/session"
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+var (
+	peerCounts  = []int{2, 4, 8}
+	tensorSizes = []int{1 << 10, 1 << 16, 1 << 20} // number of float32
+)
+
+func strategies() []kb.Strategy {
+	names := kb.StrategyNames()
+	sort.Strings(names)
+	var ss []kb.Strategy
+	for _, name := range names {
+		s, err := kb.ParseStrategy(name)
+		if err != nil || *s == kb.Auto {
+			continue
+		}
+		ss = append(ss, *s)
+	}
+	return ss
+}
+
+func BenchmarkAllReduce(b *testing.B) {
+	config.InprocTransport = true
+	for _, s := range strategies() {
+		for _, np := range peerCounts {
+			for _, n := range tensorSizes {
+				b.Run(fmt.Sprintf("%s/np=%d/n=%d", s, np, n), func(b *testing.B) {
+					benchAllReduce(b, s, np, n)
+				})
+			}
+		}
+	}
+}
+
+// benchAllReduce runs b.N all reduces of n float32 on np peers
+func benchAllReduce(b *testing.B, s kb.Strategy, np, n int) {
+	sessions, closeAll := startPeers(b, s, np)
+	defer closeAll()
+	ws := make([]kb.Workspace, np)
+	for i := range ws {
+		ws[i] = kb.Workspace{
+			SendBuf: kb.NewVector(n, kb.F32),
+			RecvBuf: kb.NewVector(n, kb.F32),
+			OP:      kb.SUM,
+		}
+	}
+	b.SetBytes(int64(n * kb.F32.Size()))
+	b.ResetTimer()
+	errs := make([]error, np)
+	var wg sync.WaitGroup
+	for i, sess := range sessions {
+		wg.Add(1)
+		go func(i int, sess *session.Session) {
+			defer wg.Done()
+			w := ws[i]
+			for step := 0; step < b.N; step++ {
+				w.Name = fmt.Sprintf("bench-%d", step)
+				if errs[i] = sess.AllReduce(w); errs[i] != nil {
+					return
+				}
+			}
+		}(i, sess)
+	}
+	wg.Wait()
+	b.StopTimer()
+	for _, err := range errs {
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// nextPort gives each group of peers its own ports, so that peers of different benchmarks never talk to each other
+var nextPort uint16 = 20000
+
+func startPeers(b *testing.B, s kb.Strategy, np int) ([]*session.Session, func()) {
+	runner := plan.PeerID{IPv4: plan.MustParseIPv4(`127.0.0.1`), Port: plan.DefaultRunnerPort}
+	hl := plan.HostList{{IPv4: runner.IPv4, Slots: np}}
+	peers, err := hl.GenPeerList(np, plan.PortRange{Begin: nextPort, End: nextPort + uint16(np)})
+	if err != nil {
+		b.Fatal(err)
+	}
+	nextPort += uint16(np)
+	// peers must start together, since each of them waits for the others in the first barrier
+	ps := make([]*peer.Peer, np)
+	errs := make([]error, np)
+	var wg sync.WaitGroup
+	for i, id := range peers {
+		wg.Add(1)
+		go func(i int, id plan.PeerID) {
+			defer wg.Done()
+			p, err := peer.NewFromConfig(&env.Config{
+				Self:               id,
+				Parent:             runner,
+				InitRunners:        plan.PeerList{runner},
+				InitPeers:          peers,
+				Strategy:           s,
+				InitClusterVersion: "0",
+			})
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			ps[i], errs[i] = p, p.Start()
+		}(i, id)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	sessions := make([]*session.Session, np)
+	for i, p := range ps {
+		sessions[i] = p.CurrentSession()
+	}
+	return sessions, func() {
+		for _, p := range ps {
+			p.Close()
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
 	"github.com/lsds/KungFu/srcs/go/plan"
 	"github.com/lsds/KungFu/srcs/go/plan/graph"
 	"github.com/lsds/KungFu/srcs/go/plan/subgraph"
@@ -96,6 +97,7 @@ var partitionStrategies = map[kb.Strategy]partitionStrategy{
 	kb.BinaryTree:          createBinaryTreeStrategies,
 	kb.BinaryTreeStar:      createBinaryTreeStarStrategies,
 	kb.MultiBinaryTreeStar: createMultiBinaryTreeStarStrategies,
+	kb.DoubleBinaryTree:    createDoubleBinaryTreeStrategies,
 }
 
 func simpleStrategy(bcastGraph *graph.Graph) strategy {
@@ -142,9 +144,23 @@ func createMultiBinaryTreeStarStrategies(peers plan.PeerList) strategyList {
 	return sl
 }
 
+func createDoubleBinaryTreeStrategies(peers plan.PeerList) strategyList {
+	var sl strategyList
+	for _, bcastGraph := range plan.GenDoubleBinaryTree(len(peers)) {
+		sl = append(sl, simpleStrategy(bcastGraph))
+	}
+	return sl
+}
+
 func createCliqueStrategies(peers plan.PeerList) strategyList {
 	k := len(peers)
 	var sl strategyList
+	if config.CliqueSubdivide > 0 && k > config.CliqueSubdivide && peers.HostCount() > 1 {
+		for _, bcastGraph := range plan.GenHierarchicalClique(peers) {
+			sl = append(sl, simpleStrategy(bcastGraph))
+		}
+		return sl
+	}
 	for r := 0; r < k; r++ {
 		bcastGraph := plan.GenStarBcastGraph(k, r)
 		sl = append(sl, simpleStrategy(bcastGraph))
@@ -181,30 +197,51 @@ func genLocalStrategyList(peers plan.PeerList) strategyList {
 	return strategyList{simpleStrategy(bcastGraph)}
 }
 
-func genGlobalStrategyList(peers plan.PeerList, strategyName kb.Strategy) strategyList {
+func genGlobalStrategyList(peers plan.PeerList, strategyName kb.Strategy, opts kb.StrategyOptions) strategyList {
+	if strategyName == kb.Tree && opts.Fanout > 0 {
+		return strategyList{simpleStrategy(plan.GenTreeFanout(peers, opts.Fanout))}
+	}
 	return partitionStrategies[strategyName](peers)
 }
 
-func createCrossRingStrategies(peers plan.PeerList) strategyList {
-	n := len(peers)
-	masters, _ := peers.PartitionByHost()
-	var sl strategyList
-	for r := range masters {
-		reduceGraph, bcastGraph := subgraph.GenCircularGraphPair(n, masters, r)
-		sl = append(sl, newStrategy(reduceGraph, bcastGraph))
+// GlobalStrategyGraphs returns the reduce and broadcast graphs of the strategies a session of peers would use
+func GlobalStrategyGraphs(peers plan.PeerList, strategyName kb.Strategy, opts kb.StrategyOptions) ([]*graph.Graph, []*graph.Graph) {
+	if strategyName == kb.Auto {
+		strategyName = autoSelect(peers)
 	}
-	return sl
+	var reduceGraphs, bcastGraphs []*graph.Graph
+	for _, s := range genGlobalStrategyList(peers, strategyName, opts) {
+		reduceGraphs = append(reduceGraphs, s.reduceGraph)
+		bcastGraphs = append(bcastGraphs, s.bcastGraph)
+	}
+	return reduceGraphs, bcastGraphs
 }
 
-func createCrossBinaryTreeStrategies(peers plan.PeerList) strategyList {
-	masters, _ := peers.PartitionByHost()
-	bcastGraph := subgraph.GenBinaryTree(len(peers), masters)
-	return strategyList{simpleStrategy(bcastGraph)}
+// ForestGraphs returns the reduce and broadcast graphs of a custom strategy given by forest, as AllReduceWith
+func ForestGraphs(forest []int) (*graph.Graph, *graph.Graph, bool) {
+	bg, _, ok := graph.FromForestArray(forest)
+	if !ok {
+		return nil, nil, false
+	}
+	s := simpleStrategy(bg)
+	return s.reduceGraph, s.bcastGraph, true
 }
 
-func genCrossStrategyList(peers plan.PeerList, strategyName kb.Strategy) strategyList {
+// createSubsetStrategies creates strategies which only involve the given ranks of n peers
+func createSubsetStrategies(n int, ranks []int, strategyName kb.Strategy) strategyList {
 	if strategyName == kb.Ring {
-		return createCrossRingStrategies(peers)
+		var sl strategyList
+		for r := range ranks {
+			reduceGraph, bcastGraph := subgraph.GenCircularGraphPair(n, ranks, r)
+			sl = append(sl, newStrategy(reduceGraph, bcastGraph))
+		}
+		return sl
 	}
-	return createCrossBinaryTreeStrategies(peers)
+	bcastGraph := subgraph.GenBinaryTree(n, ranks)
+	return strategyList{simpleStrategy(bcastGraph)}
+}
+
+func genCrossStrategyList(peers plan.PeerList, strategyName kb.Strategy) strategyList {
+	masters, _ := peers.PartitionByHost()
+	return createSubsetStrategies(len(peers), masters, strategyName)
 }
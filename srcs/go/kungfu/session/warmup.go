@@ -0,0 +1,51 @@
+package session
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/utils"
+)
+
+// WarmUp runs a one byte all reduce over each graph of all strategies concurrently,
+// so that connections of all edges are established before the first collective of the user.
+// It must be called by all peers.
+func (sess *Session) WarmUp() error {
+	t0 := time.Now()
+	lists := map[string]strategyList{
+		"global": sess.globalStrategies,
+		"cross":  sess.crossStrategies,
+		"local":  sess.localStrategies,
+	}
+	var errs []error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, sl := range lists {
+		for i, s := range sl {
+			wg.Add(1)
+			go func(name string, s strategy) {
+				defer wg.Done()
+				w := kb.Workspace{
+					SendBuf: kb.NewVector(1, kb.U8),
+					RecvBuf: kb.NewVector(1, kb.U8),
+					OP:      kb.SUM,
+					Name:    name,
+				}
+				if err := sess.runGraphs(w, s.reduceGraph, s.bcastGraph); err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+			}(fmt.Sprintf("kungfu::warm-up:%s:%d", name, i), s)
+		}
+	}
+	wg.Wait()
+	if err := utils.MergeErrors(errs, "WarmUp"); err != nil {
+		return err
+	}
+	log.Debugf("warmed up %d peers, took %s", len(sess.peers), time.Since(t0))
+	return nil
+}
@@ -0,0 +1,153 @@
+// Package throughput measures the global throughput of a cluster over windows of steps which all peers close at the same step,
+// so that the throughputs of clusters of different sizes are compared at the same points of training rather than of wall clock,
+// e.g. to tell whether adding 4 workers actually improved the global throughput.
+package throughput
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/utils"
+)
+
+// Snapshot is the global throughput of a window of steps of a cluster version
+type Snapshot struct {
+	Version  int
+	Peers    int
+	Step     int           // the last step of the window, counted from the start of the cluster version
+	Steps    int           // in the window
+	Samples  int64         // processed by all peers in the window, a sample per step of each peer which doesn't count samples
+	Duration time.Duration // of the window on the slowest peer
+}
+
+// Rate returns the samples per second
+func (s Snapshot) Rate() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Samples) / s.Duration.Seconds()
+}
+
+func (s Snapshot) String() string {
+	return fmt.Sprintf("v%d of %s, steps %d-%d: %.1f samples/s", s.Version, utils.Pluralize(s.Peers, "peer", "peers"), s.Step-s.Steps+1, s.Step, s.Rate())
+}
+
+// Speedup returns the ratio of the throughput of s to that of an earlier Snapshot
+func (s Snapshot) Speedup(before Snapshot) float64 {
+	if r := before.Rate(); r > 0 {
+		return s.Rate() / r
+	}
+	return 0
+}
+
+// Window accumulates the samples and the time of the steps of a peer within a cluster version.
+// A step lasts from the end of the previous step, the first step of a cluster version is not timed,
+// so that the cost of joining the cluster doesn't count.
+type Window struct {
+	mu      sync.Mutex
+	period  int
+	steps   int
+	samples int64
+	counted bool
+	last    time.Time
+}
+
+// New creates a Window which closes every period steps
+func New(period int) *Window {
+	return &Window{period: period}
+}
+
+// Add counts samples processed in the current step
+func (w *Window) Add(n int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.samples += n
+	w.counted = true
+}
+
+// Reset restarts the steps, when the cluster changes
+func (w *Window) Reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.steps, w.samples, w.counted = 0, 0, false
+	w.last = time.Time{}
+}
+
+// Step ends a step, it returns the local samples and duration of the window, and the step it closes at, at the end of each window
+func (w *Window) Step() (int64, time.Duration, int, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.steps++
+	now := time.Now()
+	if w.last.IsZero() {
+		w.last = now
+		w.samples, w.counted = 0, false
+		return 0, 0, 0, false
+	}
+	if w.period <= 0 || (w.steps-1)%w.period != 0 {
+		return 0, 0, 0, false
+	}
+	samples := w.samples
+	if !w.counted {
+		samples = int64(w.period)
+	}
+	d := now.Sub(w.last)
+	w.last = now
+	w.samples, w.counted = 0, false
+	return samples, d, w.steps, true
+}
+
+// maxVersions is the number of cluster versions kept by a History
+const maxVersions = 16
+
+// History keeps the latest Snapshot of each of the latest cluster versions
+type History struct {
+	mu     sync.Mutex
+	latest map[int]Snapshot
+}
+
+func NewHistory() *History {
+	return &History{latest: make(map[int]Snapshot)}
+}
+
+// Add records a Snapshot, it returns the latest Snapshot of the previous version if s is the first of its version
+func (h *History) Add(s Snapshot) (Snapshot, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, seen := h.latest[s.Version]
+	h.latest[s.Version] = s
+	if len(h.latest) > maxVersions {
+		oldest := s.Version
+		for v := range h.latest {
+			if v < oldest {
+				oldest = v
+			}
+		}
+		delete(h.latest, oldest)
+	}
+	if seen {
+		return Snapshot{}, false
+	}
+	var prev Snapshot
+	var ok bool
+	for v, t := range h.latest {
+		if v < s.Version && (!ok || v > prev.Version) {
+			prev, ok = t, true
+		}
+	}
+	return prev, ok
+}
+
+// Latest returns the latest Snapshot of each version, in the order of versions
+func (h *History) Latest() []Snapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var ss []Snapshot
+	for _, s := range h.latest {
+		ss = append(ss, s)
+	}
+	sort.Slice(ss, func(i, j int) bool { return ss[i].Version < ss[j].Version })
+	return ss
+}
@@ -0,0 +1,59 @@
+package throughput
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_Window(t *testing.T) {
+	w := New(2)
+	w.Add(100)
+	if _, _, _, ok := w.Step(); ok {
+		t.Fatalf("the first step closed a window")
+	}
+	w.Step()
+	samples, _, step, ok := w.Step()
+	if !ok || step != 3 || samples != 2 {
+		t.Fatalf("unexpected window: samples=%d, step=%d, ok=%v", samples, step, ok)
+	}
+	w.Add(10)
+	w.Step()
+	w.Add(20)
+	if samples, _, step, _ := w.Step(); step != 5 || samples != 30 {
+		t.Errorf("unexpected window: samples=%d, step=%d", samples, step)
+	}
+	w.Reset()
+	w.Step()
+	w.Step()
+	if _, _, _, ok := w.Step(); !ok {
+		t.Errorf("steps not restarted after reset")
+	}
+}
+
+func Test_History(t *testing.T) {
+	h := NewHistory()
+	a := Snapshot{Version: 1, Peers: 4, Step: 11, Steps: 10, Samples: 400, Duration: time.Second}
+	if _, ok := h.Add(a); ok {
+		t.Errorf("unexpected previous version")
+	}
+	a.Step = 21
+	h.Add(a)
+	b := Snapshot{Version: 2, Peers: 8, Step: 11, Steps: 10, Samples: 800, Duration: 1500 * time.Millisecond}
+	prev, ok := h.Add(b)
+	if !ok || prev.Step != 21 {
+		t.Fatalf("unexpected previous version: %v", prev)
+	}
+	if s := b.Speedup(prev); s < 1.33 || s > 1.34 {
+		t.Errorf("unexpected speedup: %f", s)
+	}
+	if _, ok := h.Add(b); ok {
+		t.Errorf("previous version returned twice")
+	}
+	for v := 3; v < 3+maxVersions; v++ {
+		h.Add(Snapshot{Version: v})
+	}
+	ss := h.Latest()
+	if len(ss) != maxVersions || ss[0].Version != 3 {
+		t.Errorf("unexpected history: %d versions from v%d", len(ss), ss[0].Version)
+	}
+}
@@ -0,0 +1,113 @@
+// Package timeouts derives the internal timeouts from the size of the cluster and the round trip times
+// measured to other peers, since constants tuned for a few peers fail spuriously at hundreds of peers,
+// and wait for nothing with two.
+package timeouts
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+)
+
+// refSize is the cluster size the base timeouts are tuned for
+const refSize = 8
+
+// rttMargin is the number of slowest round trips waited for in each hop of a timeout
+const rttMargin = 10
+
+// maxSamples is the number of latest round trip times kept for the percentiles
+const maxSamples = 256
+
+// Base timeouts, tuned for refSize peers
+var (
+	BaseConnect   = time.Duration(config.ConnRetryCount) * config.ConnRetryPeriod // until a peer accepts connections
+	BaseHandshake = 10 * time.Second                                              // of the header and token exchange of a new connection
+)
+
+type estimator struct {
+	sync.Mutex
+	size    int
+	samples []time.Duration
+	next    int
+}
+
+var defaultEstimator = &estimator{size: refSize}
+
+// SetClusterSize sets the number of peers the timeouts are scaled to
+func SetClusterSize(n int) {
+	defaultEstimator.Lock()
+	defer defaultEstimator.Unlock()
+	defaultEstimator.size = n
+}
+
+// Observe records a round trip time to a peer
+func Observe(rtt time.Duration) {
+	defaultEstimator.Lock()
+	defer defaultEstimator.Unlock()
+	defaultEstimator.observe(rtt)
+}
+
+func (e *estimator) observe(rtt time.Duration) {
+	if len(e.samples) < maxSamples {
+		e.samples = append(e.samples, rtt)
+		return
+	}
+	e.samples[e.next] = rtt
+	e.next = (e.next + 1) % maxSamples
+}
+
+// percentile returns the p-th percentile of the samples, 0 if there is none
+func (e *estimator) percentile(p float64) time.Duration {
+	if len(e.samples) == 0 {
+		return 0
+	}
+	xs := append([]time.Duration{}, e.samples...)
+	sort.Slice(xs, func(i, j int) bool { return xs[i] < xs[j] })
+	i := int(math.Ceil(p/100*float64(len(xs)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return xs[i]
+}
+
+// hops is the number of sequential steps of reaching all n peers by a tree, at least 1
+func hops(n int) float64 {
+	if n < 2 {
+		n = 2
+	}
+	return math.Log2(float64(n))
+}
+
+// scale scales base from refSize to the cluster size, plus rttMargin round trips of the 99th percentile per hop
+func (e *estimator) scale(base time.Duration) time.Duration {
+	if !config.AdaptiveTimeouts {
+		return base
+	}
+	h := hops(e.size)
+	d := time.Duration(float64(base) * h / hops(refSize))
+	return d + time.Duration(h*rttMargin*float64(e.percentile(99)))
+}
+
+func scale(base time.Duration) time.Duration {
+	defaultEstimator.Lock()
+	defer defaultEstimator.Unlock()
+	return defaultEstimator.scale(base)
+}
+
+// Connect is the time to keep retrying to connect to a peer that doesn't accept connections yet
+func Connect() time.Duration {
+	return scale(BaseConnect)
+}
+
+// Handshake is the time to exchange the header and token of a new connection
+func Handshake() time.Duration {
+	return scale(BaseHandshake)
+}
+
+// StagePropagation is the time to wait for a runner to be up to receive a new stage
+func StagePropagation() time.Duration {
+	return scale(config.WaitRunnerTimeout)
+}
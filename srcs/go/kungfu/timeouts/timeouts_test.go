@@ -0,0 +1,45 @@
+package timeouts
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_scale(t *testing.T) {
+	base := 10 * time.Second
+	e := &estimator{size: refSize}
+	if d := e.scale(base); d != base {
+		t.Errorf("scale at %d peers = %s, want %s", refSize, d, base)
+	}
+	e.size = 2
+	small := e.scale(base)
+	e.size = 256
+	large := e.scale(base)
+	if !(small < base && base < large) {
+		t.Errorf("scale at 2, %d, 256 peers = %s, %s, %s, want increasing", refSize, small, base, large)
+	}
+	e.size = refSize
+	for i := 0; i < 100; i++ {
+		e.observe(time.Millisecond)
+	}
+	e.observe(100 * time.Millisecond)
+	if p := e.percentile(99); p != time.Millisecond {
+		t.Errorf("99th percentile = %s, want 1ms", p)
+	}
+	if d := e.scale(base); d != base+30*time.Millisecond {
+		t.Errorf("scale with 1ms RTT = %s", d)
+	}
+}
+
+func Test_observe(t *testing.T) {
+	e := &estimator{}
+	for i := 0; i < 2*maxSamples; i++ {
+		e.observe(time.Duration(i))
+	}
+	if len(e.samples) != maxSamples {
+		t.Errorf("kept %d samples, want %d", len(e.samples), maxSamples)
+	}
+	if p := e.percentile(0); p != maxSamples {
+		t.Errorf("oldest kept sample = %d, want %d", p, maxSamples)
+	}
+}
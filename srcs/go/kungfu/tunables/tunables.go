@@ -0,0 +1,156 @@
+// Package tunables defines the runtime knobs that can be changed on a live job by kungfu-ctl tune.
+package tunables
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TuneName is the name of the control message that sets tunables on peers
+const TuneName = "tune"
+
+// Names of tunables
+const (
+	ChunkSize        = "chunk-size"         // bytes of each part of an allreduce, parts are reduced concurrently
+	FusionBufferSize = "fusion-buffer-size" // bytes of a fused group of tensors, read by the framework
+	Compression      = "compression"        // whether gradients are compressed, read by the framework
+)
+
+var (
+	errUnknownTunable = errors.New("unknown tunable")
+	errInvalidValue   = errors.New("invalid value of tunable")
+)
+
+type Tunables struct {
+	ChunkSize        int  `json:"chunk-size"`
+	FusionBufferSize int  `json:"fusion-buffer-size"`
+	Compression      bool `json:"compression"`
+}
+
+func Default() Tunables {
+	return Tunables{
+		ChunkSize:        1 << 20,
+		FusionBufferSize: 64 << 20,
+	}
+}
+
+func Names() []string {
+	return []string{ChunkSize, Compression, FusionBufferSize}
+}
+
+// Get returns the value of the named tunable as an integer, 1 or 0 for booleans
+func (t Tunables) Get(name string) (int64, error) {
+	switch name {
+	case ChunkSize:
+		return int64(t.ChunkSize), nil
+	case FusionBufferSize:
+		return int64(t.FusionBufferSize), nil
+	case Compression:
+		if t.Compression {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("%v: %s", errUnknownTunable, name)
+}
+
+// Set sets the named tunable, sizes may have a suffix of Ki, Mi or Gi
+func (t *Tunables) Set(name, value string) error {
+	switch name {
+	case ChunkSize, FusionBufferSize:
+		n, err := parseSize(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("%v: %s=%s", errInvalidValue, name, value)
+		}
+		if name == ChunkSize {
+			t.ChunkSize = n
+		} else {
+			t.FusionBufferSize = n
+		}
+	case Compression:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%v: %s=%s", errInvalidValue, name, value)
+		}
+		t.Compression = v
+	default:
+		return fmt.Errorf("%v: %s", errUnknownTunable, name)
+	}
+	return nil
+}
+
+func (t Tunables) String() string {
+	return fmt.Sprintf("%s=%d,%s=%t,%s=%d", ChunkSize, t.ChunkSize, Compression, t.Compression, FusionBufferSize, t.FusionBufferSize)
+}
+
+func (t Tunables) Bytes() []byte {
+	bs, _ := json.Marshal(t)
+	return bs
+}
+
+var units = []struct {
+	suffix string
+	n      int
+}{
+	{"Gi", 1 << 30},
+	{"Mi", 1 << 20},
+	{"Ki", 1 << 10},
+}
+
+func parseSize(val string) (int, error) {
+	for _, u := range units {
+		if strings.HasSuffix(val, u.suffix) {
+			n, err := strconv.Atoi(strings.TrimSuffix(val, u.suffix))
+			return n * u.n, err
+		}
+	}
+	return strconv.Atoi(val)
+}
+
+// Update is a list of name=value assignments carried by a tune message
+type Update map[string]string
+
+// ParseUpdate parses assignments of the form name=value
+func ParseUpdate(args []string) (Update, error) {
+	u := make(Update)
+	var t Tunables
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%v: %q", errInvalidValue, arg)
+		}
+		if err := t.Set(parts[0], parts[1]); err != nil {
+			return nil, err
+		}
+		u[parts[0]] = parts[1]
+	}
+	return u, nil
+}
+
+// Apply returns a copy of t with the update applied
+func (u Update) Apply(t Tunables) (Tunables, error) {
+	var names []string
+	for name := range u {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := t.Set(name, u[name]); err != nil {
+			return t, err
+		}
+	}
+	return t, nil
+}
+
+func (u Update) Encode() []byte {
+	bs, _ := json.Marshal(u)
+	return bs
+}
+
+func (u *Update) Decode(bs []byte) error {
+	return json.Unmarshal(bs, u)
+}
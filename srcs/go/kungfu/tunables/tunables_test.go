@@ -0,0 +1,38 @@
+package tunables
+
+import "testing"
+
+func TestParseUpdate(t *testing.T) {
+	u, err := ParseUpdate([]string{"chunk-size=4Mi", "compression=true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v Update
+	if err := v.Decode(u.Encode()); err != nil {
+		t.Fatal(err)
+	}
+	x, err := v.Apply(Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.ChunkSize != 4<<20 || !x.Compression || x.FusionBufferSize != Default().FusionBufferSize {
+		t.Errorf("unexpected tunables: %s", x)
+	}
+	if n, _ := x.Get(Compression); n != 1 {
+		t.Errorf("unexpected %s: %d", Compression, n)
+	}
+}
+
+func TestParseUpdateInvalid(t *testing.T) {
+	for _, args := range [][]string{
+		{"chunk-size"},
+		{"chunk-size=0"},
+		{"chunk-size=1Ti"},
+		{"compression=yes please"},
+		{"unknown=1"},
+	} {
+		if _, err := ParseUpdate(args); err == nil {
+			t.Errorf("%q should be rejected", args)
+		}
+	}
+}
@@ -34,6 +34,17 @@ func GoKungfuResizeClusterFromURL(pChanged, pDetached *C.char) int {
 	return 0
 }
 
+//export GoKungfuMigrateRank
+func GoKungfuMigrateRank(rank int, pHost *C.char, pChanged, pDetached *C.char) int {
+	changed, detached, err := defaultPeer.MigrateRank(rank, C.GoString(pHost))
+	if err != nil {
+		utils.ExitErr(err)
+	}
+	*pChanged = boolToChar(changed)
+	*pDetached = boolToChar(detached)
+	return 0
+}
+
 //export GoKungfuProposeNewSize
 func GoKungfuProposeNewSize(newSize int) int {
 	err := defaultPeer.ProposeNewSize(newSize)
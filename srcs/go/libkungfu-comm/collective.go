@@ -1,9 +1,11 @@
 package main
 
 import (
+	"time"
 	"unsafe"
 
 	kb "github.com/lsds/KungFu/srcs/go/kungfu/base"
+	"github.com/lsds/KungFu/srcs/go/log"
 )
 
 /*
@@ -19,6 +21,17 @@ func GoKungfuBarrier(done *C.callback_t) int {
 	return callOP("Barrier", sess.Barrier, done)
 }
 
+//export GoKungfuNamedBarrier
+func GoKungfuNamedBarrier(pName *C.char, timeoutMs int) int {
+	name := C.GoString(pName)
+	sess := defaultPeer.CurrentSession()
+	if err := sess.NamedBarrier(name, time.Duration(timeoutMs)*time.Millisecond); err != nil {
+		log.Errorf("%v", err)
+		return 1
+	}
+	return 0
+}
+
 //export GoKungfuConsensus
 func GoKungfuConsensus(buf unsafe.Pointer, count int, dtype C.KungFu_Datatype, pOK *C.char, pName *C.char, done *C.callback_t) int {
 	name := C.GoString(pName)
@@ -33,12 +46,18 @@ func GoKungfuConsensus(buf unsafe.Pointer, count int, dtype C.KungFu_Datatype, p
 
 //export GoKungfuAllReduce
 func GoKungfuAllReduce(sendBuf, recvBuf unsafe.Pointer, count int, dtype C.KungFu_Datatype, op C.KungFu_Op, pName *C.char, done *C.callback_t) int {
+	return GoKungfuAllReduceOnStream(sendBuf, recvBuf, count, dtype, op, pName, nil, done)
+}
+
+//export GoKungfuAllReduceOnStream
+func GoKungfuAllReduceOnStream(sendBuf, recvBuf unsafe.Pointer, count int, dtype C.KungFu_Datatype, op C.KungFu_Op, pName *C.char, pStream *C.char, done *C.callback_t) int {
 	name := C.GoString(pName)
 	w := kb.Workspace{
 		SendBuf: toVector(sendBuf, count, dtype),
 		RecvBuf: toVector(recvBuf, count, dtype),
 		OP:      kb.OP(op),
 		Name:    name,
+		Stream:  C.GoString(pStream),
 	}
 	sess := defaultPeer.CurrentSession()
 	return callCollectiveOP("AllReduce", name, sess.AllReduce, w, done)
@@ -57,6 +76,21 @@ func GoKungfuCrossAllReduce(sendBuf, recvBuf unsafe.Pointer, count int, dtype C.
 	return callCollectiveOP("CrossAllReduce", name, sess.CrossAllReduce, w, done)
 }
 
+//export GoKungfuRoleAllReduce
+func GoKungfuRoleAllReduce(sendBuf, recvBuf unsafe.Pointer, count int, dtype C.KungFu_Datatype, op C.KungFu_Op, pName *C.char, done *C.callback_t) int {
+	name := C.GoString(pName)
+	w := kb.Workspace{
+		SendBuf: toVector(sendBuf, count, dtype),
+		RecvBuf: toVector(recvBuf, count, dtype),
+		OP:      kb.OP(op),
+		Name:    name,
+	}
+	sess := defaultPeer.CurrentSession()
+	ranks := defaultPeer.RoleRanks()
+	f := func(w kb.Workspace) error { return sess.GroupAllReduce(ranks, w) }
+	return callCollectiveOP("RoleAllReduce", name, f, w, done)
+}
+
 //export GoKungfuMonitoredAllReduce
 func GoKungfuMonitoredAllReduce(sendBuf, recvBuf unsafe.Pointer, count int, dtype C.KungFu_Datatype, op C.KungFu_Op, pTree unsafe.Pointer /* TODO: return monitoring data */, pName *C.char, done *C.callback_t) int {
 	name := C.GoString(pName)
@@ -81,24 +115,36 @@ func GoKungfuMonitoredAllReduce(sendBuf, recvBuf unsafe.Pointer, count int, dtyp
 
 //export GoKungfuAllGather
 func GoKungfuAllGather(sendBuf unsafe.Pointer, count int, dtype C.KungFu_Datatype, recvBuf unsafe.Pointer, pName *C.char, done *C.callback_t) int {
+	return GoKungfuAllGatherOnStream(sendBuf, count, dtype, recvBuf, pName, nil, done)
+}
+
+//export GoKungfuAllGatherOnStream
+func GoKungfuAllGatherOnStream(sendBuf unsafe.Pointer, count int, dtype C.KungFu_Datatype, recvBuf unsafe.Pointer, pName *C.char, pStream *C.char, done *C.callback_t) int {
 	name := C.GoString(pName)
 	sess := defaultPeer.CurrentSession()
 	w := kb.Workspace{
 		SendBuf: toVector(sendBuf, count, dtype),
 		RecvBuf: toVector(recvBuf, count*sess.Size(), dtype),
 		Name:    name,
+		Stream:  C.GoString(pStream),
 	}
 	return callCollectiveOP("AllGather", name, sess.AllGather, w, done)
 }
 
 //export GoKungfuReduce
 func GoKungfuReduce(sendBuf, recvBuf unsafe.Pointer, count int, dtype C.KungFu_Datatype, op C.KungFu_Op, pName *C.char, done *C.callback_t) int {
+	return GoKungfuReduceOnStream(sendBuf, recvBuf, count, dtype, op, pName, nil, done)
+}
+
+//export GoKungfuReduceOnStream
+func GoKungfuReduceOnStream(sendBuf, recvBuf unsafe.Pointer, count int, dtype C.KungFu_Datatype, op C.KungFu_Op, pName *C.char, pStream *C.char, done *C.callback_t) int {
 	name := C.GoString(pName)
 	w := kb.Workspace{
 		SendBuf: toVector(sendBuf, count, dtype),
 		RecvBuf: toVector(recvBuf, count, dtype),
 		OP:      kb.OP(op),
 		Name:    name,
+		Stream:  C.GoString(pStream),
 	}
 	sess := defaultPeer.CurrentSession()
 	return callCollectiveOP("Reduce", name, sess.Reduce, w, done)
@@ -106,11 +152,17 @@ func GoKungfuReduce(sendBuf, recvBuf unsafe.Pointer, count int, dtype C.KungFu_D
 
 //export GoKungfuBroadcast
 func GoKungfuBroadcast(sendBuf, recvBuf unsafe.Pointer, count int, dtype C.KungFu_Datatype, pName *C.char, done *C.callback_t) int {
+	return GoKungfuBroadcastOnStream(sendBuf, recvBuf, count, dtype, pName, nil, done)
+}
+
+//export GoKungfuBroadcastOnStream
+func GoKungfuBroadcastOnStream(sendBuf, recvBuf unsafe.Pointer, count int, dtype C.KungFu_Datatype, pName *C.char, pStream *C.char, done *C.callback_t) int {
 	name := C.GoString(pName)
 	w := kb.Workspace{
 		SendBuf: toVector(sendBuf, count, dtype),
 		RecvBuf: toVector(recvBuf, count, dtype),
 		Name:    name,
+		Stream:  C.GoString(pStream),
 	}
 	sess := defaultPeer.CurrentSession()
 	return callCollectiveOP("Broadcast", name, sess.Broadcast, w, done)
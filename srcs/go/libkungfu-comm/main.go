@@ -47,6 +47,76 @@ func GoKungfuUID() uint64 {
 	return defaultPeer.UID()
 }
 
+//export GoKungfuSeed
+func GoKungfuSeed() uint64 {
+	return defaultPeer.Seed()
+}
+
+//export GoKungfuReportDegraded
+func GoKungfuReportDegraded(pReason *C.char) int {
+	return errorCode("ReportDegraded", defaultPeer.ReportDegraded(C.GoString(pReason)))
+}
+
+//export GoKungfuCPUOnly
+func GoKungfuCPUOnly() bool {
+	return defaultPeer.CPUOnly()
+}
+
+// GoKungfuLookupOP returns the op of a built-in or custom reduction by name, -1 if not found
+//export GoKungfuLookupOP
+func GoKungfuLookupOP(pName *C.char) int {
+	op, ok := kb.LookupOP(C.GoString(pName))
+	if !ok {
+		return -1
+	}
+	return int(op)
+}
+
+//export GoKungfuStepFence
+func GoKungfuStepFence() int {
+	return errorCode("StepFence", defaultPeer.StepFence())
+}
+
+//export GoKungfuBeginStep
+func GoKungfuBeginStep() int {
+	return errorCode("BeginStep", defaultPeer.BeginStep())
+}
+
+//export GoKungfuEndStep
+func GoKungfuEndStep(pChanged, pDetached *C.char) int {
+	changed, detached, err := defaultPeer.EndStep()
+	*pChanged = boolToChar(changed)
+	*pDetached = boolToChar(detached)
+	return errorCode("EndStep", err)
+}
+
+//export GoKungfuDeclareTensor
+func GoKungfuDeclareTensor(pName *C.char, dtype C.KungFu_Datatype, pShape unsafe.Pointer, ndim int) int {
+	var shape []int
+	if ndim > 0 {
+		for _, d := range toVector(pShape, ndim, C.KungFu_INT32).AsI32() {
+			shape = append(shape, int(d))
+		}
+	}
+	return errorCode("DeclareTensor", defaultPeer.DeclareTensor(C.GoString(pName), kb.DataType(dtype), shape))
+}
+
+//export GoKungfuCheckTensorSchema
+func GoKungfuCheckTensorSchema() int {
+	return errorCode("CheckTensorSchema", defaultPeer.CheckTensorSchema())
+}
+
+//export GoKungfuRoleRank
+func GoKungfuRoleRank() int {
+	_, rank := defaultPeer.Role()
+	return rank
+}
+
+//export GoKungfuRoleSize
+func GoKungfuRoleSize() int {
+	return len(defaultPeer.RoleRanks())
+}
+
 //export GoKungfuSize
 func GoKungfuSize() int {
 	sess := defaultPeer.CurrentSession()
@@ -123,6 +193,65 @@ func GoKungfuSaveVersion(version, name *C.char, buf unsafe.Pointer, count int, d
 	return callOP("SaveVersion", op, done)
 }
 
+//export GoKungfuPSPush
+func GoKungfuPSPush(pName *C.char, buf unsafe.Pointer, count int, dtype C.KungFu_Datatype, op C.KungFu_Op) int {
+	name := C.GoString(pName)
+	return errorCode("PSPush", defaultPeer.PSPush(name, toVector(buf, count, dtype), kb.OP(op)))
+}
+
+//export GoKungfuPSPull
+func GoKungfuPSPull(pName *C.char, buf unsafe.Pointer, count int, dtype C.KungFu_Datatype, done *C.callback_t) int {
+	name := C.GoString(pName)
+	b := toVector(buf, count, dtype)
+	op := func() error { return defaultPeer.PSPull(name, b) }
+	return callOP("PSPull", op, done)
+}
+
+//export GoKungfuPSFlush
+func GoKungfuPSFlush() int {
+	return errorCode("PSFlush", defaultPeer.PSFlush())
+}
+
+//export GoKungfuPSStop
+func GoKungfuPSStop() int {
+	defaultPeer.PSStop()
+	return 0
+}
+
+//export GoKungfuServePS
+func GoKungfuServePS() int {
+	return errorCode("ServePS", defaultPeer.ServePS())
+}
+
+//export GoKungfuKVPut
+func GoKungfuKVPut(key *C.char, buf unsafe.Pointer, size int) int {
+	value := C.GoBytes(buf, C.int(size))
+	return errorCode("KVPut", defaultPeer.KVPut(C.GoString(key), value))
+}
+
+// GoKungfuKVGet copies the value into buf if it fits, and returns the size of the value, or -1 if the key doesn't exist
+//export GoKungfuKVGet
+func GoKungfuKVGet(key *C.char, buf unsafe.Pointer, capacity int) int {
+	value, ok := defaultPeer.KVGet(C.GoString(key))
+	if !ok {
+		return -1
+	}
+	if len(value) <= capacity && len(value) > 0 {
+		copy(toVector(buf, len(value), C.KungFu_UINT8).Data, value)
+	}
+	return len(value)
+}
+
+// GoKungfuGetTunable returns the value of the named tunable in effect, or -1 if the name is unknown
+//export GoKungfuGetTunable
+func GoKungfuGetTunable(name *C.char) int64 {
+	v, err := defaultPeer.Tunables().Get(C.GoString(name))
+	if err != nil {
+		return -1
+	}
+	return v
+}
+
 //export GoKungfuNoop
 func GoKungfuNoop(done *C.callback_t) int {
 	noop := func() error { return nil }
@@ -58,3 +58,23 @@ func GoPrintStategyStats() {
 	sess := defaultPeer.CurrentSession()
 	sess.PrintStategyStats()
 }
+
+//export GoKungfuAddSamples
+func GoKungfuAddSamples(n int) {
+	defaultPeer.AddSamples(n)
+}
+
+//export GoKungfuThroughput
+func GoKungfuThroughput(pCurrent, pPrevious *C.double) int {
+	// samples per second of the latest two cluster versions measured, returns how many are written
+	ss := defaultPeer.Throughputs()
+	if n := len(ss); n > 0 {
+		*pCurrent = C.double(ss[n-1].Rate())
+		if n > 1 {
+			*pPrevious = C.double(ss[n-2].Rate())
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
@@ -31,7 +31,7 @@ func parseLogLevel(val string) Level {
 	return logLevelMap[val]
 }
 
-var std = New()
+var std = newStd()
 
 const (
 	ShowTimestamp = 1 << iota
@@ -45,6 +45,7 @@ type Logger struct {
 	t0        time.Time
 	level     Level
 	flags     uint32
+	sinks     []Sink
 }
 
 func New() *Logger {
@@ -57,6 +58,18 @@ func New() *Logger {
 	return l
 }
 
+func newStd() *Logger {
+	l := New()
+	if len(config.LogSinks) > 0 {
+		sinks, err := ParseSinks(config.LogSinks)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid %s: %v\n", config.LogSinksEnvKey, err)
+		}
+		l.sinks = sinks
+	}
+	return l
+}
+
 func fmtDuration(d time.Duration) string {
 	n := int64(d / time.Second)
 
@@ -74,10 +87,11 @@ func fmtDuration(d time.Duration) string {
 	return fmt.Sprintf("%dd %02d:%02d:%02d %6.2fms", n, hh, mm, ss, float64(ns)/float64(time.Millisecond))
 }
 
-func (l *Logger) output(w io.Writer, prefix, format string, v ...interface{}) {
+func (l *Logger) output(w io.Writer, level Level, prefix, format string, v ...interface{}) {
 	l.Lock()
 	defer l.Unlock()
-	d := time.Since(l.t0)
+	now := time.Now()
+	d := now.Sub(l.t0)
 	l.buf = l.buf[:0]
 	l.buf = append(l.buf, prefix...)
 	if l.flags&ShowTimestamp != 0 {
@@ -93,11 +107,14 @@ func (l *Logger) output(w io.Writer, prefix, format string, v ...interface{}) {
 		l.buf = append(l.buf, '\n')
 	}
 	w.Write(l.buf)
+	for _, sink := range l.sinks {
+		sink.Write(Entry{Time: now, Level: level, Message: s})
+	}
 }
 
 func (l *Logger) logf(w io.Writer, level Level, prefix, format string, v ...interface{}) {
 	if level >= l.level {
-		l.output(w, prefix, format, v...)
+		l.output(w, level, prefix, format, v...)
 	}
 }
 
@@ -119,6 +136,7 @@ func (l *Logger) Errorf(format string, v ...interface{}) {
 
 func (l *Logger) Exitf(format string, v ...interface{}) {
 	l.logf(l.errWriter, Error, xterm.Warn.S("[F]"), format, v...)
+	l.CloseSinks()
 	os.Exit(1)
 }
 
@@ -129,6 +147,26 @@ func (l *Logger) SetOutput(w io.Writer) {
 	l.errWriter = w
 }
 
+// AddSink sends the log entries also to s
+func (l *Logger) AddSink(s Sink) {
+	l.Lock()
+	defer l.Unlock()
+	l.sinks = append(l.sinks, s)
+}
+
+// CloseSinks flushes and removes all sinks, it should be called before the process exits
+func (l *Logger) CloseSinks() {
+	l.Lock()
+	sinks := l.sinks
+	l.sinks = nil
+	l.Unlock()
+	for _, s := range sinks {
+		if err := s.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+	}
+}
+
 func (l *Logger) SetFlags(fs ...uint32) {
 	var flags uint32
 	for _, f := range fs {
@@ -147,4 +185,7 @@ var (
 	Exitf     = std.Exitf
 	SetFlags  = std.SetFlags
 	SetOutput = std.SetOutput
+
+	AddSink    = std.AddSink
+	CloseSinks = std.CloseSinks
 )
@@ -0,0 +1,187 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func (l Level) String() string {
+	for k, v := range logLevelMap {
+		if v == l {
+			return k
+		}
+	}
+	return ""
+}
+
+// Entry is a log message passed to sinks
+type Entry struct {
+	Time    time.Time
+	Level   Level
+	Message string
+}
+
+// Sink receives log entries in addition to the standard outputs, Write must not block
+type Sink interface {
+	Write(e Entry)
+	Close() error // flushes pending entries
+}
+
+var errInvalidSink = errors.New("invalid log sink, expect syslog://[<host>:<port>], fluentd://<host>:<port> or cloudwatch://<group>/<stream>")
+
+// OpenSink creates a Sink from its URL:
+//
+//	syslog://[<host>:<port>][?network=udp&tag=kungfu], the local syslog if host is omitted
+//	fluentd://<host>:<port>[?tag=kungfu], the forward input of fluentd
+//	cloudwatch://<group>/<stream>[?region=us-east-1], via the aws command line tool
+func OpenSink(spec string) (Sink, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	tag := q.Get("tag")
+	if len(tag) == 0 {
+		tag = "kungfu"
+	}
+	switch u.Scheme {
+	case "syslog":
+		return newSyslogSink(q.Get("network"), u.Host, tag)
+	case "fluentd":
+		if len(u.Host) == 0 {
+			return nil, errInvalidSink
+		}
+		return newFluentdSink(u.Host, tag), nil
+	case "cloudwatch":
+		stream := strings.Trim(u.Path, "/")
+		if len(u.Host) == 0 || len(stream) == 0 {
+			return nil, errInvalidSink
+		}
+		return newCloudWatchSink(u.Host, stream, q.Get("region")), nil
+	default:
+		return nil, errInvalidSink
+	}
+}
+
+// ParseSinks parses comma separated sink URLs
+func ParseSinks(val string) ([]Sink, error) {
+	var sinks []Sink
+	for _, spec := range strings.Split(val, ",") {
+		if len(spec) == 0 {
+			continue
+		}
+		s, err := OpenSink(spec)
+		if err != nil {
+			for _, s := range sinks {
+				s.Close()
+			}
+			return nil, fmt.Errorf("%s: %v", spec, err)
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, nil
+}
+
+const (
+	sinkQueueSize = 4096
+	sinkRetries   = 3
+)
+
+// batchSink queues entries and flushes them in batches, a batch is retried before it is dropped
+type batchSink struct {
+	name     string
+	mu       sync.RWMutex
+	closed   bool
+	ch       chan Entry
+	done     chan struct{}
+	maxBatch int
+	period   time.Duration
+	flush    func([]Entry) error
+	dropped  int64
+}
+
+func newBatchSink(name string, maxBatch int, period time.Duration, flush func([]Entry) error) *batchSink {
+	s := &batchSink{
+		name:     name,
+		ch:       make(chan Entry, sinkQueueSize),
+		done:     make(chan struct{}),
+		maxBatch: maxBatch,
+		period:   period,
+		flush:    flush,
+	}
+	go s.run()
+	return s
+}
+
+// Write drops the entry if the queue is full
+func (s *batchSink) Write(e Entry) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.ch <- e:
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+	}
+}
+
+func (s *batchSink) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+	s.mu.Unlock()
+	<-s.done
+	if n := atomic.LoadInt64(&s.dropped); n > 0 {
+		return fmt.Errorf("%s sink dropped %d entries", s.name, n)
+	}
+	return nil
+}
+
+func (s *batchSink) run() {
+	defer close(s.done)
+	tk := time.NewTicker(s.period)
+	defer tk.Stop()
+	var batch []Entry
+	for {
+		select {
+		case e, ok := <-s.ch:
+			if !ok {
+				s.send(batch)
+				return
+			}
+			if batch = append(batch, e); len(batch) >= s.maxBatch {
+				s.send(batch)
+				batch = nil
+			}
+		case <-tk.C:
+			s.send(batch)
+			batch = nil
+		}
+	}
+}
+
+func (s *batchSink) send(batch []Entry) {
+	if len(batch) == 0 {
+		return
+	}
+	var err error
+	for i := 0; i < sinkRetries; i++ {
+		if err = s.flush(batch); err == nil {
+			return
+		}
+		time.Sleep(time.Duration(i+1) * 100 * time.Millisecond)
+	}
+	atomic.AddInt64(&s.dropped, int64(len(batch)))
+	// don't use the logger which would send the error to the failing sink again
+	fmt.Fprintf(os.Stderr, "failed to send %d log entries to %s: %v\n", len(batch), s.name, err)
+}
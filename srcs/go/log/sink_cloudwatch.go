@@ -0,0 +1,75 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// cloudWatchSink puts entries to CloudWatch Logs with the aws command line tool
+type cloudWatchSink struct {
+	*batchSink
+	group   string
+	stream  string
+	region  string
+	created bool
+}
+
+func newCloudWatchSink(group, stream, region string) *cloudWatchSink {
+	s := &cloudWatchSink{group: group, stream: stream, region: region}
+	// PutLogEvents accepts up to 10000 events per call, and is rate limited per stream
+	s.batchSink = newBatchSink("cloudwatch", 1000, 5*time.Second, s.send)
+	return s
+}
+
+type cloudWatchEvent struct {
+	Timestamp int64  `json:"timestamp"` // milliseconds since epoch
+	Message   string `json:"message"`
+}
+
+func (s *cloudWatchSink) send(es []Entry) error {
+	if !s.created {
+		err := s.aws("create-log-stream", "--log-group-name", s.group, "--log-stream-name", s.stream)
+		if err != nil && !strings.Contains(err.Error(), "ResourceAlreadyExistsException") {
+			return err
+		}
+		s.created = true
+	}
+	var events []cloudWatchEvent
+	for _, e := range es {
+		events = append(events, cloudWatchEvent{
+			Timestamp: e.Time.UnixNano() / int64(time.Millisecond),
+			Message:   e.Level.String() + " " + e.Message,
+		})
+	}
+	f, err := ioutil.TempFile("", "kungfu-log-events-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := json.NewEncoder(f).Encode(events); err != nil {
+		f.Close()
+		return err
+	}
+	f.Close()
+	return s.aws("put-log-events", "--log-group-name", s.group, "--log-stream-name", s.stream, "--log-events", "file://"+f.Name())
+}
+
+func (s *cloudWatchSink) aws(args ...string) error {
+	args = append([]string{"logs"}, args...)
+	if len(s.region) > 0 {
+		args = append(args, "--region", s.region)
+	}
+	cmd := exec.Command("aws", args...)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("aws %s: %v %s", strings.Join(args[:2], " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
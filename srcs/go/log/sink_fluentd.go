@@ -0,0 +1,66 @@
+package log
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"time"
+)
+
+// fluentdSink sends entries to the forward input of fluentd, in the JSON form of the forward mode:
+// [tag, [[time, record], ...]]
+type fluentdSink struct {
+	*batchSink
+	addr     string
+	tag      string
+	hostname string
+	conn     net.Conn
+}
+
+func newFluentdSink(addr, tag string) *fluentdSink {
+	hostname, _ := os.Hostname()
+	s := &fluentdSink{addr: addr, tag: tag, hostname: hostname}
+	s.batchSink = newBatchSink("fluentd", 256, time.Second, s.send)
+	return s
+}
+
+type fluentdRecord struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+	Host    string `json:"host"`
+	PID     int    `json:"pid"`
+}
+
+func (s *fluentdSink) send(es []Entry) error {
+	events := make([][2]interface{}, 0, len(es))
+	for _, e := range es {
+		events = append(events, [2]interface{}{
+			e.Time.Unix(),
+			fluentdRecord{Level: e.Level.String(), Message: e.Message, Host: s.hostname, PID: os.Getpid()},
+		})
+	}
+	bs, err := json.Marshal([]interface{}{s.tag, events})
+	if err != nil {
+		return err
+	}
+	if s.conn == nil {
+		if s.conn, err = net.DialTimeout("tcp", s.addr, 5*time.Second); err != nil {
+			return err
+		}
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if _, err := s.conn.Write(bs); err != nil {
+		s.conn.Close()
+		s.conn = nil // reconnect on retry
+		return err
+	}
+	return nil
+}
+
+func (s *fluentdSink) Close() error {
+	err := s.batchSink.Close()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	return err
+}
@@ -0,0 +1,52 @@
+// +build !windows
+
+package log
+
+import (
+	"log/syslog"
+	"time"
+)
+
+type syslogSink struct {
+	*batchSink
+	w *syslog.Writer
+}
+
+func newSyslogSink(network, addr, tag string) (*syslogSink, error) {
+	if len(addr) > 0 && len(network) == 0 {
+		network = "udp"
+	}
+	w, err := syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_USER, tag)
+	if err != nil {
+		return nil, err
+	}
+	s := &syslogSink{w: w}
+	s.batchSink = newBatchSink("syslog", 64, 100*time.Millisecond, s.send)
+	return s, nil
+}
+
+func (s *syslogSink) send(es []Entry) error {
+	for _, e := range es {
+		var err error
+		switch e.Level {
+		case Debug:
+			err = s.w.Debug(e.Message)
+		case Info:
+			err = s.w.Info(e.Message)
+		case Warn:
+			err = s.w.Warning(e.Message)
+		default:
+			err = s.w.Err(e.Message)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *syslogSink) Close() error {
+	err := s.batchSink.Close()
+	s.w.Close()
+	return err
+}
@@ -0,0 +1,9 @@
+package log
+
+import "errors"
+
+var errSyslogNotSupported = errors.New("syslog is not supported on windows")
+
+func newSyslogSink(network, addr, tag string) (Sink, error) {
+	return nil, errSyslogNotSupported
+}
@@ -0,0 +1,51 @@
+package monitor
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+var families struct {
+	sync.Mutex
+	m map[plan.PeerID]int
+}
+
+// RecordFamily records the address family, 4 or 6, the connection to remote was dialed over
+func RecordFamily(remote plan.PeerID, family int) {
+	families.Lock()
+	defer families.Unlock()
+	if families.m == nil {
+		families.m = make(map[plan.PeerID]int)
+	}
+	families.m[remote] = family
+}
+
+// GetFamilies returns the address family of the last connection dialed to each remote peer
+func GetFamilies() map[string]int {
+	families.Lock()
+	defer families.Unlock()
+	if len(families.m) == 0 {
+		return nil
+	}
+	m := make(map[string]int, len(families.m))
+	for p, f := range families.m {
+		m[p.String()] = f
+	}
+	return m
+}
+
+func writeFamiliesTo(w io.Writer) {
+	m := GetFamilies()
+	var peers []string
+	for p := range m {
+		peers = append(peers, p)
+	}
+	sort.Strings(peers)
+	for _, p := range peers {
+		fmt.Fprintf(w, "dial_address_family{peer=\"%s\"} %d\n", p, m[p])
+	}
+}
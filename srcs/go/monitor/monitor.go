@@ -95,6 +95,9 @@ func (m *netMetrics) GetEgressRates(addrs []plan.NetAddr) []float64 {
 func (m *netMetrics) WriteTo(w io.Writer) {
 	m.egressCounters.WriteTo(w)
 	m.ingressCounters.WriteTo(w)
+	writeTransitionsTo(w)
+	writeQueueGaugesTo(w)
+	writeFamiliesTo(w)
 }
 
 func (m *netMetrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
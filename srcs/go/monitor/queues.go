@@ -0,0 +1,61 @@
+package monitor
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+// QueueAlertName is the control message sent by a peer to its runner, when a send queue exceeds the thresholds for a sustained period
+const QueueAlertName = "queue-alert"
+
+// QueueAlert is a send queue of a peer to a remote peer that may stall the job
+type QueueAlert struct {
+	Peer      plan.PeerID // the sender
+	Remote    plan.PeerID
+	Type      string
+	Depth     int
+	OldestAge time.Duration
+	Since     time.Time // the thresholds have been exceeded since
+}
+
+func (a QueueAlert) String() string {
+	return fmt.Sprintf("send queue of %s to %s (%s) has %d messages, the oldest queued %s ago, since %s", a.Peer, a.Remote, a.Type, a.Depth, a.OldestAge, a.Since.Format(time.RFC3339))
+}
+
+// QueueGauge is a send queue exported as metrics
+type QueueGauge struct {
+	Remote    plan.PeerID
+	Type      string
+	Depth     int
+	OldestAge time.Duration
+}
+
+var queueGauges struct {
+	sync.Mutex
+	f func() []QueueGauge
+}
+
+// SetQueueGauges sets the function sampling the send queues when metrics are scraped
+func SetQueueGauges(f func() []QueueGauge) {
+	queueGauges.Lock()
+	defer queueGauges.Unlock()
+	queueGauges.f = f
+}
+
+func writeQueueGaugesTo(w io.Writer) {
+	queueGauges.Lock()
+	f := queueGauges.f
+	queueGauges.Unlock()
+	if f == nil {
+		return
+	}
+	for _, g := range f() {
+		labels := fmt.Sprintf(`{peer="%s",type="%s"}`, g.Remote, g.Type)
+		fmt.Fprintf(w, "send_queue_depth%s %d\n", labels, g.Depth)
+		fmt.Fprintf(w, "send_queue_oldest_age_seconds%s %f\n", labels, g.OldestAge.Seconds())
+	}
+}
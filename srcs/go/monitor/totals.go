@@ -0,0 +1,43 @@
+package monitor
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Totals are process-wide counters which are always enabled
+type Totals struct {
+	EgressBytes    int64
+	Collectives    int64
+	CollectiveTime time.Duration
+}
+
+var totals Totals
+
+func AddEgress(n int64) {
+	atomic.AddInt64(&totals.EgressBytes, n)
+}
+
+func AddCollective(d time.Duration) {
+	atomic.AddInt64(&totals.Collectives, 1)
+	atomic.AddInt64((*int64)(&totals.CollectiveTime), int64(d))
+	endTransition()
+}
+
+func GetTotals() Totals {
+	return Totals{
+		EgressBytes:    atomic.LoadInt64(&totals.EgressBytes),
+		Collectives:    atomic.LoadInt64(&totals.Collectives),
+		CollectiveTime: time.Duration(atomic.LoadInt64((*int64)(&totals.CollectiveTime))),
+	}
+}
+
+// Report is saved by a peer on exit, for its runner to summarize
+type Report struct {
+	Totals
+	Started  time.Time // when the peer was ready to work, excluding the time to spawn and initialize the process
+	Finished time.Time
+
+	Transitions []Transition   `json:",omitempty"`
+	Families    map[string]int `json:",omitempty"` // address family each remote peer was dialed over, see RecordFamily
+}
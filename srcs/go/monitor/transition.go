@@ -0,0 +1,113 @@
+package monitor
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/log"
+)
+
+// Transition is the timeline of a resize observed by a peer, durations are since the resize was proposed
+type Transition struct {
+	Version  int
+	From     int // cluster size before the resize
+	To       int
+	Proposed time.Time
+
+	Acked           time.Duration // all runners were notified of the new cluster
+	Ready           time.Duration // the session of the new cluster was established
+	FirstCollective time.Duration // the first collective in the new cluster finished, end of the resize
+}
+
+func (t Transition) String() string {
+	return fmt.Sprintf("v%d %d -> %d peers, took %s (acked: %s, ready: %s)", t.Version, t.From, t.To, t.FirstCollective, t.Acked, t.Ready)
+}
+
+var transitions struct {
+	sync.Mutex
+	pending    *Transition
+	done       []Transition
+	violations int
+}
+
+var transitionReady int32 // checked by AddCollective without locking, collectives before the session is ready don't count
+
+// BeginTransition starts to time the resize to the given version
+func BeginTransition(version, from, to int) {
+	transitions.Lock()
+	defer transitions.Unlock()
+	transitions.pending = &Transition{Version: version, From: from, To: to, Proposed: time.Now()}
+}
+
+// TransitionAcked marks that all runners were notified of the pending resize
+func TransitionAcked() {
+	transitions.Lock()
+	defer transitions.Unlock()
+	if t := transitions.pending; t != nil {
+		t.Acked = time.Since(t.Proposed)
+	}
+}
+
+// TransitionReady marks that the session of the pending resize was established
+func TransitionReady() {
+	transitions.Lock()
+	defer transitions.Unlock()
+	if t := transitions.pending; t != nil {
+		t.Ready = time.Since(t.Proposed)
+		atomic.StoreInt32(&transitionReady, 1)
+	}
+}
+
+// AbortTransition drops the pending resize, e.g. the peer left the cluster
+func AbortTransition() {
+	transitions.Lock()
+	defer transitions.Unlock()
+	transitions.pending = nil
+	atomic.StoreInt32(&transitionReady, 0)
+}
+
+func endTransition() {
+	if atomic.LoadInt32(&transitionReady) == 0 {
+		return
+	}
+	transitions.Lock()
+	defer transitions.Unlock()
+	t := transitions.pending
+	if t == nil {
+		return
+	}
+	t.FirstCollective = time.Since(t.Proposed)
+	transitions.pending = nil
+	atomic.StoreInt32(&transitionReady, 0)
+	transitions.done = append(transitions.done, *t)
+	if config.ResizeSLO > 0 && t.FirstCollective > config.ResizeSLO {
+		transitions.violations++
+		log.Warnf("resize exceeded SLO %s: %s", config.ResizeSLO, t)
+	} else {
+		log.Debugf("resize finished: %s", t)
+	}
+}
+
+// GetTransitions returns the finished resizes
+func GetTransitions() []Transition {
+	transitions.Lock()
+	defer transitions.Unlock()
+	return append([]Transition(nil), transitions.done...)
+}
+
+func writeTransitionsTo(w io.Writer) {
+	transitions.Lock()
+	defer transitions.Unlock()
+	fmt.Fprintf(w, "resize_count %d\n", len(transitions.done))
+	fmt.Fprintf(w, "resize_slo_violations %d\n", transitions.violations)
+	if n := len(transitions.done); n > 0 {
+		t := transitions.done[n-1]
+		fmt.Fprintf(w, "resize_last_seconds{phase=\"acked\"} %f\n", t.Acked.Seconds())
+		fmt.Fprintf(w, "resize_last_seconds{phase=\"ready\"} %f\n", t.Ready.Seconds())
+		fmt.Fprintf(w, "resize_last_seconds{phase=\"first_collective\"} %f\n", t.FirstCollective.Seconds())
+	}
+}
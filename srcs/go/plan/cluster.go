@@ -89,6 +89,47 @@ func (c *Cluster) growOne() error {
 			ipv4 = r.IPv4
 		}
 	}
+	newWorker := PeerID{IPv4: ipv4, Port: c.nextPort(ipv4)}
+	c.Workers = append(c.Workers, newWorker)
+	return nil
+}
+
+// growWithin adds a worker to the least loaded of the hosts which has a runner and a free slot,
+// in the group of hosts of the same value of the spreadAcross label which has the least workers.
+func (c *Cluster) growWithin(hosts HostList, spreadAcross string) error {
+	used := make(map[uint32]int)
+	for _, w := range c.Workers {
+		used[w.IPv4]++
+	}
+	groups := make(map[string]int)
+	for _, h := range hosts {
+		groups[h.Labels[spreadAcross]] += used[h.IPv4]
+	}
+	best := -1
+	for i, h := range hosts {
+		if len(c.Runners.On(h.IPv4)) == 0 || used[h.IPv4] >= h.Slots {
+			continue
+		}
+		if best < 0 {
+			best = i
+			continue
+		}
+		b := hosts[best]
+		g, gb := groups[h.Labels[spreadAcross]], groups[b.Labels[spreadAcross]]
+		if g < gb || g == gb && used[h.IPv4] < used[b.IPv4] {
+			best = i
+		}
+	}
+	if best < 0 {
+		return ErrNoEnoughCapacity
+	}
+	ipv4 := hosts[best].IPv4
+	c.Workers = append(c.Workers, PeerID{IPv4: ipv4, Port: c.nextPort(ipv4)})
+	return nil
+}
+
+// nextPort returns an unused worker port on the given host
+func (c *Cluster) nextPort(ipv4 uint32) uint16 {
 	var port uint16
 	for _, w := range c.Workers {
 		if w.IPv4 == ipv4 && port <= w.Port {
@@ -98,9 +139,78 @@ func (c *Cluster) growOne() error {
 	if port == 0 {
 		port = DefaultPortRange.Begin
 	}
-	newWorker := PeerID{IPv4: ipv4, Port: port}
-	c.Workers = append(c.Workers, newWorker)
-	return nil
+	return port
+}
+
+var (
+	errInvalidRank       = errors.New("invalid rank")
+	errNoRunnerOnHost    = errors.New("no runner on host")
+	errMigrateToSameHost = errors.New("worker is already on host")
+	errRestartAll        = errors.New("can't restart all workers at once")
+)
+
+// Migrate replaces the worker of given rank by a new worker on the host ipv4
+func (c Cluster) Migrate(rank int, ipv4 uint32) (*Cluster, error) {
+	if rank < 0 || len(c.Workers) <= rank {
+		return nil, errInvalidRank
+	}
+	if c.Workers[rank].IPv4 == ipv4 {
+		return nil, errMigrateToSameHost
+	}
+	if len(c.Runners.On(ipv4)) == 0 {
+		return nil, errNoRunnerOnHost
+	}
+	d := c.Clone()
+	d.Workers[rank] = PeerID{IPv4: ipv4, Port: d.nextPort(ipv4)}
+	return &d, nil
+}
+
+// Restart replaces the workers of given ranks by new workers on the same hosts, for a rolling restart.
+// If the root is replaced, workers are rotated so that the first kept worker becomes the root, since state is synchronised from the root.
+func (c Cluster) Restart(ranks []int) (*Cluster, error) {
+	d := c.Clone()
+	restarted := make(map[int]bool)
+	for _, rank := range ranks {
+		if rank < 0 || len(c.Workers) <= rank {
+			return nil, errInvalidRank
+		}
+		restarted[rank] = true
+	}
+	if len(restarted) >= len(c.Workers) {
+		return nil, errRestartAll
+	}
+	for rank := range d.Workers {
+		if restarted[rank] {
+			ipv4 := d.Workers[rank].IPv4
+			d.Workers[rank] = PeerID{IPv4: ipv4, Port: d.nextPort(ipv4)}
+		}
+	}
+	if restarted[0] {
+		i := 0
+		for restarted[i] {
+			i++
+		}
+		d.Workers = append(d.Workers[i:], d.Workers[:i]...)
+	}
+	return &d, nil
+}
+
+// ResizeWithin is Resize placing the new workers on the hosts of hl satisfying the constraints, as HostList.Place does
+func (c Cluster) ResizeWithin(newSize int, hl HostList, cons Constraints) (*Cluster, error) {
+	if cons.IsEmpty() {
+		return c.Resize(newSize)
+	}
+	d := c.Clone()
+	if len(d.Workers) > newSize {
+		d.Workers = d.Workers[:newSize]
+	}
+	hosts := hl.Filter(cons.Require)
+	for i := len(d.Workers); i < newSize; i++ {
+		if err := d.growWithin(hosts, cons.SpreadAcross); err != nil {
+			return nil, err
+		}
+	}
+	return &d, nil
 }
 
 func (c Cluster) Resize(newSize int) (*Cluster, error) {
@@ -20,3 +20,82 @@ func Test_Resize(t *testing.T) {
 		t.Errorf("invalid resize")
 	}
 }
+
+func Test_ResizeWithin(t *testing.T) {
+	hl := fakeHosts(4)
+	for i := range hl {
+		hl[i].Labels = Labels{`zone`: string('a' + rune(i/2)), `gpu`: `a100`}
+	}
+	hl[3].Labels[`gpu`] = `v100`
+	pl, _ := hl.Place(2, DefaultPortRange, Constraints{})
+	c := Cluster{Runners: hl.GenRunnerList(DefaultRunnerPort), Workers: pl} // both on hl[0] of zone a
+	d, err := c.ResizeWithin(4, hl, Constraints{SpreadAcross: `zone`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(d.Workers.On(hl[2].IPv4)) + len(d.Workers.On(hl[3].IPv4)); n != 2 {
+		t.Errorf("expect %d new workers in zone b, got %d: %s", 2, n, d.Workers)
+	}
+	d, err = c.ResizeWithin(12, hl, Constraints{Require: Labels{`gpu`: `a100`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(d.Workers.On(hl[3].IPv4)); n != 0 {
+		t.Errorf("expect %d workers on a host without the required labels, got %d", 0, n)
+	}
+	if _, err := c.ResizeWithin(13, hl, Constraints{Require: Labels{`gpu`: `a100`}}); err != ErrNoEnoughCapacity {
+		t.Errorf("expect %v, got %v", ErrNoEnoughCapacity, err)
+	}
+}
+
+func Test_Migrate(t *testing.T) {
+	r1 := PeerID{IPv4: 1, Port: 31300}
+	r2 := PeerID{IPv4: 2, Port: 31200}
+
+	w1 := PeerID{IPv4: 1, Port: 100}
+	w2 := PeerID{IPv4: 1, Port: 101}
+	w3 := PeerID{IPv4: 2, Port: 100}
+	c := Cluster{
+		Runners: PeerList{r1, r2},
+		Workers: PeerList{w1, w2, w3},
+	}
+
+	d, err := c.Migrate(1, 2)
+	if err != nil || !(d.Workers[1] == PeerID{IPv4: 2, Port: 101}) || d.Workers[0] != w1 || d.Workers[2] != w3 {
+		t.Errorf("invalid migrate")
+	}
+	if _, err := c.Migrate(1, 3); err == nil {
+		t.Errorf("migrate to host without runner should fail")
+	}
+	if _, err := c.Migrate(0, 1); err == nil {
+		t.Errorf("migrate to the same host should fail")
+	}
+}
+
+func Test_Restart(t *testing.T) {
+	r1 := PeerID{IPv4: 1, Port: 31300}
+	r2 := PeerID{IPv4: 2, Port: 31200}
+
+	w1 := PeerID{IPv4: 1, Port: 100}
+	w2 := PeerID{IPv4: 1, Port: 101}
+	w3 := PeerID{IPv4: 2, Port: 100}
+	c := Cluster{
+		Runners: PeerList{r1, r2},
+		Workers: PeerList{w1, w2, w3},
+	}
+
+	d, err := c.Restart([]int{1, 2})
+	if err != nil || !d.Workers.Eq(PeerList{w1, {IPv4: 1, Port: 102}, {IPv4: 2, Port: 101}}) {
+		t.Errorf("invalid restart: %s", d.Workers)
+	}
+	d, err = c.Restart([]int{0})
+	if err != nil || !d.Workers.Eq(PeerList{w2, w3, {IPv4: 1, Port: 102}}) {
+		t.Errorf("invalid restart of root: %s", d.Workers)
+	}
+	if _, err := c.Restart([]int{0, 1, 2}); err == nil {
+		t.Errorf("restart of all workers should fail")
+	}
+	if _, err := c.Restart([]int{3}); err == nil {
+		t.Errorf("restart of invalid rank should fail")
+	}
+}
@@ -0,0 +1,43 @@
+package plan
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DegradedPolicy decides what happens to a worker which reports its GPU unavailable, e.g. after an Xid error or ECC fault
+type DegradedPolicy string
+
+const (
+	DegradedEvict DegradedPolicy = `evict` // the worker is killed and removed from the cluster, in watch mode
+	DegradedCPU   DegradedPolicy = `cpu`   // the worker continues, all workers switch to CPU collectives while it is in the cluster
+)
+
+var DegradedPolicies = []DegradedPolicy{
+	DegradedEvict,
+	DegradedCPU,
+}
+
+var errInvalidDegradedPolicy = errors.New("invalid degraded policy")
+
+func (p *DegradedPolicy) Set(val string) error {
+	for _, q := range DegradedPolicies {
+		if string(q) == val {
+			*p = q
+			return nil
+		}
+	}
+	return fmt.Errorf("%v: %q", errInvalidDegradedPolicy, val)
+}
+
+func (p DegradedPolicy) String() string {
+	return string(p)
+}
+
+func DegradedPolicyNames() []string {
+	var names []string
+	for _, p := range DegradedPolicies {
+		names = append(names, string(p))
+	}
+	return names
+}
@@ -0,0 +1,141 @@
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EvictionPolicy decides which workers are removed first when the cluster shrinks
+type EvictionPolicy string
+
+const (
+	EvictHighestRank EvictionPolicy = `rank`        // workers of higher ranks first
+	EvictSlowest     EvictionPolicy = `slowest`     // workers of higher latency first
+	EvictExpensive   EvictionPolicy = `cost`        // workers on hosts of higher cost=<number> label first
+	EvictPreemptible EvictionPolicy = `preemptible` // workers on hosts labeled preemptible=true first
+	EvictLoaded      EvictionPolicy = `load`        // workers on hosts of higher load reported by runners first
+)
+
+var EvictionPolicies = []EvictionPolicy{
+	EvictHighestRank,
+	EvictSlowest,
+	EvictExpensive,
+	EvictPreemptible,
+	EvictLoaded,
+}
+
+var errInvalidEvictionPolicy = errors.New("invalid eviction policy")
+
+func (p *EvictionPolicy) Set(val string) error {
+	for _, q := range EvictionPolicies {
+		if string(q) == val {
+			*p = q
+			return nil
+		}
+	}
+	return fmt.Errorf("%v: %q", errInvalidEvictionPolicy, val)
+}
+
+func (p EvictionPolicy) String() string {
+	return string(p)
+}
+
+func EvictionPolicyNames() []string {
+	var names []string
+	for _, p := range EvictionPolicies {
+		names = append(names, string(p))
+	}
+	return names
+}
+
+// Eviction is a worker chosen to be removed
+type Eviction struct {
+	Peer   PeerID
+	Rank   int
+	Reason string
+}
+
+// Evict chooses k workers to remove from pl, the remaining workers keep their order.
+// The root is never chosen, so that the state is kept. Ties are broken by removing higher ranks first.
+// Latencies are only used by EvictSlowest, workers missing from latencies are taken as unreachable.
+func (p EvictionPolicy) Evict(pl PeerList, k int, hl HostList, latencies map[PeerID]time.Duration) (PeerList, []Eviction) {
+	if k <= 0 {
+		return pl.Clone(), nil
+	}
+	type candidate struct {
+		rank   int
+		score  float64
+		reason string
+	}
+	var cs []candidate
+	for rank := 1; rank < len(pl); rank++ {
+		score, reason := p.score(pl[rank], hl, latencies)
+		cs = append(cs, candidate{rank: rank, score: score, reason: reason})
+	}
+	sort.SliceStable(cs, func(i, j int) bool {
+		if cs[i].score != cs[j].score {
+			return cs[i].score > cs[j].score
+		}
+		return cs[i].rank > cs[j].rank
+	})
+	if k > len(cs) {
+		k = len(cs)
+	}
+	evicted := make(map[int]bool)
+	var es []Eviction
+	for _, c := range cs[:k] {
+		evicted[c.rank] = true
+		es = append(es, Eviction{Peer: pl[c.rank], Rank: c.rank, Reason: c.reason})
+	}
+	var kept PeerList
+	for rank, id := range pl {
+		if !evicted[rank] {
+			kept = append(kept, id)
+		}
+	}
+	return kept, es
+}
+
+func (p EvictionPolicy) score(id PeerID, hl HostList, latencies map[PeerID]time.Duration) (float64, string) {
+	switch p {
+	case EvictSlowest:
+		if d, ok := latencies[id]; ok {
+			return float64(d), fmt.Sprintf("latency %s", d)
+		}
+		return math.MaxFloat64, "unreachable"
+	case EvictExpensive:
+		val := hostLabel(hl, id.IPv4, "cost")
+		cost, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return 0, "cost unknown"
+		}
+		return cost, fmt.Sprintf("cost %s", val)
+	case EvictPreemptible:
+		if strings.ToLower(hostLabel(hl, id.IPv4, "preemptible")) == "true" {
+			return 1, "preemptible host"
+		}
+		return 0, "highest rank"
+	case EvictLoaded:
+		if h, ok := hl.lookup(id.IPv4); ok {
+			if r, ok := h.Fresh(); ok {
+				return r.LoadPerCPU(), fmt.Sprintf("load %.2f per CPU", r.LoadPerCPU())
+			}
+		}
+		return 0, "load unknown"
+	}
+	return 0, "highest rank"
+}
+
+func hostLabel(hl HostList, ipv4 uint32, key string) string {
+	for _, h := range hl {
+		if h.IPv4 == ipv4 {
+			return h.Labels[key]
+		}
+	}
+	return ""
+}
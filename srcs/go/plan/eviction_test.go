@@ -0,0 +1,38 @@
+package plan
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_Evict(t *testing.T) {
+	hl := HostList{
+		{IPv4: 1, Slots: 2, Labels: Labels{`cost`: `1.5`}},
+		{IPv4: 2, Slots: 2, Labels: Labels{`cost`: `3`, `preemptible`: `true`}},
+	}
+	w0 := PeerID{IPv4: 1, Port: 100}
+	w1 := PeerID{IPv4: 2, Port: 100}
+	w2 := PeerID{IPv4: 1, Port: 101}
+	w3 := PeerID{IPv4: 2, Port: 101}
+	pl := PeerList{w0, w1, w2, w3}
+	latencies := map[PeerID]time.Duration{w1: 2 * time.Millisecond, w2: 5 * time.Millisecond}
+	cases := []struct {
+		policy EvictionPolicy
+		k      int
+		want   PeerList
+	}{
+		{EvictHighestRank, 2, PeerList{w0, w1}},
+		{EvictSlowest, 1, PeerList{w0, w1, w2}}, // w3 is unreachable
+		{EvictSlowest, 2, PeerList{w0, w1}},
+		{EvictExpensive, 2, PeerList{w0, w2}},
+		{EvictPreemptible, 1, PeerList{w0, w1, w2}},
+		{EvictPreemptible, 3, PeerList{w0}},
+		{EvictHighestRank, 4, PeerList{w0}}, // the root is kept
+	}
+	for _, c := range cases {
+		got, es := c.policy.Evict(pl, c.k, hl, latencies)
+		if !got.Eq(c.want) || len(es) != len(pl)-len(c.want) {
+			t.Errorf("%s evicting %d: got %s, want %s", c.policy, c.k, got, c.want)
+		}
+	}
+}
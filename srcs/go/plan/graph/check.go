@@ -0,0 +1,87 @@
+package graph
+
+import "fmt"
+
+// CheckBcast returns the problems of g as a broadcast graph: it must be a tree spanning all vertices,
+// without self-edges, and no vertex sends to more than maxDegree others (unbounded if maxDegree <= 0).
+func (g Graph) CheckBcast(maxDegree int) []error {
+	return g.checkTree(`broadcast`, maxDegree, func(n Node) ([]int, []int) { return n.Prevs, n.Nexts }, false)
+}
+
+// CheckReduce returns the problems of g as a reduce graph: its reverse must be a tree spanning all vertices,
+// every vertex must contribute by a self-edge, and no vertex receives from more than maxDegree others.
+func (g Graph) CheckReduce(maxDegree int) []error {
+	return g.checkTree(`reduce`, maxDegree, func(n Node) ([]int, []int) { return n.Nexts, n.Prevs }, true)
+}
+
+// checkTree checks that g is a tree rooted at the vertex without parent, where children are given by the edges
+// returned by dir, and that vertices have self-edges iff selfLoop.
+func (g Graph) checkTree(kind string, maxDegree int, dir func(Node) (parents, children []int), selfLoop bool) []error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s graph: %s", kind, fmt.Sprintf(format, args...)))
+	}
+	n := len(g.Nodes)
+	if n == 0 {
+		fail("no vertices")
+		return errs
+	}
+	var roots []int
+	for i, node := range g.Nodes {
+		parents, children := dir(node)
+		switch {
+		case node.SelfLoop && !selfLoop:
+			fail("self-edge at %d", i)
+		case !node.SelfLoop && selfLoop:
+			fail("%d doesn't contribute, it has no self-edge", i)
+		}
+		for _, j := range children {
+			if j == i {
+				fail("self-edge at %d", i)
+			}
+			if j < 0 || j >= n {
+				fail("edge of %d to %d out of range", i, j)
+			}
+		}
+		switch len(parents) {
+		case 0:
+			roots = append(roots, i)
+		case 1:
+		default:
+			fail("%d has %d parents %v", i, len(parents), parents)
+		}
+		if maxDegree > 0 && len(children) > maxDegree {
+			fail("%d has degree %d > %d", i, len(children), maxDegree)
+		}
+	}
+	if len(roots) != 1 {
+		fail("not connected, roots: %v", roots)
+	}
+	if len(roots) == 0 {
+		return errs
+	}
+	visited := make([]bool, n)
+	queue := []int{roots[0]}
+	visited[roots[0]] = true
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		_, children := dir(g.Nodes[i])
+		for _, j := range children {
+			if j >= 0 && j < n && !visited[j] {
+				visited[j] = true
+				queue = append(queue, j)
+			}
+		}
+	}
+	var uncovered []int
+	for i, ok := range visited {
+		if !ok {
+			uncovered = append(uncovered, i)
+		}
+	}
+	if len(uncovered) > 0 {
+		fail("peers %v not covered from root %d", uncovered, roots[0])
+	}
+	return errs
+}
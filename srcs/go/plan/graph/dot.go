@@ -0,0 +1,26 @@
+package graph
+
+import (
+	"fmt"
+	"io"
+)
+
+// WriteDot writes g as a subgraph named name in the DOT language, with vertices prefixed by name,
+// self-edges are drawn as double circles.
+func (g Graph) WriteDot(w io.Writer, name string) {
+	fmt.Fprintf(w, "  subgraph \"cluster_%s\" {\n", name)
+	fmt.Fprintf(w, "    label=%q;\n", name)
+	for i, n := range g.Nodes {
+		shape := `circle`
+		if n.SelfLoop {
+			shape = `doublecircle`
+		}
+		fmt.Fprintf(w, "    \"%s/%d\" [label=\"%d\", shape=%s];\n", name, i, i, shape)
+	}
+	for i, n := range g.Nodes {
+		for _, j := range n.Nexts {
+			fmt.Fprintf(w, "    \"%s/%d\" -> \"%s/%d\";\n", name, i, name, j)
+		}
+	}
+	fmt.Fprintf(w, "  }\n")
+}
@@ -29,3 +29,22 @@ func Test_FromForestArrayI32(t *testing.T) {
 		assert.True(m == 0)
 	}
 }
+
+func Test_Check(t *testing.T) {
+	{
+		bg, _, _ := FromForestArray([]int{0, 0, 0, 1})
+		assert.True(len(bg.CheckBcast(0)) == 0)
+		assert.True(len(bg.CheckBcast(1)) == 1)
+		rg := bg.Reverse()
+		assert.True(len(rg.CheckReduce(0)) == 4) // no self-edges
+		for i := range rg.Nodes {
+			rg.AddEdge(i, i)
+		}
+		assert.True(len(rg.CheckReduce(0)) == 0)
+		assert.True(len(rg.CheckBcast(0)) > 0)
+	}
+	{
+		bg, _, _ := FromForestArray([]int{0, 0, 2, 2})
+		assert.True(len(bg.CheckBcast(0)) == 2) // two roots, 2 and 3 not covered
+	}
+}
@@ -0,0 +1,57 @@
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// HostAddrs are the public addresses of hosts by their IPv4, a public address may be a name resolving to IPv6 addresses
+type HostAddrs map[uint32]string
+
+// PublicAddrs returns the public addresses of the hosts which are not their IPv4
+func (hl HostList) PublicAddrs() HostAddrs {
+	addrs := make(HostAddrs)
+	for _, h := range hl {
+		if len(h.PublicAddr) > 0 && h.PublicAddr != FormatIPv4(h.IPv4) {
+			addrs[h.IPv4] = h.PublicAddr
+		}
+	}
+	return addrs
+}
+
+// String formats the addresses as comma separated <IPv4>=<public addr>, sorted by IPv4
+func (a HostAddrs) String() string {
+	var ids []uint32
+	for id := range a {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var parts []string
+	for _, id := range ids {
+		parts = append(parts, FormatIPv4(id)+"="+a[id])
+	}
+	return strings.Join(parts, ",")
+}
+
+var errInvalidHostAddrs = errors.New("invalid host addresses")
+
+func ParseHostAddrs(val string) (HostAddrs, error) {
+	addrs := make(HostAddrs)
+	if len(val) == 0 {
+		return addrs, nil
+	}
+	for _, part := range strings.Split(val, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || len(kv[1]) == 0 {
+			return nil, fmt.Errorf("%v: %q", errInvalidHostAddrs, part)
+		}
+		ipv4, err := ParseIPv4(kv[0])
+		if err != nil {
+			return nil, fmt.Errorf("%v: %q", errInvalidHostAddrs, part)
+		}
+		addrs[ipv4] = kv[1]
+	}
+	return addrs, nil
+}
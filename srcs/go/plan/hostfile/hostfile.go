@@ -6,28 +6,34 @@ import (
 	"io/ioutil"
 	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/utils"
 )
 
 // ParseFile parses -hostfile: https://www.open-mpi.org/doc/current/man1/mpirun.1.php
+// <key>=<value> pairs other than slots, public_addr, ssh_proxy and runner_port are labels of the host.
 func ParseFile(filename string) (plan.HostList, error) {
 	bs, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
-	return Parse(string(bs))
+	hl, err := Parse(string(bs))
+	if err != nil {
+		return nil, fmt.Errorf("%s:%v", filename, err)
+	}
+	return hl, nil
 }
 
 func Parse(text string) (plan.HostList, error) {
 	var hl plan.HostList
-	for _, line := range strings.Split(text, "\n") {
+	for i, line := range strings.Split(text, "\n") {
 		line := trimComment(line)
-		line = strings.TrimSpace(line)
-		if len(line) <= 0 || strings.HasPrefix(line, "#") {
+		if len(strings.TrimSpace(line)) <= 0 {
 			continue
 		}
-		h, err := parseLine(line)
+		h, err := parseLine(i+1, line)
 		if err != nil {
 			return nil, err
 		}
@@ -38,41 +44,93 @@ func Parse(text string) (plan.HostList, error) {
 
 var errInvalidHostfile = errors.New("invalid hostfile")
 
-func parseLine(line string) (*plan.HostSpec, error) {
-	parts := strings.Split(line, " ")
-	if len(parts) < 1 {
-		return nil, errInvalidHostfile
+// reservedKeys are the keys of a host which are not labels
+var reservedKeys = []string{`slots`, `public_addr`, `ssh_proxy`, `runner_port`}
+
+// posError is an error at a line and a column of a hostfile
+type posError struct {
+	line, col int
+	msg       string
+}
+
+func (e *posError) Error() string {
+	return fmt.Sprintf("%d:%d: %v: %s", e.line, e.col, errInvalidHostfile, e.msg)
+}
+
+// field is a space separated field of a line, col is its 1-based column
+type field struct {
+	s   string
+	col int
+}
+
+func fields(line string) []field {
+	var fs []field
+	start := -1
+	for i, c := range line + " " {
+		if unicode.IsSpace(c) {
+			if start >= 0 {
+				fs = append(fs, field{s: line[start:i], col: start + 1})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
 	}
-	ipv4, err := plan.ParseIPv4(parts[0])
+	return fs
+}
+
+func parseLine(lineno int, line string) (*plan.HostSpec, error) {
+	parts := fields(line)
+	ipv4, err := plan.ParseIPv4(parts[0].s)
 	if err != nil {
-		return nil, fmt.Errorf("%v: %q", err, parts[0])
+		return nil, &posError{lineno, parts[0].col, fmt.Sprintf("%v: %q", err, parts[0].s)}
 	}
 	slots := 1
 	pubAddr := plan.FormatIPv4(ipv4)
-	for _, kv := range parts[1:] {
-		kvs := strings.Split(kv, "=")
-		if len(kvs) != 2 {
-			return nil, errInvalidHostfile
+	var sshProxy string
+	var runnerPort uint16
+	labels := make(plan.Labels)
+	for _, f := range parts[1:] {
+		kvs := strings.Split(f.s, "=")
+		if len(kvs) != 2 || len(kvs[0]) == 0 {
+			return nil, &posError{lineno, f.col, fmt.Sprintf("%q is not <key>=<value>", f.s)}
 		}
 		k, v := kvs[0], kvs[1]
 		switch k {
 		case `slots`:
 			n, err := strconv.Atoi(v)
 			if err != nil {
-				return nil, errInvalidHostfile
+				return nil, &posError{lineno, f.col + len(k) + 1, fmt.Sprintf("invalid slots %q", v)}
 			}
 			slots = n
 		case `public_addr`:
 			pubAddr = v
+		case `ssh_proxy`:
+			sshProxy = v
+		case `runner_port`:
+			port, err := strconv.ParseUint(v, 10, 16)
+			if err != nil || port == 0 {
+				return nil, &posError{lineno, f.col + len(k) + 1, fmt.Sprintf("invalid runner_port %q", v)}
+			}
+			runnerPort = uint16(port)
 		default:
-			return nil, errInvalidHostfile
+			if known, ok := utils.Suggest(k, reservedKeys); ok {
+				return nil, &posError{lineno, f.col, fmt.Sprintf("unknown key %q, did you mean %q? labels can't look like misspelled keys", k, known)}
+			}
+			labels[k] = v
 		}
 	}
-	return &plan.HostSpec{
+	h := &plan.HostSpec{
 		IPv4:       ipv4,
 		Slots:      slots,
 		PublicAddr: pubAddr,
-	}, nil
+		SSHProxy:   sshProxy,
+		RunnerPort: runnerPort,
+	}
+	if len(labels) > 0 {
+		h.Labels = labels
+	}
+	return h, nil
 }
 
 func trimComment(line string) string {
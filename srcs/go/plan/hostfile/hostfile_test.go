@@ -1,6 +1,7 @@
 package hostfile
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/lsds/KungFu/srcs/go/plan"
@@ -24,3 +25,48 @@ func Test_Parse(t *testing.T) {
 	assert.True(hl[1].Slots == 8)
 	assert.True(hl[1].PublicAddr == `x.y.z`)
 }
+
+func Test_ParseSSHProxy(t *testing.T) {
+	text := `
+	10.0.0.1 slots=4 ssh_proxy=alice@bastion:2222 zone=a
+	10.0.0.2 slots=4
+	`
+	hl, err := Parse(text)
+	assert.OK(err)
+	assert.True(len(hl) == 2)
+	assert.True(hl[0].SSHProxy == `alice@bastion:2222`)
+	assert.True(hl[0].Labels[`zone`] == `a`)
+	assert.True(len(hl[0].Labels) == 1)
+	assert.True(hl[1].SSHProxy == ``)
+}
+
+func Test_ParseRunnerPort(t *testing.T) {
+	hl, err := Parse("10.0.0.1 slots=4 runner_port=38090 zone=a\n10.0.0.2 slots=4")
+	assert.OK(err)
+	assert.True(hl[0].RunnerPort == 38090)
+	assert.True(len(hl[0].Labels) == 1)
+	assert.True(hl[1].RunnerPort == 0)
+}
+
+func Test_ParseErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"10.0.0.1 slots=4\n10.0.0.2  slot=4", `2:11: invalid hostfile: unknown key "slot", did you mean "slots"?`},
+		{"10.0.0.1 public-addr=x.y.z", `1:10: invalid hostfile: unknown key "public-addr", did you mean "public_addr"?`},
+		{"10.0.0.1 slots=four", `1:16: invalid hostfile: invalid slots "four"`},
+		{"10.0.0.1 runner_port=0", `1:22: invalid hostfile: invalid runner_port "0"`},
+		{"10.0.0.1 runner-port=1", `1:10: invalid hostfile: unknown key "runner-port", did you mean "runner_port"?`},
+		{"10.0.0.1\tzone", `1:10: invalid hostfile: "zone" is not <key>=<value>`},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.text)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) = %v, want %s", tt.text, err, tt.want)
+		}
+	}
+	hl, err := Parse("10.0.0.1\tslots=2   zone=a")
+	assert.OK(err)
+	assert.True(hl[0].Slots == 2 && hl[0].Labels[`zone`] == `a`)
+}
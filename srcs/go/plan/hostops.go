@@ -0,0 +1,103 @@
+package plan
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	errHostExists   = errors.New("host is already in cluster")
+	errHostNotFound = errors.New("host is not in cluster")
+	errLastHost     = errors.New("can't remove the last host of cluster")
+	errNoFreeSlot   = errors.New("no free slot on other hosts")
+	errNoWorkerLeft = errors.New("no worker would be left, drain the host instead")
+)
+
+func (pl PeerList) notOn(ipv4 uint32) PeerList {
+	var ql PeerList
+	for _, p := range pl {
+		if p.IPv4 != ipv4 {
+			ql = append(ql, p)
+		}
+	}
+	return ql
+}
+
+func (c Cluster) checkRemovable(ipv4 uint32) error {
+	if len(c.Runners.On(ipv4)) == 0 {
+		return fmt.Errorf("%v: %s", errHostNotFound, FormatIPv4(ipv4))
+	}
+	if len(c.Runners.notOn(ipv4)) == 0 {
+		return errLastHost
+	}
+	return nil
+}
+
+// AddHost adds a runner of port on the host, where new workers will be placed by the following resizes
+func (c Cluster) AddHost(ipv4 uint32, port uint16) (*Cluster, error) {
+	if len(c.Runners.On(ipv4)) > 0 {
+		return nil, fmt.Errorf("%v: %s", errHostExists, FormatIPv4(ipv4))
+	}
+	d := c.Clone()
+	d.Runners = append(d.Runners, PeerID{IPv4: ipv4, Port: port})
+	return &d, nil
+}
+
+// RemoveHost removes the runner and the workers on the host, the ranks of the other workers are kept in order
+func (c Cluster) RemoveHost(ipv4 uint32) (*Cluster, error) {
+	if err := c.checkRemovable(ipv4); err != nil {
+		return nil, err
+	}
+	d := c.Clone()
+	d.Runners = d.Runners.notOn(ipv4)
+	d.Workers = d.Workers.notOn(ipv4)
+	if len(d.Workers) == 0 {
+		return nil, errNoWorkerLeft
+	}
+	return &d, nil
+}
+
+// DrainHost removes the runner on the host, and moves its workers to the other hosts with the fewest workers,
+// keeping their ranks. Slots are given by hl, hosts not in hl are not limited, as by Resize.
+func (c Cluster) DrainHost(ipv4 uint32, hl HostList) (*Cluster, []Move, error) {
+	if err := c.checkRemovable(ipv4); err != nil {
+		return nil, nil, err
+	}
+	d := c.Clone()
+	d.Runners = d.Runners.notOn(ipv4)
+	used := make(map[uint32]int)
+	for _, w := range d.Workers {
+		used[w.IPv4]++
+	}
+	var moves []Move
+	for i, w := range d.Workers {
+		if w.IPv4 != ipv4 {
+			continue
+		}
+		target, ok := d.fewestWorkers(hl, used)
+		if !ok {
+			return nil, nil, fmt.Errorf("%v: %d workers to move from %s", errNoFreeSlot, used[ipv4], FormatIPv4(ipv4))
+		}
+		to := PeerID{IPv4: target, Port: d.nextPort(target)}
+		d.Workers[i] = to
+		used[ipv4]--
+		used[target]++
+		moves = append(moves, Move{From: w, To: to, Reason: "host drained"})
+	}
+	return &d, moves, nil
+}
+
+// fewestWorkers returns the runner host of the fewest workers which is not full
+func (c Cluster) fewestWorkers(hl HostList, used map[uint32]int) (uint32, bool) {
+	var best uint32
+	var found bool
+	for _, r := range c.Runners {
+		if h, ok := hl.lookup(r.IPv4); ok && h.Slots > 0 && used[r.IPv4] >= h.Slots {
+			continue
+		}
+		if !found || used[r.IPv4] < used[best] {
+			best, found = r.IPv4, true
+		}
+	}
+	return best, found
+}
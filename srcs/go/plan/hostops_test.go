@@ -0,0 +1,54 @@
+package plan
+
+import "testing"
+
+func Test_HostOps(t *testing.T) {
+	hl, _ := ParseHostList("192.168.1.2:2,192.168.1.3:2,192.168.1.4:3")
+	c := Cluster{
+		Runners: hl.GenRunnerList(DefaultRunnerPort),
+		Workers: hl.MustGenPeerList(5, DefaultPortRange),
+	}
+	if _, err := c.AddHost(hl[0].IPv4, DefaultRunnerPort); err == nil {
+		t.Errorf("adding an existing host should fail")
+	}
+	newHost := MustParseIPv4("192.168.1.5")
+	d, err := c.AddHost(newHost, DefaultRunnerPort)
+	if err != nil || len(d.Runners) != 4 || !d.Workers.Eq(c.Workers) {
+		t.Fatalf("AddHost() = %v, %v", d, err)
+	}
+
+	e, moves, err := c.DrainHost(hl[1].IPv4, hl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moves) != 2 || len(e.Workers) != 5 || len(e.Workers.On(hl[1].IPv4)) != 0 || len(e.Runners.On(hl[1].IPv4)) != 0 {
+		t.Errorf("DrainHost() = %s, %v", e.DebugString(), moves)
+	}
+	if len(e.Workers.On(hl[0].IPv4)) != 2 || len(e.Workers.On(hl[2].IPv4)) != 3 {
+		t.Errorf("slots should be respected: %s", e.DebugString())
+	}
+	if err := e.Validate(); err != nil {
+		t.Errorf("invalid cluster: %v", err)
+	}
+	if _, _, err := e.DrainHost(hl[0].IPv4, hl); err == nil {
+		t.Errorf("draining without free slots should fail")
+	}
+
+	f, err := c.RemoveHost(hl[0].IPv4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := c.Workers[2:]; !f.Workers.Eq(want) {
+		t.Errorf("RemoveHost() = %s, want %s", f.Workers, want)
+	}
+	if _, err := f.RemoveHost(hl[0].IPv4); err == nil {
+		t.Errorf("removing an unknown host should fail")
+	}
+	if _, err := d.RemoveHost(hl[0].IPv4); err != nil {
+		t.Errorf("removing a host should keep the added host: %v", err)
+	}
+	g := Cluster{Runners: c.Runners, Workers: c.Workers.On(hl[0].IPv4)}
+	if _, err := g.RemoveHost(hl[0].IPv4); err == nil {
+		t.Errorf("removing all workers should fail")
+	}
+}
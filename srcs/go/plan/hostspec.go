@@ -16,21 +16,78 @@ type HostSpec struct {
 	IPv4       uint32
 	Slots      int
 	PublicAddr string
+	Labels     Labels
+	Resources  *HostResources // latest report of the runner, nil if unknown
+	SSHProxy   string         // [user@]host[:port] of the jump host to reach the host by SSH, from the hostfile only
+	RunnerPort uint16         // port of the runner on the host, 0 for the port shared by all runners
 }
 
+// runnerPortKey gives the runner port in a host spec, it is not a label
+const runnerPortKey = `runner_port`
+
 func (h HostSpec) String() string {
-	return fmt.Sprintf("%s:%d:%s", FormatIPv4(h.IPv4), h.Slots, h.PublicAddr)
+	s := fmt.Sprintf("%s:%d:%s", FormatIPv4(h.IPv4), h.Slots, h.PublicAddr)
+	if h.RunnerPort > 0 {
+		s += fmt.Sprintf(":%s=%d", runnerPortKey, h.RunnerPort)
+	}
+	if len(h.Labels) > 0 {
+		s += ":" + h.Labels.format(":")
+	}
+	return s
 }
 
 func (h HostSpec) DebugString() string {
-	return fmt.Sprintf("%s slots=%d hostname=%s", FormatIPv4(h.IPv4), h.Slots, h.PublicAddr)
+	s := fmt.Sprintf("%s slots=%d hostname=%s", FormatIPv4(h.IPv4), h.Slots, h.PublicAddr)
+	if len(h.SSHProxy) > 0 {
+		s += " ssh_proxy=" + h.SSHProxy
+	}
+	if h.RunnerPort > 0 {
+		s += fmt.Sprintf(" %s=%d", runnerPortKey, h.RunnerPort)
+	}
+	if len(h.Labels) > 0 {
+		s += " " + h.Labels.format(" ")
+	}
+	return s
 }
 
+// parseHostSpec parses <internal IP>:<nslots>[:<public addr>][:<key>=<value>]...
+// where runner_port=<port> is not a label but the port of the runner on the host.
 func parseHostSpec(spec string) (*HostSpec, error) {
 	parts := strings.Split(spec, ":")
 	if len(parts) < 1 {
 		return nil, ErrInvalidHostSpec
 	}
+	var labels Labels
+	var runnerPort uint16
+	for len(parts) > 1 {
+		k, v, ok := parseLabel(parts[len(parts)-1])
+		if !ok {
+			break
+		}
+		parts = parts[:len(parts)-1]
+		if k == runnerPortKey {
+			port, err := strconv.ParseUint(v, 10, 16)
+			if err != nil || port == 0 {
+				return nil, ErrInvalidHostSpec
+			}
+			runnerPort = uint16(port)
+			continue
+		}
+		if labels == nil {
+			labels = make(Labels)
+		}
+		labels[k] = v
+	}
+	h, err := parseHostAddr(parts)
+	if err != nil {
+		return nil, err
+	}
+	h.Labels = labels
+	h.RunnerPort = runnerPort
+	return h, nil
+}
+
+func parseHostAddr(parts []string) (*HostSpec, error) {
 	ipv4, err := ParseIPv4(parts[0])
 	if err != nil {
 		return nil, err
@@ -104,6 +161,19 @@ func (hl HostList) Cap() int {
 	return cap
 }
 
+// Oversubscribe returns hl with each slot shared by n ranks, hl itself if n <= 1
+func (hl HostList) Oversubscribe(n int) HostList {
+	if n <= 1 {
+		return hl
+	}
+	over := make(HostList, len(hl))
+	for i, h := range hl {
+		h.Slots *= n
+		over[i] = h
+	}
+	return over
+}
+
 func (hl HostList) LookupHost(ipv4 uint32) string {
 	for _, h := range hl {
 		if h.IPv4 == ipv4 {
@@ -191,14 +261,32 @@ func (hl HostList) genPeerList(np int, pr PortRange) PeerList {
 
 var ErrNoEnoughCapacity = errors.New("no enough capacity")
 
+// GenRunnerList returns a runner on each host, of the runner port of the host if given, otherwise of port
 func (hl HostList) GenRunnerList(port uint16) PeerList {
 	var pl PeerList
 	for _, h := range hl {
-		pl = append(pl, PeerID{IPv4: h.IPv4, Port: port})
+		pl = append(pl, PeerID{IPv4: h.IPv4, Port: h.runnerPort(port)})
 	}
 	return pl
 }
 
+func (h HostSpec) runnerPort(port uint16) uint16 {
+	if h.RunnerPort > 0 {
+		return h.RunnerPort
+	}
+	return port
+}
+
+// RunnerPortOf returns the runner port of the host, port if the host doesn't give one or is not in hl
+func (hl HostList) RunnerPortOf(ipv4 uint32, port uint16) uint16 {
+	for _, h := range hl {
+		if h.IPv4 == ipv4 {
+			return h.runnerPort(port)
+		}
+	}
+	return port
+}
+
 func (hl HostList) GenPeerList(np int, pr PortRange) (PeerList, error) {
 	if hl.Cap() < np {
 		return nil, ErrNoEnoughCapacity
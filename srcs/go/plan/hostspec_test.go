@@ -39,3 +39,110 @@ func Test_HostSpecList(t *testing.T) {
 		t.Errorf("expect %d, got %d", 0, n)
 	}
 }
+
+func Test_ParseHostListLabels(t *testing.T) {
+	hl, err := ParseHostList("192.168.1.11:4:gpu=a100:zone=a,192.168.1.12:2:x.y.z:zone=b,192.168.1.13")
+	if err != nil {
+		t.Fatalf("unexpect error: %v", err)
+	}
+	if hl[0].Slots != 4 || hl[0].PublicAddr != `192.168.1.11` || hl[0].Labels[`gpu`] != `a100` || hl[0].Labels[`zone`] != `a` {
+		t.Errorf("unexpected host: %s", hl[0].DebugString())
+	}
+	if hl[1].PublicAddr != `x.y.z` || hl[1].Labels[`zone`] != `b` {
+		t.Errorf("unexpected host: %s", hl[1].DebugString())
+	}
+	if len(hl[2].Labels) != 0 {
+		t.Errorf("unexpected host: %s", hl[2].DebugString())
+	}
+	hl2, err := ParseHostList(hl.String())
+	if err != nil || hl2.String() != hl.String() {
+		t.Errorf("%s != %s", hl2, hl)
+	}
+}
+
+func Test_RunnerPort(t *testing.T) {
+	hl, err := ParseHostList("192.168.1.11:4,192.168.1.12:4:x.y.z:runner_port=38090:zone=b")
+	if err != nil {
+		t.Fatalf("unexpect error: %v", err)
+	}
+	if hl[0].RunnerPort != 0 || hl[1].RunnerPort != 38090 || len(hl[1].Labels) != 1 || hl[1].PublicAddr != `x.y.z` {
+		t.Errorf("unexpected hosts: %s", hl)
+	}
+	runners := hl.GenRunnerList(DefaultRunnerPort)
+	if runners[0].Port != DefaultRunnerPort || runners[1].Port != 38090 {
+		t.Errorf("unexpected runners: %s", runners)
+	}
+	if p := hl.RunnerPortOf(hl[1].IPv4, DefaultRunnerPort); p != 38090 {
+		t.Errorf("expect %d, got %d", 38090, p)
+	}
+	if p := hl.RunnerPortOf(MustParseIPv4(`192.168.1.13`), DefaultRunnerPort); p != DefaultRunnerPort {
+		t.Errorf("expect %d, got %d", DefaultRunnerPort, p)
+	}
+	hl2, err := ParseHostList(hl.String())
+	if err != nil || hl2.String() != hl.String() {
+		t.Errorf("%s != %s", hl2, hl)
+	}
+	for _, spec := range []string{"192.168.1.11:4:runner_port=0", "192.168.1.11:4:runner_port=65536"} {
+		if _, err := ParseHostList(spec); err == nil {
+			t.Errorf("%s is parsed", spec)
+		}
+	}
+}
+
+func Test_Place(t *testing.T) {
+	hl := fakeHosts(4)
+	for i := range hl {
+		hl[i].Labels = Labels{`zone`: fmt.Sprintf("%d", i/2), `gpu`: `a100`}
+	}
+	hl[3].Labels[`gpu`] = `v100`
+	pl, err := hl.Place(6, DefaultPortRange, Constraints{SpreadAcross: `zone`})
+	if err != nil {
+		t.Fatalf("unexpect error: %v", err)
+	}
+	// 3 peers per zone, on the first host of the zone
+	if n := len(pl.On(hl[0].IPv4)); n != 3 {
+		t.Errorf("expect %d, got %d", 3, n)
+	}
+	if n := len(pl.On(hl[2].IPv4)); n != 3 {
+		t.Errorf("expect %d, got %d", 3, n)
+	}
+	pl, err = hl.Place(12, DefaultPortRange, Constraints{Require: Labels{`gpu`: `a100`}})
+	if err != nil {
+		t.Fatalf("unexpect error: %v", err)
+	}
+	if n := len(pl.On(hl[3].IPv4)); n != 0 {
+		t.Errorf("expect %d, got %d", 0, n)
+	}
+	if _, err := hl.Place(13, DefaultPortRange, Constraints{Require: Labels{`gpu`: `a100`}}); err != ErrNoEnoughCapacity {
+		t.Errorf("expect %v, got %v", ErrNoEnoughCapacity, err)
+	}
+}
+
+func Test_Oversubscribe(t *testing.T) {
+	hl := fakeHosts(2)
+	over := hl.Oversubscribe(3)
+	if over.Cap() != 24 || hl.Cap() != 8 {
+		t.Errorf("unexpected capacity: %d, original: %d", over.Cap(), hl.Cap())
+	}
+	if pl, err := over.GenPeerList(20, DefaultPortRange); err != nil || pl.LocalSize(pl[0]) != 12 {
+		t.Errorf("unexpected peers: %s, %v", pl, err)
+	}
+	if hl.Oversubscribe(1).Cap() != 8 {
+		t.Errorf("hosts must not be changed without oversubscription")
+	}
+}
+
+func Test_HostAddrs(t *testing.T) {
+	hl, _ := ParseHostList("192.168.1.12:2:node-2.v6,192.168.1.11:2")
+	addrs := hl.PublicAddrs()
+	if want := "192.168.1.12=node-2.v6"; addrs.String() != want {
+		t.Errorf("unexpected addresses: %s, want %s", addrs, want)
+	}
+	parsed, err := ParseHostAddrs("192.168.1.12=fd00::2,192.168.1.11=node-1")
+	if err != nil || len(parsed) != 2 || parsed[MustParseIPv4("192.168.1.12")] != "fd00::2" {
+		t.Errorf("unexpected addresses: %v, %v", parsed, err)
+	}
+	if _, err := ParseHostAddrs("node-1"); err == nil {
+		t.Errorf("addresses without IPv4 should be rejected")
+	}
+}
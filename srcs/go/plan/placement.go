@@ -0,0 +1,160 @@
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var errInvalidLabel = errors.New("invalid label, expect <key>=<value>")
+
+// Labels are key-value attributes of a host, e.g. gpu=a100, zone=eu-west-1a
+type Labels map[string]string
+
+func parseLabel(kv string) (string, string, bool) {
+	parts := strings.SplitN(kv, "=", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// ParseLabels parses comma separated <key>=<value> pairs
+func ParseLabels(val string) (Labels, error) {
+	ls := make(Labels)
+	if len(val) == 0 {
+		return ls, nil
+	}
+	for _, kv := range strings.Split(val, ",") {
+		k, v, ok := parseLabel(kv)
+		if !ok {
+			return nil, errInvalidLabel
+		}
+		ls[k] = v
+	}
+	return ls, nil
+}
+
+func (ls Labels) keys() []string {
+	var ks []string
+	for k := range ls {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
+
+func (ls Labels) format(sep string) string {
+	var ss []string
+	for _, k := range ls.keys() {
+		ss = append(ss, k+"="+ls[k])
+	}
+	return strings.Join(ss, sep)
+}
+
+func (ls Labels) String() string {
+	return ls.format(",")
+}
+
+// Set implements flags.Value::Set
+func (ls *Labels) Set(val string) error {
+	value, err := ParseLabels(val)
+	if err != nil {
+		return err
+	}
+	*ls = value
+	return nil
+}
+
+// Match returns true if ls has all labels of required
+func (ls Labels) Match(required Labels) bool {
+	for k, v := range required {
+		if w, ok := ls[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Constraints restrict the hosts where peers can be placed
+type Constraints struct {
+	Require      Labels // only use hosts having all these labels
+	SpreadAcross string // spread peers evenly across the groups of hosts that have the same value of this label
+}
+
+// IsEmpty returns true if peers can be placed on any host
+func (c Constraints) IsEmpty() bool {
+	return len(c.Require) == 0 && len(c.SpreadAcross) == 0
+}
+
+func (c Constraints) String() string {
+	var ss []string
+	if len(c.Require) > 0 {
+		ss = append(ss, fmt.Sprintf("require: %s", c.Require))
+	}
+	if len(c.SpreadAcross) > 0 {
+		ss = append(ss, fmt.Sprintf("spread-across: %s", c.SpreadAcross))
+	}
+	return strings.Join(ss, ", ")
+}
+
+// Filter returns the hosts having all the required labels
+func (hl HostList) Filter(required Labels) HostList {
+	var part HostList
+	for _, h := range hl {
+		if h.Labels.Match(required) {
+			part = append(part, h)
+		}
+	}
+	return part
+}
+
+// Place generates np peers on the hosts satisfying the constraints,
+// peers on the same host have consecutive ranks.
+func (hl HostList) Place(np int, pr PortRange, c Constraints) (PeerList, error) {
+	hosts := hl.Filter(c.Require)
+	if len(c.SpreadAcross) == 0 {
+		return hosts.GenPeerList(np, pr)
+	}
+	if hosts.Cap() < np {
+		return nil, ErrNoEnoughCapacity
+	}
+	for _, h := range hosts {
+		if pr.Cap() < h.Slots {
+			return nil, ErrNoEnoughCapacity
+		}
+	}
+	var groups [][]int
+	index := make(map[string]int)
+	for i, h := range hosts {
+		v := h.Labels[c.SpreadAcross]
+		if _, ok := index[v]; !ok {
+			index[v] = len(groups)
+			groups = append(groups, nil)
+		}
+		groups[index[v]] = append(groups[index[v]], i)
+	}
+	used := make([]int, len(hosts))
+	for placed := 0; placed < np; {
+		for _, g := range groups {
+			if placed >= np {
+				break
+			}
+			for _, i := range g {
+				if used[i] < hosts[i].Slots {
+					used[i]++
+					placed++
+					break
+				}
+			}
+		}
+	}
+	var pl PeerList
+	for i, h := range hosts {
+		for j := 0; j < used[i]; j++ {
+			pl = append(pl, PeerID{IPv4: h.IPv4, Port: pr.Begin + uint16(j)})
+		}
+	}
+	return pl, nil
+}
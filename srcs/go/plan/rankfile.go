@@ -0,0 +1,46 @@
+package plan
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RankAssignment describes where a rank runs, for external tools consuming rank maps
+type RankAssignment struct {
+	Rank int    `json:"rank"`
+	Host string `json:"host"` // public address of the host, its IPv4 if it has none
+	IPv4 string `json:"ipv4"`
+	Port uint16 `json:"port"`
+	Slot int    `json:"slot"` // local rank on the host
+	GPU  int    `json:"gpu"`  // -1 if not known
+}
+
+// Assign describes the ranks of the peers in pl, the GPU of each rank is given by gpuOf
+func (hl HostList) Assign(pl PeerList, gpuOf func(rank int, p PeerID) int) []RankAssignment {
+	var as []RankAssignment
+	for rank, p := range pl {
+		host := hl.LookupHost(p.IPv4)
+		if len(host) == 0 {
+			host = FormatIPv4(p.IPv4)
+		}
+		slot, _ := pl.LocalRank(p)
+		as = append(as, RankAssignment{
+			Rank: rank,
+			Host: host,
+			IPv4: FormatIPv4(p.IPv4),
+			Port: p.Port,
+			Slot: slot,
+			GPU:  gpuOf(rank, p),
+		})
+	}
+	return as
+}
+
+// FormatRankfile formats the assignments as an OpenMPI rankfile, of lines of rank <rank>=<host> slot=<slot>
+func FormatRankfile(as []RankAssignment) string {
+	var lines []string
+	for _, a := range as {
+		lines = append(lines, fmt.Sprintf("rank %d=%s slot=%d", a.Rank, a.Host, a.Slot))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,125 @@
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	errInvalidRankMap   = errors.New("invalid rank map")
+	errRankMapHost      = errors.New("host of rank map not in host list")
+	errRankMapSlots     = errors.New("rank map exceeds slots of host")
+	errRankMapDuplicate = errors.New("duplicated GPU in rank map")
+)
+
+// RankSlot pins a rank to a host, and optionally to a GPU of the host
+type RankSlot struct {
+	Host uint32
+	GPU  int // -1 if not pinned
+}
+
+// RankMap gives the slot of each rank
+type RankMap []RankSlot
+
+// ParseRankMap parses lines of <rank> <host> [gpu=<index>], ranks must be 0, 1, ..., n - 1 in any order.
+func ParseRankMap(text string) (RankMap, error) {
+	slots := make(map[int]RankSlot)
+	for _, line := range strings.Split(text, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		parts := strings.Fields(line)
+		if len(parts) == 0 {
+			continue
+		}
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("%v: %q", errInvalidRankMap, line)
+		}
+		rank, err := strconv.Atoi(parts[0])
+		if err != nil || rank < 0 {
+			return nil, fmt.Errorf("%v: %q", errInvalidRankMap, line)
+		}
+		if _, ok := slots[rank]; ok {
+			return nil, fmt.Errorf("%v: duplicated rank %d", errInvalidRankMap, rank)
+		}
+		host, err := ParseIPv4(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("%v: %q", err, parts[1])
+		}
+		s := RankSlot{Host: host, GPU: -1}
+		if len(parts) == 3 {
+			if !strings.HasPrefix(parts[2], "gpu=") {
+				return nil, fmt.Errorf("%v: %q", errInvalidRankMap, line)
+			}
+			if s.GPU, err = strconv.Atoi(strings.TrimPrefix(parts[2], "gpu=")); err != nil || s.GPU < 0 {
+				return nil, fmt.Errorf("%v: %q", errInvalidRankMap, line)
+			}
+		}
+		slots[rank] = s
+	}
+	m := make(RankMap, len(slots))
+	for rank, s := range slots {
+		if rank >= len(m) {
+			return nil, fmt.Errorf("%v: missing ranks below %d", errInvalidRankMap, rank)
+		}
+		m[rank] = s
+	}
+	return m, nil
+}
+
+func (m RankMap) String() string {
+	var lines []string
+	for rank, s := range m {
+		line := fmt.Sprintf("%d %s", rank, FormatIPv4(s.Host))
+		if s.GPU >= 0 {
+			line += fmt.Sprintf(" gpu=%d", s.GPU)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// RankMapOf returns the hosts of the ranks of pl, without pinning them to GPUs
+func RankMapOf(pl PeerList) RankMap {
+	m := make(RankMap, len(pl))
+	for rank, p := range pl {
+		m[rank] = RankSlot{Host: p.IPv4, GPU: -1}
+	}
+	return m
+}
+
+// GPUOf returns the GPU pinned to the rank, if the rank is on the given host
+func (m RankMap) GPUOf(rank int, host uint32) (int, bool) {
+	if rank < 0 || rank >= len(m) || m[rank].Host != host || m[rank].GPU < 0 {
+		return -1, false
+	}
+	return m[rank].GPU, true
+}
+
+// PlaceByRankMap generates peers of the ranks in the map, overriding the placement by Place,
+// peers on the same host take ports in the order of their ranks.
+func (hl HostList) PlaceByRankMap(m RankMap, pr PortRange) (PeerList, error) {
+	used := make(map[uint32]int)
+	gpus := make(map[RankSlot]bool)
+	var pl PeerList
+	for _, s := range m {
+		slots := hl.SlotOf(s.Host)
+		if slots == 0 {
+			return nil, fmt.Errorf("%v: %s", errRankMapHost, FormatIPv4(s.Host))
+		}
+		if used[s.Host] >= slots || used[s.Host] >= pr.Cap() {
+			return nil, fmt.Errorf("%v: %s", errRankMapSlots, FormatIPv4(s.Host))
+		}
+		if s.GPU >= 0 {
+			if gpus[s] {
+				return nil, fmt.Errorf("%v: %s gpu=%d", errRankMapDuplicate, FormatIPv4(s.Host), s.GPU)
+			}
+			gpus[s] = true
+		}
+		pl = append(pl, PeerID{IPv4: s.Host, Port: pr.Begin + uint16(used[s.Host])})
+		used[s.Host]++
+	}
+	return pl, nil
+}
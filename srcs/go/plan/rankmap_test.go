@@ -0,0 +1,67 @@
+package plan
+
+import "testing"
+
+func Test_RankMap(t *testing.T) {
+	text := `
+# NVLink pairs are (0, 1) and (2, 3)
+1 192.168.1.2 gpu=1
+0 192.168.1.2 gpu=0
+2 192.168.1.3 gpu=2
+3 192.168.1.3 gpu=3
+4 192.168.1.2
+`
+	m, err := ParseRankMap(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hl, _ := ParseHostList("192.168.1.2:4,192.168.1.3:4")
+	pl, err := hl.PlaceByRankMap(m, DefaultPortRange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "192.168.1.2:10000,192.168.1.2:10001,192.168.1.3:10000,192.168.1.3:10001,192.168.1.2:10002"; pl.String() != want {
+		t.Errorf("unexpected peers: %s, want %s", pl, want)
+	}
+	if gpu, ok := m.GPUOf(2, MustParseIPv4("192.168.1.3")); !ok || gpu != 2 {
+		t.Errorf("unexpected GPU of rank 2: %d", gpu)
+	}
+	if _, ok := m.GPUOf(4, MustParseIPv4("192.168.1.2")); ok {
+		t.Errorf("rank 4 should not be pinned to a GPU")
+	}
+	if _, ok := m.GPUOf(2, MustParseIPv4("192.168.1.2")); ok {
+		t.Errorf("rank 2 is not on 192.168.1.2")
+	}
+	for _, text := range []string{
+		"1 192.168.1.2",
+		"0 192.168.1.2\n0 192.168.1.3",
+		"0 192.168.1.2 cpu=1",
+		"0 192.168.1.4",
+		"0 192.168.1.2 gpu=0\n1 192.168.1.2 gpu=0",
+		"0 192.168.1.2\n1 192.168.1.2\n2 192.168.1.2\n3 192.168.1.2\n4 192.168.1.2",
+	} {
+		m, err := ParseRankMap(text)
+		if err == nil {
+			_, err = hl.PlaceByRankMap(m, DefaultPortRange)
+		}
+		if err == nil {
+			t.Errorf("%q should be rejected", text)
+		}
+	}
+}
+
+func Test_FormatRankfile(t *testing.T) {
+	hl, _ := ParseHostList("192.168.1.2:2:node-a,192.168.1.3:2")
+	pl, err := hl.Place(3, DefaultPortRange, Constraints{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	as := hl.Assign(pl, func(rank int, p PeerID) int { return -1 })
+	want := "rank 0=node-a slot=0\nrank 1=node-a slot=1\nrank 2=192.168.1.3 slot=0\n"
+	if s := FormatRankfile(as); s != want {
+		t.Errorf("FormatRankfile() = %q, want %q", s, want)
+	}
+	if a := as[1]; a.IPv4 != "192.168.1.2" || a.Port != DefaultPortRange.Begin+1 {
+		t.Errorf("unexpected assignment of rank 1: %+v", a)
+	}
+}
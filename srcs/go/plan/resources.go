@@ -0,0 +1,135 @@
+package plan
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// HostResources are the free resources of a host, reported periodically by its runner
+type HostResources struct {
+	MemAvailable uint64    `json:"mem_available"` // bytes, 0 if unknown
+	Load1        float64   `json:"load1"`         // load average of the last minute
+	CPUs         int       `json:"cpus"`
+	FreeGPUs     int       `json:"free_gpus"` // GPUs without compute processes, -1 if unknown
+	Updated      time.Time `json:"updated"`
+}
+
+// Thresholds of a saturated host
+var (
+	MinMemAvailable uint64 = 1 << 30
+	MaxLoadPerCPU          = 1.0
+	ResourcesTTL           = 1 * time.Minute // reports older than this are ignored
+)
+
+// LoadPerCPU returns the load average normalized by the number of CPUs
+func (r HostResources) LoadPerCPU() float64 {
+	if r.CPUs <= 0 {
+		return r.Load1
+	}
+	return r.Load1 / float64(r.CPUs)
+}
+
+// Saturated tells if a new peer should not be placed on the host, and why
+func (r HostResources) Saturated() (bool, string) {
+	if r.FreeGPUs == 0 {
+		return true, "no free GPU"
+	}
+	if r.MemAvailable > 0 && r.MemAvailable < MinMemAvailable {
+		return true, fmt.Sprintf("%d MiB memory available", r.MemAvailable>>20)
+	}
+	if l := r.LoadPerCPU(); l > MaxLoadPerCPU {
+		return true, fmt.Sprintf("load %.2f per CPU", l)
+	}
+	return false, ""
+}
+
+// Fresh returns the resources of the host if they are reported within ResourcesTTL
+func (h HostSpec) Fresh() (*HostResources, bool) {
+	if h.Resources == nil || time.Since(h.Resources.Updated) > ResourcesTTL {
+		return nil, false
+	}
+	return h.Resources, true
+}
+
+func (hl HostList) lookup(ipv4 uint32) (HostSpec, bool) {
+	for _, h := range hl {
+		if h.IPv4 == ipv4 {
+			return h, true
+		}
+	}
+	return HostSpec{}, false
+}
+
+// Move is a new worker placed on another host
+type Move struct {
+	From   PeerID
+	To     PeerID
+	Reason string
+}
+
+// AvoidSaturated moves workers added to c since current away from hosts saturated by fresh resources in hl,
+// to the least loaded runner host with a free slot, workers stay if there is no such host.
+func (c Cluster) AvoidSaturated(current PeerList, hl HostList) (*Cluster, []Move) {
+	d := c.Clone()
+	used := make(map[uint32]int)
+	for _, w := range d.Workers {
+		used[w.IPv4]++
+	}
+	var moves []Move
+	for i, w := range d.Workers {
+		if current.Contains(w) {
+			continue
+		}
+		h, ok := hl.lookup(w.IPv4)
+		if !ok {
+			continue
+		}
+		r, ok := h.Fresh()
+		if !ok {
+			continue
+		}
+		saturated, reason := r.Saturated()
+		if !saturated {
+			continue
+		}
+		target, ok := d.leastLoaded(hl, used)
+		if !ok {
+			continue
+		}
+		to := PeerID{IPv4: target, Port: d.nextPort(target)}
+		d.Workers[i] = to
+		used[w.IPv4]--
+		used[target]++
+		moves = append(moves, Move{From: w, To: to, Reason: reason})
+	}
+	return &d, moves
+}
+
+// leastLoaded returns the runner host of the lowest load which is neither saturated nor full
+func (c Cluster) leastLoaded(hl HostList, used map[uint32]int) (uint32, bool) {
+	type candidate struct {
+		ipv4 uint32
+		load float64
+	}
+	var cs []candidate
+	for _, r := range c.Runners {
+		h, ok := hl.lookup(r.IPv4)
+		if !ok || used[r.IPv4] >= h.Slots {
+			continue
+		}
+		res, ok := h.Fresh()
+		if !ok {
+			continue
+		}
+		if saturated, _ := res.Saturated(); saturated {
+			continue
+		}
+		cs = append(cs, candidate{ipv4: r.IPv4, load: res.LoadPerCPU()})
+	}
+	if len(cs) == 0 {
+		return 0, false
+	}
+	sort.SliceStable(cs, func(i, j int) bool { return cs[i].load < cs[j].load })
+	return cs[0].ipv4, true
+}
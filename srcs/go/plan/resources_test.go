@@ -0,0 +1,53 @@
+package plan
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_AvoidSaturated(t *testing.T) {
+	hl, _ := ParseHostList("192.168.1.2:4,192.168.1.3:4,192.168.1.4:4")
+	now := time.Now()
+	hl[0].Resources = &HostResources{MemAvailable: 8 << 30, Load1: 1, CPUs: 8, FreeGPUs: 0, Updated: now}
+	hl[1].Resources = &HostResources{MemAvailable: 8 << 30, Load1: 6, CPUs: 8, FreeGPUs: 2, Updated: now}
+	hl[2].Resources = &HostResources{MemAvailable: 8 << 30, Load1: 2, CPUs: 8, FreeGPUs: 2, Updated: now}
+	c := Cluster{
+		Runners: hl.GenRunnerList(DefaultRunnerPort),
+		Workers: hl.MustGenPeerList(1, DefaultPortRange),
+	}
+	d := c.Clone()
+	d.Workers = append(d.Workers, PeerID{IPv4: hl[0].IPv4, Port: c.nextPort(hl[0].IPv4)}) // e.g. proposed by a hook
+	e, moves := d.AvoidSaturated(c.Workers, hl)
+	if len(moves) != 1 || moves[0].From.IPv4 != hl[0].IPv4 || moves[0].To.IPv4 != hl[2].IPv4 {
+		t.Fatalf("unexpected moves: %v", moves)
+	}
+	if e.Workers[0] != c.Workers[0] {
+		t.Errorf("existing workers should not be moved")
+	}
+	if err := e.Validate(); err != nil {
+		t.Errorf("invalid cluster: %v", err)
+	}
+
+	hl[2].Resources.Updated = now.Add(-2 * ResourcesTTL)
+	if _, moves := d.AvoidSaturated(c.Workers, hl); len(moves) != 1 || moves[0].To.IPv4 != hl[1].IPv4 {
+		t.Errorf("stale report should be ignored, got moves: %v", moves)
+	}
+	hl[1].Resources.MemAvailable = 1 << 20
+	if _, moves := d.AvoidSaturated(c.Workers, hl); len(moves) != 0 {
+		t.Errorf("workers should stay without a better host, got moves: %v", moves)
+	}
+}
+
+func Test_EvictLoaded(t *testing.T) {
+	hl, _ := ParseHostList("192.168.1.2:2,192.168.1.3:2")
+	hl[1].Resources = &HostResources{Load1: 4, CPUs: 2, Updated: time.Now()}
+	pl := hl.MustGenPeerList(4, DefaultPortRange)
+	kept, es := EvictLoaded.Evict(pl, 1, hl, nil)
+	if len(kept) != 3 || len(es) != 1 || es[0].Rank != 3 {
+		t.Errorf("unexpected evictions: %v", es)
+	}
+	kept, es = EvictLoaded.Evict(pl, 2, hl, nil)
+	if len(es) != 2 || es[0].Peer.IPv4 != hl[1].IPv4 || es[1].Peer.IPv4 != hl[1].IPv4 {
+		t.Errorf("workers on the loaded host should be evicted first, got %v", es)
+	}
+}
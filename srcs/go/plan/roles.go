@@ -0,0 +1,92 @@
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RoleSection is a number of consecutive ranks of the same role
+type RoleSection struct {
+	Role  string
+	Count int
+}
+
+// RoleLayout assigns roles to ranks, the sections take the last ranks in order and the main role takes the rest,
+// so that the layout still applies after the cluster is resized.
+type RoleLayout struct {
+	Main     string
+	Sections []RoleSection
+}
+
+var errInvalidRoleLayout = errors.New("invalid role layout")
+
+// String formats the layout as <main role>[,<role>:<count>]...
+func (l RoleLayout) String() string {
+	parts := []string{l.Main}
+	for _, s := range l.Sections {
+		parts = append(parts, fmt.Sprintf("%s:%d", s.Role, s.Count))
+	}
+	return strings.Join(parts, ",")
+}
+
+func ParseRoleLayout(val string) (*RoleLayout, error) {
+	parts := strings.Split(val, ",")
+	l := RoleLayout{Main: parts[0]}
+	for _, p := range parts[1:] {
+		i := strings.LastIndex(p, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("%v: %q", errInvalidRoleLayout, val)
+		}
+		n, err := strconv.Atoi(p[i+1:])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%v: %q", errInvalidRoleLayout, val)
+		}
+		l.Sections = append(l.Sections, RoleSection{Role: p[:i], Count: n})
+	}
+	return &l, nil
+}
+
+// RoleOf returns the role of a rank in a cluster of the given size, and the rank among peers of the same role
+func (l RoleLayout) RoleOf(rank, size int) (string, int) {
+	ranks := l.sectionRanks(size)
+	for i := len(ranks) - 1; i >= 0; i-- {
+		if rank >= ranks[i].begin && rank < ranks[i].end {
+			return ranks[i].role, rank - ranks[i].begin
+		}
+	}
+	return l.Main, rank
+}
+
+// Ranks returns the ranks of a role in a cluster of the given size
+func (l RoleLayout) Ranks(role string, size int) []int {
+	var rs []int
+	for rank := 0; rank < size; rank++ {
+		if r, _ := l.RoleOf(rank, size); r == role {
+			rs = append(rs, rank)
+		}
+	}
+	return rs
+}
+
+type roleRange struct {
+	role       string
+	begin, end int
+}
+
+func (l RoleLayout) sectionRanks(size int) []roleRange {
+	offset := size
+	for _, s := range l.Sections {
+		offset -= s.Count
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	ranks := []roleRange{{role: l.Main, begin: 0, end: offset}}
+	for _, s := range l.Sections {
+		ranks = append(ranks, roleRange{role: s.Role, begin: offset, end: offset + s.Count})
+		offset += s.Count
+	}
+	return ranks
+}
@@ -0,0 +1,32 @@
+package plan
+
+import "testing"
+
+func Test_RoleLayout(t *testing.T) {
+	l, err := ParseRoleLayout("trainer,evaluator:1,logger:2")
+	if err != nil || l.String() != "trainer,evaluator:1,logger:2" {
+		t.Fatalf("unexpected layout: %v, %v", l, err)
+	}
+	for _, c := range []struct {
+		rank, size int
+		role       string
+		roleRank   int
+	}{
+		{0, 6, "trainer", 0},
+		{2, 6, "trainer", 2},
+		{3, 6, "evaluator", 0},
+		{5, 6, "logger", 1},
+		{4, 8, "trainer", 4},
+		{6, 8, "logger", 0},
+	} {
+		if role, roleRank := l.RoleOf(c.rank, c.size); role != c.role || roleRank != c.roleRank {
+			t.Errorf("RoleOf(%d, %d) = %s, %d, want %s, %d", c.rank, c.size, role, roleRank, c.role, c.roleRank)
+		}
+	}
+	if rs := l.Ranks("logger", 6); len(rs) != 2 || rs[0] != 4 {
+		t.Errorf("unexpected ranks: %v", rs)
+	}
+	if _, err := ParseRoleLayout("trainer,evaluator"); err == nil {
+		t.Errorf("invalid layout should fail")
+	}
+}
@@ -30,6 +30,21 @@ func GenTree(peers PeerList) *graph.Graph {
 	return g
 }
 
+// GenTreeFanout generates the tree of GenTree, except that the masters of hosts form a tree in which each has up to fanout children
+func GenTreeFanout(peers PeerList, fanout int) *graph.Graph {
+	g := graph.New(len(peers))
+	masters, hostMaster := getLocalMasters(peers)
+	for rank, p := range peers {
+		if master := hostMaster[p.IPv4]; master != rank {
+			g.AddEdge(master, rank)
+		}
+	}
+	for i := 1; i < len(masters); i++ {
+		g.AddEdge(masters[(i-1)/fanout], masters[i])
+	}
+	return g
+}
+
 func GenDefaultReduceGraph(g *graph.Graph) *graph.Graph {
 	g0 := g.Reverse()
 	k := len(g.Nodes)
@@ -40,18 +55,32 @@ func GenDefaultReduceGraph(g *graph.Graph) *graph.Graph {
 }
 
 func GenBinaryTree(k int) *graph.Graph {
+	return genBinaryTree(k, func(i int) int { return i })
+}
+
+func genBinaryTree(k int, idx func(int) int) *graph.Graph {
 	g := graph.New(k)
 	for i := 0; i < k; i++ {
 		if j := i*2 + 1; j < k {
-			g.AddEdge(i, j)
+			g.AddEdge(idx(i), idx(j))
 		}
 		if j := i*2 + 2; j < k {
-			g.AddEdge(i, j)
+			g.AddEdge(idx(i), idx(j))
 		}
 	}
 	return g
 }
 
+// GenDoubleBinaryTree generates two binary trees of k vertices such that
+// the inner vertices of one tree are leaves of the other,
+// the second tree is the first one with ranks reversed.
+func GenDoubleBinaryTree(k int) []*graph.Graph {
+	return []*graph.Graph{
+		GenBinaryTree(k),
+		genBinaryTree(k, func(i int) int { return k - 1 - i }),
+	}
+}
+
 func genMultiStar(peers PeerList, root int) *graph.Graph {
 	g := graph.New(len(peers))
 	masters, hostMaster := getLocalMasters(peers)
@@ -134,6 +163,47 @@ func GenAlternativeStar(peers PeerList, off int) *graph.Graph {
 	return genMultiStar(peers, masters[off])
 }
 
+// GenHierarchicalClique generates the star graphs of a clique subdivided by hosts. In each graph, the peers of each host form a star
+// centered at a leader of the host, and the leaders form a star centered at the leader of a host. The leaders and the root rotate among the graphs,
+// so that peers of a host form a clique, and peers of the same local rank form a clique across hosts,
+// which takes n*(s+h) connections for n peers on h hosts of s peers, instead of n^2 of the clique.
+func GenHierarchicalClique(peers PeerList) []*graph.Graph {
+	var hosts []uint32
+	locals := make(map[uint32][]int)
+	var s int
+	for rank, p := range peers {
+		if _, ok := locals[p.IPv4]; !ok {
+			hosts = append(hosts, p.IPv4)
+		}
+		locals[p.IPv4] = append(locals[p.IPv4], rank)
+		if n := len(locals[p.IPv4]); n > s {
+			s = n
+		}
+	}
+	var gs []*graph.Graph
+	for l := 0; l < s; l++ {
+		leaders := make([]int, len(hosts))
+		for i, h := range hosts {
+			leaders[i] = locals[h][l%len(locals[h])]
+		}
+		for r := range hosts {
+			g := graph.New(len(peers))
+			for i, h := range hosts {
+				for _, rank := range locals[h] {
+					if rank != leaders[i] {
+						g.AddEdge(leaders[i], rank)
+					}
+				}
+				if i != r {
+					g.AddEdge(leaders[r], leaders[i])
+				}
+			}
+			gs = append(gs, g)
+		}
+	}
+	return gs
+}
+
 // GenStarBcastGraph generates a star shape graph with k vertices and centered at vertice r (0 <= r < k)
 func GenStarBcastGraph(k, r int) *graph.Graph {
 	g := graph.New(k)
@@ -68,6 +68,17 @@ func isValidTreeWithRoot(g *graph.Graph, root int) bool {
 	return true
 }
 
+func Test_DoubleBinaryTree(t *testing.T) {
+	for k := 1; k <= 16; k++ {
+		gs := GenDoubleBinaryTree(k)
+		for i := 0; i < k; i++ {
+			if len(gs[0].Nexts(i)) > 0 && len(gs[1].Nexts(i)) > 0 {
+				t.Errorf("rank %d is inner node of both trees of size %d", i, k)
+			}
+		}
+	}
+}
+
 func Test_trees(t *testing.T) {
 	peers := PeerList{
 		{3, 9}, // 0
@@ -83,12 +94,21 @@ func Test_trees(t *testing.T) {
 	if g := GenTree(peers); !isValidTreeWithRoot(g, 0) {
 		t.Errorf("tree not generated correctly")
 	}
+	if g := GenTreeFanout(peers, 2); !isValidTreeWithRoot(g, 0) {
+		t.Errorf("tree of fanout 2 not generated correctly")
+	}
 	if g := GenBinaryTree(len(peers)); !isValidTreeWithRoot(g, 0) {
 		t.Errorf("binary tree not generated correctly")
 	}
 	if g := GenBinaryTreeStar(peers); !isValidTreeWithRoot(g, 0) {
 		t.Errorf("binary tree star not generated correctly")
 	}
+	{
+		gs := GenDoubleBinaryTree(len(peers))
+		if !isValidTreeWithRoot(gs[0], 0) || !isValidTreeWithRoot(gs[1], len(peers)-1) {
+			t.Errorf("double binary tree not generated correctly")
+		}
+	}
 	{
 		gs := GenMultiBinaryTreeStar(peers)
 		if !isValidTreeWithRoot(gs[0], 0) {
@@ -96,3 +116,91 @@ func Test_trees(t *testing.T) {
 		}
 	}
 }
+
+func Test_GenTreeFanIn(t *testing.T) {
+	const hosts, slots = 3, 4
+	var peers PeerList
+	for h := 0; h < hosts; h++ {
+		for s := 0; s < slots; s++ {
+			peers = append(peers, PeerID{IPv4: uint32(h + 1), Port: uint16(10000 + s)})
+		}
+	}
+	g := GenDefaultReduceGraph(GenTree(peers))
+	// the root receives one reduced contribution from each other host, and one from each local peer
+	if n := len(g.Prevs(0)); n != (hosts-1)+(slots-1) {
+		t.Errorf("root has %d prevs", n)
+	}
+	// every other peer, including the local masters reducing the peers of their hosts, sends once upward
+	for i := 1; i < len(peers); i++ {
+		if n := len(g.Nexts(i)); n != 1 {
+			t.Errorf("%d sends %d messages upward", i, n)
+		}
+	}
+}
+
+func Test_GenHierarchicalClique(t *testing.T) {
+	peers := PeerList{
+		{3, 9}, // 0
+		{3, 8}, // 1
+		{2, 7}, // 2
+		{2, 6}, // 3
+		{2, 5}, // 4
+		{1, 4}, // 5
+		{1, 3}, // 6
+	}
+	gs := GenHierarchicalClique(peers)
+	if len(gs) != 3*3 {
+		t.Fatalf("%d graphs generated, want %d", len(gs), 3*3)
+	}
+	type pair struct{ a, b int }
+	edges := make(map[pair]struct{})
+	roots := make(map[int]int)
+	for _, g := range gs {
+		var root = -1
+		for i := range peers {
+			if len(g.Prevs(i)) == 0 {
+				root = i
+			}
+		}
+		if !isValidTreeWithRoot(g, root) {
+			t.Fatalf("graph rooted at %d is not a tree", root)
+		}
+		roots[root]++
+		for i := range peers {
+			for _, j := range g.Nexts(i) {
+				if i < j {
+					edges[pair{i, j}] = struct{}{}
+				} else {
+					edges[pair{j, i}] = struct{}{}
+				}
+			}
+		}
+	}
+	if len(roots) != len(peers) {
+		t.Errorf("graphs are rooted at %d of %d peers", len(roots), len(peers))
+	}
+	if n := len(peers) * (len(peers) - 1) / 2; len(edges) >= n {
+		t.Errorf("%d connections used, no less than %d of the clique", len(edges), n)
+	}
+}
+
+func Test_GenTreeFanout(t *testing.T) {
+	const hosts, slots = 5, 2
+	var peers PeerList
+	for h := 0; h < hosts; h++ {
+		for s := 0; s < slots; s++ {
+			peers = append(peers, PeerID{IPv4: uint32(h + 1), Port: uint16(10000 + s)})
+		}
+	}
+	g := GenTreeFanout(peers, 2)
+	if !isValidTreeWithRoot(g, 0) {
+		t.Fatalf("tree of fanout 2 not generated correctly")
+	}
+	// the root broadcasts to its local peer and the masters of 2 hosts
+	if n := len(g.Nexts(0)); n != (slots-1)+2 {
+		t.Errorf("root has %d nexts", n)
+	}
+	if n := len(g.Nexts(slots)); n != (slots-1)+2 {
+		t.Errorf("master of the 2nd host has %d nexts", n)
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"sort"
 	"strings"
+	"time"
 )
 
 type Envs map[string]string
@@ -17,6 +19,20 @@ func (e Envs) AddIfMissing(k, v string) {
 	}
 }
 
+// Assignments returns the K=V pairs sorted by key
+func (e Envs) Assignments() []string {
+	var keys []string
+	for k := range e {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var kvs []string
+	for _, k := range keys {
+		kvs = append(kvs, k+`=`+e[k])
+	}
+	return kvs
+}
+
 func Merge(e, f Envs) Envs {
 	g := make(Envs)
 	for k, v := range e {
@@ -37,6 +53,14 @@ type Proc struct {
 	Hostname string
 	LogDir   string
 	Dir      string
+	Delay    time.Duration // waited before the process is started, see job.Job.StartStagger
+}
+
+func (p Proc) Cmd() *exec.Cmd {
+	cmd := exec.Command(p.Prog, p.Args...)
+	cmd.Env = updatedEnvFrom(p.Envs, os.Environ())
+	cmd.Dir = p.Dir
+	return cmd
 }
 
 func (p Proc) CmdCtx(ctx context.Context) *exec.Cmd {
@@ -2,26 +2,45 @@ package client
 
 import (
 	"context"
+	"encoding/binary"
 	"time"
 
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/kungfu/features"
+	"github.com/lsds/KungFu/srcs/go/kungfu/timeouts"
+	"github.com/lsds/KungFu/srcs/go/log"
 	"github.com/lsds/KungFu/srcs/go/monitor"
 	"github.com/lsds/KungFu/srcs/go/plan"
 	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
 	"github.com/lsds/KungFu/srcs/go/utils"
 )
 
+// PriorityStream is the stream of collectives of the control plane, e.g. barriers and consensus.
+// They are sent on dedicated connections, so that they are never queued behind large tensor chunks.
+const PriorityStream = "kungfu::priority"
+
 type Client struct {
 	self        plan.PeerID
 	useUnixSock bool
 	connPool    *connectionPool
+	datagram    *datagramSender
 	monitor     monitor.Monitor
 }
 
 func New(self plan.PeerID, useUnixSock bool) *Client {
+	connPool := newConnectionPool(useUnixSock)
+	var datagram *datagramSender
+	if features.Requested().Has(features.Datagram) && !config.InprocTransport {
+		var err error
+		if datagram, err = newDatagramSender(self, connPool); err != nil {
+			log.Warnf("datagram fast path disabled: %v", err)
+		}
+	}
 	return &Client{
 		self:        self,
 		useUnixSock: useUnixSock,
-		connPool:    newConnectionPool(useUnixSock),
+		connPool:    connPool,
+		datagram:    datagram,
 		monitor:     monitor.GetMonitor(),
 	}
 }
@@ -40,7 +59,77 @@ func (c *Client) Ping(target plan.PeerID) (time.Duration, error) {
 	if err := conn.Read("ping", empty); err != nil {
 		return time.Since(t0), err
 	}
-	return time.Since(t0), nil
+	rtt := time.Since(t0)
+	timeouts.Observe(rtt)
+	return rtt, nil
+}
+
+// Probe sends n bytes to target and reads them echoed back, it returns the round trip time of an empty Ping,
+// and the bandwidth in bytes per second estimated from the extra time taken by the payload.
+func (c *Client) Probe(target plan.PeerID, n int) (time.Duration, float64, error) {
+	rtt, err := c.Ping(target)
+	if err != nil {
+		return rtt, 0, err
+	}
+	t0 := time.Now()
+	conn, err := connection.Open(target, c.self, connection.ConnPing, 0, c.useUnixSock)
+	if err != nil {
+		return rtt, 0, err
+	}
+	defer conn.Close()
+	msg := connection.Message{Length: uint32(n), Data: make([]byte, n)}
+	if err := conn.Send("probe", msg, connection.NoFlag); err != nil {
+		return rtt, 0, err
+	}
+	if err := conn.Read("probe", msg); err != nil {
+		return rtt, 0, err
+	}
+	d := time.Since(t0)
+	if d > rtt {
+		d -= rtt
+	}
+	return rtt, utils.Rate(int64(2*n), d), nil
+}
+
+// Clock estimates the offset of the clock of target relative to the local clock,
+// it returns the offset and the round trip time of the query.
+func (c *Client) Clock(target plan.PeerID) (time.Duration, time.Duration, error) {
+	conn, err := connection.Open(target, c.self, connection.ConnPing, 0, c.useUnixSock)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+	t0 := time.Now()
+	var empty connection.Message
+	if err := conn.Send(connection.ClockName, empty, connection.NoFlag); err != nil {
+		return 0, 0, err
+	}
+	resp := connection.Message{Length: 8, Data: make([]byte, 8)}
+	if err := conn.Read(connection.ClockName, resp); err != nil {
+		return 0, 0, err
+	}
+	rtt := time.Since(t0)
+	timeouts.Observe(rtt)
+	remote := time.Unix(0, int64(binary.LittleEndian.Uint64(resp.Data)))
+	return remote.Sub(t0.Add(rtt / 2)), rtt, nil
+}
+
+// Digest queries the digest of n bytes served by target
+func (c *Client) Digest(target plan.PeerID, n int) ([]byte, error) {
+	conn, err := connection.Open(target, c.self, connection.ConnPing, 0, c.useUnixSock)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var empty connection.Message
+	if err := conn.Send(connection.DigestName, empty, connection.NoFlag); err != nil {
+		return nil, err
+	}
+	resp := connection.Message{Length: uint32(n), Data: make([]byte, n)}
+	if err := conn.Read(connection.DigestName, resp); err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
 }
 
 // Wait waits a peer until it's accessible
@@ -60,25 +149,120 @@ func (c *Client) Wait(ctx context.Context, target plan.PeerID) (int, bool) {
 
 // Send sends data in buf to given Addr
 func (c *Client) Send(a plan.Addr, buf []byte, t connection.ConnType, flags uint32) error {
+	return c.SendOnStream("", a, buf, t, flags)
+}
+
+// SendOnStream sends data in buf to given Addr, concurrent sends of different streams to the same Addr take turns
+func (c *Client) SendOnStream(stream string, a plan.Addr, buf []byte, t connection.ConnType, flags uint32) error {
 	msg := connection.Message{
 		Length: uint32(len(buf)),
 		Data:   buf,
 	}
-	if err := c.send(a, msg, t, flags); err != nil {
+	priority := stream == PriorityStream
+	s := c.connPool.scheduler(a.Peer(), t, priority)
+	s.acquire(stream)
+	err := c.send(a, msg, t, flags, priority)
+	if ferr := c.release(s, a.Peer(), t, priority); err == nil {
+		err = ferr
+	}
+	if err != nil {
 		return err
 	}
 	c.monitor.Egress(int64(msg.Length), a.NetAddr())
+	monitor.AddEgress(int64(msg.Length))
 	return nil
 }
 
-func (c *Client) send(a plan.Addr, msg connection.Message, t connection.ConnType, flags uint32) error {
-	conn := c.connPool.get(a.Peer(), c.self, t)
-	if err := conn.Send(a.Name, msg, flags); err != nil {
+func (c *Client) send(a plan.Addr, msg connection.Message, t connection.ConnType, flags uint32, priority bool) error {
+	if c.useDatagram(a.Peer(), msg, t) {
+		return c.datagram.send(a.Peer(), a.Name, msg, t, flags, c.connPool.currentToken())
+	}
+	conn := c.connPool.get(a.Peer(), c.self, t, priority)
+	if b, ok := conn.(connection.Batcher); ok {
+		return b.Buffer(a.Name, msg, flags)
+	}
+	return conn.Send(a.Name, msg, flags)
+}
+
+// release ends the turn of a sender, the buffered messages are flushed unless the turn is handed over to a waiting sender,
+// so that the messages of the senders queued at the same time are written together.
+func (c *Client) release(s *streamScheduler, remote plan.PeerID, t connection.ConnType, priority bool) error {
+	if s.release() {
+		return nil
+	}
+	return c.connPool.flush(remote, t, priority)
+}
+
+// SendEncodedOnStream sends an encoded message as SendOnStream does, e is released once sent
+func (c *Client) SendEncodedOnStream(stream string, a plan.Addr, e *connection.EncodedMessage, t connection.ConnType) error {
+	defer e.Release()
+	priority := stream == PriorityStream
+	s := c.connPool.scheduler(a.Peer(), t, priority)
+	s.acquire(stream)
+	err := c.sendEncoded(a, e, t, priority)
+	if ferr := c.release(s, a.Peer(), t, priority); err == nil {
+		err = ferr
+	}
+	if err != nil {
 		return err
 	}
+	c.monitor.Egress(int64(e.Length()), a.NetAddr())
+	monitor.AddEgress(int64(e.Length()))
 	return nil
 }
 
+func (c *Client) sendEncoded(a plan.Addr, e *connection.EncodedMessage, t connection.ConnType, priority bool) error {
+	if c.useDatagram(a.Peer(), connection.Message{Length: e.Length()}, t) {
+		return c.datagram.sendEncoded(a.Peer(), a.Name, e, t, c.connPool.currentToken())
+	}
+	conn := c.connPool.get(a.Peer(), c.self, t, priority)
+	if b, ok := conn.(connection.Batcher); ok {
+		return b.BufferEncoded(e)
+	}
+	return conn.SendEncoded(e)
+}
+
+// useDatagram decides if a message can be sent via the datagram fast path
+func (c *Client) useDatagram(remote plan.PeerID, msg connection.Message, t connection.ConnType) bool {
+	if c.datagram == nil || msg.Length > connection.MaxDatagramMessageSize || !features.Enabled(features.Datagram) {
+		return false
+	}
+	if c.useUnixSock && remote.ColocatedWith(c.self) {
+		return false
+	}
+	return t == connection.ConnControl || t == connection.ConnCollective
+}
+
+// ShareConnections makes a pair of peers share one duplex collective connection, messages from remote are handled by h
+func (c *Client) ShareConnections(h connection.Handler) {
+	c.connPool.Lock()
+	defer c.connPool.Unlock()
+	c.connPool.duplex = h
+}
+
+// Adopt uses an accepted duplex connection for sending messages back to its source, until Release is called
+func (c *Client) Adopt(conn connection.Connection) {
+	c.connPool.adopt(conn)
+}
+
+func (c *Client) Release(conn connection.Connection) {
+	c.connPool.drop(connKey{a: conn.Src(), t: conn.Type()}, conn)
+}
+
+// QueueStat is the send queue of a connection
+type QueueStat struct {
+	Peer      plan.PeerID
+	Type      connection.ConnType
+	Priority  bool
+	Depth     int           // messages queued or being sent
+	OldestAge time.Duration // since the oldest of them was queued
+}
+
+// QueueStats returns the send queues of all connections
+func (c *Client) QueueStats() []QueueStat {
+	return c.connPool.queueStats()
+}
+
 func (c *Client) ResetConnections(keeps plan.PeerList, token uint32) {
 	c.connPool.reset(keeps, token)
 }
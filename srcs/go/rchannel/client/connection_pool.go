@@ -8,36 +8,115 @@ import (
 )
 
 type connKey struct {
-	a plan.PeerID
-	t connection.ConnType
+	a        plan.PeerID
+	t        connection.ConnType
+	priority bool // dedicated to PriorityStream
 }
 
 type connectionPool struct {
 	sync.Mutex
 	useUnixSock bool
 	conns       map[connKey]connection.Connection
+	schedulers  map[connKey]*streamScheduler
 	token       uint32
+	duplex      connection.Handler // handles messages from remote on the duplex connections, nil if not sharing connections
 }
 
 func newConnectionPool(useUnixSock bool) *connectionPool {
 	return &connectionPool{
 		useUnixSock: useUnixSock,
 		conns:       make(map[connKey]connection.Connection),
+		schedulers:  make(map[connKey]*streamScheduler),
 	}
 }
 
-func (p *connectionPool) get(remote, local plan.PeerID, t connection.ConnType) connection.Connection {
+func (p *connectionPool) get(remote, local plan.PeerID, t connection.ConnType, priority bool) connection.Connection {
 	p.Lock()
 	defer p.Unlock()
-	key := connKey{remote, t}
+	key := connKey{a: remote, t: t, priority: priority}
 	if conn, ok := p.conns[key]; ok {
 		return conn
 	}
-	conn := connection.New(remote, local, t, p.token, p.useUnixSock)
+	if priority {
+		conn := connection.NewPriority(remote, local, t, p.token, p.useUnixSock)
+		p.conns[key] = conn
+		return conn
+	}
+	if p.duplex == nil || t != connection.ConnCollective {
+		conn := connection.New(remote, local, t, p.token, p.useUnixSock)
+		p.conns[key] = conn
+		return conn
+	}
+	// the connection is also used by remote, unless remote has dialed to local at the same time
+	var conn connection.Connection
+	conn = connection.NewDuplex(remote, local, t, p.token, p.useUnixSock, func(reversed connection.Connection) {
+		p.duplex.Handle(reversed)
+		p.drop(key, conn)
+		conn.Close()
+	})
 	p.conns[key] = conn
 	return conn
 }
 
+// flush writes the messages buffered by the connection to remote, if there is one
+func (p *connectionPool) flush(remote plan.PeerID, t connection.ConnType, priority bool) error {
+	p.Lock()
+	conn := p.conns[connKey{a: remote, t: t, priority: priority}]
+	p.Unlock()
+	if b, ok := conn.(connection.Batcher); ok {
+		return b.Flush()
+	}
+	return nil
+}
+
+// adopt uses an accepted duplex connection for sending messages back to its source
+func (p *connectionPool) adopt(conn connection.Connection) {
+	p.Lock()
+	defer p.Unlock()
+	key := connKey{a: conn.Src(), t: conn.Type()}
+	if _, ok := p.conns[key]; !ok {
+		p.conns[key] = conn
+	}
+}
+
+// drop removes conn from the pool after it is closed by remote
+func (p *connectionPool) drop(key connKey, conn connection.Connection) {
+	p.Lock()
+	defer p.Unlock()
+	if c, ok := p.conns[key]; ok && c == conn {
+		delete(p.conns, key)
+	}
+}
+
+func (p *connectionPool) scheduler(remote plan.PeerID, t connection.ConnType, priority bool) *streamScheduler {
+	p.Lock()
+	defer p.Unlock()
+	key := connKey{a: remote, t: t, priority: priority}
+	if s, ok := p.schedulers[key]; ok {
+		return s
+	}
+	s := newStreamScheduler()
+	p.schedulers[key] = s
+	return s
+}
+
+func (p *connectionPool) queueStats() []QueueStat {
+	p.Lock()
+	defer p.Unlock()
+	var stats []QueueStat
+	for k, s := range p.schedulers {
+		depth, age := s.stats()
+		stats = append(stats, QueueStat{Peer: k.a, Type: k.t, Priority: k.priority, Depth: depth, OldestAge: age})
+	}
+	return stats
+}
+
+func (p *connectionPool) currentToken() uint32 {
+	p.Lock()
+	defer p.Unlock()
+	return p.token
+}
+
 func (p *connectionPool) reset(keeps plan.PeerList, token uint32) {
 	m := keeps.Set()
 	p.Lock()
@@ -46,6 +125,7 @@ func (p *connectionPool) reset(keeps plan.PeerList, token uint32) {
 	for k := range p.conns {
 		if _, ok := m[plan.PeerID(k.a)]; !ok {
 			delete(p.conns, k) // FIXME: gracefully shutdown conn
+			delete(p.schedulers, k)
 		}
 	}
 }
@@ -0,0 +1,183 @@
+package client
+
+import (
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+)
+
+type ackKey struct {
+	addr string
+	t    connection.ConnType
+	seq  uint32
+}
+
+// datagramSender sends small messages over UDP with stop-and-wait acknowledgement,
+// a stream (remote, type) falls back to TCP permanently once a datagram is lost.
+// The datagrams of a stream which fell back are sent over a ConnDatagram connection, starting from the lost one,
+// so that the receiver drops it if it was delivered but not acknowledged, and handles all of them in order.
+type datagramSender struct {
+	sync.Mutex
+	self     plan.PeerID
+	conn     *net.UDPConn
+	nonce    uint32
+	streams  map[connKey]*datagramStream
+	acks     map[ackKey]chan struct{}
+	fallback func(remote plan.PeerID) connection.Connection
+}
+
+type datagramStream struct {
+	sync.Mutex
+	addr     *net.UDPAddr
+	seq      uint32
+	srtt     time.Duration // smoothed round trip time of the acknowledged datagrams
+	disabled bool          // fell back to TCP
+}
+
+// timeout is how long an ack of the stream is waited
+func (st *datagramStream) timeout() time.Duration {
+	if d := 2 * st.srtt; d > config.DatagramAckTimeout {
+		return d
+	}
+	return config.DatagramAckTimeout
+}
+
+func (st *datagramStream) observe(rtt time.Duration) {
+	if st.srtt == 0 {
+		st.srtt = rtt
+		return
+	}
+	st.srtt = (7*st.srtt + rtt) / 8
+}
+
+// newDatagramSender creates a datagramSender, which gets the ConnDatagram connections to fall back to from pool
+func newDatagramSender(self plan.PeerID, pool *connectionPool) (*datagramSender, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	s := &datagramSender{
+		self:    self,
+		conn:    conn,
+		nonce:   rand.New(rand.NewSource(time.Now().UnixNano())).Uint32(),
+		streams: make(map[connKey]*datagramStream),
+		acks:    make(map[ackKey]chan struct{}),
+		fallback: func(remote plan.PeerID) connection.Connection {
+			return pool.get(remote, self, connection.ConnDatagram, false)
+		},
+	}
+	go s.recvAcks()
+	return s, nil
+}
+
+func (s *datagramSender) stream(remote plan.PeerID, t connection.ConnType) *datagramStream {
+	s.Lock()
+	defer s.Unlock()
+	key := connKey{a: remote, t: t}
+	if st, ok := s.streams[key]; ok {
+		return st
+	}
+	st := &datagramStream{}
+	if addr, err := net.ResolveUDPAddr("udp", remote.String()); err == nil {
+		st.addr = addr
+	} else {
+		st.disabled = true
+	}
+	s.streams[key] = st
+	return st
+}
+
+// send sends a message over UDP, or over TCP if the stream fell back
+func (s *datagramSender) send(remote plan.PeerID, name string, msg connection.Message, t connection.ConnType, flags uint32, token uint32) error {
+	return s.sendPacket(remote, name, t, token, func(h connection.DatagramHeader) []byte {
+		return connection.EncodeDatagram(h, name, msg, flags)
+	})
+}
+
+// sendEncoded sends an encoded message as send does
+func (s *datagramSender) sendEncoded(remote plan.PeerID, name string, e *connection.EncodedMessage, t connection.ConnType, token uint32) error {
+	return s.sendPacket(remote, name, t, token, func(h connection.DatagramHeader) []byte {
+		return connection.EncodeDatagramFrom(h, e)
+	})
+}
+
+func (s *datagramSender) sendPacket(remote plan.PeerID, name string, t connection.ConnType, token uint32, encode func(connection.DatagramHeader) []byte) error {
+	st := s.stream(remote, t)
+	st.Lock()
+	defer st.Unlock()
+	st.seq++
+	h := connection.DatagramHeader{
+		Type:    uint16(t),
+		SrcPort: s.self.Port,
+		SrcIPv4: s.self.IPv4,
+		Nonce:   s.nonce,
+		Seq:     st.seq,
+		Token:   token,
+	}
+	pkt := encode(h)
+	if st.disabled {
+		return s.sendTCP(remote, name, pkt)
+	}
+	key := ackKey{addr: st.addr.String(), t: t, seq: st.seq}
+	ch := make(chan struct{}, 1)
+	s.Lock()
+	s.acks[key] = ch
+	s.Unlock()
+	defer func() {
+		s.Lock()
+		delete(s.acks, key)
+		s.Unlock()
+	}()
+	for i := 0; i <= connection.DatagramRetryCount; i++ {
+		t0 := time.Now()
+		if _, err := s.conn.WriteToUDP(pkt, st.addr); err != nil {
+			break
+		}
+		select {
+		case <-ch:
+			if i == 0 {
+				st.observe(time.Since(t0)) // the ack of a retry may be of an earlier send
+			}
+			return nil
+		case <-time.After(st.timeout()):
+		}
+	}
+	log.Debugf("datagram %s to %s lost, falling back to TCP", name, remote)
+	st.disabled = true
+	return s.sendTCP(remote, name, pkt)
+}
+
+// sendTCP sends a datagram over the ConnDatagram connection to remote
+func (s *datagramSender) sendTCP(remote plan.PeerID, name string, pkt []byte) error {
+	conn := s.fallback(remote)
+	return conn.Send(name, connection.Message{Length: uint32(len(pkt)), Data: pkt}, connection.NoFlag)
+}
+
+func (s *datagramSender) recvAcks() {
+	buf := make([]byte, 1024)
+	for {
+		n, from, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		h, _, err := connection.DecodeDatagram(buf[:n])
+		if err != nil || !h.IsAck() || h.Nonce != s.nonce {
+			continue
+		}
+		key := ackKey{addr: from.String(), t: connection.ConnType(h.Type), seq: h.Seq}
+		s.Lock()
+		if ch, ok := s.acks[key]; ok {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+		s.Unlock()
+	}
+}
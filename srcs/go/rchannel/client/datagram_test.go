@@ -0,0 +1,147 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+	"github.com/lsds/KungFu/srcs/go/rchannel/server"
+)
+
+func freePort(t *testing.T) uint16 {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return uint16(l.Addr().(*net.TCPAddr).Port)
+}
+
+// dropAcks relays datagrams to target, and their acks back except those of the sequence numbers from lost
+func dropAcks(t *testing.T, target *net.UDPAddr, lost uint32) *net.UDPConn {
+	relay, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		var sender *net.UDPAddr
+		buf := make([]byte, 2*connection.MaxDatagramMessageSize)
+		for {
+			n, from, err := relay.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			h, _, err := connection.DecodeDatagram(buf[:n])
+			if err != nil {
+				continue
+			}
+			if !h.IsAck() {
+				sender = from
+				relay.WriteToUDP(buf[:n], target)
+			} else if h.Seq < lost {
+				relay.WriteToUDP(buf[:n], sender)
+			}
+		}
+	}()
+	return relay
+}
+
+func Test_DatagramLostAcks(t *testing.T) {
+	config.EnableDatagram = true // before the features are loaded
+	config.DatagramAckTimeout = time.Millisecond
+	const n = 8
+	const lost = 3 // the datagrams from #3 are delivered, but not acknowledged
+	got := make(chan string, 2*n)
+	handler := connection.HandlerFunc(func(conn connection.Connection) (int, error) {
+		return connection.Stream(conn, connection.Accept, func(name string, _ *connection.Message, _ connection.Connection) {
+			got <- name
+		})
+	})
+	ip := plan.MustParseIPv4("127.0.0.1")
+	remote := plan.PeerID{IPv4: ip, Port: freePort(t)}
+	srv := server.New(remote, handler, false)
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	self := plan.PeerID{IPv4: ip, Port: freePort(t)}
+	s, err := newDatagramSender(self, newConnectionPool(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.conn.Close()
+	relay := dropAcks(t, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: int(remote.Port)}, lost)
+	defer relay.Close()
+	s.stream(remote, connection.ConnControl).addr = relay.LocalAddr().(*net.UDPAddr)
+
+	for i := 0; i < n; i++ {
+		bs := []byte{byte(i)}
+		msg := connection.Message{Length: uint32(len(bs)), Data: bs}
+		if err := s.send(remote, fmt.Sprintf("msg-%d", i), msg, connection.ConnControl, connection.NoFlag, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if st := s.stream(remote, connection.ConnControl); !st.disabled {
+		t.Errorf("stream didn't fall back to TCP")
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case name := <-got:
+			if want := fmt.Sprintf("msg-%d", i); name != want {
+				t.Fatalf("received %s, expect %s", name, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d messages, expect %d", i, n)
+		}
+	}
+	select {
+	case name := <-got:
+		t.Errorf("received %s again", name)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func Test_DatagramFallbackToken(t *testing.T) {
+	config.EnableDatagram = true // before the features are loaded
+	got := make(chan string, 2)
+	handler := connection.HandlerFunc(func(conn connection.Connection) (int, error) {
+		return connection.Stream(conn, connection.Accept, func(name string, _ *connection.Message, _ connection.Connection) {
+			got <- name
+		})
+	})
+	ip := plan.MustParseIPv4("127.0.0.1")
+	remote := plan.PeerID{IPv4: ip, Port: freePort(t)}
+	srv := server.New(remote, handler, false)
+	srv.SetToken(2)
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	self := plan.PeerID{IPv4: ip, Port: freePort(t)}
+	s, err := newDatagramSender(self, newConnectionPool(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.conn.Close()
+	s.stream(remote, connection.ConnCollective).disabled = true
+	for i, name := range []string{"stale", "current"} {
+		msg := connection.Message{Length: 1, Data: []byte{byte(i)}}
+		if err := s.send(remote, name, msg, connection.ConnCollective, connection.NoFlag, uint32(i+1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case name := <-got:
+		if name != "current" {
+			t.Errorf("received %s of another session over TCP", name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("datagram of the current session not received")
+	}
+}
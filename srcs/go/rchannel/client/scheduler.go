@@ -0,0 +1,86 @@
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+// streamScheduler grants the turns of sending to a connection to the waiting streams in round robin,
+// so that a stream with many pending chunks doesn't block the others.
+type streamScheduler struct {
+	sync.Mutex
+	busy      bool
+	busySince time.Time // when the sender having the turn was queued
+	waiting   map[string][]waiter
+	order     []string // streams with waiting senders
+	depth     int      // number of waiting senders
+}
+
+type waiter struct {
+	ch    chan struct{}
+	since time.Time
+}
+
+func newStreamScheduler() *streamScheduler {
+	return &streamScheduler{
+		waiting: make(map[string][]waiter),
+	}
+}
+
+func (s *streamScheduler) acquire(stream string) {
+	now := time.Now()
+	s.Lock()
+	if !s.busy {
+		s.busy = true
+		s.busySince = now
+		s.Unlock()
+		return
+	}
+	ch := make(chan struct{})
+	if len(s.waiting[stream]) == 0 {
+		s.order = append(s.order, stream)
+	}
+	s.waiting[stream] = append(s.waiting[stream], waiter{ch: ch, since: now})
+	s.depth++
+	s.Unlock()
+	<-ch
+}
+
+// release ends the turn of the current sender, it returns true if the turn is handed over to a waiting sender
+func (s *streamScheduler) release() bool {
+	s.Lock()
+	defer s.Unlock()
+	if len(s.order) == 0 {
+		s.busy = false
+		return false
+	}
+	stream := s.order[0]
+	s.order = s.order[1:]
+	q := s.waiting[stream]
+	if len(q) > 1 {
+		s.waiting[stream] = q[1:]
+		s.order = append(s.order, stream)
+	} else {
+		delete(s.waiting, stream)
+	}
+	s.depth--
+	s.busySince = q[0].since
+	close(q[0].ch) // the turn is handed over, s.busy remains true
+	return true
+}
+
+// stats returns the number of messages queued or being sent, and the age of the oldest of them
+func (s *streamScheduler) stats() (int, time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	if !s.busy {
+		return 0, 0
+	}
+	oldest := s.busySince
+	for _, q := range s.waiting {
+		if q[0].since.Before(oldest) {
+			oldest = q[0].since
+		}
+	}
+	return s.depth + 1, time.Since(oldest)
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/monitor"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+)
+
+// fakeConn counts the messages buffered and the flushes, instead of writing them
+type fakeConn struct {
+	connection.Connection
+	sync.Mutex
+	names    []string
+	buffered int
+	flushed  int
+	flushes  int
+}
+
+func (c *fakeConn) Buffer(name string, m connection.Message, flags uint32) error {
+	time.Sleep(100 * time.Microsecond) // for the other senders to queue
+	c.Lock()
+	defer c.Unlock()
+	c.names = append(c.names, name)
+	c.buffered++
+	return nil
+}
+
+func (c *fakeConn) BufferEncoded(e *connection.EncodedMessage) error {
+	return c.Buffer("", connection.Message{}, connection.NoFlag)
+}
+
+func (c *fakeConn) Flush() error {
+	c.Lock()
+	defer c.Unlock()
+	if c.buffered > 0 {
+		c.flushes++
+		c.flushed += c.buffered
+		c.buffered = 0
+	}
+	return nil
+}
+
+func newFakeClient(remote plan.PeerID, conn connection.Connection) *Client {
+	c := &Client{connPool: newConnectionPool(false), monitor: monitor.GetMonitor()}
+	c.connPool.conns[connKey{a: remote, t: connection.ConnCollective}] = conn
+	return c
+}
+
+func Test_BatchQueuedSenders(t *testing.T) {
+	remote := plan.PeerID{IPv4: plan.MustParseIPv4("127.0.0.1"), Port: 10000}
+	conn := &fakeConn{}
+	c := newFakeClient(remote, conn)
+	const n = 64
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			c.Send(remote.WithName(fmt.Sprintf("msg-%d", i)), []byte{1}, connection.ConnCollective, connection.NoFlag)
+			wg.Done()
+		}(i)
+	}
+	wg.Wait()
+	if conn.flushed != n || conn.buffered != 0 {
+		t.Fatalf("flushed %d messages, %d left in buffer, expect %d flushed", conn.flushed, conn.buffered, n)
+	}
+	if conn.flushes >= n/2 {
+		t.Errorf("%d messages of concurrent senders are written by %d flushes", n, conn.flushes)
+	}
+}
+
+func Test_StreamsTakeTurns(t *testing.T) {
+	remote := plan.PeerID{IPv4: plan.MustParseIPv4("127.0.0.1"), Port: 10000}
+	conn := &fakeConn{}
+	c := newFakeClient(remote, conn)
+	s := c.connPool.scheduler(remote, connection.ConnCollective, false)
+	s.acquire("") // queue the chunks of both streams behind the current sender
+	const n = 16
+	var wg sync.WaitGroup
+	for _, stream := range []string{"gradients", "ema"} {
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(stream string, i int) {
+				c.SendOnStream(stream, remote.WithName(stream), []byte{1}, connection.ConnCollective, connection.NoFlag)
+				wg.Done()
+			}(stream, i)
+		}
+	}
+	for {
+		if depth, _ := s.stats(); depth == 2*n+1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	c.release(s, remote, connection.ConnCollective, false)
+	wg.Wait()
+	if len(conn.names) != 2*n {
+		t.Fatalf("sent %d messages, expect %d", len(conn.names), 2*n)
+	}
+	for i := 1; i < len(conn.names); i++ {
+		if conn.names[i] == conn.names[i-1] {
+			t.Fatalf("stream %s took two turns in a row at #%d: %v", conn.names[i], i, conn.names)
+		}
+	}
+}
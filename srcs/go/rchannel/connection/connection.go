@@ -1,6 +1,8 @@
 package connection
 
 import (
+	"bufio"
+	"encoding/binary"
 	"errors"
 	"io"
 	"net"
@@ -8,6 +10,8 @@ import (
 	"time"
 
 	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/kungfu/features"
+	"github.com/lsds/KungFu/srcs/go/kungfu/timeouts"
 	"github.com/lsds/KungFu/srcs/go/log"
 	"github.com/lsds/KungFu/srcs/go/plan"
 )
@@ -21,29 +25,81 @@ type Connection interface {
 	Src() plan.PeerID
 	Dest() plan.PeerID
 	Send(name string, m Message, flags uint32) error
+	SendEncoded(e *EncodedMessage) error
 	Read(name string, m Message) error
 }
 
-// UpgradeFrom performs the server side operations to upgrade a TCP connection to a Connection
+// Batcher is a Connection which can buffer the messages of consecutive senders, to write them to the network together
+type Batcher interface {
+	Connection
+	Buffer(name string, m Message, flags uint32) error
+	BufferEncoded(e *EncodedMessage) error
+	Flush() error
+}
+
+// Bits of the connection type in the connection header
+const (
+	duplexBit   uint16 = 1 << 15 // the connection also carries messages from the server side
+	priorityBit uint16 = 1 << 14 // the connection is dedicated to the priority stream
+)
+
+// UpgradeFrom performs the server side operations to upgrade a TCP connection to a Connection.
+// It returns ErrResumed if the connection resumes a stream which is already being handled.
 func UpgradeFrom(conn net.Conn, self plan.PeerID, token uint32) (Connection, error) {
 	var ch connectionHeader
 	if err := ch.ReadFrom(conn); err != nil {
 		return nil, err
 	}
+	var rh resumeHeader
+	if ch.Type&resumeBit != 0 {
+		if err := binary.Read(conn, endian, &rh); err != nil {
+			return nil, err
+		}
+	}
 	ack := connectionACK{
 		Token: token,
 	}
 	if err := ack.WriteTo(conn); err != nil {
 		return nil, err
 	}
+	src := plan.PeerID{IPv4: ch.SrcIPv4, Port: ch.SrcPort}
+	conn = shape(conn, self, src)
+	if ch.Type&resumeBit != 0 {
+		s, received, created := acceptResumable(conn, src, rh.ID)
+		if err := binary.Write(conn, endian, resumeACK{Received: received}); err != nil {
+			if created {
+				s.Close()
+			}
+			return nil, err
+		}
+		if !created {
+			return nil, ErrResumed
+		}
+		conn = s
+	}
 	return &tcpConnection{
-		src:      plan.PeerID{IPv4: ch.SrcIPv4, Port: ch.SrcPort},
+		src:      src,
 		dest:     self,
-		connType: ConnType(ch.Type),
+		connType: ConnType(ch.Type &^ (duplexBit | priorityBit | resumeBit)),
+		duplex:   ch.Type&duplexBit != 0,
+		priority: ch.Type&priorityBit != 0,
 		conn:     conn,
+		w:        bufio.NewWriter(conn),
 	}, nil
 }
 
+// IsDuplex returns true if the accepted connection can be used to send messages back to its source
+func IsDuplex(conn Connection) bool {
+	c, ok := conn.(*tcpConnection)
+	return ok && c.duplex
+}
+
+// IsPriority returns true if the accepted connection is dedicated to the priority stream of its source
+func IsPriority(conn Connection) bool {
+	c, ok := conn.(*tcpConnection)
+	return ok && c.priority
+}
+
 var errInvalidToken = errors.New("invalid token")
 
 func Open(remote, local plan.PeerID, t ConnType, token uint32, useUnixSock bool) (*tcpConnection, error) {
@@ -55,58 +111,143 @@ func Open(remote, local plan.PeerID, t ConnType, token uint32, useUnixSock bool)
 }
 
 func New(remote, local plan.PeerID, t ConnType, token uint32, useUnixSock bool) *tcpConnection {
-	init := func() (net.Conn, error) {
+	return newTCPConnection(remote, local, t, token, useUnixSock, false, nil)
+}
+
+// NewPriority creates a Connection dedicated to the priority stream, which is told apart from the others by remote
+func NewPriority(remote, local plan.PeerID, t ConnType, token uint32, useUnixSock bool) *tcpConnection {
+	return newTCPConnection(remote, local, t, token, useUnixSock, true, nil)
+}
+
+// NewDuplex creates a Connection which also carries messages from remote to local,
+// they are handled by established with the reversed Connection once the connection is established.
+func NewDuplex(remote, local plan.PeerID, t ConnType, token uint32, useUnixSock bool, established func(Connection)) *tcpConnection {
+	return newTCPConnection(remote, local, t, token, useUnixSock, false, established)
+}
+
+func newTCPConnection(remote, local plan.PeerID, t ConnType, token uint32, useUnixSock bool, priority bool, established func(Connection)) *tcpConnection {
+	duplex := established != nil
+	// the server side of a duplex connection also sends messages, which would be interleaved with acknowledgements
+	resumable := !duplex && (t == ConnCollective || t == ConnPeerToPeer) && features.Enabled(features.Resume)
+	dial := func(resumeID uint64) (net.Conn, uint64, error) {
 		conn, err := func() (net.Conn, error) {
+			if config.InprocTransport {
+				return dialInproc(remote)
+			}
 			if useUnixSock && remote.ColocatedWith(local) {
 				addr := net.UnixAddr{Name: remote.SockFile(), Net: "unix"}
 				return net.DialUnix(addr.Net, nil, &addr)
 			}
-			return net.Dial("tcp", remote.String())
+			if runner, ok := relayOf(remote, local); ok {
+				if conn, err := dialRelay(runner, remote, local); err != errNoRelay {
+					return conn, err
+				}
+			}
+			pacer.wait(config.DialRate)
+			return dialTCP(remote)
 		}()
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
+		conn = shape(conn, local, remote)
+		conn.SetDeadline(time.Now().Add(timeouts.Handshake()))
 		h := connectionHeader{
 			Type:    uint16(t),
 			SrcIPv4: local.IPv4,
 			SrcPort: local.Port,
 		}
+		if duplex {
+			h.Type |= duplexBit
+		}
+		if priority {
+			h.Type |= priorityBit
+		}
+		if resumeID != 0 {
+			h.Type |= resumeBit
+		}
 		if err := h.WriteTo(conn); err != nil {
-			return nil, err
+			conn.Close()
+			return nil, 0, err
+		}
+		if resumeID != 0 {
+			if err := binary.Write(conn, endian, resumeHeader{ID: resumeID}); err != nil {
+				conn.Close()
+				return nil, 0, err
+			}
 		}
 		var ack connectionACK
 		if err := ack.ReadFrom(conn); err != nil {
-			return nil, err
+			conn.Close()
+			return nil, 0, err
 		}
 		if ack.Token != token {
 			if t == ConnCollective {
 				conn.Close()
-				return nil, errInvalidToken
+				return nil, 0, errInvalidToken
 			}
 			// FIXME: ignored token check for other connection types
 		}
-		return conn, nil
+		var rack resumeACK
+		if resumeID != 0 {
+			if err := binary.Read(conn, endian, &rack); err != nil {
+				conn.Close()
+				return nil, 0, err
+			}
+		}
+		conn.SetDeadline(time.Time{})
+		return conn, rack.Received, nil
+	}
+	init := func() (net.Conn, error) {
+		if resumable {
+			c, err := newResumableConn(remote, dial)
+			if err != nil {
+				return nil, err
+			}
+			return c, nil
+		}
+		conn, _, err := dial(0)
+		return conn, err
 	}
 	var initRetry int
 	if t == ConnCollective || t == ConnPeerToPeer {
-		initRetry = config.ConnRetryCount
+		initRetry = int(timeouts.Connect() / config.ConnRetryPeriod)
 	}
 	return &tcpConnection{
-		init:      init,
-		src:       local,
-		dest:      remote,
-		initRetry: initRetry,
-		connType:  t,
+		init:        init,
+		src:         local,
+		dest:        remote,
+		initRetry:   initRetry,
+		connType:    t,
+		duplex:      duplex,
+		priority:    priority,
+		established: established,
 	}
 }
 
 type tcpConnection struct {
 	sync.Mutex
-	src, dest plan.PeerID
-	init      func() (net.Conn, error)
-	conn      net.Conn
-	initRetry int
-	connType  ConnType
+	src, dest   plan.PeerID
+	init        func() (net.Conn, error)
+	conn        net.Conn
+	w           *bufio.Writer
+	initRetry   int
+	connType    ConnType
+	duplex      bool
+	priority    bool
+	established func(Connection)
+}
+
+// reversedConnection is the view of a duplex connection from the remote side, for reading messages from remote
+type reversedConnection struct {
+	*tcpConnection
+}
+
+func (c reversedConnection) Src() plan.PeerID {
+	return c.dest
+}
+
+func (c reversedConnection) Dest() plan.PeerID {
+	return c.src
 }
 
 var errCantEstablishConnection = errors.New("can't establish connection")
@@ -138,30 +279,86 @@ func (c *tcpConnection) initOnce() error {
 		var err error
 		if c.conn, err = c.init(); err == nil {
 			log.Debugf("%s connection to #<%s> established after %d trials, took %s", c.connType, c.dest, i+1, time.Since(t0))
+			c.w = bufio.NewWriter(c.conn)
+			if c.established != nil {
+				go c.established(reversedConnection{c})
+			}
 			return nil
 		}
 		log.Debugf("failed to establish connection to #<%s> for %d times: %v", c.dest, i+1, err)
-		time.Sleep(config.ConnRetryPeriod)
+		time.Sleep(retryPeriod())
 	}
 	return errCantEstablishConnection
 }
 
+// Send writes the message to the network
 func (c *tcpConnection) Send(name string, m Message, flags uint32) error {
 	if err := c.initOnce(); err != nil {
 		return err
 	}
 	c.Lock()
 	defer c.Unlock()
+	if err := c.write(name, m, flags); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+// SendEncoded writes the encoded message as Send does, without encoding it again
+func (c *tcpConnection) SendEncoded(e *EncodedMessage) error {
+	if err := c.initOnce(); err != nil {
+		return err
+	}
+	c.Lock()
+	defer c.Unlock()
+	if _, err := c.w.Write(e.frame); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+// Buffer writes the message to a buffer, which is written to the network by Flush or the next Send
+func (c *tcpConnection) Buffer(name string, m Message, flags uint32) error {
+	if err := c.initOnce(); err != nil {
+		return err
+	}
+	c.Lock()
+	defer c.Unlock()
+	return c.write(name, m, flags)
+}
+
+// BufferEncoded writes the encoded message as Buffer does
+func (c *tcpConnection) BufferEncoded(e *EncodedMessage) error {
+	if err := c.initOnce(); err != nil {
+		return err
+	}
+	c.Lock()
+	defer c.Unlock()
+	_, err := c.w.Write(e.frame)
+	return err
+}
+
+// Flush writes the buffered messages to the network
+func (c *tcpConnection) Flush() error {
+	c.Lock()
+	defer c.Unlock()
+	if c.w == nil {
+		return nil
+	}
+	return c.w.Flush()
+}
+
+func (c *tcpConnection) write(name string, m Message, flags uint32) error {
 	bs := []byte(name)
 	mh := MessageHeader{
 		NameLength: uint32(len(bs)),
 		Name:       bs,
 		Flags:      flags,
 	}
-	if err := mh.WriteTo(c.conn); err != nil {
+	if err := mh.WriteTo(c.w); err != nil {
 		return err
 	}
-	return m.WriteTo(c.conn)
+	return m.WriteTo(c.w)
 }
 
 func (c *tcpConnection) Read(name string, m Message) error {
@@ -0,0 +1,151 @@
+package connection
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+// MaxDatagramMessageSize is the largest message payload sent via the datagram fast path
+const MaxDatagramMessageSize = 512
+
+// DatagramRetryCount is how many times a datagram is sent again before its stream falls back to TCP
+const DatagramRetryCount = 3
+
+const datagramAck uint16 = 1
+
+// DatagramHeader prefixes every datagram, a message datagram is followed by
+// a MessageHeader and a Message, in the same format as a stream connection.
+type DatagramHeader struct {
+	Type    uint16
+	Flags   uint16
+	SrcPort uint16
+	_       uint16
+	SrcIPv4 uint32
+	Nonce   uint32 // distinguishes restarted senders using the same PeerID
+	Seq     uint32
+	Token   uint32
+}
+
+var datagramHeaderSize = binary.Size(DatagramHeader{})
+
+func (h DatagramHeader) IsAck() bool {
+	return h.Flags&datagramAck == datagramAck
+}
+
+func (h DatagramHeader) Src() plan.PeerID {
+	return plan.PeerID{IPv4: h.SrcIPv4, Port: h.SrcPort}
+}
+
+// Ack returns the header of the acknowledgement of h
+func (h DatagramHeader) Ack() DatagramHeader {
+	h.Flags |= datagramAck
+	return h
+}
+
+// EncodeDatagram encodes a message datagram into a single packet
+func EncodeDatagram(h DatagramHeader, name string, m Message, flags uint32) []byte {
+	b := &bytes.Buffer{}
+	binary.Write(b, endian, &h)
+	if h.IsAck() {
+		return b.Bytes()
+	}
+	bs := []byte(name)
+	mh := MessageHeader{
+		NameLength: uint32(len(bs)),
+		Name:       bs,
+		Flags:      flags,
+	}
+	mh.WriteTo(b)
+	m.WriteTo(b)
+	return b.Bytes()
+}
+
+// EncodeDatagramFrom encodes a message datagram into a single packet from an encoded message
+func EncodeDatagramFrom(h DatagramHeader, e *EncodedMessage) []byte {
+	b := bytes.NewBuffer(make([]byte, 0, datagramHeaderSize+len(e.frame)))
+	binary.Write(b, endian, &h)
+	b.Write(e.frame)
+	return b.Bytes()
+}
+
+var errShortDatagram = errors.New("short datagram")
+
+// DecodeDatagram decodes the header of a packet, and returns the remaining payload
+func DecodeDatagram(pkt []byte) (*DatagramHeader, []byte, error) {
+	if len(pkt) < datagramHeaderSize {
+		return nil, nil, errShortDatagram
+	}
+	var h DatagramHeader
+	if err := binary.Read(bytes.NewReader(pkt), endian, &h); err != nil {
+		return nil, nil, err
+	}
+	return &h, pkt[datagramHeaderSize:], nil
+}
+
+// NewDatagramConnection creates a read only Connection which carries a single datagram payload
+func NewDatagramConnection(h DatagramHeader, self plan.PeerID, payload []byte) Connection {
+	return &datagramConnection{
+		src:      h.Src(),
+		dest:     self,
+		connType: ConnType(h.Type),
+		conn:     &payloadConn{Reader: bytes.NewReader(payload)},
+	}
+}
+
+type datagramConnection struct {
+	src, dest plan.PeerID
+	connType  ConnType
+	conn      *payloadConn
+}
+
+var errDatagramReadOnly = errors.New("datagram connection is read only")
+
+func (c *datagramConnection) Conn() net.Conn { return c.conn }
+
+func (c *datagramConnection) Type() ConnType { return c.connType }
+
+func (c *datagramConnection) Src() plan.PeerID { return c.src }
+
+func (c *datagramConnection) Dest() plan.PeerID { return c.dest }
+
+func (c *datagramConnection) Send(name string, m Message, flags uint32) error {
+	return errDatagramReadOnly
+}
+
+func (c *datagramConnection) SendEncoded(e *EncodedMessage) error {
+	return errDatagramReadOnly
+}
+
+func (c *datagramConnection) Read(name string, m Message) error {
+	var mh MessageHeader
+	if err := mh.Expect(c.conn, name); err != nil {
+		return err
+	}
+	return m.ReadInto(c.conn)
+}
+
+func (c *datagramConnection) Close() error { return nil }
+
+// payloadConn is a net.Conn that reads from a received datagram
+type payloadConn struct {
+	*bytes.Reader
+}
+
+func (c *payloadConn) Write(bs []byte) (int, error) { return 0, errDatagramReadOnly }
+
+func (c *payloadConn) Close() error { return nil }
+
+func (c *payloadConn) LocalAddr() net.Addr { return nil }
+
+func (c *payloadConn) RemoteAddr() net.Addr { return nil }
+
+func (c *payloadConn) SetDeadline(t time.Time) error { return nil }
+
+func (c *payloadConn) SetReadDeadline(t time.Time) error { return nil }
+
+func (c *payloadConn) SetWriteDeadline(t time.Time) error { return nil }
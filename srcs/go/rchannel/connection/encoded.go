@@ -0,0 +1,42 @@
+package connection
+
+import (
+	"sync/atomic"
+)
+
+// EncodedMessage is a MessageHeader and a Message encoded once for sending to many peers,
+// the encoded buffer is shared by all sends and returned to the pool after the last Release.
+type EncodedMessage struct {
+	frame  []byte
+	length uint32
+	refs   int32
+}
+
+// EncodeMessage encodes a message which will be sent refs times
+func EncodeMessage(name string, m Message, flags uint32, refs int) *EncodedMessage {
+	size := 4 + len(name) + 4 + 4 + len(m.Data)
+	frame := GetBuf(uint32(size))
+	endian.PutUint32(frame, uint32(len(name)))
+	off := 4 + copy(frame[4:], name)
+	endian.PutUint32(frame[off:], flags)
+	endian.PutUint32(frame[off+4:], m.Length)
+	copy(frame[off+8:], m.Data)
+	return &EncodedMessage{
+		frame:  frame,
+		length: m.Length,
+		refs:   int32(refs),
+	}
+}
+
+// Length returns the length of the Message
+func (e *EncodedMessage) Length() uint32 {
+	return e.length
+}
+
+// Release is called once for each send, the last one recycles the buffer
+func (e *EncodedMessage) Release() {
+	if atomic.AddInt32(&e.refs, -1) == 0 {
+		PutBuf(e.frame)
+		e.frame = nil
+	}
+}
@@ -0,0 +1,93 @@
+package connection
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/monitor"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/utils"
+)
+
+var hostAddrs struct {
+	sync.RWMutex
+	addrs plan.HostAddrs
+}
+
+// SetHostAddrs sets the public addresses of hosts, which are dialed besides the IPv4 of their peers,
+// those of config.PreferFamily first, so that hosts resolving only to IPv6 addresses are reachable.
+func SetHostAddrs(addrs plan.HostAddrs) {
+	hostAddrs.Lock()
+	defer hostAddrs.Unlock()
+	hostAddrs.addrs = addrs
+}
+
+func lookupHostAddr(ipv4 uint32) (string, bool) {
+	hostAddrs.RLock()
+	defer hostAddrs.RUnlock()
+	addr, ok := hostAddrs.addrs[ipv4]
+	return addr, ok
+}
+
+// familyAddr is an address of a peer, of the family 4 or 6
+type familyAddr struct {
+	addr   string
+	family int
+}
+
+func familyOf(ip net.IP) int {
+	if ip.To4() != nil {
+		return 4
+	}
+	return 6
+}
+
+// dialAddrs returns the addresses of remote, those of config.PreferFamily first
+func dialAddrs(remote plan.PeerID) []familyAddr {
+	addrs := []familyAddr{{addr: remote.String(), family: 4}}
+	host, ok := lookupHostAddr(remote.IPv4)
+	if !ok {
+		return addrs
+	}
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		var err error
+		if ips, err = net.LookupIP(host); err != nil {
+			log.Debugf("failed to resolve %s of %s: %v", host, remote, err)
+		}
+	}
+	port := strconv.Itoa(int(remote.Port))
+	for _, ip := range ips {
+		a := familyAddr{addr: net.JoinHostPort(ip.String(), port), family: familyOf(ip)}
+		if a.addr != addrs[0].addr {
+			addrs = append(addrs, a)
+		}
+	}
+	sort.SliceStable(addrs, func(i, j int) bool {
+		return addrs[i].family == config.PreferFamily && addrs[j].family != config.PreferFamily
+	})
+	return addrs
+}
+
+// dialFamilies dials the addresses of remote in the order of dialAddrs until one is connected,
+// the family of the connected address is recorded by monitor.RecordFamily.
+func dialFamilies(remote plan.PeerID) (net.Conn, error) {
+	addrs := dialAddrs(remote)
+	var errs []error
+	for _, a := range addrs {
+		conn, err := net.Dial("tcp", a.addr)
+		if err == nil {
+			monitor.RecordFamily(remote, a.family)
+			return conn, nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 1 {
+		return nil, errs[0]
+	}
+	return nil, utils.MergeErrors(errs, "dial "+remote.String())
+}
@@ -0,0 +1,35 @@
+package connection
+
+import (
+	"testing"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+func Test_dialAddrs(t *testing.T) {
+	defer SetHostAddrs(nil)
+	defer func(f int) { config.PreferFamily = f }(config.PreferFamily)
+	v6 := plan.PeerID{IPv4: plan.MustParseIPv4("10.0.0.2"), Port: 10000}
+	v4 := plan.PeerID{IPv4: plan.MustParseIPv4("10.0.0.3"), Port: 10000}
+	SetHostAddrs(plan.HostAddrs{v6.IPv4: "fd00::2"})
+	tests := []struct {
+		family int
+		peer   plan.PeerID
+		want   []string
+	}{
+		{4, v6, []string{"10.0.0.2:10000", "[fd00::2]:10000"}},
+		{6, v6, []string{"[fd00::2]:10000", "10.0.0.2:10000"}},
+		{6, v4, []string{"10.0.0.3:10000"}},
+	}
+	for _, tt := range tests {
+		config.PreferFamily = tt.family
+		var got []string
+		for _, a := range dialAddrs(tt.peer) {
+			got = append(got, a.addr)
+		}
+		if len(got) != len(tt.want) || got[0] != tt.want[0] || got[len(got)-1] != tt.want[len(tt.want)-1] {
+			t.Errorf("dialAddrs(%s) preferring IPv%d = %q, want %q", tt.peer, tt.family, got, tt.want)
+		}
+	}
+}
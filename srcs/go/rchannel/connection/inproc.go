@@ -0,0 +1,91 @@
+package connection
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+// InprocListener is a net.Listener of in-memory connections between peers of the same process
+type InprocListener struct {
+	self   plan.PeerID
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+var inprocListeners = struct {
+	sync.RWMutex
+	m map[plan.PeerID]*InprocListener
+}{
+	m: make(map[plan.PeerID]*InprocListener),
+}
+
+var (
+	errInprocAddrInUse    = errors.New("inproc address already in use")
+	errInprocConnRefused  = errors.New("inproc connection refused")
+	errInprocListenClosed = &net.OpError{Op: "accept", Net: "inproc", Err: net.ErrClosed}
+)
+
+// ListenInproc registers an in-memory listener for self
+func ListenInproc(self plan.PeerID) (*InprocListener, error) {
+	inprocListeners.Lock()
+	defer inprocListeners.Unlock()
+	if _, ok := inprocListeners.m[self]; ok {
+		return nil, errInprocAddrInUse
+	}
+	l := &InprocListener{
+		self:   self,
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+	inprocListeners.m[self] = l
+	return l, nil
+}
+
+func dialInproc(remote plan.PeerID) (net.Conn, error) {
+	inprocListeners.RLock()
+	l, ok := inprocListeners.m[remote]
+	inprocListeners.RUnlock()
+	if !ok {
+		return nil, errInprocConnRefused
+	}
+	client, server := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.closed:
+		return nil, errInprocConnRefused
+	}
+}
+
+func (l *InprocListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, errInprocListenClosed
+	}
+}
+
+func (l *InprocListener) Close() error {
+	l.once.Do(func() {
+		inprocListeners.Lock()
+		delete(inprocListeners.m, l.self)
+		inprocListeners.Unlock()
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *InprocListener) Addr() net.Addr {
+	return inprocAddr(l.self)
+}
+
+type inprocAddr plan.PeerID
+
+func (a inprocAddr) Network() string { return "inproc" }
+
+func (a inprocAddr) String() string { return plan.PeerID(a).String() }
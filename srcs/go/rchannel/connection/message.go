@@ -14,6 +14,9 @@ const (
 	ConnControl    ConnType = iota
 	ConnCollective ConnType = iota
 	ConnPeerToPeer ConnType = iota
+	ConnRelay      ConnType = iota // from a peer to its runner, relayed to a peer of another host, see UseRelay
+	ConnMux        ConnType = iota // between runners, carrying the relayed connections of their peers, see package mux
+	ConnDatagram   ConnType = iota // datagrams of a stream which fell back to TCP, each message carries one datagram
 )
 
 var (
@@ -30,6 +33,12 @@ func (t ConnType) String() string {
 		return "Collective"
 	case ConnPeerToPeer:
 		return "PeerToPeer"
+	case ConnRelay:
+		return "Relay"
+	case ConnMux:
+		return "Mux"
+	case ConnDatagram:
+		return "Datagram"
 	default:
 		return ""
 	}
@@ -65,6 +74,12 @@ func (a *connectionACK) ReadFrom(r io.Reader) error {
 	return binary.Read(r, endian, a)
 }
 
+// ClockName is the message name of a ConnPing request for the remote timestamp
+const ClockName = "clock"
+
+// DigestName is the message name of a ConnPing request for the digest served by the remote, see handler.PingHandler
+const DigestName = "digest"
+
 const NoFlag uint32 = 0
 
 const (
@@ -72,6 +87,9 @@ const (
 	WaitRecvBuf   uint32 = 1 << iota // The recevier should wait receive buffer
 	IsResponse    uint32 = 1 << iota // This is a response message for ConnPeerToPeer
 	RequestFailed uint32 = 1 << iota // This is a response meesage for failed request
+	IsBlob        uint32 = 1 << iota // This is a request or response of a blob of unknown size for ConnPeerToPeer
+	IsBlobRange   uint32 = 1 << iota // This is a request or response of a range of a blob for ConnPeerToPeer
+	RecvSegments  uint32 = 1 << iota // The receiver should reduce the message by segments while it is being read
 )
 
 type MessageHeader struct {
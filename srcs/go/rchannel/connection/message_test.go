@@ -3,6 +3,8 @@ package connection
 import (
 	"bytes"
 	"testing"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
 )
 
 func Test_connectionHeader(t *testing.T) {
@@ -112,3 +114,85 @@ func repeat(n int, str string) string {
 	}
 	return ss
 }
+
+func Test_Datagram(t *testing.T) {
+	h := DatagramHeader{
+		Type:    uint16(ConnControl),
+		SrcPort: 9999,
+		SrcIPv4: 0x7f080808,
+		Nonce:   42,
+		Seq:     7,
+	}
+	bs := []byte("123456")
+	pkt := EncodeDatagram(h, "name", Message{Length: uint32(len(bs)), Data: bs}, WaitRecvBuf)
+	h2, payload, err := DecodeDatagram(pkt)
+	if err != nil {
+		t.Fatalf("DecodeDatagram failed: %v", err)
+	}
+	if *h2 != h || h2.IsAck() {
+		t.Error("datagram header content not match")
+	}
+	conn := NewDatagramConnection(*h2, plan.PeerID{}, payload)
+	name, m, err := Accept(conn)
+	if err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+	if name != "name" || string(m.Data) != "123456" {
+		t.Error("datagram message content not match")
+	}
+	if ack := h.Ack(); !ack.IsAck() || ack.Seq != h.Seq {
+		t.Error("invalid datagram ack")
+	}
+}
+
+func Test_EncodeMessage(t *testing.T) {
+	bs := []byte("123456")
+	m := Message{Length: uint32(len(bs)), Data: bs}
+	want := &bytes.Buffer{}
+	mh := MessageHeader{NameLength: 4, Name: []byte("name"), Flags: WaitRecvBuf}
+	mh.WriteTo(want)
+	m.WriteTo(want)
+	e := EncodeMessage("name", m, WaitRecvBuf, 2)
+	if !bytes.Equal(e.frame, want.Bytes()) || e.Length() != m.Length {
+		t.Errorf("unexpected encoded message: %q", e.frame)
+	}
+	e.Release()
+	if e.frame == nil {
+		t.Errorf("released before the last send")
+	}
+	e.Release()
+	if e.frame != nil {
+		t.Errorf("not released after the last send")
+	}
+}
+
+func Test_ReadSegments(t *testing.T) {
+	bs := make([]byte, 2500)
+	for i := range bs {
+		bs[i] = byte(i)
+	}
+	b := &bytes.Buffer{}
+	m := Message{Length: uint32(len(bs)), Data: bs}
+	if err := m.WriteTo(b); err != nil {
+		t.Fatal(err)
+	}
+	b.WriteString("next")
+	got := make([]byte, len(bs))
+	var offsets []int
+	err := ReadSegments(b, len(bs), 1024, func(offset int, seg []byte) {
+		offsets = append(offsets, offset)
+		copy(got[offset:], seg)
+	})
+	if err != nil {
+		t.Fatalf("ReadSegments failed: %v", err)
+	}
+	if len(offsets) != 3 || offsets[2] != 2048 {
+		t.Errorf("unexpected segments at %v", offsets)
+	}
+	if !bytes.Equal(got, bs) {
+		t.Errorf("segments not match")
+	}
+	if b.String() != "next" {
+		t.Errorf("ReadSegments read beyond the message")
+	}
+}
@@ -0,0 +1,202 @@
+package connection
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/utils"
+	"github.com/lsds/KungFu/srcs/go/utils/strictjson"
+)
+
+// Scenario describes simulated network conditions between peers, see config.NetemScenario
+type Scenario struct {
+	Default *Link
+	Links   []Link // the first matching link applies
+}
+
+// Link describes the conditions from one peer to another
+type Link struct {
+	From      string       // IPv4 or IPv4:port of the sender, empty matches any peer
+	To        string       // IPv4 or IPv4:port of the receiver, empty matches any peer
+	Both      bool         // also applies from To to From
+	Latency   jsonDuration // one way delay
+	Jitter    jsonDuration // uniformly distributed extra delay, messages are never reordered
+	Bandwidth float64      // Mbit/s, 0 for unlimited
+	Loss      float64      // probability of a write being lost, which is delivered after lossPenalty
+}
+
+// lossPenalty is the delay of a lost write, which TCP retransmits after the minimal RTO
+const lossPenalty = 200 * time.Millisecond
+
+type jsonDuration time.Duration
+
+func (d *jsonDuration) UnmarshalJSON(bs []byte) error {
+	var s string
+	if err := json.Unmarshal(bs, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	*d = jsonDuration(v)
+	return err
+}
+
+func (l Link) matchOne(from, to plan.PeerID) bool {
+	return matchPeer(l.From, from) && matchPeer(l.To, to)
+}
+
+func (l Link) match(from, to plan.PeerID) bool {
+	return l.matchOne(from, to) || (l.Both && l.matchOne(to, from))
+}
+
+func matchPeer(pattern string, id plan.PeerID) bool {
+	return len(pattern) == 0 || pattern == plan.FormatIPv4(id.IPv4) || pattern == id.String()
+}
+
+func (s *Scenario) lookup(from, to plan.PeerID) *Link {
+	for i := range s.Links {
+		if s.Links[i].match(from, to) {
+			return &s.Links[i]
+		}
+	}
+	return s.Default
+}
+
+func LoadScenario(filename string) (*Scenario, error) {
+	var s Scenario
+	if err := strictjson.ReadFile(filename, &s); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %v", err)
+	}
+	return &s, nil
+}
+
+var scenario struct {
+	sync.Once
+	s *Scenario
+}
+
+func getScenario() *Scenario {
+	scenario.Do(func() {
+		if len(config.NetemScenario) == 0 {
+			return
+		}
+		s, err := LoadScenario(config.NetemScenario)
+		if err != nil {
+			utils.ExitErr(err)
+		}
+		log.Warnf("simulating network conditions of %s", config.NetemScenario)
+		scenario.s = s
+	})
+	return scenario.s
+}
+
+// shape applies the simulated conditions to writes from src to dest, if any
+func shape(conn net.Conn, src, dest plan.PeerID) net.Conn {
+	s := getScenario()
+	if s == nil {
+		return conn
+	}
+	l := s.lookup(src, dest)
+	if l == nil {
+		return conn
+	}
+	c := &shapedConn{
+		Conn:    conn,
+		link:    *l,
+		rng:     rand.New(rand.NewSource(int64(src.IPv4)<<16 ^ int64(src.Port)<<32 ^ int64(dest.Port) ^ time.Now().UnixNano())),
+		chunks:  make(chan chunk, 1024),
+		drained: make(chan struct{}),
+	}
+	go c.deliver()
+	return c
+}
+
+type chunk struct {
+	bs []byte
+	at time.Time
+}
+
+// shapedConn delays writes by latency, jitter and loss without blocking the writer,
+// and paces the writer to the bandwidth.
+type shapedConn struct {
+	net.Conn
+	link Link
+
+	mu        sync.Mutex
+	rng       *rand.Rand
+	busyUntil time.Time // when the last write leaves the sender at the bandwidth
+	lastAt    time.Time // when the last write arrives
+	closed    bool
+	err       error
+
+	chunks  chan chunk
+	drained chan struct{}
+}
+
+func (c *shapedConn) Write(bs []byte) (int, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return 0, net.ErrClosed
+	}
+	if c.err != nil {
+		c.mu.Unlock()
+		return 0, c.err
+	}
+	now := time.Now()
+	if c.busyUntil.Before(now) {
+		c.busyUntil = now
+	}
+	if bw := c.link.Bandwidth; bw > 0 {
+		c.busyUntil = c.busyUntil.Add(time.Duration(float64(len(bs)*8) / (bw * 1e6) * float64(time.Second)))
+	}
+	at := c.busyUntil.Add(time.Duration(c.link.Latency))
+	if j := c.link.Jitter; j > 0 {
+		at = at.Add(time.Duration(c.rng.Int63n(int64(j))))
+	}
+	if c.link.Loss > 0 && c.rng.Float64() < c.link.Loss {
+		at = at.Add(lossPenalty)
+	}
+	if at.Before(c.lastAt) {
+		at = c.lastAt
+	}
+	c.lastAt = at
+	busyUntil := c.busyUntil
+	c.chunks <- chunk{bs: append([]byte(nil), bs...), at: at} // under lock, so that chunks are queued in order
+	c.mu.Unlock()
+	time.Sleep(time.Until(busyUntil))
+	return len(bs), nil
+}
+
+func (c *shapedConn) deliver() {
+	defer close(c.drained)
+	for ch := range c.chunks {
+		time.Sleep(time.Until(ch.at))
+		if _, err := c.Conn.Write(ch.bs); err != nil {
+			c.mu.Lock()
+			c.err = err
+			c.mu.Unlock()
+			for range c.chunks {
+			}
+			return
+		}
+	}
+}
+
+// Close delivers pending writes before closing the connection
+func (c *shapedConn) Close() error {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.chunks)
+	}
+	c.mu.Unlock()
+	<-c.drained
+	return c.Conn.Close()
+}
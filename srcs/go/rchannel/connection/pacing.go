@@ -0,0 +1,40 @@
+package connection
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+)
+
+// dialPacer spaces out the TCP connections dialed by this peer, so that a large cluster forming at once
+// doesn't flood the listeners and the conntrack tables of the first hosts with SYNs.
+type dialPacer struct {
+	sync.Mutex
+	next time.Time
+}
+
+var pacer dialPacer
+
+// wait blocks until a connection can be dialed at no more than rate per second, 0 for unlimited
+func (p *dialPacer) wait(rate int) {
+	if rate <= 0 {
+		return
+	}
+	p.Lock()
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	t := p.next
+	p.next = p.next.Add(time.Second / time.Duration(rate))
+	p.Unlock()
+	time.Sleep(time.Until(t))
+}
+
+// retryPeriod jitters config.ConnRetryPeriod by up to half of it, so that peers failing at the same time don't retry in lockstep
+func retryPeriod() time.Duration {
+	d := config.ConnRetryPeriod
+	return d/2 + time.Duration(rand.Int63n(int64(d)))
+}
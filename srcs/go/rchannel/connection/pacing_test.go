@@ -0,0 +1,34 @@
+package connection
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+)
+
+func Test_dialPacer(t *testing.T) {
+	var p dialPacer
+	t0 := time.Now()
+	for i := 0; i < 5; i++ {
+		p.wait(100)
+	}
+	if d := time.Since(t0); d < 40*time.Millisecond {
+		t.Errorf("5 dials at 100/s took %s, want at least 40ms", d)
+	}
+	t0 = time.Now()
+	for i := 0; i < 5; i++ {
+		p.wait(0)
+	}
+	if d := time.Since(t0); d > 10*time.Millisecond {
+		t.Errorf("unlimited dials took %s", d)
+	}
+}
+
+func Test_retryPeriod(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if d := retryPeriod(); d < config.ConnRetryPeriod/2 || d >= config.ConnRetryPeriod*3/2 {
+			t.Fatalf("retryPeriod() = %s, out of range", d)
+		}
+	}
+}
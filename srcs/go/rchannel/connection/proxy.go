@@ -0,0 +1,211 @@
+package connection
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/utils"
+)
+
+// ProxyRules are the proxies to dial peers through, parsed from config.Proxy,
+// e.g. 10.0.1.2=direct,10.0.1.0:10000=http://proxy-a:3128,socks5://proxy-b:1080
+// The first rule matching the IPv4 or IPv4:port of the remote peer applies, a rule without pattern matches any peer.
+type ProxyRules []proxyRule
+
+type proxyRule struct {
+	pattern string
+	proxy   *url.URL // nil for direct connections
+}
+
+var errInvalidProxy = errors.New("invalid proxy, expect [<IPv4>[:<port>]=]socks5|http://<host>:<port> or direct")
+
+func ParseProxyRules(val string) (ProxyRules, error) {
+	var rs ProxyRules
+	for _, s := range strings.Split(val, ",") {
+		if s = strings.TrimSpace(s); len(s) == 0 {
+			continue
+		}
+		var r proxyRule
+		if i := strings.Index(s, "="); i >= 0 && !strings.Contains(s[:i], "://") {
+			r.pattern, s = s[:i], s[i+1:]
+		}
+		if s != "direct" {
+			u, err := url.Parse(s)
+			if err != nil || (u.Scheme != "socks5" && u.Scheme != "http") || len(u.Host) == 0 {
+				return nil, errInvalidProxy
+			}
+			r.proxy = u
+		}
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
+
+func (rs ProxyRules) lookup(remote plan.PeerID) *url.URL {
+	for _, r := range rs {
+		if matchPeer(r.pattern, remote) {
+			return r.proxy
+		}
+	}
+	return nil
+}
+
+var proxyRules struct {
+	sync.Once
+	rs ProxyRules
+}
+
+func getProxyRules() ProxyRules {
+	proxyRules.Do(func() {
+		if len(config.Proxy) == 0 {
+			return
+		}
+		rs, err := ParseProxyRules(config.Proxy)
+		if err != nil {
+			utils.ExitErr(fmt.Errorf("%s: %v", config.ProxyEnvKey, err))
+		}
+		log.Infof("dialing peers through proxies: %s", config.Proxy)
+		proxyRules.rs = rs
+	})
+	return proxyRules.rs
+}
+
+// dialTCP connects to remote directly over the addresses of dialFamilies, or through the proxy of the first matching rule
+func dialTCP(remote plan.PeerID) (net.Conn, error) {
+	proxy := getProxyRules().lookup(remote)
+	if proxy == nil {
+		return dialFamilies(remote)
+	}
+	conn, err := net.Dial("tcp", proxy.Host)
+	if err != nil {
+		return nil, err
+	}
+	switch proxy.Scheme {
+	case "socks5":
+		err = socks5Connect(conn, proxy.User, remote)
+	default:
+		conn, err = httpConnect(conn, proxy.User, remote)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %v", proxy.Host, err)
+	}
+	return conn, nil
+}
+
+var (
+	errSocks5Auth    = errors.New("socks5 authentication failed")
+	errSocks5Version = errors.New("not a socks5 proxy")
+)
+
+// socks5Connect performs the CONNECT command of RFC 1928, with username/password authentication of RFC 1929 if user is set
+func socks5Connect(conn net.Conn, user *url.Userinfo, remote plan.PeerID) error {
+	method := byte(0x00) // no authentication
+	if user != nil {
+		method = 0x02
+	}
+	if _, err := conn.Write([]byte{0x05, 1, method}); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 0x05 {
+		return errSocks5Version
+	}
+	if reply[1] != method {
+		return errSocks5Auth
+	}
+	if user != nil {
+		password, _ := user.Password()
+		req := []byte{0x01, byte(len(user.Username()))}
+		req = append(req, user.Username()...)
+		req = append(req, byte(len(password)))
+		req = append(req, password...)
+		if _, err := conn.Write(req); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0x00 {
+			return errSocks5Auth
+		}
+	}
+	req := []byte{0x05, 0x01, 0x00, 0x01, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(req[4:8], remote.IPv4)
+	binary.BigEndian.PutUint16(req[8:10], remote.Port)
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return err
+	}
+	if head[1] != 0x00 {
+		return fmt.Errorf("socks5 CONNECT to %s failed with code %d", remote, head[1])
+	}
+	var addrLen int // of the bound address, which is ignored
+	switch head[3] {
+	case 0x01:
+		addrLen = net.IPv4len
+	case 0x04:
+		addrLen = net.IPv6len
+	case 0x03:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(conn, n); err != nil {
+			return err
+		}
+		addrLen = int(n[0])
+	}
+	_, err := io.ReadFull(conn, make([]byte, addrLen+2))
+	return err
+}
+
+// httpConnect tunnels conn to remote by the CONNECT method of HTTP
+func httpConnect(conn net.Conn, user *url.Userinfo, remote plan.PeerID) (net.Conn, error) {
+	req := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", remote, remote)
+	if user != nil {
+		password, _ := user.Password()
+		req += "Proxy-Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(user.Username()+":"+password)) + "\r\n"
+	}
+	if _, err := io.WriteString(conn, req+"\r\n"); err != nil {
+		return conn, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		return conn, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return conn, fmt.Errorf("CONNECT to %s: %s", remote, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn reads the bytes buffered while reading the response of the proxy before the rest of the connection
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,40 @@
+package connection
+
+import (
+	"testing"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+func Test_ParseProxyRules(t *testing.T) {
+	rs, err := ParseProxyRules("10.0.0.2=direct, 10.0.0.3:10001=http://u:p@proxy-a:3128,socks5://proxy-b:1080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		peer  string
+		proxy string
+	}{
+		{"10.0.0.2:10000", ""},
+		{"10.0.0.3:10001", "proxy-a:3128"},
+		{"10.0.0.3:10002", "proxy-b:1080"},
+	}
+	for _, tt := range tests {
+		id, err := plan.ParsePeerID(tt.peer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var host string
+		if u := rs.lookup(*id); u != nil {
+			host = u.Host
+		}
+		if host != tt.proxy {
+			t.Errorf("proxy of %s is %q, want %q", tt.peer, host, tt.proxy)
+		}
+	}
+	for _, s := range []string{"ftp://proxy:21", "10.0.0.2=socks5://"} {
+		if _, err := ParseProxyRules(s); err == nil {
+			t.Errorf("ParseProxyRules(%q) should fail", s)
+		}
+	}
+}
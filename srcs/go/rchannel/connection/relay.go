@@ -0,0 +1,148 @@
+package connection
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/timeouts"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+// relayHeader follows the connection header of a ConnRelay connection, it's the peer the connection is relayed to
+type relayHeader struct {
+	DestPort uint16
+	DestIPv4 uint32
+}
+
+// relayACK follows the connectionACK of a ConnRelay connection, once the runner has reached the runner of the destination
+type relayACK struct {
+	OK uint8
+}
+
+var (
+	errRelayFailed = errors.New("relay failed")
+	errNoRelay     = errors.New("runner doesn't relay")
+)
+
+var relay struct {
+	sync.Mutex
+	runner plan.PeerID
+	on     bool
+	failed int32 // the runner doesn't relay, connections are dialed directly
+}
+
+// UseRelay makes the connections to peers of other hosts relayed by runner, which multiplexes the connections of all peers of a pair of hosts
+// into one connection between their runners. The connections to runner are over Unix sockets, which use no ports.
+func UseRelay(runner plan.PeerID) {
+	relay.Lock()
+	defer relay.Unlock()
+	relay.runner, relay.on = runner, true
+}
+
+func relayOf(remote, local plan.PeerID) (plan.PeerID, bool) {
+	relay.Lock()
+	defer relay.Unlock()
+	if !relay.on || local == relay.runner || remote.ColocatedWith(local) || atomic.LoadInt32(&relay.failed) != 0 {
+		return plan.PeerID{}, false
+	}
+	return relay.runner, true
+}
+
+// dialRelay connects to remote through the runner of local, it returns errNoRelay if the runner can't be reached,
+// then all connections are dialed directly.
+func dialRelay(runner, remote, local plan.PeerID) (net.Conn, error) {
+	addr := net.UnixAddr{Name: runner.SockFile(), Net: "unix"}
+	conn, err := net.DialUnix(addr.Net, nil, &addr)
+	if err != nil {
+		if atomic.CompareAndSwapInt32(&relay.failed, 0, 1) {
+			log.Warnf("runner %s doesn't relay connections: %v, dialing peers directly", runner, err)
+		}
+		return nil, errNoRelay
+	}
+	conn.SetDeadline(time.Now().Add(timeouts.Handshake()))
+	if err := relayHandshake(conn, remote, local); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("relay to %s by %s: %v", remote, runner, err)
+	}
+	return conn, nil
+}
+
+func relayHandshake(conn net.Conn, remote, local plan.PeerID) error {
+	h := connectionHeader{Type: uint16(ConnRelay), SrcIPv4: local.IPv4, SrcPort: local.Port}
+	if err := h.WriteTo(conn); err != nil {
+		return err
+	}
+	if err := binary.Write(conn, endian, relayHeader{DestPort: remote.Port, DestIPv4: remote.IPv4}); err != nil {
+		return err
+	}
+	var ack connectionACK
+	if err := ack.ReadFrom(conn); err != nil {
+		return err
+	}
+	var rack relayACK
+	if err := binary.Read(conn, endian, &rack); err != nil {
+		return err
+	}
+	if rack.OK == 0 {
+		return errRelayFailed
+	}
+	return nil
+}
+
+// AcceptRelay reads the destination of an accepted ConnRelay connection
+func AcceptRelay(conn Connection) (plan.PeerID, error) {
+	var h relayHeader
+	if err := binary.Read(conn.Conn(), endian, &h); err != nil {
+		return plan.PeerID{}, err
+	}
+	return plan.PeerID{IPv4: h.DestIPv4, Port: h.DestPort}, nil
+}
+
+// AckRelay tells the source of an accepted ConnRelay connection whether it's relayed, the connection is a byte stream to the destination afterwards
+func AckRelay(conn Connection, ok bool) error {
+	var rack relayACK
+	if ok {
+		rack.OK = 1
+	}
+	return binary.Write(conn.Conn(), endian, rack)
+}
+
+// Splice copies between a and b in both directions until both directions are closed, or either fails
+func Splice(a, b io.ReadWriteCloser) {
+	errs := make(chan error, 2)
+	half := func(dst, src io.ReadWriteCloser) {
+		_, err := io.Copy(dst, src)
+		if err == nil {
+			err = closeWrite(dst)
+		}
+		errs <- err
+	}
+	go half(a, b)
+	go half(b, a)
+	if err := <-errs; err != nil {
+		a.Close()
+		b.Close()
+	}
+	<-errs
+	a.Close()
+	b.Close()
+}
+
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// closeWrite closes c for writing, or fully if it can't be half closed
+func closeWrite(c io.ReadWriteCloser) error {
+	if cw, ok := c.(closeWriter); ok {
+		return cw.CloseWrite()
+	}
+	return c.Close()
+}
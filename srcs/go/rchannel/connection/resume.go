@@ -0,0 +1,460 @@
+package connection
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+// A resumable connection survives transient failures of the TCP connection under it, e.g. a reset by a middlebox.
+// The bytes sent are numbered by their offsets in the stream, and kept in a bounded replay buffer by the sender
+// until the receiver acknowledges them. After a failure, the sender dials again with the ID of the stream,
+// the receiver answers the offset it has read up to, and the sender retransmits the rest from the buffer.
+// Resumption works below the message framing, so that a message interrupted in the middle is neither lost
+// nor handled twice, even if it is being reduced by segments while it is read.
+// On each TCP connection, the bytes are sent in frames prefixed by their lengths, an empty frame closes the stream,
+// so that the receiver can tell a stream closed by the sender from a broken connection.
+
+// resumeBit in the connection header tells that a resumeHeader follows, and a resumeACK follows the connectionACK
+const resumeBit uint16 = 1 << 13
+
+type resumeHeader struct {
+	ID uint64
+}
+
+type resumeACK struct {
+	Received uint64 // the offset the receiver has read the stream up to, 0 for a new stream
+}
+
+// ackPeriod is the period of acknowledgements of a receiver, which are also sent once a quarter of the replay buffer is read
+const ackPeriod = 20 * time.Millisecond
+
+var (
+	errReplayLost    = errors.New("receiver lost the resumable stream")
+	errStreamClosed  = errors.New("resumable stream closed")
+	errResumeTimeout = errors.New("resumable stream not resumed in time")
+
+	// ErrResumed is returned by UpgradeFrom if the accepted connection resumes a stream being handled
+	ErrResumed = errors.New("connection resumed")
+)
+
+// resumeDialFunc dials the receiver and completes the handshake, resuming the stream of id,
+// it returns the offset the receiver has read the stream up to.
+type resumeDialFunc func(id uint64) (net.Conn, uint64, error)
+
+// resumableConn is the sending side of a resumable stream
+type resumableConn struct {
+	id     uint64
+	dest   plan.PeerID
+	dial   resumeDialFunc
+	limit  int
+	wmu    sync.Mutex // serializes writes and repairs
+	mu     sync.Mutex
+	cond   *sync.Cond
+	conn   net.Conn
+	sent   uint64 // offset of the end of the stream
+	acked  uint64 // offset the receiver acknowledged
+	buf    []byte // the bytes in [acked, sent)
+	broken net.Conn
+	closed bool
+}
+
+func newResumableConn(dest plan.PeerID, dial resumeDialFunc) (*resumableConn, error) {
+	c := &resumableConn{
+		id:    rand.Uint64() | 1, // never 0
+		dest:  dest,
+		dial:  dial,
+		limit: config.ReplayBufferSize,
+	}
+	c.cond = sync.NewCond(&c.mu)
+	conn, _, err := dial(c.id)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	go c.readAcks(conn)
+	return c, nil
+}
+
+func (c *resumableConn) Write(p []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	var n int
+	for len(p) > 0 {
+		k := len(p)
+		if k > c.limit {
+			k = c.limit
+		}
+		conn, err := c.reserve(p[:k])
+		if err != nil {
+			return n, err
+		}
+		if err := writeFrame(conn, p[:k]); err != nil {
+			if err := c.repair(conn); err != nil {
+				return n, err
+			}
+		}
+		n += k
+		p = p[k:]
+	}
+	return n, nil
+}
+
+// reserve waits until the replay buffer has room for p and appends it, the TCP connection to write p to is returned
+func (c *resumableConn) reserve(p []byte) (net.Conn, error) {
+	c.mu.Lock()
+	for len(c.buf)+len(p) > c.limit && !c.closed {
+		if c.broken == c.conn {
+			c.mu.Unlock()
+			if err := c.repair(c.broken); err != nil {
+				return nil, err
+			}
+			c.mu.Lock()
+			continue
+		}
+		c.cond.Wait()
+	}
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, errStreamClosed
+	}
+	c.buf = append(c.buf, p...)
+	c.sent += uint64(len(p))
+	return c.conn, nil
+}
+
+// readAcks trims the replay buffer by the acknowledgements received on conn,
+// and repairs the stream in background if conn fails while some bytes are unacknowledged.
+func (c *resumableConn) readAcks(conn net.Conn) {
+	for {
+		var received uint64
+		if err := binary.Read(conn, endian, &received); err != nil {
+			break
+		}
+		c.mu.Lock()
+		c.ack(received)
+		c.mu.Unlock()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || c.conn != conn {
+		return
+	}
+	c.broken = conn
+	c.cond.Broadcast()
+	conn.Close() // unblocks the writer
+	if c.sent > c.acked {
+		go func() {
+			c.wmu.Lock()
+			defer c.wmu.Unlock()
+			if err := c.repair(conn); err != nil {
+				log.Warnf("failed to resume connection to %s: %v", c.dest, err)
+			}
+		}()
+	}
+}
+
+// ack drops the bytes before received from the replay buffer, c.mu must be held
+func (c *resumableConn) ack(received uint64) {
+	if received <= c.acked || received > c.sent {
+		return
+	}
+	c.buf = c.buf[received-c.acked:]
+	c.acked = received
+	if len(c.buf) == 0 {
+		c.buf = nil // release the backing array
+	}
+	c.cond.Broadcast()
+}
+
+// repair replaces the broken TCP connection and retransmits the bytes not received, c.wmu must be held
+func (c *resumableConn) repair(broken net.Conn) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return errStreamClosed
+	}
+	if c.conn != broken {
+		c.mu.Unlock()
+		return nil // already repaired
+	}
+	c.mu.Unlock()
+	broken.Close()
+	log.Warnf("connection to %s broken, resuming", c.dest)
+	t0 := time.Now()
+	deadline := t0.Add(config.ReconnectTimeout)
+	for {
+		conn, received, err := c.dial(c.id)
+		if err == nil {
+			if err = c.resume(conn, received); err == nil {
+				log.Infof("connection to %s resumed after %s", c.dest, time.Since(t0))
+				return nil
+			}
+			conn.Close()
+			if err == errReplayLost || err == errStreamClosed {
+				return err
+			}
+		}
+		if time.Now().After(deadline) {
+			log.Errorf("failed to resume connection to %s in %s: %v", c.dest, config.ReconnectTimeout, err)
+			return errResumeTimeout
+		}
+		time.Sleep(retryPeriod())
+	}
+}
+
+func (c *resumableConn) resume(conn net.Conn, received uint64) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return errStreamClosed
+	}
+	if received < c.acked || received > c.sent || (received == 0 && c.acked > 0) {
+		c.mu.Unlock()
+		return errReplayLost
+	}
+	c.ack(received)
+	replay := append([]byte(nil), c.buf...)
+	c.conn = conn
+	c.broken = nil
+	c.cond.Broadcast()
+	c.mu.Unlock()
+	go c.readAcks(conn)
+	if len(replay) > 0 {
+		log.Debugf("retransmitting %d bytes to %s", len(replay), c.dest)
+	}
+	for len(replay) > 0 {
+		k := len(replay)
+		if k > c.limit {
+			k = c.limit
+		}
+		if err := writeFrame(conn, replay[:k]); err != nil {
+			return err
+		}
+		replay = replay[k:]
+	}
+	return nil
+}
+
+func (c *resumableConn) Read(p []byte) (int, error) {
+	return 0, errors.New("can't read from the sending side of a resumable stream")
+}
+
+// Close sends the empty frame after the pending writes, the bytes not acknowledged yet are still delivered by TCP
+func (c *resumableConn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true // fails the writers waiting for room
+	c.cond.Broadcast()
+	c.mu.Unlock()
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	conn := c.current()
+	writeFrame(conn, nil)
+	return conn.Close()
+}
+
+func (c *resumableConn) current() net.Conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn
+}
+
+func (c *resumableConn) LocalAddr() net.Addr                { return c.current().LocalAddr() }
+func (c *resumableConn) RemoteAddr() net.Addr               { return c.current().RemoteAddr() }
+func (c *resumableConn) SetDeadline(t time.Time) error      { return c.current().SetDeadline(t) }
+func (c *resumableConn) SetReadDeadline(t time.Time) error  { return c.current().SetReadDeadline(t) }
+func (c *resumableConn) SetWriteDeadline(t time.Time) error { return c.current().SetWriteDeadline(t) }
+
+// resumableStream is the receiving side of a resumable stream
+type resumableStream struct {
+	id       uint64
+	src      plan.PeerID
+	mu       sync.Mutex
+	cond     *sync.Cond
+	conn     net.Conn
+	reading  bool
+	frame    uint32 // bytes left in the current frame of conn
+	received uint64
+	acked    uint64
+	closed   bool
+	kick     chan struct{}
+}
+
+var resumableStreams = struct {
+	sync.Mutex
+	m map[uint64]*resumableStream
+}{
+	m: make(map[uint64]*resumableStream),
+}
+
+// acceptResumable attaches an accepted TCP connection to the stream it resumes, or to a new stream.
+// It returns the offset the stream has been read up to, and whether the stream is new.
+func acceptResumable(conn net.Conn, src plan.PeerID, id uint64) (*resumableStream, uint64, bool) {
+	resumableStreams.Lock()
+	s, ok := resumableStreams.m[id]
+	if !ok || s.src != src {
+		s = &resumableStream{id: id, src: src, conn: conn, kick: make(chan struct{}, 1)}
+		s.cond = sync.NewCond(&s.mu)
+		resumableStreams.m[id] = s
+		resumableStreams.Unlock()
+		go s.sendAcks()
+		return s, 0, true
+	}
+	resumableStreams.Unlock()
+	return s, s.attach(conn), false
+}
+
+// attach replaces the TCP connection of the stream, after the reader stopped reading the old one
+func (s *resumableStream) attach(conn net.Conn) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conn.Close()
+	for s.reading {
+		s.cond.Wait()
+	}
+	s.conn = conn
+	s.frame = 0
+	s.acked = s.received
+	s.cond.Broadcast()
+	log.Infof("connection from %s resumed at offset %d", s.src, s.received)
+	return s.received
+}
+
+func (s *resumableStream) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		if s.closed {
+			return 0, io.EOF
+		}
+		conn, frame := s.conn, s.frame
+		s.reading = true
+		s.mu.Unlock()
+		var n int
+		var err error
+		var ended bool
+		if frame == 0 {
+			err = binary.Read(conn, endian, &frame)
+			ended = err == nil && frame == 0
+		}
+		if err == nil && !ended {
+			k := len(p)
+			if uint32(k) > frame {
+				k = int(frame)
+			}
+			n, err = conn.Read(p[:k])
+		}
+		s.mu.Lock()
+		s.reading = false
+		if conn == s.conn {
+			s.frame = frame - uint32(n)
+		}
+		s.received += uint64(n)
+		s.cond.Broadcast()
+		if s.received-s.acked >= uint64(config.ReplayBufferSize/4) {
+			select {
+			case s.kick <- struct{}{}:
+			default:
+			}
+		}
+		if ended && conn == s.conn {
+			s.closed = true
+			return 0, io.EOF // the empty frame
+		}
+		if n > 0 || (err == nil && !ended) {
+			return n, nil
+		}
+		if conn == s.conn && !s.waitResume(conn) {
+			log.Warnf("connection from %s not resumed in %s: %v", s.src, config.ReconnectTimeout, err)
+			return 0, err
+		}
+	}
+}
+
+// waitResume waits for the sender to replace the broken connection, s.mu must be held
+func (s *resumableStream) waitResume(broken net.Conn) bool {
+	timer := time.AfterFunc(config.ReconnectTimeout, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.cond.Broadcast()
+	})
+	defer timer.Stop()
+	deadline := time.Now().Add(config.ReconnectTimeout)
+	for s.conn == broken && !s.closed && time.Now().Before(deadline) {
+		s.cond.Wait()
+	}
+	return s.conn != broken
+}
+
+// sendAcks acknowledges the offset read up to, periodically and when kicked by Read
+func (s *resumableStream) sendAcks() {
+	tk := time.NewTicker(ackPeriod)
+	defer tk.Stop()
+	for {
+		select {
+		case <-tk.C:
+		case <-s.kick:
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+		conn, received, changed := s.conn, s.received, s.received != s.acked
+		s.acked = received
+		s.mu.Unlock()
+		if changed {
+			binary.Write(conn, endian, received) // a failed ack is made up by the resumeACK
+		}
+	}
+}
+
+func (s *resumableStream) Write(p []byte) (int, error) {
+	return 0, errors.New("can't write to the receiving side of a resumable stream")
+}
+
+func (s *resumableStream) Close() error {
+	resumableStreams.Lock()
+	if resumableStreams.m[s.id] == s {
+		delete(resumableStreams.m, s.id)
+	}
+	resumableStreams.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.cond.Broadcast()
+	return s.conn.Close()
+}
+
+func (s *resumableStream) current() net.Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn
+}
+
+func (s *resumableStream) LocalAddr() net.Addr                { return s.current().LocalAddr() }
+func (s *resumableStream) RemoteAddr() net.Addr               { return s.current().RemoteAddr() }
+func (s *resumableStream) SetDeadline(t time.Time) error      { return s.current().SetDeadline(t) }
+func (s *resumableStream) SetReadDeadline(t time.Time) error  { return s.current().SetReadDeadline(t) }
+func (s *resumableStream) SetWriteDeadline(t time.Time) error { return s.current().SetWriteDeadline(t) }
+
+// writeFrame writes p prefixed by its length in one write
+func writeFrame(conn net.Conn, p []byte) error {
+	var hdr [4]byte
+	endian.PutUint32(hdr[:], uint32(len(p)))
+	bs := net.Buffers{hdr[:], p}
+	_, err := bs.WriteTo(conn)
+	return err
+}
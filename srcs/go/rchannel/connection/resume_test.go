@@ -0,0 +1,123 @@
+package connection
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/plan"
+)
+
+// resumeTestServer accepts resumable streams, and reads each new one to the end
+type resumeTestServer struct {
+	l        net.Listener
+	mu       sync.Mutex
+	accepted []net.Conn
+	received chan []byte
+}
+
+func newResumeTestServer(t *testing.T) *resumeTestServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &resumeTestServer{l: l, received: make(chan []byte, 1)}
+	go s.serve()
+	return s
+}
+
+func (s *resumeTestServer) serve() {
+	src := plan.PeerID{IPv4: 1, Port: 1}
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.accepted = append(s.accepted, conn)
+		s.mu.Unlock()
+		var rh resumeHeader
+		if err := binary.Read(conn, endian, &rh); err != nil {
+			continue
+		}
+		stream, received, created := acceptResumable(conn, src, rh.ID)
+		binary.Write(conn, endian, resumeACK{Received: received})
+		if created {
+			go func() {
+				bs, _ := ioutil.ReadAll(stream)
+				stream.Close()
+				s.received <- bs
+			}()
+		}
+	}
+}
+
+// breakLast closes the latest accepted TCP connection, as if it was reset
+func (s *resumeTestServer) breakLast() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accepted[len(s.accepted)-1].Close()
+}
+
+func (s *resumeTestServer) dial(id uint64) (net.Conn, uint64, error) {
+	conn, err := net.Dial("tcp", s.l.Addr().String())
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := binary.Write(conn, endian, resumeHeader{ID: id}); err != nil {
+		return nil, 0, err
+	}
+	var ack resumeACK
+	if err := binary.Read(conn, endian, &ack); err != nil {
+		return nil, 0, err
+	}
+	return conn, ack.Received, nil
+}
+
+func Test_ResumableConn(t *testing.T) {
+	defer func(n int, d time.Duration) { config.ReplayBufferSize, config.ReconnectTimeout = n, d }(config.ReplayBufferSize, config.ReconnectTimeout)
+	config.ReplayBufferSize = 64 << 10
+	config.ReconnectTimeout = 5 * time.Second
+	for _, breakSender := range []bool{true, false} {
+		srv := newResumeTestServer(t)
+		c, err := newResumableConn(plan.PeerID{}, srv.dial)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := make([]byte, 1<<20)
+		rand.Read(data)
+		const chunk = 10000
+		for i := 0; i < len(data); i += chunk {
+			j := i + chunk
+			if j > len(data) {
+				j = len(data)
+			}
+			if _, err := c.Write(data[i:j]); err != nil {
+				t.Fatalf("write failed at %d: %v", i, err)
+			}
+			if i == 30*chunk || i == 70*chunk {
+				if breakSender {
+					c.current().Close()
+				} else {
+					srv.breakLast()
+				}
+			}
+		}
+		c.Close()
+		select {
+		case got := <-srv.received:
+			if !bytes.Equal(got, data) {
+				t.Errorf("received %d bytes, differ from the %d sent", len(got), len(data))
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("stream not closed")
+		}
+		srv.l.Close()
+	}
+}
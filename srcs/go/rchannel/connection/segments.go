@@ -0,0 +1,60 @@
+package connection
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// SegmentFunc consumes a segment of a message at offset, seg can't be used after it returns
+type SegmentFunc func(offset int, seg []byte)
+
+type segment struct {
+	offset int
+	buf    []byte
+	n      int
+}
+
+// ReadSegments reads a message of the expected length from r by segments of the given size,
+// and calls f on each segment in another goroutine, so that f on a segment overlaps with reading the next one.
+// Two buffers of the segment size are used in turn.
+func ReadSegments(r io.Reader, length int, size int, f SegmentFunc) error {
+	var n uint32
+	if err := binary.Read(r, endian, &n); err != nil {
+		return err
+	}
+	if int(n) != length {
+		return errUnexpectedMessageLength
+	}
+	free := make(chan []byte, 2)
+	free <- GetBuf(uint32(size))
+	free <- GetBuf(uint32(size))
+	full := make(chan segment, 1)
+	done := make(chan struct{})
+	go func() {
+		for s := range full {
+			f(s.offset, s.buf[:s.n])
+			free <- s.buf
+		}
+		close(done)
+	}()
+	var err error
+	for offset := 0; offset < length; offset += size {
+		buf := <-free
+		k := size
+		if rest := length - offset; rest < k {
+			k = rest
+		}
+		if err = readN(r, buf[:k], k); err != nil {
+			free <- buf
+			break
+		}
+		full <- segment{offset: offset, buf: buf, n: k}
+	}
+	close(full)
+	<-done
+	close(free)
+	for buf := range free {
+		PutBuf(buf)
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+	"github.com/lsds/KungFu/srcs/go/store"
+)
+
+// blobGenerations tracks the number of times each blob was put,
+// so that a transfer in chunks can detect that the blob was replaced.
+type blobGenerations struct {
+	sync.RWMutex
+	gens map[string]uint64
+	next uint64
+}
+
+func (g *blobGenerations) put(s *store.Store, name string, data []byte) {
+	g.Lock()
+	defer g.Unlock()
+	if g.gens == nil {
+		g.gens = make(map[string]uint64)
+	}
+	g.next++
+	g.gens[name] = g.next
+	s.Put(name, data)
+}
+
+func (g *blobGenerations) get(s *store.Store, name string) (*store.Blob, uint64, error) {
+	g.RLock()
+	defer g.RUnlock()
+	blob, err := s.Get(name)
+	return blob, g.gens[name], err
+}
+
+// BlobChunk is a range of a blob
+type BlobChunk struct {
+	Total      int64  // size of the whole blob
+	Generation uint64 // changes when the blob is replaced
+	Offset     int64
+	Data       []byte
+}
+
+const (
+	blobRangeRequestSize = 16 // offset and length
+	blobRangeHeaderSize  = 16 // total size and generation
+)
+
+var errInvalidBlobRange = errors.New("invalid blob range")
+
+// chunkName makes the names of concurrent requests of different chunks distinct
+func chunkName(name string, offset int64) string {
+	return fmt.Sprintf("%s#%d", name, offset)
+}
+
+func blobNameOf(chunkName string) string {
+	if i := strings.LastIndex(chunkName, "#"); i >= 0 {
+		return chunkName[:i]
+	}
+	return chunkName
+}
+
+// GetBlobRange fetches at most length bytes of the blob saved by PutBlob on the target peer from offset,
+// it returns false if the blob doesn't exist.
+func (e *PeerToPeerEndpoint) GetBlobRange(target plan.PeerID, name string, offset, length int64) (*BlobChunk, bool, error) {
+	a := target.WithName(chunkName(name, offset))
+	flags := connection.IsBlob | connection.IsBlobRange
+	req := make([]byte, blobRangeRequestSize)
+	binary.LittleEndian.PutUint64(req[0:], uint64(offset))
+	binary.LittleEndian.PutUint64(req[8:], uint64(length))
+	m := &connection.Message{Flags: flags}
+	e.waitQ.require(a) <- m
+	if err := e.client.Send(a, req, connection.ConnPeerToPeer, flags); err != nil {
+		<-e.waitQ.require(a)
+		return nil, false, err
+	}
+	pm := <-e.recvQ.require(a)
+	if pm != m {
+		return nil, false, errRegisteredBufferNotUsed
+	}
+	if pm.HasFlag(connection.RequestFailed) {
+		return nil, false, nil
+	}
+	if len(pm.Data) < blobRangeHeaderSize {
+		return nil, false, errInvalidBlobRange
+	}
+	return &BlobChunk{
+		Total:      int64(binary.LittleEndian.Uint64(pm.Data[0:])),
+		Generation: binary.LittleEndian.Uint64(pm.Data[8:]),
+		Offset:     offset,
+		Data:       pm.Data[blobRangeHeaderSize:],
+	}, true, nil
+}
+
+func (e *PeerToPeerEndpoint) responseBlobRange(name string, req []byte, remote plan.PeerID) error {
+	flags := connection.IsResponse | connection.IsBlob | connection.IsBlobRange
+	blob, gen, err := e.blobGens.get(e.blobs, blobNameOf(name))
+	if err != nil || len(req) != blobRangeRequestSize {
+		return e.client.Send(remote.WithName(name), nil, connection.ConnPeerToPeer, flags|connection.RequestFailed)
+	}
+	offset := int64(binary.LittleEndian.Uint64(req[0:]))
+	length := int64(binary.LittleEndian.Uint64(req[8:]))
+	blob.RLock()
+	defer blob.RUnlock()
+	total := int64(len(blob.Data))
+	if offset < 0 || offset > total || length < 0 {
+		return e.client.Send(remote.WithName(name), nil, connection.ConnPeerToPeer, flags|connection.RequestFailed)
+	}
+	end := total
+	if offset+length < end {
+		end = offset + length
+	}
+	buf := make([]byte, blobRangeHeaderSize+int(end-offset))
+	binary.LittleEndian.PutUint64(buf[0:], uint64(total))
+	binary.LittleEndian.PutUint64(buf[8:], gen)
+	copy(buf[blobRangeHeaderSize:], blob.Data[offset:end])
+	return e.client.Send(remote.WithName(name), buf, connection.ConnPeerToPeer, flags)
+}
@@ -30,3 +30,45 @@ func (p *BufferPool) require(a plan.Addr) chan *connection.Message {
 	}
 	return m
 }
+
+// take removes the messages queued in the buffers
+func (p *BufferPool) take() map[plan.Addr]*connection.Message {
+	p.Lock()
+	defer p.Unlock()
+	ms := make(map[plan.Addr]*connection.Message)
+	for a, ch := range p.buffers {
+		select {
+		case m := <-ch:
+			ms[a] = m
+		default:
+		}
+	}
+	return ms
+}
+
+type sink struct {
+	length int
+	size   int
+	f      connection.SegmentFunc
+	done   chan error
+}
+
+type sinkPool struct {
+	sync.Mutex
+	sinks map[plan.Addr]chan *sink
+}
+
+func newSinkPool() *sinkPool {
+	return &sinkPool{sinks: make(map[plan.Addr]chan *sink)}
+}
+
+func (p *sinkPool) require(a plan.Addr) chan *sink {
+	p.Lock()
+	defer p.Unlock()
+	s, ok := p.sinks[a]
+	if !ok {
+		s = make(chan *sink, 1)
+		p.sinks[a] = s
+	}
+	return s
+}
@@ -2,6 +2,8 @@ package handler
 
 import (
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/lsds/KungFu/srcs/go/plan"
 	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
@@ -10,12 +12,14 @@ import (
 type CollectiveEndpoint struct {
 	waitQ *BufferPool
 	recvQ *BufferPool
+	sinkQ *sinkPool
 }
 
 func NewCollectiveEndpoint() *CollectiveEndpoint {
 	return &CollectiveEndpoint{
 		waitQ: newBufferPool(1),
 		recvQ: newBufferPool(1),
+		sinkQ: newSinkPool(),
 	}
 }
 
@@ -29,6 +33,16 @@ func (e *CollectiveEndpoint) Recv(a plan.Addr) connection.Message {
 	return *m
 }
 
+// RecvTimeout is Recv with a timeout, a message arriving later is left to the next Recv of a
+func (e *CollectiveEndpoint) RecvTimeout(a plan.Addr, d time.Duration) (connection.Message, bool) {
+	select {
+	case m := <-e.recvQ.require(a):
+		return *m, true
+	case <-time.After(d):
+		return connection.Message{}, false
+	}
+}
+
 var errRegisteredBufferNotUsed = errors.New("registered buffer not used")
 
 func (e *CollectiveEndpoint) RecvInto(a plan.Addr, m connection.Message) error {
@@ -40,6 +54,45 @@ func (e *CollectiveEndpoint) RecvInto(a plan.Addr, m connection.Message) error {
 	return nil
 }
 
+// RecvSegments consumes a message sent with the RecvSegments flag by segments of the given size while it is being read,
+// see connection.ReadSegments.
+func (e *CollectiveEndpoint) RecvSegments(a plan.Addr, length int, size int, f connection.SegmentFunc) error {
+	s := &sink{length: length, size: size, f: f, done: make(chan error, 1)}
+	e.sinkQ.require(a) <- s
+	return <-s.done
+}
+
+// PendingMessage is a message received by a CollectiveEndpoint, which is not consumed by Recv yet
+type PendingMessage struct {
+	Src  plan.PeerID
+	Name string
+	Data []byte
+}
+
+// TakePending removes the pending messages, which are handed over to the endpoint of another peer by RestorePending
+func (e *CollectiveEndpoint) TakePending() []PendingMessage {
+	var ms []PendingMessage
+	for a, m := range e.recvQ.take() {
+		ms = append(ms, PendingMessage{Src: a.Peer(), Name: a.Name, Data: m.Data})
+	}
+	return ms
+}
+
+var errPendingQueueFull = errors.New("a message of the same name is already pending")
+
+// RestorePending queues the messages taken by TakePending, as if they were received by e
+func (e *CollectiveEndpoint) RestorePending(ms []PendingMessage) error {
+	for _, pm := range ms {
+		m := &connection.Message{Length: uint32(len(pm.Data)), Data: pm.Data}
+		select {
+		case e.recvQ.require(pm.Src.WithName(pm.Name)) <- m:
+		default:
+			return fmt.Errorf("%v: %s from %s", errPendingQueueFull, pm.Name, pm.Src)
+		}
+	}
+	return nil
+}
+
 func (e *CollectiveEndpoint) accept(conn connection.Connection) (string, *connection.Message, error) {
 	var mh connection.MessageHeader
 	if err := mh.ReadFrom(conn.Conn()); err != nil {
@@ -53,6 +106,15 @@ func (e *CollectiveEndpoint) accept(conn connection.Connection) (string, *connec
 		}
 		return name, m, nil
 	}
+	if mh.HasFlag(connection.RecvSegments) {
+		s := <-e.sinkQ.require(conn.Src().WithName(name))
+		err := connection.ReadSegments(conn.Conn(), s.length, s.size, s.f)
+		s.done <- err
+		if err != nil {
+			return "", nil, err
+		}
+		return name, nil, nil
+	}
 	var m connection.Message
 	if err := m.ReadFrom(conn.Conn()); err != nil {
 		return "", nil, err
@@ -61,5 +123,8 @@ func (e *CollectiveEndpoint) accept(conn connection.Connection) (string, *connec
 }
 
 func (e *CollectiveEndpoint) handle(name string, msg *connection.Message, conn connection.Connection) {
+	if msg == nil { // consumed by RecvSegments
+		return
+	}
 	e.recvQ.require(conn.Src().WithName(name)) <- msg
 }
@@ -2,22 +2,42 @@ package handler
 
 import (
 	"os"
+	"sync"
 
 	"github.com/lsds/KungFu/srcs/go/log"
 	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
 )
 
 type ControlHandler struct {
+	mu       sync.RWMutex
+	handlers map[string]connection.MsgHandleFunc
+}
+
+// Register handles control messages of the given name with f
+func (h *ControlHandler) Register(name string, f connection.MsgHandleFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.handlers == nil {
+		h.handlers = make(map[string]connection.MsgHandleFunc)
+	}
+	h.handlers[name] = f
 }
 
 func (h *ControlHandler) Handle(conn connection.Connection) (int, error) {
 	return connection.Stream(conn, connection.Accept, h.handleControl)
 }
 
-func (h *ControlHandler) handleControl(name string, msg *connection.Message, _conn connection.Connection) {
+func (h *ControlHandler) handleControl(name string, msg *connection.Message, conn connection.Connection) {
 	if name == "exit" {
 		log.Errorf("exit control message received.")
 		os.Exit(0)
 	}
+	h.mu.RLock()
+	f, ok := h.handlers[name]
+	h.mu.RUnlock()
+	if ok {
+		f(name, msg, conn)
+		return
+	}
 	log.Errorf("unexpected control message: %q", name)
 }
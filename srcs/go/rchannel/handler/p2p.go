@@ -13,6 +13,8 @@ const defaultVersionCount = 3
 type PeerToPeerEndpoint struct {
 	versionedStore *store.VersionedStore
 	store          *store.Store
+	blobs          *store.Store
+	blobGens       blobGenerations
 	waitQ          *BufferPool
 	recvQ          *BufferPool
 	client         *client.Client
@@ -22,6 +24,7 @@ func NewPeerToPeerEndpoint(client *client.Client) *PeerToPeerEndpoint {
 	return &PeerToPeerEndpoint{
 		versionedStore: store.NewVersionedStore(defaultVersionCount),
 		store:          store.NewStore(),
+		blobs:          store.NewStore(),
 		waitQ:          newBufferPool(1),
 		recvQ:          newBufferPool(1),
 		client:         client,
@@ -46,6 +49,29 @@ func (e *PeerToPeerEndpoint) Request(a plan.Addr, version string, m connection.M
 	return !pm.HasFlag(connection.RequestFailed), nil
 }
 
+// GetBlob fetches the blob saved by PutBlob on the remote peer, it returns false if the blob doesn't exist
+func (e *PeerToPeerEndpoint) GetBlob(a plan.Addr) ([]byte, bool, error) {
+	m := &connection.Message{Flags: connection.IsBlob}
+	e.waitQ.require(a) <- m
+	if err := e.client.Send(a, nil, connection.ConnPeerToPeer, connection.IsBlob); err != nil {
+		<-e.waitQ.require(a)
+		return nil, false, err
+	}
+	pm := <-e.recvQ.require(a)
+	if pm != m {
+		return nil, false, errRegisteredBufferNotUsed
+	}
+	if pm.HasFlag(connection.RequestFailed) {
+		return nil, false, nil
+	}
+	return pm.Data, true, nil
+}
+
+// PutBlob saves a copy of data of any size, which can be fetched by other peers with GetBlob
+func (e *PeerToPeerEndpoint) PutBlob(name string, data []byte) {
+	e.blobGens.put(e.blobs, name, data)
+}
+
 func (e *PeerToPeerEndpoint) Save(name string, buf *kb.Vector) error {
 	blob, err := e.store.GetOrCreate(name, len(buf.Data))
 	if err != nil {
@@ -62,6 +88,26 @@ func (e *PeerToPeerEndpoint) SaveVersion(version, name string, buf *kb.Vector) e
 	return blob.CopyFrom(buf.Data)
 }
 
+// PeerToPeerState is a copy of the blobs saved in a PeerToPeerEndpoint
+type PeerToPeerState struct {
+	Blobs    map[string][]byte
+	Versions []store.VersionSnapshot
+}
+
+func (e *PeerToPeerEndpoint) Snapshot() PeerToPeerState {
+	return PeerToPeerState{
+		Blobs:    e.store.Snapshot(),
+		Versions: e.versionedStore.Snapshot(),
+	}
+}
+
+func (e *PeerToPeerEndpoint) Restore(s PeerToPeerState) error {
+	if err := e.store.Restore(s.Blobs); err != nil {
+		return err
+	}
+	return e.versionedStore.Restore(s.Versions)
+}
+
 func (e *PeerToPeerEndpoint) accept(conn connection.Connection) (string, *connection.Message, error) {
 	var mh connection.MessageHeader
 	if err := mh.ReadFrom(conn.Conn()); err != nil {
@@ -78,6 +124,12 @@ func (e *PeerToPeerEndpoint) accept(conn connection.Connection) (string, *connec
 			}
 			return name, m, nil
 		}
+		if mh.HasFlag(connection.IsBlob) {
+			if err := m.ReadFrom(conn.Conn()); err != nil {
+				return "", nil, err
+			}
+			return name, m, nil
+		}
 		if err := m.ReadInto(conn.Conn()); err != nil {
 			return "", nil, err
 		}
@@ -96,18 +148,27 @@ func (e *PeerToPeerEndpoint) handle(name string, msg *connection.Message, conn c
 		e.recvQ.require(conn.Src().WithName(name)) <- msg
 		return
 	}
-	go e.response(name, msg.Data, conn.Src()) // FIXME: check error, use one queue
+	if msg.HasFlag(connection.IsBlobRange) {
+		go e.responseBlobRange(name, msg.Data, conn.Src())
+		return
+	}
+	go e.response(name, msg.Data, msg.HasFlag(connection.IsBlob), conn.Src()) // FIXME: check error, use one queue
 }
 
-func (e *PeerToPeerEndpoint) response(name string, version []byte, remote plan.PeerID) error {
+func (e *PeerToPeerEndpoint) response(name string, version []byte, isBlob bool, remote plan.PeerID) error {
 	var blob *store.Blob
 	var err error
-	if len(version) == 0 {
+	if isBlob {
+		blob, err = e.blobs.Get(name)
+	} else if len(version) == 0 {
 		blob, err = e.store.Get(name)
 	} else {
 		blob, err = e.versionedStore.Get(string(version), name)
 	}
 	flags := connection.IsResponse
+	if isBlob {
+		flags |= connection.IsBlob
+	}
 	var buf []byte
 	if err == nil {
 		blob.RLock()
@@ -1,10 +1,14 @@
 package handler
 
 import (
+	"encoding/binary"
+	"time"
+
 	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
 )
 
 type PingHandler struct {
+	Digest []byte // answered to DigestName requests, e.g. the digest of the initial cluster of a runner
 }
 
 func (h *PingHandler) Handle(conn connection.Connection) (int, error) {
@@ -12,8 +16,23 @@ func (h *PingHandler) Handle(conn connection.Connection) (int, error) {
 	if err != nil {
 		return 0, err
 	}
+	switch name {
+	case connection.ClockName:
+		*msg = clockMessage()
+	case connection.DigestName:
+		*msg = connection.Message{Length: uint32(len(h.Digest)), Data: h.Digest}
+	}
 	if err := conn.Send(name, *msg, connection.NoFlag); err != nil {
 		return 1, err
 	}
 	return 1, nil
 }
+
+func clockMessage() connection.Message {
+	bs := make([]byte, 8)
+	binary.LittleEndian.PutUint64(bs, uint64(time.Now().UnixNano()))
+	return connection.Message{
+		Length: uint32(len(bs)),
+		Data:   bs,
+	}
+}
@@ -0,0 +1,375 @@
+// Package mux multiplexes streams over a connection, so that the peers of a pair of hosts share one TCP connection between their runners,
+// instead of a connection for each pair of peers, which exhausts ephemeral ports and conntrack entries on hosts of many peers.
+// Each stream has a window of bytes the sender may send before the receiver reads them, so that a slow reader never blocks the other streams.
+package mux
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// Frame types
+const (
+	frameOpen   byte = iota // the payload is the header of a new stream
+	frameData               // the payload is data of a stream
+	frameWindow             // the length is the number of bytes the sender of the stream may send more
+	frameClose              // the sender will send no more data on the stream
+	frameReset              // the stream is refused or aborted
+)
+
+const (
+	headerSize    = 9 // type, stream ID and length
+	maxFrameSize  = 64 << 10
+	initialWindow = 1 << 20
+)
+
+var (
+	ErrSessionClosed = errors.New("mux session closed")
+	errStreamReset   = errors.New("mux stream reset")
+	errStreamClosed  = errors.New("mux stream closed for writing")
+	errDuplicateOpen = errors.New("mux stream opened twice")
+	errInvalidFrame  = errors.New("invalid mux frame")
+	errFrameTooLarge = errors.New("mux frame too large")
+
+	endian = binary.BigEndian
+)
+
+// AcceptFunc handles a stream opened by the remote side of a Session, given the header of the stream
+type AcceptFunc func(s *Stream, header []byte)
+
+// Session multiplexes streams over a connection, both sides of which may open streams
+type Session struct {
+	conn   net.Conn
+	accept AcceptFunc
+
+	wmu sync.Mutex
+	w   *bufio.Writer
+
+	mu      sync.Mutex
+	streams map[uint32]*Stream
+	nextID  uint32
+	err     error
+	done    chan struct{}
+}
+
+// NewSession creates a Session over conn, the streams opened by the dialing side have odd IDs, those by the accepting side even IDs
+func NewSession(conn net.Conn, dialer bool, accept AcceptFunc) *Session {
+	s := &Session{
+		conn:    conn,
+		accept:  accept,
+		w:       bufio.NewWriterSize(conn, headerSize+maxFrameSize),
+		streams: make(map[uint32]*Stream),
+		nextID:  2,
+		done:    make(chan struct{}),
+	}
+	if dialer {
+		s.nextID = 1
+	}
+	return s
+}
+
+// Open opens a stream, header is passed to the AcceptFunc of the remote side
+func (s *Session) Open(header []byte) (*Stream, error) {
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return nil, s.err
+	}
+	id := s.nextID
+	s.nextID += 2
+	st := newStream(s, id)
+	s.streams[id] = st
+	s.mu.Unlock()
+	if err := s.writeFrame(frameOpen, id, uint32(len(header)), header); err != nil {
+		s.remove(id)
+		return nil, err
+	}
+	return st, nil
+}
+
+// NumStreams returns the number of open streams
+func (s *Session) NumStreams() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams)
+}
+
+// Done is closed when the Session is closed
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close closes the connection and all streams
+func (s *Session) Close() error {
+	s.closeWith(ErrSessionClosed)
+	return nil
+}
+
+func (s *Session) closeWith(err error) {
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.err = err
+	streams := s.streams
+	s.streams = make(map[uint32]*Stream)
+	s.mu.Unlock()
+	s.conn.Close()
+	close(s.done)
+	for _, st := range streams {
+		st.abort(err)
+	}
+}
+
+func (s *Session) writeFrame(t byte, id, length uint32, payload []byte) error {
+	var h [headerSize]byte
+	h[0] = t
+	endian.PutUint32(h[1:], id)
+	endian.PutUint32(h[5:], length)
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	if _, err := s.w.Write(h[:]); err != nil {
+		s.closeWith(err)
+		return err
+	}
+	if _, err := s.w.Write(payload); err != nil {
+		s.closeWith(err)
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		s.closeWith(err)
+		return err
+	}
+	return nil
+}
+
+func (s *Session) lookup(id uint32) *Stream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.streams[id]
+}
+
+func (s *Session) remove(id uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.streams, id)
+}
+
+// Serve reads frames until the connection is closed, it never blocks on the readers of streams
+func (s *Session) Serve() error {
+	err := s.serve()
+	s.closeWith(err)
+	return err
+}
+
+func (s *Session) serve() error {
+	r := bufio.NewReaderSize(s.conn, headerSize+maxFrameSize)
+	var h [headerSize]byte
+	for {
+		if _, err := io.ReadFull(r, h[:]); err != nil {
+			if err == io.EOF {
+				return ErrSessionClosed
+			}
+			return err
+		}
+		t, id, n := h[0], endian.Uint32(h[1:]), endian.Uint32(h[5:])
+		switch t {
+		case frameOpen, frameData:
+			if n > maxFrameSize {
+				return fmt.Errorf("%v: %d bytes", errFrameTooLarge, n)
+			}
+			payload := make([]byte, n)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return err
+			}
+			if t == frameOpen {
+				st, err := s.opened(id)
+				if err != nil {
+					return err
+				}
+				go s.accept(st, payload)
+			} else if st := s.lookup(id); st != nil {
+				st.push(payload)
+			}
+		case frameWindow:
+			if st := s.lookup(id); st != nil {
+				st.grant(n)
+			}
+		case frameClose:
+			if st := s.lookup(id); st != nil {
+				st.remoteClosed()
+			}
+		case frameReset:
+			if st := s.lookup(id); st != nil {
+				s.remove(id)
+				st.abort(errStreamReset)
+			}
+		default:
+			return fmt.Errorf("%v: type %d", errInvalidFrame, t)
+		}
+	}
+}
+
+func (s *Session) opened(id uint32) (*Stream, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.streams[id]; ok {
+		return nil, fmt.Errorf("%v: %d", errDuplicateOpen, id)
+	}
+	st := newStream(s, id)
+	s.streams[id] = st
+	return st, nil
+}
+
+// Stream is a duplex byte stream of a Session
+type Stream struct {
+	id   uint32
+	sess *Session
+
+	mu          sync.Mutex
+	cond        *sync.Cond
+	recv        [][]byte // received but not read yet
+	consumed    uint32   // read since the last window update sent
+	window      uint32   // bytes that may be sent before the next window update received
+	readClosed  bool     // the remote side closed the stream for writing
+	writeClosed bool
+	err         error
+}
+
+func newStream(s *Session, id uint32) *Stream {
+	st := &Stream{id: id, sess: s, window: initialWindow}
+	st.cond = sync.NewCond(&st.mu)
+	return st
+}
+
+func (st *Stream) push(bs []byte) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if len(bs) > 0 {
+		st.recv = append(st.recv, bs)
+	}
+	st.cond.Broadcast()
+}
+
+func (st *Stream) grant(n uint32) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.window += n
+	st.cond.Broadcast()
+}
+
+func (st *Stream) remoteClosed() {
+	st.mu.Lock()
+	st.readClosed = true
+	done := st.writeClosed
+	st.cond.Broadcast()
+	st.mu.Unlock()
+	if done {
+		st.sess.remove(st.id)
+	}
+}
+
+func (st *Stream) abort(err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.err == nil {
+		st.err = err
+	}
+	st.cond.Broadcast()
+}
+
+// Read reads received data, it returns io.EOF after the remote side closed the stream and all data is read
+func (st *Stream) Read(p []byte) (int, error) {
+	st.mu.Lock()
+	for len(st.recv) == 0 && !st.readClosed && st.err == nil {
+		st.cond.Wait()
+	}
+	if len(st.recv) == 0 {
+		err := st.err
+		st.mu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+	n := copy(p, st.recv[0])
+	if st.recv[0] = st.recv[0][n:]; len(st.recv[0]) == 0 {
+		st.recv = st.recv[1:]
+	}
+	st.consumed += uint32(n)
+	var inc uint32
+	if st.consumed >= initialWindow/2 && st.err == nil {
+		inc, st.consumed = st.consumed, 0
+	}
+	st.mu.Unlock()
+	if inc > 0 {
+		st.sess.writeFrame(frameWindow, st.id, inc, nil)
+	}
+	return n, nil
+}
+
+// Write sends p in frames, it waits while the window of the stream is used up
+func (st *Stream) Write(p []byte) (int, error) {
+	var total int
+	for len(p) > 0 {
+		st.mu.Lock()
+		for st.window == 0 && st.err == nil && !st.writeClosed {
+			st.cond.Wait()
+		}
+		if st.err != nil {
+			err := st.err
+			st.mu.Unlock()
+			return total, err
+		}
+		if st.writeClosed {
+			st.mu.Unlock()
+			return total, errStreamClosed
+		}
+		n := len(p)
+		if n > int(st.window) {
+			n = int(st.window)
+		}
+		if n > maxFrameSize {
+			n = maxFrameSize
+		}
+		st.window -= uint32(n)
+		st.mu.Unlock()
+		if err := st.sess.writeFrame(frameData, st.id, uint32(n), p[:n]); err != nil {
+			return total, err
+		}
+		total += n
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// Close closes the stream for writing, the remote side reads io.EOF after the data sent
+func (st *Stream) Close() error {
+	st.mu.Lock()
+	if st.writeClosed || st.err != nil {
+		st.mu.Unlock()
+		return nil
+	}
+	st.writeClosed = true
+	done := st.readClosed
+	st.cond.Broadcast()
+	st.mu.Unlock()
+	err := st.sess.writeFrame(frameClose, st.id, 0, nil)
+	if done {
+		st.sess.remove(st.id)
+	}
+	return err
+}
+
+// Reset aborts the stream on both sides, e.g. to refuse a stream which can't be served
+func (st *Stream) Reset() {
+	st.abort(errStreamReset)
+	st.sess.remove(st.id)
+	st.sess.writeFrame(frameReset, st.id, 0, nil)
+}
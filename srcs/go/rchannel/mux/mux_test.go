@@ -0,0 +1,84 @@
+package mux
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+func newPair(accept AcceptFunc) (*Session, *Session) {
+	a, b := net.Pipe()
+	x := NewSession(a, true, nil)
+	y := NewSession(b, false, accept)
+	go x.Serve()
+	go y.Serve()
+	return x, y
+}
+
+func Test_Stream(t *testing.T) {
+	data := make([]byte, 3*initialWindow+123) // more than the window, which the reader opens while reading
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	echoed := make(chan []byte, 1)
+	x, y := newPair(func(s *Stream, header []byte) {
+		if string(header) != "hello" {
+			s.Reset()
+			return
+		}
+		bs, _ := ioutil.ReadAll(s)
+		s.Write(bs)
+		s.Close()
+	})
+	defer x.Close()
+	defer y.Close()
+	s, err := x.Open([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		bs, _ := ioutil.ReadAll(s)
+		echoed <- bs
+	}()
+	if _, err := s.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if bs := <-echoed; !bytes.Equal(bs, data) {
+		t.Errorf("echoed %d bytes, expect %d bytes", len(bs), len(data))
+	}
+	if n := x.NumStreams(); n != 0 {
+		t.Errorf("%d streams left after both sides closed", n)
+	}
+}
+
+func Test_Reset(t *testing.T) {
+	x, y := newPair(func(s *Stream, header []byte) { s.Reset() })
+	defer x.Close()
+	defer y.Close()
+	s, err := x.Open(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Read(make([]byte, 1)); err != errStreamReset {
+		t.Errorf("expect %v, got %v", errStreamReset, err)
+	}
+}
+
+func Test_SessionClosed(t *testing.T) {
+	x, y := newPair(func(s *Stream, header []byte) {})
+	s, err := x.Open(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	y.Close()
+	if _, err := s.Read(make([]byte, 1)); err == nil || err == io.EOF {
+		t.Errorf("expect an error after the session is closed, got %v", err)
+	}
+	<-x.Done()
+	if _, err := x.Open(nil); err == nil {
+		t.Errorf("opened a stream of a closed session")
+	}
+}
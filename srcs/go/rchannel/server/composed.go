@@ -1,9 +1,14 @@
 package server
 
 import (
+	"fmt"
 	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/kungfu/features"
 	"github.com/lsds/KungFu/srcs/go/log"
 	"github.com/lsds/KungFu/srcs/go/plan"
 	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
@@ -19,20 +24,46 @@ type Server interface {
 
 // New creates a new Server
 func New(self plan.PeerID, handler connection.Handler, useUnixSock bool) *composedServer {
+	active := newConnRegistry()
+	if config.InprocTransport {
+		inprocServer := newInprocServer(self, handler)
+		inprocServer.active = active
+		return &composedServer{tcpServer: inprocServer}
+	}
 	tcpServer := newTCPServer(self, handler)
+	tcpServer.active = active
 	var unixServer *server
 	if useUnixSock {
 		unixServer = newUnixServer(self, handler)
+		unixServer.active = active
+	}
+	var datagramServer *datagramServer
+	if features.Requested().Has(features.Datagram) {
+		datagramServer = newDatagramServer(self, handler)
+		tcpServer.datagram = datagramServer
+		if unixServer != nil {
+			unixServer.datagram = datagramServer
+		}
 	}
 	return &composedServer{
-		tcpServer:  tcpServer,
-		unixServer: unixServer,
+		tcpServer:      tcpServer,
+		unixServer:     unixServer,
+		datagramServer: datagramServer,
 	}
 }
 
 type composedServer struct {
-	tcpServer  *server
-	unixServer *server
+	tcpServer      *server
+	unixServer     *server
+	datagramServer *datagramServer
+
+	restarts  int32
+	onRestart func()
+}
+
+// OnRestart sets f to be called after a listener died and the server listens again, e.g. to announce it to peers
+func (s *composedServer) OnRestart(f func()) {
+	s.onRestart = f
 }
 
 func (s *composedServer) SetToken(token uint32) {
@@ -41,6 +72,9 @@ func (s *composedServer) SetToken(token uint32) {
 			srv.SetToken(token)
 		}
 	}
+	if s.datagramServer != nil {
+		s.datagramServer.SetToken(token)
+	}
 }
 
 func (s *composedServer) listen() error {
@@ -51,6 +85,9 @@ func (s *composedServer) listen() error {
 			}
 		}
 	}
+	if s.datagramServer != nil {
+		return s.datagramServer.Listen()
+	}
 	return nil
 }
 
@@ -60,14 +97,55 @@ func (s *composedServer) serve() {
 		if srv != nil {
 			wg.Add(1)
 			go func(srv *server) {
-				srv.Serve()
+				s.watch(srv)
 				wg.Done()
 			}(srv)
 		}
 	}
+	if s.datagramServer != nil {
+		wg.Add(1)
+		go func() {
+			s.datagramServer.Serve()
+			wg.Done()
+		}()
+	}
 	wg.Wait()
 }
 
+// restartDelay is the interval between attempts of binding the address of a died listener again
+const restartDelay = time.Second
+
+// watch serves srv until it is closed, binding its address again when a listener died, for at most
+// config.ServerRestarts times in total, so that a transient failure doesn't take down the local peers.
+func (s *composedServer) watch(srv *server) {
+	for {
+		err := srv.Serve()
+		if err == nil {
+			return
+		}
+		n := atomic.AddInt32(&s.restarts, 1)
+		if int(n) > config.ServerRestarts {
+			utils.ExitErr(fmt.Errorf("server of %s died %d times, last: %v", srv.self, n, err))
+		}
+		log.Errorf("server of %s died: %v, restarting (%d/%d)", srv.self, err, n, config.ServerRestarts)
+		for {
+			if srv.isClosed() {
+				return
+			}
+			if err := srv.Listen(); err != nil {
+				log.Warnf("failed to listen again: %v, retrying in %s", err, restartDelay)
+				time.Sleep(restartDelay)
+				continue
+			}
+			break
+		}
+		log.Infof("server of %s restarted", srv.self)
+		if s.onRestart != nil {
+			s.onRestart()
+		}
+	}
+}
+
 func (s *composedServer) ListenAndServe() error {
 	if err := s.listen(); err != nil {
 		return err
@@ -91,5 +169,8 @@ func (s *composedServer) Close() {
 			srv.Close()
 		}
 	}
+	if s.datagramServer != nil {
+		s.datagramServer.Close()
+	}
 	log.Debugf("Server Closed")
 }
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+)
+
+const datagramQueueSize = 64
+
+type datagramStreamKey struct {
+	src   plan.PeerID
+	t     connection.ConnType
+	nonce uint32
+}
+
+type datagramStream struct {
+	seq   uint32
+	queue chan connection.Connection
+}
+
+// datagramServer receives small messages sent via the datagram fast path,
+// messages of each stream are acknowledged on receipt and handled in order.
+// A stream which fell back to TCP continues on a ConnDatagram connection, with the same sequence numbers,
+// so that a datagram received both ways is handled once.
+type datagramServer struct {
+	self    plan.PeerID
+	handler connection.Handler
+	conn    *net.UDPConn
+	token   uint32
+	done    chan struct{}
+
+	mu      sync.Mutex // guards streams, which are received from UDP and the ConnDatagram connections
+	streams map[datagramStreamKey]*datagramStream
+}
+
+func newDatagramServer(self plan.PeerID, handler connection.Handler) *datagramServer {
+	return &datagramServer{
+		self:    self,
+		handler: handler,
+		done:    make(chan struct{}),
+		streams: make(map[datagramStreamKey]*datagramStream),
+	}
+}
+
+func (s *datagramServer) SetToken(token uint32) {
+	atomic.StoreUint32(&s.token, token)
+}
+
+func (s *datagramServer) Listen() error {
+	addr, err := net.ResolveUDPAddr("udp", s.self.ListenAddr(false).String())
+	if err != nil {
+		return err
+	}
+	s.conn, err = net.ListenUDP("udp", addr)
+	return err
+}
+
+func (s *datagramServer) Serve() {
+	buf := make([]byte, 2*connection.MaxDatagramMessageSize)
+	for {
+		n, from, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			if isNetClosingErr(err) {
+				break
+			}
+			log.Infof("ReadFromUDP failed: %v", err)
+			continue
+		}
+		h, payload, err := connection.DecodeDatagram(buf[:n])
+		if err != nil || h.IsAck() {
+			continue
+		}
+		if connection.ConnType(h.Type) == connection.ConnCollective && h.Token != atomic.LoadUint32(&s.token) {
+			continue // not acknowledged, the sender will fall back to TCP
+		}
+		s.receive(*h, payload, from)
+	}
+	close(s.done)
+}
+
+// receive queues a datagram from UDP if it is the next of its stream, without blocking
+func (s *datagramServer) receive(h connection.DatagramHeader, payload []byte, from *net.UDPAddr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.stream(datagramStreamKey{src: h.Src(), t: connection.ConnType(h.Type), nonce: h.Nonce})
+	if h.Seq <= st.seq {
+		s.ack(h, from) // the previous ack was lost
+		return
+	}
+	if h.Seq != st.seq+1 {
+		return
+	}
+	conn := connection.NewDatagramConnection(h, s.self, append([]byte(nil), payload...))
+	select {
+	case st.queue <- conn:
+		st.seq = h.Seq
+		s.ack(h, from)
+	default:
+	}
+}
+
+// serveConn receives the datagrams of the streams of a sender which fell back to TCP,
+// those already received from UDP, and the collective ones of another session, are dropped.
+func (s *datagramServer) serveConn(conn connection.Connection) (int, error) {
+	return connection.Stream(conn, connection.Accept, func(name string, msg *connection.Message, _ connection.Connection) {
+		defer connection.PutBuf(msg.Data)
+		h, payload, err := connection.DecodeDatagram(msg.Data)
+		if err != nil {
+			log.Warnf("invalid datagram %s from %s: %v", name, conn.Src(), err)
+			return
+		}
+		if connection.ConnType(h.Type) == connection.ConnCollective && h.Token != atomic.LoadUint32(&s.token) {
+			log.Debugf("dropped datagram %s from %s of another session", name, conn.Src())
+			return // as from UDP
+		}
+		s.mu.Lock()
+		st := s.stream(datagramStreamKey{src: h.Src(), t: connection.ConnType(h.Type), nonce: h.Nonce})
+		if h.Seq <= st.seq {
+			s.mu.Unlock()
+			return
+		}
+		if h.Seq != st.seq+1 {
+			log.Warnf("datagram %s from %s is #%d, expect #%d", name, conn.Src(), h.Seq, st.seq+1)
+		}
+		st.seq = h.Seq
+		s.mu.Unlock()
+		select {
+		case st.queue <- connection.NewDatagramConnection(*h, s.self, append([]byte(nil), payload...)):
+		case <-s.done:
+		}
+	})
+}
+
+// stream returns the stream of key, with s.mu held
+func (s *datagramServer) stream(key datagramStreamKey) *datagramStream {
+	if st, ok := s.streams[key]; ok {
+		return st
+	}
+	st := &datagramStream{
+		queue: make(chan connection.Connection, datagramQueueSize),
+	}
+	s.streams[key] = st
+	go func() {
+		for {
+			select {
+			case conn := <-st.queue:
+				if _, err := s.handler.Handle(conn); err != nil {
+					log.Warnf("handle datagram from %s err: %v", conn.Src(), err)
+				}
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	return st
+}
+
+func (s *datagramServer) ack(h connection.DatagramHeader, to *net.UDPAddr) {
+	pkt := connection.EncodeDatagram(h.Ack(), "", connection.Message{}, connection.NoFlag)
+	if _, err := s.conn.WriteToUDP(pkt, to); err != nil {
+		log.Debugf("failed to ack datagram from %s: %v", h.Src(), err)
+	}
+}
+
+func (s *datagramServer) Close() {
+	s.conn.Close()
+}
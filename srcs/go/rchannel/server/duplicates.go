@@ -0,0 +1,98 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
+	"github.com/lsds/KungFu/srcs/go/utils"
+)
+
+// Policies of a peer connecting again while its previous connection of the same kind is still being served,
+// e.g. after the peer is restarted transparently.
+const (
+	ReplaceDuplicate = `REPLACE` // serve the new connection after the old one is drained, or closed after config.DuplicateConnDrain
+	RejectDuplicate  = `REJECT`  // close the new connection
+	KeepDuplicate    = `KEEP`    // serve both
+)
+
+type connKey struct {
+	src      plan.PeerID
+	t        connection.ConnType
+	priority bool
+}
+
+type activeConn struct {
+	conn connection.Connection
+	done chan struct{} // closed when the connection is no longer served
+}
+
+// connRegistry tracks the connections of peers being served by the servers of a peer, over all transports
+type connRegistry struct {
+	sync.Mutex
+	policy string
+	drain  time.Duration
+	conns  map[connKey]*activeConn
+}
+
+func newConnRegistry() *connRegistry {
+	switch config.DuplicateConnPolicy {
+	case ReplaceDuplicate, RejectDuplicate, KeepDuplicate:
+	default:
+		utils.ExitErr(fmt.Errorf("invalid %s: %q", config.DuplicateConnPolicyEnvKey, config.DuplicateConnPolicy))
+	}
+	return &connRegistry{
+		policy: config.DuplicateConnPolicy,
+		drain:  config.DuplicateConnDrain,
+		conns:  make(map[connKey]*activeConn),
+	}
+}
+
+// tracked tells if a peer has at most one connection of the kind of conn, only connections of the data plane are,
+// while runners and tools may connect from the same address by many clients.
+func tracked(conn connection.Connection) bool {
+	t := conn.Type()
+	return (t == connection.ConnCollective || t == connection.ConnPeerToPeer) && conn.Src() != plan.PeerID{}
+}
+
+// acquire registers conn before it is served, it returns false if conn must be closed instead,
+// release must be called after conn is served.
+func (r *connRegistry) acquire(conn connection.Connection) (func(), bool) {
+	if r.policy == KeepDuplicate || !tracked(conn) {
+		return func() {}, true
+	}
+	key := connKey{src: conn.Src(), t: conn.Type(), priority: connection.IsPriority(conn)}
+	a := &activeConn{conn: conn, done: make(chan struct{})}
+	release := func() {
+		r.Lock()
+		if r.conns[key] == a {
+			delete(r.conns, key)
+		}
+		r.Unlock()
+		close(a.done)
+	}
+	r.Lock()
+	prev := r.conns[key]
+	if prev != nil && r.policy == RejectDuplicate {
+		r.Unlock()
+		log.Warnf("rejected %s connection from %s, which is already connected", conn.Type(), conn.Src())
+		return nil, false
+	}
+	r.conns[key] = a
+	r.Unlock()
+	if prev != nil {
+		log.Infof("%s connection from %s replaces the previous one, draining it", conn.Type(), conn.Src())
+		select {
+		case <-prev.done:
+		case <-time.After(r.drain):
+			log.Warnf("previous %s connection from %s not drained in %s, closing it", conn.Type(), conn.Src(), r.drain)
+			prev.conn.Conn().Close() // not by prev.conn.Close, which waits for the pending sends of a duplex connection
+			<-prev.done
+		}
+	}
+	return release, true
+}
@@ -0,0 +1,14 @@
+// +build !linux
+
+package server
+
+import (
+	"errors"
+	"net"
+)
+
+var errReusePortNotSupported = errors.New("SO_REUSEPORT is not supported on this platform")
+
+func listenReusePort(network, addr string) (net.Listener, error) {
+	return nil, errReusePortNotSupported
+}
@@ -1,12 +1,16 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"os"
+	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/lsds/KungFu/srcs/go/kungfu/config"
 	"github.com/lsds/KungFu/srcs/go/log"
 	"github.com/lsds/KungFu/srcs/go/plan"
 	"github.com/lsds/KungFu/srcs/go/rchannel/connection"
@@ -14,26 +18,69 @@ import (
 )
 
 type server struct {
-	listen   func() (net.Listener, error)
-	listener net.Listener
-	self     plan.PeerID
-	handler  connection.Handler
-	token    uint32
-	unix     bool
+	listen    func(network string, shard int) (net.Listener, error)
+	networks  []string // listened by each shard, the first is required, the others are skipped if they are not available
+	shards    int      // number of listeners sharing the address with SO_REUSEPORT, each has its own accept loop
+	listeners []net.Listener
+	self      plan.PeerID
+	handler   connection.Handler
+	token     uint32
+	unix      bool
+	active    *connRegistry   // shared by the servers of all transports
+	datagram  *datagramServer // serves the ConnDatagram connections, nil if the datagram fast path is not requested
+
+	mu     sync.Mutex // guards listeners, which are replaced when the server listens again
+	closed int32
 }
 
+// newTCPServer creates a new Server listening both IPv4 and IPv6, if the host has IPv6
 func newTCPServer(self plan.PeerID, handler connection.Handler) *server {
+	shards := config.ListenShards
 	return &server{
-		listen: func() (net.Listener, error) {
-			listenAddr := self.ListenAddr(false)
+		listen: func(network string, shard int) (net.Listener, error) {
+			listenAddr := self.ListenAddr(false).String()
+			if network == `tcp6` {
+				listenAddr = net.JoinHostPort(`::`, strconv.Itoa(int(self.Port)))
+			}
 			log.Debugf("listening: %s", listenAddr)
-			return net.Listen("tcp", listenAddr.String())
+			if shards > 1 {
+				if shard == 0 {
+					// SO_REUSEPORT would share the address with a listener of another process of the same user
+					if err := checkFree(network, listenAddr); err != nil {
+						return nil, err
+					}
+				}
+				return listenReusePort(network, listenAddr)
+			}
+			return net.Listen(network, listenAddr)
+		},
+		networks: []string{`tcp4`, `tcp6`},
+		shards:   shards,
+		self:     self,
+		handler:  handler,
+	}
+}
+
+// newInprocServer creates a new Server accepting connections from peers of the same process
+func newInprocServer(self plan.PeerID, handler connection.Handler) *server {
+	return &server{
+		listen: func(string, int) (net.Listener, error) {
+			return connection.ListenInproc(self)
 		},
 		self:    self,
 		handler: handler,
 	}
 }
 
+// checkFree checks that addr is not listened, by listening it without SO_REUSEPORT
+func checkFree(network, addr string) error {
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	return l.Close()
+}
+
 func fileExists(filename string) (bool, time.Duration) {
 	info, err := os.Stat(filename)
 	if os.IsNotExist(err) {
@@ -47,7 +94,7 @@ func fileExists(filename string) (bool, time.Duration) {
 
 // newUnixServer creates a new Server listening Unix socket
 func newUnixServer(self plan.PeerID, handler connection.Handler) *server {
-	listen := func() (net.Listener, error) {
+	listen := func(string, int) (net.Listener, error) {
 		sockFile := self.SockFile()
 		if ok, age := fileExists(sockFile); ok {
 			if age > 0 {
@@ -74,53 +121,162 @@ func (s *server) SetToken(token uint32) {
 }
 
 func (s *server) Listen() error {
-	var err error
-	s.listener, err = s.listen()
-	return err
+	networks := s.networks
+	if len(networks) == 0 {
+		networks = []string{``}
+	}
+	var listeners []net.Listener
+	for i := 0; i < s.shards || i == 0; i++ {
+		for j, network := range networks {
+			l, err := s.listen(network, i)
+			if err != nil && j > 0 {
+				log.Debugf("not listening %s: %v", network, err)
+				continue
+			}
+			if err != nil {
+				for _, l := range listeners {
+					l.Close()
+				}
+				return err
+			}
+			listeners = append(listeners, l)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.isClosed() {
+		for _, l := range listeners {
+			l.Close()
+		}
+		return errClosed
+	}
+	s.listeners = listeners
+	return nil
 }
 
-func (s *server) accept() (connection.Connection, error) {
-	tcpConn, err := s.listener.Accept()
-	if err != nil {
-		return nil, err
+var errClosed = errors.New("server closed")
+
+// Serve accepts connections until the server is closed, or returns the error of a listener that died,
+// after closing the other listeners, so that the server can Listen again.
+func (s *server) Serve() error {
+	s.mu.Lock()
+	listeners := s.listeners
+	s.mu.Unlock()
+	var wg sync.WaitGroup
+	errs := make([]error, len(listeners))
+	for i, l := range listeners {
+		wg.Add(1)
+		go func(i int, l net.Listener) {
+			if errs[i] = s.serve(l); errs[i] != nil {
+				s.closeListeners()
+			}
+			wg.Done()
+		}(i, l)
 	}
-	conn, err := connection.UpgradeFrom(tcpConn, s.self, atomic.LoadUint32(&s.token))
-	if err != nil {
-		return nil, err
+	wg.Wait()
+	if s.isClosed() {
+		return nil
 	}
-	return conn, nil
+	return utils.MergeErrors(errs, "serve")
 }
 
-func (s *server) Serve() {
+// maxAcceptDelay bounds the backoff of accepting after temporary errors, e.g. EMFILE
+const maxAcceptDelay = time.Second
+
+func (s *server) serve(l net.Listener) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("accept loop panicked: %v", r)
+		}
+	}()
+	var delay time.Duration
 	for {
-		conn, err := s.accept()
+		conn, err := l.Accept()
 		if err != nil {
-			if isNetClosingErr(err) {
-				break
+			if isNetClosingErr(err) || s.isClosed() {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if delay *= 2; delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay > maxAcceptDelay {
+					delay = maxAcceptDelay
+				}
+				log.Warnf("Accept failed: %v, retrying in %s", err, delay)
+				time.Sleep(delay)
+				continue
 			}
-			log.Infof("Accept failed: %v", err)
-			continue
+			return err
 		}
+		delay = 0
 		go s.handle(conn)
 	}
 }
 
-// Close closes the listener
+func (s *server) isClosed() bool {
+	return atomic.LoadInt32(&s.closed) != 0
+}
+
+func (s *server) closeListeners() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, l := range s.listeners {
+		l.Close()
+	}
+}
+
+// Close closes the listeners
 func (s *server) Close() {
 	// TODO: to be graceful
-	s.listener.Close()
+	atomic.StoreInt32(&s.closed, 1)
+	s.closeListeners()
 	if s.unix {
 		os.Remove(s.self.SockFile())
 	}
 }
 
-func (s *server) handle(conn connection.Connection) {
+// handle upgrades the accepted connection outside the accept loop, so that a slow client doesn't block the others
+// A panic of the handler only drops the connection, instead of the whole process.
+func (s *server) handle(tcpConn net.Conn) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("handler of connection from %s panicked: %v", tcpConn.RemoteAddr(), r)
+		}
+	}()
+	conn, err := connection.UpgradeFrom(tcpConn, s.self, atomic.LoadUint32(&s.token))
+	if err == connection.ErrResumed {
+		return // tcpConn is read by the handler of the resumed stream
+	}
+	if err != nil {
+		log.Infof("Accept failed: %v", err)
+		tcpConn.Close()
+		return
+	}
 	defer conn.Close()
+	if conn.Type() == connection.ConnDatagram {
+		s.handleDatagram(conn)
+		return
+	}
+	release, ok := s.active.acquire(conn)
+	if !ok {
+		return
+	}
+	defer release()
 	if n, err := s.handler.Handle(conn); err != nil {
 		log.Warnf("handle conn err: %v after handled %d messages", err, n)
 	}
 }
 
+func (s *server) handleDatagram(conn connection.Connection) {
+	if s.datagram == nil {
+		log.Warnf("datagram fast path not requested, closing %s connection from %s", conn.Type(), conn.Src())
+		return
+	}
+	if n, err := s.datagram.serveConn(conn); err != nil {
+		log.Warnf("handle datagram conn err: %v after handled %d datagrams", err, n)
+	}
+}
+
 // check if error is internal/poll.ErrNetClosing
 func isNetClosingErr(err error) bool {
 	// file:///$GOROOT/src/internal/poll/fd.go:18:
@@ -57,3 +57,38 @@ func (s *Store) GetOrCreate(name string, size int) (*Blob, error) {
 	s.data[name] = blob
 	return blob, nil
 }
+
+// Put saves a copy of data, replacing the existing blob of any size
+func (s *Store) Put(name string, data []byte) {
+	blob := &Blob{Data: append([]byte(nil), data...)}
+	s.Lock()
+	defer s.Unlock()
+	s.data[name] = blob
+}
+
+// Snapshot returns a copy of all blobs in the store
+func (s *Store) Snapshot() map[string][]byte {
+	s.RLock()
+	defer s.RUnlock()
+	m := make(map[string][]byte, len(s.data))
+	for name, blob := range s.data {
+		blob.RLock()
+		m[name] = append([]byte(nil), blob.Data...)
+		blob.RUnlock()
+	}
+	return m
+}
+
+// Restore saves all blobs of a snapshot into the store
+func (s *Store) Restore(m map[string][]byte) error {
+	for name, data := range m {
+		blob, err := s.GetOrCreate(name, len(data))
+		if err != nil {
+			return err
+		}
+		if err := blob.CopyFrom(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -92,3 +92,33 @@ func (s *VersionedStore) GetNextVersion(prev string) string {
 	}
 	return prev
 }
+
+// VersionSnapshot is a copy of all blobs of one version
+type VersionSnapshot struct {
+	Version string
+	Blobs   map[string][]byte
+}
+
+// Snapshot returns a copy of all versions in the store, from the oldest to the newest
+func (s *VersionedStore) Snapshot() []VersionSnapshot {
+	s.RLock()
+	defer s.RUnlock()
+	var vs []VersionSnapshot
+	for _, version := range s.window {
+		vs = append(vs, VersionSnapshot{
+			Version: version,
+			Blobs:   s.versions[version].Snapshot(),
+		})
+	}
+	return vs
+}
+
+// Restore saves all versions of a snapshot into the store
+func (s *VersionedStore) Restore(vs []VersionSnapshot) error {
+	for _, v := range vs {
+		if err := s.getOrCreateVersion(v.Version).Restore(v.Blobs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -30,3 +30,27 @@ func Test_1(t *testing.T) {
 		t.Error("Get should return error")
 	}
 }
+
+func Test_Snapshot(t *testing.T) {
+	vs := NewVersionedStore(2)
+	for i, v := range []string{"0x1", "0x2", "0x3"} {
+		b, _ := vs.Create(v, "a.idx", 1)
+		b.Data[0] = byte(i)
+	}
+	snapshot := vs.Snapshot()
+	if len(snapshot) != 2 || snapshot[0].Version != "0x2" {
+		t.Fatalf("unexpected snapshot: %v", snapshot)
+	}
+
+	ws := NewVersionedStore(2)
+	if err := ws.Restore(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ws.Get("0x3", "a.idx")
+	if err != nil || b.Data[0] != 2 {
+		t.Error("Restore failed")
+	}
+	if next := ws.GetNextVersion("0x2"); next != "0x3" {
+		t.Errorf("unexpected next version %s", next)
+	}
+}
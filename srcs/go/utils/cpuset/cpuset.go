@@ -0,0 +1,176 @@
+// Package cpuset partitions the CPU cores of a host among the peers running on it.
+package cpuset
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// List is a sorted list of CPU ids, formatted as in /sys/devices/system/cpu, e.g. 0-3,8-11
+type List []int
+
+var errInvalidList = errors.New("invalid CPU list")
+
+// Parse parses the format of cpulist in sysfs and of taskset -c
+func Parse(s string) (List, error) {
+	var l List
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return l, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		lo, err := strconv.Atoi(bounds[0])
+		if err != nil || lo < 0 {
+			return nil, errInvalidList
+		}
+		hi := lo
+		if len(bounds) == 2 {
+			if hi, err = strconv.Atoi(bounds[1]); err != nil || hi < lo {
+				return nil, errInvalidList
+			}
+		}
+		for i := lo; i <= hi; i++ {
+			l = append(l, i)
+		}
+	}
+	sort.Ints(l)
+	return l, nil
+}
+
+func (l List) String() string {
+	var parts []string
+	for i := 0; i < len(l); {
+		j := i
+		for j+1 < len(l) && l[j+1] == l[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(l[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", l[i], l[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l List) union(m List) List {
+	u := append(List{}, l...)
+	for _, c := range m {
+		if !u.contains(c) {
+			u = append(u, c)
+		}
+	}
+	sort.Ints(u)
+	return u
+}
+
+func (l List) intersect(m List) List {
+	var r List
+	for _, c := range l {
+		if m.contains(c) {
+			r = append(r, c)
+		}
+	}
+	return r
+}
+
+func (l List) contains(c int) bool {
+	i := sort.SearchInts(l, c)
+	return i < len(l) && l[i] == c
+}
+
+// Nodes returns the CPUs of each NUMA node allowed to this process,
+// or all CPUs as a single node if the topology is not available.
+func Nodes() []List {
+	allowed := allowedCPUs()
+	files, _ := filepath.Glob("/sys/devices/system/node/node[0-9]*/cpulist")
+	sort.Slice(files, func(i, j int) bool { return nodeID(files[i]) < nodeID(files[j]) })
+	var nodes []List
+	for _, f := range files {
+		bs, err := ioutil.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		l, err := Parse(string(bs))
+		if err != nil {
+			continue
+		}
+		if l = l.intersect(allowed); len(l) > 0 { // skip nodes of only memory
+			nodes = append(nodes, l)
+		}
+	}
+	if len(nodes) == 0 {
+		nodes = append(nodes, allowed)
+	}
+	return nodes
+}
+
+func nodeID(cpulist string) int {
+	n, _ := strconv.Atoi(strings.TrimPrefix(filepath.Base(filepath.Dir(cpulist)), "node"))
+	return n
+}
+
+func allowedCPUs() List {
+	if bs, err := ioutil.ReadFile("/proc/self/status"); err == nil {
+		for _, line := range strings.Split(string(bs), "\n") {
+			if strings.HasPrefix(line, "Cpus_allowed_list:") {
+				if l, err := Parse(strings.TrimPrefix(line, "Cpus_allowed_list:")); err == nil && len(l) > 0 {
+					return l
+				}
+			}
+		}
+	}
+	var l List
+	for i := 0; i < runtime.NumCPU(); i++ {
+		l = append(l, i)
+	}
+	return l
+}
+
+// Partition assigns the CPUs of nodes to n peers of consecutive local ranks.
+// Peers are spread over the nodes, and the cores of a node are split among its peers,
+// except the first reserved cores of each node, which are shared by its peers for the goroutines of rchannel.
+// If there are less peers than nodes, each peer takes whole nodes.
+func Partition(nodes []List, n, reserved int) []List {
+	if n <= 0 || len(nodes) == 0 {
+		return nil
+	}
+	parts := make([]List, n)
+	if n < len(nodes) {
+		for i := range parts {
+			for _, node := range nodes[i*len(nodes)/n : (i+1)*len(nodes)/n] {
+				parts[i] = parts[i].union(node)
+			}
+		}
+		return parts
+	}
+	for k, node := range nodes {
+		var peers []int
+		for i := 0; i < n; i++ {
+			if i*len(nodes)/n == k {
+				peers = append(peers, i)
+			}
+		}
+		r := reserved
+		if r < 0 || len(node)-r < 1 {
+			r = 0
+		}
+		shared, cores := node[:r], node[r:]
+		for j, i := range peers {
+			lo, hi := j*len(cores)/len(peers), (j+1)*len(cores)/len(peers)
+			if hi == lo {
+				hi = lo + 1 // more peers than cores, some peers share a core
+			}
+			parts[i] = append(List{}, cores[lo:hi]...).union(shared)
+		}
+	}
+	return parts
+}
@@ -0,0 +1,48 @@
+package cpuset
+
+import "testing"
+
+func Test_Parse(t *testing.T) {
+	for _, s := range []string{"0", "0-3", "0-3,8-11", "1,3,5-6"} {
+		l, err := Parse(s)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", s, err)
+		}
+		if l.String() != s {
+			t.Errorf("Parse(%q).String() = %q", s, l.String())
+		}
+	}
+	for _, s := range []string{"a", "3-1", "-1"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) should fail", s)
+		}
+	}
+}
+
+func Test_Partition(t *testing.T) {
+	node0, _ := Parse("0-7")
+	node1, _ := Parse("8-15")
+	tests := []struct {
+		nodes    []List
+		n        int
+		reserved int
+		want     []string
+	}{
+		{[]List{node0, node1}, 4, 1, []string{"0-3", "0,4-7", "8-11", "8,12-15"}},
+		{[]List{node0, node1}, 2, 0, []string{"0-7", "8-15"}},
+		{[]List{node0, node1}, 1, 1, []string{"0-15"}},
+		{[]List{node0}, 3, 2, []string{"0-3", "0-1,4-5", "0-1,6-7"}},
+		{[]List{{0, 1}}, 3, 1, []string{"0-1", "0-1", "0-1"}},
+	}
+	for _, tt := range tests {
+		parts := Partition(tt.nodes, tt.n, tt.reserved)
+		if len(parts) != len(tt.want) {
+			t.Fatalf("Partition(%v, %d, %d) = %v", tt.nodes, tt.n, tt.reserved, parts)
+		}
+		for i, p := range parts {
+			if p.String() != tt.want[i] {
+				t.Errorf("Partition(%v, %d, %d)[%d] = %s, want %s", tt.nodes, tt.n, tt.reserved, i, p, tt.want[i])
+			}
+		}
+	}
+}
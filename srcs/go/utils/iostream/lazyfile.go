@@ -44,9 +44,17 @@ func (f *layzeFile) create() error {
 	return err
 }
 
+// NewLogFile creates a lazy file which is rotated as set by SetRotation
+func NewLogFile(filename string) io.WriteCloser {
+	if r := currentRotation(); r.Enabled() {
+		return NewRotatingFile(filename, r)
+	}
+	return NewLazyFile(filename)
+}
+
 func NewFileRedirector(name string) *StdWriters {
 	return &StdWriters{
-		Stdout: NewLazyFile(name + ".stdout.log"),
-		Stderr: NewLazyFile(name + ".stderr.log"),
+		Stdout: NewLogFile(name + ".stdout.log"),
+		Stderr: NewLogFile(name + ".stderr.log"),
 	}
 }
@@ -0,0 +1,171 @@
+package iostream
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rotation limits the size and age of log files, the zero value disables rotation
+type Rotation struct {
+	MaxSize  int64         // rotate when the file would exceed this number of bytes
+	Period   time.Duration // rotate when the file is older than this
+	MaxAge   time.Duration // remove rotated files older than this
+	Compress bool          // gzip rotated files
+}
+
+func (r Rotation) Enabled() bool {
+	return r.MaxSize > 0 || r.Period > 0
+}
+
+var (
+	rotationMu sync.Mutex
+	rotation   Rotation
+)
+
+// SetRotation sets the rotation of log files created afterwards
+func SetRotation(r Rotation) {
+	rotationMu.Lock()
+	defer rotationMu.Unlock()
+	rotation = r
+}
+
+func currentRotation() Rotation {
+	rotationMu.Lock()
+	defer rotationMu.Unlock()
+	return rotation
+}
+
+const rotatedTimeFormat = "20060102T150405.000"
+
+// rotatingFile is a lazily created file which is renamed to <base>-<time><ext> and replaced by a new one
+// when it is too large or too old.
+type rotatingFile struct {
+	mu      sync.Mutex
+	name    string
+	r       Rotation
+	f       *os.File
+	size    int64
+	created time.Time
+}
+
+// NewRotatingFile creates a log file which is rotated by r
+func NewRotatingFile(filename string, r Rotation) io.WriteCloser {
+	return &rotatingFile{name: filename, r: r}
+}
+
+func (f *rotatingFile) Write(bs []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.f != nil && f.due(len(bs)) {
+		if err := f.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to rotate log file %s: %v\n", f.name, err)
+		}
+	}
+	if f.f == nil {
+		if err := f.open(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to create log file %s: %v", f.name, err)
+			os.Stderr.Write(bs)
+			return 0, err
+		}
+	}
+	n, err := f.f.Write(bs)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.f != nil {
+		return f.f.Close()
+	}
+	return nil
+}
+
+func (f *rotatingFile) due(n int) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.r.MaxSize > 0 && f.size+int64(n) > f.r.MaxSize {
+		return true
+	}
+	return f.r.Period > 0 && time.Since(f.created) > f.r.Period
+}
+
+func (f *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.name), os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.Create(f.name)
+	if err != nil {
+		return err
+	}
+	f.f, f.size, f.created = file, 0, time.Now()
+	return nil
+}
+
+func (f *rotatingFile) rotate() error {
+	err := f.f.Close()
+	f.f = nil
+	if err != nil {
+		return err
+	}
+	ext := filepath.Ext(f.name)
+	rotated := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(f.name, ext), time.Now().Format(rotatedTimeFormat), ext)
+	if err := os.Rename(f.name, rotated); err != nil {
+		return err
+	}
+	go func() {
+		if f.r.Compress {
+			if err := compressFile(rotated); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to compress %s: %v\n", rotated, err)
+			}
+		}
+		if f.r.MaxAge > 0 {
+			removeRotated(f.name, f.r.MaxAge)
+		}
+	}()
+	return nil
+}
+
+func compressFile(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(name + ".gz")
+	if err != nil {
+		return err
+	}
+	w := gzip.NewWriter(out)
+	if _, err := io.Copy(w, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+// removeRotated removes the rotated files of name which were last modified before maxAge
+func removeRotated(name string, maxAge time.Duration) {
+	ext := filepath.Ext(name)
+	rotated, _ := filepath.Glob(strings.TrimSuffix(name, ext) + "-*" + ext + "*")
+	for _, file := range rotated {
+		if info, err := os.Stat(file); err == nil && time.Since(info.ModTime()) > maxAge {
+			os.Remove(file)
+		}
+	}
+}
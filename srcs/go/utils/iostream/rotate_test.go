@@ -0,0 +1,31 @@
+package iostream
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_RotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kungfu-rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "peer.stdout.log")
+	f := NewRotatingFile(name, Rotation{MaxSize: 10})
+	for i := 0; i < 3; i++ {
+		f.Write([]byte("0123456789"))
+		time.Sleep(2 * time.Millisecond) // rotated files are named by time
+	}
+	f.Close()
+	rotated, _ := filepath.Glob(filepath.Join(dir, "peer.stdout-*.log"))
+	if len(rotated) != 2 {
+		t.Errorf("expect 2 rotated files, got %q", rotated)
+	}
+	if bs, _ := ioutil.ReadFile(name); len(bs) != 10 {
+		t.Errorf("unexpected size of current file: %d", len(bs))
+	}
+}
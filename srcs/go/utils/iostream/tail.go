@@ -0,0 +1,45 @@
+package iostream
+
+import (
+	"strings"
+	"sync"
+)
+
+// TailWriter keeps the last n lines written to it, it can be shared by stdout and stderr
+type TailWriter struct {
+	sync.Mutex
+	n     int
+	lines []string
+	next  int
+	full  bool
+}
+
+func NewTailWriter(n int) *TailWriter {
+	return &TailWriter{n: n, lines: make([]string, n)}
+}
+
+func (w *TailWriter) Write(bs []byte) (int, error) {
+	if w.n <= 0 {
+		return len(bs), nil
+	}
+	w.Lock()
+	defer w.Unlock()
+	for _, line := range strings.Split(strings.TrimSuffix(string(bs), "\n"), "\n") {
+		w.lines[w.next] = line
+		w.next = (w.next + 1) % w.n
+		if w.next == 0 {
+			w.full = true
+		}
+	}
+	return len(bs), nil
+}
+
+// Lines returns the kept lines, the oldest first
+func (w *TailWriter) Lines() []string {
+	w.Lock()
+	defer w.Unlock()
+	if !w.full {
+		return append([]string(nil), w.lines[:w.next]...)
+	}
+	return append(append([]string(nil), w.lines[w.next:]...), w.lines[:w.next]...)
+}
@@ -0,0 +1,21 @@
+package iostream
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func Test_TailWriter(t *testing.T) {
+	w := NewTailWriter(3)
+	fmt.Fprintln(w, "a")
+	if got := strings.Join(w.Lines(), ","); got != "a" {
+		t.Errorf("unexpected lines: %q", got)
+	}
+	fmt.Fprintln(w, "b\nc")
+	fmt.Fprintln(w, "d")
+	fmt.Fprintln(w, "e")
+	if got := strings.Join(w.Lines(), ","); got != "c,d,e" {
+		t.Errorf("unexpected lines: %q", got)
+	}
+}
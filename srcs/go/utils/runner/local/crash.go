@@ -0,0 +1,131 @@
+package local
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/lsds/KungFu/srcs/go/log"
+)
+
+const (
+	crashTailLines    = 50 // lines of stdout and stderr kept in a CrashReport
+	maxKernelMessages = 20 // of each kind
+)
+
+// CrashReport is the postmortem of a process that exited abnormally
+type CrashReport struct {
+	ExitCode    int      `json:",omitempty"`
+	Signal      string   `json:",omitempty"`
+	CoreDumped  bool     `json:",omitempty"`
+	CorePattern string   `json:",omitempty"` // where the kernel writes core dumps, if dumped
+	Output      []string `json:",omitempty"` // the last lines of stdout and stderr
+	OOM         []string `json:",omitempty"` // messages of the OOM killer while the process was running
+	Xid         []string `json:",omitempty"` // GPU Xid errors reported by the NVIDIA driver while the process was running
+}
+
+func (c CrashReport) String() string {
+	buf := &bytes.Buffer{}
+	if len(c.Signal) > 0 {
+		fmt.Fprintf(buf, "killed by signal: %s", c.Signal)
+	} else {
+		fmt.Fprintf(buf, "exit code %d", c.ExitCode)
+	}
+	if c.CoreDumped {
+		fmt.Fprintf(buf, ", core dumped to %s", c.CorePattern)
+	}
+	sections := []struct {
+		name  string
+		lines []string
+	}{
+		{"OOM killer", c.OOM},
+		{"GPU Xid errors", c.Xid},
+		{fmt.Sprintf("last %d lines of output", len(c.Output)), c.Output},
+	}
+	for _, s := range sections {
+		if len(s.lines) == 0 {
+			continue
+		}
+		fmt.Fprintf(buf, "\n%s:", s.name)
+		for _, line := range s.lines {
+			fmt.Fprintf(buf, "\n\t%s", line)
+		}
+	}
+	return buf.String()
+}
+
+// newCrashReport describes a process that started at the uptime t0
+func newCrashReport(ps *os.ProcessState, output []string, t0 float64) *CrashReport {
+	c := &CrashReport{
+		ExitCode: ps.ExitCode(),
+		Output:   output,
+	}
+	if ws, ok := ps.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		c.Signal = ws.Signal().String()
+		if c.CoreDumped = ws.CoreDump(); c.CoreDumped {
+			if bs, err := ioutil.ReadFile("/proc/sys/kernel/core_pattern"); err == nil {
+				c.CorePattern = strings.TrimSpace(string(bs))
+			}
+		}
+	}
+	for _, msg := range kernelMessages(t0) {
+		switch {
+		case strings.Contains(msg, "Out of memory") || strings.Contains(msg, "oom-kill") || strings.Contains(msg, "Killed process"):
+			c.OOM = append(c.OOM, msg)
+		case strings.Contains(msg, "NVRM: Xid"):
+			c.Xid = append(c.Xid, msg)
+		}
+	}
+	c.OOM = lastN(c.OOM, maxKernelMessages)
+	c.Xid = lastN(c.Xid, maxKernelMessages)
+	return c
+}
+
+var kernelMessage = regexp.MustCompile(`^\[\s*(\d+\.\d+)\]\s*(.*)$`)
+
+// kernelMessages returns the messages in the kernel ring buffer logged since the uptime t0
+func kernelMessages(t0 float64) []string {
+	out, err := exec.Command("dmesg").Output()
+	if err != nil {
+		log.Debugf("failed to read kernel messages: %v", err)
+		return nil
+	}
+	var msgs []string
+	for _, line := range strings.Split(string(out), "\n") {
+		m := kernelMessage.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if t, _ := strconv.ParseFloat(m[1], 64); t >= t0 {
+			msgs = append(msgs, m[2])
+		}
+	}
+	return msgs
+}
+
+// uptime returns the seconds since boot, as the timestamps of kernel messages
+func uptime() float64 {
+	bs, err := ioutil.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(bs))
+	if len(fields) == 0 {
+		return 0
+	}
+	t, _ := strconv.ParseFloat(fields[0], 64)
+	return t
+}
+
+func lastN(lines []string, n int) []string {
+	if len(lines) > n {
+		return lines[len(lines)-n:]
+	}
+	return lines
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/lsds/KungFu/srcs/go/log"
 	"github.com/lsds/KungFu/srcs/go/nccl"
@@ -11,25 +12,52 @@ import (
 	"github.com/lsds/KungFu/srcs/go/utils/iostream"
 )
 
+// Result is the outcome of running a process
+type Result struct {
+	Duration time.Duration
+	Restarts int
+	Err      error
+	Crash    *CrashReport // of the last run, if it exited abnormally on its own
+}
+
 func (r Runner) TryRun(ctx context.Context, p proc.Proc) error {
+	return r.TryRunWithResult(ctx, p).Err
+}
+
+func (r Runner) TryRunWithResult(ctx context.Context, p proc.Proc) Result {
+	t0 := time.Now()
+	if p.Delay > 0 {
+		log.Debugf("#<%s> starts in %s", p.Name, p.Delay)
+		select {
+		case <-time.After(p.Delay):
+		case <-ctx.Done():
+			return Result{Duration: time.Since(t0), Err: ctx.Err()}
+		}
+	}
 	for i := 1; ; i++ {
-		retry, err := r.tryRun(p.CmdCtx(ctx))
+		retry, crash, err := r.tryRun(ctx, p.Cmd())
 		if err != nil && retry {
 			log.Errorf("restarting for the %d-th time because of %v", i, err)
 			continue
 		}
-		return err
+		return Result{Duration: time.Since(t0), Restarts: i - 1, Err: err, Crash: crash}
 	}
 }
 
-func (r Runner) tryRun(cmd *exec.Cmd) (bool, error) {
+func (r Runner) tryRun(ctx context.Context, cmd *exec.Cmd) (bool, *CrashReport, error) {
 	redirectors := r.defaultRedirectors()
 	firstStderr := &iostream.SaveFirstdWriter{}
 	firstLogs := &iostream.StdWriters{Stdout: &iostream.Null{}, Stderr: firstStderr}
-	redirectors = append(redirectors, firstLogs)
-	err := runWith(redirectors, cmd)
+	tail := iostream.NewTailWriter(crashTailLines)
+	redirectors = append(redirectors, firstLogs, &iostream.StdWriters{Stdout: tail, Stderr: tail})
+	t0 := uptime()
+	err := runWith(ctx, redirectors, cmd)
+	var crash *CrashReport
+	if _, ok := err.(*exec.ExitError); ok {
+		crash = newCrashReport(cmd.ProcessState, tail.Lines(), t0)
+	}
 	if strings.HasPrefix(firstStderr.First, nccl.Bug) {
-		return true, err
+		return true, crash, err
 	}
-	return false, err
+	return false, crash, err
 }
@@ -8,6 +8,8 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/lsds/KungFu/srcs/go/log"
 	"github.com/lsds/KungFu/srcs/go/proc"
@@ -23,9 +25,9 @@ type Runner struct {
 	VerboseLog    bool
 }
 
-// Run a command with context
+// Run a command
 func (r Runner) Run(cmd *exec.Cmd) error {
-	return runWith(r.defaultRedirectors(), cmd)
+	return runWith(context.Background(), r.defaultRedirectors(), cmd)
 }
 
 func (r Runner) defaultRedirectors() []*iostream.StdWriters {
@@ -39,7 +41,21 @@ func (r Runner) defaultRedirectors() []*iostream.StdWriters {
 	return redirectors
 }
 
-func runWith(redirectors []*iostream.StdWriters, cmd *exec.Cmd) error {
+// killGracePeriod is the time given to a process group to exit after SIGTERM, before it is killed
+const killGracePeriod = 5 * time.Second
+
+var subreaperOnce sync.Once
+
+// runWith runs cmd in its own process group, the group is terminated when ctx is canceled,
+// and the descendants left behind are terminated when cmd exits.
+func runWith(ctx context.Context, redirectors []*iostream.StdWriters, cmd *exec.Cmd) error {
+	subreaperOnce.Do(func() {
+		if err := becomeSubreaper(); err != nil {
+			log.Debugf("orphaned descendants won't be reaped: %v", err)
+			return
+		}
+		go reapOrphans()
+	})
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return err
@@ -52,14 +68,62 @@ func runWith(redirectors []*iostream.StdWriters, cmd *exec.Cmd) error {
 	defer stderr.Close()
 	results := iostream.StdReaders{Stdout: stdout, Stderr: stderr}
 	ioDone := results.Stream(redirectors...)
+	setpgid(cmd)
 	if err := cmd.Start(); err != nil {
 		return err
 	}
+	pgid := cmd.Process.Pid
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	terminate := func() {
+		signalGroup(pgid, syscall.SIGTERM)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case <-time.After(killGracePeriod):
+				signalGroup(pgid, syscall.SIGKILL)
+			case <-stop:
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			terminate()
+		case <-stop:
+		}
+	}()
+	exited := waitExited(pgid) == nil
+	if exited {
+		// descendants may keep the pipes open after the leader exits
+		terminate()
+	}
 	ioDone.Wait() // call this before cmd.Wait!
-	return cmd.Wait()
+	if exited {
+		// the leader is not reaped yet, so pgid can't be reused by others
+		signalGroup(pgid, syscall.SIGKILL)
+	}
+	close(stop)
+	wg.Wait()
+	err = cmd.Wait()
+	go reapGroup(pgid)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
 }
 
 func RunAll(ctx context.Context, ps []proc.Proc, verboseLog bool) error {
+	_, err := RunAllWithResults(ctx, ps, verboseLog)
+	return err
+}
+
+// RunAllWithResults runs all processes in parallel, and returns the result of each process
+func RunAllWithResults(ctx context.Context, ps []proc.Proc, verboseLog bool) ([]Result, error) {
+	results := make([]Result, len(ps))
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	var wg sync.WaitGroup
@@ -74,7 +138,8 @@ func RunAll(ctx context.Context, ps []proc.Proc, verboseLog bool) error {
 				LogFilePrefix: strings.Replace(p.Name, "/", "-", -1),
 				LogDir:        p.LogDir,
 			}
-			if err := r.TryRun(ctx, p); err != nil {
+			results[i] = r.TryRunWithResult(ctx, p)
+			if err := results[i].Err; err != nil {
 				log.Errorf("#<%s> exited with error: %v", p.Name, err)
 				atomic.AddInt32(&fail, 1)
 				cancel()
@@ -86,7 +151,7 @@ func RunAll(ctx context.Context, ps []proc.Proc, verboseLog bool) error {
 	}
 	wg.Wait()
 	if fail != 0 {
-		return fmt.Errorf("%d tasks failed", fail)
+		return results, fmt.Errorf("%d tasks failed", fail)
 	}
-	return nil
+	return results, nil
 }
@@ -0,0 +1,39 @@
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package local
+
+import (
+	"errors"
+	"syscall"
+)
+
+var errNotSupported = errors.New("not supported on this platform")
+
+func becomeSubreaper() error {
+	return errNotSupported
+}
+
+func reapOrphans() {}
+
+// waitExited blocks until the process exits, without reaping it, so that its pid stays valid as the process group ID
+func waitExited(pid int) error {
+	kq, err := syscall.Kqueue()
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(kq)
+	var ev syscall.Kevent_t
+	syscall.SetKevent(&ev, pid, syscall.EVFILT_PROC, syscall.EV_ADD|syscall.EV_ONESHOT)
+	ev.Fflags = syscall.NOTE_EXIT
+	events := make([]syscall.Kevent_t, 1)
+	for {
+		_, err := syscall.Kevent(kq, []syscall.Kevent_t{ev}, events, nil)
+		switch err {
+		case nil, syscall.ESRCH: // ESRCH: it has exited before being watched
+			return nil
+		case syscall.EINTR:
+		default:
+			return err
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package local
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	prSetChildSubreaper = 36
+	pAll                = 0
+	pPID                = 1
+	wNoWait             = 0x1000000
+)
+
+// siginfoPidOffset is the offset of si_pid in siginfo_t, where the union follows three ints, aligned to a pointer
+const siginfoPidOffset = (12 + unsafe.Sizeof(uintptr(0)) - 1) &^ (unsafe.Sizeof(uintptr(0)) - 1)
+
+// reapPeriod is the time to wait before peeking again at an exited child which is not an orphan
+const reapPeriod = 1 * time.Second
+
+// becomeSubreaper makes orphaned descendants children of this process instead of init, so that they can be reaped
+func becomeSubreaper() error {
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 1, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// reapOrphans reaps the orphans which called setsid, as they left the process groups which are reaped by reapGroup.
+// Other exited children are left to whoever started them, so that their exec.Cmd still gets the exit status.
+func reapOrphans() {
+	sid, _ := getsid(0)
+	var info [128]byte // siginfo_t
+	for {
+		_, _, errno := syscall.Syscall6(syscall.SYS_WAITID, pAll, 0, uintptr(unsafe.Pointer(&info[0])), syscall.WEXITED|wNoWait, 0, 0)
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 { // ECHILD: no children yet
+			time.Sleep(reapPeriod)
+			continue
+		}
+		pid := int(*(*int32)(unsafe.Pointer(&info[siginfoPidOffset])))
+		if s, err := getsid(pid); err == nil && s != sid {
+			var ws syscall.WaitStatus
+			syscall.Wait4(pid, &ws, syscall.WNOHANG, nil)
+			continue
+		}
+		time.Sleep(reapPeriod)
+	}
+}
+
+func getsid(pid int) (int, error) {
+	sid, _, errno := syscall.RawSyscall(syscall.SYS_GETSID, uintptr(pid), 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(sid), nil
+}
+
+// waitExited blocks until the process exits, without reaping it, so that its pid stays valid as the process group ID
+func waitExited(pid int) error {
+	var info [128]byte // siginfo_t
+	for {
+		_, _, errno := syscall.Syscall6(syscall.SYS_WAITID, pPID, uintptr(pid), uintptr(unsafe.Pointer(&info[0])), syscall.WEXITED|wNoWait, 0, 0)
+		if errno != syscall.EINTR {
+			if errno != 0 {
+				return errno
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,17 @@
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd,!windows
+
+package local
+
+import "errors"
+
+var errNotSupported = errors.New("not supported on this platform")
+
+func becomeSubreaper() error {
+	return errNotSupported
+}
+
+func reapOrphans() {}
+
+func waitExited(pid int) error {
+	return errNotSupported
+}
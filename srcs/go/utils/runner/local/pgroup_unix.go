@@ -0,0 +1,30 @@
+// +build !windows
+
+package local
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setpgid places the process in its own process group, so that its descendants can be signaled together
+func setpgid(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+func signalGroup(pgid int, sig syscall.Signal) {
+	syscall.Kill(-pgid, sig)
+}
+
+// reapGroup waits for members of the process group which became children of this process as orphans
+func reapGroup(pgid int) {
+	for {
+		var ws syscall.WaitStatus
+		if _, err := syscall.Wait4(-pgid, &ws, 0, nil); err != nil && err != syscall.EINTR {
+			return // ECHILD: no more children in the group
+		}
+	}
+}
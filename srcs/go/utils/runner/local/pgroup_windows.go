@@ -0,0 +1,40 @@
+package local
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+func setpgid(cmd *exec.Cmd) {}
+
+// signalGroup kills the process only, as there are no process groups
+func signalGroup(pid int, sig syscall.Signal) {
+	if p, err := os.FindProcess(pid); err == nil {
+		p.Kill()
+	}
+}
+
+func reapGroup(pgid int) {}
+
+var errNotSupported = errors.New("not supported on this platform")
+
+func becomeSubreaper() error {
+	return errNotSupported
+}
+
+func reapOrphans() {}
+
+// waitExited blocks until the process exits, the open handles of exec.Cmd keep its pid from being reused
+func waitExited(pid int) error {
+	h, err := syscall.OpenProcess(syscall.SYNCHRONIZE, false, uint32(pid))
+	if err != nil {
+		return err
+	}
+	defer syscall.CloseHandle(h)
+	if _, err := syscall.WaitForSingleObject(h, syscall.INFINITE); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/job"
+	"github.com/lsds/KungFu/srcs/go/kungfu/runtime"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/utils/ssh"
+)
+
+// CheckPrograms runs kungfu-run -check-only on all hosts, and reports the problems of starting the programs of j found by all of them at once,
+// instead of the peers failing one by one as they are started.
+func CheckPrograms(ctx context.Context, j job.Job, sp runtime.SystemParameters) error {
+	ps := staticJobProcs(j, sp, true, `-check-only`)
+	problems := make(map[string][]string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, p := range ps {
+		wg.Add(1)
+		go func(host, script string) {
+			defer wg.Done()
+			found := func() []string {
+				client, err := ssh.New(sp.SSH.Config(host))
+				if err != nil {
+					return []string{err.Error()}
+				}
+				defer client.Close()
+				bs, err := client.Output(ctx, script)
+				if r, ok := parseCheckReport(bs); ok {
+					return r.Problems
+				}
+				if err != nil {
+					return []string{fmt.Sprintf("kungfu-run -check-only failed: %v", err)}
+				}
+				return nil
+			}()
+			if len(found) > 0 {
+				mu.Lock()
+				problems[host] = found
+				mu.Unlock()
+			}
+		}(p.Hostname, p.Script())
+	}
+	wg.Wait()
+	if len(problems) > 0 {
+		return fmt.Errorf("programs can't be started on %d of %d hosts:\n%s", len(problems), len(ps), formatProblems(problems))
+	}
+	log.Debugf("programs can be started on all %d hosts", len(ps))
+	return nil
+}
+
+// parseCheckReport finds the report of kungfu-run -check-only, which is the last line of its stdout
+func parseCheckReport(bs []byte) (*job.ProgramCheckError, bool) {
+	var last string
+	s := bufio.NewScanner(bytes.NewReader(bs))
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); len(line) > 0 {
+			last = line
+		}
+	}
+	var r job.ProgramCheckError
+	if err := json.Unmarshal([]byte(last), &r); err != nil {
+		return nil, false
+	}
+	return &r, true
+}
+
+func formatProblems(problems map[string][]string) string {
+	var hosts []string
+	for h := range problems {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	var lines []string
+	for _, h := range hosts {
+		for _, p := range problems[h] {
+			lines = append(lines, fmt.Sprintf("%s: %s", h, p))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
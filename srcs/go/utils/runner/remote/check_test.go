@@ -0,0 +1,18 @@
+package remote
+
+import "testing"
+
+func Test_parseCheckReport(t *testing.T) {
+	out := "[I] arguments: ...\n{\"Problems\":[\"python3: not found in PATH=/usr/bin\"]}\n"
+	r, ok := parseCheckReport([]byte(out))
+	if !ok || len(r.Problems) != 1 {
+		t.Errorf("unexpected report: %v", r)
+	}
+	if _, ok := parseCheckReport([]byte("flag provided but not defined: -check-only\n")); ok {
+		t.Errorf("output without report should not be parsed")
+	}
+	problems := map[string][]string{"b": {"x"}, "a": {"y", "z"}}
+	if s := formatProblems(problems); s != "a: y\na: z\nb: x" {
+		t.Errorf("unexpected format: %q", s)
+	}
+}
@@ -0,0 +1,58 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/utils/ssh"
+)
+
+// CollectedFile is a file fetched from a host after a job
+type CollectedFile struct {
+	Host string
+	File string
+	Data []byte
+}
+
+// CollectFiles fetches files from all hosts, relative paths are relative to the home directory of the user of opts.
+// Files missing on a host are skipped with a warning.
+func CollectFiles(ctx context.Context, opts ssh.Options, hl plan.HostList, files []string) []CollectedFile {
+	var mu sync.Mutex
+	var collected []CollectedFile
+	var wg sync.WaitGroup
+	for _, h := range hl {
+		wg.Add(1)
+		go func(h plan.HostSpec) {
+			defer wg.Done()
+			host := hl.LookupHost(h.IPv4)
+			client, err := ssh.New(opts.Config(host))
+			if err != nil {
+				log.Warnf("failed to collect files from %s: %v", host, err)
+				return
+			}
+			defer client.Close()
+			for _, f := range files {
+				bs, err := client.Output(ctx, fmt.Sprintf("cat %q", f))
+				if err != nil {
+					log.Warnf("failed to collect %s from %s: %v", f, host, err)
+					continue
+				}
+				mu.Lock()
+				collected = append(collected, CollectedFile{Host: host, File: f, Data: bs})
+				mu.Unlock()
+			}
+		}(h)
+	}
+	wg.Wait()
+	sort.Slice(collected, func(i, j int) bool {
+		if collected[i].Host != collected[j].Host {
+			return collected[i].Host < collected[j].Host
+		}
+		return collected[i].File < collected[j].File
+	})
+	return collected
+}
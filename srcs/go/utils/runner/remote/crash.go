@@ -0,0 +1,48 @@
+package remote
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/runner"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/utils"
+)
+
+// crashCollector picks the crash reports forwarded by remote kungfu-run from their outputs
+type crashCollector struct {
+	sync.Mutex
+	crashes []runner.ForwardedCrash
+}
+
+func (c *crashCollector) Write(bs []byte) (int, error) {
+	line := strings.TrimSpace(string(bs))
+	if !strings.HasPrefix(line, runner.CrashMarker) {
+		return len(bs), nil
+	}
+	var f runner.ForwardedCrash
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, runner.CrashMarker)), &f); err != nil {
+		log.Warnf("invalid crash report: %v", err)
+		return len(bs), nil
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.crashes = append(c.crashes, f)
+	return len(bs), nil
+}
+
+// report logs the collected crash reports, in the order of ranks
+func (c *crashCollector) report() {
+	c.Lock()
+	defer c.Unlock()
+	if len(c.crashes) == 0 {
+		return
+	}
+	sort.SliceStable(c.crashes, func(i, j int) bool { return c.crashes[i].Rank < c.crashes[j].Rank })
+	log.Errorf("%s crashed", utils.Pluralize(len(c.crashes), "peer", "peers"))
+	for _, f := range c.crashes {
+		log.Errorf("crash report of %s (rank %d, version %d): %s", f.Peer, f.Rank, f.Version, f.Crash)
+	}
+}
@@ -0,0 +1,26 @@
+package remote
+
+import (
+	"github.com/lsds/KungFu/srcs/go/kungfu/runner"
+	"github.com/lsds/KungFu/srcs/go/utils/ssh"
+)
+
+// SSHOptions returns the SSH settings of the remote runners given by the flags,
+// the jump hosts of hosts in the hostfile override -ssh-proxy.
+func SSHOptions(f *runner.FlagSet) ssh.Options {
+	opts := ssh.Options{
+		User:          f.User,
+		Proxy:         f.SSHProxy,
+		ForwardAgent:  f.ForwardAgent,
+		HostKeyPolicy: ssh.HostKeyPolicy(f.HostKeyPolicy),
+	}
+	for _, h := range f.HostList {
+		if len(h.SSHProxy) > 0 {
+			if opts.HostProxies == nil {
+				opts.HostProxies = make(map[string]string)
+			}
+			opts.HostProxies[h.PublicAddr] = h.SSHProxy
+		}
+	}
+	return opts
+}
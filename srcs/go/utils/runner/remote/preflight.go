@@ -0,0 +1,128 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/envsnap"
+	"github.com/lsds/KungFu/srcs/go/log"
+	"github.com/lsds/KungFu/srcs/go/plan"
+	"github.com/lsds/KungFu/srcs/go/utils"
+	"github.com/lsds/KungFu/srcs/go/utils/ssh"
+)
+
+// HostVersions is the versions of the GPU software stack reported by a host
+type HostVersions struct {
+	Host     string
+	Versions map[string]string
+}
+
+// Preflight checks that all hosts have the same GPU models, driver, CUDA, NCCL, Python and TensorFlow versions,
+// since a mixed stack fails in cryptic ways in the middle of a run.
+func Preflight(ctx context.Context, opts ssh.Options, hl plan.HostList) error {
+	hvs, err := ProbeHosts(ctx, opts, hl, envsnap.VersionScript)
+	if err != nil {
+		return err
+	}
+	if diff := diffVersions(hvs); len(diff) > 0 {
+		return fmt.Errorf("%s mismatch across %d hosts:\n%s", strings.Join(diff, ", "), len(hvs), formatVersions(hvs, diff))
+	}
+	log.Infof("preflight passed on %d hosts:\n%s", len(hvs), formatVersions(hvs, nil))
+	return nil
+}
+
+// ProbeHosts runs a script printing <key>=<value> lines on all hosts, e.g. envsnap.VersionScript, and returns the values by host.
+// Hosts failed to probe are returned without values along with the error.
+func ProbeHosts(ctx context.Context, opts ssh.Options, hl plan.HostList, script string) ([]HostVersions, error) {
+	hvs := make([]HostVersions, len(hl))
+	errs := make([]error, len(hl))
+	var wg sync.WaitGroup
+	for i, h := range hl {
+		wg.Add(1)
+		go func(i int, h plan.HostSpec) {
+			defer wg.Done()
+			host := hl.LookupHost(h.IPv4)
+			hvs[i].Host = host
+			errs[i] = func() error {
+				client, err := ssh.New(opts.Config(host))
+				if err != nil {
+					return err
+				}
+				defer client.Close()
+				bs, err := client.Output(ctx, script)
+				if err != nil {
+					return fmt.Errorf("failed to probe %s: %v", host, err)
+				}
+				hvs[i].Versions = parseVersions(bs)
+				return nil
+			}()
+		}(i, h)
+	}
+	wg.Wait()
+	return hvs, utils.MergeErrors(errs, "probe")
+}
+
+func parseVersions(bs []byte) map[string]string {
+	vs := make(map[string]string)
+	s := bufio.NewScanner(bytes.NewReader(bs))
+	for s.Scan() {
+		if kv := strings.SplitN(strings.TrimSpace(s.Text()), "=", 2); len(kv) == 2 {
+			vs[kv[0]] = kv[1]
+		}
+	}
+	return vs
+}
+
+// diffVersions returns the keys of which hosts report different versions
+func diffVersions(hvs []HostVersions) []string {
+	var diff []string
+	for _, k := range envsnap.VersionKeys {
+		values := make(map[string]struct{})
+		for _, hv := range hvs {
+			values[hv.Versions[k]] = struct{}{}
+		}
+		if len(values) > 1 {
+			diff = append(diff, k)
+		}
+	}
+	return diff
+}
+
+// formatVersions formats a table of hosts and versions, keys in diff are marked with *
+func formatVersions(hvs []HostVersions, diff []string) string {
+	marked := make(map[string]bool)
+	for _, k := range diff {
+		marked[k] = true
+	}
+	hvs = append([]HostVersions(nil), hvs...)
+	sort.Slice(hvs, func(i, j int) bool { return hvs[i].Host < hvs[j].Host })
+	buf := &bytes.Buffer{}
+	w := tabwriter.NewWriter(buf, 0, 4, 2, ' ', 0)
+	fmt.Fprint(w, "host")
+	for _, k := range envsnap.VersionKeys {
+		if marked[k] {
+			k += "*"
+		}
+		fmt.Fprintf(w, "\t%s", k)
+	}
+	fmt.Fprintln(w)
+	for _, hv := range hvs {
+		fmt.Fprint(w, hv.Host)
+		for _, k := range envsnap.VersionKeys {
+			v, ok := hv.Versions[k]
+			if !ok {
+				v = "?"
+			}
+			fmt.Fprintf(w, "\t%s", v)
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+	return buf.String()
+}
@@ -0,0 +1,25 @@
+package remote
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_diffVersions(t *testing.T) {
+	out := "gpu=4 Tesla V100\ndriver=450.80\ncuda=10.2\nnccl=2.7.8\npython=3.6.9\ntensorflow=1.15.0\n"
+	a := HostVersions{Host: `a`, Versions: parseVersions([]byte(out))}
+	b := HostVersions{Host: `b`, Versions: parseVersions([]byte(strings.Replace(out, "450.80", "418.67", 1)))}
+	if a.Versions[`gpu`] != `4 Tesla V100` {
+		t.Errorf("unexpected gpu: %q", a.Versions[`gpu`])
+	}
+	if diff := diffVersions([]HostVersions{a, a}); len(diff) != 0 {
+		t.Errorf("unexpected diff: %q", diff)
+	}
+	diff := diffVersions([]HostVersions{a, b})
+	if len(diff) != 1 || diff[0] != `driver` {
+		t.Errorf("unexpected diff: %q", diff)
+	}
+	if table := formatVersions([]HostVersions{b, a}, diff); !strings.Contains(table, "driver*") || strings.Index(table, "418.67") < strings.Index(table, "450.80") {
+		t.Errorf("unexpected table:\n%s", table)
+	}
+}
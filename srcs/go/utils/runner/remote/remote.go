@@ -3,6 +3,7 @@ package remote
 import (
 	"context"
 	"fmt"
+	"io"
 	"path"
 	"strconv"
 	"sync"
@@ -19,9 +20,16 @@ import (
 	"github.com/lsds/KungFu/srcs/go/utils/xterm"
 )
 
-func RemoteRunAll(ctx context.Context, user string, ps []proc.Proc, verboseLog bool, logDir string) error {
+func RemoteRunAll(ctx context.Context, opts ssh.Options, ps []proc.Proc, verboseLog bool, logDir string) error {
+	return remoteRunAll(ctx, opts, ps, verboseLog, logDir, nil, nil)
+}
+
+// remoteRunAll runs ps as RemoteRunAll does, the stdout of all ps is also written to stdout and passed to onLine if not nil
+func remoteRunAll(ctx context.Context, opts ssh.Options, ps []proc.Proc, verboseLog bool, logDir string, stdout io.Writer, onLine LineFunc) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
+	var crashes crashCollector
+	defer crashes.report()
 	var wg sync.WaitGroup
 	var fail int32
 	for i, p := range ps {
@@ -29,10 +37,7 @@ func RemoteRunAll(ctx context.Context, user string, ps []proc.Proc, verboseLog b
 		go func(i int, p proc.Proc) {
 			defer wg.Done()
 			t0 := time.Now()
-			config := ssh.Config{
-				Host: p.Hostname,
-				User: user,
-			}
+			config := opts.Config(p.Hostname)
 			client, err := ssh.New(config)
 			if err != nil {
 				log.Errorf("#<%s> failed to new SSH Client with config: %v: %v", p.Name, config, err)
@@ -44,6 +49,13 @@ func RemoteRunAll(ctx context.Context, user string, ps []proc.Proc, verboseLog b
 				redirectors = append(redirectors, iostream.NewXTermRedirector(p.Name, xterm.BasicColors.Choose(i)))
 			}
 			redirectors = append(redirectors, iostream.NewFileRedirector(path.Join(logDir, p.Name)))
+			redirectors = append(redirectors, &iostream.StdWriters{Stdout: &crashes, Stderr: &iostream.Null{}})
+			if stdout != nil {
+				redirectors = append(redirectors, &iostream.StdWriters{Stdout: stdout, Stderr: &iostream.Null{}})
+			}
+			if onLine != nil {
+				redirectors = append(redirectors, &iostream.StdWriters{Stdout: lineHook{host: p.Name, f: onLine}, Stderr: &iostream.Null{}})
+			}
 			if err := client.Watch(ctx, p.Script(), redirectors); err != nil {
 				log.Errorf("#<%s> exited with error: %v, took %s", p.Name, err, time.Since(t0))
 				atomic.AddInt32(&fail, 1)
@@ -63,6 +75,16 @@ func RemoteRunAll(ctx context.Context, user string, ps []proc.Proc, verboseLog b
 const runnerProg = `kungfu-run`
 
 func RunStaticKungFuJob(ctx context.Context, j job.Job, sp runtime.SystemParameters, quiet bool) error {
+	return RemoteRunAll(ctx, sp.SSH, staticJobProcs(j, sp, quiet), true, j.LogDir)
+}
+
+// MeasureStaticKungFuJob runs the job as RunStaticKungFuJob does, and returns the duration of the work reported by the peers,
+// which excludes the overhead of SSH setup and spawning processes. It returns 0 if no peer reported.
+func MeasureStaticKungFuJob(ctx context.Context, j job.Job, sp runtime.SystemParameters, quiet bool) (time.Duration, error) {
+	return StreamStaticKungFuJob(ctx, j, sp, quiet, nil)
+}
+
+func staticJobProcs(j job.Job, sp runtime.SystemParameters, quiet bool, extraFlags ...string) []proc.Proc {
 	hl := sp.HostList
 	runners := hl.GenRunnerList(sp.RunnerPort)
 	runnerFlags := []string{
@@ -70,17 +92,47 @@ func RunStaticKungFuJob(ctx context.Context, j job.Job, sp runtime.SystemParamet
 
 		`PYTHONWARNINGS=ignore`,
 		`TF_CPP_MIN_LOG_LEVEL=2`,
+	}
+	runnerFlags = append(runnerFlags, j.Envs.Assignments()...)
+	runnerFlags = append(runnerFlags,
 		runnerProg,
 		`-np`, strconv.Itoa(sp.ClusterSize),
 		`-H`, hl.String(),
 		`-port-range`, sp.WorkerPortRange.String(),
 		`-nic`, sp.Nic,
-		`-strategy`, j.Strategy.String(),
+		`-strategy`, j.StrategySpec(),
 		`-logdir`, j.LogDir,
-	}
+		`-forward-crashes`,
+	)
 	if quiet {
 		runnerFlags = append(runnerFlags, `-q`)
 	}
+	if len(j.Role) > 0 {
+		runnerFlags = append(runnerFlags, `-role`, j.Role)
+	}
+	if len(j.EnvProbe) > 0 {
+		runnerFlags = append(runnerFlags, `-env-probe`, strconv.Quote(j.EnvProbe))
+	}
+	runnerFlags = append(runnerFlags, constraintFlags(j.Constraints)...)
+	if j.Seed != 0 {
+		runnerFlags = append(runnerFlags, `-seed`, strconv.FormatUint(j.Seed, 10))
+	}
+	for _, s := range j.LogSinks {
+		runnerFlags = append(runnerFlags, `-log-sink`, s)
+	}
+	for _, h := range j.Webhooks {
+		runnerFlags = append(runnerFlags, `-webhook`, h)
+	}
+	runnerFlags = append(runnerFlags, j.Binaries.Flags()...)
+	runnerFlags = append(runnerFlags, pinCoresFlags(j)...)
+	runnerFlags = append(runnerFlags, jobIDFlags(j)...)
+	runnerFlags = append(runnerFlags, dirFlags(j)...)
+	runnerFlags = append(runnerFlags, oversubscribeFlags(j)...)
+	runnerFlags = append(runnerFlags, familyFlags(j)...)
+	runnerFlags = append(runnerFlags, staggerFlags(j)...)
+	runnerFlags = append(runnerFlags, perfFlags(j)...)
+	runnerFlags = append(runnerFlags, degradedFlags(j)...)
+	runnerFlags = append(runnerFlags, extraFlags...)
 	var ps []proc.Proc
 	for _, r := range runners {
 		p := proc.Proc{
@@ -91,10 +143,14 @@ func RunStaticKungFuJob(ctx context.Context, j job.Job, sp runtime.SystemParamet
 		}
 		ps = append(ps, p)
 	}
-	return RemoteRunAll(ctx, sp.User, ps, true, j.LogDir)
+	return ps
 }
 
 func RunElasticKungFuJob(ctx context.Context, j job.Job, sp runtime.SystemParameters, quiet bool) error {
+	return RemoteRunAll(ctx, sp.SSH, elasticJobProcs(j, sp, quiet), true, j.LogDir)
+}
+
+func elasticJobProcs(j job.Job, sp runtime.SystemParameters, quiet bool) []proc.Proc {
 	hl := sp.HostList
 	runners := hl.GenRunnerList(sp.RunnerPort)
 	runnerFlags := []string{
@@ -102,7 +158,9 @@ func RunElasticKungFuJob(ctx context.Context, j job.Job, sp runtime.SystemParame
 
 		`PYTHONWARNINGS=ignore`,
 		`TF_CPP_MIN_LOG_LEVEL=2`,
-
+	}
+	runnerFlags = append(runnerFlags, j.Envs.Assignments()...)
+	runnerFlags = append(runnerFlags,
 		runnerProg,
 		`-w`,
 		`-k`,
@@ -111,12 +169,38 @@ func RunElasticKungFuJob(ctx context.Context, j job.Job, sp runtime.SystemParame
 		`-H`, hl.String(),
 		`-port-range`, sp.WorkerPortRange.String(),
 		`-nic`, sp.Nic,
-		`-strategy`, j.Strategy.String(),
+		`-strategy`, j.StrategySpec(),
 		`-logdir`, j.LogDir,
-	}
+		`-forward-crashes`,
+	)
 	if quiet {
 		runnerFlags = append(runnerFlags, `-q`)
 	}
+	if len(j.Role) > 0 {
+		runnerFlags = append(runnerFlags, `-role`, j.Role)
+	}
+	if len(j.EnvProbe) > 0 {
+		runnerFlags = append(runnerFlags, `-env-probe`, strconv.Quote(j.EnvProbe))
+	}
+	runnerFlags = append(runnerFlags, constraintFlags(j.Constraints)...)
+	if j.Seed != 0 {
+		runnerFlags = append(runnerFlags, `-seed`, strconv.FormatUint(j.Seed, 10))
+	}
+	for _, s := range j.LogSinks {
+		runnerFlags = append(runnerFlags, `-log-sink`, s)
+	}
+	for _, h := range j.Webhooks {
+		runnerFlags = append(runnerFlags, `-webhook`, h)
+	}
+	runnerFlags = append(runnerFlags, j.Binaries.Flags()...)
+	runnerFlags = append(runnerFlags, pinCoresFlags(j)...)
+	runnerFlags = append(runnerFlags, jobIDFlags(j)...)
+	runnerFlags = append(runnerFlags, dirFlags(j)...)
+	runnerFlags = append(runnerFlags, oversubscribeFlags(j)...)
+	runnerFlags = append(runnerFlags, familyFlags(j)...)
+	runnerFlags = append(runnerFlags, staggerFlags(j)...)
+	runnerFlags = append(runnerFlags, perfFlags(j)...)
+	runnerFlags = append(runnerFlags, degradedFlags(j)...)
 	var ps []proc.Proc
 	for _, r := range runners {
 		p := proc.Proc{
@@ -127,5 +211,80 @@ func RunElasticKungFuJob(ctx context.Context, j job.Job, sp runtime.SystemParame
 		}
 		ps = append(ps, p)
 	}
-	return RemoteRunAll(ctx, sp.User, ps, true, j.LogDir)
+	return ps
+}
+
+func pinCoresFlags(j job.Job) []string {
+	if !j.PinCores {
+		return nil
+	}
+	return []string{`-pin-cores`, `-reserved-cores`, strconv.Itoa(j.ReservedCores)}
+}
+
+func jobIDFlags(j job.Job) []string {
+	if len(j.ID) == 0 {
+		return nil
+	}
+	flags := []string{`-job-id`, j.ID}
+	if len(j.RankStore) > 0 {
+		flags = append(flags, `-rank-store`, j.RankStore)
+	}
+	return flags
+}
+
+func dirFlags(j job.Job) []string {
+	if len(j.Dir) == 0 {
+		return nil
+	}
+	return []string{`-workdir`, j.Dir}
+}
+
+func oversubscribeFlags(j job.Job) []string {
+	if j.Oversubscribe <= 1 {
+		return nil
+	}
+	return []string{`-oversubscribe`, strconv.Itoa(j.Oversubscribe)}
+}
+
+func familyFlags(j job.Job) []string {
+	if j.PreferFamily <= 0 {
+		return nil
+	}
+	return []string{`-prefer-family`, strconv.Itoa(j.PreferFamily)}
+}
+
+func staggerFlags(j job.Job) []string {
+	if j.StartStagger <= 0 {
+		return nil
+	}
+	return []string{`-stagger`, j.StartStagger.String()}
+}
+
+func perfFlags(j job.Job) []string {
+	var flags []string
+	if j.PerfReport {
+		flags = append(flags, `-perf-report`)
+	}
+	if j.GCPercent > 0 {
+		flags = append(flags, `-gc-percent`, strconv.Itoa(j.GCPercent))
+	}
+	return flags
+}
+
+func degradedFlags(j job.Job) []string {
+	if len(j.DegradedPolicy) == 0 {
+		return nil
+	}
+	return []string{`-degraded-policy`, j.DegradedPolicy.String()}
+}
+
+func constraintFlags(c plan.Constraints) []string {
+	var flags []string
+	if len(c.Require) > 0 {
+		flags = append(flags, `-require`, c.Require.String())
+	}
+	if len(c.SpreadAcross) > 0 {
+		flags = append(flags, `-spread-across`, c.SpreadAcross)
+	}
+	return flags
 }
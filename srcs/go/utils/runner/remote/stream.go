@@ -0,0 +1,43 @@
+package remote
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/job"
+	"github.com/lsds/KungFu/srcs/go/kungfu/runtime"
+)
+
+// LineFunc is called with each line of the stdout of the remote kungfu-run on host, as it is written.
+// It is called concurrently for different hosts.
+type LineFunc func(host, line string)
+
+// lineHook passes each line written to it to f
+type lineHook struct {
+	host string
+	f    LineFunc
+}
+
+func (h lineHook) Write(bs []byte) (int, error) {
+	h.f(h.host, strings.TrimRight(string(bs), "\r\n"))
+	return len(bs), nil
+}
+
+// StreamStaticKungFuJob runs the job as MeasureStaticKungFuJob does, and calls onLine with the lines written by the
+// remote kungfu-run as the job runs, which include the outputs of the peers unless quiet.
+// Cancelling ctx from onLine stops the job.
+func StreamStaticKungFuJob(ctx context.Context, j job.Job, sp runtime.SystemParameters, quiet bool, onLine LineFunc) (time.Duration, error) {
+	ps := staticJobProcs(j, sp, quiet, `-summary`, `-`)
+	var c summaryCollector
+	if err := remoteRunAll(ctx, sp.SSH, ps, true, j.LogDir, &c, onLine); err != nil {
+		return 0, err
+	}
+	return c.workDuration(), nil
+}
+
+// StreamElasticKungFuJob runs the job as RunElasticKungFuJob does, and calls onLine with the lines written by the remote kungfu-run
+// as StreamStaticKungFuJob does.
+func StreamElasticKungFuJob(ctx context.Context, j job.Job, sp runtime.SystemParameters, quiet bool, onLine LineFunc) error {
+	return remoteRunAll(ctx, sp.SSH, elasticJobProcs(j, sp, quiet), true, j.LogDir, nil, onLine)
+}
@@ -0,0 +1,62 @@
+package remote
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu/runner"
+	"github.com/lsds/KungFu/srcs/go/log"
+)
+
+type receivedSummary struct {
+	runner.Summary
+	received time.Time
+}
+
+// summaryCollector picks the summary lines from the outputs of remote kungfu-run
+type summaryCollector struct {
+	sync.Mutex
+	summaries []receivedSummary
+}
+
+func (c *summaryCollector) Write(bs []byte) (int, error) {
+	line := strings.TrimSpace(string(bs))
+	if !strings.HasPrefix(line, runner.SummaryMarker) {
+		return len(bs), nil
+	}
+	t := time.Now()
+	var s runner.Summary
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, runner.SummaryMarker)), &s); err != nil {
+		log.Warnf("invalid summary: %v", err)
+		return len(bs), nil
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.summaries = append(c.summaries, receivedSummary{Summary: s, received: t})
+	return len(bs), nil
+}
+
+// workDuration returns the span of the work reported by all peers, in the local clock.
+// The clock offset of each host is estimated NTP-style, from the time its summary was saved and received,
+// ignoring the latency of delivering the summary.
+func (c *summaryCollector) workDuration() time.Duration {
+	c.Lock()
+	defer c.Unlock()
+	var start, end time.Time
+	for _, s := range c.summaries {
+		if s.WorkStart == nil {
+			continue
+		}
+		offset := s.SavedAt().Sub(s.received)
+		t0, t1 := s.WorkStart.Add(-offset), s.WorkEnd.Add(-offset)
+		if start.IsZero() || t0.Before(start) {
+			start = t0
+		}
+		if end.IsZero() || t1.After(end) {
+			end = t1
+		}
+	}
+	return end.Sub(start)
+}
@@ -0,0 +1,96 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// HostKeyPolicy decides which host keys are trusted
+type HostKeyPolicy string
+
+const (
+	HostKeyInsecure   HostKeyPolicy = `insecure`    // trust all host keys
+	HostKeyKnownHosts HostKeyPolicy = `known-hosts` // trust the host keys in ~/.ssh/known_hosts only
+	HostKeyAcceptNew  HostKeyPolicy = `accept-new`  // trust the host keys in ~/.ssh/known_hosts, and add the keys of unknown hosts to it
+)
+
+var HostKeyPolicies = []HostKeyPolicy{
+	HostKeyInsecure,
+	HostKeyKnownHosts,
+	HostKeyAcceptNew,
+}
+
+var errInvalidHostKeyPolicy = errors.New("invalid host key policy")
+
+func (p *HostKeyPolicy) Set(val string) error {
+	for _, q := range HostKeyPolicies {
+		if string(q) == val {
+			*p = q
+			return nil
+		}
+	}
+	return fmt.Errorf("%v: %q", errInvalidHostKeyPolicy, val)
+}
+
+func (p HostKeyPolicy) String() string {
+	return string(p)
+}
+
+func HostKeyPolicyNames() []string {
+	var names []string
+	for _, p := range HostKeyPolicies {
+		names = append(names, string(p))
+	}
+	return names
+}
+
+func knownHostsFile() string {
+	usr, _ := user.Current()
+	return path.Join(usr.HomeDir, ".ssh", "known_hosts")
+}
+
+// knownHostsMu serialises the updates of known_hosts by all clients of the accept-new policy
+var knownHostsMu sync.Mutex
+
+func (p HostKeyPolicy) callback() (ssh.HostKeyCallback, error) {
+	switch p {
+	case ``, HostKeyInsecure:
+		return ssh.InsecureIgnoreHostKey(), nil
+	case HostKeyKnownHosts:
+		return knownhosts.New(knownHostsFile())
+	case HostKeyAcceptNew:
+		filename := knownHostsFile()
+		if f, err := os.OpenFile(filename, os.O_CREATE|os.O_RDONLY, 0600); err == nil {
+			f.Close()
+		}
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			knownHostsMu.Lock()
+			defer knownHostsMu.Unlock()
+			check, err := knownhosts.New(filename)
+			if err != nil {
+				return err
+			}
+			err = check(hostname, remote, key)
+			if ke, ok := err.(*knownhosts.KeyError); !ok || len(ke.Want) > 0 {
+				return err // nil, or a changed key
+			}
+			f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0600)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+			return err
+		}, nil
+	}
+	return nil, fmt.Errorf("%v: %q, must be one of %s", errInvalidHostKeyPolicy, p, strings.Join(HostKeyPolicyNames(), ", "))
+}
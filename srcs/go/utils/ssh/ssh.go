@@ -8,20 +8,58 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net"
+	"os"
 	"os/user"
 	"path"
+	"strings"
 	"time"
 
 	"github.com/lsds/KungFu/srcs/go/utils/iostream"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
 var defaultTimeout = 8 * time.Second
 
-// Config is a pair of user and host
+// Config is a pair of user and host, and how to reach and trust the host
 type Config struct {
-	User string
-	Host string
+	User          string
+	Host          string
+	Proxy         string // [user@]host[:port] of the jump host, empty to connect directly
+	ForwardAgent  bool   // forward the local ssh-agent to the remote commands
+	HostKeyPolicy HostKeyPolicy
+}
+
+// ParseAddr parses [user@]host[:port]
+func ParseAddr(addr string) Config {
+	if i := strings.LastIndex(addr, "@"); i >= 0 {
+		return Config{User: addr[:i], Host: addr[i+1:]}
+	}
+	return Config{Host: addr}
+}
+
+// Options are the SSH settings shared by all hosts of a remote run
+type Options struct {
+	User          string
+	Proxy         string            // default jump host
+	HostProxies   map[string]string // jump hosts of hosts, overriding Proxy
+	ForwardAgent  bool
+	HostKeyPolicy HostKeyPolicy
+}
+
+// Config returns the Config of a host
+func (o Options) Config(host string) Config {
+	proxy := o.Proxy
+	if p, ok := o.HostProxies[host]; ok {
+		proxy = p
+	}
+	return Config{
+		User:          o.User,
+		Host:          host,
+		Proxy:         proxy,
+		ForwardAgent:  o.ForwardAgent,
+		HostKeyPolicy: o.HostKeyPolicy,
+	}
 }
 
 func withDefaultPort(host string) string {
@@ -43,54 +81,153 @@ func withDefaultUser(name string) string {
 }
 
 func completeConfig(config Config) Config {
-	return Config{
-		User: withDefaultUser(config.User),
-		Host: withDefaultPort(config.Host),
+	config.User = withDefaultUser(config.User)
+	config.Host = withDefaultPort(config.Host)
+	return config
+}
+
+var errNoAuthMethod = errors.New("failed to get key, neither ~/.ssh/id_rsa nor ssh-agent is available")
+
+// agentConns are the connections to the ssh-agent opened for a Client, which are closed with it
+type agentConns []net.Conn
+
+func (a agentConns) Close() {
+	for _, conn := range a {
+		conn.Close()
 	}
 }
 
-func newSSHClient(config Config) (*ssh.Client, error) {
-	config = completeConfig(config)
-	key, err := defaultKeyFile()
+// authMethods authenticates with the keys of the ssh-agent if SSH_AUTH_SOCK is set, and ~/.ssh/id_rsa,
+// the connection to the ssh-agent is added to agents.
+func authMethods(agents *agentConns) ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+	if sock := os.Getenv("SSH_AUTH_SOCK"); len(sock) > 0 {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			*agents = append(*agents, conn)
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	if key, err := defaultKeyFile(); err == nil {
+		methods = append(methods, ssh.PublicKeys(key))
+	}
+	if len(methods) == 0 {
+		return nil, errNoAuthMethod
+	}
+	return methods, nil
+}
+
+func newClientConfig(config Config, agents *agentConns) (*ssh.ClientConfig, error) {
+	auth, err := authMethods(agents)
 	if err != nil {
-		return nil, errors.New("failed to get key")
-	}
-	clientConfig := &ssh.ClientConfig{
-		User: config.User,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(key),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         defaultTimeout,
+		return nil, err
 	}
-	client, err := ssh.Dial("tcp", config.Host, clientConfig)
+	hostKeyCallback, err := config.HostKeyPolicy.callback()
 	if err != nil {
 		return nil, err
 	}
-	return client, nil
+	return &ssh.ClientConfig{
+		User:            config.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         defaultTimeout,
+	}, nil
+}
+
+// newSSHClient connects to config.Host, through config.Proxy if it is not empty.
+// The returned proxy client is nil if config.Host is connected directly.
+// The connections to the ssh-agent are added to agents, also if it fails.
+func newSSHClient(config Config, agents *agentConns) (*ssh.Client, *ssh.Client, error) {
+	config = completeConfig(config)
+	clientConfig, err := newClientConfig(config, agents)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(config.Proxy) == 0 {
+		client, err := ssh.Dial("tcp", config.Host, clientConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+		return client, nil, nil
+	}
+	proxyConfig := ParseAddr(config.Proxy)
+	proxyConfig.HostKeyPolicy = config.HostKeyPolicy
+	proxyConfig = completeConfig(proxyConfig)
+	proxyClientConfig, err := newClientConfig(proxyConfig, agents)
+	if err != nil {
+		return nil, nil, err
+	}
+	proxy, err := ssh.Dial("tcp", proxyConfig.Host, proxyClientConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("jump host %s: %v", proxyConfig.Host, err)
+	}
+	conn, err := proxy.Dial("tcp", config.Host)
+	if err != nil {
+		proxy.Close()
+		return nil, nil, fmt.Errorf("jump host %s failed to reach %s: %v", proxyConfig.Host, config.Host, err)
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, config.Host, clientConfig)
+	if err != nil {
+		conn.Close()
+		proxy.Close()
+		return nil, nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), proxy, nil
 }
 
 // Client is a wrapper for ssh.Client
 type Client struct {
 	config Config
 	client *ssh.Client
+	proxy  *ssh.Client
+	agents agentConns
 }
 
 // New creates a new Client
 func New(cfg Config) (*Client, error) {
-	client, err := newSSHClient(cfg)
+	var agents agentConns
+	client, proxy, err := newSSHClient(cfg, &agents)
 	if err != nil {
+		agents.Close()
 		return nil, err
 	}
-	return &Client{cfg, client}, err
+	c := &Client{config: cfg, client: client, proxy: proxy, agents: agents}
+	if cfg.ForwardAgent {
+		sock := os.Getenv("SSH_AUTH_SOCK")
+		if len(sock) == 0 {
+			c.Close()
+			return nil, errors.New("agent forwarding requires SSH_AUTH_SOCK")
+		}
+		if err := agent.ForwardToRemote(client, sock); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *Client) newSession() (*ssh.Session, error) {
+	session, err := c.client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	if c.config.ForwardAgent {
+		if err := agent.RequestAgentForwarding(session); err != nil {
+			session.Close()
+			return nil, err
+		}
+	}
+	return session, nil
 }
 
 func (c *Client) String() string {
+	if len(c.config.Proxy) > 0 {
+		return fmt.Sprintf("%s@%s via %s", c.config.User, c.config.Host, c.config.Proxy)
+	}
 	return fmt.Sprintf("%s@%s", c.config.User, c.config.Host)
 }
 
 func (c *Client) Watch(ctx context.Context, cmd string, redirectors []*iostream.StdWriters) error {
-	session, err := c.client.NewSession()
+	session, err := c.newSession()
 	if err != nil {
 		return err
 	}
@@ -127,6 +264,30 @@ func (c *Client) Watch(ctx context.Context, cmd string, redirectors []*iostream.
 	}
 }
 
+// Output runs cmd without a terminal and returns its stdout
+func (c *Client) Output(ctx context.Context, cmd string) ([]byte, error) {
+	session, err := c.newSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	type result struct {
+		bs  []byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		bs, err := session.Output(cmd)
+		done <- result{bs, err}
+	}()
+	select {
+	case r := <-done:
+		return r.bs, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 func defaultKeyFile() (ssh.Signer, error) {
 	usr, _ := user.Current()
 	file := path.Join(usr.HomeDir, ".ssh", "id_rsa")
@@ -137,7 +298,12 @@ func defaultKeyFile() (ssh.Signer, error) {
 	return ssh.ParsePrivateKey(buf)
 }
 
-// Close closes the client
+// Close closes the client, and the connection to the jump host if any
 func (c *Client) Close() error {
-	return c.client.Close()
+	err := c.client.Close()
+	if c.proxy != nil {
+		c.proxy.Close()
+	}
+	c.agents.Close()
+	return err
 }
@@ -0,0 +1,178 @@
+// Package strictjson decodes JSON config files strictly, so that a misspelled key is an error rather than a silently zero value.
+// Errors locate the offending input by line and column, and suggest the closest known key for an unknown one.
+package strictjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/lsds/KungFu/srcs/go/utils"
+)
+
+// Error is an invalid input at a position, Line is 0 if the position is unknown
+type Error struct {
+	Name   string // of the input, e.g. the file name
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	if e.Line <= 0 {
+		return fmt.Sprintf("%s: %s", e.Name, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.Name, e.Line, e.Column, e.Msg)
+}
+
+// ReadFile decodes the JSON file into v as Decode does
+func ReadFile(filename string, v interface{}) error {
+	bs, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return Decode(filename, bs, v)
+}
+
+// Decode decodes bs into v, it fails on keys unknown to v, values of wrong types and data after the value
+func Decode(name string, bs []byte, v interface{}) error {
+	r := bytes.NewReader(bs)
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+	if err := d.Decode(v); err != nil {
+		return locate(name, bs, v, err)
+	}
+	rest, _ := ioutil.ReadAll(io.MultiReader(d.Buffered(), r))
+	if trimmed := bytes.TrimLeft(rest, " \t\r\n"); len(trimmed) > 0 {
+		return errorAt(name, bs, len(bs)-len(trimmed), "unexpected data after the value")
+	}
+	return nil
+}
+
+const unknownFieldPrefix = `json: unknown field `
+
+func locate(name string, bs []byte, v interface{}, err error) error {
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		return errorAt(name, bs, int(e.Offset)-1, e.Error())
+	case *json.UnmarshalTypeError:
+		msg := fmt.Sprintf("cannot use %s as %s", e.Value, e.Type)
+		if len(e.Field) > 0 {
+			msg = fmt.Sprintf("%s: %s", e.Field, msg)
+		}
+		return errorAt(name, bs, valueStart(bs, int(e.Offset)), msg)
+	}
+	if err == io.EOF {
+		return &Error{Name: name, Msg: "empty input"}
+	}
+	if err == io.ErrUnexpectedEOF {
+		return errorAt(name, bs, len(bs), "unexpected end of input")
+	}
+	if s := err.Error(); strings.HasPrefix(s, unknownFieldPrefix) {
+		key, qerr := strconv.Unquote(strings.TrimPrefix(s, unknownFieldPrefix))
+		if qerr != nil {
+			return &Error{Name: name, Msg: s}
+		}
+		msg := fmt.Sprintf("unknown key %q", key)
+		if known, ok := utils.Suggest(key, keysOf(reflect.TypeOf(v))); ok {
+			msg += fmt.Sprintf(", did you mean %q?", known)
+		}
+		if off := keyOffset(bs, key); off >= 0 {
+			return errorAt(name, bs, off, msg)
+		}
+		return &Error{Name: name, Msg: msg}
+	}
+	return &Error{Name: name, Msg: err.Error()}
+}
+
+func errorAt(name string, bs []byte, offset int, msg string) *Error {
+	if offset > len(bs) {
+		offset = len(bs)
+	}
+	line := 1 + bytes.Count(bs[:offset], []byte("\n"))
+	col := offset - bytes.LastIndexByte(bs[:offset], '\n')
+	return &Error{Name: name, Line: line, Column: col, Msg: msg}
+}
+
+// valueStart returns the offset of the scalar value ending at end, or of the object or array starting just before end
+func valueStart(bs []byte, end int) int {
+	if end <= 0 || end > len(bs) {
+		return end
+	}
+	i := end - 1
+	switch c := bs[i]; {
+	case c == '{' || c == '[':
+		return i
+	case c == '"':
+		for i--; i >= 0; i-- {
+			if bs[i] == '"' && (i == 0 || bs[i-1] != '\\') {
+				return i
+			}
+		}
+		return end
+	}
+	for i > 0 && strings.IndexByte("0123456789+-.eEtruefalsn", bs[i-1]) >= 0 {
+		i--
+	}
+	return i
+}
+
+// keyOffset returns the offset of the first occurrence of key as an object key in bs, or -1
+func keyOffset(bs []byte, key string) int {
+	quoted, _ := json.Marshal(key)
+	for off := 0; ; {
+		i := bytes.Index(bs[off:], quoted)
+		if i < 0 {
+			return -1
+		}
+		i += off
+		if rest := bytes.TrimLeft(bs[i+len(quoted):], " \t\r\n"); len(rest) > 0 && rest[0] == ':' {
+			return i
+		}
+		off = i + len(quoted)
+	}
+}
+
+// keysOf returns the JSON keys of the structs reachable from t
+func keysOf(t reflect.Type) []string {
+	var keys []string
+	seen := make(map[reflect.Type]bool)
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct || seen[t] {
+			return
+		}
+		seen[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" && !f.Anonymous {
+				continue
+			}
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if f.Anonymous && len(name) == 0 {
+				walk(f.Type)
+				continue
+			}
+			if len(name) == 0 {
+				name = f.Name
+			}
+			keys = append(keys, name)
+			walk(f.Type)
+		}
+	}
+	if t != nil {
+		walk(t)
+	}
+	return keys
+}
@@ -0,0 +1,52 @@
+package strictjson
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+type link struct {
+	Latency string
+	Loss    float64
+}
+
+type scenario struct {
+	Default *link
+	Links   []link `json:"links"`
+	Period  time.Duration
+}
+
+func Test_Decode(t *testing.T) {
+	var s scenario
+	if err := Decode("ok.json", []byte(`{"Default": {"Loss": 0.1}, "links": [{"Latency": "1ms"}]}`+"\n"), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Default.Loss != 0.1 || len(s.Links) != 1 || s.Links[0].Latency != "1ms" {
+		t.Errorf("decoded %+v", s)
+	}
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"{\n  \"links\": [\n    {\"Latencey\": \"1ms\"}\n  ]\n}", `s.json:3:6: unknown key "Latencey", did you mean "Latency"?`},
+		{"{\"Default\": {\"Loss\": \"high\"}}", `s.json:1:22: Default.Loss: cannot use string as float64`},
+		{"{\"Links\": [}", `s.json:1:12: invalid character '}' looking for beginning of value`},
+		{"{}\n{}", `s.json:2:1: unexpected data after the value`},
+		{"{\"Period\": 1500, \"Links\": {}}", `s.json:1:27: Links: cannot use object as []strictjson.link`},
+		{"{\"Default\": {\"Loss\": true}}", `s.json:1:22: Default.Loss: cannot use bool as float64`},
+		{"{\"Zone\": 1}", `s.json:1:2: unknown key "Zone"`},
+		{"", `s.json: empty input`},
+	}
+	for _, tt := range tests {
+		var s scenario
+		err := Decode("s.json", []byte(tt.input), &s)
+		if err == nil {
+			t.Errorf("Decode(%q) should fail", tt.input)
+			continue
+		}
+		if got := err.Error(); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("Decode(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
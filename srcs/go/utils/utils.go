@@ -23,11 +23,25 @@ func LogArgs() {
 func LogEnvWithPrefix(prefix string, logPrefix string) {
 	for _, kv := range os.Environ() {
 		if strings.HasPrefix(kv, prefix) {
+			if i := strings.Index(kv, "="); i >= 0 && IsSecret(kv[:i]) {
+				kv = kv[:i+1] + "<redacted>"
+			}
 			fmt.Printf("[%s]: %s\n", logPrefix, kv)
 		}
 	}
 }
 
+// IsSecret tells if a named value is a secret, e.g. KUNGFU_CONFIG_STATE_KEY, API_TOKEN, --password
+func IsSecret(name string) bool {
+	name = strings.ToUpper(strings.TrimLeft(name, "-"))
+	for _, s := range []string{`TOKEN`, `SECRET`, `PASSWORD`, `PASSWD`, `CREDENTIAL`} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return name == `KEY` || strings.HasSuffix(name, `_KEY`) || strings.HasSuffix(name, `-KEY`)
+}
+
 func LogCudaEnv() {
 	LogEnvWithPrefix(`CUDA_`, `cuda-env`)
 }
@@ -74,6 +88,19 @@ func Measure(f func() error) (time.Duration, error) {
 	return d, err
 }
 
+// MeasureWork measures f as Measure does, f reports the duration of its actual work,
+// excluding the overhead such as setting up connections and spawning processes.
+// The measured duration is used if f reports none.
+func MeasureWork(f func() (time.Duration, error)) (time.Duration, time.Duration, error) {
+	t0 := time.Now()
+	work, err := f()
+	d := time.Since(t0)
+	if work <= 0 {
+		work = d
+	}
+	return d, work, err
+}
+
 func Rate(n int64, d time.Duration) float64 {
 	return float64(n) / (float64(d) / float64(time.Second))
 }
@@ -94,6 +121,23 @@ func ShowRate(r float64) string {
 	}
 }
 
+// ShowSize formats a number of bytes in binary units
+func ShowSize(n int64) string {
+	const Ki = 1 << 10
+	const Mi = 1 << 20
+	const Gi = 1 << 30
+	switch {
+	case n > Gi:
+		return fmt.Sprintf("%.2f GiB", float64(n)/float64(Gi))
+	case n > Mi:
+		return fmt.Sprintf("%.2f MiB", float64(n)/float64(Mi))
+	case n > Ki:
+		return fmt.Sprintf("%.2f KiB", float64(n)/float64(Ki))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
 func ListNvidiaGPUNames() []string {
 	const prefix = `/dev/`
 	files, err := filepath.Glob(prefix + `nvidia*`)
@@ -32,3 +32,12 @@ func Test_Poll_Fail(t *testing.T) {
 	assert.True(!ok)
 	assert.True(failed == 2)
 }
+
+func Test_IsSecret(t *testing.T) {
+	for _, name := range []string{`KUNGFU_CONFIG_STATE_KEY`, `KUNGFU_CONFIG_DEBUG_TOKEN`, `AWS_SECRET_ACCESS_KEY`, `--password`, `key`} {
+		assert.True(IsSecret(name))
+	}
+	for _, name := range []string{`KUNGFU_CONFIG_STATE_KEY_CMD`, `NCCL_DEBUG`, `KEYBOARD`} {
+		assert.True(!IsSecret(name))
+	}
+}
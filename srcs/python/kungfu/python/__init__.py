@@ -1,14 +1,32 @@
 import atexit
+import ctypes
+import os
 
 from kungfu.loader import _call_method, _load_clib, _module_path
 
 __all__ = [
+    'all_gather',
+    'all_reduce',
+    'broadcast',
     'current_cluster_size',
     'current_local_rank',
     'current_local_size',
     'current_rank',
+    'current_role',
+    'current_role_rank',
+    'current_role_size',
+    'current_seed',
     'detached',
+    'get_tunable',
+    'kv_get',
+    'kv_put',
     'run_barrier',
+    'run_named_barrier',
+    'begin_step',
+    'check_tensor_schema',
+    'declare_tensor',
+    'end_step',
+    'step_fence',
 ]
 
 
@@ -37,6 +55,12 @@ def uid():
     return _python_lib.kungfu_uid()
 
 
+def current_seed():
+    """Get the random seed of the current rank, which is different for each rank and changes after resize."""
+    _python_lib.kungfu_seed.restype = ctypes.c_uint64
+    return _python_lib.kungfu_seed()
+
+
 def detached():
     """Check if the peer is detached."""
     return bool(_python_lib.kungfu_detached())
@@ -62,6 +86,21 @@ def current_local_size():
     return _python_lib.kungfu_local_size()
 
 
+def current_role():
+    """Get the role of this peer given by -role of kungfu-run, empty if not given."""
+    return os.getenv('KUNGFU_ROLE', '')
+
+
+def current_role_rank():
+    """Get the current rank among peers of the same role."""
+    return _python_lib.kungfu_role_rank()
+
+
+def current_role_size():
+    """Get the number of peers of the same role in the current cluster."""
+    return _python_lib.kungfu_role_size()
+
+
 def _get_cuda_index():
     return _python_lib.kungfu_get_cuda_index()
 
@@ -71,6 +110,138 @@ def run_barrier():
     _python_lib.kungfu_barrier()
 
 
+def run_named_barrier(name, timeout=60):
+    """Wait for all peers to reach the barrier of the same name, raise if some don't arrive within timeout seconds."""
+    err = _python_lib.kungfu_named_barrier(name.encode(), int(timeout * 1000))
+    if err != 0:
+        raise RuntimeError('barrier %s timed out, see the log for the missing ranks' % name)
+
+
+def step_fence():
+    """Call once per step on all peers, it blocks while the job is paused by kungfu-ctl."""
+    _python_lib.kungfu_step_fence()
+
+
+def begin_step():
+    """Mark the start of a step, the cluster doesn't change until end_step."""
+    err = _python_lib.kungfu_begin_step()
+    if err != 0:
+        raise RuntimeError('begin_step failed')
+
+
+def end_step():
+    """Call at the end of each step on all peers, it runs step_fence and applies the cluster changes of the config server.
+    Returns whether the cluster changed, and whether this peer is detached from it."""
+    changed = ctypes.c_bool()
+    detached = ctypes.c_bool()
+    err = _python_lib.kungfu_end_step(ctypes.byref(changed), ctypes.byref(detached))
+    if err != 0:
+        raise RuntimeError('end_step failed')
+    return changed.value, detached.value
+
+
+def _dtype_code(dtype):
+    # see TYPE_CODE in kungfu/dtype.h
+    import numpy as np
+    dt = np.dtype(getattr(dtype, 'as_numpy_dtype', dtype))
+    category = {'u': 0, 'i': 1, 'f': 2, 'b': 3}[dt.kind]
+    return (category << 16) | (dt.itemsize << 8) | 8
+
+
+def declare_tensor(name, dtype, shape):
+    """Declare a tensor to be reduced under name, with a numpy or tensorflow dtype."""
+    shape = [int(d) for d in shape]
+    c_shape = (ctypes.c_int * len(shape))(*shape)
+    err = _python_lib.kungfu_declare_tensor(name.encode(), _dtype_code(dtype), c_shape, len(shape))
+    if err != 0:
+        raise ValueError('tensor %s redeclared with another dtype or shape' % name)
+
+
+def check_tensor_schema():
+    """Call on all peers after declare_tensor, raise if peers declared different tensors, the difference is logged.
+    It is also checked after every resize, which fails the job on mismatch."""
+    err = _python_lib.kungfu_check_tensor_schema()
+    if err != 0:
+        raise RuntimeError('tensor schema diverges among peers, see the log for the tensor')
+
+
+_ops = {'sum': 0, 'min': 1, 'max': 2, 'prod': 3}  # see KungFu_Op in kungfu/op.h
+
+
+def _buffer(x):
+    return x.ctypes.data_as(ctypes.c_void_p)
+
+
+def all_reduce(x, op='sum', name=None, stream=''):
+    """Reduce the numpy array x of all peers by op, and return the result.
+    Collectives on different streams can be called concurrently, e.g. for gradients and EMA weights,
+    their chunks are sent in turn, they are matched by name."""
+    import numpy as np
+    x = np.ascontiguousarray(x)
+    y = np.empty_like(x)
+    name = name or 'kungfu::python::all_reduce'
+    err = _python_lib.kungfu_all_reduce(_buffer(x), _buffer(y), x.size, _dtype_code(x.dtype), _ops[op], name.encode(),
+                                        stream.encode())
+    if err != 0:
+        raise RuntimeError('all_reduce %s failed' % name)
+    return y
+
+
+def broadcast(x, name=None, stream=''):
+    """Return the numpy array x of rank 0, see all_reduce for stream."""
+    import numpy as np
+    x = np.ascontiguousarray(x)
+    y = np.empty_like(x)
+    name = name or 'kungfu::python::broadcast'
+    err = _python_lib.kungfu_broadcast(_buffer(x), _buffer(y), x.size, _dtype_code(x.dtype), name.encode(),
+                                       stream.encode())
+    if err != 0:
+        raise RuntimeError('broadcast %s failed' % name)
+    return y
+
+
+def all_gather(x, name=None, stream=''):
+    """Return the numpy arrays x of all peers stacked by rank, see all_reduce for stream."""
+    import numpy as np
+    x = np.ascontiguousarray(x)
+    y = np.empty((current_cluster_size(), ) + x.shape, dtype=x.dtype)
+    name = name or 'kungfu::python::all_gather'
+    err = _python_lib.kungfu_all_gather(_buffer(x), x.size, _dtype_code(x.dtype), _buffer(y), name.encode(),
+                                        stream.encode())
+    if err != 0:
+        raise RuntimeError('all_gather %s failed' % name)
+    return y
+
+
+def kv_put(key, value):
+    """Set key to value of bytes in the cluster metadata store, which survives resizes, kungfu-run must be in watch mode."""
+    value = bytes(value)
+    err = _python_lib.kungfu_kv_put(key.encode(), value, len(value))
+    if err != 0:
+        raise RuntimeError('kv_put %s failed' % key)
+
+
+def kv_get(key):
+    """Get the value of key in the cluster metadata store, None if the key doesn't exist."""
+    size = _python_lib.kungfu_kv_get(key.encode(), None, 0)
+    while size > 0:
+        buf = ctypes.create_string_buffer(size)
+        n = _python_lib.kungfu_kv_get(key.encode(), buf, size)
+        if n <= size:
+            return buf.raw[:n]
+        size = n
+    return None if size < 0 else b''
+
+
+def get_tunable(name):
+    """Get the runtime knob in effect, e.g. fusion-buffer-size, which is changed by kungfu-ctl tune at step_fence."""
+    _python_lib.kungfu_get_tunable.restype = ctypes.c_int64
+    value = _python_lib.kungfu_get_tunable(name.encode())
+    if value < 0:
+        raise ValueError('unknown tunable %s' % name)
+    return value
+
+
 def propose_new_size(new_size):
     # FIXME: check ctypes
     _python_lib.kungfu_propose_new_size(int(new_size))
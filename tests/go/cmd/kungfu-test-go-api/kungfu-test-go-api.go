@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu"
+	"github.com/lsds/KungFu/srcs/go/utils/assert"
+)
+
+var n = flag.Int("n", 1<<20, "number of elements")
+
+func main() {
+	flag.Parse()
+	assert.OK(kungfu.Init())
+	defer kungfu.Finalize()
+	rank, np := kungfu.Rank(), kungfu.ClusterSize()
+
+	x := make([]float32, *n)
+	for i := range x {
+		x[i] = float32(rank + 1)
+	}
+	assert.OK(kungfu.AllReduce(x, kungfu.SUM))
+	for _, a := range x {
+		assert.True(a == float32(np*(np+1)/2))
+	}
+	assert.OK(kungfu.AllReduce(x[:1], kungfu.MAX))
+
+	y := []float32{float32(rank)}
+	assert.OK(kungfu.Broadcast(y))
+	assert.True(y[0] == 0)
+
+	assert.OK(kungfu.Barrier())
+	fmt.Printf("rank %d/%d OK\n", rank, np)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/lsds/KungFu/srcs/go/kungfu"
+	"github.com/lsds/KungFu/srcs/go/utils/assert"
+)
+
+var (
+	steps     = flag.Int("steps", 20, "number of steps")
+	stepTime  = flag.Duration("step-time", 0, "duration of each step, for kungfu-ctl migrate-rank to happen during the run")
+	migrateAt = flag.Int("migrate-at", 10, "call kungfu.MigrateRank after this step")
+	target    = flag.Int("rank", 1, "rank to migrate")
+	host      = flag.String("host", "", "internal IP of the host to migrate the rank to, the rank is left to kungfu-ctl migrate-rank if empty")
+)
+
+// Each step checks that the replacement of the migrated peer continues from the step of the migrated peer,
+// and that its collectives match those of the other peers.
+func main() {
+	flag.Parse()
+	assert.OK(kungfu.Init())
+	defer kungfu.Finalize()
+	p := kungfu.Peer()
+	if p.Steps() > 0 {
+		fmt.Printf("rank %d resumed after step %d\n", kungfu.Rank(), p.Steps())
+	}
+	for p.Steps() < *steps {
+		step := p.Steps()
+		assert.OK(kungfu.BeginStep())
+		rank, np := kungfu.Rank(), kungfu.ClusterSize()
+		x := []float32{float32(rank + 1)}
+		assert.OK(kungfu.AllReduce(x, kungfu.SUM))
+		assert.True(x[0] == float32(np*(np+1)/2))
+		y := []float32{float32(step)}
+		assert.OK(kungfu.Broadcast(y))
+		if int(y[0]) != step {
+			panic(fmt.Sprintf("rank %d is at step %d, rank 0 is at step %d", rank, step, int(y[0])))
+		}
+		time.Sleep(*stepTime)
+		changed, detached, err := kungfu.EndStep()
+		assert.OK(err)
+		if p.Steps() == *migrateAt && len(*host) > 0 {
+			changed, detached, err = kungfu.MigrateRank(*target, *host)
+			assert.OK(err)
+		}
+		if changed {
+			fmt.Printf("rank %d: cluster changed after step %d\n", rank, step)
+		}
+		if detached {
+			fmt.Printf("rank %d migrated after step %d\n", rank, step)
+			return
+		}
+	}
+	fmt.Printf("rank %d/%d finished %d steps\n", kungfu.Rank(), kungfu.ClusterSize(), p.Steps())
+}
@@ -14,6 +14,9 @@ import (
 	"github.com/lsds/KungFu/srcs/go/utils"
 )
 
+// waitPeriod is the period WaitServer polls the server at
+const waitPeriod = 200 * time.Millisecond
+
 type Client struct {
 	endpoint string
 	client   http.Client
@@ -55,15 +58,23 @@ func (cc *Client) Update(cluster plan.Cluster) error {
 }
 
 func (cc *Client) WaitServer() error {
-	utils.Poll(context.TODO(), func() bool {
+	return cc.WaitServerContext(context.TODO())
+}
+
+// WaitServerContext waits until the server responds, or ctx is done
+func (cc *Client) WaitServerContext(ctx context.Context) error {
+	if _, ok := utils.Poll(ctx, func() bool {
 		resp, err := cc.client.Get(cc.endpoint)
 		if err == nil {
 			resp.Body.Close()
 		} else {
 			log.Warnf("config server is not ready: %v", err)
+			time.Sleep(waitPeriod)
 		}
 		return err == nil
-	})
+	}); !ok {
+		return ctx.Err()
+	}
 	return nil
 }
 